@@ -3,10 +3,12 @@ package main
 import (
 	"net/url"
 	"os"
+	"time"
 
 	"github.com/apex/log"
 	"github.com/deviceplane/deviceplane/pkg/agent"
 	agent_client "github.com/deviceplane/deviceplane/pkg/agent/client"
+	"github.com/deviceplane/deviceplane/pkg/agent/metrics"
 	"github.com/deviceplane/deviceplane/pkg/engine/docker"
 	dphttp "github.com/deviceplane/deviceplane/pkg/http"
 	"github.com/segmentio/conf"
@@ -23,6 +25,15 @@ var config struct {
 	StateDir          string `conf:"state-dir"`
 	ServerPort        int    `conf:"server-port"`
 	LogLevel          string `conf:"log-level"`
+
+	AccessKeyRotationInterval time.Duration `conf:"access-key-rotation-interval"`
+	TLSClientAuth             bool          `conf:"tls-client-auth"`
+	MetricsBufferSize         int64         `conf:"metrics-buffer-size"`
+	MetricsBufferMaxAge       time.Duration `conf:"metrics-buffer-max-age"`
+	MetricsTextfileDir        string        `conf:"metrics-textfile-dir"`
+	MetricsScriptDir          string        `conf:"metrics-script-dir"`
+	MetricsScriptTimeout      time.Duration `conf:"metrics-script-timeout"`
+	MetricsScriptInterval     time.Duration `conf:"metrics-script-interval"`
 }
 
 func init() {
@@ -31,6 +42,13 @@ func init() {
 	config.StateDir = "/var/lib/deviceplane"
 	config.ServerPort = 4444
 	config.LogLevel = "info"
+	config.AccessKeyRotationInterval = 7 * 24 * time.Hour
+	config.MetricsBufferSize = 50 * 1024 * 1024
+	config.MetricsBufferMaxAge = 24 * time.Hour
+	config.MetricsTextfileDir = "/var/lib/deviceplane/textfile-metrics"
+	config.MetricsScriptDir = "/etc/deviceplane/metrics-scripts"
+	config.MetricsScriptTimeout = metrics.DefaultScriptTimeout
+	config.MetricsScriptInterval = metrics.DefaultScriptInterval
 }
 
 func main() {
@@ -47,6 +65,12 @@ func main() {
 		log.WithError(err).Fatal("create docker client")
 	}
 
+	// Host metrics are served by a single handler that's created on first use
+	metrics.DefaultNodeCollectorConfig.TextfileDirectory = config.MetricsTextfileDir
+	metrics.DefaultNodeCollectorConfig.ScriptDirectory = config.MetricsScriptDir
+	metrics.DefaultNodeCollectorConfig.ScriptTimeout = config.MetricsScriptTimeout
+	metrics.DefaultNodeCollectorConfig.ScriptInterval = config.MetricsScriptInterval
+
 	controllerURL, err := url.Parse(config.Controller)
 	if err != nil {
 		log.WithError(err).Fatal("parse controller URL")
@@ -54,7 +78,8 @@ func main() {
 
 	client := agent_client.NewClient(controllerURL, config.Project, dphttp.DefaultClient)
 	agent, err := agent.NewAgent(client, engine, config.Project, config.RegistrationToken,
-		config.ConfDir, config.StateDir, version, os.Args[0], config.ServerPort)
+		config.ConfDir, config.StateDir, version, os.Args[0], config.ServerPort, config.AccessKeyRotationInterval, config.TLSClientAuth,
+		config.MetricsBufferSize, config.MetricsBufferMaxAge)
 	if err != nil {
 		log.WithError(err).Fatal("failure creating agent")
 	}
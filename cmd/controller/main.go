@@ -1,6 +1,8 @@
 package main
 
 import (
+	"context"
+	"crypto/tls"
 	"database/sql"
 	"net/http"
 	"net/url"
@@ -9,6 +11,9 @@ import (
 	"github.com/DataDog/datadog-go/statsd"
 	"github.com/apex/log"
 	"github.com/deviceplane/deviceplane/pkg/controller/connman"
+	"github.com/deviceplane/deviceplane/pkg/controller/jobs"
+	"github.com/deviceplane/deviceplane/pkg/controller/metricstorage"
+	"github.com/deviceplane/deviceplane/pkg/controller/oidc"
 	"github.com/deviceplane/deviceplane/pkg/controller/service"
 	mysql_store "github.com/deviceplane/deviceplane/pkg/controller/store/mysql"
 	"github.com/deviceplane/deviceplane/pkg/email"
@@ -80,6 +85,65 @@ var (
 	auth0Audience = kingpin.
 			Flag("auth0-audience", "").
 			String()
+	oidcDiscoveryURL = kingpin.
+				Flag("oidc-discovery-url", "").
+				String()
+	oidcClientID = kingpin.
+			Flag("oidc-client-id", "").
+			String()
+	oidcProviderName = kingpin.
+				Flag("oidc-provider-name", "").
+				String()
+	oidcEmailClaim = kingpin.
+			Flag("oidc-email-claim", "").
+			Default("email").
+			String()
+	oidcNameClaim = kingpin.
+			Flag("oidc-name-claim", "").
+			Default("name").
+			String()
+	oidcGroupsClaim = kingpin.
+			Flag("oidc-groups-claim", "").
+			Default("groups").
+			String()
+	tlsCert = kingpin.
+		Flag("tls-cert", "").
+		String()
+	tlsKey = kingpin.
+		Flag("tls-key", "").
+		String()
+	metricStorageEnabled = kingpin.
+				Flag("metric-storage", "").
+				Bool()
+	metricStorageRetention = kingpin.
+				Flag("metric-storage-retention", "").
+				Default("2160h").
+				Duration()
+	jobWorkers = kingpin.
+			Flag("job-workers", "").
+			Default("4").
+			Int()
+	sessionTTL = kingpin.
+			Flag("session-ttl", "").
+			Default("720h").
+			Duration()
+	// Roles granted by SSO group mappings are revoked once a user hasn't
+	// logged in through SSO for this long, since that's the only time the
+	// controller learns their groups. Zero keeps them until the next login.
+	ssoGroupTTL = kingpin.
+			Flag("sso-group-ttl", "").
+			Default("24h").
+			Duration()
+	// Metrics sinks can only be sent to loopback, private or link-local
+	// addresses if their host is allowed here
+	metricsSinkAllowedHosts = kingpin.
+				Flag("metrics-sink-allowed-host", "").
+				Strings()
+	// Only set this when a proxy in front of the controller terminates TLS
+	// and overwrites the header, otherwise devices could be impersonated
+	clientCertificateHeader = kingpin.
+				Flag("client-certificate-header", "").
+				String()
 )
 
 func main() {
@@ -117,12 +181,28 @@ func main() {
 
 	connman := connman.New()
 
+	var metricStorage *metricstorage.Storage
+	if *metricStorageEnabled {
+		if *metricStorageRetention < metricstorage.MinRetention {
+			log.Fatal("metric storage retention must be at least " + metricstorage.MinRetention.String())
+		}
+		metricStorage = metricstorage.New(sqlStore, *metricStorageRetention)
+		go metricStorage.Run(context.Background())
+	}
+
+	jobRunner := jobs.NewRunner(sqlStore, *jobWorkers)
+
 	svc := service.NewService(sqlStore, sqlStore, sqlStore, sqlStore, sqlStore, sqlStore, sqlStore, sqlStore,
-		sqlStore, sqlStore, sqlStore, sqlStore, sqlStore, sqlStore, sqlStore, sqlStore, sqlStore, sqlStore, sqlStore,
-		sqlStore, sqlStore, sqlStore, sqlStore, sqlStore, sqlStore, sqlStore, sqlStore, sqlStore, sqlStore,
+		sqlStore, sqlStore, sqlStore, sqlStore, sqlStore, sqlStore, sqlStore, sqlStore, sqlStore, sqlStore, sqlStore, sqlStore,
+		sqlStore, sqlStore, sqlStore, sqlStore, sqlStore, sqlStore, sqlStore, sqlStore, sqlStore, sqlStore, sqlStore, sqlStore, sqlStore, sqlStore,
+		sqlStore, sqlStore, sqlStore, sqlStore, sqlStore, sqlStore, sqlStore, sqlStore,
 		emailProvider, *emailFromName, *emailFromAddress, *allowedEmailDomains,
-		*auth0Domain, *auth0Audience,
-		statikFS, st, connman, allowedOriginURLs)
+		getOIDCProvider(), *clientCertificateHeader, *sessionTTL, *ssoGroupTTL, *metricsSinkAllowedHosts,
+		statikFS, st, connman, metricStorage, jobRunner, allowedOriginURLs)
+
+	// Job types are registered by the service, so the runner starts after it
+	go jobRunner.Run(context.Background())
+	go svc.RunSsoGroupExpiry(context.Background())
 
 	server := &http.Server{
 		Addr: *addr,
@@ -135,6 +215,17 @@ func main() {
 	}
 
 	log.Info("Server will now listen on " + *addr)
+	if *tlsCert != "" {
+		// Client certificates are verified against each project's
+		// certificate authority when devices authenticate
+		server.TLSConfig = &tls.Config{
+			ClientAuth: tls.RequestClientCert,
+		}
+		if err := server.ListenAndServeTLS(*tlsCert, *tlsKey); err != nil {
+			log.WithError(err).Fatal("listen and serve TLS")
+		}
+		return
+	}
 	if err := server.ListenAndServe(); err != nil {
 		log.WithError(err).Fatal("listen and serve")
 	}
@@ -182,3 +273,24 @@ func getEmailProvider(emailProvider string) email.Interface {
 		return nil
 	}
 }
+
+// getOIDCProvider returns nil when SSO isn't configured. The Auth0 flags are
+// still honored since Auth0 tenants serve a standard discovery document.
+func getOIDCProvider() *oidc.Provider {
+	config := oidc.Config{
+		DiscoveryURL: *oidcDiscoveryURL,
+		ClientID:     *oidcClientID,
+		ProviderName: *oidcProviderName,
+		EmailClaim:   *oidcEmailClaim,
+		NameClaim:    *oidcNameClaim,
+		GroupsClaim:  *oidcGroupsClaim,
+	}
+	if config.DiscoveryURL == "" && *auth0Domain != nil && *auth0Audience != "" {
+		config.DiscoveryURL = (*auth0Domain).String()
+		config.ClientID = *auth0Audience
+	}
+	if config.DiscoveryURL == "" || config.ClientID == "" {
+		return nil
+	}
+	return oidc.NewProvider(config, nil)
+}
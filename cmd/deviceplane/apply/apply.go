@@ -0,0 +1,53 @@
+package apply
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/pkg/errors"
+	kingpin "gopkg.in/alecthomas/kingpin.v2"
+)
+
+func applyAction(c *kingpin.ParseContext) error {
+	m, err := loadManifests(*fileListFlag)
+	if err != nil {
+		return errors.Wrap(err, "failed to load manifests")
+	}
+
+	s, err := fetchState(context.TODO(), config.APIClient, *config.Flags.Project)
+	if err != nil {
+		return err
+	}
+
+	changes, err := computePlan(*m, *s, *pruneFlag)
+	if err != nil {
+		return err
+	}
+
+	if len(changes) == 0 {
+		fmt.Println("No changes. Project is up to date.")
+		return nil
+	}
+
+	counts := make(map[operation]int)
+	for _, change := range changes {
+		counts[change.operation]++
+		fmt.Println(change)
+	}
+	fmt.Printf("\nPlan: %d to create, %d to update, %d to delete.\n",
+		counts[operationCreate], counts[operationUpdate], counts[operationDelete])
+
+	if *dryRunFlag {
+		return nil
+	}
+
+	fmt.Println()
+	for _, change := range changes {
+		if err := change.apply(context.TODO(), config.APIClient, *config.Flags.Project); err != nil {
+			return errors.Wrapf(err, "failed to apply %s %s", change.kind, change.name)
+		}
+		fmt.Printf("Applied %s %s\n", change.kind, change.name)
+	}
+
+	return nil
+}
@@ -0,0 +1,23 @@
+package apply
+
+import (
+	"github.com/deviceplane/deviceplane/cmd/deviceplane/global"
+)
+
+var (
+	fileListFlag *[]string = &[][]string{[]string{}}[0]
+	pruneFlag    *bool     = &[]bool{false}[0]
+	dryRunFlag   *bool     = &[]bool{false}[0]
+
+	config *global.Config
+)
+
+func Initialize(c *global.Config) {
+	config = c
+
+	applyCmd := c.App.Command("apply", "Apply a directory of manifests to a project.")
+	applyCmd.Flag("filename", "Manifest file or directory of manifests. Can be repeated.").Short('f').Required().StringsVar(fileListFlag)
+	applyCmd.Flag("prune", "Delete resources of the kinds present in the manifests that are not declared in them. The default roles and device registration token are kept.").BoolVar(pruneFlag)
+	applyCmd.Flag("dry-run", "Only show the plan, don't apply it.").BoolVar(dryRunFlag)
+	applyCmd.Action(applyAction)
+}
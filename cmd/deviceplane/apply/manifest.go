@@ -0,0 +1,229 @@
+package apply
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/deviceplane/deviceplane/pkg/controller/authz"
+	"github.com/deviceplane/deviceplane/pkg/models"
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v2"
+)
+
+type Kind string
+
+const (
+	KindRole                    = Kind("Role")
+	KindConnection              = Kind("Connection")
+	KindDeviceRegistrationToken = Kind("DeviceRegistrationToken")
+	KindApplication             = Kind("Application")
+)
+
+// Kinds are listed in the order their creations and updates are applied.
+// Deletions are applied in reverse order.
+var kinds = []Kind{
+	KindRole,
+	KindConnection,
+	KindDeviceRegistrationToken,
+	KindApplication,
+}
+
+type manifestHeader struct {
+	Kind Kind   `yaml:"kind"`
+	Name string `yaml:"name"`
+}
+
+type roleManifest struct {
+	Kind        Kind         `yaml:"kind"`
+	Name        string       `yaml:"name"`
+	Description string       `yaml:"description,omitempty"`
+	Config      authz.Config `yaml:"config"`
+}
+
+type connectionManifest struct {
+	Kind     Kind            `yaml:"kind"`
+	Name     string          `yaml:"name"`
+	Protocol models.Protocol `yaml:"protocol"`
+	Port     uint            `yaml:"port"`
+}
+
+type deviceRegistrationTokenManifest struct {
+	Kind                 Kind              `yaml:"kind"`
+	Name                 string            `yaml:"name"`
+	Description          string            `yaml:"description,omitempty"`
+	MaxRegistrations     *int              `yaml:"maxRegistrations,omitempty"`
+	Labels               map[string]string `yaml:"labels,omitempty"`
+	EnvironmentVariables map[string]string `yaml:"environmentVariables,omitempty"`
+}
+
+type applicationManifest struct {
+	Kind                  Kind                                   `yaml:"kind"`
+	Name                  string                                 `yaml:"name"`
+	Description           string                                 `yaml:"description,omitempty"`
+	SchedulingRule        *models.SchedulingRule                 `yaml:"schedulingRule,omitempty"`
+	MetricEndpointConfigs map[string]models.MetricEndpointConfig `yaml:"metricEndpointConfigs,omitempty"`
+	Release               yaml.MapSlice                          `yaml:"release,omitempty"`
+	ReleaseFile           string                                 `yaml:"releaseFile,omitempty"`
+
+	rawRelease string
+}
+
+type manifests struct {
+	roles                    []roleManifest
+	connections              []connectionManifest
+	deviceRegistrationTokens []deviceRegistrationTokenManifest
+	applications             []applicationManifest
+}
+
+func (m *manifests) hasKind(kind Kind) bool {
+	switch kind {
+	case KindRole:
+		return len(m.roles) > 0
+	case KindConnection:
+		return len(m.connections) > 0
+	case KindDeviceRegistrationToken:
+		return len(m.deviceRegistrationTokens) > 0
+	case KindApplication:
+		return len(m.applications) > 0
+	}
+	return false
+}
+
+func loadManifests(paths []string) (*manifests, error) {
+	var files []string
+	for _, path := range paths {
+		err := filepath.Walk(path, func(file string, info os.FileInfo, err error) error {
+			if err != nil {
+				return err
+			}
+			if info.IsDir() {
+				return nil
+			}
+			// Explicitly named files are always read, files found while
+			// walking a directory only if they look like YAML
+			if file != path {
+				ext := filepath.Ext(file)
+				if ext != ".yaml" && ext != ".yml" {
+					return nil
+				}
+			}
+			files = append(files, file)
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	var m manifests
+	seen := make(map[Kind]map[string]string)
+	for _, file := range files {
+		fileBytes, err := ioutil.ReadFile(file)
+		if err != nil {
+			return nil, err
+		}
+
+		decoder := yaml.NewDecoder(bytes.NewReader(fileBytes))
+		for {
+			var document yaml.MapSlice
+			if err := decoder.Decode(&document); err == io.EOF {
+				break
+			} else if err != nil {
+				return nil, errors.Wrap(err, file)
+			}
+			if len(document) == 0 {
+				continue
+			}
+
+			documentBytes, err := yaml.Marshal(document)
+			if err != nil {
+				return nil, errors.Wrap(err, file)
+			}
+
+			header, err := m.add(documentBytes, filepath.Dir(file))
+			if err != nil {
+				return nil, errors.Wrap(err, file)
+			}
+
+			if seen[header.Kind] == nil {
+				seen[header.Kind] = make(map[string]string)
+			}
+			if previousFile, ok := seen[header.Kind][header.Name]; ok {
+				return nil, fmt.Errorf("%s %s is declared in both %s and %s", header.Kind, header.Name, previousFile, file)
+			}
+			seen[header.Kind][header.Name] = file
+		}
+	}
+
+	return &m, nil
+}
+
+func (m *manifests) add(document []byte, dir string) (*manifestHeader, error) {
+	var header manifestHeader
+	if err := yaml.Unmarshal(document, &header); err != nil {
+		return nil, err
+	}
+	if header.Name == "" {
+		return nil, fmt.Errorf("%s is missing a name", header.Kind)
+	}
+
+	switch header.Kind {
+	case KindRole:
+		var role roleManifest
+		if err := yaml.UnmarshalStrict(document, &role); err != nil {
+			return nil, err
+		}
+		m.roles = append(m.roles, role)
+	case KindConnection:
+		var connection connectionManifest
+		if err := yaml.UnmarshalStrict(document, &connection); err != nil {
+			return nil, err
+		}
+		m.connections = append(m.connections, connection)
+	case KindDeviceRegistrationToken:
+		var token deviceRegistrationTokenManifest
+		if err := yaml.UnmarshalStrict(document, &token); err != nil {
+			return nil, err
+		}
+		m.deviceRegistrationTokens = append(m.deviceRegistrationTokens, token)
+	case KindApplication:
+		var application applicationManifest
+		if err := yaml.UnmarshalStrict(document, &application); err != nil {
+			return nil, err
+		}
+		if application.Release != nil && application.ReleaseFile != "" {
+			return nil, fmt.Errorf("application %s sets both release and releaseFile", application.Name)
+		}
+		if application.ReleaseFile != "" {
+			releaseFile := application.ReleaseFile
+			if !filepath.IsAbs(releaseFile) {
+				releaseFile = filepath.Join(dir, releaseFile)
+			}
+			releaseBytes, err := ioutil.ReadFile(releaseFile)
+			if err != nil {
+				return nil, err
+			}
+			application.rawRelease = string(releaseBytes)
+		} else if application.Release != nil {
+			releaseBytes, err := yaml.Marshal(application.Release)
+			if err != nil {
+				return nil, err
+			}
+			application.rawRelease = string(releaseBytes)
+		}
+		m.applications = append(m.applications, application)
+	default:
+		var kindNames []string
+		for _, kind := range kinds {
+			kindNames = append(kindNames, string(kind))
+		}
+		return nil, fmt.Errorf(`unknown kind "%s", expected one of %s`, header.Kind, strings.Join(kindNames, ", "))
+	}
+
+	return &header, nil
+}
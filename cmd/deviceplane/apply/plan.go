@@ -0,0 +1,578 @@
+package apply
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/deviceplane/deviceplane/pkg/client"
+	"github.com/deviceplane/deviceplane/pkg/controller/authz"
+	"github.com/deviceplane/deviceplane/pkg/models"
+	"gopkg.in/yaml.v2"
+)
+
+type operation string
+
+const (
+	operationCreate = operation("+")
+	operationUpdate = operation("~")
+	operationDelete = operation("-")
+)
+
+type change struct {
+	operation operation
+	kind      Kind
+	name      string
+	details   []string
+	apply     func(ctx context.Context, c *client.Client, project string) error
+}
+
+func (c change) String() string {
+	s := fmt.Sprintf("%s %s %s", c.operation, c.kind, c.name)
+	if len(c.details) > 0 {
+		s += " (" + strings.Join(c.details, ", ") + ")"
+	}
+	return s
+}
+
+// Every project is created with these roles and device registration token.
+// They're never pruned, since deleting them can lock everyone out of the
+// project.
+var (
+	defaultRoleNames = map[string]bool{
+		"admin-all": true,
+		"write-all": true,
+		"read-all":  true,
+	}
+	defaultDeviceRegistrationTokenName = "default"
+)
+
+type state struct {
+	roles                    []models.Role
+	connections              []models.Connection
+	deviceRegistrationTokens []models.DeviceRegistrationToken
+	applications             []models.ApplicationFull1
+}
+
+func fetchState(ctx context.Context, c *client.Client, project string) (*state, error) {
+	var s state
+	var err error
+
+	if s.roles, err = c.ListRoles(ctx, project); err != nil {
+		return nil, err
+	}
+	if s.connections, err = c.ListConnections(ctx, project); err != nil {
+		return nil, err
+	}
+	if s.deviceRegistrationTokens, err = c.ListDeviceRegistrationTokens(ctx, project); err != nil {
+		return nil, err
+	}
+	if s.applications, err = c.ListApplicationsFull(ctx, project); err != nil {
+		return nil, err
+	}
+
+	return &s, nil
+}
+
+func computePlan(m manifests, s state, prune bool) ([]change, error) {
+	var changes []change
+	var deletions []change
+
+	for _, kind := range kinds {
+		var kindChanges, kindDeletions []change
+		var err error
+		switch kind {
+		case KindRole:
+			kindChanges, kindDeletions, err = planRoles(m.roles, s.roles)
+		case KindConnection:
+			kindChanges, kindDeletions = planConnections(m.connections, s.connections)
+		case KindDeviceRegistrationToken:
+			kindChanges, kindDeletions = planDeviceRegistrationTokens(m.deviceRegistrationTokens, s.deviceRegistrationTokens)
+		case KindApplication:
+			kindChanges, kindDeletions, err = planApplications(m.applications, s.applications)
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		changes = append(changes, kindChanges...)
+		if prune && m.hasKind(kind) {
+			deletions = append(kindDeletions, deletions...)
+		}
+	}
+
+	return append(changes, deletions...), nil
+}
+
+func planRoles(desired []roleManifest, current []models.Role) ([]change, []change, error) {
+	var changes []change
+	declared := make(map[string]bool)
+
+	for _, d := range desired {
+		d := d
+		declared[d.Name] = true
+
+		configBytes, err := yaml.Marshal(d.Config)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		r := findRole(current, d.Name)
+		if r == nil {
+			changes = append(changes, change{operationCreate, KindRole, d.Name, nil,
+				func(ctx context.Context, c *client.Client, project string) error {
+					_, err := c.CreateRole(ctx, project, d.Name, d.Description, string(configBytes))
+					return err
+				},
+			})
+			continue
+		}
+
+		var details []string
+		if r.Description != d.Description {
+			details = append(details, "description")
+		}
+		var currentConfig authz.Config
+		if err := yaml.Unmarshal([]byte(r.Config), &currentConfig); err != nil {
+			return nil, nil, err
+		}
+		currentConfigBytes, err := yaml.Marshal(currentConfig)
+		if err != nil {
+			return nil, nil, err
+		}
+		if !bytes.Equal(configBytes, currentConfigBytes) {
+			details = append(details, "config")
+		}
+		if len(details) > 0 {
+			changes = append(changes, change{operationUpdate, KindRole, d.Name, details,
+				func(ctx context.Context, c *client.Client, project string) error {
+					_, err := c.UpdateRole(ctx, project, r.ID, d.Name, d.Description, string(configBytes))
+					return err
+				},
+			})
+		}
+	}
+
+	var deletions []change
+	for _, r := range current {
+		r := r
+		if declared[r.Name] || defaultRoleNames[r.Name] {
+			continue
+		}
+		deletions = append(deletions, change{operationDelete, KindRole, r.Name, nil,
+			func(ctx context.Context, c *client.Client, project string) error {
+				return c.DeleteRole(ctx, project, r.ID)
+			},
+		})
+	}
+
+	return changes, deletions, nil
+}
+
+func planConnections(desired []connectionManifest, current []models.Connection) ([]change, []change) {
+	var changes []change
+	declared := make(map[string]bool)
+
+	for _, d := range desired {
+		d := d
+		declared[d.Name] = true
+
+		conn := findConnection(current, d.Name)
+		if conn == nil {
+			changes = append(changes, change{operationCreate, KindConnection, d.Name, nil,
+				func(ctx context.Context, c *client.Client, project string) error {
+					_, err := c.CreateConnection(ctx, project, d.Name, d.Protocol, d.Port)
+					return err
+				},
+			})
+			continue
+		}
+
+		var details []string
+		if conn.Protocol != d.Protocol {
+			details = append(details, "protocol")
+		}
+		if conn.Port != d.Port {
+			details = append(details, "port")
+		}
+		if len(details) > 0 {
+			changes = append(changes, change{operationUpdate, KindConnection, d.Name, details,
+				func(ctx context.Context, c *client.Client, project string) error {
+					_, err := c.UpdateConnection(ctx, project, conn.ID, d.Name, d.Protocol, d.Port)
+					return err
+				},
+			})
+		}
+	}
+
+	var deletions []change
+	for _, conn := range current {
+		conn := conn
+		if declared[conn.Name] {
+			continue
+		}
+		deletions = append(deletions, change{operationDelete, KindConnection, conn.Name, nil,
+			func(ctx context.Context, c *client.Client, project string) error {
+				return c.DeleteConnection(ctx, project, conn.ID)
+			},
+		})
+	}
+
+	return changes, deletions
+}
+
+func planDeviceRegistrationTokens(desired []deviceRegistrationTokenManifest, current []models.DeviceRegistrationToken) ([]change, []change) {
+	var changes []change
+	declared := make(map[string]bool)
+
+	for _, d := range desired {
+		d := d
+		declared[d.Name] = true
+
+		t := findDeviceRegistrationToken(current, d.Name)
+		if t == nil {
+			changes = append(changes, change{operationCreate, KindDeviceRegistrationToken, d.Name, nil,
+				func(ctx context.Context, c *client.Client, project string) error {
+					token, err := c.CreateDeviceRegistrationToken(ctx, project, d.Name, d.Description, d.MaxRegistrations)
+					if err != nil {
+						return err
+					}
+					return applyKeyValues(ctx, c, project, token.ID, nil, d.Labels, nil, d.EnvironmentVariables)
+				},
+			})
+			continue
+		}
+
+		var details []string
+		if t.Description != d.Description {
+			details = append(details, "description")
+		}
+		if !reflect.DeepEqual(t.MaxRegistrations, d.MaxRegistrations) {
+			details = append(details, "max registrations")
+		}
+		propertiesChanged := len(details) > 0
+		for _, key := range changedKeys(t.Labels, d.Labels) {
+			details = append(details, "label "+key)
+		}
+		for _, key := range changedKeys(t.EnvironmentVariables, d.EnvironmentVariables) {
+			details = append(details, "environment variable "+key)
+		}
+		if len(details) > 0 {
+			changes = append(changes, change{operationUpdate, KindDeviceRegistrationToken, d.Name, details,
+				func(ctx context.Context, c *client.Client, project string) error {
+					if propertiesChanged {
+						if _, err := c.UpdateDeviceRegistrationToken(ctx, project, t.ID, d.Name, d.Description, d.MaxRegistrations); err != nil {
+							return err
+						}
+					}
+					return applyKeyValues(ctx, c, project, t.ID, t.Labels, d.Labels, t.EnvironmentVariables, d.EnvironmentVariables)
+				},
+			})
+		}
+	}
+
+	var deletions []change
+	for _, t := range current {
+		t := t
+		if declared[t.Name] || t.Name == defaultDeviceRegistrationTokenName {
+			continue
+		}
+		deletions = append(deletions, change{operationDelete, KindDeviceRegistrationToken, t.Name, nil,
+			func(ctx context.Context, c *client.Client, project string) error {
+				return c.DeleteDeviceRegistrationToken(ctx, project, t.ID)
+			},
+		})
+	}
+
+	return changes, deletions
+}
+
+func applyKeyValues(ctx context.Context, c *client.Client, project, token string, currentLabels, desiredLabels, currentEnvironmentVariables, desiredEnvironmentVariables map[string]string) error {
+	for _, key := range changedKeys(currentLabels, desiredLabels) {
+		var err error
+		if value, ok := desiredLabels[key]; ok {
+			err = c.SetDeviceRegistrationTokenLabel(ctx, project, token, key, value)
+		} else {
+			err = c.DeleteDeviceRegistrationTokenLabel(ctx, project, token, key)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	for _, key := range changedKeys(currentEnvironmentVariables, desiredEnvironmentVariables) {
+		var err error
+		if value, ok := desiredEnvironmentVariables[key]; ok {
+			err = c.SetDeviceRegistrationTokenEnvironmentVariable(ctx, project, token, key, value)
+		} else {
+			err = c.DeleteDeviceRegistrationTokenEnvironmentVariable(ctx, project, token, key)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func planApplications(desired []applicationManifest, current []models.ApplicationFull1) ([]change, []change, error) {
+	var changes []change
+	declared := make(map[string]bool)
+
+	for _, d := range desired {
+		d := d
+		declared[d.Name] = true
+
+		if d.rawRelease != "" {
+			if _, err := parseReleaseConfig(d.rawRelease); err != nil {
+				return nil, nil, fmt.Errorf("application %s: %s", d.Name, err.Error())
+			}
+		}
+
+		app := findApplication(current, d.Name)
+		if app == nil {
+			changes = append(changes, change{operationCreate, KindApplication, d.Name, nil,
+				func(ctx context.Context, c *client.Client, project string) error {
+					application, err := c.CreateApplication(ctx, project, d.Name)
+					if err != nil {
+						return err
+					}
+					return applyApplication(ctx, c, project, application.ID, d, true, true)
+				},
+			})
+			continue
+		}
+
+		var details []string
+		if app.Description != d.Description {
+			details = append(details, "description")
+		}
+		if d.SchedulingRule != nil {
+			fields, err := changedFields(app.SchedulingRule, *d.SchedulingRule)
+			if err != nil {
+				return nil, nil, err
+			}
+			for _, field := range fields {
+				details = append(details, "scheduling rule "+field)
+			}
+		}
+		if d.MetricEndpointConfigs != nil {
+			fields, err := changedFields(app.MetricEndpointConfigs, d.MetricEndpointConfigs)
+			if err != nil {
+				return nil, nil, err
+			}
+			for _, field := range fields {
+				details = append(details, "metric endpoint config "+field)
+			}
+		}
+		propertiesChanged := len(details) > 0
+
+		releaseChanged := false
+		if d.rawRelease != "" {
+			latestRelease := app.LatestRelease
+			if latestRelease == nil {
+				releaseChanged = true
+			} else {
+				desiredConfig, _ := parseReleaseConfig(d.rawRelease)
+				currentConfig, err := parseReleaseConfig(latestRelease.RawConfig)
+				releaseChanged = err != nil || !reflect.DeepEqual(desiredConfig, currentConfig)
+			}
+		}
+		if releaseChanged {
+			details = append(details, "release")
+		}
+
+		if len(details) > 0 {
+			changes = append(changes, change{operationUpdate, KindApplication, d.Name, details,
+				func(ctx context.Context, c *client.Client, project string) error {
+					return applyApplication(ctx, c, project, app.ID, d, propertiesChanged, releaseChanged)
+				},
+			})
+		}
+	}
+
+	var deletions []change
+	for _, app := range current {
+		app := app
+		if declared[app.Name] {
+			continue
+		}
+		deletions = append(deletions, change{operationDelete, KindApplication, app.Name, nil,
+			func(ctx context.Context, c *client.Client, project string) error {
+				return c.DeleteApplication(ctx, project, app.ID)
+			},
+		})
+	}
+
+	return changes, deletions, nil
+}
+
+// The release is created before the application is updated so that
+// scheduling rules referencing the latest release pick it up.
+func applyApplication(ctx context.Context, c *client.Client, project, application string, d applicationManifest, propertiesChanged, releaseChanged bool) error {
+	if releaseChanged && d.rawRelease != "" {
+		if _, err := c.CreateRelease(ctx, project, application, d.rawRelease); err != nil {
+			return err
+		}
+	}
+	if propertiesChanged {
+		var metricEndpointConfigs *map[string]models.MetricEndpointConfig
+		if d.MetricEndpointConfigs != nil {
+			metricEndpointConfigs = &d.MetricEndpointConfigs
+		}
+		if _, err := c.UpdateApplication(ctx, project, application, &d.Description, d.SchedulingRule, metricEndpointConfigs); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func parseReleaseConfig(rawConfig string) (map[string]models.Service, error) {
+	var config map[string]models.Service
+	if err := yaml.UnmarshalStrict([]byte(rawConfig), &config); err != nil {
+		return nil, err
+	}
+	return config, nil
+}
+
+// changedFields returns the paths of the fields that differ between the
+// current and desired values, including fields that are only set on one side.
+// Both values are normalized first, so that values decoded from the API and
+// from manifests compare the same way.
+func changedFields(current, desired interface{}) ([]string, error) {
+	normalizedCurrent, err := normalize(current)
+	if err != nil {
+		return nil, err
+	}
+	normalizedDesired, err := normalize(desired)
+	if err != nil {
+		return nil, err
+	}
+
+	var fields []string
+	diffValues("", normalizedCurrent, normalizedDesired, &fields)
+	sort.Strings(fields)
+	return fields, nil
+}
+
+// normalize round trips a value through YAML. This turns structs and maps
+// into map[interface{}]interface{}, whether their nested values were decoded
+// from YAML or JSON, and whole numbers decoded from JSON back into ints.
+func normalize(v interface{}) (interface{}, error) {
+	yamlBytes, err := yaml.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	var normalized interface{}
+	if err := yaml.Unmarshal(yamlBytes, &normalized); err != nil {
+		return nil, err
+	}
+	return normalized, nil
+}
+
+func diffValues(path string, current, desired interface{}, fields *[]string) {
+	currentMap, currentIsMap := current.(map[interface{}]interface{})
+	desiredMap, desiredIsMap := desired.(map[interface{}]interface{})
+	if currentIsMap && desiredIsMap {
+		keys := make(map[interface{}]bool)
+		for key := range currentMap {
+			keys[key] = true
+		}
+		for key := range desiredMap {
+			keys[key] = true
+		}
+		for key := range keys {
+			diffValues(joinFieldPath(path, fmt.Sprint(key)), currentMap[key], desiredMap[key], fields)
+		}
+		return
+	}
+
+	currentSlice, currentIsSlice := current.([]interface{})
+	desiredSlice, desiredIsSlice := desired.([]interface{})
+	if currentIsSlice && desiredIsSlice && len(currentSlice) == len(desiredSlice) {
+		for i := range currentSlice {
+			diffValues(fmt.Sprintf("%s[%d]", path, i), currentSlice[i], desiredSlice[i], fields)
+		}
+		return
+	}
+
+	// A missing field is the same as an empty one
+	if isEmptyValue(current) && isEmptyValue(desired) {
+		return
+	}
+	if !reflect.DeepEqual(current, desired) {
+		*fields = append(*fields, path)
+	}
+}
+
+func joinFieldPath(path, field string) string {
+	if path == "" {
+		return field
+	}
+	return path + "." + field
+}
+
+func isEmptyValue(v interface{}) bool {
+	switch v := v.(type) {
+	case nil:
+		return true
+	case map[interface{}]interface{}:
+		return len(v) == 0
+	case []interface{}:
+		return len(v) == 0
+	}
+	return false
+}
+
+func changedKeys(current, desired map[string]string) []string {
+	var keys []string
+	for key, value := range desired {
+		if currentValue, ok := current[key]; !ok || currentValue != value {
+			keys = append(keys, key)
+		}
+	}
+	for key := range current {
+		if _, ok := desired[key]; !ok {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func findRole(roles []models.Role, name string) *models.Role {
+	for i := range roles {
+		if roles[i].Name == name {
+			return &roles[i]
+		}
+	}
+	return nil
+}
+
+func findConnection(connections []models.Connection, name string) *models.Connection {
+	for i := range connections {
+		if connections[i].Name == name {
+			return &connections[i]
+		}
+	}
+	return nil
+}
+
+func findDeviceRegistrationToken(tokens []models.DeviceRegistrationToken, name string) *models.DeviceRegistrationToken {
+	for i := range tokens {
+		if tokens[i].Name == name {
+			return &tokens[i]
+		}
+	}
+	return nil
+}
+
+func findApplication(applications []models.ApplicationFull1, name string) *models.ApplicationFull1 {
+	for i := range applications {
+		if applications[i].Name == name {
+			return &applications[i]
+		}
+	}
+	return nil
+}
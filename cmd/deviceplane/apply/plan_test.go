@@ -0,0 +1,224 @@
+package apply
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/deviceplane/deviceplane/pkg/models"
+	"github.com/stretchr/testify/require"
+	"gopkg.in/yaml.v2"
+)
+
+const testManifests = `
+kind: Role
+name: read-all
+config:
+  rules:
+  - resources:
+    - '*'
+    actions:
+    - read
+---
+kind: Connection
+name: web
+protocol: http
+port: 8080
+---
+kind: DeviceRegistrationToken
+name: default
+labels:
+  site: hq
+---
+kind: Application
+name: kiosk
+description: Kiosk display
+schedulingRule:
+  scheduleType: AllDevices
+  defaultReleaseId: latest
+release:
+  web:
+    image: nginx:1.17
+`
+
+func loadTestManifests(t *testing.T, contents string) *manifests {
+	dir, err := ioutil.TempDir("", "apply")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	require.NoError(t, ioutil.WriteFile(filepath.Join(dir, "project.yaml"), []byte(contents), 0644))
+	require.NoError(t, ioutil.WriteFile(filepath.Join(dir, "README.md"), []byte("not a manifest"), 0644))
+
+	m, err := loadManifests([]string{dir})
+	require.NoError(t, err)
+	return m
+}
+
+func planStrings(changes []change) []string {
+	var ret []string
+	for _, c := range changes {
+		ret = append(ret, c.String())
+	}
+	return ret
+}
+
+func TestLoadManifests(t *testing.T) {
+	m := loadTestManifests(t, testManifests)
+
+	require.Len(t, m.roles, 1)
+	require.Len(t, m.connections, 1)
+	require.Len(t, m.deviceRegistrationTokens, 1)
+	require.Len(t, m.applications, 1)
+
+	require.Equal(t, "read-all", m.roles[0].Name)
+	require.Equal(t, uint(8080), m.connections[0].Port)
+	require.Equal(t, map[string]string{"site": "hq"}, m.deviceRegistrationTokens[0].Labels)
+	require.Equal(t, models.ScheduleType(models.ScheduleTypeAllDevices), m.applications[0].SchedulingRule.ScheduleType)
+	require.Equal(t, "web:\n  image: nginx:1.17\n", m.applications[0].rawRelease)
+}
+
+func TestLoadManifestsErrors(t *testing.T) {
+	for _, contents := range []string{
+		"kind: Unknown\nname: foo\n",
+		"kind: Connection\nport: 80\n",
+		"kind: Connection\nname: foo\nport: 80\nunknownField: true\n",
+		"kind: Connection\nname: foo\nport: 80\n---\nkind: Connection\nname: foo\nport: 81\n",
+	} {
+		dir, err := ioutil.TempDir("", "apply")
+		require.NoError(t, err)
+		defer os.RemoveAll(dir)
+
+		file := filepath.Join(dir, "project.yaml")
+		require.NoError(t, ioutil.WriteFile(file, []byte(contents), 0644))
+
+		_, err = loadManifests([]string{file})
+		require.Error(t, err, contents)
+	}
+}
+
+func TestComputePlan(t *testing.T) {
+	m := loadTestManifests(t, testManifests)
+
+	t.Run("empty project", func(t *testing.T) {
+		changes, err := computePlan(*m, state{}, true)
+		require.NoError(t, err)
+		require.Equal(t, []string{
+			"+ Role read-all",
+			"+ Connection web",
+			"+ DeviceRegistrationToken default",
+			"+ Application kiosk",
+		}, planStrings(changes))
+	})
+
+	current := state{
+		roles: []models.Role{
+			{ID: "rol_1", Name: "read-all", Config: "rules:\n- resources:\n  - '*'\n  actions:\n  - read\n"},
+			{ID: "rol_2", Name: "admin-all", Config: "rules:\n- resources:\n  - '*'\n  actions:\n  - admin\n"},
+			{ID: "rol_3", Name: "operators", Config: "rules:\n- resources:\n  - devices\n  actions:\n  - write\n"},
+		},
+		connections: []models.Connection{
+			{ID: "con_1", Name: "web", Protocol: models.ProtocolHTTP, Port: 80},
+		},
+		deviceRegistrationTokens: []models.DeviceRegistrationToken{
+			{ID: "drt_1", Name: "default", Labels: map[string]string{"site": "hq", "old": "x"}},
+			{ID: "drt_2", Name: "lab"},
+		},
+		applications: []models.ApplicationFull1{
+			{
+				Application: models.Application{
+					ID:          "app_1",
+					Name:        "kiosk",
+					Description: "Kiosk display",
+					SchedulingRule: models.SchedulingRule{
+						ScheduleType:     models.ScheduleTypeAllDevices,
+						DefaultReleaseID: "latest",
+					},
+				},
+				LatestRelease: &models.Release{
+					RawConfig: "web:\n  image: nginx:1.16\n",
+				},
+			},
+			{
+				Application: models.Application{
+					ID:   "app_2",
+					Name: "legacy",
+				},
+			},
+		},
+	}
+
+	t.Run("updates", func(t *testing.T) {
+		changes, err := computePlan(*m, current, false)
+		require.NoError(t, err)
+		require.Equal(t, []string{
+			"~ Connection web (port)",
+			"~ DeviceRegistrationToken default (label old)",
+			"~ Application kiosk (release)",
+		}, planStrings(changes))
+	})
+
+	t.Run("prune", func(t *testing.T) {
+		changes, err := computePlan(*m, current, true)
+		require.NoError(t, err)
+		require.Equal(t, []string{
+			"~ Connection web (port)",
+			"~ DeviceRegistrationToken default (label old)",
+			"~ Application kiosk (release)",
+			"- Application legacy",
+			"- DeviceRegistrationToken lab",
+			"- Role operators",
+		}, planStrings(changes))
+	})
+
+	t.Run("prune only declared kinds", func(t *testing.T) {
+		m := loadTestManifests(t, "kind: Connection\nname: web\nprotocol: http\nport: 80\n")
+		changes, err := computePlan(*m, current, true)
+		require.NoError(t, err)
+		require.Len(t, changes, 0)
+	})
+}
+
+func TestChangedFields(t *testing.T) {
+	var desired models.SchedulingRule
+	require.NoError(t, yaml.Unmarshal([]byte(`
+scheduleType: Conditional
+defaultReleaseId: latest
+conditionalQuery:
+- - type: LabelValueCondition
+    params:
+      key: rack
+      operator: in
+      value: 7
+      values: [a, b]
+`), &desired))
+
+	var current models.SchedulingRule
+	require.NoError(t, json.Unmarshal([]byte(`{
+		"scheduleType": "Conditional",
+		"defaultReleaseId": "latest",
+		"conditionalQuery": [[{
+			"type": "LabelValueCondition",
+			"params": {"key": "rack", "operator": "in", "value": 7, "values": ["a", "b"]}
+		}]],
+		"releaseSelectors": []
+	}`), &current))
+
+	fields, err := changedFields(current, desired)
+	require.NoError(t, err)
+	require.Len(t, fields, 0)
+
+	current.ReleaseSelectors = []models.ReleaseSelector{{ReleaseID: "rel_1"}}
+	(*current.ConditionalQuery)[0][0].Params["extra"] = "x"
+	fields, err = changedFields(current, desired)
+	require.NoError(t, err)
+	require.Equal(t, []string{"conditionalQuery[0][0].params.extra", "releaseSelectors"}, fields)
+
+	fields, err = changedFields(
+		map[string]models.MetricEndpointConfig{"web": {Port: 80}, "other": {Port: 9100}},
+		map[string]models.MetricEndpointConfig{"web": {Port: 8080}},
+	)
+	require.NoError(t, err)
+	require.Equal(t, []string{"other", "web.port"}, fields)
+}
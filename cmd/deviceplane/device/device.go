@@ -2,16 +2,21 @@ package device
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"io"
 	"net"
 	"os"
 	"os/exec"
+	"os/signal"
 	"strconv"
 	"strings"
+	"sync"
+	"syscall"
 
 	"github.com/deviceplane/deviceplane/cmd/deviceplane/cliutils"
 	"github.com/deviceplane/deviceplane/pkg/models"
+	"github.com/deviceplane/deviceplane/pkg/queryparser"
 	"golang.org/x/sync/errgroup"
 
 	kingpin "gopkg.in/alecthomas/kingpin.v2"
@@ -20,12 +25,12 @@ import (
 func deviceListAction(c *kingpin.ParseContext) error {
 	var filters []models.Filter
 	for _, textFilter := range *deviceFilterListFlag {
-		filter, err := parseTextFilter(textFilter)
+		parsed, err := queryparser.Parse(textFilter)
 		if err != nil {
-			return err
+			return fmt.Errorf(`invalid filter "%s": %v`, textFilter, err)
 		}
 
-		filters = append(filters, filter)
+		filters = append(filters, parsed...)
 	}
 
 	devices, err := config.APIClient.ListDevices(context.TODO(), filters, *config.Flags.Project)
@@ -75,6 +80,36 @@ func deviceRebootAction(c *kingpin.ParseContext) error {
 	return nil
 }
 
+func deviceQuarantineAction(c *kingpin.ParseContext) error {
+	_, err := config.APIClient.SetDeviceQuarantine(context.TODO(), *config.Flags.Project, *deviceArg, true)
+	if err != nil {
+		return err
+	}
+
+	fmt.Println("Successfully quarantined device")
+	return nil
+}
+
+func deviceUnquarantineAction(c *kingpin.ParseContext) error {
+	_, err := config.APIClient.SetDeviceQuarantine(context.TODO(), *config.Flags.Project, *deviceArg, false)
+	if err != nil {
+		return err
+	}
+
+	fmt.Println("Successfully released device from quarantine")
+	return nil
+}
+
+func deviceRevokeAccessKeysAction(c *kingpin.ParseContext) error {
+	err := config.APIClient.RevokeDeviceAccessKeys(context.TODO(), *config.Flags.Project, *deviceArg)
+	if err != nil {
+		return err
+	}
+
+	fmt.Println("Successfully revoked device access keys")
+	return nil
+}
+
 func deviceInspectAction(c *kingpin.ParseContext) error {
 	device, err := config.APIClient.GetDevice(context.TODO(), *config.Flags.Project, *deviceArg)
 	if err != nil {
@@ -146,4 +181,151 @@ func deviceSSHAction(c *kingpin.ParseContext) error {
 	})
 
 	return g.Wait()
-}
\ No newline at end of file
+}
+
+func devicePortForwardAction(c *kingpin.ParseContext) error {
+	target, err := resolvePortForwardTarget(*connectionArg)
+	if err != nil {
+		return err
+	}
+
+	localPort := *portArg
+	if localPort == 0 {
+		localPort = target.port
+	}
+
+	listener, err := net.Listen("tcp", net.JoinHostPort("127.0.0.1", strconv.Itoa(int(localPort))))
+	if err != nil {
+		return err
+	}
+
+	stopped := make(chan struct{})
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-signals
+		close(stopped)
+		listener.Close()
+	}()
+
+	fmt.Printf("Forwarding %s -> %s\n", listener.Addr(), target.description)
+
+	var wg sync.WaitGroup
+	defer wg.Wait()
+
+	for {
+		localConn, err := listener.Accept()
+		if err != nil {
+			select {
+			case <-stopped:
+				return nil
+			default:
+				return err
+			}
+		}
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := forwardConnection(localConn, target.dial); err != nil {
+				fmt.Fprintf(os.Stderr, "forwarding connection from %s: %v\n", localConn.RemoteAddr(), err)
+			}
+		}()
+	}
+}
+
+func forwardConnection(localConn net.Conn, dial func() (net.Conn, error)) error {
+	defer localConn.Close()
+
+	conn, err := dial()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	done := make(chan struct{}, 2)
+	go func() {
+		io.Copy(conn, localConn)
+		done <- struct{}{}
+	}()
+	go func() {
+		io.Copy(localConn, conn)
+		done <- struct{}{}
+	}()
+	<-done
+
+	return nil
+}
+
+type portForwardTarget struct {
+	port        uint
+	description string
+	dial        func() (net.Conn, error)
+}
+
+// resolvePortForwardTarget accepts either a connection name or a port
+// number. A port number uses the project connection forwarding that port if
+// there is one, and otherwise connects to the port ad hoc. Ports inside a
+// service's container are always connected to ad hoc.
+func resolvePortForwardTarget(nameOrPort string) (*portForwardTarget, error) {
+	if *applicationFlag != "" || *serviceFlag != "" {
+		if *applicationFlag == "" || *serviceFlag == "" {
+			return nil, errors.New("--application and --service must be used together")
+		}
+
+		port, err := strconv.ParseUint(nameOrPort, 10, 16)
+		if err != nil {
+			return nil, fmt.Errorf("invalid port %s", nameOrPort)
+		}
+
+		return adHocPortForwardTarget(uint(port), *applicationFlag, *serviceFlag), nil
+	}
+
+	connections, err := config.APIClient.ListConnections(context.TODO(), *config.Flags.Project)
+	if err != nil {
+		return nil, err
+	}
+
+	for i := range connections {
+		if connections[i].Name == nameOrPort {
+			return connectionPortForwardTarget(connections[i]), nil
+		}
+	}
+
+	port, err := strconv.ParseUint(nameOrPort, 10, 16)
+	if err != nil {
+		return nil, fmt.Errorf("connection %s not found", nameOrPort)
+	}
+	for i := range connections {
+		if connections[i].Port == uint(port) {
+			return connectionPortForwardTarget(connections[i]), nil
+		}
+	}
+
+	return adHocPortForwardTarget(uint(port), "", ""), nil
+}
+
+func connectionPortForwardTarget(connection models.Connection) *portForwardTarget {
+	return &portForwardTarget{
+		port:        connection.Port,
+		description: fmt.Sprintf("%s:%d (connection %s, %s)", *deviceArg, connection.Port, connection.Name, connection.Protocol),
+		dial: func() (net.Conn, error) {
+			return config.APIClient.ConnectRaw(context.TODO(), *config.Flags.Project, *deviceArg, connection.Name)
+		},
+	}
+}
+
+func adHocPortForwardTarget(port uint, application, service string) *portForwardTarget {
+	description := fmt.Sprintf("%s:%d", *deviceArg, port)
+	if application != "" {
+		description = fmt.Sprintf("%s:%d (application %s, service %s)", *deviceArg, port, application, service)
+	}
+
+	return &portForwardTarget{
+		port:        port,
+		description: description,
+		dial: func() (net.Conn, error) {
+			return config.APIClient.ConnectPort(context.TODO(), *config.Flags.Project, *deviceArg, application, service, port)
+		},
+	}
+}
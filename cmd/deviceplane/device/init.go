@@ -16,6 +16,9 @@ var (
 	connectionArg *string = &[]string{""}[0]
 	portArg               = &[]uint{0}[0]
 
+	applicationFlag *string = &[]string{""}[0]
+	serviceFlag     *string = &[]string{""}[0]
+
 	deviceFilterListFlag *[]string = &[][]string{[]string{}}[0]
 
 	deviceOutputFlag *string = &[]string{""}[0]
@@ -29,7 +32,7 @@ func Initialize(c *global.Config) {
 	deviceCmd := c.App.Command("device", "Manage devices.")
 
 	deviceListCmd := deviceCmd.Command("list", "List devices.")
-	deviceListCmd.Flag("filter", `Label key/values used to filter devices. e.g. "--filter status=online --filter labels.location=hq2"`).StringsVar(deviceFilterListFlag)
+	deviceListCmd.Flag("filter", `Expressions used to filter devices, all of which must match. e.g. "--filter status=online --filter 'labels.location in (hq1, hq2) and agentVersion >= 1.10'"`).StringsVar(deviceFilterListFlag)
 	cliutils.AddFormatFlag(deviceOutputFlag, deviceListCmd,
 		cliutils.FormatTable,
 		cliutils.FormatYAML,
@@ -45,6 +48,14 @@ func Initialize(c *global.Config) {
 		deviceSSHCmd.Action(deviceSSHAction)
 	})
 
+	devicePortForwardCmd := deviceCmd.Command("port-forward", "Forward a local port to a device through a connection.")
+	addDeviceArg(devicePortForwardCmd)
+	addConnectionArg(devicePortForwardCmd)
+	devicePortForwardCmd.Flag("local", "Local port to listen on. Defaults to the connection's port.").UintVar(portArg)
+	devicePortForwardCmd.Flag("application", "Application whose service container to connect into. Requires --service.").StringVar(applicationFlag)
+	devicePortForwardCmd.Flag("service", "Service whose container to connect into. Requires --application.").StringVar(serviceFlag)
+	devicePortForwardCmd.Action(devicePortForwardAction)
+
 	deviceInspectCmd := deviceCmd.Command("inspect", "Inspect a device's properties and labels.")
 	addDeviceArg(deviceInspectCmd)
 	cliutils.AddFormatFlag(deviceOutputFlag, deviceInspectCmd,
@@ -58,6 +69,18 @@ func Initialize(c *global.Config) {
 		addDeviceArg(deviceRebootCmd)
 		deviceRebootCmd.Action(deviceRebootAction)
 	})
+
+	deviceQuarantineCmd := deviceCmd.Command("quarantine", "Stop all applications on a device while keeping it connected.")
+	addDeviceArg(deviceQuarantineCmd)
+	deviceQuarantineCmd.Action(deviceQuarantineAction)
+
+	deviceUnquarantineCmd := deviceCmd.Command("unquarantine", "Release a device from quarantine.")
+	addDeviceArg(deviceUnquarantineCmd)
+	deviceUnquarantineCmd.Action(deviceUnquarantineAction)
+
+	deviceRevokeAccessKeysCmd := deviceCmd.Command("revoke-access-keys", "Revoke all of a device's access keys. The device will need to be registered again.")
+	addDeviceArg(deviceRevokeAccessKeysCmd)
+	deviceRevokeAccessKeysCmd.Action(deviceRevokeAccessKeysAction)
 }
 
 func addDeviceArg(cmd *kingpin.CmdClause) *kingpin.ArgClause {
@@ -82,7 +105,7 @@ func addDeviceArg(cmd *kingpin.CmdClause) *kingpin.ArgClause {
 }
 
 func addConnectionArg(cmd *kingpin.CmdClause) *kingpin.ArgClause {
-	arg := cmd.Arg("connection", "Connection name.").Required()
+	arg := cmd.Arg("connection", "Connection name or port.").Required()
 	arg.StringVar(connectionArg)
 	return arg
 }
@@ -3,11 +3,14 @@ package main
 import (
 	"os"
 
+	"github.com/deviceplane/deviceplane/cmd/deviceplane/apply"
 	"github.com/deviceplane/deviceplane/cmd/deviceplane/cliutils"
 	"github.com/deviceplane/deviceplane/cmd/deviceplane/configure"
 	"github.com/deviceplane/deviceplane/cmd/deviceplane/device"
 	"github.com/deviceplane/deviceplane/cmd/deviceplane/global"
 	"github.com/deviceplane/deviceplane/cmd/deviceplane/project"
+	"github.com/deviceplane/deviceplane/cmd/deviceplane/release"
+	"github.com/deviceplane/deviceplane/cmd/deviceplane/role"
 	kingpin "gopkg.in/alecthomas/kingpin.v2"
 )
 
@@ -33,6 +36,9 @@ func main() {
 	configure.Initialize(&config)
 	project.Initialize(&config)
 	device.Initialize(&config)
+	release.Initialize(&config)
+	role.Initialize(&config)
+	apply.Initialize(&config)
 
 	app.PreAction(cliutils.InitializeAPIClient(&config))
 	preSSH, _ := cliutils.GetSSHArgs(os.Args[1:])
@@ -0,0 +1,53 @@
+package release
+
+import (
+	"github.com/deviceplane/deviceplane/cmd/deviceplane/cliutils"
+	"github.com/deviceplane/deviceplane/cmd/deviceplane/global"
+)
+
+var (
+	releaseFileArg    *string = &[]string{""}[0]
+	releaseFileFlag   *string = &[]string{""}[0]
+	applicationArg    *string = &[]string{""}[0]
+	releaseArg        *string = &[]string{""}[0]
+	baseReleaseFlag   *string = &[]string{""}[0]
+	interpolateFlag   *bool   = &[]bool{false}[0]
+	dryRunFlag        *bool   = &[]bool{false}[0]
+	releaseOutputFlag *string = &[]string{""}[0]
+
+	config *global.Config
+)
+
+func Initialize(c *global.Config) {
+	config = c
+
+	releaseCmd := c.App.Command("release", "Manage releases.")
+
+	releaseValidateCmd := releaseCmd.Command("validate", "Validate a release config locally.")
+	releaseValidateCmd.Arg("file", "Release config file.").Required().ExistingFileVar(releaseFileArg)
+	releaseValidateCmd.Flag("interpolate", "Substitute environment variables into the config before validating it.").BoolVar(interpolateFlag)
+	releaseValidateCmd.Action(releaseValidateAction)
+
+	releaseCreateCmd := releaseCmd.Command("create", "Create a new release of an application.")
+	releaseCreateCmd.Arg("application", "Application name.").Required().StringVar(applicationArg)
+	releaseCreateCmd.Flag("file", "Release config file.").Short('f').Required().ExistingFileVar(releaseFileFlag)
+	releaseCreateCmd.Flag("interpolate", "Substitute environment variables into the config before creating the release.").BoolVar(interpolateFlag)
+	releaseCreateCmd.Flag("dry-run", "Validate the release and show which devices would receive it, without creating it.").BoolVar(dryRunFlag)
+	cliutils.AddFormatFlag(releaseOutputFlag, releaseCreateCmd,
+		cliutils.FormatTable,
+		cliutils.FormatYAML,
+		cliutils.FormatJSON,
+	)
+	releaseCreateCmd.Action(releaseCreateAction)
+
+	releaseDiffCmd := releaseCmd.Command("diff", "Show the changes a release makes relative to another release.")
+	releaseDiffCmd.Arg("application", "Application name.").Required().StringVar(applicationArg)
+	releaseDiffCmd.Arg("release", "Release number or ID.").Default("latest").StringVar(releaseArg)
+	releaseDiffCmd.Flag("base", "Release number or ID to compare against. Defaults to the previous release.").StringVar(baseReleaseFlag)
+	cliutils.AddFormatFlag(releaseOutputFlag, releaseDiffCmd,
+		cliutils.FormatTable,
+		cliutils.FormatYAML,
+		cliutils.FormatJSON,
+	)
+	releaseDiffCmd.Action(releaseDiffAction)
+}
@@ -0,0 +1,198 @@
+package release
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/deviceplane/deviceplane/cmd/deviceplane/cliutils"
+	"github.com/deviceplane/deviceplane/pkg/interpolation"
+	"github.com/deviceplane/deviceplane/pkg/models"
+	"github.com/deviceplane/deviceplane/pkg/spec"
+	"github.com/pkg/errors"
+	kingpin "gopkg.in/alecthomas/kingpin.v2"
+)
+
+func readReleaseConfig(file string) (string, error) {
+	configBytes, err := ioutil.ReadFile(file)
+	if err != nil {
+		return "", err
+	}
+	rawConfig := string(configBytes)
+
+	if *interpolateFlag {
+		rawConfig, err = interpolation.Interpolate(rawConfig, os.Getenv)
+		if err != nil {
+			return "", errors.Wrap(err, "failed to interpolate release config")
+		}
+	} else if _, err := interpolation.Variables(rawConfig); err != nil {
+		return "", errors.Wrap(err, "failed to interpolate release config")
+	}
+
+	return rawConfig, nil
+}
+
+func releaseValidateAction(c *kingpin.ParseContext) error {
+	rawConfig, err := readReleaseConfig(*releaseFileArg)
+	if err != nil {
+		return err
+	}
+
+	services, err := spec.Parse([]byte(rawConfig))
+	if err != nil {
+		return errors.Wrap(err, "invalid release config")
+	}
+
+	serviceNames := make([]string, 0, len(services))
+	for name := range services {
+		serviceNames = append(serviceNames, name)
+	}
+	sort.Strings(serviceNames)
+
+	fmt.Printf("Release config is valid. Services: %s\n", strings.Join(serviceNames, ", "))
+
+	if !*interpolateFlag {
+		variables, _ := interpolation.Variables(rawConfig)
+		if len(variables) > 0 {
+			fmt.Printf("Variables referenced (not interpolated): %s\n", strings.Join(variables, ", "))
+		}
+	}
+
+	return nil
+}
+
+func releaseCreateAction(c *kingpin.ParseContext) error {
+	rawConfig, err := readReleaseConfig(*releaseFileFlag)
+	if err != nil {
+		return err
+	}
+
+	if _, err := spec.Parse([]byte(rawConfig)); err != nil {
+		return errors.Wrap(err, "invalid release config")
+	}
+
+	if *dryRunFlag {
+		dryRun, err := config.APIClient.CreateReleaseDryRun(context.TODO(), *config.Flags.Project, *applicationArg, rawConfig)
+		if err != nil {
+			return err
+		}
+
+		if *releaseOutputFlag == cliutils.FormatTable {
+			table := cliutils.DefaultTable()
+			table.SetHeader([]string{"Service", "Image"})
+			serviceNames := make([]string, 0, len(dryRun.Config))
+			for name := range dryRun.Config {
+				serviceNames = append(serviceNames, name)
+			}
+			sort.Strings(serviceNames)
+			for _, name := range serviceNames {
+				table.Append([]string{name, dryRun.Config[name].Image})
+			}
+			table.Render()
+
+			fmt.Printf("\n%d device(s) would receive this release:\n", len(dryRun.ScheduledDevices))
+			for _, d := range dryRun.ScheduledDevices {
+				fmt.Println(d.Name)
+			}
+			return nil
+		}
+
+		return cliutils.PrintWithFormat(dryRun, *releaseOutputFlag)
+	}
+
+	release, err := config.APIClient.CreateRelease(context.TODO(), *config.Flags.Project, *applicationArg, rawConfig)
+	if err != nil {
+		return err
+	}
+
+	if *releaseOutputFlag == cliutils.FormatTable {
+		fmt.Printf("Release %d of %s successfully created at %s!\n", release.Number, *applicationArg, release.CreatedAt.Format("Mon Jan _2 15:04:05 2006"))
+		return nil
+	}
+
+	return cliutils.PrintWithFormat(release, *releaseOutputFlag)
+}
+
+func releaseDiffAction(c *kingpin.ParseContext) error {
+	diff, err := config.APIClient.DiffReleases(context.TODO(), *config.Flags.Project, *applicationArg, *releaseArg, *baseReleaseFlag)
+	if err != nil {
+		return err
+	}
+
+	if *releaseOutputFlag != cliutils.FormatTable {
+		return cliutils.PrintWithFormat(diff, *releaseOutputFlag)
+	}
+
+	if diff.BaseRelease == 0 {
+		fmt.Printf("Release %d is the first release\n", diff.TargetRelease)
+	} else {
+		fmt.Printf("Changes from release %d to release %d\n", diff.BaseRelease, diff.TargetRelease)
+	}
+
+	if len(diff.Services) == 0 {
+		fmt.Println("No changes")
+		return nil
+	}
+
+	table := cliutils.DefaultTable()
+	table.SetHeader([]string{"Service", "Change", "Details"})
+	for _, service := range diff.Services {
+		table.Append([]string{service.Service, string(service.Type), strings.Join(serviceDiffDetails(service), "\n")})
+	}
+	table.Render()
+
+	return nil
+}
+
+func serviceDiffDetails(diff models.ServiceDiff) []string {
+	var details []string
+
+	if diff.Image != nil {
+		switch diff.Type {
+		case models.ServiceDiffTypeAdded:
+			details = append(details, fmt.Sprintf("image: %s", diff.Image.To))
+		case models.ServiceDiffTypeRemoved:
+			details = append(details, fmt.Sprintf("image: %s", diff.Image.From))
+		default:
+			details = append(details, fmt.Sprintf("image: %s -> %s", diff.Image.From, diff.Image.To))
+		}
+	}
+
+	for _, env := range diff.Environment {
+		switch {
+		case env.From == nil:
+			details = append(details, fmt.Sprintf("+ env %s=%s", env.Key, *env.To))
+		case env.To == nil:
+			details = append(details, fmt.Sprintf("- env %s", env.Key))
+		default:
+			details = append(details, fmt.Sprintf("~ env %s: %s -> %s", env.Key, *env.From, *env.To))
+		}
+	}
+
+	for _, list := range []struct {
+		name string
+		diff *models.ListDiff
+	}{
+		{"volume", diff.Volumes},
+		{"port", diff.Ports},
+	} {
+		if list.diff == nil {
+			continue
+		}
+		for _, added := range list.diff.Added {
+			details = append(details, fmt.Sprintf("+ %s %s", list.name, added))
+		}
+		for _, removed := range list.diff.Removed {
+			details = append(details, fmt.Sprintf("- %s %s", list.name, removed))
+		}
+	}
+
+	if len(diff.OtherFields) > 0 {
+		details = append(details, fmt.Sprintf("changed: %s", strings.Join(diff.OtherFields, ", ")))
+	}
+
+	return details
+}
@@ -0,0 +1,37 @@
+package role
+
+import (
+	"github.com/deviceplane/deviceplane/cmd/deviceplane/cliutils"
+	"github.com/deviceplane/deviceplane/cmd/deviceplane/global"
+)
+
+var (
+	userFlag           *string = &[]string{""}[0]
+	serviceAccountFlag *string = &[]string{""}[0]
+	resourceFlag       *string = &[]string{""}[0]
+	actionFlag         *string = &[]string{""}[0]
+	objectFlag         *string = &[]string{""}[0]
+
+	roleOutputFlag *string = &[]string{""}[0]
+
+	config *global.Config
+)
+
+func Initialize(c *global.Config) {
+	config = c
+
+	roleCmd := c.App.Command("role", "Manage roles.")
+
+	roleSimulateCmd := roleCmd.Command("simulate", "Check whether a user or service account is allowed to perform an action, and which role rules decide it.")
+	roleSimulateCmd.Flag("user", "User ID.").StringVar(userFlag)
+	roleSimulateCmd.Flag("service-account", "Service account name.").StringVar(serviceAccountFlag)
+	roleSimulateCmd.Flag("resource", `Resource, e.g. "devices".`).Required().StringVar(resourceFlag)
+	roleSimulateCmd.Flag("action", `Action, e.g. "SSH".`).Required().StringVar(actionFlag)
+	roleSimulateCmd.Flag("object", "Name or ID of the targeted object, e.g. a device for device resources or an application for release resources.").StringVar(objectFlag)
+	cliutils.AddFormatFlag(roleOutputFlag, roleSimulateCmd,
+		cliutils.FormatTable,
+		cliutils.FormatYAML,
+		cliutils.FormatJSON,
+	)
+	roleSimulateCmd.Action(roleSimulateAction)
+}
@@ -0,0 +1,73 @@
+package role
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/deviceplane/deviceplane/cmd/deviceplane/cliutils"
+	"github.com/deviceplane/deviceplane/pkg/models"
+	kingpin "gopkg.in/alecthomas/kingpin.v2"
+)
+
+func roleSimulateAction(c *kingpin.ParseContext) error {
+	if (*userFlag == "") == (*serviceAccountFlag == "") {
+		return errors.New("exactly one of --user and --service-account must be set")
+	}
+
+	simulation, err := config.APIClient.SimulateAuthorization(context.TODO(), *config.Flags.Project, models.SimulateAuthorizationRequest{
+		UserID:         *userFlag,
+		ServiceAccount: *serviceAccountFlag,
+		Resource:       *resourceFlag,
+		Action:         *actionFlag,
+		Object:         *objectFlag,
+	})
+	if err != nil {
+		return err
+	}
+
+	if *roleOutputFlag != cliutils.FormatTable {
+		return cliutils.PrintWithFormat(simulation, *roleOutputFlag)
+	}
+
+	if simulation.Allowed {
+		fmt.Println("Decision: allowed")
+	} else {
+		fmt.Println("Decision: denied")
+	}
+	if simulation.SuperAdmin {
+		fmt.Println("Roles: (super admin)")
+	} else {
+		fmt.Printf("Roles: %s\n", strings.Join(simulation.Roles, ", "))
+	}
+
+	if len(simulation.AllowRules) == 0 && len(simulation.DenyRules) == 0 {
+		fmt.Println("\nNo rules match this request")
+		return nil
+	}
+
+	fmt.Println()
+	table := cliutils.DefaultTable()
+	table.SetHeader([]string{"Effect", "Role", "Rule", "Definition"})
+	for _, effect := range []struct {
+		name  string
+		rules []models.MatchingAuthorizationRule
+	}{
+		{"allow", simulation.AllowRules},
+		{"deny", simulation.DenyRules},
+	} {
+		for _, rule := range effect.rules {
+			table.Append([]string{
+				effect.name,
+				rule.RoleName,
+				strconv.Itoa(rule.RuleIndex),
+				strings.TrimSpace(rule.Rule),
+			})
+		}
+	}
+	table.Render()
+
+	return nil
+}
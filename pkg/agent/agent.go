@@ -2,7 +2,13 @@ package agent
 
 import (
 	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
 	"encoding/json"
+	"encoding/pem"
 	"fmt"
 	"io/ioutil"
 	"net"
@@ -34,9 +40,13 @@ import (
 )
 
 const (
-	accessKeyFilename = "access-key"
-	deviceIDFilename  = "device-id"
-	bundleFilename    = "bundle"
+	accessKeyFilename  = "access-key"
+	clientKeyFilename  = "client-key"
+	clientCertFilename = "client-cert"
+	deviceIDFilename   = "device-id"
+	bundleFilename     = "bundle"
+
+	metricsBufferDirname = "metrics-buffer"
 )
 
 var (
@@ -51,6 +61,8 @@ type Agent struct {
 	confDir                string
 	stateDir               string
 	serverPort             int
+	accessKeyRotation      time.Duration
+	certificateAuth        bool
 	supervisor             *supervisor.Supervisor
 	statusGarbageCollector *status.GarbageCollector
 	metricsPusher          *metrics.MetricsPusher
@@ -63,6 +75,8 @@ type Agent struct {
 func NewAgent(
 	client *client.Client, engine engine.Engine,
 	projectID, registrationToken, confDir, stateDir, version, binaryPath string, serverPort int,
+	accessKeyRotation time.Duration, certificateAuth bool,
+	metricsBufferSize int64, metricsBufferMaxAge time.Duration,
 ) (*Agent, error) {
 	if version == "" {
 		return nil, errVersionNotSet
@@ -101,7 +115,17 @@ func NewAgent(
 		netnsManager,
 	)
 
-	service := service.NewService(variables, supervisor, engine, confDir, serviceMetricsFetcher)
+	// A size of zero disables buffering
+	var metricsBuffer *metrics.Buffer
+	if metricsBufferSize > 0 {
+		metricsBuffer = metrics.NewBuffer(
+			path.Join(stateDir, projectID, metricsBufferDirname),
+			metricsBufferSize,
+			metricsBufferMaxAge,
+		)
+	}
+
+	service := service.NewService(variables, supervisor, engine, confDir, serviceMetricsFetcher, netnsManager)
 
 	return &Agent{
 		client:            client,
@@ -111,13 +135,15 @@ func NewAgent(
 		confDir:           confDir,
 		stateDir:          stateDir,
 		serverPort:        serverPort,
+		accessKeyRotation: accessKeyRotation,
+		certificateAuth:   certificateAuth,
 		supervisor:        supervisor,
 		statusGarbageCollector: status.NewGarbageCollector(
 			client.DeleteDeviceApplicationStatus,
 			client.DeleteDeviceServiceStatus,
 			client.DeleteDeviceServiceState,
 		),
-		metricsPusher: metrics.NewMetricsPusher(client, serviceMetricsFetcher),
+		metricsPusher: metrics.NewMetricsPusher(client, serviceMetricsFetcher, metricsBuffer),
 		infoReporter:  info.NewReporter(client, version),
 		localServer:   local.NewServer(service),
 		remoteServer:  remote.NewServer(client, service),
@@ -144,21 +170,57 @@ func (a *Agent) writeFile(contents []byte, elem ...string) error {
 	return nil
 }
 
+func (a *Agent) writePrivateFile(contents []byte, elem ...string) error {
+	if err := os.MkdirAll(a.fileLocation(), 0700); err != nil {
+		return err
+	}
+	return file.WriteFileAtomic(a.fileLocation(elem...), contents, 0600)
+}
+
+func (a *Agent) fileExists(elem ...string) (bool, error) {
+	_, err := os.Stat(a.fileLocation(elem...))
+	if err == nil {
+		return true, nil
+	} else if os.IsNotExist(err) {
+		return false, nil
+	}
+	return false, err
+}
+
 func (a *Agent) Initialize() error {
-	if _, err := os.Stat(a.fileLocation(accessKeyFilename)); err == nil {
+	hasAccessKey, err := a.fileExists(accessKeyFilename)
+	if err != nil {
+		return errors.Wrap(err, "failed to check for access key")
+	}
+	hasClientCert, err := a.fileExists(clientCertFilename)
+	if err != nil {
+		return errors.Wrap(err, "failed to check for client certificate")
+	}
+
+	if hasAccessKey || hasClientCert {
 		log.Info("device already registered")
-	} else if os.IsNotExist(err) {
+	} else {
 		log.Info("registering device")
 		if err = a.register(); err != nil {
 			return errors.Wrap(err, "failed to register device")
 		}
-	} else if err != nil {
-		return errors.Wrap(err, "failed to check for access key")
+		hasClientCert = a.certificateAuth
 	}
 
-	accessKeyBytes, err := ioutil.ReadFile(a.fileLocation(accessKeyFilename))
-	if err != nil {
-		return errors.Wrap(err, "failed to read access key")
+	// Devices keep using whichever credential they registered with
+	a.certificateAuth = hasClientCert
+	if a.certificateAuth {
+		certificate, err := tls.LoadX509KeyPair(a.fileLocation(clientCertFilename), a.fileLocation(clientKeyFilename))
+		if err != nil {
+			return errors.Wrap(err, "failed to load client certificate")
+		}
+		a.client.SetClientCertificate(certificate)
+	} else {
+		accessKeyBytes, err := ioutil.ReadFile(a.fileLocation(accessKeyFilename))
+		if err != nil {
+			return errors.Wrap(err, "failed to read access key")
+		}
+		a.client.SetAccessKey(string(accessKeyBytes))
 	}
 
 	deviceIDBytes, err := ioutil.ReadFile(a.fileLocation(deviceIDFilename))
@@ -166,7 +228,6 @@ func (a *Agent) Initialize() error {
 		return errors.Wrap(err, "failed to read device ID")
 	}
 
-	a.client.SetAccessKey(string(accessKeyBytes))
 	a.client.SetDeviceID(string(deviceIDBytes))
 
 	ticker := time.NewTicker(time.Second)
@@ -187,12 +248,30 @@ func (a *Agent) register() error {
 	ctx, cancel := dpcontext.New(context.Background(), time.Minute)
 	defer cancel()
 
-	registerDeviceResponse, err := a.client.RegisterDevice(ctx, a.registrationToken)
+	var csr string
+	if a.certificateAuth {
+		var err error
+		csr, err = a.createClientKey()
+		if err != nil {
+			return errors.Wrap(err, "failed to create client key")
+		}
+	}
+
+	registerDeviceResponse, err := a.client.RegisterDevice(ctx, a.registrationToken, csr)
 	if err != nil {
 		return errors.Wrap(err, "failed to register device")
 	}
-	if err := a.writeFile([]byte(registerDeviceResponse.DeviceAccessKeyValue), accessKeyFilename); err != nil {
-		return errors.Wrap(err, "failed to save access key")
+	if a.certificateAuth {
+		if registerDeviceResponse.DeviceCertificate == "" {
+			return errors.New("controller didn't issue a client certificate")
+		}
+		if err := a.writeFile([]byte(registerDeviceResponse.DeviceCertificate), clientCertFilename); err != nil {
+			return errors.Wrap(err, "failed to save client certificate")
+		}
+	} else {
+		if err := a.writeFile([]byte(registerDeviceResponse.DeviceAccessKeyValue), accessKeyFilename); err != nil {
+			return errors.Wrap(err, "failed to save access key")
+		}
 	}
 	if err := a.writeFile([]byte(registerDeviceResponse.DeviceID), deviceIDFilename); err != nil {
 		return errors.Wrap(err, "failed to save device ID")
@@ -200,11 +279,38 @@ func (a *Agent) register() error {
 	return nil
 }
 
+// createClientKey generates the device's private key and saves it, returning
+// a PEM encoded certificate signing request for it. The key never leaves the
+// device.
+func (a *Agent) createClientKey() (string, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return "", err
+	}
+
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		return "", err
+	}
+	if err := a.writePrivateFile(pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), clientKeyFilename); err != nil {
+		return "", err
+	}
+
+	csrDER, err := x509.CreateCertificateRequest(rand.Reader, &x509.CertificateRequest{}, key)
+	if err != nil {
+		return "", err
+	}
+	return string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE REQUEST", Bytes: csrDER})), nil
+}
+
 func (a *Agent) Run() {
 	go a.runBundleApplier()
 	go a.runInfoReporter()
 	go a.runRemoteServer()
 	go a.runLocalServer()
+	if a.accessKeyRotation > 0 && !a.certificateAuth {
+		go a.runAccessKeyRotator()
+	}
 	select {}
 }
 
@@ -317,6 +423,51 @@ func mergeBundle(oldBundle *models.Bundle, bundleBytes []byte) *models.Bundle {
 	return &bundle
 }
 
+func (a *Agent) runAccessKeyRotator() {
+	ticker := time.NewTicker(time.Hour)
+	defer ticker.Stop()
+
+	for {
+		if err := a.rotateAccessKeyIfDue(); err != nil {
+			log.WithError(err).Error("rotate access key")
+		}
+
+		<-ticker.C
+	}
+}
+
+// rotateAccessKeyIfDue replaces the access key once the saved one is older
+// than the rotation interval. The controller keeps accepting the old key
+// until the new one is used, so it's only switched to after it's been saved.
+func (a *Agent) rotateAccessKeyIfDue() error {
+	info, err := os.Stat(a.fileLocation(accessKeyFilename))
+	if err != nil {
+		return errors.Wrap(err, "stat access key")
+	}
+	if time.Since(info.ModTime()) < a.accessKeyRotation {
+		return nil
+	}
+
+	ctx, cancel := dpcontext.New(context.Background(), time.Minute)
+	defer cancel()
+
+	rotateDeviceAccessKeyResponse, err := a.client.RotateDeviceAccessKey(ctx)
+	if err != nil {
+		return err
+	}
+	if rotateDeviceAccessKeyResponse.DeviceAccessKeyValue == "" {
+		return errors.New("no access key in response")
+	}
+
+	if err := a.writeFile([]byte(rotateDeviceAccessKeyResponse.DeviceAccessKeyValue), accessKeyFilename); err != nil {
+		return errors.Wrap(err, "save access key")
+	}
+	a.client.SetAccessKey(rotateDeviceAccessKeyResponse.DeviceAccessKeyValue)
+
+	log.Info("rotated access key")
+	return nil
+}
+
 func (a *Agent) runInfoReporter() {
 	ticker := time.NewTicker(time.Minute)
 	defer ticker.Stop()
@@ -2,10 +2,21 @@ package agent
 
 import (
 	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path"
+	"sync"
 	"testing"
+	"time"
 
+	"github.com/deviceplane/deviceplane/pkg/agent/client"
 	"github.com/deviceplane/deviceplane/pkg/models"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestMergeBundleClean(t *testing.T) {
@@ -88,3 +99,68 @@ func TestMergeBundleIncompatibleWithEmptyOld(t *testing.T) {
 	assert.NotEqual(t, new, *merged)
 	assert.Equal(t, new["desiredAgentVersion"], merged.DesiredAgentVersion)
 }
+
+func TestRotateAccessKeyPersistFailure(t *testing.T) {
+	var lock sync.Mutex
+	var rotations int
+	var usedKeys []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		lock.Lock()
+		defer lock.Unlock()
+
+		accessKey, _, _ := r.BasicAuth()
+		usedKeys = append(usedKeys, accessKey)
+		rotations++
+		json.NewEncoder(w).Encode(models.RotateDeviceAccessKeyResponse{
+			DeviceAccessKeyValue: fmt.Sprintf("key%d", rotations),
+		})
+	}))
+	defer server.Close()
+
+	serverURL, err := url.Parse(server.URL)
+	require.NoError(t, err)
+	c := client.NewClient(serverURL, "prj", nil)
+	c.SetDeviceID("dev")
+	c.SetAccessKey("key0")
+
+	stateDir, err := ioutil.TempDir("", "agent")
+	require.NoError(t, err)
+	defer os.RemoveAll(stateDir)
+
+	a := &Agent{
+		client:            c,
+		projectID:         "prj",
+		stateDir:          stateDir,
+		accessKeyRotation: time.Hour,
+	}
+	accessKeyPath := a.fileLocation(accessKeyFilename)
+	old := time.Now().Add(-2 * time.Hour)
+
+	// A non-empty directory where the key is saved makes saving it fail,
+	// even for root
+	require.NoError(t, os.MkdirAll(path.Join(accessKeyPath, "blocker"), 0700))
+	require.NoError(t, os.Chtimes(accessKeyPath, old, old))
+
+	// The controller rotated the key but the agent couldn't save it, so it
+	// keeps using the old one
+	require.Error(t, a.rotateAccessKeyIfDue())
+
+	require.NoError(t, os.RemoveAll(accessKeyPath))
+	require.NoError(t, ioutil.WriteFile(accessKeyPath, []byte("key0"), 0644))
+	require.NoError(t, os.Chtimes(accessKeyPath, old, old))
+
+	require.NoError(t, a.rotateAccessKeyIfDue())
+	saved, err := ioutil.ReadFile(accessKeyPath)
+	require.NoError(t, err)
+	require.Equal(t, "key2", string(saved))
+
+	// The saved key isn't due yet
+	require.NoError(t, a.rotateAccessKeyIfDue())
+	require.Equal(t, 2, rotations)
+	require.Equal(t, []string{"key0", "key0"}, usedKeys)
+
+	// The next rotation uses the key that was saved
+	require.NoError(t, os.Chtimes(accessKeyPath, old, old))
+	require.NoError(t, a.rotateAccessKeyIfDue())
+	require.Equal(t, []string{"key0", "key0", "key2"}, usedKeys)
+}
@@ -2,11 +2,16 @@ package client
 
 import (
 	"bytes"
+	"crypto/tls"
 	"encoding/json"
+	"fmt"
 	"io/ioutil"
 	"net"
+	"net/http"
 	"net/url"
 	"strings"
+	"sync"
+	"time"
 
 	"github.com/apex/log"
 	dpcontext "github.com/deviceplane/deviceplane/pkg/context"
@@ -14,19 +19,38 @@ import (
 	"github.com/deviceplane/deviceplane/pkg/models"
 	dpwebsocket "github.com/deviceplane/deviceplane/pkg/websocket"
 	"github.com/function61/holepunch-server/pkg/wsconnadapter"
+	"github.com/gorilla/websocket"
 )
 
 const (
 	bundleURL = "bundle"
 )
 
+// StatusError is returned when the controller responds with an error status.
+type StatusError struct {
+	StatusCode int
+	Body       string
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("unexpected status code %d: %s", e.StatusCode, strings.TrimSpace(e.Body))
+}
+
+// Temporary reports whether the request might succeed if it's retried.
+func (e *StatusError) Temporary() bool {
+	return e.StatusCode >= 500 || e.StatusCode == http.StatusTooManyRequests
+}
+
 type Client struct {
 	url        *url.URL
 	projectID  string
 	httpClient *dphttp.Client
+	wsDialer   *dpwebsocket.Dialer
+
+	deviceID string
 
-	deviceID  string
-	accessKey string
+	accessKeyLock sync.RWMutex
+	accessKey     string
 }
 
 func NewClient(url *url.URL, projectID string, httpClient *dphttp.Client) *Client {
@@ -37,6 +61,31 @@ func NewClient(url *url.URL, projectID string, httpClient *dphttp.Client) *Clien
 		url:        url,
 		projectID:  projectID,
 		httpClient: httpClient,
+		wsDialer:   dpwebsocket.DefaultDialer,
+	}
+}
+
+// SetClientCertificate makes the client authenticate with the certificate
+// instead of an access key. It must be called before the client is used.
+func (c *Client) SetClientCertificate(certificate tls.Certificate) {
+	tlsConfig := &tls.Config{
+		Certificates: []tls.Certificate{certificate},
+	}
+
+	c.httpClient = &dphttp.Client{
+		Client: &http.Client{
+			Transport: &http.Transport{
+				Proxy:           http.ProxyFromEnvironment,
+				TLSClientConfig: tlsConfig,
+			},
+		},
+	}
+	c.wsDialer = &dpwebsocket.Dialer{
+		Dialer: &websocket.Dialer{
+			Proxy:            http.ProxyFromEnvironment,
+			HandshakeTimeout: 45 * time.Second,
+			TLSClientConfig:  tlsConfig,
+		},
 	}
 }
 
@@ -44,13 +93,32 @@ func (c *Client) SetDeviceID(deviceID string) {
 	c.deviceID = deviceID
 }
 
+// SetAccessKey can be called while requests are in flight, which happens
+// when the access key is rotated.
 func (c *Client) SetAccessKey(accessKey string) {
+	c.accessKeyLock.Lock()
 	c.accessKey = accessKey
+	c.accessKeyLock.Unlock()
+}
+
+func (c *Client) getAccessKey() string {
+	c.accessKeyLock.RLock()
+	defer c.accessKeyLock.RUnlock()
+	return c.accessKey
 }
 
-func (c *Client) RegisterDevice(ctx *dpcontext.Context, registrationToken string) (*models.RegisterDeviceResponse, error) {
+// authorize adds the access key to the request. Devices that authenticate
+// with a client certificate don't have one.
+func (c *Client) authorize(req *dphttp.Request) {
+	if accessKey := c.getAccessKey(); accessKey != "" {
+		req.SetBasicAuth(accessKey, "")
+	}
+}
+
+func (c *Client) RegisterDevice(ctx *dpcontext.Context, registrationToken, certificateSigningRequest string) (*models.RegisterDeviceResponse, error) {
 	req := models.RegisterDeviceRequest{
 		DeviceRegistrationTokenID: registrationToken,
+		CertificateSigningRequest: certificateSigningRequest,
 	}
 
 	var registerDeviceResponse models.RegisterDeviceResponse
@@ -66,16 +134,30 @@ func (c *Client) GetBundleBytes(ctx *dpcontext.Context) ([]byte, error) {
 	return c.getB(ctx, "projects", c.projectID, "devices", c.deviceID, "bundle")
 }
 
+func (c *Client) RotateDeviceAccessKey(ctx *dpcontext.Context) (*models.RotateDeviceAccessKeyResponse, error) {
+	var rotateDeviceAccessKeyResponse models.RotateDeviceAccessKeyResponse
+	err := c.post(ctx, struct{}{}, &rotateDeviceAccessKeyResponse, "projects", c.projectID, "devices", c.deviceID, "accesskeys", "rotate")
+	if err != nil {
+		return nil, err
+	}
+
+	return &rotateDeviceAccessKeyResponse, nil
+}
+
 func (c *Client) SetDeviceInfo(ctx *dpcontext.Context, req models.SetDeviceInfoRequest) error {
 	return c.post(ctx, req, nil, "projects", c.projectID, "devices", c.deviceID, "info")
 }
 
+// SendDeviceMetrics fails with a *StatusError if the controller doesn't
+// accept the metrics.
 func (c *Client) SendDeviceMetrics(ctx *dpcontext.Context, req models.DatadogPostMetricsRequest) error {
-	return c.post(ctx, req, nil, "projects", c.projectID, "devices", c.deviceID, "forwardmetrics", "device")
+	return c.postChecked(ctx, req, "projects", c.projectID, "devices", c.deviceID, "forwardmetrics", "device")
 }
 
+// SendServiceMetrics fails with a *StatusError if the controller doesn't
+// accept the metrics.
 func (c *Client) SendServiceMetrics(ctx *dpcontext.Context, req models.IntermediateServiceMetricsRequest) error {
-	return c.post(ctx, req, nil, "projects", c.projectID, "devices", c.deviceID, "forwardmetrics", "service")
+	return c.postChecked(ctx, req, "projects", c.projectID, "devices", c.deviceID, "forwardmetrics", "service")
 }
 
 func (c *Client) SetDeviceApplicationStatus(ctx *dpcontext.Context, applicationID string, req models.SetDeviceApplicationStatusRequest) error {
@@ -108,9 +190,9 @@ func (c *Client) InitiateDeviceConnection(ctx *dpcontext.Context) (net.Conn, err
 		return nil, err
 	}
 
-	req.SetBasicAuth(c.accessKey, "")
+	c.authorize(req)
 
-	wsConn, _, err := dpwebsocket.DefaultDialer.Dial(
+	wsConn, _, err := c.wsDialer.Dial(
 		ctx,
 		getWebsocketURL(c.url, "projects", c.projectID, "devices", c.deviceID, "connection"),
 		req.Header,
@@ -123,7 +205,7 @@ func (c *Client) InitiateDeviceConnection(ctx *dpcontext.Context) (net.Conn, err
 }
 
 func (c *Client) Revdial(ctx *dpcontext.Context, path string) (*dpwebsocket.Conn, *dphttp.Response, error) {
-	return dpwebsocket.DefaultDialer.Dial(
+	return c.wsDialer.Dial(
 		ctx,
 		getWebsocketURL(c.url, strings.TrimPrefix(path, "/")),
 		nil,
@@ -147,7 +229,7 @@ func (c *Client) getB(ctx *dpcontext.Context, s ...string) ([]byte, error) {
 		return nil, err
 	}
 
-	req.SetBasicAuth(c.accessKey, "")
+	c.authorize(req)
 
 	resp, err := c.httpClient.Do(req)
 	if err != nil {
@@ -183,32 +265,53 @@ func (c *Client) post(ctx *dpcontext.Context, in, out interface{}, s ...string)
 	return json.Unmarshal(bytes, &out)
 }
 
+// postChecked is like post, but it also fails when the response has an
+// error status.
+func (c *Client) postChecked(ctx *dpcontext.Context, in interface{}, s ...string) error {
+	statusCode, bytes, err := c.postStatus(ctx, in, s...)
+	if err != nil {
+		return err
+	}
+	if statusCode < 200 || statusCode >= 300 {
+		return &StatusError{
+			StatusCode: statusCode,
+			Body:       string(bytes),
+		}
+	}
+	return nil
+}
+
 func (c *Client) postB(ctx *dpcontext.Context, in interface{}, s ...string) ([]byte, error) {
+	_, bytes, err := c.postStatus(ctx, in, s...)
+	return bytes, err
+}
+
+func (c *Client) postStatus(ctx *dpcontext.Context, in interface{}, s ...string) (int, []byte, error) {
 	reqBytes, err := json.Marshal(in)
 	if err != nil {
-		return nil, err
+		return 0, nil, err
 	}
 	reader := bytes.NewReader(reqBytes)
 
 	req, err := dphttp.NewRequest(ctx, "POST", getURL(c.url, s...), reader)
 	if err != nil {
-		return nil, err
+		return 0, nil, err
 	}
 
-	req.SetBasicAuth(c.accessKey, "")
+	c.authorize(req)
 
 	resp, err := c.httpClient.Do(req)
 	if err != nil {
 		log.WithFields(log.Fields{
 			"error": err.Error(),
 		}).Debug("POST response")
-		return nil, err
+		return 0, nil, err
 	}
 	defer resp.Body.Close()
 
 	bytes, err := ioutil.ReadAll(resp.Body)
 	if err != nil {
-		return nil, err
+		return 0, nil, err
 	}
 
 	log.WithFields(log.Fields{
@@ -217,7 +320,7 @@ func (c *Client) postB(ctx *dpcontext.Context, in interface{}, s ...string) ([]b
 		"body":   string(bytes),
 	}).Debug("POST response")
 
-	return bytes, nil
+	return resp.StatusCode, bytes, nil
 }
 
 func (c *Client) delete(ctx *dpcontext.Context, out interface{}, s ...string) error {
@@ -237,7 +340,7 @@ func (c *Client) deleteB(ctx *dpcontext.Context, s ...string) ([]byte, error) {
 		return nil, err
 	}
 
-	req.SetBasicAuth(c.accessKey, "")
+	c.authorize(req)
 
 	resp, err := c.httpClient.Do(req)
 	if err != nil {
@@ -0,0 +1,280 @@
+package metrics
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/apex/log"
+	"github.com/deviceplane/deviceplane/pkg/agent/client"
+	"github.com/deviceplane/deviceplane/pkg/file"
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const (
+	bufferKindDevice  = "device"
+	bufferKindService = "service"
+
+	dropReasonSize     = "size"
+	dropReasonAge      = "age"
+	dropReasonRejected = "rejected"
+)
+
+var (
+	bufferedRequests = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "deviceplane_agent_metrics_buffer_requests",
+		Help: "Metrics requests buffered on disk waiting to be sent to the controller.",
+	})
+	bufferedBytes = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "deviceplane_agent_metrics_buffer_bytes",
+		Help: "Size of the metrics requests buffered on disk.",
+	})
+	droppedRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "deviceplane_agent_metrics_buffer_dropped_requests_total",
+		Help: "Buffered metrics requests that were dropped without being sent, by reason.",
+	}, []string{"reason"})
+	droppedBytes = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "deviceplane_agent_metrics_buffer_dropped_bytes_total",
+		Help: "Size of the buffered metrics requests that were dropped without being sent, by reason.",
+	}, []string{"reason"})
+)
+
+func init() {
+	prometheus.MustRegister(bufferedRequests, bufferedBytes, droppedRequests, droppedBytes)
+}
+
+type bufferEntry struct {
+	name    string
+	kind    string
+	size    int64
+	created time.Time
+}
+
+// Buffer keeps metrics requests on disk while the controller can't be
+// reached, so that they can be sent later with their original timestamps.
+// The oldest requests are dropped once the buffer is larger than its maximum
+// size, or when they're older than its maximum age.
+type Buffer struct {
+	dir     string
+	maxSize int64
+	maxAge  time.Duration
+	now     func() time.Time
+
+	lock    sync.Mutex
+	loaded  bool
+	entries []bufferEntry
+	size    int64
+}
+
+func NewBuffer(dir string, maxSize int64, maxAge time.Duration) *Buffer {
+	return &Buffer{
+		dir:     dir,
+		maxSize: maxSize,
+		maxAge:  maxAge,
+		now:     time.Now,
+	}
+}
+
+// Len returns the number of buffered requests.
+func (b *Buffer) Len() int {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	if err := b.load(); err != nil {
+		log.WithError(err).Error("load metrics buffer")
+	}
+	return len(b.entries)
+}
+
+// Add buffers a request of the given kind.
+func (b *Buffer) Add(kind string, req interface{}) error {
+	payload, err := json.Marshal(req)
+	if err != nil {
+		return err
+	}
+
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	if err := b.load(); err != nil {
+		return err
+	}
+
+	now := b.now()
+	entry := bufferEntry{
+		name:    fmt.Sprintf("%020d-%s", now.UnixNano(), kind),
+		kind:    kind,
+		size:    int64(len(payload)),
+		created: now,
+	}
+	if entry.size > b.maxSize {
+		b.recordDrop(dropReasonSize, 1, entry.size)
+		return nil
+	}
+
+	if err := file.WriteFileAtomic(filepath.Join(b.dir, entry.name), payload, 0600); err != nil {
+		return errors.Wrap(err, "write buffered metrics")
+	}
+	b.entries = append(b.entries, entry)
+	b.size += entry.size
+
+	b.enforceLimits()
+	return nil
+}
+
+// Replay sends buffered requests, oldest first, and removes the ones that
+// were sent. It stops at the first request that fails but might succeed
+// later, which is left in the buffer along with everything after it.
+// Requests that the controller rejects outright are dropped.
+func (b *Buffer) Replay(send func(kind string, payload []byte) error) error {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	if err := b.load(); err != nil {
+		return err
+	}
+	b.enforceLimits()
+
+	for len(b.entries) > 0 {
+		entry := b.entries[0]
+
+		payload, err := ioutil.ReadFile(filepath.Join(b.dir, entry.name))
+		if err == nil {
+			err = send(entry.kind, payload)
+			if err != nil && isTemporary(err) {
+				return err
+			}
+		}
+		if err != nil {
+			log.WithError(err).WithField("kind", entry.kind).Warn("dropping buffered metrics")
+			b.recordDrop(dropReasonRejected, 1, entry.size)
+		}
+
+		b.removeOldest(1)
+	}
+
+	return nil
+}
+
+// load reads the requests that were buffered before the agent started.
+func (b *Buffer) load() error {
+	if b.loaded {
+		return nil
+	}
+
+	if err := os.MkdirAll(b.dir, 0700); err != nil {
+		return err
+	}
+
+	fileInfos, err := ioutil.ReadDir(b.dir)
+	if err != nil {
+		return err
+	}
+
+	for _, fileInfo := range fileInfos {
+		// Skips leftovers from interrupted atomic writes
+		if fileInfo.IsDir() || strings.HasPrefix(fileInfo.Name(), ".") {
+			continue
+		}
+
+		parts := strings.SplitN(fileInfo.Name(), "-", 2)
+		if len(parts) != 2 {
+			continue
+		}
+		nanos, err := strconv.ParseInt(parts[0], 10, 64)
+		if err != nil {
+			continue
+		}
+
+		b.entries = append(b.entries, bufferEntry{
+			name:    fileInfo.Name(),
+			kind:    parts[1],
+			size:    fileInfo.Size(),
+			created: time.Unix(0, nanos),
+		})
+		b.size += fileInfo.Size()
+	}
+
+	// Names start with a fixed width timestamp so they sort chronologically
+	sort.Slice(b.entries, func(i, j int) bool {
+		return b.entries[i].name < b.entries[j].name
+	})
+
+	b.loaded = true
+	b.enforceLimits()
+	return nil
+}
+
+func (b *Buffer) enforceLimits() {
+	cutoff := b.now().Add(-b.maxAge)
+
+	var expired, expiredBytes int64
+	for _, entry := range b.entries {
+		if !entry.created.Before(cutoff) {
+			break
+		}
+		expired++
+		expiredBytes += entry.size
+	}
+	if expired > 0 {
+		b.removeOldest(int(expired))
+		b.recordDrop(dropReasonAge, expired, expiredBytes)
+	}
+
+	var overflow, overflowBytes int64
+	for _, entry := range b.entries {
+		if b.size-overflowBytes <= b.maxSize {
+			break
+		}
+		overflow++
+		overflowBytes += entry.size
+	}
+	if overflow > 0 {
+		b.removeOldest(int(overflow))
+		b.recordDrop(dropReasonSize, overflow, overflowBytes)
+	}
+
+	bufferedRequests.Set(float64(len(b.entries)))
+	bufferedBytes.Set(float64(b.size))
+}
+
+func (b *Buffer) removeOldest(n int) {
+	for _, entry := range b.entries[:n] {
+		if err := os.Remove(filepath.Join(b.dir, entry.name)); err != nil && !os.IsNotExist(err) {
+			log.WithError(err).Error("remove buffered metrics")
+		}
+		b.size -= entry.size
+	}
+	b.entries = b.entries[n:]
+
+	bufferedRequests.Set(float64(len(b.entries)))
+	bufferedBytes.Set(float64(b.size))
+}
+
+func (b *Buffer) recordDrop(reason string, requests, bytes int64) {
+	droppedRequests.WithLabelValues(reason).Add(float64(requests))
+	droppedBytes.WithLabelValues(reason).Add(float64(bytes))
+
+	log.WithField("reason", reason).
+		WithField("requests", requests).
+		WithField("bytes", bytes).
+		Warn("dropped buffered metrics")
+}
+
+// isTemporary reports whether a failed request should be retried. Only
+// error responses from the controller are conclusive, anything else means
+// that it couldn't be reached.
+func isTemporary(err error) bool {
+	if statusErr, ok := errors.Cause(err).(*client.StatusError); ok {
+		return statusErr.Temporary()
+	}
+	return true
+}
@@ -0,0 +1,117 @@
+package metrics
+
+import (
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/deviceplane/deviceplane/pkg/agent/client"
+	"github.com/stretchr/testify/require"
+)
+
+type bufferedRequest struct {
+	kind    string
+	payload string
+}
+
+func newTestBuffer(t *testing.T, maxSize int64) (*Buffer, *time.Time, func()) {
+	dir, err := ioutil.TempDir("", "metrics-buffer")
+	require.NoError(t, err)
+
+	now := time.Unix(1577836800, 0)
+	b := NewBuffer(dir, maxSize, time.Hour)
+	b.now = func() time.Time {
+		return now
+	}
+
+	return b, &now, func() {
+		os.RemoveAll(dir)
+	}
+}
+
+func replayAll(t *testing.T, b *Buffer) []bufferedRequest {
+	var ret []bufferedRequest
+	require.NoError(t, b.Replay(func(kind string, payload []byte) error {
+		ret = append(ret, bufferedRequest{kind, string(payload)})
+		return nil
+	}))
+	return ret
+}
+
+func TestBufferReplaysInOrder(t *testing.T) {
+	b, now, cleanup := newTestBuffer(t, 1024)
+	defer cleanup()
+
+	require.NoError(t, b.Add(bufferKindDevice, 1))
+	*now = now.Add(time.Second)
+	require.NoError(t, b.Add(bufferKindService, 2))
+	*now = now.Add(time.Second)
+	require.NoError(t, b.Add(bufferKindDevice, 3))
+
+	// A new buffer in the same directory picks up where the old one left off
+	reloaded := NewBuffer(b.dir, b.maxSize, b.maxAge)
+	reloaded.now = b.now
+	require.Equal(t, 3, reloaded.Len())
+
+	require.Equal(t, []bufferedRequest{
+		{bufferKindDevice, "1"},
+		{bufferKindService, "2"},
+		{bufferKindDevice, "3"},
+	}, replayAll(t, reloaded))
+	require.Equal(t, 0, reloaded.Len())
+}
+
+func TestBufferStopsAtTemporaryFailure(t *testing.T) {
+	b, now, cleanup := newTestBuffer(t, 1024)
+	defer cleanup()
+
+	for i := 0; i < 3; i++ {
+		require.NoError(t, b.Add(bufferKindDevice, i))
+		*now = now.Add(time.Second)
+	}
+
+	var sent []string
+	err := b.Replay(func(kind string, payload []byte) error {
+		switch string(payload) {
+		case "0":
+			return &client.StatusError{StatusCode: http.StatusBadRequest}
+		case "1":
+			return errors.New("connection refused")
+		}
+		sent = append(sent, string(payload))
+		return nil
+	})
+	require.Error(t, err)
+	require.Empty(t, sent)
+
+	// The rejected request is dropped but the unsent ones are kept
+	require.Equal(t, []bufferedRequest{
+		{bufferKindDevice, "1"},
+		{bufferKindDevice, "2"},
+	}, replayAll(t, b))
+}
+
+func TestBufferLimits(t *testing.T) {
+	b, now, cleanup := newTestBuffer(t, 7)
+	defer cleanup()
+
+	require.NoError(t, b.Add(bufferKindDevice, "old"))
+	*now = now.Add(2 * time.Hour)
+
+	// Too large to ever fit
+	require.NoError(t, b.Add(bufferKindDevice, "way too large"))
+
+	require.NoError(t, b.Add(bufferKindDevice, "a"))
+	*now = now.Add(time.Second)
+	require.NoError(t, b.Add(bufferKindDevice, "b"))
+	*now = now.Add(time.Second)
+	require.NoError(t, b.Add(bufferKindDevice, "c"))
+
+	require.Equal(t, []bufferedRequest{
+		{bufferKindDevice, `"b"`},
+		{bufferKindDevice, `"c"`},
+	}, replayAll(t, b))
+}
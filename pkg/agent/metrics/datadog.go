@@ -2,6 +2,8 @@ package metrics
 
 import (
 	"context"
+	"encoding/json"
+	"fmt"
 	"sync"
 	"time"
 
@@ -13,10 +15,15 @@ import (
 	"github.com/deviceplane/deviceplane/pkg/models"
 )
 
+// Buffered metrics are replayed before each push for at most this long, so
+// that a large backlog doesn't hold up collection
+const replayTimeout = 30 * time.Second
+
 type MetricsPusher struct {
 	client                *client.Client
 	statsCache            *translation.StatsCache
 	serviceMetricsFetcher *ServiceMetricsFetcher
+	buffer                *Buffer
 
 	lock sync.Mutex
 	once sync.Once
@@ -27,10 +34,12 @@ type MetricsPusher struct {
 func NewMetricsPusher(
 	client *client.Client,
 	serviceMetricsFetcher *ServiceMetricsFetcher,
+	buffer *Buffer,
 ) *MetricsPusher {
 	return &MetricsPusher{
 		client:                client,
 		serviceMetricsFetcher: serviceMetricsFetcher,
+		buffer:                buffer,
 
 		statsCache: translation.NewStatsCache(),
 	}
@@ -51,6 +60,10 @@ func (m *MetricsPusher) begin() {
 	defer ticker.Stop()
 
 	for {
+		if m.buffer != nil {
+			m.replayBuffer()
+		}
+
 		ctx, cancel := dpcontext.New(context.Background(), 10*time.Second)
 
 		var wg sync.WaitGroup
@@ -102,12 +115,9 @@ func (m *MetricsPusher) PushDeviceMetrics(ctx *dpcontext.Context) {
 		return
 	}
 
-	err = m.client.SendDeviceMetrics(ctx, models.DatadogPostMetricsRequest{
+	m.send(ctx, bufferKindDevice, models.DatadogPostMetricsRequest{
 		Series: processedMetrics,
 	})
-	if err != nil {
-		log.WithError(err).Error("could not POST device metrics")
-	}
 }
 
 func (m *MetricsPusher) PushServiceMetrics(ctx *dpcontext.Context) {
@@ -188,8 +198,65 @@ func (m *MetricsPusher) PushServiceMetrics(ctx *dpcontext.Context) {
 		return
 	}
 
-	err := m.client.SendServiceMetrics(ctx, datadogMetrics)
+	m.send(ctx, bufferKindService, datadogMetrics)
+}
+
+// send posts metrics to the controller, buffering them if it can't be
+// reached. Metrics are only sent directly when nothing older is buffered, so
+// that the controller receives them in order.
+func (m *MetricsPusher) send(ctx *dpcontext.Context, kind string, req interface{}) {
+	if m.buffer == nil || m.buffer.Len() == 0 {
+		err := m.sendRequest(ctx, req)
+		if err == nil {
+			return
+		}
+		log.WithError(err).Errorf("could not POST %s metrics", kind)
+		if m.buffer == nil || !isTemporary(err) {
+			return
+		}
+	}
+
+	if err := m.buffer.Add(kind, req); err != nil {
+		log.WithError(err).Errorf("could not buffer %s metrics", kind)
+	}
+}
+
+func (m *MetricsPusher) sendRequest(ctx *dpcontext.Context, req interface{}) error {
+	switch req := req.(type) {
+	case models.DatadogPostMetricsRequest:
+		return m.client.SendDeviceMetrics(ctx, req)
+	case models.IntermediateServiceMetricsRequest:
+		return m.client.SendServiceMetrics(ctx, req)
+	default:
+		return fmt.Errorf("unknown metrics request %T", req)
+	}
+}
+
+func (m *MetricsPusher) replayBuffer() {
+	ctx, cancel := dpcontext.New(context.Background(), replayTimeout)
+	defer cancel()
+
+	err := m.buffer.Replay(func(kind string, payload []byte) error {
+		var req interface{}
+		switch kind {
+		case bufferKindDevice:
+			var deviceReq models.DatadogPostMetricsRequest
+			if err := json.Unmarshal(payload, &deviceReq); err != nil {
+				return err
+			}
+			req = deviceReq
+		case bufferKindService:
+			var serviceReq models.IntermediateServiceMetricsRequest
+			if err := json.Unmarshal(payload, &serviceReq); err != nil {
+				return err
+			}
+			req = serviceReq
+		default:
+			return fmt.Errorf("unknown buffered metrics kind %q", kind)
+		}
+		return m.sendRequest(ctx, req)
+	})
 	if err != nil {
-		log.WithError(err).Error("could not POST service metrics")
+		log.WithError(err).Debug("could not replay buffered metrics")
 	}
 }
@@ -4,6 +4,7 @@ import (
 	"errors"
 	"fmt"
 	"net/http"
+	"time"
 
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
@@ -35,6 +36,8 @@ var (
 			"time",
 			"netdev",
 		},
+		ScriptTimeout:  DefaultScriptTimeout,
+		ScriptInterval: DefaultScriptInterval,
 	}
 )
 
@@ -43,6 +46,15 @@ type NodeCollectorConfig struct {
 	SysFSPath  string
 	RootFSPath string
 	Collectors []string
+
+	// Metrics are read from *.prom files in this directory by the textfile
+	// collector
+	TextfileDirectory string
+	// Every executable in this directory is run at most once per
+	// ScriptInterval, and the metrics that it prints are merged in
+	ScriptDirectory string
+	ScriptTimeout   time.Duration
+	ScriptInterval  time.Duration
 }
 
 func HostMetricsHandler(ncConfig *NodeCollectorConfig) (*http.Handler, error) {
@@ -64,7 +76,11 @@ func HostMetricsHandler(ncConfig *NodeCollectorConfig) (*http.Handler, error) {
 	handler := promhttp.InstrumentMetricHandler(
 		metricsRegistry,
 		promhttp.HandlerFor(
-			prometheus.Gatherers{metricsRegistry, r},
+			prometheus.Gatherers{metricsRegistry, r, &scriptGatherer{
+				dir:      ncConfig.ScriptDirectory,
+				timeout:  ncConfig.ScriptTimeout,
+				interval: ncConfig.ScriptInterval,
+			}},
 			promhttp.HandlerOpts{
 				ErrorLog:            clog.NewErrorLogger(),
 				ErrorHandling:       promhttp.ContinueOnError,
@@ -97,6 +113,7 @@ func NewNodeCollector(config *NodeCollectorConfig) (*collector.NodeCollector, er
 		"--path.procfs", config.ProcFSPath,
 		"--path.sysfs", config.SysFSPath,
 		"--path.rootfs", config.RootFSPath,
+		"--collector.textfile.directory", config.TextfileDirectory,
 	})
 	if err != nil {
 		return nil, err
@@ -0,0 +1,225 @@
+package metrics
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/apex/log"
+	"github.com/pkg/errors"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/prometheus/common/expfmt"
+)
+
+const (
+	DefaultScriptTimeout  = 10 * time.Second
+	DefaultScriptInterval = 30 * time.Second
+
+	// Reported for every script, like node_textfile_scrape_error is for
+	// the textfile collector
+	scriptSuccessMetric = "node_script_success"
+)
+
+var errScriptTimeout = errors.New("script timed out")
+
+// scriptGatherer runs every executable in a directory and gathers the
+// metrics that they print in the text exposition format. Scripts are run at
+// most once per interval, and scrapes in between get the last results.
+type scriptGatherer struct {
+	dir      string
+	timeout  time.Duration
+	interval time.Duration
+
+	lock       sync.Mutex
+	gatheredAt time.Time
+	families   []*dto.MetricFamily
+}
+
+func (g *scriptGatherer) Gather() ([]*dto.MetricFamily, error) {
+	if g.dir == "" {
+		return nil, nil
+	}
+
+	g.lock.Lock()
+	defer g.lock.Unlock()
+
+	if !g.gatheredAt.IsZero() && time.Since(g.gatheredAt) < g.interval {
+		return g.families, nil
+	}
+
+	g.families = g.gather()
+	g.gatheredAt = time.Now()
+	return g.families, nil
+}
+
+func (g *scriptGatherer) gather() []*dto.MetricFamily {
+
+	fileInfos, err := ioutil.ReadDir(g.dir)
+	if err != nil {
+		log.WithError(err).WithField("dir", g.dir).Debug("read metrics script directory")
+		return nil
+	}
+
+	families := make(map[string]*dto.MetricFamily)
+	success := &dto.MetricFamily{
+		Name: stringPtr(scriptSuccessMetric),
+		Help: stringPtr("1 if the script ran and printed valid metrics, 0 otherwise."),
+		Type: dto.MetricType_GAUGE.Enum(),
+	}
+
+	for _, fileInfo := range fileInfos {
+		if fileInfo.IsDir() || strings.HasPrefix(fileInfo.Name(), ".") || fileInfo.Mode()&0111 == 0 {
+			continue
+		}
+
+		value := 1.0
+		scriptFamilies, err := g.run(fileInfo.Name())
+		if err != nil {
+			log.WithError(err).WithField("script", fileInfo.Name()).Error("run metrics script")
+			value = 0
+		}
+
+		for name, family := range scriptFamilies {
+			existing, ok := families[name]
+			if !ok {
+				families[name] = family
+				continue
+			}
+			if existing.GetType() != family.GetType() {
+				log.WithField("script", fileInfo.Name()).
+					WithField("metric", name).
+					Error("metrics script output conflicts with another script")
+				continue
+			}
+			existing.Metric = append(existing.Metric, family.Metric...)
+		}
+
+		success.Metric = append(success.Metric, &dto.Metric{
+			Label: []*dto.LabelPair{
+				{
+					Name:  stringPtr("script"),
+					Value: stringPtr(fileInfo.Name()),
+				},
+			},
+			Gauge: &dto.Gauge{
+				Value: float64Ptr(value),
+			},
+		})
+	}
+
+	ret := make([]*dto.MetricFamily, 0, len(families)+1)
+	for _, family := range families {
+		ret = append(ret, family)
+	}
+	if len(success.Metric) > 0 {
+		ret = append(ret, success)
+	}
+	sort.Slice(ret, func(i, j int) bool {
+		return ret[i].GetName() < ret[j].GetName()
+	})
+	return ret
+}
+
+func (g *scriptGatherer) run(name string) (map[string]*dto.MetricFamily, error) {
+	path := filepath.Join(g.dir, name)
+	stdout, err := runScript(path, g.dir, g.timeout)
+	if err != nil {
+		return nil, err
+	}
+
+	var parser expfmt.TextParser
+	families, err := parser.TextToMetricFamilies(stdout)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, family := range families {
+		if family.Help == nil {
+			family.Help = stringPtr("Metric read from " + path)
+		}
+		// Timestamps aren't supported, the same as with textfiles
+		for _, metric := range family.Metric {
+			metric.TimestampMs = nil
+		}
+	}
+
+	return families, nil
+}
+
+// runScript runs a script and returns what it printed. The script gets its
+// own process group, which is killed once the script exits or times out, so
+// that processes it leaves behind can't keep its output open and hold up the
+// scrape.
+func runScript(path, dir string, timeout time.Duration) (*bytes.Buffer, error) {
+	deadline := time.Now().Add(timeout)
+
+	stdoutReader, stdoutWriter, err := os.Pipe()
+	if err != nil {
+		return nil, err
+	}
+	defer stdoutReader.Close()
+
+	cmd := exec.Command(path)
+	cmd.Dir = dir
+	cmd.Stdout = stdoutWriter
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+
+	err = cmd.Start()
+	stdoutWriter.Close()
+	if err != nil {
+		return nil, err
+	}
+
+	// Output from processes that escaped the process group is only read
+	// until the deadline
+	if err := stdoutReader.SetReadDeadline(deadline); err != nil {
+		log.WithError(err).Debug("set metrics script read deadline")
+	}
+
+	var stdout bytes.Buffer
+	read := make(chan error, 1)
+	go func() {
+		_, err := stdout.ReadFrom(stdoutReader)
+		read <- err
+	}()
+
+	waited := make(chan error, 1)
+	go func() {
+		waited <- cmd.Wait()
+	}()
+
+	timer := time.NewTimer(time.Until(deadline))
+	defer timer.Stop()
+
+	select {
+	case err = <-waited:
+	case <-timer.C:
+		syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
+		<-waited
+		err = errScriptTimeout
+	}
+	syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
+
+	if readErr := <-read; err == nil && readErr != nil {
+		err = errors.Wrap(readErr, "read script output")
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &stdout, nil
+}
+
+func stringPtr(s string) *string {
+	return &s
+}
+
+func float64Ptr(f float64) *float64 {
+	return &f
+}
@@ -0,0 +1,127 @@
+package metrics
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	dto "github.com/prometheus/client_model/go"
+	"github.com/stretchr/testify/require"
+)
+
+func TestScriptGatherer(t *testing.T) {
+	dir, err := ioutil.TempDir("", "metrics-scripts")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	for name, script := range map[string]struct {
+		contents string
+		mode     os.FileMode
+	}{
+		"a": {"#!/bin/sh\necho 'temperature{sensor=\"a\"} 40'\n", 0755},
+		"b": {"#!/bin/sh\necho 'temperature{sensor=\"b\"} 45'\necho 'fan_rpm 1200'\n", 0755},
+		"c": {"#!/bin/sh\nexit 1\n", 0755},
+		"d": {"#!/bin/sh\necho 'not_executable 1'\n", 0644},
+	} {
+		require.NoError(t, ioutil.WriteFile(filepath.Join(dir, name), []byte(script.contents), script.mode))
+	}
+
+	g := &scriptGatherer{
+		dir:     dir,
+		timeout: 5 * time.Second,
+	}
+	families, err := g.Gather()
+	require.NoError(t, err)
+
+	values := make(map[string][]float64)
+	for _, family := range families {
+		for _, metric := range family.Metric {
+			values[family.GetName()] = append(values[family.GetName()], metricValue(metric))
+		}
+	}
+
+	require.Equal(t, map[string][]float64{
+		"fan_rpm":             {1200},
+		"node_script_success": {1, 1, 0},
+		"temperature":         {40, 45},
+	}, values)
+}
+
+func TestScriptGathererMissingDirectory(t *testing.T) {
+	g := &scriptGatherer{
+		dir:     "/nonexistent",
+		timeout: time.Second,
+	}
+	families, err := g.Gather()
+	require.NoError(t, err)
+	require.Empty(t, families)
+}
+
+func TestScriptGathererBackgroundProcess(t *testing.T) {
+	dir, err := ioutil.TempDir("", "metrics-scripts")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	// The background sleep inherits stdout, and the hanging script never
+	// exits
+	require.NoError(t, ioutil.WriteFile(filepath.Join(dir, "background"),
+		[]byte("#!/bin/sh\nsleep 30 &\necho 'temperature 40'\n"), 0755))
+	require.NoError(t, ioutil.WriteFile(filepath.Join(dir, "hanging"),
+		[]byte("#!/bin/sh\necho 'fan_rpm 1200'\nsleep 30\n"), 0755))
+
+	g := &scriptGatherer{
+		dir:     dir,
+		timeout: time.Second,
+	}
+
+	start := time.Now()
+	families, err := g.Gather()
+	require.NoError(t, err)
+	require.True(t, time.Since(start) < 5*time.Second)
+
+	values := make(map[string][]float64)
+	for _, family := range families {
+		for _, metric := range family.Metric {
+			values[family.GetName()] = append(values[family.GetName()], metricValue(metric))
+		}
+	}
+
+	require.Equal(t, map[string][]float64{
+		"node_script_success": {1, 0},
+		"temperature":         {40},
+	}, values)
+}
+
+func TestScriptGathererInterval(t *testing.T) {
+	dir, err := ioutil.TempDir("", "metrics-scripts")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	script := filepath.Join(dir, "count")
+	require.NoError(t, ioutil.WriteFile(script,
+		[]byte("#!/bin/sh\necho run >> "+filepath.Join(dir, ".runs")+"\necho 'temperature 40'\n"), 0755))
+
+	g := &scriptGatherer{
+		dir:      dir,
+		timeout:  5 * time.Second,
+		interval: time.Hour,
+	}
+	for i := 0; i < 3; i++ {
+		families, err := g.Gather()
+		require.NoError(t, err)
+		require.Len(t, families, 2)
+	}
+
+	runs, err := ioutil.ReadFile(filepath.Join(dir, ".runs"))
+	require.NoError(t, err)
+	require.Equal(t, "run\n", string(runs))
+}
+
+func metricValue(metric *dto.Metric) float64 {
+	if metric.Gauge != nil {
+		return metric.Gauge.GetValue()
+	}
+	return metric.Untyped.GetValue()
+}
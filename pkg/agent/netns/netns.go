@@ -22,10 +22,12 @@ type request struct {
 	containerID string
 	port        int
 	path        string
+	dialOnly    bool
 }
 
 type response struct {
 	response *http.Response
+	conn     net.Conn
 	err      error
 }
 
@@ -70,6 +72,20 @@ func (m *Manager) ProcessRequest(
 	return resp.response, resp.err
 }
 
+// Dial opens a TCP connection to a port inside a container's network
+// namespace. The connection stays in that namespace after Dial returns, so
+// it can be used from any goroutine.
+func (m *Manager) Dial(ctx context.Context, containerID string, port int) (net.Conn, error) {
+	m.in <- request{
+		ctx:         ctx,
+		containerID: containerID,
+		port:        port,
+		dialOnly:    true,
+	}
+	resp := <-m.out
+	return resp.conn, resp.err
+}
+
 func (m *Manager) processRequest(ctx context.Context, req request) response {
 	inspectResponse, err := m.engine.InspectContainer(ctx, req.containerID)
 	if err != nil {
@@ -102,6 +118,12 @@ func (m *Manager) processRequest(ctx context.Context, req request) response {
 		}
 	}
 
+	if req.dialOnly {
+		return response{
+			conn: conn,
+		}
+	}
+
 	httpRequest, err := http.NewRequestWithContext(
 		ctx, "GET", string(req.path), nil,
 	)
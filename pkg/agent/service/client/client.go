@@ -133,6 +133,31 @@ func ConnectTCP(ctx context.Context, deviceConn net.Conn, port uint) error {
 	return req.Write(deviceConn)
 }
 
+func ConnectServiceTCP(ctx context.Context, deviceConn net.Conn, applicationID, service string, port uint) error {
+	url := url.URL{
+		Path: fmt.Sprintf(
+			"/applications/%s/services/%s/connecttcp",
+			applicationID, service,
+		),
+	}
+
+	query := url.Query()
+	query.Set("port", strconv.Itoa(int(port)))
+	url.RawQuery = query.Encode()
+
+	req, err := http.NewRequestWithContext(
+		ctx,
+		"GET",
+		url.RequestURI(),
+		nil,
+	)
+	if err != nil {
+		return err
+	}
+
+	return req.Write(deviceConn)
+}
+
 func ConnectHTTP(ctx context.Context, deviceConn net.Conn, port uint) error {
 	url := url.URL{
 		Path: "/connecthttp",
@@ -10,6 +10,7 @@ import (
 	"github.com/deviceplane/deviceplane/pkg/agent/server/conncontext"
 	"github.com/deviceplane/deviceplane/pkg/codes"
 	"github.com/deviceplane/deviceplane/pkg/utils"
+	"github.com/gorilla/mux"
 )
 
 func (s *Service) connectTCP(w http.ResponseWriter, r *http.Request) {
@@ -22,11 +23,57 @@ func (s *Service) connectTCP(w http.ResponseWriter, r *http.Request) {
 			return
 		}
 
-		go io.Copy(localConn, conn)
-		io.Copy(conn, localConn)
+		defer localConn.Close()
+
+		proxyConns(conn, localConn)
+	})
+}
+
+func (s *Service) connectServiceTCP(w http.ResponseWriter, r *http.Request) {
+	withPort(w, r, func(port int) {
+		vars := mux.Vars(r)
+		applicationID := vars["application"]
+		service := vars["service"]
+
+		containerID, ok := s.supervisorLookup.GetContainerID(applicationID, service)
+		if !ok {
+			http.Error(w, "could not get container ID", codes.StatusDeviceConnectionFailure)
+			return
+		}
+
+		conn := conncontext.GetConn(r)
+
+		localConn, err := s.netnsManager.Dial(r.Context(), containerID, port)
+		if err != nil {
+			http.Error(w, err.Error(), codes.StatusDeviceConnectionFailure)
+			return
+		}
+
+		defer localConn.Close()
+
+		proxyConns(conn, localConn)
 	})
 }
 
+// proxyConns copies between the connections until either side is done, and
+// then closes both so that the copy in the other direction stops too.
+func proxyConns(conn, localConn net.Conn) {
+	done := make(chan struct{}, 2)
+	go func() {
+		io.Copy(localConn, conn)
+		done <- struct{}{}
+	}()
+	go func() {
+		io.Copy(conn, localConn)
+		done <- struct{}{}
+	}()
+
+	<-done
+	conn.Close()
+	localConn.Close()
+	<-done
+}
+
 func (s *Service) connectHTTP(w http.ResponseWriter, r *http.Request) {
 	withPort(w, r, func(port int) {
 		conn := conncontext.GetConn(r)
@@ -9,6 +9,7 @@ import (
 	"sync"
 
 	"github.com/deviceplane/deviceplane/pkg/agent/metrics"
+	"github.com/deviceplane/deviceplane/pkg/agent/netns"
 	"github.com/deviceplane/deviceplane/pkg/agent/supervisor"
 	"github.com/deviceplane/deviceplane/pkg/agent/variables"
 	"github.com/deviceplane/deviceplane/pkg/engine"
@@ -27,6 +28,7 @@ type Service struct {
 	router           *mux.Router
 
 	serviceMetricsFetcher *metrics.ServiceMetricsFetcher
+	netnsManager          *netns.Manager
 
 	signer     ssh.Signer
 	signerLock sync.Mutex
@@ -35,6 +37,7 @@ type Service struct {
 func NewService(
 	variables variables.Interface, supervisorLookup supervisor.Lookup,
 	engine engine.Engine, confDir string, serviceMetricsFetcher *metrics.ServiceMetricsFetcher,
+	netnsManager *netns.Manager,
 ) *Service {
 	s := &Service{
 		variables: variables,
@@ -43,6 +46,7 @@ func NewService(
 
 		supervisorLookup:      supervisorLookup,
 		serviceMetricsFetcher: serviceMetricsFetcher,
+		netnsManager:          netnsManager,
 	}
 	go s.getSigner()
 
@@ -50,6 +54,7 @@ func NewService(
 	s.router.HandleFunc("/connecttcp", s.connectTCP)
 	s.router.HandleFunc("/connecthttp", s.connectHTTP)
 	s.router.HandleFunc("/reboot", s.reboot)
+	s.router.HandleFunc("/applications/{application}/services/{service}/connecttcp", s.connectServiceTCP)
 	s.router.HandleFunc("/applications/{application}/services/{service}/imagepullprogress", s.imagePullProgress).Methods("GET")
 	s.router.HandleFunc("/applications/{application}/services/{service}/metrics", s.metrics).Methods("GET")
 	s.router.Handle("/metrics/host", metrics.FilteredHostMetricsHandler())
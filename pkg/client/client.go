@@ -11,6 +11,7 @@ import (
 	"net"
 	"net/http"
 	"net/url"
+	"strconv"
 	"strings"
 
 	"github.com/deviceplane/deviceplane/pkg/models"
@@ -27,10 +28,20 @@ const (
 	connectURL      = "connect"
 	executeURL      = "execute"
 	rebootURL       = "reboot"
+	quarantineURL   = "quarantine"
+	accessKeysURL   = "accesskeys"
 	bundleURL       = "bundle"
 	metricsURL      = "metrics"
 	servicesURL     = "services"
 	membershipsURL  = "memberships"
+
+	connectionsURL              = "connections"
+	rolesURL                    = "roles"
+	deviceRegistrationTokensURL = "deviceregistrationtokens"
+	labelsURL                   = "labels"
+	environmentVariablesURL     = "environmentvariables"
+	portsURL                    = "ports"
+	authzURL                    = "authz"
 )
 
 type Client struct {
@@ -66,6 +77,27 @@ func (c *Client) CreateApplication(ctx context.Context, project string, name str
 	return &application, nil
 }
 
+func (c *Client) UpdateApplication(ctx context.Context, project, application string, description *string, schedulingRule *models.SchedulingRule, metricEndpointConfigs *map[string]models.MetricEndpointConfig) (*models.Application, error) {
+	var updateApplicationRequest struct {
+		Description           *string                                 `json:"description,omitempty"`
+		SchedulingRule        *models.SchedulingRule                  `json:"schedulingRule,omitempty"`
+		MetricEndpointConfigs *map[string]models.MetricEndpointConfig `json:"metricEndpointConfigs,omitempty"`
+	}
+	updateApplicationRequest.Description = description
+	updateApplicationRequest.SchedulingRule = schedulingRule
+	updateApplicationRequest.MetricEndpointConfigs = metricEndpointConfigs
+
+	var app models.Application
+	if err := c.patch(ctx, updateApplicationRequest, &app, projectsURL, project, applicationsURL, application); err != nil {
+		return nil, err
+	}
+	return &app, nil
+}
+
+func (c *Client) DeleteApplication(ctx context.Context, project, application string) error {
+	return c.delete(ctx, nil, projectsURL, project, applicationsURL, application)
+}
+
 func (c *Client) ListProjects(ctx context.Context, project string) ([]models.ProjectFull, error) {
 	var memberships []models.MembershipFull1
 	if err := c.get(ctx, &memberships, membershipsURL+"?full"); err != nil {
@@ -87,6 +119,14 @@ func (c *Client) ListApplications(ctx context.Context, project string) ([]models
 	return applications, nil
 }
 
+func (c *Client) ListApplicationsFull(ctx context.Context, project string) ([]models.ApplicationFull1, error) {
+	var applications []models.ApplicationFull1
+	if err := c.get(ctx, &applications, projectsURL, project, applicationsURL+"?full"); err != nil {
+		return nil, err
+	}
+	return applications, nil
+}
+
 func (c *Client) ListDevices(ctx context.Context, filters []models.Filter, project string) ([]models.Device, error) {
 	var devices []models.Device
 
@@ -152,6 +192,19 @@ func (c *Client) GetLatestRelease(ctx context.Context, project, application stri
 	return &release, nil
 }
 
+func (c *Client) DiffReleases(ctx context.Context, project, application, release, base string) (*models.ReleaseDiff, error) {
+	diffURL := "diff"
+	if base != "" {
+		diffURL += "?base=" + url.QueryEscape(base)
+	}
+
+	var diff models.ReleaseDiff
+	if err := c.get(ctx, &diff, projectsURL, project, applicationsURL, application, releasesURL, release, diffURL); err != nil {
+		return nil, err
+	}
+	return &diff, nil
+}
+
 func (c *Client) CreateRelease(ctx context.Context, project, application, yamlConfig string) (*models.Release, error) {
 	var release models.Release
 	if err := c.post(ctx, models.CreateReleaseRequest{
@@ -162,6 +215,154 @@ func (c *Client) CreateRelease(ctx context.Context, project, application, yamlCo
 	return &release, nil
 }
 
+func (c *Client) CreateReleaseDryRun(ctx context.Context, project, application, yamlConfig string) (*models.CreateReleaseDryRunResponse, error) {
+	var dryRun models.CreateReleaseDryRunResponse
+	if err := c.post(ctx, models.CreateReleaseRequest{
+		RawConfig: yamlConfig,
+	}, &dryRun, projectsURL, project, applicationsURL, application, releasesURL+"?dryrun"); err != nil {
+		return nil, err
+	}
+	return &dryRun, nil
+}
+
+func (c *Client) ListConnections(ctx context.Context, project string) ([]models.Connection, error) {
+	var connections []models.Connection
+	if err := c.get(ctx, &connections, projectsURL, project, connectionsURL); err != nil {
+		return nil, err
+	}
+	return connections, nil
+}
+
+func (c *Client) CreateConnection(ctx context.Context, project, name string, protocol models.Protocol, port uint) (*models.Connection, error) {
+	var connection models.Connection
+	if err := c.post(ctx, models.Connection{
+		Name:     name,
+		Protocol: protocol,
+		Port:     port,
+	}, &connection, projectsURL, project, connectionsURL); err != nil {
+		return nil, err
+	}
+	return &connection, nil
+}
+
+func (c *Client) UpdateConnection(ctx context.Context, project, connection, name string, protocol models.Protocol, port uint) (*models.Connection, error) {
+	var conn models.Connection
+	if err := c.put(ctx, models.Connection{
+		Name:     name,
+		Protocol: protocol,
+		Port:     port,
+	}, &conn, projectsURL, project, connectionsURL, connection); err != nil {
+		return nil, err
+	}
+	return &conn, nil
+}
+
+func (c *Client) DeleteConnection(ctx context.Context, project, connection string) error {
+	return c.delete(ctx, nil, projectsURL, project, connectionsURL, connection)
+}
+
+func (c *Client) ListRoles(ctx context.Context, project string) ([]models.Role, error) {
+	var roles []models.Role
+	if err := c.get(ctx, &roles, projectsURL, project, rolesURL); err != nil {
+		return nil, err
+	}
+	return roles, nil
+}
+
+func (c *Client) CreateRole(ctx context.Context, project, name, description, config string) (*models.Role, error) {
+	var role models.Role
+	if err := c.post(ctx, models.Role{
+		Name:        name,
+		Description: description,
+		Config:      config,
+	}, &role, projectsURL, project, rolesURL); err != nil {
+		return nil, err
+	}
+	return &role, nil
+}
+
+func (c *Client) UpdateRole(ctx context.Context, project, role, name, description, config string) (*models.Role, error) {
+	var r models.Role
+	if err := c.put(ctx, models.Role{
+		Name:        name,
+		Description: description,
+		Config:      config,
+	}, &r, projectsURL, project, rolesURL, role); err != nil {
+		return nil, err
+	}
+	return &r, nil
+}
+
+func (c *Client) DeleteRole(ctx context.Context, project, role string) error {
+	return c.delete(ctx, nil, projectsURL, project, rolesURL, role)
+}
+
+func (c *Client) SimulateAuthorization(ctx context.Context, project string, req models.SimulateAuthorizationRequest) (*models.SimulateAuthorizationResponse, error) {
+	var simulation models.SimulateAuthorizationResponse
+	if err := c.post(ctx, req, &simulation, projectsURL, project, authzURL, "simulate"); err != nil {
+		return nil, err
+	}
+	return &simulation, nil
+}
+
+func (c *Client) ListDeviceRegistrationTokens(ctx context.Context, project string) ([]models.DeviceRegistrationToken, error) {
+	var tokens []models.DeviceRegistrationToken
+	if err := c.get(ctx, &tokens, projectsURL, project, deviceRegistrationTokensURL); err != nil {
+		return nil, err
+	}
+	return tokens, nil
+}
+
+func (c *Client) CreateDeviceRegistrationToken(ctx context.Context, project, name, description string, maxRegistrations *int) (*models.DeviceRegistrationToken, error) {
+	var token models.DeviceRegistrationToken
+	if err := c.post(ctx, models.DeviceRegistrationToken{
+		Name:             name,
+		Description:      description,
+		MaxRegistrations: maxRegistrations,
+	}, &token, projectsURL, project, deviceRegistrationTokensURL); err != nil {
+		return nil, err
+	}
+	return &token, nil
+}
+
+func (c *Client) UpdateDeviceRegistrationToken(ctx context.Context, project, token, name, description string, maxRegistrations *int) (*models.DeviceRegistrationToken, error) {
+	var t models.DeviceRegistrationToken
+	if err := c.put(ctx, models.DeviceRegistrationToken{
+		Name:             name,
+		Description:      description,
+		MaxRegistrations: maxRegistrations,
+	}, &t, projectsURL, project, deviceRegistrationTokensURL, token); err != nil {
+		return nil, err
+	}
+	return &t, nil
+}
+
+func (c *Client) DeleteDeviceRegistrationToken(ctx context.Context, project, token string) error {
+	return c.delete(ctx, nil, projectsURL, project, deviceRegistrationTokensURL, token)
+}
+
+func (c *Client) SetDeviceRegistrationTokenLabel(ctx context.Context, project, token, key, value string) error {
+	return c.put(ctx, keyValue{
+		Key:   key,
+		Value: value,
+	}, nil, projectsURL, project, deviceRegistrationTokensURL, token, labelsURL)
+}
+
+func (c *Client) DeleteDeviceRegistrationTokenLabel(ctx context.Context, project, token, key string) error {
+	return c.delete(ctx, nil, projectsURL, project, deviceRegistrationTokensURL, token, labelsURL, key)
+}
+
+func (c *Client) SetDeviceRegistrationTokenEnvironmentVariable(ctx context.Context, project, token, key, value string) error {
+	return c.put(ctx, keyValue{
+		Key:   key,
+		Value: value,
+	}, nil, projectsURL, project, deviceRegistrationTokensURL, token, environmentVariablesURL)
+}
+
+func (c *Client) DeleteDeviceRegistrationTokenEnvironmentVariable(ctx context.Context, project, token, key string) error {
+	return c.delete(ctx, nil, projectsURL, project, deviceRegistrationTokensURL, token, environmentVariablesURL, key)
+}
+
 func (c *Client) SSH(ctx context.Context, project, deviceID string) (net.Conn, error) {
 	req, err := http.NewRequestWithContext(ctx, "", "", nil)
 	if err != nil {
@@ -194,6 +395,48 @@ func (c *Client) Connect(ctx context.Context, project, deviceID, connection stri
 	return wsconnadapter.New(wsConn), nil
 }
 
+// ConnectRaw is like Connect but also forwards HTTP connections as raw TCP.
+func (c *Client) ConnectRaw(ctx context.Context, project, deviceID, connection string) (net.Conn, error) {
+	req, err := http.NewRequestWithContext(ctx, "", "", nil)
+	if err != nil {
+		return nil, err
+	}
+
+	req.SetBasicAuth(c.accessKey, "")
+
+	wsConn, _, err := websocket.DefaultDialer.Dial(getWebsocketURL(c.url, projectsURL, project, devicesURL, deviceID, connectURL, connection)+"?raw", req.Header)
+	if err != nil {
+		return nil, err
+	}
+
+	return wsconnadapter.New(wsConn), nil
+}
+
+// ConnectPort opens an ad-hoc connection to a port on a device. If
+// application and service are set, the port is dialed inside that service's
+// container rather than on the host.
+func (c *Client) ConnectPort(ctx context.Context, project, deviceID, application, service string, port uint) (net.Conn, error) {
+	req, err := http.NewRequestWithContext(ctx, "", "", nil)
+	if err != nil {
+		return nil, err
+	}
+
+	req.SetBasicAuth(c.accessKey, "")
+
+	s := []string{projectsURL, project, devicesURL, deviceID}
+	if application != "" {
+		s = append(s, applicationsURL, application, servicesURL, service)
+	}
+	s = append(s, portsURL, strconv.Itoa(int(port)), connectURL)
+
+	wsConn, _, err := websocket.DefaultDialer.Dial(getWebsocketURL(c.url, s...), req.Header)
+	if err != nil {
+		return nil, err
+	}
+
+	return wsconnadapter.New(wsConn), nil
+}
+
 func (c *Client) Reboot(ctx context.Context, project, device string) error {
 	if err := c.post(ctx, []byte{}, nil, projectsURL, project, devicesURL, device, rebootURL); err != nil {
 		return err
@@ -201,6 +444,22 @@ func (c *Client) Reboot(ctx context.Context, project, device string) error {
 	return nil
 }
 
+func (c *Client) SetDeviceQuarantine(ctx context.Context, project, device string, quarantined bool) (*models.Device, error) {
+	var d models.Device
+	if err := c.put(ctx, struct {
+		Quarantined bool `json:"quarantined"`
+	}{
+		Quarantined: quarantined,
+	}, &d, projectsURL, project, devicesURL, device, quarantineURL); err != nil {
+		return nil, err
+	}
+	return &d, nil
+}
+
+func (c *Client) RevokeDeviceAccessKeys(ctx context.Context, project, device string) error {
+	return c.delete(ctx, nil, projectsURL, project, devicesURL, device, accessKeysURL)
+}
+
 func (c *Client) get(ctx context.Context, out interface{}, s ...string) error {
 	req, err := http.NewRequestWithContext(ctx, "GET", getURL(c.url, s...), nil)
 	if err != nil {
@@ -211,6 +470,27 @@ func (c *Client) get(ctx context.Context, out interface{}, s ...string) error {
 }
 
 func (c *Client) post(ctx context.Context, in, out interface{}, s ...string) error {
+	return c.send(ctx, "POST", in, out, s...)
+}
+
+func (c *Client) put(ctx context.Context, in, out interface{}, s ...string) error {
+	return c.send(ctx, "PUT", in, out, s...)
+}
+
+func (c *Client) patch(ctx context.Context, in, out interface{}, s ...string) error {
+	return c.send(ctx, "PATCH", in, out, s...)
+}
+
+func (c *Client) delete(ctx context.Context, out interface{}, s ...string) error {
+	req, err := http.NewRequestWithContext(ctx, "DELETE", getURL(c.url, s...), nil)
+	if err != nil {
+		return err
+	}
+
+	return c.performRequest(req, out)
+}
+
+func (c *Client) send(ctx context.Context, method string, in, out interface{}, s ...string) error {
 	var reqBytes []byte
 
 	switch v := in.(type) {
@@ -226,7 +506,7 @@ func (c *Client) post(ctx context.Context, in, out interface{}, s ...string) err
 
 	reader := bytes.NewReader(reqBytes)
 
-	req, err := http.NewRequestWithContext(ctx, "POST", getURL(c.url, s...), reader)
+	req, err := http.NewRequestWithContext(ctx, method, getURL(c.url, s...), reader)
 	if err != nil {
 		return err
 	}
@@ -250,6 +530,8 @@ func (c *Client) handleResponse(resp *http.Response, out interface{}) error {
 	switch resp.StatusCode {
 	case http.StatusOK:
 		switch o := out.(type) {
+		case nil:
+			return nil
 		case *string:
 			bytes, err := ioutil.ReadAll(resp.Body)
 			if err != nil {
@@ -267,6 +549,11 @@ func (c *Client) handleResponse(resp *http.Response, out interface{}) error {
 	}
 }
 
+type keyValue struct {
+	Key   string `json:"key"`
+	Value string `json:"value"`
+}
+
 func getURL(u *url.URL, s ...string) string {
 	return strings.Join(append([]string{u.String()}, s...), "/")
 }
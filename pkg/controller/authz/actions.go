@@ -18,32 +18,59 @@ const (
 	ActionListServiceAccounts          = Action("ListServiceAccounts")
 	ActionGetConnection                = Action("GetConnection")
 	ActionListConnections              = Action("ListConnections")
+	ActionGetDeviceGroup               = Action("GetDeviceGroup")
+	ActionListDeviceGroups             = Action("ListDeviceGroups")
+	ActionGetJob                       = Action("GetJob")
+	ActionListJobs                     = Action("ListJobs")
 	ActionGetApplication               = Action("GetApplication")
 	ActionListApplications             = Action("ListApplications")
 	ActionGetLatestRelease             = Action("GetLatestRelease")
 	ActionGetRelease                   = Action("GetRelease")
 	ActionListReleases                 = Action("ListReleases")
+	ActionSimulateAuthorization        = Action("SimulateAuthorization")
+	ActionDiffReleases                 = Action("DiffReleases")
 	ActionPreviewApplicationScheduling = Action("PreviewApplicationScheduling")
 	ActionGetDevice                    = Action("GetDevice")
 	ActionListDevices                  = Action("ListDevices")
 	ActionGetImagePullProgress         = Action("GetImagePullProgress")
 	ActionGetMetrics                   = Action("GetMetrics")
 	ActionGetServiceMetrics            = Action("GetServiceMetrics")
+	ActionQueryMetrics                 = Action("QueryMetrics")
+	ActionFederateMetrics              = Action("FederateMetrics")
 	ActionGetDeviceRegistrationToken   = Action("GetDeviceRegistrationToken")
 	ActionListDeviceRegistrationTokens = Action("ListDeviceRegistrationTokens")
 	ActionGetProjectConfig             = Action("GetProjectConfig")
+	ActionGetSsoGroupMapping           = Action("GetSsoGroupMapping")
+	ActionListSsoGroupMappings         = Action("ListSsoGroupMappings")
+
+	ActionGetOrganization                        = Action("GetOrganization")
+	ActionListOrganizationProjects               = Action("ListOrganizationProjects")
+	ActionGetOrganizationMembership              = Action("GetOrganizationMembership")
+	ActionListOrganizationMemberships            = Action("ListOrganizationMemberships")
+	ActionGetOrganizationRole                    = Action("GetOrganizationRole")
+	ActionListOrganizationRoles                  = Action("ListOrganizationRoles")
+	ActionGetOrganizationMembershipRoleBinding   = Action("GetOrganizationMembershipRoleBinding")
+	ActionListOrganizationMembershipRoleBindings = Action("ListOrganizationMembershipRoleBindings")
 
 	ActionCreateConnection                                 = Action("CreateConnection")
 	ActionUpdateConnection                                 = Action("UpdateConnection")
 	ActionDeleteConnection                                 = Action("DeleteConnection")
+	ActionCreateDeviceGroup                                = Action("CreateDeviceGroup")
+	ActionUpdateDeviceGroup                                = Action("UpdateDeviceGroup")
+	ActionDeleteDeviceGroup                                = Action("DeleteDeviceGroup")
+	ActionCancelJob                                        = Action("CancelJob")
 	ActionCreateApplication                                = Action("CreateApplication")
 	ActionUpdateApplication                                = Action("UpdateApplication")
 	ActionDeleteApplication                                = Action("DeleteApplication")
 	ActionCreateRelease                                    = Action("CreateRelease")
 	ActionUpdateDevice                                     = Action("UpdateDevice")
 	ActionDeleteDevice                                     = Action("DeleteDevice")
+	ActionQuarantineDevice                                 = Action("QuarantineDevice")
+	ActionListDeviceAccessKeys                             = Action("ListDeviceAccessKeys")
+	ActionRevokeDeviceAccessKey                            = Action("RevokeDeviceAccessKey")
 	ActionSSH                                              = Action("SSH")
 	ActionConnect                                          = Action("Connect")
+	ActionConnectPort                                      = Action("ConnectPort")
 	ActionReboot                                           = Action("Reboot")
 	ActionListAllDeviceLabels                              = Action("ListAllDeviceLabels")
 	ActionSetDeviceLabel                                   = Action("SetDeviceLabel")
@@ -79,6 +106,19 @@ const (
 	ActionListServiceAccountRoleBinding   = Action("ListServiceAccountRoleBinding")
 	ActionDeleteServiceAccountRoleBinding = Action("DeleteServiceAccountRoleBinding")
 	ActionSetProjectConfig                = Action("SetProjectConfig")
+	ActionCreateSsoGroupMapping           = Action("CreateSsoGroupMapping")
+	ActionDeleteSsoGroupMapping           = Action("DeleteSsoGroupMapping")
+
+	ActionUpdateOrganization                      = Action("UpdateOrganization")
+	ActionDeleteOrganization                      = Action("DeleteOrganization")
+	ActionCreateOrganizationProject               = Action("CreateOrganizationProject")
+	ActionCreateOrganizationMembership            = Action("CreateOrganizationMembership")
+	ActionDeleteOrganizationMembership            = Action("DeleteOrganizationMembership")
+	ActionCreateOrganizationRole                  = Action("CreateOrganizationRole")
+	ActionUpdateOrganizationRole                  = Action("UpdateOrganizationRole")
+	ActionDeleteOrganizationRole                  = Action("DeleteOrganizationRole")
+	ActionCreateOrganizationMembershipRoleBinding = Action("CreateOrganizationMembershipRoleBinding")
+	ActionDeleteOrganizationMembershipRoleBinding = Action("DeleteOrganizationMembershipRoleBinding")
 )
 
 var (
@@ -94,33 +134,60 @@ var (
 		ActionListServiceAccounts,
 		ActionGetConnection,
 		ActionListConnections,
+		ActionGetDeviceGroup,
+		ActionListDeviceGroups,
+		ActionGetJob,
+		ActionListJobs,
 		ActionGetApplication,
 		ActionListApplications,
 		ActionGetLatestRelease,
 		ActionGetRelease,
 		ActionListReleases,
+		ActionDiffReleases,
 		ActionPreviewApplicationScheduling,
 		ActionGetDevice,
 		ActionListDevices,
 		ActionGetImagePullProgress,
 		ActionGetMetrics,
 		ActionGetServiceMetrics,
+		ActionQueryMetrics,
+		ActionFederateMetrics,
 		ActionGetDeviceRegistrationToken,
 		ActionListDeviceRegistrationTokens,
 		ActionGetProjectConfig,
+		ActionGetSsoGroupMapping,
+		ActionListSsoGroupMappings,
+		ActionGetOrganization,
+		ActionListOrganizationProjects,
+		ActionGetOrganizationMembership,
+		ActionListOrganizationMemberships,
+		ActionGetOrganizationRole,
+		ActionListOrganizationRoles,
+		ActionGetOrganizationMembershipRoleBinding,
+		ActionListOrganizationMembershipRoleBindings,
 	}
 	writeActions = append(readActions, []Action{
 		ActionCreateConnection,
 		ActionUpdateConnection,
 		ActionDeleteConnection,
+		ActionCreateDeviceGroup,
+		ActionUpdateDeviceGroup,
+		ActionDeleteDeviceGroup,
+		ActionCancelJob,
 		ActionCreateApplication,
 		ActionUpdateApplication,
 		ActionDeleteApplication,
 		ActionCreateRelease,
 		ActionUpdateDevice,
 		ActionDeleteDevice,
+		ActionQuarantineDevice,
+		ActionListDeviceAccessKeys,
+		ActionRevokeDeviceAccessKey,
 		ActionSSH,
 		ActionConnect,
+		// ActionConnectPort isn't included since it reaches any port on a
+		// device, not just the project's connections, so it has to be
+		// granted explicitly
 		ActionReboot,
 		ActionSetDeviceLabel,
 		ActionDeleteDeviceLabel,
@@ -144,6 +211,7 @@ var (
 		ActionDeleteMembership,
 		ActionCreateMembershipRoleBinding,
 		ActionDeleteMembershipRoleBinding,
+		ActionSimulateAuthorization,
 		ActionCreateServiceAccount,
 		ActionUpdateServiceAccount,
 		ActionDeleteServiceAccount,
@@ -154,5 +222,31 @@ var (
 		ActionCreateServiceAccountRoleBinding,
 		ActionDeleteServiceAccountRoleBinding,
 		ActionSetProjectConfig,
+		ActionCreateSsoGroupMapping,
+		ActionDeleteSsoGroupMapping,
+		ActionUpdateOrganization,
+		ActionDeleteOrganization,
+		ActionCreateOrganizationProject,
+		ActionCreateOrganizationMembership,
+		ActionDeleteOrganizationMembership,
+		ActionCreateOrganizationRole,
+		ActionUpdateOrganizationRole,
+		ActionDeleteOrganizationRole,
+		ActionCreateOrganizationMembershipRoleBinding,
+		ActionDeleteOrganizationMembershipRoleBinding,
 	}...)
 )
+
+// ValidAction returns true if action is a known action or action group.
+func ValidAction(action Action) bool {
+	switch action {
+	case ActionReadAll, ActionWriteAll, ActionAdminAll:
+		return true
+	}
+	for _, a := range adminActions {
+		if a == action {
+			return true
+		}
+	}
+	return false
+}
@@ -8,6 +8,38 @@ type Rule struct {
 	Resources []Resource `yaml:"resources,omitempty"`
 	Actions   []Action   `yaml:"actions,omitempty"`
 	Effect    Effect     `yaml:"effect,omitempty"`
+
+	// Names restricts the rule to objects with one of these names or IDs
+	Names []string `yaml:"names,omitempty"`
+	// LabelSelector restricts the rule to objects, such as devices, that
+	// have all of these labels
+	LabelSelector map[string]string `yaml:"labelSelector,omitempty"`
+}
+
+// Object is the specific object a request targets. For nested resources,
+// such as releases or device labels, it's the parent object.
+type Object struct {
+	ID     string
+	Name   string
+	Labels map[string]string
+}
+
+// Scoped returns true if the rule only applies to specific objects.
+func (r Rule) Scoped() bool {
+	return len(r.Names) > 0 || len(r.LabelSelector) > 0
+}
+
+// Scoped returns true if any rule in configs only applies to specific
+// objects, in which case the target object is needed for evaluation.
+func Scoped(configs []Config) bool {
+	for _, config := range configs {
+		for _, rule := range config.Rules {
+			if rule.Scoped() {
+				return true
+			}
+		}
+	}
+	return false
 }
 
 var (
@@ -38,27 +70,93 @@ var (
 )
 
 func Evaluate(requestedResource Resource, requestedAction Action, configs []Config) bool {
-	oneAllow := false
-	oneDeny := false
-	for _, config := range configs {
-		for _, rule := range config.Rules {
-			rule = resolveRule(rule)
-			for _, ruleResource := range rule.Resources {
-				if ruleResource == requestedResource || ruleResource == ResourceAny {
-					for _, ruleAction := range rule.Actions {
-						if ruleAction == requestedAction {
-							if rule.Effect == EffectDeny {
-								oneDeny = true
-							} else {
-								oneAllow = true
-							}
-						}
-					}
+	return EvaluateObject(requestedResource, requestedAction, nil, configs)
+}
+
+// EvaluateObject is like Evaluate but also considers scoped rules. A scoped
+// rule never matches a request without an object, so it neither grants nor
+// denies access to project-wide operations such as listing.
+func EvaluateObject(requestedResource Resource, requestedAction Action, object *Object, configs []Config) bool {
+	allows, denies := MatchingRules(requestedResource, requestedAction, object, configs)
+	return len(allows) > 0 && len(denies) == 0
+}
+
+// RuleMatch identifies a rule by its position in the configs passed to
+// MatchingRules.
+type RuleMatch struct {
+	ConfigIndex int
+	RuleIndex   int
+	Rule        Rule
+}
+
+// MatchingRules returns the allow and deny rules that apply to a request.
+// The request is allowed if there is at least one allow and no deny.
+func MatchingRules(requestedResource Resource, requestedAction Action, object *Object, configs []Config) (allows, denies []RuleMatch) {
+	for i, config := range configs {
+		for j, rule := range config.Rules {
+			if !rule.matchesObject(object) {
+				continue
+			}
+			if !resolveRule(rule).matches(requestedResource, requestedAction) {
+				continue
+			}
+
+			match := RuleMatch{
+				ConfigIndex: i,
+				RuleIndex:   j,
+				Rule:        rule,
+			}
+			if rule.Effect == EffectDeny {
+				denies = append(denies, match)
+			} else {
+				allows = append(allows, match)
+			}
+		}
+	}
+	return allows, denies
+}
+
+func (r Rule) matches(requestedResource Resource, requestedAction Action) bool {
+	for _, ruleResource := range r.Resources {
+		if ruleResource == requestedResource || ruleResource == ResourceAny {
+			for _, ruleAction := range r.Actions {
+				if ruleAction == requestedAction {
+					return true
 				}
 			}
 		}
 	}
-	return oneAllow && !oneDeny
+	return false
+}
+
+func (r Rule) matchesObject(object *Object) bool {
+	if !r.Scoped() {
+		return true
+	}
+	if object == nil {
+		return false
+	}
+
+	if len(r.Names) > 0 {
+		found := false
+		for _, name := range r.Names {
+			if name == object.Name || name == object.ID {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+
+	for key, value := range r.LabelSelector {
+		if objectValue, ok := object.Labels[key]; !ok || objectValue != value {
+			return false
+		}
+	}
+
+	return true
 }
 
 func resolveRule(rule Rule) Rule {
@@ -43,6 +43,11 @@ func TestEvaluate(t *testing.T) {
 				ActionCreateMembership,
 				[]Config{AdminAllRole},
 			},
+			{
+				ResourceRoles,
+				ActionSimulateAuthorization,
+				[]Config{AdminAllRole},
+			},
 		} {
 			require.True(t, Evaluate(scenario.resource, scenario.action, scenario.configs))
 		}
@@ -67,6 +72,26 @@ func TestEvaluate(t *testing.T) {
 				ActionCreateMembership,
 				[]Config{WriteAllRole},
 			},
+			{
+				ResourceRoles,
+				ActionSimulateAuthorization,
+				[]Config{ReadAllRole},
+			},
+			{
+				ResourceRoles,
+				ActionSimulateAuthorization,
+				[]Config{WriteAllRole},
+			},
+			{
+				ResourceDevices,
+				ActionConnectPort,
+				[]Config{WriteAllRole},
+			},
+			{
+				ResourceDevices,
+				ActionConnectPort,
+				[]Config{AdminAllRole},
+			},
 		} {
 			require.False(t, Evaluate(scenario.resource, scenario.action, scenario.configs))
 		}
@@ -248,3 +273,141 @@ func TestEvaluate(t *testing.T) {
 		}
 	})
 }
+
+func TestEvaluateObject(t *testing.T) {
+	stagingDevice := &Object{
+		ID:     "dev_1",
+		Name:   "kiosk-1",
+		Labels: map[string]string{"env": "staging", "site": "hq"},
+	}
+	productionDevice := &Object{
+		ID:     "dev_2",
+		Name:   "kiosk-2",
+		Labels: map[string]string{"env": "production", "site": "hq"},
+	}
+	kioskApplication := &Object{ID: "app_1", Name: "kiosk"}
+	otherApplication := &Object{ID: "app_2", Name: "other"}
+
+	sshOnStaging := Config{
+		Rules: []Rule{
+			{
+				Resources:     []Resource{ResourceDevices},
+				Actions:       []Action{ActionSSH},
+				LabelSelector: map[string]string{"env": "staging"},
+			},
+		},
+	}
+	kioskReleases := Config{
+		Rules: []Rule{
+			{
+				Resources: []Resource{ResourceReleases},
+				Actions:   []Action{ActionCreateRelease},
+				Names:     []string{"kiosk"},
+			},
+		},
+	}
+	writeExceptProduction := Config{
+		Rules: []Rule{
+			{
+				Resources: []Resource{ResourceAny},
+				Actions:   []Action{ActionWriteAll},
+			},
+			{
+				Resources:     []Resource{ResourceDevices},
+				Actions:       []Action{ActionSSH},
+				LabelSelector: map[string]string{"env": "production"},
+				Effect:        EffectDeny,
+			},
+		},
+	}
+
+	for _, scenario := range []struct {
+		resource Resource
+		action   Action
+		object   *Object
+		configs  []Config
+	}{
+		{ResourceDevices, ActionSSH, stagingDevice, []Config{sshOnStaging}},
+		{ResourceReleases, ActionCreateRelease, kioskApplication, []Config{kioskReleases}},
+		{ResourceReleases, ActionCreateRelease, &Object{ID: "app_1"}, []Config{
+			{Rules: []Rule{{Resources: []Resource{ResourceReleases}, Actions: []Action{ActionCreateRelease}, Names: []string{"app_1"}}}},
+		}},
+		{ResourceDevices, ActionSSH, stagingDevice, []Config{writeExceptProduction}},
+		{ResourceDevices, ActionListDevices, nil, []Config{writeExceptProduction}},
+		{ResourceDevices, ActionReboot, productionDevice, []Config{writeExceptProduction}},
+		{ResourceDevices, ActionSSH, stagingDevice, []Config{
+			{Rules: []Rule{{Resources: []Resource{ResourceDevices}, Actions: []Action{ActionWriteAll}, Names: []string{"kiosk-1"}, LabelSelector: map[string]string{"site": "hq"}}}},
+		}},
+	} {
+		require.True(t, EvaluateObject(scenario.resource, scenario.action, scenario.object, scenario.configs))
+	}
+
+	for _, scenario := range []struct {
+		resource Resource
+		action   Action
+		object   *Object
+		configs  []Config
+	}{
+		{ResourceDevices, ActionSSH, productionDevice, []Config{sshOnStaging}},
+		{ResourceDevices, ActionSSH, nil, []Config{sshOnStaging}},
+		{ResourceDevices, ActionSSH, &Object{ID: "dev_3", Name: "unlabeled"}, []Config{sshOnStaging}},
+		{ResourceDevices, ActionReboot, stagingDevice, []Config{sshOnStaging}},
+		{ResourceReleases, ActionCreateRelease, otherApplication, []Config{kioskReleases}},
+		{ResourceApplications, ActionDeleteApplication, kioskApplication, []Config{kioskReleases}},
+		{ResourceDevices, ActionSSH, productionDevice, []Config{writeExceptProduction}},
+		{ResourceDevices, ActionSSH, productionDevice, []Config{
+			{Rules: []Rule{{Resources: []Resource{ResourceDevices}, Actions: []Action{ActionWriteAll}, Names: []string{"kiosk-2"}, LabelSelector: map[string]string{"env": "staging"}}}},
+		}},
+	} {
+		require.False(t, EvaluateObject(scenario.resource, scenario.action, scenario.object, scenario.configs))
+	}
+
+	require.True(t, Scoped([]Config{ReadAllRole, sshOnStaging}))
+	require.False(t, Scoped([]Config{ReadAllRole, WriteAllRole}))
+}
+
+func TestMatchingRules(t *testing.T) {
+	configs := []Config{
+		ReadAllRole,
+		{
+			Rules: []Rule{
+				{
+					Resources: []Resource{ResourceReleases},
+					Actions:   []Action{ActionCreateRelease},
+				},
+				{
+					Resources: []Resource{ResourceApplications},
+					Actions:   []Action{ActionReadAll},
+					Effect:    EffectDeny,
+				},
+				{
+					Resources: []Resource{ResourceAny},
+					Actions:   []Action{ActionGetApplication},
+					Names:     []string{"kiosk"},
+					Effect:    EffectDeny,
+				},
+			},
+		},
+	}
+
+	allows, denies := MatchingRules(ResourceApplications, ActionGetApplication, &Object{ID: "app_1", Name: "kiosk"}, configs)
+	require.Equal(t, []RuleMatch{
+		{ConfigIndex: 0, RuleIndex: 0, Rule: ReadAllRole.Rules[0]},
+	}, allows)
+	require.Equal(t, []RuleMatch{
+		{ConfigIndex: 1, RuleIndex: 1, Rule: configs[1].Rules[1]},
+		{ConfigIndex: 1, RuleIndex: 2, Rule: configs[1].Rules[2]},
+	}, denies)
+
+	allows, denies = MatchingRules(ResourceReleases, ActionCreateRelease, nil, configs)
+	require.Equal(t, []RuleMatch{
+		{ConfigIndex: 1, RuleIndex: 0, Rule: configs[1].Rules[0]},
+	}, allows)
+	require.Empty(t, denies)
+
+	require.True(t, ValidAction(ActionSSH))
+	require.True(t, ValidAction(ActionReadAll))
+	require.False(t, ValidAction(Action("ssh")))
+	require.True(t, ValidResource(ResourceDevices))
+	require.False(t, ValidResource(ResourceAny))
+}
@@ -13,13 +13,61 @@ const (
 	ResourceServiceAccountAccessKeys                    = Resource("serviceaccountaccesskeys")
 	ResourceServiceAccountRoleBindings                  = Resource("serviceaccountrolebindings")
 	ResourceConnections                                 = Resource("connection")
+	ResourceDeviceGroups                                = Resource("devicegroups")
+	ResourceJobs                                        = Resource("jobs")
 	ResourceApplications                                = Resource("applications")
 	ResourceReleases                                    = Resource("releases")
 	ResourceDevices                                     = Resource("devices")
 	ResourceDeviceLabels                                = Resource("devicelabels")
 	ResourceDeviceEnvironmentVariables                  = Resource("deviceenvironmentvariables")
+	ResourceDeviceAccessKeys                            = Resource("deviceaccesskeys")
 	ResourceDeviceRegistrationTokens                    = Resource("deviceregistrationtokens")
 	ResourceDeviceRegistrationTokenLabels               = Resource("deviceregistrationtokenlabels")
 	ResourceDeviceRegistrationTokenEnvironmentVariables = Resource("deviceregistrationtokenenvironmentvariables")
 	ResourceProjectConfigs                              = Resource("projectconfigs")
+	ResourceSsoGroupMappings                            = Resource("ssogroupmappings")
+
+	ResourceOrganizations                      = Resource("organizations")
+	ResourceOrganizationMemberships            = Resource("organizationmemberships")
+	ResourceOrganizationRoles                  = Resource("organizationroles")
+	ResourceOrganizationMembershipRoleBindings = Resource("organizationmembershiprolebindings")
 )
+
+var resources = []Resource{
+	ResourceProjects,
+	ResourceRoles,
+	ResourceMemberships,
+	ResourceMembershipRoleBindings,
+	ResourceServiceAccounts,
+	ResourceServiceAccountAccessKeys,
+	ResourceServiceAccountRoleBindings,
+	ResourceConnections,
+	ResourceDeviceGroups,
+	ResourceJobs,
+	ResourceApplications,
+	ResourceReleases,
+	ResourceDevices,
+	ResourceDeviceLabels,
+	ResourceDeviceEnvironmentVariables,
+	ResourceDeviceAccessKeys,
+	ResourceDeviceRegistrationTokens,
+	ResourceDeviceRegistrationTokenLabels,
+	ResourceDeviceRegistrationTokenEnvironmentVariables,
+	ResourceProjectConfigs,
+	ResourceSsoGroupMappings,
+	ResourceOrganizations,
+	ResourceOrganizationMemberships,
+	ResourceOrganizationRoles,
+	ResourceOrganizationMembershipRoleBindings,
+}
+
+// ValidResource returns true if resource is a known resource. The wildcard
+// resource isn't valid since requests always target a specific resource.
+func ValidResource(resource Resource) bool {
+	for _, r := range resources {
+		if r == resource {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,192 @@
+package deviceca
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/hex"
+	"encoding/pem"
+	"math/big"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	caValidity          = 20 * 365 * 24 * time.Hour
+	certificateValidity = 5 * 365 * 24 * time.Hour
+
+	// Allow for devices whose clocks are slightly behind the controller's
+	clockSkew = time.Hour
+)
+
+var (
+	ErrInvalidPEM         = errors.New("invalid PEM")
+	ErrInvalidCertificate = errors.New("certificate wasn't issued for this project")
+)
+
+// CertificateAuthority issues client certificates to the devices of a
+// single project. A device's certificate has the device ID as its common
+// name and the project ID as its organization.
+type CertificateAuthority struct {
+	certificate *x509.Certificate
+	key         crypto.Signer
+}
+
+// New generates a new certificate authority for the project and returns its
+// PEM encoded certificate and private key.
+func New(projectID string) (certificatePEM, keyPEM []byte, err error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	serialNumber, err := newSerialNumber()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	now := time.Now()
+	template := &x509.Certificate{
+		SerialNumber: serialNumber,
+		Subject: pkix.Name{
+			CommonName:   "Deviceplane device CA",
+			Organization: []string{projectID},
+		},
+		NotBefore:             now.Add(-clockSkew),
+		NotAfter:              now.Add(caValidity),
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageCRLSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+		MaxPathLenZero:        true,
+	}
+
+	certificateDER, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: certificateDER}),
+		pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}),
+		nil
+}
+
+// Parse loads a certificate authority created by New.
+func Parse(certificatePEM, keyPEM []byte) (*CertificateAuthority, error) {
+	certificate, err := ParseCertificate(certificatePEM)
+	if err != nil {
+		return nil, err
+	}
+
+	keyBlock, _ := pem.Decode(keyPEM)
+	if keyBlock == nil {
+		return nil, ErrInvalidPEM
+	}
+	key, err := x509.ParseECPrivateKey(keyBlock.Bytes)
+	if err != nil {
+		return nil, err
+	}
+
+	return &CertificateAuthority{
+		certificate: certificate,
+		key:         key,
+	}, nil
+}
+
+// ParseCSR decodes a PEM encoded certificate signing request and checks
+// that it was signed by the key it's for.
+func ParseCSR(csrPEM []byte) (*x509.CertificateRequest, error) {
+	csrBlock, _ := pem.Decode(csrPEM)
+	if csrBlock == nil || csrBlock.Type != "CERTIFICATE REQUEST" {
+		return nil, ErrInvalidPEM
+	}
+	csr, err := x509.ParseCertificateRequest(csrBlock.Bytes)
+	if err != nil {
+		return nil, err
+	}
+	if err := csr.CheckSignature(); err != nil {
+		return nil, errors.Wrap(err, "check CSR signature")
+	}
+	return csr, nil
+}
+
+// SignDeviceCSR issues a client certificate for the device. Only the public
+// key is taken from the request.
+func (ca *CertificateAuthority) SignDeviceCSR(csr *x509.CertificateRequest, projectID, deviceID string) ([]byte, error) {
+	serialNumber, err := newSerialNumber()
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	template := &x509.Certificate{
+		SerialNumber: serialNumber,
+		Subject: pkix.Name{
+			CommonName:   deviceID,
+			Organization: []string{projectID},
+		},
+		NotBefore:   now.Add(-clockSkew),
+		NotAfter:    now.Add(certificateValidity),
+		KeyUsage:    x509.KeyUsageDigitalSignature,
+		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+
+	certificateDER, err := x509.CreateCertificate(rand.Reader, template, ca.certificate, csr.PublicKey, ca.key)
+	if err != nil {
+		return nil, err
+	}
+
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: certificateDER}), nil
+}
+
+// VerifyDeviceCertificate checks that the certificate was issued by this
+// certificate authority for a device in the project and returns the
+// device's ID.
+func (ca *CertificateAuthority) VerifyDeviceCertificate(certificate *x509.Certificate, projectID string) (string, error) {
+	roots := x509.NewCertPool()
+	roots.AddCert(ca.certificate)
+
+	if _, err := certificate.Verify(x509.VerifyOptions{
+		Roots:     roots,
+		KeyUsages: []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}); err != nil {
+		return "", err
+	}
+
+	if len(certificate.Subject.Organization) != 1 || certificate.Subject.Organization[0] != projectID ||
+		certificate.Subject.CommonName == "" {
+		return "", ErrInvalidCertificate
+	}
+
+	return certificate.Subject.CommonName, nil
+}
+
+// ParseCertificate decodes a single PEM encoded certificate.
+func ParseCertificate(certificatePEM []byte) (*x509.Certificate, error) {
+	block, _ := pem.Decode(certificatePEM)
+	if block == nil || block.Type != "CERTIFICATE" {
+		return nil, ErrInvalidPEM
+	}
+	return x509.ParseCertificate(block.Bytes)
+}
+
+// Fingerprint returns the hex encoded SHA-256 hash of the certificate. It's
+// stored in place of an access key hash so that certificates can be listed
+// and revoked like access keys.
+func Fingerprint(certificate *x509.Certificate) string {
+	sum := sha256.Sum256(certificate.Raw)
+	return hex.EncodeToString(sum[:])
+}
+
+func newSerialNumber() (*big.Int, error) {
+	return rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+}
@@ -0,0 +1,71 @@
+package deviceca
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/pem"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func newCSR(t *testing.T) *x509.CertificateRequest {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	csrDER, err := x509.CreateCertificateRequest(rand.Reader, &x509.CertificateRequest{}, key)
+	require.NoError(t, err)
+
+	csr, err := ParseCSR(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE REQUEST", Bytes: csrDER}))
+	require.NoError(t, err)
+	return csr
+}
+
+func newCertificateAuthority(t *testing.T, projectID string) *CertificateAuthority {
+	certificatePEM, keyPEM, err := New(projectID)
+	require.NoError(t, err)
+
+	ca, err := Parse(certificatePEM, keyPEM)
+	require.NoError(t, err)
+	return ca
+}
+
+func TestSignAndVerify(t *testing.T) {
+	ca := newCertificateAuthority(t, "prj_1")
+
+	certificatePEM, err := ca.SignDeviceCSR(newCSR(t), "prj_1", "dev_1")
+	require.NoError(t, err)
+
+	certificate, err := ParseCertificate(certificatePEM)
+	require.NoError(t, err)
+
+	deviceID, err := ca.VerifyDeviceCertificate(certificate, "prj_1")
+	require.NoError(t, err)
+	require.Equal(t, "dev_1", deviceID)
+
+	_, err = ca.VerifyDeviceCertificate(certificate, "prj_2")
+	require.Equal(t, ErrInvalidCertificate, err)
+
+	require.Len(t, Fingerprint(certificate), 64)
+}
+
+func TestVerifyOtherCertificateAuthority(t *testing.T) {
+	ca := newCertificateAuthority(t, "prj_1")
+	otherCA := newCertificateAuthority(t, "prj_1")
+
+	certificatePEM, err := otherCA.SignDeviceCSR(newCSR(t), "prj_1", "dev_1")
+	require.NoError(t, err)
+
+	certificate, err := ParseCertificate(certificatePEM)
+	require.NoError(t, err)
+
+	_, err = ca.VerifyDeviceCertificate(certificate, "prj_1")
+	require.Error(t, err)
+}
+
+func TestParseInvalidCSR(t *testing.T) {
+	_, err := ParseCSR([]byte("not a CSR"))
+	require.Equal(t, ErrInvalidPEM, err)
+}
@@ -0,0 +1,254 @@
+package jobs
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/apex/log"
+	"github.com/deviceplane/deviceplane/pkg/controller/store"
+	"github.com/deviceplane/deviceplane/pkg/models"
+	"github.com/pkg/errors"
+)
+
+const (
+	// Retention is how long finished jobs are kept around for their results
+	Retention = 7 * 24 * time.Hour
+
+	// A runner that stops without finishing its jobs loses them once their
+	// lease expires, at which point they're claimed again
+	leaseDuration = time.Minute
+
+	pollInterval    = 2 * time.Second
+	renewInterval   = 5 * time.Second
+	cleanupInterval = time.Hour
+	itemBatchSize   = 100
+	itemConcurrency = 20
+)
+
+var ErrUnknownJobType = errors.New("unknown job type")
+
+// ItemFunc applies a job to one of its items. Items are applied at least
+// once, so an item can be applied again if the controller stops before its
+// result is recorded.
+type ItemFunc func(ctx context.Context, job models.Job, item models.JobItem) error
+
+const (
+	stopReasonNone int32 = iota
+	stopReasonCancelled
+	stopReasonClaimLost
+)
+
+// Runner claims jobs from the store and works on up to a fixed number of
+// them at once. Jobs are persisted along with the result of each item, so
+// any runner can pick up where another left off.
+type Runner struct {
+	jobs     store.Jobs
+	handlers map[models.JobType]ItemFunc
+	slots    chan struct{}
+	wake     chan struct{}
+
+	pollInterval  time.Duration
+	renewInterval time.Duration
+}
+
+func NewRunner(jobs store.Jobs, workers int) *Runner {
+	if workers < 1 {
+		workers = 1
+	}
+	return &Runner{
+		jobs:          jobs,
+		handlers:      make(map[models.JobType]ItemFunc),
+		slots:         make(chan struct{}, workers),
+		wake:          make(chan struct{}, 1),
+		pollInterval:  pollInterval,
+		renewInterval: renewInterval,
+	}
+}
+
+// Register sets the function that's applied to each item of jobs of the
+// given type. It must be called before Run.
+func (r *Runner) Register(jobType models.JobType, f ItemFunc) {
+	r.handlers[jobType] = f
+}
+
+// Notify starts newly created jobs without waiting for the next poll.
+func (r *Runner) Notify() {
+	select {
+	case r.wake <- struct{}{}:
+	default:
+	}
+}
+
+func (r *Runner) Run(ctx context.Context) {
+	ticker := time.NewTicker(r.pollInterval)
+	defer ticker.Stop()
+
+	var wg sync.WaitGroup
+	defer wg.Wait()
+
+	var lastCleanup time.Time
+	for {
+		r.claimJobs(ctx, &wg)
+
+		if time.Since(lastCleanup) >= cleanupInterval {
+			if err := r.jobs.DeleteJobsFinishedBefore(ctx, time.Now().Add(-Retention)); err != nil {
+				log.WithError(err).Error("delete finished jobs")
+			}
+			lastCleanup = time.Now()
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		case <-r.wake:
+		}
+	}
+}
+
+func (r *Runner) claimJobs(ctx context.Context, wg *sync.WaitGroup) {
+	for {
+		select {
+		case r.slots <- struct{}{}:
+		default:
+			return
+		}
+
+		job, err := r.jobs.ClaimJob(ctx, leaseDuration)
+		if err != nil {
+			<-r.slots
+			if err != store.ErrJobNotFound && ctx.Err() == nil {
+				log.WithError(err).Error("claim job")
+			}
+			return
+		}
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer func() { <-r.slots }()
+			r.runJob(ctx, *job)
+		}()
+	}
+}
+
+func (r *Runner) runJob(ctx context.Context, job models.Job) {
+	if job.CancelRequested {
+		r.finishJob(ctx, job, models.JobStatusCancelled, "")
+		return
+	}
+
+	f, ok := r.handlers[job.Type]
+	if !ok {
+		r.finishJob(ctx, job, models.JobStatusFailed, ErrUnknownJobType.Error())
+		return
+	}
+
+	jobCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var stopReason int32
+	go r.keepLease(jobCtx, job, cancel, &stopReason)
+
+	for jobCtx.Err() == nil {
+		items, err := r.jobs.ListPendingJobItems(jobCtx, job.ID, job.ProjectID, itemBatchSize)
+		if err != nil {
+			if jobCtx.Err() == nil {
+				// The job is left to be claimed again once its lease
+				// expires
+				log.WithField("job", job.ID).WithError(err).Error("list pending job items")
+				return
+			}
+			break
+		}
+		if len(items) == 0 {
+			r.finishJob(ctx, job, models.JobStatusCompleted, "")
+			return
+		}
+
+		r.runItems(ctx, jobCtx, job, f, items)
+	}
+
+	if atomic.LoadInt32(&stopReason) == stopReasonCancelled {
+		r.finishJob(ctx, job, models.JobStatusCancelled, "")
+	}
+}
+
+// keepLease renews the lease on a job while it runs and stops the job if it's
+// cancelled or claimed by another runner.
+func (r *Runner) keepLease(ctx context.Context, job models.Job, cancel func(), stopReason *int32) {
+	ticker := time.NewTicker(r.renewInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		renewedJob, err := r.jobs.RenewJobLease(ctx, job.ID, job.ClaimID, leaseDuration)
+		if err == store.ErrJobNotFound {
+			atomic.StoreInt32(stopReason, stopReasonClaimLost)
+			cancel()
+			return
+		} else if err != nil {
+			if ctx.Err() == nil {
+				log.WithField("job", job.ID).WithError(err).Error("renew job lease")
+			}
+			continue
+		}
+
+		if renewedJob.CancelRequested {
+			atomic.StoreInt32(stopReason, stopReasonCancelled)
+			cancel()
+			return
+		}
+	}
+}
+
+func (r *Runner) runItems(ctx, jobCtx context.Context, job models.Job, f ItemFunc, items []models.JobItem) {
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, itemConcurrency)
+
+	for _, item := range items {
+		select {
+		case sem <- struct{}{}:
+		case <-jobCtx.Done():
+		}
+		if jobCtx.Err() != nil {
+			break
+		}
+
+		wg.Add(1)
+		go func(item models.JobItem) {
+			defer wg.Done()
+			defer func() { <-sem }()
+
+			err := f(jobCtx, job, item)
+
+			// Items that were interrupted are left pending
+			if err != nil && jobCtx.Err() != nil {
+				return
+			}
+
+			status, errorMessage := models.JobItemStatusSucceeded, ""
+			if err != nil {
+				status, errorMessage = models.JobItemStatusFailed, err.Error()
+			}
+			if err := r.jobs.SetJobItemResult(ctx, job.ID, item.ItemID, status, errorMessage); err != nil {
+				log.WithField("job", job.ID).WithError(err).Error("set job item result")
+			}
+		}(item)
+	}
+
+	wg.Wait()
+}
+
+func (r *Runner) finishJob(ctx context.Context, job models.Job, status models.JobStatus, errorMessage string) {
+	if err := r.jobs.FinishJob(ctx, job.ID, job.ClaimID, status, errorMessage); err != nil {
+		log.WithField("job", job.ID).WithError(err).Error("finish job")
+	}
+}
@@ -0,0 +1,247 @@
+package jobs
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/deviceplane/deviceplane/pkg/controller/store"
+	"github.com/deviceplane/deviceplane/pkg/models"
+	"github.com/stretchr/testify/require"
+)
+
+type fakeJobs struct {
+	store.Jobs
+
+	lock  sync.Mutex
+	jobs  []*models.Job
+	items map[string][]*models.JobItem
+}
+
+func newFakeJobs() *fakeJobs {
+	return &fakeJobs{
+		items: make(map[string][]*models.JobItem),
+	}
+}
+
+func (f *fakeJobs) add(job models.Job, itemIDs ...string) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	job.Status = models.JobStatusPending
+	job.ItemCount = len(itemIDs)
+	f.jobs = append(f.jobs, &job)
+	for _, itemID := range itemIDs {
+		f.items[job.ID] = append(f.items[job.ID], &models.JobItem{
+			JobID:  job.ID,
+			ItemID: itemID,
+			Status: models.JobItemStatusPending,
+		})
+	}
+}
+
+func (f *fakeJobs) get(id string) models.Job {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	for _, job := range f.jobs {
+		if job.ID == id {
+			return *job
+		}
+	}
+	return models.Job{}
+}
+
+func (f *fakeJobs) cancel(id string) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	for _, job := range f.jobs {
+		if job.ID == id {
+			job.CancelRequested = true
+		}
+	}
+}
+
+func (f *fakeJobs) itemStatuses(id string) map[string]models.JobItemStatus {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	statuses := make(map[string]models.JobItemStatus)
+	for _, item := range f.items[id] {
+		statuses[item.ItemID] = item.Status
+	}
+	return statuses
+}
+
+func (f *fakeJobs) ClaimJob(ctx context.Context, lease time.Duration) (*models.Job, error) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	for _, job := range f.jobs {
+		if job.Status == models.JobStatusPending {
+			job.Status = models.JobStatusRunning
+			job.ClaimID = "jcl_" + job.ID
+			claimed := *job
+			return &claimed, nil
+		}
+	}
+	return nil, store.ErrJobNotFound
+}
+
+func (f *fakeJobs) RenewJobLease(ctx context.Context, id, claimID string, lease time.Duration) (*models.Job, error) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	for _, job := range f.jobs {
+		if job.ID == id && job.ClaimID == claimID && job.Status == models.JobStatusRunning {
+			renewed := *job
+			return &renewed, nil
+		}
+	}
+	return nil, store.ErrJobNotFound
+}
+
+func (f *fakeJobs) ListPendingJobItems(ctx context.Context, id, projectID string, limit int) ([]models.JobItem, error) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	var items []models.JobItem
+	for _, item := range f.items[id] {
+		if item.Status == models.JobItemStatusPending && len(items) < limit {
+			items = append(items, *item)
+		}
+	}
+	return items, nil
+}
+
+func (f *fakeJobs) SetJobItemResult(ctx context.Context, id, itemID string, status models.JobItemStatus, errorMessage string) error {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	for _, item := range f.items[id] {
+		if item.ItemID == itemID && item.Status == models.JobItemStatusPending {
+			item.Status = status
+			item.Error = errorMessage
+		}
+	}
+	return nil
+}
+
+func (f *fakeJobs) FinishJob(ctx context.Context, id, claimID string, status models.JobStatus, errorMessage string) error {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	for _, job := range f.jobs {
+		if job.ID == id && job.ClaimID == claimID && job.Status == models.JobStatusRunning {
+			job.Status = status
+			job.Error = errorMessage
+		}
+	}
+	return nil
+}
+
+func (f *fakeJobs) DeleteJobsFinishedBefore(ctx context.Context, before time.Time) error {
+	return nil
+}
+
+func newTestRunner(jobs store.Jobs) *Runner {
+	r := NewRunner(jobs, 2)
+	r.pollInterval = 10 * time.Millisecond
+	r.renewInterval = 10 * time.Millisecond
+	return r
+}
+
+func waitForStatus(t *testing.T, jobs *fakeJobs, id string, status models.JobStatus) {
+	require.Eventually(t, func() bool {
+		return jobs.get(id).Status == status
+	}, 5*time.Second, 10*time.Millisecond)
+}
+
+func TestRunnerCompletesJobs(t *testing.T) {
+	jobs := newFakeJobs()
+	jobs.add(models.Job{ID: "job_1", Type: "test"}, "a", "b", "c")
+	jobs.add(models.Job{ID: "job_2", Type: "unknown"}, "a")
+
+	r := newTestRunner(jobs)
+	r.Register("test", func(ctx context.Context, job models.Job, item models.JobItem) error {
+		if item.ItemID == "b" {
+			return errors.New("b failed")
+		}
+		return nil
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go r.Run(ctx)
+
+	waitForStatus(t, jobs, "job_1", models.JobStatusCompleted)
+	require.Equal(t, map[string]models.JobItemStatus{
+		"a": models.JobItemStatusSucceeded,
+		"b": models.JobItemStatusFailed,
+		"c": models.JobItemStatusSucceeded,
+	}, jobs.itemStatuses("job_1"))
+
+	waitForStatus(t, jobs, "job_2", models.JobStatusFailed)
+	require.Equal(t, ErrUnknownJobType.Error(), jobs.get("job_2").Error)
+}
+
+func TestRunnerCancelsJobs(t *testing.T) {
+	jobs := newFakeJobs()
+	jobs.add(models.Job{ID: "job_1", Type: "test"}, "a", "b")
+
+	r := newTestRunner(jobs)
+	r.Register("test", func(ctx context.Context, job models.Job, item models.JobItem) error {
+		if item.ItemID == "a" {
+			return nil
+		}
+		<-ctx.Done()
+		return ctx.Err()
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go r.Run(ctx)
+
+	require.Eventually(t, func() bool {
+		return jobs.itemStatuses("job_1")["a"] == models.JobItemStatusSucceeded
+	}, 5*time.Second, 10*time.Millisecond)
+	jobs.cancel("job_1")
+
+	waitForStatus(t, jobs, "job_1", models.JobStatusCancelled)
+	require.Equal(t, map[string]models.JobItemStatus{
+		"a": models.JobItemStatusSucceeded,
+		"b": models.JobItemStatusPending,
+	}, jobs.itemStatuses("job_1"))
+}
+
+func TestRunnerLeavesJobsWhenStopped(t *testing.T) {
+	jobs := newFakeJobs()
+	jobs.add(models.Job{ID: "job_1", Type: "test"}, "a")
+
+	started := make(chan struct{})
+	r := newTestRunner(jobs)
+	r.Register("test", func(ctx context.Context, job models.Job, item models.JobItem) error {
+		close(started)
+		<-ctx.Done()
+		return ctx.Err()
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		r.Run(ctx)
+		close(done)
+	}()
+
+	<-started
+	cancel()
+	<-done
+
+	// The job stays claimed until its lease expires so that it's resumed
+	// after a restart
+	require.Equal(t, models.JobStatusRunning, jobs.get("job_1").Status)
+	require.Equal(t, models.JobItemStatusPending, jobs.itemStatuses("job_1")["a"])
+}
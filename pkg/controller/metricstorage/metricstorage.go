@@ -0,0 +1,362 @@
+package metricstorage
+
+import (
+	"context"
+	"math"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/apex/log"
+	"github.com/deviceplane/deviceplane/pkg/controller/store"
+	"github.com/deviceplane/deviceplane/pkg/hash"
+	"github.com/deviceplane/deviceplane/pkg/metrics/sink"
+	"github.com/deviceplane/deviceplane/pkg/models"
+	"github.com/pkg/errors"
+)
+
+const (
+	// DeviceIDTag is added to every stored series so that metrics can be
+	// graphed per device regardless of the project's exposed properties
+	DeviceIDTag = "deviceplane.device_id"
+
+	// MinRetention keeps the finer tiers around long enough to be
+	// downsampled into the coarser ones
+	MinRetention = 24 * time.Hour
+
+	maintenanceInterval = time.Minute
+	maxPointsPerSeries  = 11000
+)
+
+var (
+	ErrInvalidRange  = errors.New("query end must be after its start")
+	ErrInvalidStep   = errors.New("query step must be at least one second")
+	ErrTooManyPoints = errors.New("query would return too many points, increase the step or shorten the range")
+)
+
+// tier is a resolution that points are stored at. Each tier is downsampled
+// from the one before it.
+type tier struct {
+	resolution int64
+	retention  time.Duration
+}
+
+// Storage keeps forwarded metrics in the controller's database. Points are
+// written at one second resolution and downsampled into five minute and one
+// hour buckets, each kept for progressively longer.
+type Storage struct {
+	storedMetrics store.StoredMetrics
+	tiers         []tier
+
+	lock sync.Mutex
+	// oldestWrite is the earliest timestamp written since the last
+	// maintenance run, so that late points get downsampled too
+	oldestWrite int64
+	written     bool
+}
+
+func New(storedMetrics store.StoredMetrics, retention time.Duration) *Storage {
+	return &Storage{
+		storedMetrics: storedMetrics,
+		tiers: []tier{
+			{resolution: 1, retention: minDuration(24*time.Hour, retention)},
+			{resolution: 5 * 60, retention: minDuration(7*24*time.Hour, retention)},
+			{resolution: 60 * 60, retention: retention},
+		},
+	}
+}
+
+// Write stores metrics that were forwarded by a device. Samples in the same
+// second of a series are merged into one point, which replaces any point
+// already stored for that second, so writing the same metrics again doesn't
+// count them twice.
+func (s *Storage) Write(ctx context.Context, projectID, deviceID string, series models.DatadogSeries) error {
+	var points []models.MetricPoint
+	pointIndexes := make(map[pointKey]int)
+	createdSeries := make(map[string]bool)
+
+	for _, metric := range series {
+		tags := sink.Labels(metric)
+		tags[DeviceIDTag] = deviceID
+
+		seriesID := metricSeriesID(projectID, metric.Metric, tags)
+		if !createdSeries[seriesID] {
+			if err := s.storedMetrics.CreateMetricSeries(ctx, models.MetricSeries{
+				ID:        seriesID,
+				ProjectID: projectID,
+				Metric:    metric.Metric,
+				Tags:      tags,
+			}); err != nil {
+				return errors.Wrap(err, "create metric series")
+			}
+			createdSeries[seriesID] = true
+		}
+
+		for _, sample := range sink.Samples(metric) {
+			if math.IsNaN(sample.Value) || math.IsInf(sample.Value, 0) {
+				continue
+			}
+
+			key := pointKey{seriesID: seriesID, timestamp: sample.Timestamp.Unix()}
+			if i, ok := pointIndexes[key]; ok {
+				points[i].Count++
+				points[i].Sum += sample.Value
+				points[i].Min = math.Min(points[i].Min, sample.Value)
+				points[i].Max = math.Max(points[i].Max, sample.Value)
+				continue
+			}
+
+			pointIndexes[key] = len(points)
+			points = append(points, models.MetricPoint{
+				SeriesID:   seriesID,
+				Resolution: s.tiers[0].resolution,
+				Timestamp:  key.timestamp,
+				Count:      1,
+				Sum:        sample.Value,
+				Min:        sample.Value,
+				Max:        sample.Value,
+			})
+		}
+	}
+
+	for _, point := range points {
+		s.markWritten(point.Timestamp)
+	}
+
+	return errors.Wrap(s.storedMetrics.AddMetricPoints(ctx, points), "add metric points")
+}
+
+type pointKey struct {
+	seriesID  string
+	timestamp int64
+}
+
+// markWritten records that points from timestamp onwards need to be
+// downsampled again.
+func (s *Storage) markWritten(timestamp int64) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if !s.written || timestamp < s.oldestWrite {
+		s.oldestWrite = timestamp
+	}
+	s.written = true
+}
+
+type Query struct {
+	Metric string
+	// Tags that series must have, all of them matching
+	Tags  map[string]string
+	Start time.Time
+	End   time.Time
+	Step  time.Duration
+}
+
+// Query returns the matching series with one point per step. Each point
+// averages the values within its step.
+func (s *Storage) Query(ctx context.Context, projectID string, query Query) ([]models.MetricQueryResult, error) {
+	if !query.End.After(query.Start) {
+		return nil, ErrInvalidRange
+	}
+	if query.Step < time.Second {
+		return nil, ErrInvalidStep
+	}
+	step := int64(query.Step / time.Second)
+	start := query.Start.Unix()
+	end := query.End.Unix()
+	if (end-start)/step > maxPointsPerSeries {
+		return nil, ErrTooManyPoints
+	}
+
+	metricSeries, err := s.storedMetrics.ListMetricSeries(ctx, projectID, query.Metric)
+	if err != nil {
+		return nil, errors.Wrap(err, "list metric series")
+	}
+
+	var seriesIDs []string
+	seriesByID := make(map[string]models.MetricSeries)
+	for _, series := range metricSeries {
+		if matchesTags(series.Tags, query.Tags) {
+			seriesIDs = append(seriesIDs, series.ID)
+			seriesByID[series.ID] = series
+		}
+	}
+
+	resolution := s.resolutionFor(time.Now(), query.Start, step)
+
+	points, err := s.storedMetrics.ListMetricPoints(ctx, seriesIDs, resolution, start-start%resolution, end)
+	if err != nil {
+		return nil, errors.Wrap(err, "list metric points")
+	}
+
+	pointsBySeriesID := make(map[string][]models.MetricPoint)
+	for _, point := range points {
+		pointsBySeriesID[point.SeriesID] = append(pointsBySeriesID[point.SeriesID], point)
+	}
+
+	ret := make([]models.MetricQueryResult, 0, len(seriesIDs))
+	for _, seriesID := range seriesIDs {
+		ret = append(ret, models.MetricQueryResult{
+			Metric: seriesByID[seriesID].Metric,
+			Tags:   seriesByID[seriesID].Tags,
+			Points: aggregate(pointsBySeriesID[seriesID], start, step),
+		})
+	}
+	return ret, nil
+}
+
+// resolutionFor picks the finest tier that still has data from start and
+// isn't finer than needed for the step. If no tier goes back far enough, the
+// one that goes back furthest is used.
+func (s *Storage) resolutionFor(now, start time.Time, step int64) int64 {
+	for i, tier := range s.tiers {
+		if i < len(s.tiers)-1 && s.tiers[i+1].resolution <= step {
+			continue
+		}
+		if !start.Before(now.Add(-tier.retention)) {
+			return tier.resolution
+		}
+	}
+	return s.tiers[len(s.tiers)-1].resolution
+}
+
+// aggregate merges points, which are ordered by timestamp, into buckets of
+// step seconds aligned with start.
+func aggregate(points []models.MetricPoint, start, step int64) []models.MetricQueryPoint {
+	ret := make([]models.MetricQueryPoint, 0)
+
+	var bucket *models.MetricPoint
+	flush := func() {
+		if bucket == nil || bucket.Count == 0 {
+			return
+		}
+		ret = append(ret, models.MetricQueryPoint{
+			Timestamp: time.Unix(bucket.Timestamp, 0).UTC(),
+			Value:     bucket.Sum / float64(bucket.Count),
+			Min:       bucket.Min,
+			Max:       bucket.Max,
+		})
+	}
+
+	for _, point := range points {
+		offset := point.Timestamp - start
+		if offset < 0 {
+			// The point's bucket started before the query did, so it's
+			// counted in the first step
+			offset = 0
+		}
+		bucketTimestamp := start + offset - offset%step
+
+		if bucket == nil || bucket.Timestamp != bucketTimestamp {
+			flush()
+			bucket = &models.MetricPoint{
+				Timestamp: bucketTimestamp,
+				Min:       point.Min,
+				Max:       point.Max,
+			}
+		}
+
+		bucket.Count += point.Count
+		bucket.Sum += point.Sum
+		bucket.Min = math.Min(bucket.Min, point.Min)
+		bucket.Max = math.Max(bucket.Max, point.Max)
+	}
+	flush()
+
+	return ret
+}
+
+// Run downsamples and expires points until the context is canceled.
+func (s *Storage) Run(ctx context.Context) {
+	ticker := time.NewTicker(maintenanceInterval)
+	defer ticker.Stop()
+
+	for {
+		s.maintain(ctx, time.Now())
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (s *Storage) maintain(ctx context.Context, now time.Time) {
+	nowUnix := now.Unix()
+
+	s.lock.Lock()
+	oldestWrite, written := s.oldestWrite, s.written
+	s.written = false
+	s.lock.Unlock()
+
+	for i := 1; i < len(s.tiers); i++ {
+		resolution := s.tiers[i].resolution
+
+		// The current bucket is recomputed on every run until it's complete,
+		// and the previous one once more. Buckets that points arrived late
+		// for since the last run are recomputed too.
+		end := nowUnix - nowUnix%resolution + resolution
+		start := end - 2*resolution
+		if written && oldestWrite < start {
+			start = oldestWrite - oldestWrite%resolution
+		}
+
+		if err := s.storedMetrics.DownsampleMetricPoints(ctx,
+			s.tiers[i-1].resolution, resolution, start, end); err != nil {
+			log.WithError(err).Error("downsample metric points")
+			if written {
+				s.markWritten(oldestWrite)
+			}
+		}
+	}
+
+	for _, tier := range s.tiers {
+		if err := s.storedMetrics.DeleteMetricPoints(ctx,
+			tier.resolution, now.Add(-tier.retention).Unix()); err != nil {
+			log.WithError(err).Error("delete expired metric points")
+		}
+	}
+
+	if err := s.storedMetrics.DeleteEmptyMetricSeries(ctx); err != nil {
+		log.WithError(err).Error("delete empty metric series")
+	}
+}
+
+func matchesTags(tags, required map[string]string) bool {
+	for k, v := range required {
+		if value, ok := tags[k]; !ok || value != v {
+			return false
+		}
+	}
+	return true
+}
+
+// metricSeriesID derives a series' ID from everything that identifies it.
+func metricSeriesID(projectID, metric string, tags map[string]string) string {
+	keys := make([]string, 0, len(tags))
+	for k := range tags {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	var b strings.Builder
+	b.WriteString(projectID)
+	b.WriteByte(0)
+	b.WriteString(metric)
+	for _, k := range keys {
+		b.WriteByte(0)
+		b.WriteString(k)
+		b.WriteByte('=')
+		b.WriteString(tags[k])
+	}
+	return hash.Hash(b.String())
+}
+
+func minDuration(a, b time.Duration) time.Duration {
+	if a < b {
+		return a
+	}
+	return b
+}
@@ -0,0 +1,149 @@
+package metricstorage
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/deviceplane/deviceplane/pkg/controller/store"
+	"github.com/deviceplane/deviceplane/pkg/models"
+	"github.com/stretchr/testify/require"
+)
+
+type downsample struct {
+	fromResolution, toResolution, start, end int64
+}
+
+type fakeStoredMetrics struct {
+	store.StoredMetrics
+
+	points      []models.MetricPoint
+	downsamples []downsample
+}
+
+func (f *fakeStoredMetrics) CreateMetricSeries(ctx context.Context, series models.MetricSeries) error {
+	return nil
+}
+
+func (f *fakeStoredMetrics) AddMetricPoints(ctx context.Context, points []models.MetricPoint) error {
+	f.points = append(f.points, points...)
+	return nil
+}
+
+func (f *fakeStoredMetrics) DownsampleMetricPoints(ctx context.Context, fromResolution, toResolution, start, end int64) error {
+	f.downsamples = append(f.downsamples, downsample{fromResolution, toResolution, start, end})
+	return nil
+}
+
+func (f *fakeStoredMetrics) DeleteMetricPoints(ctx context.Context, resolution, before int64) error {
+	return nil
+}
+
+func (f *fakeStoredMetrics) DeleteEmptyMetricSeries(ctx context.Context) error {
+	return nil
+}
+
+func TestResolutionFor(t *testing.T) {
+	s := New(nil, 90*24*time.Hour)
+	now := time.Unix(1577836800, 0)
+
+	for _, tc := range []struct {
+		start    time.Time
+		step     int64
+		expected int64
+	}{
+		{now.Add(-time.Hour), 10, 1},
+		{now.Add(-time.Hour), 300, 300},
+		{now.Add(-time.Hour), 7200, 3600},
+		{now.Add(-48 * time.Hour), 10, 300},
+		{now.Add(-30 * 24 * time.Hour), 10, 3600},
+		{now.Add(-365 * 24 * time.Hour), 10, 3600},
+	} {
+		require.Equal(t, tc.expected, s.resolutionFor(now, tc.start, tc.step), "%v %d", tc.start, tc.step)
+	}
+}
+
+func TestAggregate(t *testing.T) {
+	points := []models.MetricPoint{
+		{Timestamp: 95, Count: 1, Sum: 1, Min: 1, Max: 1},
+		{Timestamp: 100, Count: 1, Sum: 3, Min: 3, Max: 3},
+		{Timestamp: 130, Count: 2, Sum: 10, Min: 4, Max: 6},
+		{Timestamp: 160, Count: 1, Sum: 7, Min: 7, Max: 7},
+	}
+
+	require.Equal(t, []models.MetricQueryPoint{
+		{Timestamp: time.Unix(100, 0).UTC(), Value: 2, Min: 1, Max: 3},
+		{Timestamp: time.Unix(130, 0).UTC(), Value: 5, Min: 4, Max: 6},
+		{Timestamp: time.Unix(160, 0).UTC(), Value: 7, Min: 7, Max: 7},
+	}, aggregate(points, 100, 30))
+}
+
+func TestMetricSeriesID(t *testing.T) {
+	id := metricSeriesID("prj_1", "cpu", map[string]string{"a": "1", "b": "2"})
+	require.Len(t, id, 64)
+	require.Equal(t, id, metricSeriesID("prj_1", "cpu", map[string]string{"b": "2", "a": "1"}))
+	require.NotEqual(t, id, metricSeriesID("prj_2", "cpu", map[string]string{"a": "1", "b": "2"}))
+}
+
+func TestWriteMergesSamplesInTheSameSecond(t *testing.T) {
+	storedMetrics := &fakeStoredMetrics{}
+	s := New(storedMetrics, 90*24*time.Hour)
+
+	require.NoError(t, s.Write(context.Background(), "prj_1", "dev_1", models.DatadogSeries{
+		{
+			Metric: "cpu",
+			Points: [][2]interface{}{
+				{float64(100), float64(1)},
+				{float64(100.5), float64(3)},
+				{float64(101), float64(5)},
+			},
+		},
+	}))
+
+	require.Len(t, storedMetrics.points, 2)
+	require.Equal(t, int64(100), storedMetrics.points[0].Timestamp)
+	require.Equal(t, int64(2), storedMetrics.points[0].Count)
+	require.Equal(t, 4.0, storedMetrics.points[0].Sum)
+	require.Equal(t, 1.0, storedMetrics.points[0].Min)
+	require.Equal(t, 3.0, storedMetrics.points[0].Max)
+	require.Equal(t, int64(101), storedMetrics.points[1].Timestamp)
+	require.Equal(t, int64(1), storedMetrics.points[1].Count)
+}
+
+func TestMaintainDownsamplesLatePoints(t *testing.T) {
+	storedMetrics := &fakeStoredMetrics{}
+	s := New(storedMetrics, 90*24*time.Hour)
+	now := time.Unix(1577836800, 0)
+
+	s.maintain(context.Background(), now)
+	require.Equal(t, []downsample{
+		{1, 300, 1577836800 - 300, 1577836800 + 300},
+		{300, 3600, 1577836800 - 3600, 1577836800 + 3600},
+	}, storedMetrics.downsamples)
+
+	// A point from three hours ago is downsampled from its buckets onwards
+	late := now.Add(-3*time.Hour - 10*time.Minute)
+	require.NoError(t, s.Write(context.Background(), "prj_1", "dev_1", models.DatadogSeries{
+		{
+			Metric: "cpu",
+			Points: [][2]interface{}{
+				{float64(late.Unix()), float64(1)},
+			},
+		},
+	}))
+
+	storedMetrics.downsamples = nil
+	s.maintain(context.Background(), now)
+	require.Equal(t, []downsample{
+		{1, 300, late.Unix(), 1577836800 + 300},
+		{300, 3600, 1577836800 - 4*3600, 1577836800 + 3600},
+	}, storedMetrics.downsamples)
+
+	// Only once
+	storedMetrics.downsamples = nil
+	s.maintain(context.Background(), now)
+	require.Equal(t, []downsample{
+		{1, 300, 1577836800 - 300, 1577836800 + 300},
+		{300, 3600, 1577836800 - 3600, 1577836800 + 3600},
+	}, storedMetrics.downsamples)
+}
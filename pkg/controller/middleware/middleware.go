@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"math"
 	"net/http"
+	"net/url"
 	"strconv"
 
 	"github.com/deviceplane/deviceplane/pkg/utils"
@@ -37,65 +38,83 @@ const (
 	OrderDescending = orderDirection("desc")
 )
 
-func SortAndPaginateAndRespond(r http.Request, w http.ResponseWriter, arr []interface{}) {
-	values := r.URL.Query()
-	after := values.Get(AfterParam)
+// PageParams are the sorting and pagination parameters of a list request.
+type PageParams struct {
+	After     string
+	PageSize  int
+	OrderBy   string
+	Direction orderDirection
+}
+
+func ParsePageParams(values url.Values) (*PageParams, error) {
+	params := PageParams{
+		After:     values.Get(AfterParam),
+		PageSize:  MaxPageSize,
+		OrderBy:   values.Get(OrderByParam),
+		Direction: OrderAscending,
+	}
 
-	var pageSize *int
 	if pageSizeStr := values.Get(PageSizeParam); pageSizeStr != "" {
 		p, err := strconv.Atoi(pageSizeStr)
 		if err != nil || p <= 0 || p > MaxPageSize {
-			http.Error(w, ErrInvalidPageSizeParameter.Error(), http.StatusBadRequest)
-			return
+			return nil, ErrInvalidPageSizeParameter
 		}
-		pageSize = &p
-	}
-	if pageSize == nil {
-		m := MaxPageSize
-		pageSize = &m
+		params.PageSize = p
 	}
 
-	var direction *orderDirection
 	if orderStr := values.Get(OrderParam); orderStr != "" {
 		switch orderStr {
 		case string(OrderAscending):
-			d := OrderAscending
-			direction = &d
+			params.Direction = OrderAscending
 		case string(OrderDescending):
-			d := OrderDescending
-			direction = &d
+			params.Direction = OrderDescending
 		default:
-			http.Error(w, ErrInvalidOrderParameter.Error(), http.StatusBadRequest)
-			return
+			return nil, ErrInvalidOrderParameter
 		}
 	}
-	if direction == nil {
-		d := OrderAscending
-		direction = &d
+
+	return &params, nil
+}
+
+func SortAndPaginateAndRespond(r http.Request, w http.ResponseWriter, arr []interface{}) {
+	params, err := ParsePageParams(r.URL.Query())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
 	}
 
-	var orderBy string = values.Get(OrderByParam)
-	if orderBy == "" {
+	if params.OrderBy == "" {
 		// Do nothing, no order
 	} else {
-		err := order(orderBy, *direction, arr)
+		err := order(params.OrderBy, params.Direction, arr)
 		if err != nil {
 			http.Error(w, err.Error(), http.StatusBadRequest)
 			return
 		}
 	}
 
-	// Set total pages header, as pages are required
-	totalPages := int(math.Ceil(float64(len(arr)) / float64(*pageSize)))
-	w.Header().Set(TotalPagesHeader, strconv.Itoa(totalPages))
+	setPageHeaders(w, len(arr), params.PageSize)
 
-	// Set total count header
-	w.Header().Set(TotalItemCountHeader, strconv.Itoa(len(arr)))
-
-	arr, err := paginateAfter(after, "id", *pageSize, arr)
+	arr, err = paginateAfter(params.After, "id", params.PageSize, arr)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
 	utils.Respond(w, arr)
 }
+
+// RespondWithPage responds with a page that has already been sorted and
+// paginated, such as by the store.
+func RespondWithPage(w http.ResponseWriter, page interface{}, totalItemCount, pageSize int) {
+	setPageHeaders(w, totalItemCount, pageSize)
+	utils.Respond(w, page)
+}
+
+func setPageHeaders(w http.ResponseWriter, totalItemCount, pageSize int) {
+	// Set total pages header, as pages are required
+	totalPages := int(math.Ceil(float64(totalItemCount) / float64(pageSize)))
+	w.Header().Set(TotalPagesHeader, strconv.Itoa(totalPages))
+
+	// Set total count header
+	w.Header().Set(TotalItemCountHeader, strconv.Itoa(totalItemCount))
+}
@@ -0,0 +1,270 @@
+package oidc
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/auth0-community/go-auth0"
+	"github.com/pkg/errors"
+	"gopkg.in/square/go-jose.v2"
+	"gopkg.in/square/go-jose.v2/jwt"
+)
+
+const discoveryPath = "/.well-known/openid-configuration"
+
+var (
+	ErrClaimNotFound    = errors.New("expected ID token claim not found")
+	ErrClaimNotString   = errors.New("expected ID token claim to be string")
+	ErrEmailNotVerified = errors.New("email isn't verified by the provider")
+)
+
+// Config describes an OpenID Connect provider and how the claims in its ID
+// tokens map onto users.
+type Config struct {
+	// DiscoveryURL is either the issuer URL or the full URL of the
+	// provider's discovery document.
+	DiscoveryURL string
+	ClientID     string
+
+	// ProviderName is stored as the provider of external users. If it's
+	// empty, Auth0-style subjects of the form "provider|id" are split and
+	// the issuer is used for every other subject.
+	ProviderName string
+
+	EmailClaim  string
+	NameClaim   string
+	GroupsClaim string
+}
+
+// Identity is the validated identity from an ID token.
+type Identity struct {
+	Email    string
+	Name     string
+	Groups   []string
+	Provider string
+	Subject  string
+	Claims   map[string]interface{}
+}
+
+type discoveryDocument struct {
+	Issuer  string `json:"issuer"`
+	JWKSURI string `json:"jwks_uri"`
+}
+
+// Provider validates ID tokens issued by an OpenID Connect provider. The
+// discovery document is fetched on first use so that an unreachable provider
+// doesn't prevent the controller from starting.
+type Provider struct {
+	config     Config
+	httpClient *http.Client
+
+	lock      sync.Mutex
+	issuer    string
+	validator *auth0.JWTValidator
+}
+
+func NewProvider(config Config, httpClient *http.Client) *Provider {
+	if config.EmailClaim == "" {
+		config.EmailClaim = "email"
+	}
+	if config.NameClaim == "" {
+		config.NameClaim = "name"
+	}
+	if config.GroupsClaim == "" {
+		config.GroupsClaim = "groups"
+	}
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+	return &Provider{
+		config:     config,
+		httpClient: httpClient,
+	}
+}
+
+func (p *Provider) ClientID() string {
+	return p.config.ClientID
+}
+
+// Issuer returns the issuer from the provider's discovery document.
+func (p *Provider) Issuer(ctx context.Context) (string, error) {
+	if _, err := p.getValidator(ctx); err != nil {
+		return "", err
+	}
+	return p.issuer, nil
+}
+
+func (p *Provider) getValidator(ctx context.Context) (*auth0.JWTValidator, error) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	if p.validator != nil {
+		return p.validator, nil
+	}
+
+	discoveryURL := p.config.DiscoveryURL
+	if !strings.HasSuffix(discoveryURL, discoveryPath) {
+		discoveryURL = strings.TrimSuffix(discoveryURL, "/") + discoveryPath
+	}
+
+	req, err := http.NewRequest("GET", discoveryURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := p.httpClient.Do(req.WithContext(ctx))
+	if err != nil {
+		return nil, errors.Wrap(err, "fetch discovery document")
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("fetch discovery document: unexpected status %d", resp.StatusCode)
+	}
+
+	var document discoveryDocument
+	if err := json.NewDecoder(resp.Body).Decode(&document); err != nil {
+		return nil, errors.Wrap(err, "decode discovery document")
+	}
+	if document.Issuer == "" || document.JWKSURI == "" {
+		return nil, errors.New("discovery document is missing issuer or jwks_uri")
+	}
+
+	client := auth0.NewJWKClient(auth0.JWKClientOptions{
+		URI:    document.JWKSURI,
+		Client: p.httpClient,
+	}, nil)
+	configuration := auth0.NewConfiguration(client, []string{p.config.ClientID}, document.Issuer, jose.RS256)
+
+	p.issuer = document.Issuer
+	p.validator = auth0.NewValidator(configuration, nil)
+	return p.validator, nil
+}
+
+// Validate verifies the signature, issuer, audience and expiry of the raw ID
+// token and maps its claims to an identity.
+func (p *Provider) Validate(ctx context.Context, rawIDToken string) (*Identity, error) {
+	validator, err := p.getValidator(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	token, err := jwt.ParseSigned(rawIDToken)
+	if err != nil {
+		return nil, errors.New("couldn't parse token")
+	}
+	if err := validator.ValidateToken(token); err != nil {
+		return nil, errors.New("couldn't validate token")
+	}
+
+	claims := make(map[string]interface{})
+	if err := validator.Claims(token, &claims); err != nil {
+		return nil, errors.New("couldn't unmarshal claims")
+	}
+
+	return p.identity(claims)
+}
+
+func (p *Provider) identity(claims map[string]interface{}) (*Identity, error) {
+	sub, err := stringClaim(claims, "sub")
+	if err != nil {
+		return nil, errors.Wrap(err, "sub")
+	}
+
+	email, err := stringClaim(claims, p.config.EmailClaim)
+	if err != nil {
+		return nil, errors.Wrap(err, p.config.EmailClaim)
+	}
+
+	// Emails are trusted to match users and to check allowed email domains,
+	// so only emails that the provider has verified are accepted. Some
+	// providers send the claim as a string.
+	switch emailVerified := claims["email_verified"].(type) {
+	case bool:
+		if !emailVerified {
+			return nil, ErrEmailNotVerified
+		}
+	case string:
+		if emailVerified != "true" {
+			return nil, ErrEmailNotVerified
+		}
+	default:
+		return nil, ErrEmailNotVerified
+	}
+
+	// TODO: validate nonce
+	if _, err := stringClaim(claims, "nonce"); err != nil {
+		return nil, errors.Wrap(err, "nonce")
+	}
+
+	// Not every provider includes a display name, so fall back to the email
+	name, err := stringClaim(claims, p.config.NameClaim)
+	if err == ErrClaimNotFound {
+		name = email
+	} else if err != nil {
+		return nil, errors.Wrap(err, p.config.NameClaim)
+	}
+
+	groups, err := groupsClaim(claims, p.config.GroupsClaim)
+	if err != nil {
+		return nil, errors.Wrap(err, p.config.GroupsClaim)
+	}
+
+	provider, subject := p.config.ProviderName, sub
+	if provider == "" {
+		if subParts := strings.Split(sub, "|"); len(subParts) == 2 {
+			provider, subject = subParts[0], subParts[1]
+		} else {
+			provider = p.issuer
+		}
+	}
+
+	return &Identity{
+		Email:    email,
+		Name:     name,
+		Groups:   groups,
+		Provider: provider,
+		Subject:  subject,
+		Claims:   claims,
+	}, nil
+}
+
+func stringClaim(claims map[string]interface{}, key string) (string, error) {
+	v, ok := claims[key]
+	if !ok {
+		return "", ErrClaimNotFound
+	}
+	value, ok := v.(string)
+	if !ok {
+		return "", ErrClaimNotString
+	}
+	return value, nil
+}
+
+// groupsClaim accepts either a list of strings or a single string. A missing
+// claim means the user isn't in any groups.
+func groupsClaim(claims map[string]interface{}, key string) ([]string, error) {
+	v, ok := claims[key]
+	if !ok {
+		return nil, nil
+	}
+	switch value := v.(type) {
+	case string:
+		return []string{value}, nil
+	case []interface{}:
+		groups := make([]string, 0, len(value))
+		for _, group := range value {
+			s, ok := group.(string)
+			if !ok {
+				return nil, ErrClaimNotString
+			}
+			groups = append(groups, s)
+		}
+		return groups, nil
+	default:
+		return nil, ErrClaimNotString
+	}
+}
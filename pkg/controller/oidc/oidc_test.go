@@ -0,0 +1,186 @@
+package oidc
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"gopkg.in/square/go-jose.v2"
+	"gopkg.in/square/go-jose.v2/jwt"
+)
+
+type testIssuer struct {
+	server *httptest.Server
+	key    *rsa.PrivateKey
+}
+
+func newTestIssuer(t *testing.T) *testIssuer {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+
+	issuer := &testIssuer{key: key}
+	mux := http.NewServeMux()
+	mux.HandleFunc(discoveryPath, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(discoveryDocument{
+			Issuer:  issuer.server.URL,
+			JWKSURI: issuer.server.URL + "/keys",
+		})
+	})
+	mux.HandleFunc("/keys", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(jose.JSONWebKeySet{
+			Keys: []jose.JSONWebKey{
+				{Key: &key.PublicKey, KeyID: "test", Algorithm: string(jose.RS256), Use: "sig"},
+			},
+		})
+	})
+	issuer.server = httptest.NewServer(mux)
+	return issuer
+}
+
+func (i *testIssuer) sign(t *testing.T, audience string, claims map[string]interface{}) string {
+	signer, err := jose.NewSigner(jose.SigningKey{Algorithm: jose.RS256, Key: i.key},
+		(&jose.SignerOptions{}).WithType("JWT").WithHeader("kid", "test"))
+	require.NoError(t, err)
+
+	token, err := jwt.Signed(signer).Claims(jwt.Claims{
+		Issuer:   i.server.URL,
+		Audience: jwt.Audience{audience},
+		Expiry:   jwt.NewNumericDate(time.Now().Add(time.Hour)),
+		IssuedAt: jwt.NewNumericDate(time.Now()),
+	}).Claims(claims).CompactSerialize()
+	require.NoError(t, err)
+	return token
+}
+
+func TestValidate(t *testing.T) {
+	issuer := newTestIssuer(t)
+	defer issuer.server.Close()
+	ctx := context.Background()
+
+	t.Run("default claims", func(t *testing.T) {
+		provider := NewProvider(Config{
+			DiscoveryURL: issuer.server.URL,
+			ClientID:     "deviceplane",
+		}, nil)
+
+		identity, err := provider.Validate(ctx, issuer.sign(t, "deviceplane", map[string]interface{}{
+			"sub":            "1234",
+			"email":          "user@example.com",
+			"email_verified": true,
+			"nonce":          "nonce",
+			"name":           "Example User",
+			"groups":         []string{"ops", "dev"},
+		}))
+		require.NoError(t, err)
+		require.Equal(t, "user@example.com", identity.Email)
+		require.Equal(t, "Example User", identity.Name)
+		require.Equal(t, []string{"ops", "dev"}, identity.Groups)
+		require.Equal(t, issuer.server.URL, identity.Provider)
+		require.Equal(t, "1234", identity.Subject)
+	})
+
+	t.Run("mapped claims", func(t *testing.T) {
+		provider := NewProvider(Config{
+			DiscoveryURL: issuer.server.URL + discoveryPath,
+			ClientID:     "deviceplane",
+			ProviderName: "keycloak",
+			EmailClaim:   "mail",
+			NameClaim:    "display_name",
+			GroupsClaim:  "roles",
+		}, nil)
+
+		identity, err := provider.Validate(ctx, issuer.sign(t, "deviceplane", map[string]interface{}{
+			"sub":            "1234",
+			"mail":           "user@example.com",
+			"email_verified": "true",
+			"nonce":          "nonce",
+			"roles":          "admin",
+		}))
+		require.NoError(t, err)
+		require.Equal(t, "user@example.com", identity.Email)
+		require.Equal(t, "user@example.com", identity.Name)
+		require.Equal(t, []string{"admin"}, identity.Groups)
+		require.Equal(t, "keycloak", identity.Provider)
+		require.Equal(t, "1234", identity.Subject)
+	})
+
+	t.Run("auth0 subject", func(t *testing.T) {
+		provider := NewProvider(Config{
+			DiscoveryURL: issuer.server.URL,
+			ClientID:     "deviceplane",
+		}, nil)
+
+		identity, err := provider.Validate(ctx, issuer.sign(t, "deviceplane", map[string]interface{}{
+			"sub":            "github|1234",
+			"email":          "user@example.com",
+			"email_verified": true,
+			"nonce":          "nonce",
+		}))
+		require.NoError(t, err)
+		require.Equal(t, "github", identity.Provider)
+		require.Equal(t, "1234", identity.Subject)
+	})
+
+	t.Run("wrong audience", func(t *testing.T) {
+		provider := NewProvider(Config{
+			DiscoveryURL: issuer.server.URL,
+			ClientID:     "deviceplane",
+		}, nil)
+
+		_, err := provider.Validate(ctx, issuer.sign(t, "other", map[string]interface{}{
+			"sub":   "1234",
+			"email": "user@example.com",
+		}))
+		require.Error(t, err)
+	})
+
+	t.Run("missing email", func(t *testing.T) {
+		provider := NewProvider(Config{
+			DiscoveryURL: issuer.server.URL,
+			ClientID:     "deviceplane",
+		}, nil)
+
+		_, err := provider.Validate(ctx, issuer.sign(t, "deviceplane", map[string]interface{}{
+			"sub": "1234",
+		}))
+		require.Error(t, err)
+	})
+
+	for name, claims := range map[string]map[string]interface{}{
+		"unverified email": {
+			"sub":            "1234",
+			"email":          "user@example.com",
+			"email_verified": false,
+			"nonce":          "nonce",
+		},
+		"missing email_verified": {
+			"sub":   "1234",
+			"email": "user@example.com",
+			"nonce": "nonce",
+		},
+		"missing nonce": {
+			"sub":            "1234",
+			"email":          "user@example.com",
+			"email_verified": true,
+		},
+	} {
+		claims := claims
+		t.Run(name, func(t *testing.T) {
+			provider := NewProvider(Config{
+				DiscoveryURL: issuer.server.URL,
+				ClientID:     "deviceplane",
+			}, nil)
+
+			_, err := provider.Validate(ctx, issuer.sign(t, "deviceplane", claims))
+			require.Error(t, err)
+		})
+	}
+}
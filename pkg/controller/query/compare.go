@@ -0,0 +1,338 @@
+package query
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/deviceplane/deviceplane/pkg/models"
+)
+
+var (
+	// Properties that are compared as times. Values can be RFC 3339
+	// timestamps, "now", or "now-" followed by a duration.
+	timeProperties = map[string]bool{
+		"createdAt":  true,
+		"lastSeenAt": true,
+	}
+
+	// Properties that are always compared as versions, so that 1.10 is
+	// after 1.9
+	versionProperties = map[string]bool{
+		"desiredAgentVersion":      true,
+		"info.agentVersion":        true,
+		"info.osRelease.versionId": true,
+	}
+
+	versionRegex = regexp.MustCompile(`^v?(\d+(?:\.\d+)*)(?:-([0-9A-Za-z.-]+))?(?:\+[0-9A-Za-z.-]+)?$`)
+
+	regexCacheLock sync.Mutex
+	regexCache     = make(map[string]*regexp.Regexp)
+)
+
+const maxCachedRegexes = 1000
+
+// matchValue reports whether a value matches a condition's operator. The
+// property is only used to decide how values are compared, and it's empty
+// for labels. Values that can't be compared don't match.
+func matchValue(property string, value string, exists bool, operator models.Operator, target string, targets []string) (bool, error) {
+	switch operator {
+	case models.OperatorIs:
+		return exists && value == target, nil
+	case models.OperatorIsNot:
+		return !exists || value != target, nil
+
+	case models.OperatorIn, models.OperatorNotIn:
+		in := false
+		if exists {
+			for _, t := range targets {
+				if value == t {
+					in = true
+					break
+				}
+			}
+		}
+		return in == (operator == models.OperatorIn), nil
+
+	case models.OperatorMatches, models.OperatorNotMatches:
+		re, err := compileRegex(target)
+		if err != nil {
+			return false, err
+		}
+		match := exists && re.MatchString(value)
+		return match == (operator == models.OperatorMatches), nil
+
+	case models.OperatorLike, models.OperatorNotLike:
+		re, err := compileRegex(globToRegex(target))
+		if err != nil {
+			return false, err
+		}
+		match := exists && re.MatchString(value)
+		return match == (operator == models.OperatorLike), nil
+
+	case models.OperatorGreaterThan, models.OperatorGreaterThanOrEqual,
+		models.OperatorLessThan, models.OperatorLessThanOrEqual:
+		if !exists {
+			return false, nil
+		}
+		cmp, ok := compareValues(property, value, target, time.Now())
+		if !ok {
+			return false, nil
+		}
+		switch operator {
+		case models.OperatorGreaterThan:
+			return cmp > 0, nil
+		case models.OperatorGreaterThanOrEqual:
+			return cmp >= 0, nil
+		case models.OperatorLessThan:
+			return cmp < 0, nil
+		default:
+			return cmp <= 0, nil
+		}
+	}
+	return false, ErrOperatorInvalid
+}
+
+// validateValue checks the value of a condition, which for labels has an
+// empty property.
+func validateValue(property string, operator models.Operator, value string, values []string) error {
+	switch operator {
+	case models.OperatorIs, models.OperatorIsNot:
+		if value == "" {
+			return ErrNoEmptyFields
+		}
+		return nil
+
+	case models.OperatorIn, models.OperatorNotIn:
+		if len(values) == 0 {
+			return ErrNoEmptyFields
+		}
+		return nil
+
+	case models.OperatorMatches, models.OperatorNotMatches:
+		if value == "" {
+			return ErrNoEmptyFields
+		}
+		if _, err := compileRegex(value); err != nil {
+			return ErrRegexInvalid
+		}
+		return nil
+
+	case models.OperatorLike, models.OperatorNotLike:
+		if value == "" {
+			return ErrNoEmptyFields
+		}
+		return nil
+
+	case models.OperatorGreaterThan, models.OperatorGreaterThanOrEqual,
+		models.OperatorLessThan, models.OperatorLessThanOrEqual:
+		if value == "" {
+			return ErrNoEmptyFields
+		}
+		if timeProperties[property] {
+			if _, ok := ParseTime(value, time.Now()); !ok {
+				return ErrTimeInvalid
+			}
+		}
+		if versionProperties[property] {
+			if _, _, ok := parseVersion(value); !ok {
+				return ErrVersionInvalid
+			}
+		}
+		return nil
+	}
+	return ErrOperatorInvalid
+}
+
+// compareValues returns -1, 0 or 1 depending on whether a is less than, equal
+// to or greater than b, and false if they can't be compared.
+func compareValues(property, a, b string, now time.Time) (int, bool) {
+	if timeProperties[property] {
+		aTime, aOK := ParseTime(a, now)
+		bTime, bOK := ParseTime(b, now)
+		if !aOK || !bOK {
+			return 0, false
+		}
+		switch {
+		case aTime.Before(bTime):
+			return -1, true
+		case aTime.After(bTime):
+			return 1, true
+		}
+		return 0, true
+	}
+
+	if versionProperties[property] {
+		return compareVersions(a, b)
+	}
+
+	aFloat, aErr := strconv.ParseFloat(a, 64)
+	bFloat, bErr := strconv.ParseFloat(b, 64)
+	if aErr == nil && bErr == nil && !looksLikeVersion(a) && !looksLikeVersion(b) {
+		switch {
+		case aFloat < bFloat:
+			return -1, true
+		case aFloat > bFloat:
+			return 1, true
+		}
+		return 0, true
+	}
+
+	if cmp, ok := compareVersions(a, b); ok {
+		return cmp, true
+	}
+
+	return strings.Compare(a, b), true
+}
+
+// looksLikeVersion is true for values that parse as numbers but are more
+// likely to be versions, such as "v1" or "1.2.3".
+func looksLikeVersion(s string) bool {
+	return strings.HasPrefix(s, "v") || strings.Count(s, ".") > 1
+}
+
+// ParseTime parses the value of a condition on a time property.
+func ParseTime(s string, now time.Time) (time.Time, bool) {
+	if s == "now" {
+		return now, true
+	}
+	if strings.HasPrefix(s, "now-") {
+		d, err := time.ParseDuration(strings.TrimPrefix(s, "now-"))
+		if err != nil {
+			return time.Time{}, false
+		}
+		return now.Add(-d), true
+	}
+	t, err := time.Parse(time.RFC3339Nano, s)
+	if err != nil {
+		return time.Time{}, false
+	}
+	return t, true
+}
+
+func parseVersion(s string) ([]int, string, bool) {
+	match := versionRegex.FindStringSubmatch(s)
+	if match == nil {
+		return nil, "", false
+	}
+
+	var parts []int
+	for _, part := range strings.Split(match[1], ".") {
+		n, err := strconv.Atoi(part)
+		if err != nil {
+			return nil, "", false
+		}
+		parts = append(parts, n)
+	}
+	return parts, match[2], true
+}
+
+// compareVersions compares versions like semver does, except that missing
+// minor and patch versions are treated as zero.
+func compareVersions(a, b string) (int, bool) {
+	aParts, aPre, aOK := parseVersion(a)
+	bParts, bPre, bOK := parseVersion(b)
+	if !aOK || !bOK {
+		return 0, false
+	}
+
+	for i := 0; i < len(aParts) || i < len(bParts); i++ {
+		var aPart, bPart int
+		if i < len(aParts) {
+			aPart = aParts[i]
+		}
+		if i < len(bParts) {
+			bPart = bParts[i]
+		}
+		switch {
+		case aPart < bPart:
+			return -1, true
+		case aPart > bPart:
+			return 1, true
+		}
+	}
+
+	// A pre-release comes before the release itself
+	switch {
+	case aPre == bPre:
+		return 0, true
+	case aPre == "":
+		return 1, true
+	case bPre == "":
+		return -1, true
+	}
+	return comparePreReleases(aPre, bPre), true
+}
+
+func comparePreReleases(a, b string) int {
+	aIdentifiers := strings.Split(a, ".")
+	bIdentifiers := strings.Split(b, ".")
+
+	for i := 0; i < len(aIdentifiers) && i < len(bIdentifiers); i++ {
+		aNum, aErr := strconv.Atoi(aIdentifiers[i])
+		bNum, bErr := strconv.Atoi(bIdentifiers[i])
+		switch {
+		case aErr == nil && bErr == nil:
+			if aNum != bNum {
+				if aNum < bNum {
+					return -1
+				}
+				return 1
+			}
+		case aErr == nil:
+			return -1
+		case bErr == nil:
+			return 1
+		default:
+			if cmp := strings.Compare(aIdentifiers[i], bIdentifiers[i]); cmp != 0 {
+				return cmp
+			}
+		}
+	}
+
+	switch {
+	case len(aIdentifiers) < len(bIdentifiers):
+		return -1
+	case len(aIdentifiers) > len(bIdentifiers):
+		return 1
+	}
+	return 0
+}
+
+// compileRegex compiles a regular expression that has to match the whole
+// value. Expressions are cached since conditions are evaluated once per
+// device.
+func compileRegex(expr string) (*regexp.Regexp, error) {
+	regexCacheLock.Lock()
+	defer regexCacheLock.Unlock()
+
+	if re, ok := regexCache[expr]; ok {
+		return re, nil
+	}
+	re, err := regexp.Compile("^(?:" + expr + ")$")
+	if err != nil {
+		return nil, err
+	}
+	if len(regexCache) >= maxCachedRegexes {
+		regexCache = make(map[string]*regexp.Regexp)
+	}
+	regexCache[expr] = re
+	return re, nil
+}
+
+func globToRegex(glob string) string {
+	var b strings.Builder
+	for _, r := range glob {
+		switch r {
+		case '*':
+			b.WriteString(".*")
+		case '?':
+			b.WriteString(".")
+		default:
+			b.WriteString(regexp.QuoteMeta(string(r)))
+		}
+	}
+	return b.String()
+}
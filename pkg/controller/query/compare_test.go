@@ -0,0 +1,85 @@
+package query
+
+import (
+	"testing"
+	"time"
+
+	"github.com/deviceplane/deviceplane/pkg/models"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCompareValues(t *testing.T) {
+	now := time.Date(2020, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	for _, tc := range []struct {
+		property string
+		a, b     string
+		expected int
+		ok       bool
+	}{
+		{"", "10", "9", 1, true},
+		{"", "1.5", "1.25", 1, true},
+		{"", "1.2.10", "1.2.9", 1, true},
+		{"", "v2", "v10", -1, true},
+		{"", "abc", "abd", -1, true},
+		{"info.agentVersion", "1.10.0", "1.9", 1, true},
+		{"info.agentVersion", "1.10", "1.10.0", 0, true},
+		{"info.agentVersion", "1.10.0-rc.1", "1.10.0", -1, true},
+		{"info.agentVersion", "1.10.0-rc.2", "1.10.0-rc.10", -1, true},
+		{"info.agentVersion", "1.10.0-alpha", "1.10.0-1", 1, true},
+		{"info.agentVersion", "dev", "1.10", 0, false},
+		{"lastSeenAt", "2020-01-01T11:30:00Z", "now-1h", 1, true},
+		{"lastSeenAt", "2020-01-01T10:30:00Z", "now-1h", -1, true},
+		{"lastSeenAt", "2020-01-01T12:00:00Z", "now", 0, true},
+		{"lastSeenAt", "2020-01-01T12:00:00Z", "tomorrow", 0, false},
+	} {
+		cmp, ok := compareValues(tc.property, tc.a, tc.b, now)
+		require.Equal(t, tc.ok, ok, "%s %s %s", tc.property, tc.a, tc.b)
+		require.Equal(t, tc.expected, cmp, "%s %s %s", tc.property, tc.a, tc.b)
+	}
+}
+
+func TestQueryDevicesExtendedOperators(t *testing.T) {
+	devices := []models.Device{
+		{
+			ID:         "one",
+			Labels:     map[string]string{"site": "hq-1", "floor": "3"},
+			Info:       models.DeviceInfo{AgentVersion: "1.10.2"},
+			LastSeenAt: time.Now(),
+		},
+		{
+			ID:         "two",
+			Labels:     map[string]string{"site": "branch", "floor": "12"},
+			Info:       models.DeviceInfo{AgentVersion: "1.9.0"},
+			LastSeenAt: time.Now().Add(-2 * time.Hour),
+		},
+		{
+			ID: "three",
+		},
+	}
+
+	for expression, expected := range map[string][]string{
+		`agentVersion >= 1.10`:               {"one"},
+		`agentVersion < 1.10`:                {"two"},
+		`labels.floor > 5`:                   {"two"},
+		`labels.site =~ "hq-[0-9]+"`:         {"one"},
+		`labels.site !~ "hq-[0-9]+"`:         {"two", "three"},
+		`labels.site like "b*"`:              {"two"},
+		`labels.site in (branch, other)`:     {"two"},
+		`labels.site not in (branch, other)`: {"one", "three"},
+		`lastSeenAt > now-1h`:                {"one"},
+		`not lastSeenAt > now-1h`:            {"two", "three"},
+	} {
+		query, err := Parse(expression)
+		require.NoError(t, err, expression)
+
+		selected, _, err := QueryDevices(QueryDependencies{}, devices, query)
+		require.NoError(t, err, expression)
+
+		ids := make([]string, 0)
+		for _, device := range selected {
+			ids = append(ids, device.ID)
+		}
+		require.Equal(t, expected, ids, expression)
+	}
+}
@@ -0,0 +1,120 @@
+package query
+
+import (
+	"github.com/deviceplane/deviceplane/pkg/controller/store"
+	"github.com/deviceplane/deviceplane/pkg/models"
+	"github.com/deviceplane/deviceplane/pkg/utils"
+	"github.com/pkg/errors"
+)
+
+// Device groups can refer to other groups, up to this many levels deep
+const maxDeviceGroupDepth = 10
+
+// DeviceGroupFilter returns a filter that matches the devices in a device
+// group.
+func DeviceGroupFilter(deviceGroupID string) models.Filter {
+	return models.Filter{
+		{
+			Type: models.DeviceGroupCondition,
+			Params: map[string]interface{}{
+				"deviceGroupId": deviceGroupID,
+				"operator":      string(models.OperatorIs),
+			},
+		},
+	}
+}
+
+// DeviceGroupReferences returns the IDs of the device groups that a query
+// refers to directly.
+func DeviceGroupReferences(query models.Query) []string {
+	var ids []string
+	for _, filter := range query {
+		for _, condition := range filter {
+			if condition.Type != models.DeviceGroupCondition {
+				continue
+			}
+			var params models.DeviceGroupConditionParams
+			if err := utils.JSONConvert(condition.Params, &params); err != nil {
+				continue
+			}
+			ids = append(ids, params.DeviceGroupID)
+		}
+	}
+	return ids
+}
+
+// ValidateDeviceGroupReferences checks that the device groups that a query
+// refers to, directly or through other groups, exist. If deviceGroupID is
+// set then the query is that group's, and it can't lead back to the group.
+func ValidateDeviceGroupReferences(deviceGroupID string, query models.Query, deviceGroups map[string]models.Query) error {
+	return validateDeviceGroupReferences(deviceGroupID, query, deviceGroups, 0)
+}
+
+func validateDeviceGroupReferences(deviceGroupID string, query models.Query, deviceGroups map[string]models.Query, depth int) error {
+	for _, id := range DeviceGroupReferences(query) {
+		if deviceGroupID != "" && id == deviceGroupID {
+			return ErrDeviceGroupCycle
+		}
+		deviceGroupQuery, exists := deviceGroups[id]
+		if !exists {
+			return errors.Wrap(store.ErrDeviceGroupNotFound, id)
+		}
+		if depth >= maxDeviceGroupDepth {
+			return ErrDeviceGroupTooDeep
+		}
+		if err := validateDeviceGroupReferences(deviceGroupID, deviceGroupQuery, deviceGroups, depth+1); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ExpandDeviceGroups replaces each filter that only requires devices to be in
+// a device group with the group's filters, so that they can be evaluated by
+// the store along with the rest of the query. Other references to groups are
+// left as they are.
+func ExpandDeviceGroups(query models.Query, deviceGroups map[string]models.Query) (models.Query, error) {
+	return expandDeviceGroups(query, deviceGroups, 0)
+}
+
+func expandDeviceGroups(query models.Query, deviceGroups map[string]models.Query, depth int) (models.Query, error) {
+	expanded := make(models.Query, 0, len(query))
+	for _, filter := range query {
+		id, ok := soleDeviceGroup(filter)
+		if !ok {
+			expanded = append(expanded, filter)
+			continue
+		}
+
+		deviceGroupQuery, exists := deviceGroups[id]
+		if !exists {
+			return nil, errors.Wrap(store.ErrDeviceGroupNotFound, id)
+		}
+		if depth >= maxDeviceGroupDepth {
+			return nil, ErrDeviceGroupTooDeep
+		}
+
+		filters, err := expandDeviceGroups(deviceGroupQuery, deviceGroups, depth+1)
+		if err != nil {
+			return nil, err
+		}
+		expanded = append(expanded, filters...)
+	}
+	return expanded, nil
+}
+
+// soleDeviceGroup returns the ID of the device group that a filter requires
+// devices to be in, if that's all the filter does.
+func soleDeviceGroup(filter models.Filter) (string, bool) {
+	if len(filter) != 1 || filter[0].Type != models.DeviceGroupCondition {
+		return "", false
+	}
+	var params models.DeviceGroupConditionParams
+	if err := utils.JSONConvert(filter[0].Params, &params); err != nil {
+		return "", false
+	}
+	if params.Operator != models.OperatorIs {
+		return "", false
+	}
+	return params.DeviceGroupID, true
+}
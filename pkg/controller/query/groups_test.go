@@ -0,0 +1,88 @@
+package query
+
+import (
+	"testing"
+
+	"github.com/deviceplane/deviceplane/pkg/controller/store"
+	"github.com/deviceplane/deviceplane/pkg/models"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/require"
+)
+
+func mustParse(t *testing.T, expression string) models.Query {
+	query, err := Parse(expression)
+	require.NoError(t, err, expression)
+	return query
+}
+
+func TestQueryDevicesDeviceGroups(t *testing.T) {
+	devices := []models.Device{
+		{ID: "one", Labels: map[string]string{"site": "hq", "role": "gateway"}},
+		{ID: "two", Labels: map[string]string{"site": "hq", "role": "sensor"}},
+		{ID: "three", Labels: map[string]string{"site": "branch", "role": "gateway"}},
+	}
+
+	deps := QueryDependencies{
+		DeviceGroups: map[string]models.Query{
+			"dgp_hq":         mustParse(t, `labels.site = hq`),
+			"dgp_hqgateways": mustParse(t, `group = dgp_hq and labels.role = gateway`),
+		},
+	}
+
+	for expression, expected := range map[string][]string{
+		`group = dgp_hq`:         {"one", "two"},
+		`group != dgp_hq`:        {"three"},
+		`group = dgp_hqgateways`: {"one"},
+		`group = dgp_hqgateways or labels.site = branch`: {"one", "three"},
+		`not group = dgp_hq and labels.role = gateway`:   {"three"},
+	} {
+		selected, _, err := QueryDevices(deps, devices, mustParse(t, expression))
+		require.NoError(t, err, expression)
+
+		ids := make([]string, 0)
+		for _, device := range selected {
+			ids = append(ids, device.ID)
+		}
+		require.Equal(t, expected, ids, expression)
+	}
+
+	_, _, err := QueryDevices(deps, devices, mustParse(t, `group = dgp_missing`))
+	require.Equal(t, store.ErrDeviceGroupNotFound, errors.Cause(err))
+}
+
+func TestExpandDeviceGroups(t *testing.T) {
+	deviceGroups := map[string]models.Query{
+		"dgp_hq":         mustParse(t, `labels.site = hq`),
+		"dgp_hqgateways": mustParse(t, `group = dgp_hq and labels.role = gateway`),
+	}
+
+	expanded, err := ExpandDeviceGroups(mustParse(t, `group = dgp_hqgateways and status = online`), deviceGroups)
+	require.NoError(t, err)
+	require.Equal(t, mustParse(t, `labels.site = hq and labels.role = gateway and status = online`), expanded)
+
+	// Groups that aren't required on their own are left for QueryDevices
+	query := mustParse(t, `group = dgp_hq or name = x`)
+	expanded, err = ExpandDeviceGroups(query, deviceGroups)
+	require.NoError(t, err)
+	require.Equal(t, query, expanded)
+
+	_, err = ExpandDeviceGroups(mustParse(t, `group = dgp_missing`), deviceGroups)
+	require.Equal(t, store.ErrDeviceGroupNotFound, errors.Cause(err))
+}
+
+func TestValidateDeviceGroupReferences(t *testing.T) {
+	deviceGroups := map[string]models.Query{
+		"dgp_a": mustParse(t, `labels.a exists`),
+		"dgp_b": mustParse(t, `group = dgp_a`),
+	}
+
+	require.NoError(t, ValidateDeviceGroupReferences("", mustParse(t, `group = dgp_b`), deviceGroups))
+	require.NoError(t, ValidateDeviceGroupReferences("dgp_c", mustParse(t, `group = dgp_b`), deviceGroups))
+
+	err := ValidateDeviceGroupReferences("", mustParse(t, `group = dgp_c`), deviceGroups)
+	require.Equal(t, store.ErrDeviceGroupNotFound, errors.Cause(err))
+
+	// Making dgp_a refer to dgp_b would make them refer to each other
+	err = ValidateDeviceGroupReferences("dgp_a", mustParse(t, `group = dgp_b`), deviceGroups)
+	require.Equal(t, ErrDeviceGroupCycle, err)
+}
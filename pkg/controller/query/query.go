@@ -4,9 +4,12 @@ import (
 	"context"
 	"encoding/base64"
 	"encoding/json"
+	"strconv"
+	"strings"
 
 	"github.com/deviceplane/deviceplane/pkg/controller/store"
 	"github.com/deviceplane/deviceplane/pkg/models"
+	"github.com/deviceplane/deviceplane/pkg/queryparser"
 	"github.com/deviceplane/deviceplane/pkg/utils"
 	"github.com/pkg/errors"
 )
@@ -16,6 +19,11 @@ var (
 	ErrOperatorInvalid     = errors.New("invalid operator")
 	ErrPropertyInvalid     = errors.New("invalid device property")
 	ErrServiceStateInvalid = errors.New("invalid service state")
+	ErrRegexInvalid        = errors.New("invalid regular expression")
+	ErrTimeInvalid         = errors.New("invalid time, use an RFC 3339 timestamp, now, or now-<duration>")
+	ErrVersionInvalid      = errors.New("invalid version")
+	ErrDeviceGroupCycle    = errors.New("device group refers to itself")
+	ErrDeviceGroupTooDeep  = errors.New("device groups are nested too deeply")
 
 	ErrNoEmptyFields = errors.New("fields should not be empty")
 )
@@ -25,6 +33,11 @@ type QueryDependencies struct {
 	DeviceServiceStates       map[string]map[string]map[string]*models.DeviceServiceState
 	Releases                  store.Releases
 	Context                   context.Context
+	// DeviceGroups holds the query of each of the project's device groups,
+	// by ID
+	DeviceGroups map[string]models.Query
+
+	deviceGroupDepth int
 }
 
 func ValidateQuery(query models.Query) error {
@@ -39,6 +52,36 @@ func ValidateQuery(query models.Query) error {
 	return nil
 }
 
+// Parse converts a textual expression into a query, in the syntax described
+// by queryparser.Parse, and validates it.
+func Parse(expression string) (models.Query, error) {
+	query, err := queryparser.Parse(expression)
+	if err != nil {
+		return nil, err
+	}
+	if err := ValidateQuery(query); err != nil {
+		return nil, err
+	}
+	return query, nil
+}
+
+// InvalidQuery returns true if an error from QueryDevices or
+// DeviceMatchesQuery was caused by the query itself, rather than by a failure
+// to load something that the query depends on.
+func InvalidQuery(err error) bool {
+	switch cause := errors.Cause(err); cause {
+	case ErrConditionInvalid, ErrOperatorInvalid, ErrPropertyInvalid,
+		ErrServiceStateInvalid, ErrRegexInvalid, ErrTimeInvalid,
+		ErrVersionInvalid, ErrDeviceGroupCycle, ErrDeviceGroupTooDeep,
+		ErrNoEmptyFields, store.ErrDeviceGroupNotFound:
+		return true
+	default:
+		// Condition params that don't decode
+		_, ok := cause.(*json.UnmarshalTypeError)
+		return ok
+	}
+}
+
 func QueryDevices(deps QueryDependencies, devices []models.Device, query models.Query) (selectedDevices []models.Device, unselectedDevices []models.Device, err error) {
 	selectedDevices = make([]models.Device, 0)
 	unselectedDevices = make([]models.Device, 0)
@@ -97,17 +140,8 @@ func validateCondition(condition models.Condition) error {
 		if params.Property == "" {
 			return ErrNoEmptyFields
 		}
-		if params.Value == "" {
-			return ErrNoEmptyFields
-		}
 
-		switch params.Operator {
-		case models.OperatorIs:
-			return nil
-		case models.OperatorIsNot:
-			return nil
-		}
-		return ErrOperatorInvalid
+		return validateValue(params.Property, params.Operator, params.Value, params.Values)
 
 	case models.LabelValueCondition:
 		var params models.LabelValueConditionParams
@@ -119,17 +153,8 @@ func validateCondition(condition models.Condition) error {
 		if params.Key == "" {
 			return ErrNoEmptyFields
 		}
-		if params.Value == "" {
-			return ErrNoEmptyFields
-		}
 
-		switch params.Operator {
-		case models.OperatorIs:
-			return nil
-		case models.OperatorIsNot:
-			return nil
-		}
-		return ErrOperatorInvalid
+		return validateValue("", params.Operator, params.Value, params.Values)
 
 	case models.LabelExistenceCondition:
 		var params models.LabelExistenceConditionParams
@@ -210,6 +235,25 @@ func validateCondition(condition models.Condition) error {
 			return ErrServiceStateInvalid
 		}
 		return nil
+
+	case models.DeviceGroupCondition:
+		var params models.DeviceGroupConditionParams
+		err := utils.JSONConvert(condition.Params, &params)
+		if err != nil {
+			return err
+		}
+
+		if params.DeviceGroupID == "" {
+			return ErrNoEmptyFields
+		}
+
+		switch params.Operator {
+		case models.OperatorIs:
+			return nil
+		case models.OperatorIsNot:
+			return nil
+		}
+		return ErrOperatorInvalid
 	}
 	return ErrConditionInvalid
 }
@@ -229,19 +273,22 @@ func deviceMatchesCondition(deps QueryDependencies, device models.Device, condit
 			return false, err
 		}
 
-		value, exists := deviceMap[params.Property]
+		path := strings.Split(params.Property, ".")
+		value, exists := deviceMap[path[0]]
 		if !exists {
 			return false, ErrPropertyInvalid
 		}
-
-		match := value == params.Value
-		switch params.Operator {
-		case models.OperatorIs:
-			return match, nil
-		case models.OperatorIsNot:
-			return !match, nil
+		for _, field := range path[1:] {
+			fields, ok := value.(map[string]interface{})
+			if !ok {
+				value = nil
+				break
+			}
+			value = fields[field]
 		}
-		return false, ErrOperatorInvalid
+
+		stringValue, ok := stringifyProperty(value)
+		return matchValue(params.Property, stringValue, ok, params.Operator, params.Value, params.Values)
 
 	case models.LabelValueCondition:
 		var params models.LabelValueConditionParams
@@ -251,15 +298,7 @@ func deviceMatchesCondition(deps QueryDependencies, device models.Device, condit
 		}
 
 		value, ok := device.Labels[params.Key]
-		valueMatches := bool(ok && value == params.Value)
-
-		switch params.Operator {
-		case models.OperatorIs:
-			return valueMatches, nil
-		case models.OperatorIsNot:
-			return !valueMatches, nil
-		}
-		return false, ErrOperatorInvalid
+		return matchValue("", value, ok, params.Operator, params.Value, params.Values)
 
 	case models.LabelExistenceCondition:
 		var params models.LabelExistenceConditionParams
@@ -368,14 +407,72 @@ func deviceMatchesCondition(deps QueryDependencies, device models.Device, condit
 			return deviceServiceState.State != params.ServiceState, nil
 		}
 		return false, ErrOperatorInvalid
+
+	case models.DeviceGroupCondition:
+		var params models.DeviceGroupConditionParams
+		err := utils.JSONConvert(condition.Params, &params)
+		if err != nil {
+			return false, err
+		}
+
+		if params.Operator != models.OperatorIs && params.Operator != models.OperatorIsNot {
+			return false, ErrOperatorInvalid
+		}
+
+		deviceGroupQuery, exists := deps.DeviceGroups[params.DeviceGroupID]
+		if !exists {
+			return false, errors.Wrap(store.ErrDeviceGroupNotFound, params.DeviceGroupID)
+		}
+		if deps.deviceGroupDepth >= maxDeviceGroupDepth {
+			return false, ErrDeviceGroupTooDeep
+		}
+
+		nestedDeps := deps
+		nestedDeps.deviceGroupDepth++
+		match, err := DeviceMatchesQuery(nestedDeps, device, deviceGroupQuery)
+		if err != nil {
+			return false, err
+		}
+
+		if params.Operator == models.OperatorIsNot {
+			return !match, nil
+		}
+		return match, nil
 	}
 	return false, ErrConditionInvalid
 }
 
+// stringifyProperty converts a property from the device's JSON form so that
+// it can be compared with a condition's value. It returns false if the
+// device doesn't have the property set.
+func stringifyProperty(value interface{}) (string, bool) {
+	switch value := value.(type) {
+	case string:
+		return value, true
+	case float64:
+		return strconv.FormatFloat(value, 'f', -1, 64), true
+	case bool:
+		return strconv.FormatBool(value), true
+	}
+	return "", false
+}
+
+// FiltersFromQuery reads filters from URL query parameters. Each "filter" is
+// a base64 encoded JSON filter, and each "q" is an expression in the syntax
+// accepted by Parse.
 func FiltersFromQuery(query map[string][]string) ([]models.Filter, error) {
 	var filters []models.Filter
 
 	for key, values := range query {
+		if key == "q" {
+			for _, expression := range values {
+				parsed, err := Parse(expression)
+				if err != nil {
+					return nil, err
+				}
+				filters = append(filters, parsed...)
+			}
+		}
 		if key == "filter" {
 			for _, encodedFilter := range values {
 				bytes, err := base64.StdEncoding.DecodeString(encodedFilter)
@@ -3,6 +3,7 @@ package query
 import (
 	"encoding/base64"
 	"encoding/json"
+	"errors"
 	"testing"
 
 	"github.com/deviceplane/deviceplane/pkg/models"
@@ -542,3 +543,51 @@ func TestFiltersFromQuery(t *testing.T) {
 	require.Equal(t, filtersA[1], result[0][1])
 	require.Equal(t, filtersB[0], result[1][0])
 }
+
+func TestParseValidates(t *testing.T) {
+	_, err := Parse(`status = online and labels.site =~ "hq-.*"`)
+	require.NoError(t, err)
+
+	for _, expression := range []string{
+		`labels.a =~ "("`,
+		`lastSeenAt > yesterday`,
+		`agentVersion >= latest`,
+		`status = online and`,
+	} {
+		_, err := Parse(expression)
+		require.Error(t, err, expression)
+	}
+}
+
+func TestInvalidQuery(t *testing.T) {
+	devices := []models.Device{{ID: "device"}}
+
+	_, _, err := QueryDevices(QueryDependencies{}, devices, models.Query{
+		{
+			{
+				Type: models.DevicePropertyCondition,
+				Params: map[string]interface{}{
+					"property": "nonexistent",
+					"operator": string(models.OperatorIs),
+					"value":    "value",
+				},
+			},
+		},
+	})
+	require.True(t, InvalidQuery(err))
+
+	_, _, err = QueryDevices(QueryDependencies{}, devices, models.Query{
+		{
+			{
+				Type: models.LabelValueCondition,
+				Params: map[string]interface{}{
+					"key": 1,
+				},
+			},
+		},
+	})
+	require.True(t, InvalidQuery(err))
+
+	require.False(t, InvalidQuery(errors.New("connection refused")))
+	require.False(t, InvalidQuery(nil))
+}
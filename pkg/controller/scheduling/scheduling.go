@@ -37,8 +37,8 @@ func SchedulingRuleFromQuery(query map[string][]string) (*models.SchedulingRule,
 	return &schedulingRule, nil
 }
 
-func IsApplicationScheduled(device models.Device, schedulingRule models.SchedulingRule) (bool, *models.ScheduledDevice, error) {
-	scheduledDevices, err := GetScheduledDevices([]models.Device{device}, schedulingRule)
+func IsApplicationScheduled(deps query.QueryDependencies, device models.Device, schedulingRule models.SchedulingRule) (bool, *models.ScheduledDevice, error) {
+	scheduledDevices, err := GetScheduledDevices(deps, []models.Device{device}, schedulingRule)
 	if err != nil {
 		return false, nil, err
 	}
@@ -48,7 +48,9 @@ func IsApplicationScheduled(device models.Device, schedulingRule models.Scheduli
 	return true, &scheduledDevices[0], nil
 }
 
-func GetScheduledDevices(devices []models.Device, schedulingRule models.SchedulingRule) ([]models.ScheduledDevice, error) {
+// GetScheduledDevices evaluates a scheduling rule against devices. Rules can
+// refer to device groups, which are looked up in deps.
+func GetScheduledDevices(deps query.QueryDependencies, devices []models.Device, schedulingRule models.SchedulingRule) ([]models.ScheduledDevice, error) {
 	var selectedDevices []models.Device
 
 	switch schedulingRule.ScheduleType {
@@ -64,7 +66,7 @@ func GetScheduledDevices(devices []models.Device, schedulingRule models.Scheduli
 		}
 
 		var err error
-		selectedDevices, _, err = query.QueryDevices(query.QueryDependencies{}, devices, *schedulingRule.ConditionalQuery)
+		selectedDevices, _, err = query.QueryDevices(deps, devices, *schedulingRule.ConditionalQuery)
 		if err != nil {
 			return nil, errors.Wrap(err, "filtering by schedule query")
 		}
@@ -81,7 +83,7 @@ func GetScheduledDevices(devices []models.Device, schedulingRule models.Scheduli
 
 	// Go through release selectors
 	for _, releaseSelector := range schedulingRule.ReleaseSelectors {
-		releasePinnedDevices, newSelectedDevices, err := query.QueryDevices(query.QueryDependencies{}, selectedDevices, releaseSelector.Query)
+		releasePinnedDevices, newSelectedDevices, err := query.QueryDevices(deps, selectedDevices, releaseSelector.Query)
 		if err != nil {
 			return nil, errors.Wrap(err, "filtering by release query")
 		}
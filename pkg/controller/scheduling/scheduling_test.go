@@ -3,6 +3,7 @@ package scheduling
 import (
 	"testing"
 
+	"github.com/deviceplane/deviceplane/pkg/controller/query"
 	"github.com/deviceplane/deviceplane/pkg/models"
 	"github.com/stretchr/testify/require"
 )
@@ -15,7 +16,7 @@ type Scenario struct {
 
 func testScenario(t *testing.T, scenario Scenario) {
 	t.Helper()
-	scheduledDevices, err := GetScheduledDevices(scenario.in, scenario.schedulingRule)
+	scheduledDevices, err := GetScheduledDevices(query.QueryDependencies{}, scenario.in, scenario.schedulingRule)
 	require.NoError(t, err)
 	require.Equal(t, scenario.out, scheduledDevices)
 }
@@ -552,7 +553,7 @@ func TestIndividualDeviceScheduling(t *testing.T) {
 	}
 
 	testIndividualScheduling := func(t *testing.T, d models.Device, sr models.SchedulingRule, is bool, sd *models.ScheduledDevice, err error) {
-		isSched, scheduledDevice, schedErr := IsApplicationScheduled(d, sr)
+		isSched, scheduledDevice, schedErr := IsApplicationScheduled(query.QueryDependencies{}, d, sr)
 		require.Equal(t, is, isSched, "is scheduled")
 		if sd != nil && scheduledDevice != nil {
 			require.Equal(t, *sd, *scheduledDevice, "scheduled device")
@@ -0,0 +1,519 @@
+package service
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/apex/log"
+	"github.com/deviceplane/deviceplane/pkg/agent/service/client"
+	"github.com/deviceplane/deviceplane/pkg/controller/authz"
+	"github.com/deviceplane/deviceplane/pkg/controller/query"
+	"github.com/deviceplane/deviceplane/pkg/controller/store"
+	"github.com/deviceplane/deviceplane/pkg/models"
+	"github.com/deviceplane/deviceplane/pkg/utils"
+	"github.com/deviceplane/deviceplane/pkg/validator"
+	"github.com/pkg/errors"
+)
+
+const (
+	bulkConcurrency   = 20
+	bulkRebootTimeout = 30 * time.Second
+
+	// Operations on more devices than this run in the background as a job
+	bulkSyncDeviceLimit = 100
+	// bulkSyncTimeout bounds operations that are run during the request.
+	// They don't stop if the client disconnects, so that devices aren't left
+	// half updated.
+	bulkSyncTimeout = 5 * time.Minute
+)
+
+var (
+	errBulkDevicesRequired        = errors.New("a query or device IDs are required")
+	errUnknownBulkDeviceOperation = errors.New("unknown bulk device operation")
+	errBulkDeviceForbidden        = errors.New("the operation isn't allowed on this device")
+	errBulkDevicesForbidden       = errors.New("the operation isn't allowed on some of the selected devices")
+)
+
+type bulkDeviceAuthorization struct {
+	resource authz.Resource
+	action   authz.Action
+}
+
+// bulkDeviceAuthorizations are what each operation is authorized as. Bulk
+// routes don't name a device, so these are also evaluated for each selected
+// device to apply device scoped rules.
+var bulkDeviceAuthorizations = map[models.BulkDeviceOperation]bulkDeviceAuthorization{
+	models.BulkDeviceOperationSetLabel:                  {authz.ResourceDeviceLabels, authz.ActionSetDeviceLabel},
+	models.BulkDeviceOperationDeleteLabel:               {authz.ResourceDeviceLabels, authz.ActionDeleteDeviceLabel},
+	models.BulkDeviceOperationSetEnvironmentVariable:    {authz.ResourceDeviceEnvironmentVariables, authz.ActionSetDeviceEnvironmentVariable},
+	models.BulkDeviceOperationDeleteEnvironmentVariable: {authz.ResourceDeviceEnvironmentVariables, authz.ActionDeleteDeviceEnvironmentVariable},
+	models.BulkDeviceOperationReboot:                    {authz.ResourceDevices, authz.ActionReboot},
+	models.BulkDeviceOperationDelete:                    {authz.ResourceDevices, authz.ActionDeleteDevice},
+}
+
+// bulkDeviceFunc applies an operation to one device.
+type bulkDeviceFunc func(ctx context.Context, project *models.Project, device models.Device) error
+
+// bulkDeviceFunc returns the function that applies an operation to each
+// device. Keys and values are validated by the handlers.
+func (s *Service) bulkDeviceFunc(operation models.BulkDeviceOperation, key, value string) (bulkDeviceFunc, error) {
+	switch operation {
+	case models.BulkDeviceOperationSetLabel:
+		return func(ctx context.Context, project *models.Project, device models.Device) error {
+			_, err := s.devices.SetDeviceLabel(ctx, device.ID, project.ID, key, value)
+			return err
+		}, nil
+	case models.BulkDeviceOperationDeleteLabel:
+		return func(ctx context.Context, project *models.Project, device models.Device) error {
+			return s.devices.DeleteDeviceLabel(ctx, device.ID, project.ID, key)
+		}, nil
+	case models.BulkDeviceOperationSetEnvironmentVariable:
+		return func(ctx context.Context, project *models.Project, device models.Device) error {
+			_, err := s.devices.SetDeviceEnvironmentVariable(ctx, device.ID, project.ID, key, value)
+			return err
+		}, nil
+	case models.BulkDeviceOperationDeleteEnvironmentVariable:
+		return func(ctx context.Context, project *models.Project, device models.Device) error {
+			return s.devices.DeleteDeviceEnvironmentVariable(ctx, device.ID, project.ID, key)
+		}, nil
+	case models.BulkDeviceOperationReboot:
+		return s.rebootDevice, nil
+	case models.BulkDeviceOperationDelete:
+		return func(ctx context.Context, project *models.Project, device models.Device) error {
+			return s.devices.DeleteDevice(ctx, device.ID, project.ID)
+		}, nil
+	}
+	return nil, errUnknownBulkDeviceOperation
+}
+
+func (s *Service) bulkSetDeviceLabel(w http.ResponseWriter, r *http.Request) {
+	s.withUserOrServiceAccountAuth(w, r, func(user *models.User, serviceAccount *models.ServiceAccount) {
+		s.validateAuthorization(
+			authz.ResourceDeviceLabels, authz.ActionSetDeviceLabel,
+			w, r,
+			user, serviceAccount,
+			func(project *models.Project) {
+				s.withBulkDeviceRequest(w, r, func(req models.BulkDeviceRequest) {
+					if err := validator.Validate(struct {
+						Key   string `validate:"labelkey"`
+						Value string `validate:"labelvalue"`
+					}{req.Key, req.Value}); err != nil {
+						http.Error(w, err.Error(), http.StatusBadRequest)
+						return
+					}
+
+					s.runBulkDeviceOperation(w, r, project, user, serviceAccount, req, models.BulkDeviceOperationSetLabel)
+				})
+			},
+		)
+	})
+}
+
+func (s *Service) bulkDeleteDeviceLabel(w http.ResponseWriter, r *http.Request) {
+	s.withUserOrServiceAccountAuth(w, r, func(user *models.User, serviceAccount *models.ServiceAccount) {
+		s.validateAuthorization(
+			authz.ResourceDeviceLabels, authz.ActionDeleteDeviceLabel,
+			w, r,
+			user, serviceAccount,
+			func(project *models.Project) {
+				s.withBulkDeviceRequest(w, r, func(req models.BulkDeviceRequest) {
+					if err := validator.Validate(struct {
+						Key string `validate:"labelkey"`
+					}{req.Key}); err != nil {
+						http.Error(w, err.Error(), http.StatusBadRequest)
+						return
+					}
+
+					s.runBulkDeviceOperation(w, r, project, user, serviceAccount, req, models.BulkDeviceOperationDeleteLabel)
+				})
+			},
+		)
+	})
+}
+
+func (s *Service) bulkSetDeviceEnvironmentVariable(w http.ResponseWriter, r *http.Request) {
+	s.withUserOrServiceAccountAuth(w, r, func(user *models.User, serviceAccount *models.ServiceAccount) {
+		s.validateAuthorization(
+			authz.ResourceDeviceEnvironmentVariables, authz.ActionSetDeviceEnvironmentVariable,
+			w, r,
+			user, serviceAccount,
+			func(project *models.Project) {
+				s.withBulkDeviceRequest(w, r, func(req models.BulkDeviceRequest) {
+					if err := validator.Validate(struct {
+						Key   string `validate:"environmentvariablekey"`
+						Value string `validate:"environmentvariablevalue"`
+					}{req.Key, req.Value}); err != nil {
+						http.Error(w, err.Error(), http.StatusBadRequest)
+						return
+					}
+
+					s.runBulkDeviceOperation(w, r, project, user, serviceAccount, req, models.BulkDeviceOperationSetEnvironmentVariable)
+				})
+			},
+		)
+	})
+}
+
+func (s *Service) bulkDeleteDeviceEnvironmentVariable(w http.ResponseWriter, r *http.Request) {
+	s.withUserOrServiceAccountAuth(w, r, func(user *models.User, serviceAccount *models.ServiceAccount) {
+		s.validateAuthorization(
+			authz.ResourceDeviceEnvironmentVariables, authz.ActionDeleteDeviceEnvironmentVariable,
+			w, r,
+			user, serviceAccount,
+			func(project *models.Project) {
+				s.withBulkDeviceRequest(w, r, func(req models.BulkDeviceRequest) {
+					if err := validator.Validate(struct {
+						Key string `validate:"environmentvariablekey"`
+					}{req.Key}); err != nil {
+						http.Error(w, err.Error(), http.StatusBadRequest)
+						return
+					}
+
+					s.runBulkDeviceOperation(w, r, project, user, serviceAccount, req, models.BulkDeviceOperationDeleteEnvironmentVariable)
+				})
+			},
+		)
+	})
+}
+
+func (s *Service) bulkReboot(w http.ResponseWriter, r *http.Request) {
+	s.withUserOrServiceAccountAuth(w, r, func(user *models.User, serviceAccount *models.ServiceAccount) {
+		s.validateAuthorization(
+			authz.ResourceDevices, authz.ActionReboot,
+			w, r,
+			user, serviceAccount,
+			func(project *models.Project) {
+				s.withBulkDeviceRequest(w, r, func(req models.BulkDeviceRequest) {
+					s.runBulkDeviceOperation(w, r, project, user, serviceAccount, req, models.BulkDeviceOperationReboot)
+				})
+			},
+		)
+	})
+}
+
+func (s *Service) bulkDeleteDevices(w http.ResponseWriter, r *http.Request) {
+	s.withUserOrServiceAccountAuth(w, r, func(user *models.User, serviceAccount *models.ServiceAccount) {
+		s.validateAuthorization(
+			authz.ResourceDevices, authz.ActionDeleteDevice,
+			w, r,
+			user, serviceAccount,
+			func(project *models.Project) {
+				s.withBulkDeviceRequest(w, r, func(req models.BulkDeviceRequest) {
+					s.runBulkDeviceOperation(w, r, project, user, serviceAccount, req, models.BulkDeviceOperationDelete)
+				})
+			},
+		)
+	})
+}
+
+func (s *Service) withBulkDeviceRequest(w http.ResponseWriter, r *http.Request, f func(req models.BulkDeviceRequest)) {
+	var req models.BulkDeviceRequest
+	if err := read(r, &req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if req.Query == nil && len(req.DeviceIDs) == 0 {
+		http.Error(w, errBulkDevicesRequired.Error(), http.StatusBadRequest)
+		return
+	}
+	if req.Query != nil {
+		if err := query.ValidateQuery(*req.Query); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+
+	f(req)
+}
+
+// runBulkDeviceOperation applies an operation to the devices that a request
+// selects. It fails if the operation isn't allowed on any of them. With
+// "dryrun" it only responds with the devices that would be changed.
+// Operations on many devices, or with "async", are run by the job runner and
+// respond with the job, which has the result for each device.
+func (s *Service) runBulkDeviceOperation(w http.ResponseWriter, r *http.Request, project *models.Project,
+	user *models.User, serviceAccount *models.ServiceAccount,
+	req models.BulkDeviceRequest, operation models.BulkDeviceOperation) {
+	f, err := s.bulkDeviceFunc(operation, req.Key, req.Value)
+	if err != nil {
+		log.WithError(err).Error("bulk device operation")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	devices, validationErr, err := s.selectBulkDevices(r.Context(), project.ID, req)
+	if validationErr != nil {
+		http.Error(w, validationErr.Error(), http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		log.WithError(err).Error("select bulk devices")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	authorizationConfigs, err := s.getAuthorizationConfigs(r.Context(), project, user, serviceAccount)
+	if err != nil {
+		log.WithError(err).Error("get authorization configs")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	authorization := bulkDeviceAuthorizations[operation]
+	for _, device := range devices {
+		if !authorizationConfigs.evaluateDevice(authorization.resource, authorization.action, device) {
+			http.Error(w, errBulkDevicesForbidden.Error(), http.StatusForbidden)
+			return
+		}
+	}
+
+	if _, ok := r.URL.Query()["dryrun"]; ok {
+		deviceIDs := make([]string, len(devices))
+		for i, device := range devices {
+			deviceIDs[i] = device.ID
+		}
+
+		utils.Respond(w, models.BulkDeviceResponse{
+			MatchingCount: len(devices),
+			DeviceIDs:     deviceIDs,
+		})
+		return
+	}
+
+	if _, ok := r.URL.Query()["async"]; ok || len(devices) > bulkSyncDeviceLimit {
+		items := make([]models.JobItem, len(devices))
+		for i, device := range devices {
+			items[i] = models.JobItem{
+				ItemID: device.ID,
+				Name:   device.Name,
+			}
+		}
+
+		// Items are authorized again as whoever created the job, since
+		// devices and roles can change before the job gets to them
+		params := map[string]interface{}{
+			"operation": string(operation),
+			"key":       req.Key,
+			"value":     req.Value,
+		}
+		var accessKeyConfig *string
+		if user != nil {
+			params["userId"] = user.ID
+			accessKeyConfig = user.AccessKeyConfig
+		} else {
+			params["serviceAccountId"] = serviceAccount.ID
+			accessKeyConfig = serviceAccount.AccessKeyConfig
+		}
+		if accessKeyConfig != nil {
+			params["accessKeyConfig"] = *accessKeyConfig
+		}
+
+		job, err := s.jobs.CreateJob(r.Context(), project.ID, models.JobTypeBulkDeviceOperation, params, items)
+		if err != nil {
+			log.WithError(err).Error("create bulk device job")
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		s.jobRunner.Notify()
+
+		utils.Respond(w, models.BulkDeviceResponse{
+			MatchingCount: len(devices),
+			JobID:         job.ID,
+		})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), bulkSyncTimeout)
+	defer cancel()
+
+	results := make([]models.BulkDeviceResult, len(devices))
+	s.applyBulkDeviceOperation(ctx, project, devices, f, func(i int, result models.BulkDeviceResult) {
+		results[i] = result
+	})
+
+	utils.Respond(w, models.BulkDeviceResponse{
+		MatchingCount: len(devices),
+		Results:       results,
+	})
+}
+
+// selectBulkDevices returns the devices that match a bulk request's query
+// and IDs.
+func (s *Service) selectBulkDevices(ctx context.Context, projectID string, req models.BulkDeviceRequest) (
+	devices []models.Device, validationErr error, err error,
+) {
+	var filters models.Query
+	if req.Query != nil {
+		filters = append(filters, *req.Query...)
+	}
+	if len(req.DeviceIDs) != 0 {
+		filters = append(filters, models.Filter{
+			{
+				Type: models.DevicePropertyCondition,
+				Params: map[string]interface{}{
+					"property": "id",
+					"operator": string(models.OperatorIn),
+					"values":   req.DeviceIDs,
+				},
+			},
+		})
+	}
+
+	filters, validationErr, err = s.expandDeviceGroups(ctx, projectID, filters)
+	if validationErr != nil || err != nil {
+		return nil, validationErr, err
+	}
+
+	page, err := s.devices.QueryDevices(ctx, projectID, store.DeviceQuery{
+		Filters: filters,
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	devices, validationErr, err = s.applyUnappliedFilters(ctx, projectID, page)
+	if validationErr != nil {
+		return nil, errors.Wrap(validationErr, "filter devices"), nil
+	}
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "filter devices")
+	}
+	return devices, nil, nil
+}
+
+// applyBulkDeviceOperation applies an operation to devices concurrently and
+// reports the result for each one, by its index, as it completes.
+func (s *Service) applyBulkDeviceOperation(ctx context.Context, project *models.Project, devices []models.Device,
+	f bulkDeviceFunc, report func(i int, result models.BulkDeviceResult)) {
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, bulkConcurrency)
+	for i, device := range devices {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(i int, device models.Device) {
+			defer wg.Done()
+			defer func() { <-sem }()
+
+			result := models.BulkDeviceResult{
+				DeviceID:   device.ID,
+				DeviceName: device.Name,
+			}
+			if err := f(ctx, project, device); err != nil {
+				result.Error = err.Error()
+			}
+			report(i, result)
+		}(i, device)
+	}
+	wg.Wait()
+}
+
+// runBulkDeviceJobItem applies a bulk operation that's run by the job runner
+// to one device. The device is fetched and authorized again since it, or the
+// job creator's roles, may have changed while the job was pending.
+func (s *Service) runBulkDeviceJobItem(ctx context.Context, job models.Job, item models.JobItem) error {
+	operation, _ := job.Params["operation"].(string)
+	key, _ := job.Params["key"].(string)
+	value, _ := job.Params["value"].(string)
+
+	f, err := s.bulkDeviceFunc(models.BulkDeviceOperation(operation), key, value)
+	if err != nil {
+		return err
+	}
+
+	project, err := s.projects.GetProject(ctx, job.ProjectID)
+	if err != nil {
+		return err
+	}
+
+	device, err := s.devices.GetDevice(ctx, item.ItemID, job.ProjectID)
+	if err == store.ErrDeviceNotFound && models.BulkDeviceOperation(operation) == models.BulkDeviceOperationDelete {
+		// Items can be applied more than once
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	authorizationConfigs, err := s.getBulkDeviceJobAuthorizationConfigs(ctx, project, job)
+	if err != nil {
+		return err
+	}
+	authorization := bulkDeviceAuthorizations[models.BulkDeviceOperation(operation)]
+	if !authorizationConfigs.evaluateDevice(authorization.resource, authorization.action, *device) {
+		return errBulkDeviceForbidden
+	}
+
+	return f(ctx, project, *device)
+}
+
+// getBulkDeviceJobAuthorizationConfigs returns the configs of the user or
+// service account that created a bulk device job, including the config of
+// the access key they used.
+func (s *Service) getBulkDeviceJobAuthorizationConfigs(ctx context.Context, project *models.Project, job models.Job) (*authorizationConfigs, error) {
+	var accessKeyConfig *string
+	if config, ok := job.Params["accessKeyConfig"].(string); ok {
+		accessKeyConfig = &config
+	}
+
+	var user *models.User
+	var serviceAccount *models.ServiceAccount
+	if userID, ok := job.Params["userId"].(string); ok {
+		var err error
+		user, err = s.users.GetUser(ctx, userID)
+		if err == store.ErrUserNotFound {
+			return nil, errBulkDeviceForbidden
+		} else if err != nil {
+			return nil, err
+		}
+		user.AccessKeyConfig = accessKeyConfig
+	} else if serviceAccountID, ok := job.Params["serviceAccountId"].(string); ok {
+		var err error
+		serviceAccount, err = s.serviceAccounts.GetServiceAccount(ctx, serviceAccountID, project.ID)
+		if err == store.ErrServiceAccountNotFound {
+			return nil, errBulkDeviceForbidden
+		} else if err != nil {
+			return nil, err
+		}
+		serviceAccount.AccessKeyConfig = accessKeyConfig
+	} else {
+		return nil, errBulkDeviceForbidden
+	}
+
+	authorizationConfigs, err := s.getAuthorizationConfigs(ctx, project, user, serviceAccount)
+	if err == store.ErrMembershipNotFound || err == store.ErrServiceAccountNotFound {
+		return nil, errBulkDeviceForbidden
+	} else if err != nil {
+		return nil, err
+	}
+	return authorizationConfigs, nil
+}
+
+func (s *Service) rebootDevice(ctx context.Context, project *models.Project, device models.Device) error {
+	ctx, cancel := context.WithTimeout(ctx, bulkRebootTimeout)
+	defer cancel()
+
+	deviceConn, err := s.connman.Dial(ctx, project.ID+device.ID)
+	if err != nil {
+		return err
+	}
+	defer deviceConn.Close()
+
+	// Reads from the connection don't observe the context, so close it
+	// when the timeout expires to unblock them
+	go func() {
+		<-ctx.Done()
+		deviceConn.Close()
+	}()
+
+	resp, err := client.Reboot(ctx, deviceConn)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return errors.Errorf("device responded with %s", resp.Status)
+	}
+	return nil
+}
@@ -0,0 +1,170 @@
+package service
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/deviceplane/deviceplane/pkg/controller/store"
+	"github.com/deviceplane/deviceplane/pkg/models"
+	"github.com/stretchr/testify/require"
+)
+
+// devLabelsRole can only set labels on devices labeled env=dev
+const devLabelsRole = `
+rules:
+- resources: [devicelabels]
+  actions: [SetDeviceLabel]
+  labelSelector:
+    env: dev
+`
+
+type fakeBulkDevices struct {
+	store.Devices
+
+	lock    sync.Mutex
+	devices []models.Device
+	labeled []string
+}
+
+// QueryDevices only supports the device ID filter that bulk requests use
+func (f *fakeBulkDevices) QueryDevices(ctx context.Context, projectID string, deviceQuery store.DeviceQuery) (*store.DevicePage, error) {
+	deviceIDs := deviceQuery.Filters[0][0].Params["values"].([]string)
+
+	var devices []models.Device
+	for _, device := range f.devices {
+		for _, deviceID := range deviceIDs {
+			if device.ID == deviceID {
+				devices = append(devices, device)
+			}
+		}
+	}
+	return &store.DevicePage{Devices: devices}, nil
+}
+
+func (f *fakeBulkDevices) GetDevice(ctx context.Context, id, projectID string) (*models.Device, error) {
+	for _, device := range f.devices {
+		if device.ID == id {
+			return &device, nil
+		}
+	}
+	return nil, store.ErrDeviceNotFound
+}
+
+func (f *fakeBulkDevices) SetDeviceLabel(ctx context.Context, deviceID, projectID, key, value string) (*string, error) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	f.labeled = append(f.labeled, deviceID)
+	return &value, nil
+}
+
+type fakeBulkProjects struct {
+	store.Projects
+}
+
+func (f *fakeBulkProjects) GetProject(ctx context.Context, id string) (*models.Project, error) {
+	return &models.Project{ID: id}, nil
+}
+
+type fakeBulkServiceAccounts struct {
+	store.ServiceAccounts
+}
+
+func (f *fakeBulkServiceAccounts) GetServiceAccount(ctx context.Context, id, projectID string) (*models.ServiceAccount, error) {
+	return &models.ServiceAccount{ID: id, ProjectID: projectID}, nil
+}
+
+type fakeBulkServiceAccountRoleBindings struct {
+	store.ServiceAccountRoleBindings
+}
+
+func (f *fakeBulkServiceAccountRoleBindings) ListServiceAccountRoleBindings(ctx context.Context, serviceAccountID, projectID string) ([]models.ServiceAccountRoleBinding, error) {
+	return []models.ServiceAccountRoleBinding{
+		{ServiceAccountID: serviceAccountID, RoleID: "role", ProjectID: projectID},
+	}, nil
+}
+
+type fakeBulkRoles struct {
+	store.Roles
+}
+
+func (f *fakeBulkRoles) GetRole(ctx context.Context, id, projectID string) (*models.Role, error) {
+	return &models.Role{ID: id, ProjectID: projectID, Config: devLabelsRole}, nil
+}
+
+func newBulkTestService() (*Service, *fakeBulkDevices) {
+	devices := &fakeBulkDevices{
+		devices: []models.Device{
+			{ID: "dev1", Name: "dev1", Labels: map[string]string{"env": "dev"}},
+			{ID: "dev2", Name: "dev2", Labels: map[string]string{"env": "dev"}},
+			{ID: "prod1", Name: "prod1", Labels: map[string]string{"env": "prod"}},
+		},
+	}
+	return &Service{
+		projects:                   &fakeBulkProjects{},
+		devices:                    devices,
+		serviceAccounts:            &fakeBulkServiceAccounts{},
+		serviceAccountRoleBindings: &fakeBulkServiceAccountRoleBindings{},
+		roles:                      &fakeBulkRoles{},
+	}, devices
+}
+
+func TestRunBulkDeviceOperationAuthorization(t *testing.T) {
+	project := &models.Project{ID: "project"}
+	serviceAccount := &models.ServiceAccount{ID: "serviceaccount", ProjectID: project.ID}
+
+	for _, scenario := range []struct {
+		name      string
+		deviceIDs []string
+		status    int
+		labeled   []string
+	}{
+		{
+			name:      "allowed on every device",
+			deviceIDs: []string{"dev1", "dev2"},
+			status:    http.StatusOK,
+			labeled:   []string{"dev1", "dev2"},
+		},
+		{
+			name:      "denied on one device",
+			deviceIDs: []string{"dev1", "prod1"},
+			status:    http.StatusForbidden,
+		},
+	} {
+		t.Run(scenario.name, func(t *testing.T) {
+			s, devices := newBulkTestService()
+
+			w := httptest.NewRecorder()
+			r := httptest.NewRequest(http.MethodPost, "/", nil)
+			s.runBulkDeviceOperation(w, r, project, nil, serviceAccount, models.BulkDeviceRequest{
+				DeviceIDs: scenario.deviceIDs,
+				Key:       "key",
+				Value:     "value",
+			}, models.BulkDeviceOperationSetLabel)
+
+			require.Equal(t, scenario.status, w.Code)
+			require.ElementsMatch(t, scenario.labeled, devices.labeled)
+		})
+	}
+}
+
+func TestRunBulkDeviceJobItemAuthorization(t *testing.T) {
+	s, devices := newBulkTestService()
+	job := models.Job{
+		ID:        "job",
+		ProjectID: "project",
+		Params: map[string]interface{}{
+			"operation":        string(models.BulkDeviceOperationSetLabel),
+			"key":              "key",
+			"value":            "value",
+			"serviceAccountId": "serviceaccount",
+		},
+	}
+
+	require.NoError(t, s.runBulkDeviceJobItem(context.Background(), job, models.JobItem{ItemID: "dev1"}))
+	require.Equal(t, errBulkDeviceForbidden, s.runBulkDeviceJobItem(context.Background(), job, models.JobItem{ItemID: "prod1"}))
+	require.Equal(t, []string{"dev1"}, devices.labeled)
+}
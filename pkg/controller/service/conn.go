@@ -5,6 +5,7 @@ import (
 	"io"
 	"net"
 	"net/http"
+	"strconv"
 	"strings"
 	"sync/atomic"
 
@@ -89,7 +90,10 @@ func (s *Service) connectTCP(w http.ResponseWriter, r *http.Request) {
 			func(project *models.Project) {
 				s.withDevice(w, r, project, func(device *models.Device) {
 					s.withConnection(w, r, project, func(connection *models.Connection) {
-						if connection.Protocol != models.ProtocolTCP {
+						// HTTP connections are only forwarded as raw TCP when the
+						// client asks for it
+						_, raw := r.URL.Query()["raw"]
+						if connection.Protocol != models.ProtocolTCP && !(raw && connection.Protocol == models.ProtocolHTTP) {
 							http.Error(w, errProtocolMismatch.Error(), http.StatusBadRequest)
 							return
 						}
@@ -113,6 +117,71 @@ func (s *Service) connectTCP(w http.ResponseWriter, r *http.Request) {
 	})
 }
 
+func (s *Service) connectPort(w http.ResponseWriter, r *http.Request) {
+	s.withUserOrServiceAccountAuth(w, r, func(user *models.User, serviceAccount *models.ServiceAccount) {
+		s.validateAuthorization(
+			authz.ResourceDevices, authz.ActionConnectPort,
+			w, r,
+			user, serviceAccount,
+			func(project *models.Project) {
+				s.withDevice(w, r, project, func(device *models.Device) {
+					withPort(w, r, func(port uint) {
+						s.proxyDeviceConnection(w, r, project, device, func(deviceConn net.Conn) error {
+							return client.ConnectTCP(r.Context(), deviceConn, port)
+						})
+					})
+				})
+			},
+		)
+	})
+}
+
+func (s *Service) connectServicePort(w http.ResponseWriter, r *http.Request) {
+	s.withUserOrServiceAccountAuth(w, r, func(user *models.User, serviceAccount *models.ServiceAccount) {
+		s.validateAuthorization(
+			authz.ResourceDevices, authz.ActionConnectPort,
+			w, r,
+			user, serviceAccount,
+			func(project *models.Project) {
+				s.withDevice(w, r, project, func(device *models.Device) {
+					s.withApplication(w, r, project, func(application *models.Application) {
+						withPort(w, r, func(port uint) {
+							service := mux.Vars(r)["service"]
+							s.proxyDeviceConnection(w, r, project, device, func(deviceConn net.Conn) error {
+								return client.ConnectServiceTCP(r.Context(), deviceConn, application.ID, service, port)
+							})
+						})
+					})
+				})
+			},
+		)
+	})
+}
+
+func (s *Service) proxyDeviceConnection(w http.ResponseWriter, r *http.Request, project *models.Project, device *models.Device, connect func(deviceConn net.Conn) error) {
+	s.withHijackedWebSocketConnection(w, r, func(clientConn net.Conn) {
+		s.withDeviceConnection(w, r, project, device, func(deviceConn net.Conn) {
+			if err := connect(deviceConn); err != nil {
+				http.Error(w, err.Error(), codes.StatusDeviceConnectionFailure)
+				return
+			}
+
+			go io.Copy(deviceConn, clientConn)
+			io.Copy(clientConn, deviceConn)
+		})
+	})
+}
+
+func withPort(w http.ResponseWriter, r *http.Request, f func(port uint)) {
+	port, err := strconv.ParseUint(mux.Vars(r)["port"], 10, 16)
+	if err != nil || port == 0 {
+		http.Error(w, "invalid port", http.StatusBadRequest)
+		return
+	}
+
+	f(uint(port))
+}
+
 func (s *Service) reboot(w http.ResponseWriter, r *http.Request) {
 	s.withUserOrServiceAccountAuth(w, r, func(user *models.User, serviceAccount *models.ServiceAccount) {
 		s.validateAuthorization(
@@ -0,0 +1,149 @@
+package service
+
+import (
+	"net/http"
+
+	"github.com/apex/log"
+	"github.com/deviceplane/deviceplane/pkg/controller/authz"
+	"github.com/deviceplane/deviceplane/pkg/controller/store"
+	"github.com/deviceplane/deviceplane/pkg/hash"
+	"github.com/deviceplane/deviceplane/pkg/models"
+	"github.com/deviceplane/deviceplane/pkg/utils"
+	"github.com/gorilla/mux"
+	"github.com/pkg/errors"
+	"github.com/segmentio/ksuid"
+)
+
+var errCertificateRotation = errors.New("devices that authenticate with a certificate can't rotate access keys")
+
+func (s *Service) listDeviceAccessKeys(w http.ResponseWriter, r *http.Request) {
+	s.withUserOrServiceAccountAuth(w, r, func(user *models.User, serviceAccount *models.ServiceAccount) {
+		s.validateAuthorization(
+			authz.ResourceDeviceAccessKeys, authz.ActionListDeviceAccessKeys,
+			w, r,
+			user, serviceAccount,
+			func(project *models.Project) {
+				s.withDevice(w, r, project, func(device *models.Device) {
+					deviceAccessKeys, err := s.deviceAccessKeys.ListDeviceAccessKeys(r.Context(), project.ID, device.ID)
+					if err != nil {
+						log.WithError(err).Error("list device access keys")
+						w.WriteHeader(http.StatusInternalServerError)
+						return
+					}
+
+					utils.Respond(w, deviceAccessKeys)
+				})
+			},
+		)
+	})
+}
+
+func (s *Service) revokeDeviceAccessKey(w http.ResponseWriter, r *http.Request) {
+	s.withUserOrServiceAccountAuth(w, r, func(user *models.User, serviceAccount *models.ServiceAccount) {
+		s.validateAuthorization(
+			authz.ResourceDeviceAccessKeys, authz.ActionRevokeDeviceAccessKey,
+			w, r,
+			user, serviceAccount,
+			func(project *models.Project) {
+				s.withDevice(w, r, project, func(device *models.Device) {
+					deviceAccessKey, err := s.deviceAccessKeys.GetDeviceAccessKey(r.Context(),
+						mux.Vars(r)["deviceaccesskey"], project.ID)
+					if err == store.ErrDeviceAccessKeyNotFound {
+						http.Error(w, err.Error(), http.StatusNotFound)
+						return
+					} else if err != nil {
+						log.WithError(err).Error("get device access key")
+						w.WriteHeader(http.StatusInternalServerError)
+						return
+					}
+					if deviceAccessKey.DeviceID != device.ID {
+						http.Error(w, store.ErrDeviceAccessKeyNotFound.Error(), http.StatusNotFound)
+						return
+					}
+
+					if err := s.deviceAccessKeys.RevokeDeviceAccessKey(r.Context(), deviceAccessKey.ID, project.ID); err != nil {
+						log.WithError(err).Error("revoke device access key")
+						w.WriteHeader(http.StatusInternalServerError)
+						return
+					}
+				})
+			},
+		)
+	})
+}
+
+// revokeDeviceAccessKeys revokes every key of the device, leaving it unable
+// to reach the controller until it's registered again.
+func (s *Service) revokeDeviceAccessKeys(w http.ResponseWriter, r *http.Request) {
+	s.withUserOrServiceAccountAuth(w, r, func(user *models.User, serviceAccount *models.ServiceAccount) {
+		s.validateAuthorization(
+			authz.ResourceDeviceAccessKeys, authz.ActionRevokeDeviceAccessKey,
+			w, r,
+			user, serviceAccount,
+			func(project *models.Project) {
+				s.withDevice(w, r, project, func(device *models.Device) {
+					if err := s.deviceAccessKeys.RevokeDeviceAccessKeys(r.Context(), project.ID, device.ID); err != nil {
+						log.WithError(err).Error("revoke device access keys")
+						w.WriteHeader(http.StatusInternalServerError)
+						return
+					}
+				})
+			},
+		)
+	})
+}
+
+func (s *Service) setDeviceQuarantine(w http.ResponseWriter, r *http.Request) {
+	s.withUserOrServiceAccountAuth(w, r, func(user *models.User, serviceAccount *models.ServiceAccount) {
+		s.validateAuthorization(
+			authz.ResourceDevices, authz.ActionQuarantineDevice,
+			w, r,
+			user, serviceAccount,
+			func(project *models.Project) {
+				s.withDevice(w, r, project, func(device *models.Device) {
+					var setDeviceQuarantineRequest struct {
+						Quarantined bool `json:"quarantined"`
+					}
+					if err := read(r, &setDeviceQuarantineRequest); err != nil {
+						http.Error(w, err.Error(), http.StatusBadRequest)
+						return
+					}
+
+					d, err := s.devices.SetDeviceQuarantined(r.Context(), device.ID, project.ID,
+						setDeviceQuarantineRequest.Quarantined)
+					if err != nil {
+						log.WithError(err).Error("set device quarantined")
+						w.WriteHeader(http.StatusInternalServerError)
+						return
+					}
+
+					utils.Respond(w, d)
+				})
+			},
+		)
+	})
+}
+
+// rotateDeviceAccessKey gives the device a new access key. The key used to
+// make the request keeps working until the new one is first used.
+func (s *Service) rotateDeviceAccessKey(w http.ResponseWriter, r *http.Request) {
+	s.withDeviceAccessKeyAuth(w, r, func(project *models.Project, device *models.Device, deviceAccessKey *models.DeviceAccessKey) {
+		if deviceAccessKey.Type == models.DeviceAccessKeyTypeCertificate {
+			http.Error(w, errCertificateRotation.Error(), http.StatusBadRequest)
+			return
+		}
+
+		deviceAccessKeyValue := ksuid.New().String()
+
+		if _, err := s.deviceAccessKeys.RotateDeviceAccessKey(r.Context(),
+			deviceAccessKey.ID, project.ID, hash.Hash(deviceAccessKeyValue)); err != nil {
+			log.WithError(err).Error("rotate device access key")
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		utils.Respond(w, models.RotateDeviceAccessKeyResponse{
+			DeviceAccessKeyValue: deviceAccessKeyValue,
+		})
+	})
+}
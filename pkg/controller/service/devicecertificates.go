@@ -0,0 +1,117 @@
+package service
+
+import (
+	"context"
+	"crypto/x509"
+	"net/http"
+	"net/url"
+
+	"github.com/deviceplane/deviceplane/pkg/controller/deviceca"
+	"github.com/deviceplane/deviceplane/pkg/controller/store"
+	"github.com/deviceplane/deviceplane/pkg/hash"
+	"github.com/deviceplane/deviceplane/pkg/models"
+	"github.com/pkg/errors"
+)
+
+// getOrCreateDeviceCertificateAuthority returns the project's certificate
+// authority, creating it the first time a device registers with a CSR.
+func (s *Service) getOrCreateDeviceCertificateAuthority(ctx context.Context, projectID string) (*deviceca.CertificateAuthority, error) {
+	deviceCertificateAuthority, err := s.deviceCertificateAuthorities.GetDeviceCertificateAuthority(ctx, projectID)
+	if err == store.ErrDeviceCertificateAuthorityNotFound {
+		certificatePEM, keyPEM, err := deviceca.New(projectID)
+		if err != nil {
+			return nil, errors.Wrap(err, "generate device certificate authority")
+		}
+
+		deviceCertificateAuthority, err = s.deviceCertificateAuthorities.CreateDeviceCertificateAuthority(ctx,
+			projectID, string(certificatePEM), string(keyPEM))
+		if err != nil {
+			return nil, errors.Wrap(err, "create device certificate authority")
+		}
+	} else if err != nil {
+		return nil, errors.Wrap(err, "get device certificate authority")
+	}
+
+	return deviceca.Parse([]byte(deviceCertificateAuthority.Certificate), []byte(deviceCertificateAuthority.PrivateKey))
+}
+
+// issueDeviceCertificate signs the device's CSR and records the resulting
+// certificate as one of the device's access keys.
+func (s *Service) issueDeviceCertificate(ctx context.Context, projectID, deviceID string, csr *x509.CertificateRequest) (string, error) {
+	ca, err := s.getOrCreateDeviceCertificateAuthority(ctx, projectID)
+	if err != nil {
+		return "", err
+	}
+
+	certificatePEM, err := ca.SignDeviceCSR(csr, projectID, deviceID)
+	if err != nil {
+		return "", errors.Wrap(err, "sign device CSR")
+	}
+
+	certificate, err := deviceca.ParseCertificate(certificatePEM)
+	if err != nil {
+		return "", err
+	}
+
+	if _, err := s.deviceAccessKeys.CreateDeviceCertificateAccessKey(ctx,
+		projectID, deviceID, hash.Hash(deviceca.Fingerprint(certificate))); err != nil {
+		return "", errors.Wrap(err, "create device certificate access key")
+	}
+
+	return string(certificatePEM), nil
+}
+
+// clientCertificate returns the certificate the client authenticated with,
+// either from the TLS connection or, when the controller is behind a proxy
+// that terminates TLS, from the configured header. It returns nil if there
+// isn't one.
+func (s *Service) clientCertificate(r *http.Request) (*x509.Certificate, error) {
+	if r.TLS != nil && len(r.TLS.PeerCertificates) > 0 {
+		return r.TLS.PeerCertificates[0], nil
+	}
+
+	if s.clientCertificateHeader == "" {
+		return nil, nil
+	}
+	headerValue := r.Header.Get(s.clientCertificateHeader)
+	if headerValue == "" {
+		return nil, nil
+	}
+
+	certificatePEM, err := url.QueryUnescape(headerValue)
+	if err != nil {
+		return nil, err
+	}
+	return deviceca.ParseCertificate([]byte(certificatePEM))
+}
+
+// validateDeviceCertificate is the client certificate equivalent of
+// ValidateDeviceAccessKey.
+func (s *Service) validateDeviceCertificate(ctx context.Context, projectID string, certificate *x509.Certificate) (*models.DeviceAccessKey, error) {
+	deviceCertificateAuthority, err := s.deviceCertificateAuthorities.GetDeviceCertificateAuthority(ctx, projectID)
+	if err == store.ErrDeviceCertificateAuthorityNotFound {
+		return nil, store.ErrDeviceAccessKeyNotFound
+	} else if err != nil {
+		return nil, err
+	}
+
+	ca, err := deviceca.Parse([]byte(deviceCertificateAuthority.Certificate), []byte(deviceCertificateAuthority.PrivateKey))
+	if err != nil {
+		return nil, err
+	}
+
+	deviceID, err := ca.VerifyDeviceCertificate(certificate, projectID)
+	if err != nil {
+		return nil, store.ErrDeviceAccessKeyNotFound
+	}
+
+	deviceAccessKey, err := s.deviceAccessKeys.ValidateDeviceAccessKey(ctx, projectID, hash.Hash(deviceca.Fingerprint(certificate)))
+	if err != nil {
+		return nil, err
+	}
+	if deviceAccessKey.DeviceID != deviceID {
+		return nil, store.ErrDeviceAccessKeyNotFound
+	}
+
+	return deviceAccessKey, nil
+}
@@ -0,0 +1,323 @@
+package service
+
+import (
+	"context"
+	"net/http"
+	"strings"
+
+	"github.com/apex/log"
+	"github.com/deviceplane/deviceplane/pkg/controller/authz"
+	"github.com/deviceplane/deviceplane/pkg/controller/query"
+	"github.com/deviceplane/deviceplane/pkg/controller/store"
+	"github.com/deviceplane/deviceplane/pkg/models"
+	"github.com/deviceplane/deviceplane/pkg/utils"
+	"github.com/pkg/errors"
+)
+
+var errDeviceGroupInUse = errors.New("device group is in use")
+
+func (s *Service) createDeviceGroup(w http.ResponseWriter, r *http.Request) {
+	s.withUserOrServiceAccountAuth(w, r, func(user *models.User, serviceAccount *models.ServiceAccount) {
+		s.validateAuthorization(
+			authz.ResourceDeviceGroups, authz.ActionCreateDeviceGroup,
+			w, r,
+			user, serviceAccount,
+			func(project *models.Project) {
+				var createDeviceGroupRequest struct {
+					Name        string       `json:"name" validate:"name"`
+					Description string       `json:"description" validate:"description"`
+					Query       models.Query `json:"query"`
+				}
+				if err := read(r, &createDeviceGroupRequest); err != nil {
+					http.Error(w, err.Error(), http.StatusBadRequest)
+					return
+				}
+				if createDeviceGroupRequest.Query == nil {
+					createDeviceGroupRequest.Query = models.Query{}
+				}
+
+				if _, err := s.deviceGroups.LookupDeviceGroup(r.Context(), createDeviceGroupRequest.Name, project.ID); err == nil {
+					http.Error(w, store.ErrDeviceGroupNameAlreadyInUse.Error(), http.StatusBadRequest)
+					return
+				} else if err != nil && err != store.ErrDeviceGroupNotFound {
+					log.WithError(err).Error("lookup device group")
+					w.WriteHeader(http.StatusInternalServerError)
+					return
+				}
+
+				validationErr, err := s.validateDeviceGroupQueries(r.Context(), project.ID, "", createDeviceGroupRequest.Query)
+				if validationErr != nil {
+					http.Error(w, validationErr.Error(), http.StatusBadRequest)
+					return
+				}
+				if err != nil {
+					log.WithError(err).Error("validate device group query")
+					w.WriteHeader(http.StatusInternalServerError)
+					return
+				}
+
+				deviceGroup, err := s.deviceGroups.CreateDeviceGroup(
+					r.Context(),
+					project.ID,
+					createDeviceGroupRequest.Name,
+					createDeviceGroupRequest.Description,
+					createDeviceGroupRequest.Query,
+				)
+				if err != nil {
+					log.WithError(err).Error("create device group")
+					w.WriteHeader(http.StatusInternalServerError)
+					return
+				}
+
+				utils.Respond(w, deviceGroup)
+			},
+		)
+	})
+}
+
+func (s *Service) getDeviceGroup(w http.ResponseWriter, r *http.Request) {
+	s.withUserOrServiceAccountAuth(w, r, func(user *models.User, serviceAccount *models.ServiceAccount) {
+		s.validateAuthorization(
+			authz.ResourceDeviceGroups, authz.ActionGetDeviceGroup,
+			w, r,
+			user, serviceAccount,
+			func(project *models.Project) {
+				s.withDeviceGroup(w, r, project, func(deviceGroup *models.DeviceGroup) {
+					utils.Respond(w, deviceGroup)
+				})
+			},
+		)
+	})
+}
+
+func (s *Service) listDeviceGroups(w http.ResponseWriter, r *http.Request) {
+	s.withUserOrServiceAccountAuth(w, r, func(user *models.User, serviceAccount *models.ServiceAccount) {
+		s.validateAuthorization(
+			authz.ResourceDeviceGroups, authz.ActionListDeviceGroups,
+			w, r,
+			user, serviceAccount,
+			func(project *models.Project) {
+				deviceGroups, err := s.deviceGroups.ListDeviceGroups(r.Context(), project.ID)
+				if err != nil {
+					log.WithError(err).Error("list device groups")
+					w.WriteHeader(http.StatusInternalServerError)
+					return
+				}
+
+				utils.Respond(w, deviceGroups)
+			},
+		)
+	})
+}
+
+func (s *Service) updateDeviceGroup(w http.ResponseWriter, r *http.Request) {
+	s.withUserOrServiceAccountAuth(w, r, func(user *models.User, serviceAccount *models.ServiceAccount) {
+		s.validateAuthorization(
+			authz.ResourceDeviceGroups, authz.ActionUpdateDeviceGroup,
+			w, r,
+			user, serviceAccount,
+			func(project *models.Project) {
+				s.withDeviceGroup(w, r, project, func(deviceGroup *models.DeviceGroup) {
+					var updateDeviceGroupRequest struct {
+						Name        string       `json:"name" validate:"name"`
+						Description string       `json:"description" validate:"description"`
+						Query       models.Query `json:"query"`
+					}
+					if err := read(r, &updateDeviceGroupRequest); err != nil {
+						http.Error(w, err.Error(), http.StatusBadRequest)
+						return
+					}
+					if updateDeviceGroupRequest.Query == nil {
+						updateDeviceGroupRequest.Query = models.Query{}
+					}
+
+					if g, err := s.deviceGroups.LookupDeviceGroup(r.Context(),
+						updateDeviceGroupRequest.Name, project.ID); err == nil && g.ID != deviceGroup.ID {
+						http.Error(w, store.ErrDeviceGroupNameAlreadyInUse.Error(), http.StatusBadRequest)
+						return
+					} else if err != nil && err != store.ErrDeviceGroupNotFound {
+						log.WithError(err).Error("lookup device group")
+						w.WriteHeader(http.StatusInternalServerError)
+						return
+					}
+
+					validationErr, err := s.validateDeviceGroupQueries(r.Context(), project.ID, deviceGroup.ID, updateDeviceGroupRequest.Query)
+					if validationErr != nil {
+						http.Error(w, validationErr.Error(), http.StatusBadRequest)
+						return
+					}
+					if err != nil {
+						log.WithError(err).Error("validate device group query")
+						w.WriteHeader(http.StatusInternalServerError)
+						return
+					}
+
+					// Applications look the group up when they're scheduled,
+					// so they pick up the new query without being updated
+					g, err := s.deviceGroups.UpdateDeviceGroup(r.Context(), deviceGroup.ID, project.ID,
+						updateDeviceGroupRequest.Name, updateDeviceGroupRequest.Description,
+						updateDeviceGroupRequest.Query,
+					)
+					if err != nil {
+						log.WithError(err).Error("update device group")
+						w.WriteHeader(http.StatusInternalServerError)
+						return
+					}
+
+					utils.Respond(w, g)
+				})
+			},
+		)
+	})
+}
+
+func (s *Service) deleteDeviceGroup(w http.ResponseWriter, r *http.Request) {
+	s.withUserOrServiceAccountAuth(w, r, func(user *models.User, serviceAccount *models.ServiceAccount) {
+		s.validateAuthorization(
+			authz.ResourceDeviceGroups, authz.ActionDeleteDeviceGroup,
+			w, r,
+			user, serviceAccount,
+			func(project *models.Project) {
+				s.withDeviceGroup(w, r, project, func(deviceGroup *models.DeviceGroup) {
+					usedBy, err := s.deviceGroupUser(r.Context(), project.ID, deviceGroup.ID)
+					if err != nil {
+						log.WithError(err).Error("check device group references")
+						w.WriteHeader(http.StatusInternalServerError)
+						return
+					}
+					if usedBy != "" {
+						http.Error(w, errors.Wrapf(errDeviceGroupInUse, "used by %s", usedBy).Error(), http.StatusBadRequest)
+						return
+					}
+
+					if err := s.deviceGroups.DeleteDeviceGroup(r.Context(), deviceGroup.ID, project.ID); err != nil {
+						log.WithError(err).Error("delete device group")
+						w.WriteHeader(http.StatusInternalServerError)
+						return
+					}
+				})
+			},
+		)
+	})
+}
+
+func (s *Service) getDeviceGroupByIdentifier(ctx context.Context, identifier, projectID string) (*models.DeviceGroup, error) {
+	if strings.Contains(identifier, "_") {
+		return s.deviceGroups.GetDeviceGroup(ctx, identifier, projectID)
+	}
+	return s.deviceGroups.LookupDeviceGroup(ctx, identifier, projectID)
+}
+
+// getDeviceGroupQueries returns the query of each of the project's device
+// groups, by ID.
+func (s *Service) getDeviceGroupQueries(ctx context.Context, projectID string) (map[string]models.Query, error) {
+	deviceGroups, err := s.deviceGroups.ListDeviceGroups(ctx, projectID)
+	if err != nil {
+		return nil, err
+	}
+
+	queries := make(map[string]models.Query, len(deviceGroups))
+	for _, deviceGroup := range deviceGroups {
+		queries[deviceGroup.ID] = deviceGroup.Query
+	}
+	return queries, nil
+}
+
+// getSchedulingDependencies loads what's needed to evaluate scheduling rules,
+// which can refer to device groups.
+func (s *Service) getSchedulingDependencies(ctx context.Context, projectID string) (*query.QueryDependencies, error) {
+	deviceGroups, err := s.getDeviceGroupQueries(ctx, projectID)
+	if err != nil {
+		return nil, err
+	}
+
+	return &query.QueryDependencies{
+		DeviceGroups: deviceGroups,
+	}, nil
+}
+
+// expandDeviceGroups inlines the device groups that filters refer to where
+// it can, so that the store can evaluate them.
+func (s *Service) expandDeviceGroups(ctx context.Context, projectID string, filters models.Query) (expanded models.Query, validationErr error, err error) {
+	if len(query.DeviceGroupReferences(filters)) == 0 {
+		return filters, nil, nil
+	}
+
+	deviceGroups, err := s.getDeviceGroupQueries(ctx, projectID)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	expanded, validationErr = query.ExpandDeviceGroups(filters, deviceGroups)
+	return expanded, validationErr, nil
+}
+
+// validateDeviceGroupQueries checks queries and the device groups that they
+// refer to. If deviceGroupID is set then the queries belong to that group.
+func (s *Service) validateDeviceGroupQueries(ctx context.Context, projectID, deviceGroupID string, queries ...models.Query) (validationErr error, err error) {
+	hasReferences := false
+	for _, q := range queries {
+		if err := query.ValidateQuery(q); err != nil {
+			return err, nil
+		}
+		if len(query.DeviceGroupReferences(q)) != 0 {
+			hasReferences = true
+		}
+	}
+	if !hasReferences {
+		return nil, nil
+	}
+
+	deviceGroups, err := s.getDeviceGroupQueries(ctx, projectID)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, q := range queries {
+		if err := query.ValidateDeviceGroupReferences(deviceGroupID, q, deviceGroups); err != nil {
+			return err, nil
+		}
+	}
+	return nil, nil
+}
+
+// deviceGroupUser returns the name of an application or device group that
+// refers to a device group, or an empty string if nothing does.
+func (s *Service) deviceGroupUser(ctx context.Context, projectID, deviceGroupID string) (string, error) {
+	refersToGroup := func(q models.Query) bool {
+		for _, id := range query.DeviceGroupReferences(q) {
+			if id == deviceGroupID {
+				return true
+			}
+		}
+		return false
+	}
+
+	applications, err := s.applications.ListApplications(ctx, projectID)
+	if err != nil {
+		return "", err
+	}
+	for _, application := range applications {
+		schedulingRule := application.SchedulingRule
+		if schedulingRule.ConditionalQuery != nil && refersToGroup(*schedulingRule.ConditionalQuery) {
+			return "application " + application.Name, nil
+		}
+		for _, releaseSelector := range schedulingRule.ReleaseSelectors {
+			if refersToGroup(releaseSelector.Query) {
+				return "application " + application.Name, nil
+			}
+		}
+	}
+
+	deviceGroups, err := s.deviceGroups.ListDeviceGroups(ctx, projectID)
+	if err != nil {
+		return "", err
+	}
+	for _, deviceGroup := range deviceGroups {
+		if refersToGroup(deviceGroup.Query) {
+			return "device group " + deviceGroup.Name, nil
+		}
+	}
+
+	return "", nil
+}
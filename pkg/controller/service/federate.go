@@ -0,0 +1,275 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/apex/log"
+	"github.com/deviceplane/deviceplane/pkg/agent/service/client"
+	"github.com/deviceplane/deviceplane/pkg/controller/authz"
+	"github.com/deviceplane/deviceplane/pkg/controller/query"
+	"github.com/deviceplane/deviceplane/pkg/controller/store"
+	"github.com/deviceplane/deviceplane/pkg/metrics/federation"
+	"github.com/deviceplane/deviceplane/pkg/models"
+	"github.com/pkg/errors"
+	"github.com/prometheus/common/expfmt"
+)
+
+const (
+	federateConcurrency   = 50
+	federateScrapeTimeout = 10 * time.Second
+	// Scrapes that respond with more than this are counted as failed
+	federateMaxScrapeBytes = 5 << 20
+
+	// Prometheus sends its scrape timeout in this header. Scrapes of devices
+	// use a little less of it so that there's time left to respond.
+	prometheusScrapeTimeoutHeader = "X-Prometheus-Scrape-Timeout-Seconds"
+	federateTimeoutFraction       = 0.8
+)
+
+var (
+	errFederateScrapeFailed   = errors.New("scrape failed")
+	errFederateScrapeTooLarge = errors.New("scrape response is too large")
+)
+
+// federateTarget is one metrics endpoint on a device.
+type federateTarget struct {
+	device models.Device
+	labels map[string]string
+	scrape func(ctx context.Context, deviceConn net.Conn) (*http.Response, error)
+}
+
+// federateMetrics scrapes host metrics, and the metrics of the services in
+// the project's service metrics config, from every connected device that
+// matches the filters. It responds with all of them in the Prometheus text
+// format, labelled by device, application and service.
+func (s *Service) federateMetrics(w http.ResponseWriter, r *http.Request) {
+	s.withUserOrServiceAccountAuth(w, r, func(user *models.User, serviceAccount *models.ServiceAccount) {
+		s.validateAuthorization(
+			authz.ResourceDevices, authz.ActionFederateMetrics,
+			w, r,
+			user, serviceAccount,
+			func(project *models.Project) {
+				filters, err := query.FiltersFromQuery(r.URL.Query())
+				if err != nil {
+					http.Error(w, errors.Wrap(err, "get filters from query").Error(), http.StatusBadRequest)
+					return
+				}
+
+				filters, validationErr, err := s.expandDeviceGroups(r.Context(), project.ID, filters)
+				if validationErr != nil {
+					http.Error(w, errors.Wrap(validationErr, "expand device groups").Error(), http.StatusBadRequest)
+					return
+				}
+				if err != nil {
+					log.WithError(err).Error("expand device groups")
+					w.WriteHeader(http.StatusInternalServerError)
+					return
+				}
+
+				page, err := s.devices.QueryDevices(r.Context(), project.ID, store.DeviceQuery{
+					Filters: filters,
+				})
+				if err != nil {
+					log.WithError(err).Error("query devices")
+					w.WriteHeader(http.StatusInternalServerError)
+					return
+				}
+
+				queryDependencies, err := s.getQueryDependencies(r.Context(), project.ID)
+				if err != nil {
+					log.WithError(err).Error("get filter dependencies")
+					w.WriteHeader(http.StatusInternalServerError)
+					return
+				}
+
+				devices := page.Devices
+				if len(page.Unapplied) != 0 {
+					devices, _, err = query.QueryDevices(*queryDependencies, devices, page.Unapplied)
+					if query.InvalidQuery(err) {
+						http.Error(w, errors.Wrap(err, "filter devices").Error(), http.StatusBadRequest)
+						return
+					} else if err != nil {
+						log.WithError(err).Error("filter devices")
+						w.WriteHeader(http.StatusInternalServerError)
+						return
+					}
+				}
+
+				authorizationConfigs, err := s.getAuthorizationConfigs(r.Context(), project, user, serviceAccount)
+				if err != nil {
+					log.WithError(err).Error("get authorization configs")
+					w.WriteHeader(http.StatusInternalServerError)
+					return
+				}
+				var authorizedDevices []models.Device
+				for _, device := range devices {
+					if authorizationConfigs.evaluateDevice(authz.ResourceDevices, authz.ActionFederateMetrics, device) {
+						authorizedDevices = append(authorizedDevices, device)
+					}
+				}
+				devices = authorizedDevices
+
+				targets, err := s.getFederateTargets(r.Context(), project, devices, queryDependencies.DeviceApplicationStatuses)
+				if err != nil {
+					log.WithError(err).Error("get federate targets")
+					w.WriteHeader(http.StatusInternalServerError)
+					return
+				}
+
+				merger := federation.NewMerger()
+
+				// Targets are scraped a few at a time, so they share one
+				// deadline to keep the response within the timeout. Targets
+				// that haven't started by then are reported as down.
+				ctx, cancel := context.WithTimeout(r.Context(), federateTimeout(r))
+				defer cancel()
+
+				var wg sync.WaitGroup
+				sem := make(chan struct{}, federateConcurrency)
+				for _, target := range targets {
+					select {
+					case sem <- struct{}{}:
+					case <-ctx.Done():
+					}
+					if ctx.Err() != nil {
+						merger.AddUp(target.labels, false)
+						continue
+					}
+
+					wg.Add(1)
+					go func(target federateTarget) {
+						defer wg.Done()
+						defer func() { <-sem }()
+
+						err := s.scrapeFederateTarget(ctx, project, target, merger)
+						merger.AddUp(target.labels, err == nil)
+					}(target)
+				}
+				wg.Wait()
+
+				w.Header().Set("Content-Type", string(expfmt.FmtText))
+				if err := merger.Write(w); err != nil {
+					log.WithError(err).Error("write federated metrics")
+				}
+			},
+		)
+	})
+}
+
+func (s *Service) getFederateTargets(ctx context.Context, project *models.Project, devices []models.Device,
+	deviceApplicationStatuses map[string]map[string]*models.DeviceApplicationStatus) ([]federateTarget, error) {
+	serviceMetricsConfigs, err := s.metricConfigs.GetServiceMetricsConfigs(ctx, project.ID)
+	if err != nil {
+		return nil, errors.Wrap(err, "get service metrics configs")
+	}
+
+	applications, err := s.applications.ListApplications(ctx, project.ID)
+	if err != nil {
+		return nil, errors.Wrap(err, "list applications")
+	}
+	applicationsByID := make(map[string]models.Application, len(applications))
+	for _, application := range applications {
+		applicationsByID[application.ID] = application
+	}
+
+	var targets []federateTarget
+	for _, device := range devices {
+		targets = append(targets, federateTarget{
+			device: device,
+			labels: map[string]string{
+				"device": device.Name,
+			},
+			scrape: func(ctx context.Context, deviceConn net.Conn) (*http.Response, error) {
+				return client.GetDeviceMetrics(ctx, deviceConn)
+			},
+		})
+
+		for _, serviceMetricsConfig := range serviceMetricsConfigs {
+			application, ok := applicationsByID[serviceMetricsConfig.ApplicationID]
+			if !ok {
+				continue
+			}
+			// Only scrape services that the device is running
+			if _, ok := deviceApplicationStatuses[device.ID][application.ID]; !ok {
+				continue
+			}
+
+			service := serviceMetricsConfig.Service
+			metricEndpointConfig, exists := application.MetricEndpointConfigs[service]
+			if !exists {
+				metricEndpointConfig.Port = models.DefaultMetricPort
+				metricEndpointConfig.Path = models.DefaultMetricPath
+			}
+
+			targets = append(targets, federateTarget{
+				device: device,
+				labels: map[string]string{
+					"device":      device.Name,
+					"application": application.Name,
+					"service":     service,
+				},
+				scrape: func(ctx context.Context, deviceConn net.Conn) (*http.Response, error) {
+					return client.GetServiceMetrics(ctx, deviceConn, application.ID, service,
+						metricEndpointConfig.Path, metricEndpointConfig.Port)
+				},
+			})
+		}
+	}
+
+	return targets, nil
+}
+
+func (s *Service) scrapeFederateTarget(ctx context.Context, project *models.Project, target federateTarget,
+	merger *federation.Merger) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	deviceConn, err := s.connman.Dial(ctx, project.ID+target.device.ID)
+	if err != nil {
+		return err
+	}
+	defer deviceConn.Close()
+
+	// Reads from the connection don't observe the context, so close it
+	// when the deadline passes to unblock them
+	go func() {
+		<-ctx.Done()
+		deviceConn.Close()
+	}()
+
+	resp, err := target.scrape(ctx, deviceConn)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return errFederateScrapeFailed
+	}
+
+	body, err := ioutil.ReadAll(io.LimitReader(resp.Body, federateMaxScrapeBytes+1))
+	if err != nil {
+		return err
+	}
+	if len(body) > federateMaxScrapeBytes {
+		return errFederateScrapeTooLarge
+	}
+
+	return merger.Add(bytes.NewReader(body), target.labels)
+}
+
+func federateTimeout(r *http.Request) time.Duration {
+	seconds, err := strconv.ParseFloat(r.Header.Get(prometheusScrapeTimeoutHeader), 64)
+	if err != nil || seconds <= 0 {
+		return federateScrapeTimeout
+	}
+	return time.Duration(seconds * federateTimeoutFraction * float64(time.Second))
+}
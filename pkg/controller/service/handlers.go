@@ -1,15 +1,19 @@
 package service
 
 import (
+	"context"
+	"crypto/x509"
 	"encoding/json"
 	"fmt"
 	"net/http"
 	"net/url"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/apex/log"
 	"github.com/deviceplane/deviceplane/pkg/controller/authz"
+	"github.com/deviceplane/deviceplane/pkg/controller/deviceca"
 	"github.com/deviceplane/deviceplane/pkg/controller/middleware"
 	"github.com/deviceplane/deviceplane/pkg/controller/query"
 	"github.com/deviceplane/deviceplane/pkg/controller/scheduling"
@@ -34,8 +38,26 @@ var (
 	errEmailDomainNotAllowed = errors.New("email domain not allowed")
 	errEmailAlreadyTaken     = errors.New("email already taken")
 	errTokenExpired          = errors.New("token expired")
+	errExpiryInPast          = errors.New("expiry must be in the future")
+	errScopedAccessKey       = errors.New("access keys with a config can't create access keys")
+	errSubjectNotFound       = errors.New("subject not found in this project")
 )
 
+// validateAccessKeyOptions checks the optional expiry and role config given
+// when creating an access key.
+func validateAccessKeyOptions(expiresAt *time.Time, config *string) error {
+	if expiresAt != nil && !expiresAt.After(time.Now()) {
+		return errExpiryInPast
+	}
+	if config != nil {
+		var accessKeyConfig authz.Config
+		if err := yaml.UnmarshalStrict([]byte(*config), &accessKeyConfig); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 func (s *Service) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	s.router.ServeHTTP(w, r)
 }
@@ -199,6 +221,12 @@ func (s *Service) registerExternalUser(w http.ResponseWriter, r *http.Request) {
 			return
 		}
 
+		if err := s.syncSsoGroupMappings(r.Context(), user.ID, ssoJWT.Groups); err != nil {
+			log.WithError(err).Error("sync SSO group mappings")
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
 		s.newSession(w, r, user.ID)
 	})
 }
@@ -334,8 +362,10 @@ func (s *Service) changeInternalUserPassword(w http.ResponseWriter, r *http.Requ
 
 func (s *Service) loginInternalUser(w http.ResponseWriter, r *http.Request) {
 	var loginRequest struct {
-		Email    string `json:"email" validate:"email"`
-		Password string `json:"password" validate:"password"`
+		Email        string  `json:"email" validate:"email"`
+		Password     string  `json:"password" validate:"password"`
+		TOTPCode     *string `json:"totpCode" validate:"omitempty,min=1,max=10"`
+		RecoveryCode *string `json:"recoveryCode" validate:"omitempty,min=1,max=20"`
 	}
 	if err := read(r, &loginRequest); err != nil {
 		http.Error(w, err.Error(), http.StatusBadRequest)
@@ -362,9 +392,45 @@ func (s *Service) loginInternalUser(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	switch err := s.validateSecondFactor(r.Context(), user.ID, loginRequest.TOTPCode, loginRequest.RecoveryCode); err {
+	case nil:
+	case errTwoFactorCodeRequired, errTwoFactorCodeInvalid:
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	case errTwoFactorLocked:
+		http.Error(w, err.Error(), http.StatusTooManyRequests)
+		return
+	default:
+		log.WithError(err).Error("validate second factor")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
 	s.newSession(w, r, user.ID)
 }
 
+// getSsoConfig tells clients which OIDC provider to start the login flow
+// with.
+func (s *Service) getSsoConfig(w http.ResponseWriter, r *http.Request) {
+	if s.oidcProvider == nil {
+		utils.Respond(w, models.SsoConfig{})
+		return
+	}
+
+	issuer, err := s.oidcProvider.Issuer(r.Context())
+	if err != nil {
+		log.WithError(err).Error("get oidc issuer")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	utils.Respond(w, models.SsoConfig{
+		Enabled:  true,
+		Issuer:   issuer,
+		ClientID: s.oidcProvider.ClientID(),
+	})
+}
+
 func (s *Service) loginExternalUser(w http.ResponseWriter, r *http.Request) {
 	s.withValidatedSsoJWT(w, r, func(ssoJWT models.SsoJWT) {
 		externalUser, err := s.externalUsers.GetExternalUserByProviderID(r.Context(), ssoJWT.Provider, ssoJWT.Subject)
@@ -387,6 +453,20 @@ func (s *Service) loginExternalUser(w http.ResponseWriter, r *http.Request) {
 			return
 		}
 
+		// Keep the stored claims current so group changes in the
+		// identity provider take effect on the next login
+		if _, err := s.externalUsers.UpdateExternalUser(r.Context(), externalUser.ID, ssoJWT.Email, ssoJWT.Claims); err != nil {
+			log.WithError(err).Error("update external user")
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		if err := s.syncSsoGroupMappings(r.Context(), user.ID, ssoJWT.Groups); err != nil {
+			log.WithError(err).Error("sync SSO group mappings")
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
 		s.newSession(w, r, user.ID)
 	})
 }
@@ -395,32 +475,14 @@ func (s *Service) newSession(w http.ResponseWriter, r *http.Request, userID stri
 	utils.WithReferrer(w, r, func(referrer *url.URL) {
 		sessionValue := ksuid.New().String()
 
-		if _, err := s.sessions.CreateSession(r.Context(), userID, hash.Hash(sessionValue)); err != nil {
+		if _, err := s.sessions.CreateSession(r.Context(), userID, hash.Hash(sessionValue),
+			time.Now().Add(s.sessionTTL), remoteIP(r), r.UserAgent()); err != nil {
 			log.WithError(err).Error("create session")
 			w.WriteHeader(http.StatusInternalServerError)
 			return
 		}
 
-		var secure bool
-		switch referrer.Scheme {
-		case "http":
-			secure = false
-		case "https":
-			secure = true
-		}
-
-		cookie := &http.Cookie{
-			Name:  sessionCookie,
-			Value: sessionValue,
-
-			Expires: time.Now().AddDate(0, 1, 0),
-
-			Domain:   r.Host,
-			Secure:   secure,
-			HttpOnly: true,
-		}
-
-		http.SetCookie(w, cookie)
+		setSessionCookie(w, r, referrer, sessionValue, time.Now().Add(s.sessionTTL))
 	})
 }
 
@@ -429,7 +491,7 @@ func (s *Service) logout(w http.ResponseWriter, r *http.Request) {
 
 	switch err {
 	case nil:
-		session, err := s.sessions.ValidateSession(r.Context(), hash.Hash(sessionValue.Value))
+		session, err := s.validateSession(r, sessionValue.Value)
 		if err == store.ErrSessionNotFound {
 			w.WriteHeader(http.StatusForbidden)
 			return
@@ -589,18 +651,33 @@ func (s *Service) listMembershipsByUser(w http.ResponseWriter, r *http.Request)
 
 func (s *Service) createUserAccessKey(w http.ResponseWriter, r *http.Request) {
 	s.withUserAuth(w, r, func(user *models.User) {
+		// Otherwise a scoped key could be used to create an unscoped one
+		if user.AccessKeyConfig != nil {
+			http.Error(w, errScopedAccessKey.Error(), http.StatusForbidden)
+			return
+		}
+
 		var createUserAccessKeyRequest struct {
-			Description string `json:"description" validate:"description"`
+			Description string     `json:"description" validate:"description"`
+			ExpiresAt   *time.Time `json:"expiresAt"`
+			Config      *string    `json:"config" validate:"omitempty,config"`
 		}
 		if err := read(r, &createUserAccessKeyRequest); err != nil {
 			http.Error(w, err.Error(), http.StatusBadRequest)
 			return
 		}
 
+		if err := validateAccessKeyOptions(createUserAccessKeyRequest.ExpiresAt,
+			createUserAccessKeyRequest.Config); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
 		userAccessKeyValue := "u" + ksuid.New().String()
 
 		userAccessKey, err := s.userAccessKeys.CreateUserAccessKey(r.Context(),
-			user.ID, hash.Hash(userAccessKeyValue), createUserAccessKeyRequest.Description)
+			user.ID, hash.Hash(userAccessKeyValue), createUserAccessKeyRequest.Description,
+			createUserAccessKeyRequest.ExpiresAt, createUserAccessKeyRequest.Config)
 		if err != nil {
 			log.WithError(err).Error("create user access key")
 			w.WriteHeader(http.StatusInternalServerError)
@@ -696,84 +773,76 @@ func (s *Service) createProject(w http.ResponseWriter, r *http.Request) {
 			return
 		}
 
-		project, err := s.projects.CreateProject(r.Context(), createProjectRequest.Name)
+		project, err := s.createProjectWithDefaults(r.Context(), user.ID, createProjectRequest.Name, nil)
 		if err != nil {
 			log.WithError(err).Error("create project")
 			w.WriteHeader(http.StatusInternalServerError)
 			return
 		}
 
-		if _, err = s.memberships.CreateMembership(r.Context(), user.ID, project.ID); err != nil {
-			log.WithError(err).Error("create membership")
-			w.WriteHeader(http.StatusInternalServerError)
-			return
-		}
+		utils.Respond(w, project)
+	})
+}
 
-		adminAllRoleBytes, err := yaml.Marshal(authz.AdminAllRole)
-		if err != nil {
-			log.WithError(err).Error("marshal admin role config")
-			w.WriteHeader(http.StatusInternalServerError)
-			return
-		}
+// createProjectWithDefaults creates a project owned by the given user along
+// with the default roles and device registration token.
+func (s *Service) createProjectWithDefaults(ctx context.Context, userID, name string, organizationID *string) (*models.Project, error) {
+	project, err := s.projects.CreateProject(ctx, name, organizationID)
+	if err != nil {
+		return nil, err
+	}
 
-		adminRole, err := s.roles.CreateRole(r.Context(), project.ID, "admin-all", "", string(adminAllRoleBytes))
-		if err != nil {
-			log.WithError(err).Error("create admin role")
-			w.WriteHeader(http.StatusInternalServerError)
-			return
-		}
+	if _, err = s.memberships.CreateMembership(ctx, userID, project.ID); err != nil {
+		return nil, errors.Wrap(err, "create membership")
+	}
 
-		writeAllRoleBytes, err := yaml.Marshal(authz.WriteAllRole)
-		if err != nil {
-			log.WithError(err).Error("marshal write role config")
-			w.WriteHeader(http.StatusInternalServerError)
-			return
-		}
+	adminAllRoleBytes, err := yaml.Marshal(authz.AdminAllRole)
+	if err != nil {
+		return nil, errors.Wrap(err, "marshal admin role config")
+	}
 
-		if _, err = s.roles.CreateRole(r.Context(), project.ID, "write-all", "", string(writeAllRoleBytes)); err != nil {
-			log.WithError(err).Error("create write role")
-			w.WriteHeader(http.StatusInternalServerError)
-			return
-		}
+	adminRole, err := s.roles.CreateRole(ctx, project.ID, "admin-all", "", string(adminAllRoleBytes))
+	if err != nil {
+		return nil, errors.Wrap(err, "create admin role")
+	}
 
-		readAllRoleBytes, err := yaml.Marshal(authz.ReadAllRole)
-		if err != nil {
-			log.WithError(err).Error("marshal read role config")
-			w.WriteHeader(http.StatusInternalServerError)
-			return
-		}
+	writeAllRoleBytes, err := yaml.Marshal(authz.WriteAllRole)
+	if err != nil {
+		return nil, errors.Wrap(err, "marshal write role config")
+	}
 
-		if _, err = s.roles.CreateRole(r.Context(), project.ID, "read-all", "", string(readAllRoleBytes)); err != nil {
-			log.WithError(err).Error("create read role")
-			w.WriteHeader(http.StatusInternalServerError)
-			return
-		}
+	if _, err = s.roles.CreateRole(ctx, project.ID, "write-all", "", string(writeAllRoleBytes)); err != nil {
+		return nil, errors.Wrap(err, "create write role")
+	}
 
-		if _, err = s.membershipRoleBindings.CreateMembershipRoleBinding(r.Context(),
-			user.ID, adminRole.ID, project.ID,
-		); err != nil {
-			log.WithError(err).Error("create membership role binding")
-			w.WriteHeader(http.StatusInternalServerError)
-			return
-		}
+	readAllRoleBytes, err := yaml.Marshal(authz.ReadAllRole)
+	if err != nil {
+		return nil, errors.Wrap(err, "marshal read role config")
+	}
 
-		// Create default device registration token.
-		// It is named "default" and has an unlimited device registration cap.
-		_, err = s.deviceRegistrationTokens.CreateDeviceRegistrationToken(
-			r.Context(),
-			project.ID,
-			"default",
-			"",
-			nil,
-		)
-		if err != nil {
-			log.WithError(err).Error("create default registration token")
-			w.WriteHeader(http.StatusInternalServerError)
-			return
-		}
+	if _, err = s.roles.CreateRole(ctx, project.ID, "read-all", "", string(readAllRoleBytes)); err != nil {
+		return nil, errors.Wrap(err, "create read role")
+	}
 
-		utils.Respond(w, project)
-	})
+	if _, err = s.membershipRoleBindings.CreateMembershipRoleBinding(ctx,
+		userID, adminRole.ID, project.ID,
+	); err != nil {
+		return nil, errors.Wrap(err, "create membership role binding")
+	}
+
+	// Create default device registration token.
+	// It is named "default" and has an unlimited device registration cap.
+	if _, err = s.deviceRegistrationTokens.CreateDeviceRegistrationToken(
+		ctx,
+		project.ID,
+		"default",
+		"",
+		nil,
+	); err != nil {
+		return nil, errors.Wrap(err, "create default registration token")
+	}
+
+	return project, nil
 }
 
 func (s *Service) getProject(w http.ResponseWriter, r *http.Request) {
@@ -1001,6 +1070,148 @@ func (s *Service) deleteRole(w http.ResponseWriter, r *http.Request) {
 	})
 }
 
+func (s *Service) simulateAuthorization(w http.ResponseWriter, r *http.Request) {
+	s.withUserOrServiceAccountAuth(w, r, func(user *models.User, serviceAccount *models.ServiceAccount) {
+		s.validateAuthorization(
+			authz.ResourceRoles, authz.ActionSimulateAuthorization,
+			w, r,
+			user, serviceAccount,
+			func(project *models.Project) {
+				var simulateAuthorizationRequest models.SimulateAuthorizationRequest
+				if err := read(r, &simulateAuthorizationRequest); err != nil {
+					http.Error(w, err.Error(), http.StatusBadRequest)
+					return
+				}
+
+				if (simulateAuthorizationRequest.UserID == "") == (simulateAuthorizationRequest.ServiceAccount == "") {
+					http.Error(w, "exactly one of userId and serviceAccount must be set", http.StatusBadRequest)
+					return
+				}
+
+				resource := authz.Resource(simulateAuthorizationRequest.Resource)
+				if !authz.ValidResource(resource) {
+					http.Error(w, fmt.Sprintf("unknown resource %s", resource), http.StatusBadRequest)
+					return
+				}
+				action := authz.Action(simulateAuthorizationRequest.Action)
+				if !authz.ValidAction(action) {
+					http.Error(w, fmt.Sprintf("unknown action %s", action), http.StatusBadRequest)
+					return
+				}
+
+				var subjectUser *models.User
+				var subjectServiceAccount *models.ServiceAccount
+				if simulateAuthorizationRequest.UserID != "" {
+					var err error
+					subjectUser, err = s.users.GetUser(r.Context(), simulateAuthorizationRequest.UserID)
+					if err == store.ErrUserNotFound {
+						http.Error(w, errSubjectNotFound.Error(), http.StatusNotFound)
+						return
+					} else if err != nil {
+						log.WithError(err).Error("get user")
+						w.WriteHeader(http.StatusInternalServerError)
+						return
+					}
+				} else {
+					identifier := simulateAuthorizationRequest.ServiceAccount
+					var err error
+					if strings.Contains(identifier, "_") {
+						subjectServiceAccount, err = s.serviceAccounts.GetServiceAccount(r.Context(), identifier, project.ID)
+					} else {
+						subjectServiceAccount, err = s.serviceAccounts.LookupServiceAccount(r.Context(), identifier, project.ID)
+					}
+					if err == store.ErrServiceAccountNotFound {
+						http.Error(w, errSubjectNotFound.Error(), http.StatusNotFound)
+						return
+					} else if err != nil {
+						log.WithError(err).Error("lookup service account")
+						w.WriteHeader(http.StatusInternalServerError)
+						return
+					}
+				}
+
+				// The subject's configs are built the same way as when it
+				// makes a request of its own. Users that don't exist and
+				// users that aren't members get the same response so that
+				// this can't be used to find out which user IDs exist.
+				authorizationConfigs, err := s.getAuthorizationConfigs(r.Context(), project, subjectUser, subjectServiceAccount)
+				if err == store.ErrMembershipNotFound {
+					http.Error(w, errSubjectNotFound.Error(), http.StatusNotFound)
+					return
+				} else if err != nil {
+					log.WithError(err).Error("get authorization configs")
+					w.WriteHeader(http.StatusInternalServerError)
+					return
+				}
+				superAdmin := authorizationConfigs.superAdmin
+				roles := authorizationConfigs.roles
+				configs := authorizationConfigs.configs
+
+				var object *authz.Object
+				if simulateAuthorizationRequest.Object != "" {
+					object, err = s.getAuthorizationObject(r.Context(), project, resource, simulateAuthorizationRequest.Object)
+					if err != nil {
+						log.WithError(err).Error("get authorization object")
+						w.WriteHeader(http.StatusInternalServerError)
+						return
+					}
+					if object == nil {
+						http.Error(w, fmt.Sprintf("%s %s not found", resource, simulateAuthorizationRequest.Object), http.StatusNotFound)
+						return
+					}
+				}
+
+				toMatchingRules := func(matches []authz.RuleMatch) ([]models.MatchingAuthorizationRule, error) {
+					ret := make([]models.MatchingAuthorizationRule, 0, len(matches))
+					for _, match := range matches {
+						ruleBytes, err := yaml.Marshal(match.Rule)
+						if err != nil {
+							return nil, err
+						}
+						matchingRule := models.MatchingAuthorizationRule{
+							RuleIndex: match.RuleIndex,
+							Rule:      string(ruleBytes),
+						}
+						if !superAdmin {
+							matchingRule.RoleID = roles[match.ConfigIndex].ID
+							matchingRule.RoleName = roles[match.ConfigIndex].Name
+						}
+						ret = append(ret, matchingRule)
+					}
+					return ret, nil
+				}
+
+				allows, denies := authz.MatchingRules(resource, action, object, configs)
+				allowRules, err := toMatchingRules(allows)
+				if err != nil {
+					log.WithError(err).Error("marshal rule")
+					w.WriteHeader(http.StatusInternalServerError)
+					return
+				}
+				denyRules, err := toMatchingRules(denies)
+				if err != nil {
+					log.WithError(err).Error("marshal rule")
+					w.WriteHeader(http.StatusInternalServerError)
+					return
+				}
+
+				roleNames := make([]string, 0, len(roles))
+				for _, role := range roles {
+					roleNames = append(roleNames, role.Name)
+				}
+
+				utils.Respond(w, models.SimulateAuthorizationResponse{
+					Allowed:    len(allows) > 0 && len(denies) == 0,
+					SuperAdmin: superAdmin,
+					Roles:      roleNames,
+					AllowRules: allowRules,
+					DenyRules:  denyRules,
+				})
+			},
+		)
+	})
+}
+
 func (s *Service) createServiceAccount(w http.ResponseWriter, r *http.Request) {
 	s.withUserOrServiceAccountAuth(w, r, func(user *models.User, serviceAccount *models.ServiceAccount) {
 		s.validateAuthorization(
@@ -1205,17 +1416,26 @@ func (s *Service) createServiceAccountAccessKey(w http.ResponseWriter, r *http.R
 				serviceAccountID := vars["serviceaccount"]
 
 				var createServiceAccountAccessKeyRequest struct {
-					Description string `json:"description" validate:"description"`
+					Description string     `json:"description" validate:"description"`
+					ExpiresAt   *time.Time `json:"expiresAt"`
+					Config      *string    `json:"config" validate:"omitempty,config"`
 				}
 				if err := read(r, &createServiceAccountAccessKeyRequest); err != nil {
 					http.Error(w, err.Error(), http.StatusBadRequest)
 					return
 				}
 
+				if err := validateAccessKeyOptions(createServiceAccountAccessKeyRequest.ExpiresAt,
+					createServiceAccountAccessKeyRequest.Config); err != nil {
+					http.Error(w, err.Error(), http.StatusBadRequest)
+					return
+				}
+
 				serviceAccountAccessKeyValue := "s" + ksuid.New().String()
 
 				serviceAccount, err := s.serviceAccountAccessKeys.CreateServiceAccountAccessKey(r.Context(),
-					project.ID, serviceAccountID, hash.Hash(serviceAccountAccessKeyValue), createServiceAccountAccessKeyRequest.Description)
+					project.ID, serviceAccountID, hash.Hash(serviceAccountAccessKeyValue), createServiceAccountAccessKeyRequest.Description,
+					createServiceAccountAccessKeyRequest.ExpiresAt, createServiceAccountAccessKeyRequest.Config)
 				if err != nil {
 					log.WithError(err).Error("create service account access key")
 					w.WriteHeader(http.StatusInternalServerError)
@@ -2013,6 +2233,24 @@ func (s *Service) updateApplication(w http.ResponseWriter, r *http.Request) {
 							return
 						}
 
+						var schedulingQueries []models.Query
+						if updateApplicationRequest.SchedulingRule.ConditionalQuery != nil {
+							schedulingQueries = append(schedulingQueries, *updateApplicationRequest.SchedulingRule.ConditionalQuery)
+						}
+						for _, releaseSelector := range updateApplicationRequest.SchedulingRule.ReleaseSelectors {
+							schedulingQueries = append(schedulingQueries, releaseSelector.Query)
+						}
+						validationErr, err = s.validateDeviceGroupQueries(r.Context(), project.ID, "", schedulingQueries...)
+						if validationErr != nil {
+							http.Error(w, validationErr.Error(), http.StatusBadRequest)
+							return
+						}
+						if err != nil {
+							log.WithError(err).Error("validate scheduling rule device groups")
+							w.WriteHeader(http.StatusInternalServerError)
+							return
+						}
+
 						if app, err = s.applications.UpdateApplicationSchedulingRule(r.Context(), application.ID, project.ID, *updateApplicationRequest.SchedulingRule); err != nil {
 							log.WithError(err).Error("update application scheduling rule")
 							w.WriteHeader(http.StatusInternalServerError)
@@ -2068,16 +2306,48 @@ func (s *Service) createRelease(w http.ResponseWriter, r *http.Request) {
 						return
 					}
 
-					if err := spec.Validate([]byte(createReleaseRequest.RawConfig)); err != nil {
+					applicationConfig, err := spec.Parse([]byte(createReleaseRequest.RawConfig))
+					if err != nil {
 						http.Error(w, err.Error(), http.StatusBadRequest)
 						return
 					}
 
-					var applicationConfig map[string]models.Service
-					if err := yaml.UnmarshalStrict([]byte(createReleaseRequest.RawConfig), &applicationConfig); err != nil {
-						http.Error(w, err.Error(), http.StatusBadRequest)
+					if _, ok := r.URL.Query()["dryrun"]; ok {
+						devices, err := s.devices.ListDevices(r.Context(), project.ID, "")
+						if err != nil {
+							log.WithError(err).Error("list devices")
+							w.WriteHeader(http.StatusInternalServerError)
+							return
+						}
+
+						schedulingDependencies, err := s.getSchedulingDependencies(r.Context(), project.ID)
+						if err != nil {
+							log.WithError(err).Error("get scheduling dependencies")
+							w.WriteHeader(http.StatusInternalServerError)
+							return
+						}
+
+						scheduledDevices, err := scheduling.GetScheduledDevices(*schedulingDependencies, devices, application.SchedulingRule)
+						if err != nil {
+							http.Error(w, errors.Wrap(err, "evaluate application scheduling rule").Error(), http.StatusBadRequest)
+							return
+						}
+
+						// Only devices scheduled on the latest release would receive this one
+						receivingDevices := make([]models.ScheduledDevice, 0)
+						for _, scheduledDevice := range scheduledDevices {
+							if scheduledDevice.ReleaseID == models.LatestRelease {
+								receivingDevices = append(receivingDevices, scheduledDevice)
+							}
+						}
+
+						utils.Respond(w, models.CreateReleaseDryRunResponse{
+							Config:           applicationConfig,
+							ScheduledDevices: receivingDevices,
+						})
 						return
 					}
+
 					jsonApplicationConfig, err := json.Marshal(applicationConfig)
 					if err != nil {
 						log.WithError(err).Error("marshal json application config")
@@ -2143,6 +2413,48 @@ func (s *Service) getRelease(w http.ResponseWriter, r *http.Request) {
 	})
 }
 
+func (s *Service) diffReleases(w http.ResponseWriter, r *http.Request) {
+	s.withUserOrServiceAccountAuth(w, r, func(user *models.User, serviceAccount *models.ServiceAccount) {
+		s.validateAuthorization(
+			authz.ResourceReleases, authz.ActionDiffReleases,
+			w, r,
+			user, serviceAccount,
+			func(project *models.Project) {
+				s.withApplication(w, r, project, func(application *models.Application) {
+					s.withRelease(w, r, project, application, func(release *models.Release) {
+						baseIdentifier := r.URL.Query().Get("base")
+						if baseIdentifier == "" && release.Number > 1 {
+							baseIdentifier = strconv.FormatUint(uint64(release.Number-1), 10)
+						}
+
+						baseConfig := map[string]models.Service{}
+						var baseNumber uint32
+						if baseIdentifier != "" {
+							baseRelease, err := utils.GetReleaseByIdentifier(s.releases, r.Context(), project.ID, application.ID, baseIdentifier)
+							if err == store.ErrReleaseNotFound {
+								http.Error(w, err.Error(), http.StatusNotFound)
+								return
+							} else if err != nil {
+								log.WithError(err).Error("get/lookup base release")
+								w.WriteHeader(http.StatusInternalServerError)
+								return
+							}
+							baseConfig = baseRelease.Config
+							baseNumber = baseRelease.Number
+						}
+
+						utils.Respond(w, models.ReleaseDiff{
+							BaseRelease:   baseNumber,
+							TargetRelease: release.Number,
+							Services:      spec.Diff(baseConfig, release.Config),
+						})
+					})
+				})
+			},
+		)
+	})
+}
+
 func (s *Service) getLatestRelease(w http.ResponseWriter, r *http.Request) {
 	s.withUserOrServiceAccountAuth(w, r, func(user *models.User, serviceAccount *models.ServiceAccount) {
 		s.validateAuthorization(
@@ -2222,60 +2534,77 @@ func (s *Service) listDevices(w http.ResponseWriter, r *http.Request) {
 			w, r,
 			user, serviceAccount,
 			func(project *models.Project) {
-				searchQuery := r.URL.Query().Get("search")
-
-				devices, err := s.devices.ListDevices(r.Context(), project.ID, searchQuery)
+				pageParams, err := middleware.ParsePageParams(r.URL.Query())
 				if err != nil {
-					log.WithError(err).Error("list devices")
-					w.WriteHeader(http.StatusInternalServerError)
+					http.Error(w, err.Error(), http.StatusBadRequest)
 					return
 				}
 
-				w.Header().Set("Total-Device-Count", strconv.Itoa(len(devices)))
-
 				filters, err := query.FiltersFromQuery(r.URL.Query())
 				if err != nil {
 					http.Error(w, errors.Wrap(err, "get filters from query").Error(), http.StatusBadRequest)
 					return
 				}
 
-				if len(filters) != 0 {
-					appStatuses, err := s.deviceApplicationStatuses.ListAllDeviceApplicationStatuses(r.Context(), project.ID)
-					if err != nil {
-						http.Error(w, errors.Wrap(err, "get filter dependencies").Error(), http.StatusBadRequest)
+				if deviceGroupIdentifier := r.URL.Query().Get("group"); deviceGroupIdentifier != "" {
+					deviceGroup, err := s.getDeviceGroupByIdentifier(r.Context(), deviceGroupIdentifier, project.ID)
+					if err == store.ErrDeviceGroupNotFound {
+						http.Error(w, err.Error(), http.StatusBadRequest)
 						return
-					}
-					appStatusMap, err := utils.DeviceApplicationStatusesListToMap(appStatuses)
-					if err != nil {
-						http.Error(w, errors.Wrap(err, "get filter dependencies").Error(), http.StatusBadRequest)
+					} else if err != nil {
+						log.WithError(err).Error("lookup device group")
+						w.WriteHeader(http.StatusInternalServerError)
 						return
 					}
+					filters = append(filters, query.DeviceGroupFilter(deviceGroup.ID))
+				}
 
-					serviceStates, err := s.deviceServiceStates.ListAllDeviceServiceStates(r.Context(), project.ID)
-					if err != nil {
-						http.Error(w, errors.Wrap(err, "get filter dependencies").Error(), http.StatusBadRequest)
-						return
-					}
-					serviceStateMap, err := utils.DeviceServiceStatesListToMap(serviceStates)
-					if err != nil {
-						http.Error(w, errors.Wrap(err, "get filter dependencies").Error(), http.StatusBadRequest)
-						return
-					}
+				filters, validationErr, err := s.expandDeviceGroups(r.Context(), project.ID, filters)
+				if validationErr != nil {
+					http.Error(w, errors.Wrap(validationErr, "expand device groups").Error(), http.StatusBadRequest)
+					return
+				}
+				if err != nil {
+					log.WithError(err).Error("expand device groups")
+					w.WriteHeader(http.StatusInternalServerError)
+					return
+				}
 
-					devices, _, err = query.QueryDevices(
-						query.QueryDependencies{
-							DeviceApplicationStatuses: appStatusMap,
-							DeviceServiceStates:       serviceStateMap,
-							Releases:                  s.releases,
-							Context:                   r.Context(),
-						},
-						devices,
-						filters,
-					)
-					if err != nil {
-						http.Error(w, errors.Wrap(err, "filter devices").Error(), http.StatusBadRequest)
-						return
-					}
+				page, err := s.devices.QueryDevices(r.Context(), project.ID, store.DeviceQuery{
+					SearchQuery: r.URL.Query().Get("search"),
+					Filters:     filters,
+					OrderBy:     pageParams.OrderBy,
+					Descending:  pageParams.Direction == middleware.OrderDescending,
+					After:       pageParams.After,
+					PageSize:    pageParams.PageSize,
+				})
+				if err == store.ErrDevicePageNotFound {
+					http.Error(w, err.Error(), http.StatusBadRequest)
+					return
+				} else if err != nil {
+					log.WithError(err).Error("query devices")
+					w.WriteHeader(http.StatusInternalServerError)
+					return
+				}
+
+				w.Header().Set("Total-Device-Count", strconv.Itoa(page.TotalCount))
+
+				if page.Paginated {
+					middleware.RespondWithPage(w, page.Devices, page.MatchingCount, pageParams.PageSize)
+					return
+				}
+
+				// The store couldn't do everything, so the rest is done in
+				// memory
+				devices, validationErr, err := s.applyUnappliedFilters(r.Context(), project.ID, page)
+				if validationErr != nil {
+					http.Error(w, errors.Wrap(validationErr, "filter devices").Error(), http.StatusBadRequest)
+					return
+				}
+				if err != nil {
+					log.WithError(err).Error("filter devices")
+					w.WriteHeader(http.StatusInternalServerError)
+					return
 				}
 
 				ds := make([]interface{}, len(devices))
@@ -2289,6 +2618,64 @@ func (s *Service) listDevices(w http.ResponseWriter, r *http.Request) {
 	})
 }
 
+// applyUnappliedFilters evaluates the filters that the store couldn't.
+// Problems with the filters themselves are returned as validationErr.
+func (s *Service) applyUnappliedFilters(ctx context.Context, projectID string, page *store.DevicePage) (
+	devices []models.Device, validationErr error, err error,
+) {
+	if len(page.Unapplied) == 0 {
+		return page.Devices, nil, nil
+	}
+
+	queryDependencies, err := s.getQueryDependencies(ctx, projectID)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "get filter dependencies")
+	}
+
+	devices, _, err = query.QueryDevices(*queryDependencies, page.Devices, page.Unapplied)
+	if query.InvalidQuery(err) {
+		return nil, err, nil
+	} else if err != nil {
+		return nil, nil, err
+	}
+	return devices, nil, nil
+}
+
+// getQueryDependencies loads what's needed to evaluate every kind of
+// condition against the project's devices.
+func (s *Service) getQueryDependencies(ctx context.Context, projectID string) (*query.QueryDependencies, error) {
+	appStatuses, err := s.deviceApplicationStatuses.ListAllDeviceApplicationStatuses(ctx, projectID)
+	if err != nil {
+		return nil, err
+	}
+	appStatusMap, err := utils.DeviceApplicationStatusesListToMap(appStatuses)
+	if err != nil {
+		return nil, err
+	}
+
+	serviceStates, err := s.deviceServiceStates.ListAllDeviceServiceStates(ctx, projectID)
+	if err != nil {
+		return nil, err
+	}
+	serviceStateMap, err := utils.DeviceServiceStatesListToMap(serviceStates)
+	if err != nil {
+		return nil, err
+	}
+
+	deviceGroups, err := s.getDeviceGroupQueries(ctx, projectID)
+	if err != nil {
+		return nil, err
+	}
+
+	return &query.QueryDependencies{
+		DeviceApplicationStatuses: appStatusMap,
+		DeviceServiceStates:       serviceStateMap,
+		Releases:                  s.releases,
+		Context:                   ctx,
+		DeviceGroups:              deviceGroups,
+	}, nil
+}
+
 func (s *Service) previewScheduledDevices(w http.ResponseWriter, r *http.Request) {
 	s.withUserOrServiceAccountAuth(w, r, func(user *models.User, serviceAccount *models.ServiceAccount) {
 		s.validateAuthorization(
@@ -2296,39 +2683,61 @@ func (s *Service) previewScheduledDevices(w http.ResponseWriter, r *http.Request
 			w, r,
 			user, serviceAccount,
 			func(project *models.Project) {
-				searchQuery := r.URL.Query().Get("search")
+				filters, err := query.FiltersFromQuery(r.URL.Query())
+				if err != nil {
+					http.Error(w, errors.Wrap(err, "get filters from query").Error(), http.StatusBadRequest)
+					return
+				}
+
+				schedulingRule, err := scheduling.SchedulingRuleFromQuery(r.URL.Query())
+				if schedulingRule == nil && err == nil {
+					err = scheduling.ErrNonexistentSchedulingRule
+				}
+				if err != nil {
+					http.Error(w, errors.Wrap(err, "get scheduling rule from query").Error(), http.StatusBadRequest)
+					return
+				}
+
+				// Only devices that match the rule's query can be scheduled, so
+				// it narrows down the devices that need to be loaded
+				storeFilters := filters
+				if schedulingRule.ScheduleType == models.ScheduleTypeConditional && schedulingRule.ConditionalQuery != nil {
+					storeFilters = append(append(models.Query{}, filters...), *schedulingRule.ConditionalQuery...)
+				}
 
-				devices, err := s.devices.ListDevices(r.Context(), project.ID, searchQuery)
+				schedulingDependencies, err := s.getSchedulingDependencies(r.Context(), project.ID)
 				if err != nil {
-					log.WithError(err).Error("list devices")
+					log.WithError(err).Error("get scheduling dependencies")
 					w.WriteHeader(http.StatusInternalServerError)
 					return
 				}
 
-				filters, err := query.FiltersFromQuery(r.URL.Query())
+				storeFilters, err = query.ExpandDeviceGroups(storeFilters, schedulingDependencies.DeviceGroups)
 				if err != nil {
-					http.Error(w, errors.Wrap(err, "get filters from query").Error(), http.StatusBadRequest)
+					http.Error(w, errors.Wrap(err, "expand device groups").Error(), http.StatusBadRequest)
+					return
+				}
+
+				page, err := s.devices.QueryDevices(r.Context(), project.ID, store.DeviceQuery{
+					SearchQuery: r.URL.Query().Get("search"),
+					Filters:     storeFilters,
+				})
+				if err != nil {
+					log.WithError(err).Error("query devices")
+					w.WriteHeader(http.StatusInternalServerError)
 					return
 				}
 
-				if len(filters) != 0 {
-					devices, _, err = query.QueryDevices(query.QueryDependencies{}, devices, filters)
+				devices := page.Devices
+				if len(page.Unapplied) != 0 {
+					devices, _, err = query.QueryDevices(*schedulingDependencies, devices, page.Unapplied)
 					if err != nil {
 						http.Error(w, errors.Wrap(err, "filter devices").Error(), http.StatusBadRequest)
 						return
 					}
 				}
 
-				schedulingRule, err := scheduling.SchedulingRuleFromQuery(r.URL.Query())
-				if schedulingRule == nil && err == nil {
-					err = scheduling.ErrNonexistentSchedulingRule
-				}
-				if err != nil {
-					http.Error(w, errors.Wrap(err, "get scheduling rule from query").Error(), http.StatusBadRequest)
-					return
-				}
-
-				scheduledDevices, err := scheduling.GetScheduledDevices(devices, *schedulingRule)
+				scheduledDevices, err := scheduling.GetScheduledDevices(*schedulingDependencies, devices, *schedulingRule)
 				if err != nil {
 					http.Error(w, errors.Wrap(err, "preview scheduling rule").Error(), http.StatusBadRequest)
 					return
@@ -2957,6 +3366,14 @@ func (s *Service) getProjectConfig(w http.ResponseWriter, r *http.Request) {
 					value, err = s.metricConfigs.GetDeviceMetricsConfig(r.Context(), project.ID)
 				case string(models.ServiceMetricsConfigKey):
 					value, err = s.metricConfigs.GetServiceMetricsConfigs(r.Context(), project.ID)
+				case string(models.SecurityConfigKey):
+					value, err = s.securityConfigs.GetSecurityConfig(r.Context(), project.ID)
+				case string(models.MetricsSinkConfigKey):
+					var metricsSinkConfig *models.MetricsSinkConfig
+					metricsSinkConfig, err = s.metricConfigs.GetMetricsSinkConfig(r.Context(), project.ID)
+					if err == nil {
+						value = redactMetricsSinkConfig(*metricsSinkConfig)
+					}
 				default:
 					http.Error(w, store.ErrProjectConfigNotFound.Error(), http.StatusBadRequest)
 					return
@@ -3011,6 +3428,34 @@ func (s *Service) setProjectConfig(w http.ResponseWriter, r *http.Request) {
 					}
 
 					err = s.metricConfigs.SetServiceMetricsConfigs(r.Context(), project.ID, values)
+				case string(models.SecurityConfigKey):
+					var value models.SecurityConfig
+					if err := read(r, &value); err != nil {
+						http.Error(w, err.Error(), http.StatusBadRequest)
+						return
+					}
+
+					err = s.securityConfigs.SetSecurityConfig(r.Context(), project.ID, value)
+				case string(models.MetricsSinkConfigKey):
+					var value models.MetricsSinkConfig
+					if err := read(r, &value); err != nil {
+						http.Error(w, err.Error(), http.StatusBadRequest)
+						return
+					}
+					if value.Type != "" && value.Type != models.MetricsSinkTypeDatadog && value.URL == "" {
+						http.Error(w, errMetricsSinkURLRequired.Error(), http.StatusBadRequest)
+						return
+					}
+
+					var current *models.MetricsSinkConfig
+					current, err = s.metricConfigs.GetMetricsSinkConfig(r.Context(), project.ID)
+					if err != nil {
+						log.WithError(err).Error("get project config with key " + key)
+						w.WriteHeader(http.StatusInternalServerError)
+						return
+					}
+
+					err = s.metricConfigs.SetMetricsSinkConfig(r.Context(), project.ID, unredactMetricsSinkConfig(value, *current))
 				default:
 					http.Error(w, store.ErrProjectConfigNotFound.Error(), http.StatusBadRequest)
 					return
@@ -3045,6 +3490,17 @@ func (s *Service) registerDevice(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// Check the CSR before creating the device so a bad one doesn't leave
+	// an unusable device behind
+	var csr *x509.CertificateRequest
+	if registerDeviceRequest.CertificateSigningRequest != "" {
+		csr, err = deviceca.ParseCSR([]byte(registerDeviceRequest.CertificateSigningRequest))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+
 	if deviceRegistrationToken.MaxRegistrations != nil {
 		devicesRegisteredCount, err := s.devicesRegisteredWithToken.GetDevicesRegisteredWithTokenCount(r.Context(), registerDeviceRequest.DeviceRegistrationTokenID, projectID)
 		if err != nil {
@@ -3070,6 +3526,21 @@ func (s *Service) registerDevice(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if csr != nil {
+		deviceCertificate, err := s.issueDeviceCertificate(r.Context(), projectID, device.ID, csr)
+		if err != nil {
+			log.WithError(err).Error("issue device certificate")
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		utils.Respond(w, models.RegisterDeviceResponse{
+			DeviceID:          device.ID,
+			DeviceCertificate: deviceCertificate,
+		})
+		return
+	}
+
 	deviceAccessKeyValue := ksuid.New().String()
 
 	_, err = s.deviceAccessKeys.CreateDeviceAccessKey(r.Context(), projectID, device.ID, hash.Hash(deviceAccessKeyValue))
@@ -3101,6 +3572,17 @@ func (s *Service) getBundle(w http.ResponseWriter, r *http.Request) {
 			return
 		}
 
+		// Quarantined devices stop all of their applications but keep
+		// checking in so they can be released from quarantine
+		if device.Quarantined {
+			utils.Respond(w, models.Bundle{
+				DeviceID:    device.ID,
+				DeviceName:  device.Name,
+				Quarantined: true,
+			})
+			return
+		}
+
 		applications, err := s.applications.ListApplications(r.Context(), project.ID)
 		if err != nil {
 			log.WithError(err).Error("list applications")
@@ -3108,6 +3590,13 @@ func (s *Service) getBundle(w http.ResponseWriter, r *http.Request) {
 			return
 		}
 
+		schedulingDependencies, err := s.getSchedulingDependencies(r.Context(), project.ID)
+		if err != nil {
+			log.WithError(err).Error("get scheduling dependencies")
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
 		bundle := models.Bundle{
 			DeviceID:             device.ID,
 			DeviceName:           device.Name,
@@ -3116,7 +3605,7 @@ func (s *Service) getBundle(w http.ResponseWriter, r *http.Request) {
 		}
 
 		for _, application := range applications {
-			scheduled, scheduledDevice, err := scheduling.IsApplicationScheduled(*device, application.SchedulingRule)
+			scheduled, scheduledDevice, err := scheduling.IsApplicationScheduled(*schedulingDependencies, *device, application.SchedulingRule)
 			if err != nil {
 				log.WithError(err).Error("evaluate application scheduling rule")
 				w.WriteHeader(http.StatusInternalServerError)
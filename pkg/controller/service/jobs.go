@@ -0,0 +1,100 @@
+package service
+
+import (
+	"net/http"
+
+	"github.com/apex/log"
+	"github.com/deviceplane/deviceplane/pkg/controller/authz"
+	"github.com/deviceplane/deviceplane/pkg/models"
+	"github.com/deviceplane/deviceplane/pkg/utils"
+)
+
+// registerJobTypes sets how the job runner applies each type of job that
+// the service creates.
+func (s *Service) registerJobTypes() {
+	if s.jobRunner == nil {
+		return
+	}
+	s.jobRunner.Register(models.JobTypeBulkDeviceOperation, s.runBulkDeviceJobItem)
+}
+
+func (s *Service) listJobs(w http.ResponseWriter, r *http.Request) {
+	s.withUserOrServiceAccountAuth(w, r, func(user *models.User, serviceAccount *models.ServiceAccount) {
+		s.validateAuthorization(
+			authz.ResourceJobs, authz.ActionListJobs,
+			w, r,
+			user, serviceAccount,
+			func(project *models.Project) {
+				jobs, err := s.jobs.ListJobs(r.Context(), project.ID)
+				if err != nil {
+					log.WithError(err).Error("list jobs")
+					w.WriteHeader(http.StatusInternalServerError)
+					return
+				}
+
+				utils.Respond(w, jobs)
+			},
+		)
+	})
+}
+
+func (s *Service) getJob(w http.ResponseWriter, r *http.Request) {
+	s.withUserOrServiceAccountAuth(w, r, func(user *models.User, serviceAccount *models.ServiceAccount) {
+		s.validateAuthorization(
+			authz.ResourceJobs, authz.ActionGetJob,
+			w, r,
+			user, serviceAccount,
+			func(project *models.Project) {
+				s.withJob(w, r, project, func(job *models.Job) {
+					utils.Respond(w, job)
+				})
+			},
+		)
+	})
+}
+
+func (s *Service) listJobItems(w http.ResponseWriter, r *http.Request) {
+	s.withUserOrServiceAccountAuth(w, r, func(user *models.User, serviceAccount *models.ServiceAccount) {
+		s.validateAuthorization(
+			authz.ResourceJobs, authz.ActionGetJob,
+			w, r,
+			user, serviceAccount,
+			func(project *models.Project) {
+				s.withJob(w, r, project, func(job *models.Job) {
+					jobItems, err := s.jobs.ListJobItems(r.Context(), job.ID, project.ID)
+					if err != nil {
+						log.WithError(err).Error("list job items")
+						w.WriteHeader(http.StatusInternalServerError)
+						return
+					}
+
+					utils.Respond(w, jobItems)
+				})
+			},
+		)
+	})
+}
+
+func (s *Service) cancelJob(w http.ResponseWriter, r *http.Request) {
+	s.withUserOrServiceAccountAuth(w, r, func(user *models.User, serviceAccount *models.ServiceAccount) {
+		s.validateAuthorization(
+			authz.ResourceJobs, authz.ActionCancelJob,
+			w, r,
+			user, serviceAccount,
+			func(project *models.Project) {
+				s.withJob(w, r, project, func(job *models.Job) {
+					// Running jobs stop once their runner sees the request,
+					// leaving any items that weren't reached pending
+					job, err := s.jobs.CancelJob(r.Context(), job.ID, project.ID)
+					if err != nil {
+						log.WithError(err).Error("cancel job")
+						w.WriteHeader(http.StatusInternalServerError)
+						return
+					}
+
+					utils.Respond(w, job)
+				})
+			},
+		)
+	})
+}
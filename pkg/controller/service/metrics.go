@@ -1,16 +1,92 @@
 package service
 
 import (
+	"context"
 	"encoding/json"
 	"net/http"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/apex/log"
-	"github.com/deviceplane/deviceplane/pkg/metrics/datadog"
+	"github.com/deviceplane/deviceplane/pkg/controller/authz"
+	"github.com/deviceplane/deviceplane/pkg/controller/metricstorage"
 	"github.com/deviceplane/deviceplane/pkg/metrics/datadog/processing"
+	"github.com/deviceplane/deviceplane/pkg/metrics/sink"
 	"github.com/deviceplane/deviceplane/pkg/models"
 	"github.com/deviceplane/deviceplane/pkg/utils"
+	"github.com/pkg/errors"
 )
 
+const (
+	defaultMetricQueryRange  = time.Hour
+	defaultMetricQueryPoints = 300
+
+	// Metrics sink headers usually hold credentials, so their values are
+	// replaced with this when the config is read. Setting a header to it
+	// keeps the stored value.
+	redactedMetricsSinkHeaderValue = "<redacted>"
+)
+
+var (
+	errMetricsSinkURLRequired = errors.New("metrics sinks other than Datadog require a URL")
+	errMetricsSinkFailed      = errors.New("metrics couldn't be posted to the project's metrics sink")
+	errMetricStorageDisabled  = errors.New("metric storage isn't enabled on this controller")
+	errMetricRequired         = errors.New("metric is required")
+	errInvalidMetricQueryTag  = errors.New("tags must be in the form key:value")
+	errInvalidMetricQueryTime = errors.New("times must be RFC 3339 or unix timestamps")
+	errInvalidMetricQueryStep = errors.New("step must be a duration such as 30s or 5m")
+)
+
+// getMetricsSink returns where the project's metrics should be forwarded to.
+// It returns sink.ErrDatadogAPIKeyMissing if the project hasn't configured a
+// sink.
+func (s *Service) getMetricsSink(ctx context.Context, project *models.Project) (sink.Sink, error) {
+	metricsSinkConfig, err := s.metricConfigs.GetMetricsSinkConfig(ctx, project.ID)
+	if err != nil {
+		return nil, err
+	}
+	return sink.New(*metricsSinkConfig, project, s.metricsSinkAllowedHosts)
+}
+
+func redactMetricsSinkConfig(config models.MetricsSinkConfig) models.MetricsSinkConfig {
+	if config.Headers != nil {
+		headers := make(map[string]string, len(config.Headers))
+		for k := range config.Headers {
+			headers[k] = redactedMetricsSinkHeaderValue
+		}
+		config.Headers = headers
+	}
+	return config
+}
+
+// unredactMetricsSinkConfig restores header values that were set to the
+// redacted value from the currently stored config.
+func unredactMetricsSinkConfig(config models.MetricsSinkConfig, current models.MetricsSinkConfig) models.MetricsSinkConfig {
+	for k, v := range config.Headers {
+		if v == redactedMetricsSinkHeaderValue {
+			config.Headers[k] = current.Headers[k]
+		}
+	}
+	return config
+}
+
+// respondMetricsSinkError responds to a device whose metrics couldn't be
+// posted to the project's sink. Devices retry requests that fail with a
+// server error, which would store the metrics again, so the request is
+// accepted if the metrics were stored. Otherwise devices keep the metrics to
+// retry unless the sink rejected them for good.
+func respondMetricsSinkError(w http.ResponseWriter, stored bool, err error) {
+	switch {
+	case stored:
+		return
+	case sink.Permanent(err):
+		http.Error(w, errMetricsSinkFailed.Error(), http.StatusFailedDependency)
+	default:
+		http.Error(w, errMetricsSinkFailed.Error(), http.StatusServiceUnavailable)
+	}
+}
+
 func (s *Service) forwardServiceMetrics(w http.ResponseWriter, r *http.Request) {
 	s.withDeviceAuth(w, r, func(project *models.Project, device *models.Device) {
 		pass := func() bool {
@@ -55,12 +131,33 @@ func (s *Service) forwardServiceMetrics(w http.ResponseWriter, r *http.Request)
 				}
 			}
 
-			client := datadog.NewClient(*project.DatadogAPIKey)
-			if err := client.PostMetrics(r.Context(), forwardedMetricsRequest); err != nil {
-				log.WithError(err).Error("post service metrics")
+			// Storage is best effort so that it can't keep metrics from
+			// reaching the sink
+			var stored bool
+			if s.metricStorage != nil {
+				if err := s.metricStorage.Write(r.Context(), project.ID, device.ID, forwardedMetricsRequest.Series); err != nil {
+					log.WithField("project_id", project.ID).
+						WithError(err).Error("storing metrics")
+				} else {
+					stored = true
+				}
+			}
+
+			metricsSink, err := s.getMetricsSink(r.Context(), project)
+			if err == sink.ErrDatadogAPIKeyMissing {
+				return true
+			} else if err != nil {
+				log.WithField("project_id", project.ID).
+					WithError(err).Error("getting metrics sink")
 				w.WriteHeader(http.StatusInternalServerError)
 				return false
 			}
+
+			if err := metricsSink.PostMetrics(r.Context(), forwardedMetricsRequest); err != nil {
+				log.WithError(err).Error("post service metrics")
+				respondMetricsSinkError(w, stored, err)
+				return false
+			}
 			return true
 		}()
 
@@ -106,12 +203,33 @@ func (s *Service) forwardDeviceMetrics(w http.ResponseWriter, r *http.Request) {
 				device,
 			)
 
-			client := datadog.NewClient(*project.DatadogAPIKey)
-			if err := client.PostMetrics(r.Context(), forwardedMetricsRequest); err != nil {
-				log.WithError(err).Error("post device metrics")
+			// Storage is best effort so that it can't keep metrics from
+			// reaching the sink
+			var stored bool
+			if s.metricStorage != nil {
+				if err := s.metricStorage.Write(r.Context(), project.ID, device.ID, forwardedMetricsRequest.Series); err != nil {
+					log.WithField("project_id", project.ID).
+						WithError(err).Error("storing metrics")
+				} else {
+					stored = true
+				}
+			}
+
+			metricsSink, err := s.getMetricsSink(r.Context(), project)
+			if err == sink.ErrDatadogAPIKeyMissing {
+				return true
+			} else if err != nil {
+				log.WithField("project_id", project.ID).
+					WithError(err).Error("getting metrics sink")
 				w.WriteHeader(http.StatusInternalServerError)
 				return false
 			}
+
+			if err := metricsSink.PostMetrics(r.Context(), forwardedMetricsRequest); err != nil {
+				log.WithError(err).Error("post device metrics")
+				respondMetricsSinkError(w, stored, err)
+				return false
+			}
 			return true
 		}()
 
@@ -130,3 +248,94 @@ func (s *Service) forwardDeviceMetrics(w http.ResponseWriter, r *http.Request) {
 		)
 	})
 }
+
+// queryMetrics reads metrics from the controller's own storage. Series can be
+// filtered by passing tag=key:value any number of times. The range defaults
+// to the last hour and the step to one that gives a few hundred points.
+func (s *Service) queryMetrics(w http.ResponseWriter, r *http.Request) {
+	s.withUserOrServiceAccountAuth(w, r, func(user *models.User, serviceAccount *models.ServiceAccount) {
+		s.validateAuthorization(
+			authz.ResourceDevices, authz.ActionQueryMetrics,
+			w, r,
+			user, serviceAccount,
+			func(project *models.Project) {
+				if s.metricStorage == nil {
+					http.Error(w, errMetricStorageDisabled.Error(), http.StatusNotFound)
+					return
+				}
+
+				values := r.URL.Query()
+
+				query := metricstorage.Query{
+					Metric: values.Get("metric"),
+					Tags:   make(map[string]string),
+				}
+				if query.Metric == "" {
+					http.Error(w, errMetricRequired.Error(), http.StatusBadRequest)
+					return
+				}
+
+				for _, tag := range values["tag"] {
+					parts := strings.SplitN(tag, ":", 2)
+					if len(parts) != 2 {
+						http.Error(w, errInvalidMetricQueryTag.Error(), http.StatusBadRequest)
+						return
+					}
+					query.Tags[parts[0]] = parts[1]
+				}
+
+				var err error
+				query.End = time.Now()
+				if end := values.Get("end"); end != "" {
+					if query.End, err = parseMetricQueryTime(end); err != nil {
+						http.Error(w, err.Error(), http.StatusBadRequest)
+						return
+					}
+				}
+				query.Start = query.End.Add(-defaultMetricQueryRange)
+				if start := values.Get("start"); start != "" {
+					if query.Start, err = parseMetricQueryTime(start); err != nil {
+						http.Error(w, err.Error(), http.StatusBadRequest)
+						return
+					}
+				}
+
+				query.Step = (query.End.Sub(query.Start) / defaultMetricQueryPoints).Truncate(time.Second)
+				if query.Step < time.Second {
+					query.Step = time.Second
+				}
+				if step := values.Get("step"); step != "" {
+					if query.Step, err = time.ParseDuration(step); err != nil {
+						http.Error(w, errInvalidMetricQueryStep.Error(), http.StatusBadRequest)
+						return
+					}
+				}
+
+				results, err := s.metricStorage.Query(r.Context(), project.ID, query)
+				switch err {
+				case nil:
+				case metricstorage.ErrInvalidRange, metricstorage.ErrInvalidStep, metricstorage.ErrTooManyPoints:
+					http.Error(w, err.Error(), http.StatusBadRequest)
+					return
+				default:
+					log.WithError(err).Error("query metrics")
+					w.WriteHeader(http.StatusInternalServerError)
+					return
+				}
+
+				utils.Respond(w, results)
+			},
+		)
+	})
+}
+
+func parseMetricQueryTime(value string) (time.Time, error) {
+	if unix, err := strconv.ParseInt(value, 10, 64); err == nil {
+		return time.Unix(unix, 0), nil
+	}
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return time.Time{}, errInvalidMetricQueryTime
+	}
+	return t, nil
+}
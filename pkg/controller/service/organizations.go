@@ -0,0 +1,628 @@
+package service
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/apex/log"
+	"github.com/deviceplane/deviceplane/pkg/controller/authz"
+	"github.com/deviceplane/deviceplane/pkg/controller/store"
+	"github.com/deviceplane/deviceplane/pkg/models"
+	"github.com/deviceplane/deviceplane/pkg/utils"
+	"github.com/gorilla/mux"
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v2"
+)
+
+var errOrganizationHasProjects = errors.New("organization still has projects")
+
+func (s *Service) createOrganization(w http.ResponseWriter, r *http.Request) {
+	s.withUserAuth(w, r, func(user *models.User) {
+		var createOrganizationRequest struct {
+			Name         string `json:"name" validate:"name"`
+			BillingEmail string `json:"billingEmail" validate:"omitempty,email"`
+		}
+		if err := read(r, &createOrganizationRequest); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		if _, err := s.organizations.LookupOrganization(r.Context(), createOrganizationRequest.Name); err == nil {
+			http.Error(w, store.ErrOrganizationNameAlreadyInUse.Error(), http.StatusBadRequest)
+			return
+		} else if err != nil && err != store.ErrOrganizationNotFound {
+			log.WithError(err).Error("lookup organization")
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		organization, err := s.createOrganizationWithDefaults(r.Context(), user.ID,
+			createOrganizationRequest.Name, createOrganizationRequest.BillingEmail)
+		if err != nil {
+			log.WithError(err).Error("create organization")
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		utils.Respond(w, organization)
+	})
+}
+
+// createOrganizationWithDefaults creates an organization with the default
+// roles and makes the user a member with the admin role. If any of that
+// fails, the organization is deleted again, which also deletes whatever else
+// was created for it.
+func (s *Service) createOrganizationWithDefaults(ctx context.Context, userID, name, billingEmail string) (*models.Organization, error) {
+	organization, err := s.organizations.CreateOrganization(ctx, name, billingEmail)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.createOrganizationDefaults(ctx, userID, organization.ID); err != nil {
+		if deleteErr := s.organizations.DeleteOrganization(ctx, organization.ID); deleteErr != nil {
+			log.WithError(deleteErr).Error("delete partially created organization")
+		}
+		return nil, err
+	}
+
+	return organization, nil
+}
+
+func (s *Service) createOrganizationDefaults(ctx context.Context, userID, organizationID string) error {
+	if _, err := s.organizationMemberships.CreateOrganizationMembership(ctx, userID, organizationID); err != nil {
+		return errors.Wrap(err, "create organization membership")
+	}
+
+	var adminRole *models.OrganizationRole
+	for _, defaultRole := range []struct {
+		name   string
+		config authz.Config
+	}{
+		{"admin-all", authz.AdminAllRole},
+		{"write-all", authz.WriteAllRole},
+		{"read-all", authz.ReadAllRole},
+	} {
+		configBytes, err := yaml.Marshal(defaultRole.config)
+		if err != nil {
+			return errors.Wrapf(err, "marshal %s role config", defaultRole.name)
+		}
+
+		role, err := s.organizationRoles.CreateOrganizationRole(ctx, organizationID,
+			defaultRole.name, "", string(configBytes))
+		if err != nil {
+			return errors.Wrapf(err, "create %s role", defaultRole.name)
+		}
+
+		if adminRole == nil {
+			adminRole = role
+		}
+	}
+
+	if _, err := s.organizationMembershipRoleBindings.CreateOrganizationMembershipRoleBinding(ctx,
+		userID, adminRole.ID, organizationID,
+	); err != nil {
+		return errors.Wrap(err, "create organization membership role binding")
+	}
+
+	return nil
+}
+
+func (s *Service) getOrganization(w http.ResponseWriter, r *http.Request) {
+	s.withOrganizationUserAuth(w, r, func(user *models.User) {
+		s.validateOrganizationAuthorization(
+			authz.ResourceOrganizations, authz.ActionGetOrganization,
+			w, r,
+			user,
+			func(organization *models.Organization) {
+				utils.Respond(w, organization)
+			},
+		)
+	})
+}
+
+func (s *Service) updateOrganization(w http.ResponseWriter, r *http.Request) {
+	s.withOrganizationUserAuth(w, r, func(user *models.User) {
+		s.validateOrganizationAuthorization(
+			authz.ResourceOrganizations, authz.ActionUpdateOrganization,
+			w, r,
+			user,
+			func(organization *models.Organization) {
+				var updateOrganizationRequest struct {
+					Name         string `json:"name" validate:"name"`
+					BillingEmail string `json:"billingEmail" validate:"omitempty,email"`
+				}
+				if err := read(r, &updateOrganizationRequest); err != nil {
+					http.Error(w, err.Error(), http.StatusBadRequest)
+					return
+				}
+
+				if o, err := s.organizations.LookupOrganization(r.Context(),
+					updateOrganizationRequest.Name); err == nil && o.ID != organization.ID {
+					http.Error(w, store.ErrOrganizationNameAlreadyInUse.Error(), http.StatusBadRequest)
+					return
+				} else if err != nil && err != store.ErrOrganizationNotFound {
+					log.WithError(err).Error("lookup organization")
+					w.WriteHeader(http.StatusInternalServerError)
+					return
+				}
+
+				o, err := s.organizations.UpdateOrganization(r.Context(), organization.ID,
+					updateOrganizationRequest.Name, updateOrganizationRequest.BillingEmail)
+				if err != nil {
+					log.WithError(err).Error("update organization")
+					w.WriteHeader(http.StatusInternalServerError)
+					return
+				}
+
+				utils.Respond(w, o)
+			},
+		)
+	})
+}
+
+func (s *Service) deleteOrganization(w http.ResponseWriter, r *http.Request) {
+	s.withOrganizationUserAuth(w, r, func(user *models.User) {
+		s.validateOrganizationAuthorization(
+			authz.ResourceOrganizations, authz.ActionDeleteOrganization,
+			w, r,
+			user,
+			func(organization *models.Organization) {
+				projects, err := s.projects.ListProjectsByOrganization(r.Context(), organization.ID)
+				if err != nil {
+					log.WithError(err).Error("list projects by organization")
+					w.WriteHeader(http.StatusInternalServerError)
+					return
+				}
+
+				if len(projects) > 0 {
+					http.Error(w, errOrganizationHasProjects.Error(), http.StatusBadRequest)
+					return
+				}
+
+				if err := s.organizations.DeleteOrganization(r.Context(), organization.ID); err != nil {
+					log.WithError(err).Error("delete organization")
+					w.WriteHeader(http.StatusInternalServerError)
+					return
+				}
+			},
+		)
+	})
+}
+
+func (s *Service) listOrganizationMembershipsByUser(w http.ResponseWriter, r *http.Request) {
+	s.withUserAuth(w, r, func(user *models.User) {
+		memberships, err := s.organizationMemberships.ListOrganizationMembershipsByUser(r.Context(), user.ID)
+		if err != nil {
+			log.WithError(err).Error("list organization memberships by user")
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		utils.Respond(w, memberships)
+	})
+}
+
+func (s *Service) listOrganizationProjects(w http.ResponseWriter, r *http.Request) {
+	s.withOrganizationUserAuth(w, r, func(user *models.User) {
+		s.validateOrganizationAuthorization(
+			authz.ResourceOrganizations, authz.ActionListOrganizationProjects,
+			w, r,
+			user,
+			func(organization *models.Organization) {
+				projects, err := s.projects.ListProjectsByOrganization(r.Context(), organization.ID)
+				if err != nil {
+					log.WithError(err).Error("list projects by organization")
+					w.WriteHeader(http.StatusInternalServerError)
+					return
+				}
+
+				utils.Respond(w, projects)
+			},
+		)
+	})
+}
+
+func (s *Service) createOrganizationProject(w http.ResponseWriter, r *http.Request) {
+	s.withOrganizationUserAuth(w, r, func(user *models.User) {
+		s.validateOrganizationAuthorization(
+			authz.ResourceOrganizations, authz.ActionCreateOrganizationProject,
+			w, r,
+			user,
+			func(organization *models.Organization) {
+				var createProjectRequest struct {
+					Name string `json:"name" validate:"name"`
+				}
+				if err := read(r, &createProjectRequest); err != nil {
+					http.Error(w, err.Error(), http.StatusBadRequest)
+					return
+				}
+
+				if _, err := s.projects.LookupProject(r.Context(), createProjectRequest.Name); err == nil {
+					http.Error(w, store.ErrProjectNameAlreadyInUse.Error(), http.StatusBadRequest)
+					return
+				} else if err != nil && err != store.ErrProjectNotFound {
+					log.WithError(err).Error("lookup project")
+					w.WriteHeader(http.StatusInternalServerError)
+					return
+				}
+
+				project, err := s.createProjectWithDefaults(r.Context(), user.ID,
+					createProjectRequest.Name, &organization.ID)
+				if err != nil {
+					log.WithError(err).Error("create project")
+					w.WriteHeader(http.StatusInternalServerError)
+					return
+				}
+
+				utils.Respond(w, project)
+			},
+		)
+	})
+}
+
+func (s *Service) listOrganizationMemberships(w http.ResponseWriter, r *http.Request) {
+	s.withOrganizationUserAuth(w, r, func(user *models.User) {
+		s.validateOrganizationAuthorization(
+			authz.ResourceOrganizationMemberships, authz.ActionListOrganizationMemberships,
+			w, r,
+			user,
+			func(organization *models.Organization) {
+				memberships, err := s.organizationMemberships.ListOrganizationMembershipsByOrganization(r.Context(), organization.ID)
+				if err != nil {
+					log.WithError(err).Error("list organization memberships by organization")
+					w.WriteHeader(http.StatusInternalServerError)
+					return
+				}
+
+				utils.Respond(w, memberships)
+			},
+		)
+	})
+}
+
+func (s *Service) createOrganizationMembership(w http.ResponseWriter, r *http.Request) {
+	s.withOrganizationUserAuth(w, r, func(user *models.User) {
+		s.validateOrganizationAuthorization(
+			authz.ResourceOrganizationMemberships, authz.ActionCreateOrganizationMembership,
+			w, r,
+			user,
+			func(organization *models.Organization) {
+				var createMembershipRequest struct {
+					Email  *string `json:"email" validate:"omitempty,email"`
+					UserID *string `json:"userId" validate:"omitempty,id"`
+				}
+				if err := read(r, &createMembershipRequest); err != nil {
+					http.Error(w, err.Error(), http.StatusBadRequest)
+					return
+				}
+
+				var member *models.User
+				if createMembershipRequest.UserID != nil {
+					var err error
+					member, err = s.users.GetUser(r.Context(), *createMembershipRequest.UserID)
+					if err == store.ErrUserNotFound {
+						http.Error(w, err.Error(), http.StatusNotFound)
+						return
+					} else if err != nil {
+						log.WithError(err).Error("get user")
+						w.WriteHeader(http.StatusInternalServerError)
+						return
+					}
+				} else if createMembershipRequest.Email != nil {
+					internalUser, err := s.internalUsers.LookupInternalUser(r.Context(), *createMembershipRequest.Email)
+					if err == store.ErrUserNotFound {
+						http.Error(w, err.Error(), http.StatusNotFound)
+						return
+					} else if err != nil {
+						log.WithError(err).Error("lookup internal user")
+						w.WriteHeader(http.StatusInternalServerError)
+						return
+					}
+					member, err = s.users.GetUserByInternalID(r.Context(), internalUser.ID)
+					if err == store.ErrUserNotFound {
+						http.Error(w, err.Error(), http.StatusNotFound)
+						return
+					} else if err != nil {
+						log.WithError(err).Error("get user by internal user id")
+						w.WriteHeader(http.StatusInternalServerError)
+						return
+					}
+				} else {
+					http.Error(w, "either email or user ID must exist", http.StatusBadRequest)
+					return
+				}
+
+				membership, err := s.organizationMemberships.CreateOrganizationMembership(r.Context(), member.ID, organization.ID)
+				if err != nil {
+					log.WithError(err).Error("create organization membership")
+					w.WriteHeader(http.StatusInternalServerError)
+					return
+				}
+
+				utils.Respond(w, membership)
+			},
+		)
+	})
+}
+
+func (s *Service) getOrganizationMembership(w http.ResponseWriter, r *http.Request) {
+	s.withOrganizationUserAuth(w, r, func(user *models.User) {
+		s.validateOrganizationAuthorization(
+			authz.ResourceOrganizationMemberships, authz.ActionGetOrganizationMembership,
+			w, r,
+			user,
+			func(organization *models.Organization) {
+				membership, err := s.organizationMemberships.GetOrganizationMembership(r.Context(),
+					mux.Vars(r)["user"], organization.ID)
+				if err == store.ErrOrganizationMembershipNotFound {
+					http.Error(w, err.Error(), http.StatusNotFound)
+					return
+				} else if err != nil {
+					log.WithError(err).Error("get organization membership")
+					w.WriteHeader(http.StatusInternalServerError)
+					return
+				}
+
+				utils.Respond(w, membership)
+			},
+		)
+	})
+}
+
+func (s *Service) deleteOrganizationMembership(w http.ResponseWriter, r *http.Request) {
+	s.withOrganizationUserAuth(w, r, func(user *models.User) {
+		s.validateOrganizationAuthorization(
+			authz.ResourceOrganizationMemberships, authz.ActionDeleteOrganizationMembership,
+			w, r,
+			user,
+			func(organization *models.Organization) {
+				if err := s.organizationMemberships.DeleteOrganizationMembership(r.Context(),
+					mux.Vars(r)["user"], organization.ID); err != nil {
+					log.WithError(err).Error("delete organization membership")
+					w.WriteHeader(http.StatusInternalServerError)
+					return
+				}
+			},
+		)
+	})
+}
+
+func (s *Service) createOrganizationRole(w http.ResponseWriter, r *http.Request) {
+	s.withOrganizationUserAuth(w, r, func(user *models.User) {
+		s.validateOrganizationAuthorization(
+			authz.ResourceOrganizationRoles, authz.ActionCreateOrganizationRole,
+			w, r,
+			user,
+			func(organization *models.Organization) {
+				var createRoleRequest struct {
+					Name        string `json:"name" validate:"name"`
+					Description string `json:"description" validate:"description"`
+					Config      string `json:"config" validate:"config"`
+				}
+				if err := read(r, &createRoleRequest); err != nil {
+					http.Error(w, err.Error(), http.StatusBadRequest)
+					return
+				}
+
+				if _, err := s.organizationRoles.LookupOrganizationRole(r.Context(),
+					createRoleRequest.Name, organization.ID); err == nil {
+					http.Error(w, store.ErrOrganizationRoleNameAlreadyInUse.Error(), http.StatusBadRequest)
+					return
+				} else if err != nil && err != store.ErrOrganizationRoleNotFound {
+					log.WithError(err).Error("lookup organization role")
+					w.WriteHeader(http.StatusInternalServerError)
+					return
+				}
+
+				var roleConfig authz.Config
+				if err := yaml.UnmarshalStrict([]byte(createRoleRequest.Config), &roleConfig); err != nil {
+					http.Error(w, err.Error(), http.StatusBadRequest)
+					return
+				}
+
+				role, err := s.organizationRoles.CreateOrganizationRole(r.Context(), organization.ID,
+					createRoleRequest.Name, createRoleRequest.Description, createRoleRequest.Config)
+				if err != nil {
+					log.WithError(err).Error("create organization role")
+					w.WriteHeader(http.StatusInternalServerError)
+					return
+				}
+
+				utils.Respond(w, role)
+			},
+		)
+	})
+}
+
+func (s *Service) listOrganizationRoles(w http.ResponseWriter, r *http.Request) {
+	s.withOrganizationUserAuth(w, r, func(user *models.User) {
+		s.validateOrganizationAuthorization(
+			authz.ResourceOrganizationRoles, authz.ActionListOrganizationRoles,
+			w, r,
+			user,
+			func(organization *models.Organization) {
+				roles, err := s.organizationRoles.ListOrganizationRoles(r.Context(), organization.ID)
+				if err != nil {
+					log.WithError(err).Error("list organization roles")
+					w.WriteHeader(http.StatusInternalServerError)
+					return
+				}
+
+				utils.Respond(w, roles)
+			},
+		)
+	})
+}
+
+func (s *Service) getOrganizationRole(w http.ResponseWriter, r *http.Request) {
+	s.withOrganizationUserAuth(w, r, func(user *models.User) {
+		s.validateOrganizationAuthorization(
+			authz.ResourceOrganizationRoles, authz.ActionGetOrganizationRole,
+			w, r,
+			user,
+			func(organization *models.Organization) {
+				s.withOrganizationRole(w, r, organization, func(role *models.OrganizationRole) {
+					utils.Respond(w, role)
+				})
+			},
+		)
+	})
+}
+
+func (s *Service) updateOrganizationRole(w http.ResponseWriter, r *http.Request) {
+	s.withOrganizationUserAuth(w, r, func(user *models.User) {
+		s.validateOrganizationAuthorization(
+			authz.ResourceOrganizationRoles, authz.ActionUpdateOrganizationRole,
+			w, r,
+			user,
+			func(organization *models.Organization) {
+				s.withOrganizationRole(w, r, organization, func(role *models.OrganizationRole) {
+					var updateRoleRequest struct {
+						Name        string `json:"name" validate:"name"`
+						Description string `json:"description" validate:"description"`
+						Config      string `json:"config" validate:"config"`
+					}
+					if err := read(r, &updateRoleRequest); err != nil {
+						http.Error(w, err.Error(), http.StatusBadRequest)
+						return
+					}
+
+					if rl, err := s.organizationRoles.LookupOrganizationRole(r.Context(),
+						updateRoleRequest.Name, organization.ID); err == nil && rl.ID != role.ID {
+						http.Error(w, store.ErrOrganizationRoleNameAlreadyInUse.Error(), http.StatusBadRequest)
+						return
+					} else if err != nil && err != store.ErrOrganizationRoleNotFound {
+						log.WithError(err).Error("lookup organization role")
+						w.WriteHeader(http.StatusInternalServerError)
+						return
+					}
+
+					var roleConfig authz.Config
+					if err := yaml.UnmarshalStrict([]byte(updateRoleRequest.Config), &roleConfig); err != nil {
+						http.Error(w, err.Error(), http.StatusBadRequest)
+						return
+					}
+
+					updatedRole, err := s.organizationRoles.UpdateOrganizationRole(r.Context(), role.ID, organization.ID,
+						updateRoleRequest.Name, updateRoleRequest.Description, updateRoleRequest.Config)
+					if err != nil {
+						log.WithError(err).Error("update organization role")
+						w.WriteHeader(http.StatusInternalServerError)
+						return
+					}
+
+					utils.Respond(w, updatedRole)
+				})
+			},
+		)
+	})
+}
+
+func (s *Service) deleteOrganizationRole(w http.ResponseWriter, r *http.Request) {
+	s.withOrganizationUserAuth(w, r, func(user *models.User) {
+		s.validateOrganizationAuthorization(
+			authz.ResourceOrganizationRoles, authz.ActionDeleteOrganizationRole,
+			w, r,
+			user,
+			func(organization *models.Organization) {
+				s.withOrganizationRole(w, r, organization, func(role *models.OrganizationRole) {
+					if err := s.organizationRoles.DeleteOrganizationRole(r.Context(), role.ID, organization.ID); err != nil {
+						log.WithError(err).Error("delete organization role")
+						w.WriteHeader(http.StatusInternalServerError)
+						return
+					}
+				})
+			},
+		)
+	})
+}
+
+func (s *Service) listOrganizationMembershipRoleBindings(w http.ResponseWriter, r *http.Request) {
+	s.withOrganizationUserAuth(w, r, func(user *models.User) {
+		s.validateOrganizationAuthorization(
+			authz.ResourceOrganizationMembershipRoleBindings, authz.ActionListOrganizationMembershipRoleBindings,
+			w, r,
+			user,
+			func(organization *models.Organization) {
+				roleBindings, err := s.organizationMembershipRoleBindings.ListOrganizationMembershipRoleBindings(r.Context(),
+					mux.Vars(r)["user"], organization.ID)
+				if err != nil {
+					log.WithError(err).Error("list organization membership role bindings")
+					w.WriteHeader(http.StatusInternalServerError)
+					return
+				}
+
+				utils.Respond(w, roleBindings)
+			},
+		)
+	})
+}
+
+func (s *Service) createOrganizationMembershipRoleBinding(w http.ResponseWriter, r *http.Request) {
+	s.withOrganizationUserAuth(w, r, func(user *models.User) {
+		s.validateOrganizationAuthorization(
+			authz.ResourceOrganizationMembershipRoleBindings, authz.ActionCreateOrganizationMembershipRoleBinding,
+			w, r,
+			user,
+			func(organization *models.Organization) {
+				s.withOrganizationRole(w, r, organization, func(role *models.OrganizationRole) {
+					roleBinding, err := s.organizationMembershipRoleBindings.CreateOrganizationMembershipRoleBinding(r.Context(),
+						mux.Vars(r)["user"], role.ID, organization.ID)
+					if err != nil {
+						log.WithError(err).Error("create organization membership role binding")
+						w.WriteHeader(http.StatusInternalServerError)
+						return
+					}
+
+					utils.Respond(w, roleBinding)
+				})
+			},
+		)
+	})
+}
+
+func (s *Service) getOrganizationMembershipRoleBinding(w http.ResponseWriter, r *http.Request) {
+	s.withOrganizationUserAuth(w, r, func(user *models.User) {
+		s.validateOrganizationAuthorization(
+			authz.ResourceOrganizationMembershipRoleBindings, authz.ActionGetOrganizationMembershipRoleBinding,
+			w, r,
+			user,
+			func(organization *models.Organization) {
+				s.withOrganizationRole(w, r, organization, func(role *models.OrganizationRole) {
+					roleBinding, err := s.organizationMembershipRoleBindings.GetOrganizationMembershipRoleBinding(r.Context(),
+						mux.Vars(r)["user"], role.ID, organization.ID)
+					if err == store.ErrOrganizationMembershipRoleBindingNotFound {
+						http.Error(w, err.Error(), http.StatusNotFound)
+						return
+					} else if err != nil {
+						log.WithError(err).Error("get organization membership role binding")
+						w.WriteHeader(http.StatusInternalServerError)
+						return
+					}
+
+					utils.Respond(w, roleBinding)
+				})
+			},
+		)
+	})
+}
+
+func (s *Service) deleteOrganizationMembershipRoleBinding(w http.ResponseWriter, r *http.Request) {
+	s.withOrganizationUserAuth(w, r, func(user *models.User) {
+		s.validateOrganizationAuthorization(
+			authz.ResourceOrganizationMembershipRoleBindings, authz.ActionDeleteOrganizationMembershipRoleBinding,
+			w, r,
+			user,
+			func(organization *models.Organization) {
+				s.withOrganizationRole(w, r, organization, func(role *models.OrganizationRole) {
+					if err := s.organizationMembershipRoleBindings.DeleteOrganizationMembershipRoleBinding(r.Context(),
+						mux.Vars(r)["user"], role.ID, organization.ID); err != nil {
+						log.WithError(err).Error("delete organization membership role binding")
+						w.WriteHeader(http.StatusInternalServerError)
+						return
+					}
+				})
+			},
+		)
+	})
+}
@@ -0,0 +1,371 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/deviceplane/deviceplane/pkg/controller/store"
+	"github.com/deviceplane/deviceplane/pkg/hash"
+	"github.com/deviceplane/deviceplane/pkg/models"
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeOrganizationStore keeps users, organizations and what belongs to them
+// in memory. Users authenticate with the access key "u" followed by their ID.
+type fakeOrganizationStore struct {
+	store.Users
+	store.UserAccessKeys
+	store.Organizations
+	store.OrganizationMemberships
+	store.OrganizationRoles
+	store.OrganizationMembershipRoleBindings
+	store.Projects
+
+	nextID        int
+	users         map[string]*models.User
+	organizations map[string]*models.Organization
+	memberships   []models.OrganizationMembership
+	roles         []models.OrganizationRole
+	roleBindings  []models.OrganizationMembershipRoleBinding
+	projects      []models.Project
+
+	failCreateRole bool
+}
+
+func newFakeOrganizationStore(userIDs ...string) *fakeOrganizationStore {
+	f := &fakeOrganizationStore{
+		users:         make(map[string]*models.User),
+		organizations: make(map[string]*models.Organization),
+	}
+	for _, userID := range userIDs {
+		f.users[userID] = &models.User{ID: userID, Name: userID}
+	}
+	return f
+}
+
+func (f *fakeOrganizationStore) id(prefix string) string {
+	f.nextID++
+	return fmt.Sprintf("%s_%d", prefix, f.nextID)
+}
+
+func (f *fakeOrganizationStore) GetUser(ctx context.Context, id string) (*models.User, error) {
+	user, ok := f.users[id]
+	if !ok {
+		return nil, store.ErrUserNotFound
+	}
+	ret := *user
+	return &ret, nil
+}
+
+func (f *fakeOrganizationStore) ValidateUserAccessKey(ctx context.Context, keyHash, ip string) (*models.UserAccessKey, error) {
+	for userID := range f.users {
+		if hash.Hash("u"+userID) == keyHash {
+			return &models.UserAccessKey{UserID: userID}, nil
+		}
+	}
+	return nil, store.ErrUserAccessKeyNotFound
+}
+
+func (f *fakeOrganizationStore) CreateOrganization(ctx context.Context, name, billingEmail string) (*models.Organization, error) {
+	organization := &models.Organization{ID: f.id("org"), Name: name, BillingEmail: billingEmail}
+	f.organizations[organization.ID] = organization
+	return organization, nil
+}
+
+func (f *fakeOrganizationStore) GetOrganization(ctx context.Context, id string) (*models.Organization, error) {
+	organization, ok := f.organizations[id]
+	if !ok {
+		return nil, store.ErrOrganizationNotFound
+	}
+	return organization, nil
+}
+
+func (f *fakeOrganizationStore) LookupOrganization(ctx context.Context, name string) (*models.Organization, error) {
+	for _, organization := range f.organizations {
+		if organization.Name == name {
+			return organization, nil
+		}
+	}
+	return nil, store.ErrOrganizationNotFound
+}
+
+func (f *fakeOrganizationStore) UpdateOrganization(ctx context.Context, id, name, billingEmail string) (*models.Organization, error) {
+	organization := f.organizations[id]
+	organization.Name = name
+	organization.BillingEmail = billingEmail
+	return organization, nil
+}
+
+// DeleteOrganization cascades like the database does
+func (f *fakeOrganizationStore) DeleteOrganization(ctx context.Context, id string) error {
+	delete(f.organizations, id)
+
+	var memberships []models.OrganizationMembership
+	for _, membership := range f.memberships {
+		if membership.OrganizationID != id {
+			memberships = append(memberships, membership)
+		}
+	}
+	f.memberships = memberships
+
+	var roles []models.OrganizationRole
+	for _, role := range f.roles {
+		if role.OrganizationID != id {
+			roles = append(roles, role)
+		}
+	}
+	f.roles = roles
+
+	var roleBindings []models.OrganizationMembershipRoleBinding
+	for _, roleBinding := range f.roleBindings {
+		if roleBinding.OrganizationID != id {
+			roleBindings = append(roleBindings, roleBinding)
+		}
+	}
+	f.roleBindings = roleBindings
+
+	return nil
+}
+
+func (f *fakeOrganizationStore) CreateOrganizationMembership(ctx context.Context, userID, organizationID string) (*models.OrganizationMembership, error) {
+	membership := models.OrganizationMembership{UserID: userID, OrganizationID: organizationID}
+	f.memberships = append(f.memberships, membership)
+	return &membership, nil
+}
+
+func (f *fakeOrganizationStore) GetOrganizationMembership(ctx context.Context, userID, organizationID string) (*models.OrganizationMembership, error) {
+	for _, membership := range f.memberships {
+		if membership.UserID == userID && membership.OrganizationID == organizationID {
+			return &membership, nil
+		}
+	}
+	return nil, store.ErrOrganizationMembershipNotFound
+}
+
+func (f *fakeOrganizationStore) CreateOrganizationRole(ctx context.Context, organizationID, name, description, config string) (*models.OrganizationRole, error) {
+	if f.failCreateRole {
+		return nil, errors.New("create organization role failed")
+	}
+	role := models.OrganizationRole{
+		ID:             f.id("orgrole"),
+		OrganizationID: organizationID,
+		Name:           name,
+		Description:    description,
+		Config:         config,
+	}
+	f.roles = append(f.roles, role)
+	return &role, nil
+}
+
+func (f *fakeOrganizationStore) GetOrganizationRole(ctx context.Context, id, organizationID string) (*models.OrganizationRole, error) {
+	for _, role := range f.roles {
+		if role.ID == id && role.OrganizationID == organizationID {
+			return &role, nil
+		}
+	}
+	return nil, store.ErrOrganizationRoleNotFound
+}
+
+func (f *fakeOrganizationStore) LookupOrganizationRole(ctx context.Context, name, organizationID string) (*models.OrganizationRole, error) {
+	for _, role := range f.roles {
+		if role.Name == name && role.OrganizationID == organizationID {
+			return &role, nil
+		}
+	}
+	return nil, store.ErrOrganizationRoleNotFound
+}
+
+func (f *fakeOrganizationStore) CreateOrganizationMembershipRoleBinding(ctx context.Context, userID, roleID, organizationID string) (*models.OrganizationMembershipRoleBinding, error) {
+	roleBinding := models.OrganizationMembershipRoleBinding{UserID: userID, RoleID: roleID, OrganizationID: organizationID}
+	f.roleBindings = append(f.roleBindings, roleBinding)
+	return &roleBinding, nil
+}
+
+func (f *fakeOrganizationStore) ListOrganizationMembershipRoleBindings(ctx context.Context, userID, organizationID string) ([]models.OrganizationMembershipRoleBinding, error) {
+	var roleBindings []models.OrganizationMembershipRoleBinding
+	for _, roleBinding := range f.roleBindings {
+		if roleBinding.UserID == userID && roleBinding.OrganizationID == organizationID {
+			roleBindings = append(roleBindings, roleBinding)
+		}
+	}
+	return roleBindings, nil
+}
+
+func (f *fakeOrganizationStore) ListProjectsByOrganization(ctx context.Context, organizationID string) ([]models.Project, error) {
+	var projects []models.Project
+	for _, project := range f.projects {
+		if project.OrganizationID != nil && *project.OrganizationID == organizationID {
+			projects = append(projects, project)
+		}
+	}
+	return projects, nil
+}
+
+// bindRole gives a member of an organization one of its roles
+func (f *fakeOrganizationStore) bindRole(t *testing.T, userID, organizationID, roleName string) {
+	role, err := f.LookupOrganizationRole(context.Background(), roleName, organizationID)
+	require.NoError(t, err)
+	_, err = f.CreateOrganizationMembership(context.Background(), userID, organizationID)
+	require.NoError(t, err)
+	_, err = f.CreateOrganizationMembershipRoleBinding(context.Background(), userID, role.ID, organizationID)
+	require.NoError(t, err)
+}
+
+func newOrganizationTestRouter(f *fakeOrganizationStore) *mux.Router {
+	s := &Service{
+		users:                              f,
+		userAccessKeys:                     f,
+		organizations:                      f,
+		organizationMemberships:            f,
+		organizationRoles:                  f,
+		organizationMembershipRoleBindings: f,
+		projects:                           f,
+	}
+
+	router := mux.NewRouter()
+	router.HandleFunc("/organizations", s.createOrganization).Methods("POST")
+	router.HandleFunc("/organizations/{organization}", s.getOrganization).Methods("GET")
+	router.HandleFunc("/organizations/{organization}", s.updateOrganization).Methods("PUT")
+	router.HandleFunc("/organizations/{organization}", s.deleteOrganization).Methods("DELETE")
+	router.HandleFunc("/organizations/{organization}/memberships", s.createOrganizationMembership).Methods("POST")
+	return router
+}
+
+func organizationRequest(t *testing.T, router *mux.Router, userID, method, path string, body interface{}) *httptest.ResponseRecorder {
+	var reqBody bytes.Buffer
+	if body != nil {
+		require.NoError(t, json.NewEncoder(&reqBody).Encode(body))
+	}
+	r := httptest.NewRequest(method, path, &reqBody)
+	r.SetBasicAuth("u"+userID, "")
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, r)
+	return w
+}
+
+func TestCreateOrganization(t *testing.T) {
+	f := newFakeOrganizationStore("usr_1")
+	router := newOrganizationTestRouter(f)
+
+	w := organizationRequest(t, router, "usr_1", "POST", "/organizations", map[string]string{
+		"name": "acme",
+	})
+	require.Equal(t, http.StatusOK, w.Code)
+
+	var organization models.Organization
+	require.NoError(t, json.NewDecoder(w.Body).Decode(&organization))
+	require.Equal(t, "acme", organization.Name)
+
+	require.Equal(t, []models.OrganizationMembership{
+		{UserID: "usr_1", OrganizationID: organization.ID},
+	}, f.memberships)
+
+	var roleNames []string
+	for _, role := range f.roles {
+		roleNames = append(roleNames, role.Name)
+	}
+	require.Equal(t, []string{"admin-all", "write-all", "read-all"}, roleNames)
+
+	require.Equal(t, []models.OrganizationMembershipRoleBinding{
+		{UserID: "usr_1", RoleID: f.roles[0].ID, OrganizationID: organization.ID},
+	}, f.roleBindings)
+
+	// Names are unique
+	w = organizationRequest(t, router, "usr_1", "POST", "/organizations", map[string]string{
+		"name": "acme",
+	})
+	require.Equal(t, http.StatusBadRequest, w.Code)
+}
+
+func TestCreateOrganizationCleansUpAfterFailures(t *testing.T) {
+	f := newFakeOrganizationStore("usr_1")
+	f.failCreateRole = true
+	router := newOrganizationTestRouter(f)
+
+	w := organizationRequest(t, router, "usr_1", "POST", "/organizations", map[string]string{
+		"name": "acme",
+	})
+	require.Equal(t, http.StatusInternalServerError, w.Code)
+	require.Empty(t, f.organizations)
+	require.Empty(t, f.memberships)
+}
+
+func TestOrganizationAuthorization(t *testing.T) {
+	f := newFakeOrganizationStore("usr_admin", "usr_reader", "usr_other")
+	router := newOrganizationTestRouter(f)
+
+	w := organizationRequest(t, router, "usr_admin", "POST", "/organizations", map[string]string{
+		"name": "acme",
+	})
+	require.Equal(t, http.StatusOK, w.Code)
+	var organization models.Organization
+	require.NoError(t, json.NewDecoder(w.Body).Decode(&organization))
+	path := "/organizations/" + organization.ID
+
+	f.bindRole(t, "usr_reader", organization.ID, "read-all")
+
+	for _, scenario := range []struct {
+		userID string
+		method string
+		body   interface{}
+		status int
+	}{
+		{"usr_other", "GET", nil, http.StatusNotFound},
+		{"usr_reader", "GET", nil, http.StatusOK},
+		{"usr_reader", "PUT", map[string]string{"name": "renamed"}, http.StatusForbidden},
+		{"usr_reader", "DELETE", nil, http.StatusForbidden},
+		{"usr_admin", "PUT", map[string]string{"name": "renamed"}, http.StatusOK},
+	} {
+		w := organizationRequest(t, router, scenario.userID, scenario.method, path, scenario.body)
+		require.Equal(t, scenario.status, w.Code, "%s %s", scenario.userID, scenario.method)
+	}
+	require.Equal(t, "renamed", f.organizations[organization.ID].Name)
+
+	// Organizations with projects can't be deleted
+	f.projects = append(f.projects, models.Project{ID: "prj_1", OrganizationID: &organization.ID})
+	w = organizationRequest(t, router, "usr_admin", "DELETE", path, nil)
+	require.Equal(t, http.StatusBadRequest, w.Code)
+
+	f.projects = nil
+	w = organizationRequest(t, router, "usr_admin", "DELETE", path, nil)
+	require.Equal(t, http.StatusOK, w.Code)
+	require.Empty(t, f.organizations)
+}
+
+func TestCreateOrganizationMembership(t *testing.T) {
+	f := newFakeOrganizationStore("usr_admin", "usr_new")
+	router := newOrganizationTestRouter(f)
+
+	w := organizationRequest(t, router, "usr_admin", "POST", "/organizations", map[string]string{
+		"name": "acme",
+	})
+	require.Equal(t, http.StatusOK, w.Code)
+	var organization models.Organization
+	require.NoError(t, json.NewDecoder(w.Body).Decode(&organization))
+	path := "/organizations/" + organization.ID + "/memberships"
+
+	// The membership is for the user in the request, not the one making it
+	w = organizationRequest(t, router, "usr_admin", "POST", path, map[string]string{
+		"userId": "usr_new",
+	})
+	require.Equal(t, http.StatusOK, w.Code)
+	var membership models.OrganizationMembership
+	require.NoError(t, json.NewDecoder(w.Body).Decode(&membership))
+	require.Equal(t, "usr_new", membership.UserID)
+
+	w = organizationRequest(t, router, "usr_admin", "POST", path, map[string]string{
+		"userId": "usr_missing",
+	})
+	require.Equal(t, http.StatusNotFound, w.Code)
+
+	w = organizationRequest(t, router, "usr_admin", "POST", path, map[string]string{})
+	require.Equal(t, http.StatusBadRequest, w.Code)
+}
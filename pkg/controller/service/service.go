@@ -4,9 +4,13 @@ import (
 	"net/http"
 	"net/http/pprof"
 	"net/url"
+	"time"
 
 	"github.com/DataDog/datadog-go/statsd"
 	"github.com/deviceplane/deviceplane/pkg/controller/connman"
+	"github.com/deviceplane/deviceplane/pkg/controller/jobs"
+	"github.com/deviceplane/deviceplane/pkg/controller/metricstorage"
+	"github.com/deviceplane/deviceplane/pkg/controller/oidc"
 	"github.com/deviceplane/deviceplane/pkg/controller/spaserver"
 	"github.com/deviceplane/deviceplane/pkg/controller/store"
 	"github.com/deviceplane/deviceplane/pkg/email"
@@ -17,45 +21,63 @@ import (
 )
 
 type Service struct {
-	users                      store.Users
-	internalUsers              store.InternalUsers
-	externalUsers              store.ExternalUsers
-	passwordRecoveryTokens     store.PasswordRecoveryTokens
-	registrationTokens         store.RegistrationTokens
-	userAccessKeys             store.UserAccessKeys
-	sessions                   store.Sessions
-	projects                   store.Projects
-	projectDeviceCounts        store.ProjectDeviceCounts
-	projectApplicationCounts   store.ProjectApplicationCounts
-	roles                      store.Roles
-	memberships                store.Memberships
-	membershipRoleBindings     store.MembershipRoleBindings
-	serviceAccounts            store.ServiceAccounts
-	serviceAccountAccessKeys   store.ServiceAccountAccessKeys
-	serviceAccountRoleBindings store.ServiceAccountRoleBindings
-	devices                    store.Devices
-	deviceRegistrationTokens   store.DeviceRegistrationTokens
-	devicesRegisteredWithToken store.DevicesRegisteredWithToken
-	deviceAccessKeys           store.DeviceAccessKeys
-	connections                store.Connections
-	applications               store.Applications
-	applicationDeviceCounts    store.ApplicationDeviceCounts
-	releases                   store.Releases
-	releaseDeviceCounts        store.ReleaseDeviceCounts
-	deviceApplicationStatuses  store.DeviceApplicationStatuses
-	deviceServiceStatuses      store.DeviceServiceStatuses
-	deviceServiceStates        store.DeviceServiceStates
-	metricConfigs              store.MetricConfigs
-	email                      email.Interface
-	emailFromName              string
-	emailFromAddress           string
-	allowedEmailDomains        []string
-	auth0Domain                *url.URL
-	auth0Audience              string
-	st                         *statsd.Client
-	connman                    *connman.ConnectionManager
-	router                     *mux.Router
-	upgrader                   websocket.Upgrader
+	users                              store.Users
+	internalUsers                      store.InternalUsers
+	externalUsers                      store.ExternalUsers
+	passwordRecoveryTokens             store.PasswordRecoveryTokens
+	registrationTokens                 store.RegistrationTokens
+	userAccessKeys                     store.UserAccessKeys
+	userTOTPs                          store.UserTOTPs
+	userRecoveryCodes                  store.UserRecoveryCodes
+	sessions                           store.Sessions
+	projects                           store.Projects
+	projectDeviceCounts                store.ProjectDeviceCounts
+	projectApplicationCounts           store.ProjectApplicationCounts
+	roles                              store.Roles
+	memberships                        store.Memberships
+	membershipRoleBindings             store.MembershipRoleBindings
+	ssoGroupMappings                   store.SsoGroupMappings
+	ssoManagedRoleBindings             store.SsoManagedRoleBindings
+	userSsoGroups                      store.UserSsoGroups
+	serviceAccounts                    store.ServiceAccounts
+	serviceAccountAccessKeys           store.ServiceAccountAccessKeys
+	serviceAccountRoleBindings         store.ServiceAccountRoleBindings
+	devices                            store.Devices
+	deviceRegistrationTokens           store.DeviceRegistrationTokens
+	devicesRegisteredWithToken         store.DevicesRegisteredWithToken
+	deviceAccessKeys                   store.DeviceAccessKeys
+	deviceCertificateAuthorities       store.DeviceCertificateAuthorities
+	connections                        store.Connections
+	deviceGroups                       store.DeviceGroups
+	jobs                               store.Jobs
+	applications                       store.Applications
+	applicationDeviceCounts            store.ApplicationDeviceCounts
+	releases                           store.Releases
+	releaseDeviceCounts                store.ReleaseDeviceCounts
+	deviceApplicationStatuses          store.DeviceApplicationStatuses
+	deviceServiceStatuses              store.DeviceServiceStatuses
+	deviceServiceStates                store.DeviceServiceStates
+	metricConfigs                      store.MetricConfigs
+	securityConfigs                    store.SecurityConfigs
+	organizations                      store.Organizations
+	organizationMemberships            store.OrganizationMemberships
+	organizationRoles                  store.OrganizationRoles
+	organizationMembershipRoleBindings store.OrganizationMembershipRoleBindings
+	email                              email.Interface
+	emailFromName                      string
+	emailFromAddress                   string
+	allowedEmailDomains                []string
+	oidcProvider                       *oidc.Provider
+	clientCertificateHeader            string
+	sessionTTL                         time.Duration
+	ssoGroupTTL                        time.Duration
+	metricsSinkAllowedHosts            []string
+	st                                 *statsd.Client
+	connman                            *connman.ConnectionManager
+	metricStorage                      *metricstorage.Storage
+	jobRunner                          *jobs.Runner
+	router                             *mux.Router
+	upgrader                           websocket.Upgrader
 }
 
 func NewService(
@@ -66,12 +88,17 @@ func NewService(
 	passwordRecoveryTokens store.PasswordRecoveryTokens,
 	sessions store.Sessions,
 	userAccessKeys store.UserAccessKeys,
+	userTOTPs store.UserTOTPs,
+	userRecoveryCodes store.UserRecoveryCodes,
 	projects store.Projects,
 	projectDeviceCounts store.ProjectDeviceCounts,
 	projectApplicationCounts store.ProjectApplicationCounts,
 	roles store.Roles,
 	memberships store.Memberships,
 	membershipRoleBindings store.MembershipRoleBindings,
+	ssoGroupMappings store.SsoGroupMappings,
+	ssoManagedRoleBindings store.SsoManagedRoleBindings,
+	userSsoGroups store.UserSsoGroups,
 	serviceAccounts store.ServiceAccounts,
 	serviceAccountAccessKeys store.ServiceAccountAccessKeys,
 	serviceAccountRoleBindings store.ServiceAccountRoleBindings,
@@ -79,7 +106,10 @@ func NewService(
 	deviceRegistrationTokens store.DeviceRegistrationTokens,
 	devicesRegisteredWithToken store.DevicesRegisteredWithToken,
 	deviceAccessKeys store.DeviceAccessKeys,
+	deviceCertificateAuthorities store.DeviceCertificateAuthorities,
 	connections store.Connections,
+	deviceGroups store.DeviceGroups,
+	jobs store.Jobs,
 	applications store.Applications,
 	applicationDeviceCounts store.ApplicationDeviceCounts,
 	releases store.Releases,
@@ -88,55 +118,83 @@ func NewService(
 	deviceServiceStatuses store.DeviceServiceStatuses,
 	deviceServiceStates store.DeviceServiceStates,
 	metricConfigs store.MetricConfigs,
+	securityConfigs store.SecurityConfigs,
+	organizations store.Organizations,
+	organizationMemberships store.OrganizationMemberships,
+	organizationRoles store.OrganizationRoles,
+	organizationMembershipRoleBindings store.OrganizationMembershipRoleBindings,
 	email email.Interface,
 	emailFromName string,
 	emailFromAddress string,
 	allowedEmailDomains []string,
-	auth0Domain *url.URL,
-	auth0Audience string,
+	oidcProvider *oidc.Provider,
+	clientCertificateHeader string,
+	sessionTTL time.Duration,
+	ssoGroupTTL time.Duration,
+	metricsSinkAllowedHosts []string,
 	fileSystem http.FileSystem,
 	st *statsd.Client,
 	connman *connman.ConnectionManager,
+	metricStorage *metricstorage.Storage,
+	jobRunner *jobs.Runner,
 	allowedOrigins []url.URL,
 ) *Service {
 	s := &Service{
-		users:                      users,
-		internalUsers:              internalUsers,
-		externalUsers:              externalUsers,
-		registrationTokens:         registrationTokens,
-		passwordRecoveryTokens:     passwordRecoveryTokens,
-		sessions:                   sessions,
-		userAccessKeys:             userAccessKeys,
-		projects:                   projects,
-		projectDeviceCounts:        projectDeviceCounts,
-		projectApplicationCounts:   projectApplicationCounts,
-		roles:                      roles,
-		memberships:                memberships,
-		membershipRoleBindings:     membershipRoleBindings,
-		serviceAccounts:            serviceAccounts,
-		serviceAccountAccessKeys:   serviceAccountAccessKeys,
-		serviceAccountRoleBindings: serviceAccountRoleBindings,
-		devices:                    devices,
-		deviceRegistrationTokens:   deviceRegistrationTokens,
-		devicesRegisteredWithToken: devicesRegisteredWithToken,
-		deviceAccessKeys:           deviceAccessKeys,
-		connections:                connections,
-		applications:               applications,
-		applicationDeviceCounts:    applicationDeviceCounts,
-		releases:                   releases,
-		releaseDeviceCounts:        releasesDeviceCounts,
-		deviceApplicationStatuses:  deviceApplicationStatuses,
-		deviceServiceStatuses:      deviceServiceStatuses,
-		deviceServiceStates:        deviceServiceStates,
-		metricConfigs:              metricConfigs,
-		email:                      email,
-		emailFromName:              emailFromName,
-		emailFromAddress:           emailFromAddress,
-		allowedEmailDomains:        allowedEmailDomains,
-		auth0Domain:                auth0Domain,
-		auth0Audience:              auth0Audience,
-		st:                         st,
-		connman:                    connman,
+		users:                              users,
+		internalUsers:                      internalUsers,
+		externalUsers:                      externalUsers,
+		registrationTokens:                 registrationTokens,
+		passwordRecoveryTokens:             passwordRecoveryTokens,
+		sessions:                           sessions,
+		userAccessKeys:                     userAccessKeys,
+		userTOTPs:                          userTOTPs,
+		userRecoveryCodes:                  userRecoveryCodes,
+		projects:                           projects,
+		projectDeviceCounts:                projectDeviceCounts,
+		projectApplicationCounts:           projectApplicationCounts,
+		roles:                              roles,
+		memberships:                        memberships,
+		membershipRoleBindings:             membershipRoleBindings,
+		ssoGroupMappings:                   ssoGroupMappings,
+		ssoManagedRoleBindings:             ssoManagedRoleBindings,
+		userSsoGroups:                      userSsoGroups,
+		serviceAccounts:                    serviceAccounts,
+		serviceAccountAccessKeys:           serviceAccountAccessKeys,
+		serviceAccountRoleBindings:         serviceAccountRoleBindings,
+		devices:                            devices,
+		deviceRegistrationTokens:           deviceRegistrationTokens,
+		devicesRegisteredWithToken:         devicesRegisteredWithToken,
+		deviceAccessKeys:                   deviceAccessKeys,
+		deviceCertificateAuthorities:       deviceCertificateAuthorities,
+		connections:                        connections,
+		deviceGroups:                       deviceGroups,
+		jobs:                               jobs,
+		applications:                       applications,
+		applicationDeviceCounts:            applicationDeviceCounts,
+		releases:                           releases,
+		releaseDeviceCounts:                releasesDeviceCounts,
+		deviceApplicationStatuses:          deviceApplicationStatuses,
+		deviceServiceStatuses:              deviceServiceStatuses,
+		deviceServiceStates:                deviceServiceStates,
+		metricConfigs:                      metricConfigs,
+		securityConfigs:                    securityConfigs,
+		organizations:                      organizations,
+		organizationMemberships:            organizationMemberships,
+		organizationRoles:                  organizationRoles,
+		organizationMembershipRoleBindings: organizationMembershipRoleBindings,
+		email:                              email,
+		emailFromName:                      emailFromName,
+		emailFromAddress:                   emailFromAddress,
+		allowedEmailDomains:                allowedEmailDomains,
+		oidcProvider:                       oidcProvider,
+		clientCertificateHeader:            clientCertificateHeader,
+		sessionTTL:                         sessionTTL,
+		ssoGroupTTL:                        ssoGroupTTL,
+		metricsSinkAllowedHosts:            metricsSinkAllowedHosts,
+		st:                                 st,
+		connman:                            connman,
+		metricStorage:                      metricStorage,
+		jobRunner:                          jobRunner,
 
 		router: mux.NewRouter(),
 		upgrader: websocket.Upgrader{
@@ -149,6 +207,8 @@ func NewService(
 		},
 	}
 
+	s.registerJobTypes()
+
 	apiRouter := s.router.PathPrefix("/api").Subrouter()
 
 	apiRouter.HandleFunc("/register", s.registerInternalUser).Methods("POST")
@@ -161,11 +221,23 @@ func NewService(
 
 	apiRouter.HandleFunc("/login", s.loginInternalUser).Methods("POST")
 	apiRouter.HandleFunc("/loginsso", s.loginExternalUser).Methods("POST")
+	apiRouter.HandleFunc("/ssoconfig", s.getSsoConfig).Methods("GET")
 	apiRouter.HandleFunc("/logout", s.logout).Methods("POST")
 
 	apiRouter.HandleFunc("/me", s.getMe).Methods("GET")
 	apiRouter.HandleFunc("/me", s.updateMe).Methods("PATCH")
 
+	apiRouter.HandleFunc("/me/totp", s.getMeTOTP).Methods("GET")
+	apiRouter.HandleFunc("/me/totp", s.createMeTOTP).Methods("POST")
+	apiRouter.HandleFunc("/me/totp", s.deleteMeTOTP).Methods("DELETE")
+	apiRouter.HandleFunc("/me/totp/verify", s.verifyMeTOTP).Methods("POST")
+	apiRouter.HandleFunc("/me/totp/recoverycodes", s.createMeRecoveryCodes).Methods("POST")
+
+	apiRouter.HandleFunc("/me/sessions", s.listMeSessions).Methods("GET")
+	apiRouter.HandleFunc("/me/sessions/{session}", s.deleteMeSession).Methods("DELETE")
+
+	apiRouter.HandleFunc("/users/{user}/sessions", s.deleteUserSessions).Methods("DELETE")
+
 	apiRouter.HandleFunc("/memberships", s.listMembershipsByUser).Methods("GET")
 
 	apiRouter.HandleFunc("/useraccesskeys", s.listUserAccessKeys).Methods("GET")
@@ -173,6 +245,32 @@ func NewService(
 	apiRouter.HandleFunc("/useraccesskeys/{useraccesskey}", s.getUserAccessKey).Methods("GET")
 	apiRouter.HandleFunc("/useraccesskeys/{useraccesskey}", s.deleteUserAccessKey).Methods("DELETE")
 
+	apiRouter.HandleFunc("/organizationmemberships", s.listOrganizationMembershipsByUser).Methods("GET")
+
+	apiRouter.HandleFunc("/organizations", s.createOrganization).Methods("POST")
+	apiRouter.HandleFunc("/organizations/{organization}", s.getOrganization).Methods("GET")
+	apiRouter.HandleFunc("/organizations/{organization}", s.updateOrganization).Methods("PUT")
+	apiRouter.HandleFunc("/organizations/{organization}", s.deleteOrganization).Methods("DELETE")
+
+	apiRouter.HandleFunc("/organizations/{organization}/projects", s.listOrganizationProjects).Methods("GET")
+	apiRouter.HandleFunc("/organizations/{organization}/projects", s.createOrganizationProject).Methods("POST")
+
+	apiRouter.HandleFunc("/organizations/{organization}/roles", s.createOrganizationRole).Methods("POST")
+	apiRouter.HandleFunc("/organizations/{organization}/roles", s.listOrganizationRoles).Methods("GET")
+	apiRouter.HandleFunc("/organizations/{organization}/roles/{role}", s.getOrganizationRole).Methods("GET")
+	apiRouter.HandleFunc("/organizations/{organization}/roles/{role}", s.updateOrganizationRole).Methods("PUT")
+	apiRouter.HandleFunc("/organizations/{organization}/roles/{role}", s.deleteOrganizationRole).Methods("DELETE")
+
+	apiRouter.HandleFunc("/organizations/{organization}/memberships", s.listOrganizationMemberships).Methods("GET")
+	apiRouter.HandleFunc("/organizations/{organization}/memberships", s.createOrganizationMembership).Methods("POST")
+	apiRouter.HandleFunc("/organizations/{organization}/memberships/{user}", s.getOrganizationMembership).Methods("GET")
+	apiRouter.HandleFunc("/organizations/{organization}/memberships/{user}", s.deleteOrganizationMembership).Methods("DELETE")
+
+	apiRouter.HandleFunc("/organizations/{organization}/memberships/{user}/membershiprolebindings", s.listOrganizationMembershipRoleBindings).Methods("GET")
+	apiRouter.HandleFunc("/organizations/{organization}/memberships/{user}/roles/{role}/membershiprolebindings", s.createOrganizationMembershipRoleBinding).Methods("POST")
+	apiRouter.HandleFunc("/organizations/{organization}/memberships/{user}/roles/{role}/membershiprolebindings", s.getOrganizationMembershipRoleBinding).Methods("GET")
+	apiRouter.HandleFunc("/organizations/{organization}/memberships/{user}/roles/{role}/membershiprolebindings", s.deleteOrganizationMembershipRoleBinding).Methods("DELETE")
+
 	apiRouter.HandleFunc("/projects", s.createProject).Methods("POST")
 	apiRouter.HandleFunc("/projects/{project}", s.getProject).Methods("GET")
 	apiRouter.HandleFunc("/projects/{project}", s.updateProject).Methods("PUT")
@@ -184,6 +282,8 @@ func NewService(
 	apiRouter.HandleFunc("/projects/{project}/roles/{role}", s.updateRole).Methods("PUT")
 	apiRouter.HandleFunc("/projects/{project}/roles/{role}", s.deleteRole).Methods("DELETE")
 
+	apiRouter.HandleFunc("/projects/{project}/authz/simulate", s.simulateAuthorization).Methods("POST")
+
 	apiRouter.HandleFunc("/projects/{project}/memberships", s.listMembershipsByProject).Methods("GET")
 	apiRouter.HandleFunc("/projects/{project}/memberships", s.createMembership).Methods("POST")
 	apiRouter.HandleFunc("/projects/{project}/memberships/{user}", s.getMembership).Methods("GET")
@@ -194,6 +294,11 @@ func NewService(
 	apiRouter.HandleFunc("/projects/{project}/memberships/{user}/roles/{role}/membershiprolebindings", s.getMembershipRoleBinding).Methods("GET")
 	apiRouter.HandleFunc("/projects/{project}/memberships/{user}/roles/{role}/membershiprolebindings", s.deleteMembershipRoleBinding).Methods("DELETE")
 
+	apiRouter.HandleFunc("/projects/{project}/ssogroupmappings", s.listSsoGroupMappings).Methods("GET")
+	apiRouter.HandleFunc("/projects/{project}/ssogroupmappings", s.createSsoGroupMapping).Methods("POST")
+	apiRouter.HandleFunc("/projects/{project}/ssogroupmappings/{ssogroupmapping}", s.getSsoGroupMapping).Methods("GET")
+	apiRouter.HandleFunc("/projects/{project}/ssogroupmappings/{ssogroupmapping}", s.deleteSsoGroupMapping).Methods("DELETE")
+
 	apiRouter.HandleFunc("/projects/{project}/serviceaccounts", s.listServiceAccounts).Methods("GET")
 	apiRouter.HandleFunc("/projects/{project}/serviceaccounts", s.createServiceAccount).Methods("POST")
 	apiRouter.HandleFunc("/projects/{project}/serviceaccounts/{serviceaccount}", s.getServiceAccount).Methods("GET")
@@ -216,6 +321,17 @@ func NewService(
 	apiRouter.HandleFunc("/projects/{project}/connections/{connection}", s.updateConnection).Methods("PUT")
 	apiRouter.HandleFunc("/projects/{project}/connections/{connection}", s.deleteConnection).Methods("DELETE")
 
+	apiRouter.HandleFunc("/projects/{project}/devicegroups", s.listDeviceGroups).Methods("GET")
+	apiRouter.HandleFunc("/projects/{project}/devicegroups", s.createDeviceGroup).Methods("POST")
+	apiRouter.HandleFunc("/projects/{project}/devicegroups/{devicegroup}", s.getDeviceGroup).Methods("GET")
+	apiRouter.HandleFunc("/projects/{project}/devicegroups/{devicegroup}", s.updateDeviceGroup).Methods("PUT")
+	apiRouter.HandleFunc("/projects/{project}/devicegroups/{devicegroup}", s.deleteDeviceGroup).Methods("DELETE")
+
+	apiRouter.HandleFunc("/projects/{project}/jobs", s.listJobs).Methods("GET")
+	apiRouter.HandleFunc("/projects/{project}/jobs/{job}", s.getJob).Methods("GET")
+	apiRouter.HandleFunc("/projects/{project}/jobs/{job}/items", s.listJobItems).Methods("GET")
+	apiRouter.HandleFunc("/projects/{project}/jobs/{job}/cancel", s.cancelJob).Methods("POST")
+
 	apiRouter.HandleFunc("/projects/{project}/applications", s.listApplications).Methods("GET")
 	apiRouter.HandleFunc("/projects/{project}/applications", s.createApplication).Methods("POST")
 	apiRouter.HandleFunc("/projects/{project}/applications/{application}", s.getApplication).Methods("GET")
@@ -225,8 +341,18 @@ func NewService(
 	apiRouter.HandleFunc("/projects/{project}/applications/{application}/releases", s.createRelease).Methods("POST")
 	apiRouter.HandleFunc("/projects/{project}/applications/{application}/releases/latest", s.getLatestRelease).Methods("GET")
 	apiRouter.HandleFunc("/projects/{project}/applications/{application}/releases/{release}", s.getRelease).Methods("GET")
+	apiRouter.HandleFunc("/projects/{project}/applications/{application}/releases/{release}/diff", s.diffReleases).Methods("GET")
 	apiRouter.HandleFunc("/projects/{project}/applications/{application}/releases", s.listReleases).Methods("GET")
 
+	// Bulk routes come before the device routes that would otherwise match
+	// them
+	apiRouter.HandleFunc("/projects/{project}/devices/bulk/setlabel", s.bulkSetDeviceLabel).Methods("POST")
+	apiRouter.HandleFunc("/projects/{project}/devices/bulk/deletelabel", s.bulkDeleteDeviceLabel).Methods("POST")
+	apiRouter.HandleFunc("/projects/{project}/devices/bulk/setenvironmentvariable", s.bulkSetDeviceEnvironmentVariable).Methods("POST")
+	apiRouter.HandleFunc("/projects/{project}/devices/bulk/deleteenvironmentvariable", s.bulkDeleteDeviceEnvironmentVariable).Methods("POST")
+	apiRouter.HandleFunc("/projects/{project}/devices/bulk/reboot", s.bulkReboot).Methods("POST")
+	apiRouter.HandleFunc("/projects/{project}/devices/bulk/delete", s.bulkDeleteDevices).Methods("POST")
+
 	apiRouter.HandleFunc("/projects/{project}/devices/{device}", s.getDevice).Methods("GET")
 	apiRouter.HandleFunc("/projects/{project}/devices", s.listDevices).Methods("GET")
 	apiRouter.HandleFunc("/projects/{project}/devices/previewscheduling/{application}", s.previewScheduledDevices).Methods("GET")
@@ -234,6 +360,8 @@ func NewService(
 	apiRouter.HandleFunc("/projects/{project}/devices/{device}", s.deleteDevice).Methods("DELETE")
 	apiRouter.HandleFunc("/projects/{project}/devices/{device}/ssh", s.ssh)
 	apiRouter.HandleFunc("/projects/{project}/devices/{device}/connect/{connection}", s.connectTCP)
+	apiRouter.HandleFunc("/projects/{project}/devices/{device}/ports/{port}/connect", s.connectPort)
+	apiRouter.HandleFunc("/projects/{project}/devices/{device}/applications/{application}/services/{service}/ports/{port}/connect", s.connectServicePort)
 	apiRouter.HandleFunc("/projects/{project}/devices/{device}/reboot", s.reboot)
 	apiRouter.HandleFunc("/projects/{project}/devices/{device}/applications/{application}/services/{service}/imagepullprogress", s.imagePullProgress).Methods("GET")
 	apiRouter.HandleFunc("/projects/{project}/devices/{device}/metrics/host", s.hostMetrics).Methods("GET")
@@ -247,6 +375,11 @@ func NewService(
 	apiRouter.HandleFunc("/projects/{project}/devices/{device}/labels", s.setDeviceLabel).Methods("PUT")
 	apiRouter.HandleFunc("/projects/{project}/devices/{device}/labels/{key}", s.deleteDeviceLabel).Methods("DELETE")
 
+	apiRouter.HandleFunc("/projects/{project}/devices/{device}/quarantine", s.setDeviceQuarantine).Methods("PUT")
+	apiRouter.HandleFunc("/projects/{project}/devices/{device}/accesskeys", s.listDeviceAccessKeys).Methods("GET")
+	apiRouter.HandleFunc("/projects/{project}/devices/{device}/accesskeys", s.revokeDeviceAccessKeys).Methods("DELETE")
+	apiRouter.HandleFunc("/projects/{project}/devices/{device}/accesskeys/{deviceaccesskey}", s.revokeDeviceAccessKey).Methods("DELETE")
+
 	apiRouter.HandleFunc("/projects/{project}/devicelabels", s.listAllDeviceLabelKeys).Methods("GET")
 
 	apiRouter.HandleFunc("/projects/{project}/deviceregistrationtokens", s.listDeviceRegistrationTokens).Methods("GET")
@@ -267,12 +400,16 @@ func NewService(
 	apiRouter.HandleFunc("/projects/{project}/devices/register", s.registerDevice).Methods("POST")
 	apiRouter.HandleFunc("/projects/{project}/devices/{device}/bundle", s.getBundle).Methods("GET")
 	apiRouter.HandleFunc("/projects/{project}/devices/{device}/info", s.setDeviceInfo).Methods("POST")
+	apiRouter.HandleFunc("/projects/{project}/devices/{device}/accesskeys/rotate", s.rotateDeviceAccessKey).Methods("POST")
 	apiRouter.HandleFunc("/projects/{project}/devices/{device}/applications/{application}/deviceapplicationstatuses", s.setDeviceApplicationStatus).Methods("POST")
 	apiRouter.HandleFunc("/projects/{project}/devices/{device}/applications/{application}/deviceapplicationstatuses", s.deleteDeviceApplicationStatus).Methods("DELETE")
 	apiRouter.HandleFunc("/projects/{project}/devices/{device}/applications/{application}/services/{service}/deviceservicestatuses", s.setDeviceServiceStatus).Methods("POST")
 	apiRouter.HandleFunc("/projects/{project}/devices/{device}/applications/{application}/services/{service}/deviceservicestatuses", s.deleteDeviceServiceStatus).Methods("DELETE")
 	apiRouter.HandleFunc("/projects/{project}/devices/{device}/applications/{application}/services/{service}/deviceservicestates", s.setDeviceServiceState).Methods("POST")
 	apiRouter.HandleFunc("/projects/{project}/devices/{device}/applications/{application}/services/{service}/deviceservicestates", s.deleteDeviceServiceState).Methods("DELETE")
+	apiRouter.HandleFunc("/projects/{project}/metrics/query", s.queryMetrics).Methods("GET")
+	apiRouter.HandleFunc("/projects/{project}/metrics/federate", s.federateMetrics).Methods("GET")
+
 	apiRouter.HandleFunc("/projects/{project}/devices/{device}/forwardmetrics/service", s.forwardServiceMetrics).Methods("POST")
 	apiRouter.HandleFunc("/projects/{project}/devices/{device}/forwardmetrics/device", s.forwardDeviceMetrics).Methods("POST")
 	apiRouter.HandleFunc("/projects/{project}/devices/{device}/connection", s.initiateDeviceConnection).Methods("GET")
@@ -0,0 +1,130 @@
+package service
+
+import (
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/apex/log"
+	"github.com/deviceplane/deviceplane/pkg/controller/store"
+	"github.com/deviceplane/deviceplane/pkg/hash"
+	"github.com/deviceplane/deviceplane/pkg/models"
+	"github.com/deviceplane/deviceplane/pkg/utils"
+	"github.com/gorilla/mux"
+)
+
+// validateSession looks up the session for a cookie value and pushes its
+// expiry back by the session TTL, so that sessions only expire after a
+// period of inactivity.
+func (s *Service) validateSession(r *http.Request, sessionValue string) (*models.Session, error) {
+	return s.sessions.ValidateSession(r.Context(), hash.Hash(sessionValue),
+		time.Now().Add(s.sessionTTL), remoteIP(r), r.UserAgent())
+}
+
+// refreshSessionCookie reissues the session cookie so that it expires along
+// with the session after validateSession pushed its expiry back. The cookie
+// is left as is when the request doesn't say which page it came from, since
+// that's needed to know whether the cookie should be secure.
+func refreshSessionCookie(w http.ResponseWriter, r *http.Request, sessionValue string, session *models.Session) {
+	if session.ExpiresAt == nil {
+		return
+	}
+
+	referrer, err := url.Parse(r.Referer())
+	if err != nil || (referrer.Scheme != "http" && referrer.Scheme != "https") {
+		return
+	}
+
+	setSessionCookie(w, r, referrer, sessionValue, *session.ExpiresAt)
+}
+
+func setSessionCookie(w http.ResponseWriter, r *http.Request, referrer *url.URL, sessionValue string, expiresAt time.Time) {
+	cookie := &http.Cookie{
+		Name:  sessionCookie,
+		Value: sessionValue,
+
+		Expires: expiresAt,
+
+		Domain:   r.Host,
+		Secure:   referrer.Scheme == "https",
+		HttpOnly: true,
+	}
+
+	http.SetCookie(w, cookie)
+}
+
+func (s *Service) listMeSessions(w http.ResponseWriter, r *http.Request) {
+	s.withUserAuth(w, r, func(user *models.User) {
+		sessions, err := s.sessions.ListSessions(r.Context(), user.ID)
+		if err != nil {
+			log.WithError(err).Error("list sessions")
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		var currentSessionID string
+		if sessionValue, err := r.Cookie(sessionCookie); err == nil {
+			if session, err := s.validateSession(r, sessionValue.Value); err == nil {
+				currentSessionID = session.ID
+			}
+		}
+
+		ret := make([]models.SessionWithCurrent, 0, len(sessions))
+		for _, session := range sessions {
+			ret = append(ret, models.SessionWithCurrent{
+				Session: session,
+				Current: session.ID == currentSessionID,
+			})
+		}
+
+		utils.Respond(w, ret)
+	})
+}
+
+func (s *Service) deleteMeSession(w http.ResponseWriter, r *http.Request) {
+	s.withUserAuth(w, r, func(user *models.User) {
+		session, err := s.sessions.GetSession(r.Context(), mux.Vars(r)["session"])
+		if err == store.ErrSessionNotFound {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		} else if err != nil {
+			log.WithError(err).Error("get session")
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		if session.UserID != user.ID {
+			http.Error(w, store.ErrSessionNotFound.Error(), http.StatusNotFound)
+			return
+		}
+
+		if err := s.sessions.DeleteSession(r.Context(), session.ID); err != nil {
+			log.WithError(err).Error("delete session")
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+	})
+}
+
+// deleteUserSessions signs a user out everywhere. It's restricted to super
+// admins.
+func (s *Service) deleteUserSessions(w http.ResponseWriter, r *http.Request) {
+	s.withUserAuth(w, r, func(user *models.User) {
+		s.withSuperUserAuth(w, r, user, func() {
+			targetUser, err := s.users.GetUser(r.Context(), mux.Vars(r)["user"])
+			if err == store.ErrUserNotFound {
+				http.Error(w, err.Error(), http.StatusNotFound)
+				return
+			} else if err != nil {
+				log.WithError(err).Error("get user")
+				w.WriteHeader(http.StatusInternalServerError)
+				return
+			}
+
+			if err := s.sessions.DeleteUserSessions(r.Context(), targetUser.ID); err != nil {
+				log.WithError(err).Error("delete user sessions")
+				w.WriteHeader(http.StatusInternalServerError)
+				return
+			}
+		})
+	})
+}
@@ -0,0 +1,321 @@
+package service
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/apex/log"
+	"github.com/deviceplane/deviceplane/pkg/controller/authz"
+	"github.com/deviceplane/deviceplane/pkg/controller/store"
+	"github.com/deviceplane/deviceplane/pkg/models"
+	"github.com/deviceplane/deviceplane/pkg/utils"
+	"github.com/gorilla/mux"
+	"github.com/pkg/errors"
+)
+
+func (s *Service) createSsoGroupMapping(w http.ResponseWriter, r *http.Request) {
+	s.withUserOrServiceAccountAuth(w, r, func(user *models.User, serviceAccount *models.ServiceAccount) {
+		s.validateAuthorization(
+			authz.ResourceSsoGroupMappings, authz.ActionCreateSsoGroupMapping,
+			w, r,
+			user, serviceAccount,
+			func(project *models.Project) {
+				var createSsoGroupMappingRequest struct {
+					Group string `json:"group" validate:"required,min=1,max=255"`
+					Role  string `json:"role" validate:"required,min=1,max=100"`
+				}
+				if err := read(r, &createSsoGroupMappingRequest); err != nil {
+					http.Error(w, err.Error(), http.StatusBadRequest)
+					return
+				}
+
+				var role *models.Role
+				var err error
+				if strings.Contains(createSsoGroupMappingRequest.Role, "_") {
+					role, err = s.roles.GetRole(r.Context(), createSsoGroupMappingRequest.Role, project.ID)
+				} else {
+					role, err = s.roles.LookupRole(r.Context(), createSsoGroupMappingRequest.Role, project.ID)
+				}
+				if err == store.ErrRoleNotFound {
+					http.Error(w, err.Error(), http.StatusNotFound)
+					return
+				} else if err != nil {
+					log.WithError(err).Error("get/lookup role")
+					w.WriteHeader(http.StatusInternalServerError)
+					return
+				}
+
+				mapping, err := s.ssoGroupMappings.CreateSsoGroupMapping(r.Context(), project.ID,
+					createSsoGroupMappingRequest.Group, role.ID)
+				if err != nil {
+					log.WithError(err).Error("create SSO group mapping")
+					w.WriteHeader(http.StatusInternalServerError)
+					return
+				}
+
+				if err := s.resyncSsoGroup(r.Context(), mapping.Group); err != nil {
+					log.WithError(err).Error("resync SSO group")
+					w.WriteHeader(http.StatusInternalServerError)
+					return
+				}
+
+				utils.Respond(w, mapping)
+			},
+		)
+	})
+}
+
+func (s *Service) listSsoGroupMappings(w http.ResponseWriter, r *http.Request) {
+	s.withUserOrServiceAccountAuth(w, r, func(user *models.User, serviceAccount *models.ServiceAccount) {
+		s.validateAuthorization(
+			authz.ResourceSsoGroupMappings, authz.ActionListSsoGroupMappings,
+			w, r,
+			user, serviceAccount,
+			func(project *models.Project) {
+				mappings, err := s.ssoGroupMappings.ListSsoGroupMappings(r.Context(), project.ID)
+				if err != nil {
+					log.WithError(err).Error("list SSO group mappings")
+					w.WriteHeader(http.StatusInternalServerError)
+					return
+				}
+
+				utils.Respond(w, mappings)
+			},
+		)
+	})
+}
+
+func (s *Service) getSsoGroupMapping(w http.ResponseWriter, r *http.Request) {
+	s.withUserOrServiceAccountAuth(w, r, func(user *models.User, serviceAccount *models.ServiceAccount) {
+		s.validateAuthorization(
+			authz.ResourceSsoGroupMappings, authz.ActionGetSsoGroupMapping,
+			w, r,
+			user, serviceAccount,
+			func(project *models.Project) {
+				mapping, err := s.ssoGroupMappings.GetSsoGroupMapping(r.Context(),
+					mux.Vars(r)["ssogroupmapping"], project.ID)
+				if err == store.ErrSsoGroupMappingNotFound {
+					http.Error(w, err.Error(), http.StatusNotFound)
+					return
+				} else if err != nil {
+					log.WithError(err).Error("get SSO group mapping")
+					w.WriteHeader(http.StatusInternalServerError)
+					return
+				}
+
+				utils.Respond(w, mapping)
+			},
+		)
+	})
+}
+
+func (s *Service) deleteSsoGroupMapping(w http.ResponseWriter, r *http.Request) {
+	s.withUserOrServiceAccountAuth(w, r, func(user *models.User, serviceAccount *models.ServiceAccount) {
+		s.validateAuthorization(
+			authz.ResourceSsoGroupMappings, authz.ActionDeleteSsoGroupMapping,
+			w, r,
+			user, serviceAccount,
+			func(project *models.Project) {
+				mapping, err := s.ssoGroupMappings.GetSsoGroupMapping(r.Context(),
+					mux.Vars(r)["ssogroupmapping"], project.ID)
+				if err == store.ErrSsoGroupMappingNotFound {
+					return
+				} else if err != nil {
+					log.WithError(err).Error("get SSO group mapping")
+					w.WriteHeader(http.StatusInternalServerError)
+					return
+				}
+
+				if err := s.ssoGroupMappings.DeleteSsoGroupMapping(r.Context(),
+					mapping.ID, project.ID); err != nil {
+					log.WithError(err).Error("delete SSO group mapping")
+					w.WriteHeader(http.StatusInternalServerError)
+					return
+				}
+
+				// Members of the group lose the role straight away rather
+				// than at their next login
+				if err := s.resyncSsoGroup(r.Context(), mapping.Group); err != nil {
+					log.WithError(err).Error("resync SSO group")
+					w.WriteHeader(http.StatusInternalServerError)
+					return
+				}
+			},
+		)
+	})
+}
+
+const ssoGroupExpiryInterval = 5 * time.Minute
+
+type projectRole struct {
+	projectID string
+	roleID    string
+}
+
+// syncSsoGroupMappings records the groups that a user logged in with and
+// applies the SSO group mappings for them.
+func (s *Service) syncSsoGroupMappings(ctx context.Context, userID string, groups []string) error {
+	// Groups longer than a mapping's group can't match one
+	seen := make(map[string]bool)
+	var storedGroups []string
+	for _, group := range groups {
+		if seen[group] || len(group) > 255 {
+			continue
+		}
+		seen[group] = true
+		storedGroups = append(storedGroups, group)
+	}
+
+	if err := s.userSsoGroups.SetUserSsoGroups(ctx, userID, storedGroups); err != nil {
+		return errors.Wrap(err, "set user SSO groups")
+	}
+	return s.applySsoGroupMappings(ctx, userID, storedGroups)
+}
+
+// resyncSsoGroup applies the SSO group mappings again for each user that was
+// in a group when they last logged in, after the group's mappings change.
+func (s *Service) resyncSsoGroup(ctx context.Context, group string) error {
+	userIDs, err := s.userSsoGroups.ListUsersBySsoGroup(ctx, group)
+	if err != nil {
+		return errors.Wrap(err, "list users by SSO group")
+	}
+
+	for _, userID := range userIDs {
+		groups, err := s.userSsoGroups.ListUserSsoGroups(ctx, userID)
+		if err != nil {
+			return errors.Wrap(err, "list user SSO groups")
+		}
+		if err := s.applySsoGroupMappings(ctx, userID, groups); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// RunSsoGroupExpiry periodically revokes the roles that SSO group mappings
+// granted to users who haven't logged in through SSO within the SSO group
+// TTL. Their groups are only known as of their last login, so this bounds how
+// long someone keeps access after being removed from a group in the identity
+// provider.
+func (s *Service) RunSsoGroupExpiry(ctx context.Context) {
+	if s.ssoGroupTTL <= 0 {
+		return
+	}
+
+	ticker := time.NewTicker(ssoGroupExpiryInterval)
+	defer ticker.Stop()
+
+	for {
+		s.expireSsoGroups(ctx, time.Now())
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (s *Service) expireSsoGroups(ctx context.Context, now time.Time) {
+	userIDs, err := s.userSsoGroups.ListUsersWithSsoGroupsSyncedBefore(ctx, now.Add(-s.ssoGroupTTL))
+	if err != nil {
+		log.WithError(err).Error("list users with expired SSO groups")
+		return
+	}
+
+	for _, userID := range userIDs {
+		if err := s.syncSsoGroupMappings(ctx, userID, nil); err != nil {
+			log.WithField("user_id", userID).WithError(err).Error("expire SSO groups")
+		}
+	}
+}
+
+// applySsoGroupMappings brings the user's memberships and role bindings in
+// line with the SSO group mappings for their groups. Only role bindings that
+// were created by a previous sync are ever removed, and a membership is
+// removed once the user has no role bindings left in its project.
+func (s *Service) applySsoGroupMappings(ctx context.Context, userID string, groups []string) error {
+	mappings, err := s.ssoGroupMappings.ListSsoGroupMappingsByGroups(ctx, groups)
+	if err != nil {
+		return errors.Wrap(err, "list SSO group mappings by groups")
+	}
+
+	desired := make(map[projectRole]bool)
+	for _, mapping := range mappings {
+		desired[projectRole{mapping.ProjectID, mapping.RoleID}] = true
+	}
+
+	managedRoleBindings, err := s.ssoManagedRoleBindings.ListSsoManagedRoleBindingsByUser(ctx, userID)
+	if err != nil {
+		return errors.Wrap(err, "list SSO managed role bindings")
+	}
+
+	managed := make(map[projectRole]bool)
+	for _, roleBinding := range managedRoleBindings {
+		managed[projectRole{roleBinding.ProjectID, roleBinding.RoleID}] = true
+	}
+
+	for binding := range desired {
+		if managed[binding] {
+			continue
+		}
+
+		if _, err := s.memberships.GetMembership(ctx, userID, binding.projectID); err == store.ErrMembershipNotFound {
+			if _, err := s.memberships.CreateMembership(ctx, userID, binding.projectID); err != nil {
+				return errors.Wrap(err, "create membership")
+			}
+		} else if err != nil {
+			return errors.Wrap(err, "get membership")
+		}
+
+		// Leave role bindings that were granted by hand unmanaged so
+		// they survive the user leaving the group
+		if _, err := s.membershipRoleBindings.GetMembershipRoleBinding(ctx,
+			userID, binding.roleID, binding.projectID,
+		); err == nil {
+			continue
+		} else if err != store.ErrMembershipRoleBindingNotFound {
+			return errors.Wrap(err, "get membership role binding")
+		}
+
+		if _, err := s.membershipRoleBindings.CreateMembershipRoleBinding(ctx,
+			userID, binding.roleID, binding.projectID,
+		); err != nil {
+			return errors.Wrap(err, "create membership role binding")
+		}
+
+		if err := s.ssoManagedRoleBindings.CreateSsoManagedRoleBinding(ctx,
+			userID, binding.roleID, binding.projectID,
+		); err != nil {
+			return errors.Wrap(err, "create SSO managed role binding")
+		}
+	}
+
+	for binding := range managed {
+		if desired[binding] {
+			continue
+		}
+
+		if err := s.membershipRoleBindings.DeleteMembershipRoleBinding(ctx,
+			userID, binding.roleID, binding.projectID,
+		); err != nil {
+			return errors.Wrap(err, "delete membership role binding")
+		}
+
+		remainingRoleBindings, err := s.membershipRoleBindings.ListMembershipRoleBindings(ctx,
+			userID, binding.projectID)
+		if err != nil {
+			return errors.Wrap(err, "list membership role bindings")
+		}
+
+		if len(remainingRoleBindings) == 0 {
+			if err := s.memberships.DeleteMembership(ctx, userID, binding.projectID); err != nil {
+				return errors.Wrap(err, "delete membership")
+			}
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,213 @@
+package service
+
+import (
+	"context"
+	"testing"
+
+	"github.com/deviceplane/deviceplane/pkg/controller/store"
+	"github.com/deviceplane/deviceplane/pkg/models"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeSsoStore keeps one user's memberships and role bindings in memory
+type fakeSsoStore struct {
+	store.SsoGroupMappings
+	store.SsoManagedRoleBindings
+	store.Memberships
+	store.MembershipRoleBindings
+
+	mappings     []models.SsoGroupMapping
+	memberships  map[string]bool
+	roleBindings map[projectRole]bool
+	managed      map[projectRole]bool
+}
+
+func (f *fakeSsoStore) ListSsoGroupMappingsByGroups(ctx context.Context, groups []string) ([]models.SsoGroupMapping, error) {
+	var mappings []models.SsoGroupMapping
+	for _, mapping := range f.mappings {
+		for _, group := range groups {
+			if mapping.Group == group {
+				mappings = append(mappings, mapping)
+			}
+		}
+	}
+	return mappings, nil
+}
+
+func (f *fakeSsoStore) CreateSsoManagedRoleBinding(ctx context.Context, userID, roleID, projectID string) error {
+	f.managed[projectRole{projectID, roleID}] = true
+	return nil
+}
+
+func (f *fakeSsoStore) ListSsoManagedRoleBindingsByUser(ctx context.Context, userID string) ([]models.MembershipRoleBinding, error) {
+	var roleBindings []models.MembershipRoleBinding
+	for binding := range f.managed {
+		roleBindings = append(roleBindings, models.MembershipRoleBinding{
+			UserID:    userID,
+			RoleID:    binding.roleID,
+			ProjectID: binding.projectID,
+		})
+	}
+	return roleBindings, nil
+}
+
+func (f *fakeSsoStore) CreateMembership(ctx context.Context, userID, projectID string) (*models.Membership, error) {
+	f.memberships[projectID] = true
+	return &models.Membership{UserID: userID, ProjectID: projectID}, nil
+}
+
+func (f *fakeSsoStore) GetMembership(ctx context.Context, userID, projectID string) (*models.Membership, error) {
+	if !f.memberships[projectID] {
+		return nil, store.ErrMembershipNotFound
+	}
+	return &models.Membership{UserID: userID, ProjectID: projectID}, nil
+}
+
+func (f *fakeSsoStore) DeleteMembership(ctx context.Context, userID, projectID string) error {
+	delete(f.memberships, projectID)
+	return nil
+}
+
+func (f *fakeSsoStore) CreateMembershipRoleBinding(ctx context.Context, userID, roleID, projectID string) (*models.MembershipRoleBinding, error) {
+	f.roleBindings[projectRole{projectID, roleID}] = true
+	return &models.MembershipRoleBinding{UserID: userID, RoleID: roleID, ProjectID: projectID}, nil
+}
+
+func (f *fakeSsoStore) GetMembershipRoleBinding(ctx context.Context, userID, roleID, projectID string) (*models.MembershipRoleBinding, error) {
+	if !f.roleBindings[projectRole{projectID, roleID}] {
+		return nil, store.ErrMembershipRoleBindingNotFound
+	}
+	return &models.MembershipRoleBinding{UserID: userID, RoleID: roleID, ProjectID: projectID}, nil
+}
+
+func (f *fakeSsoStore) ListMembershipRoleBindings(ctx context.Context, userID, projectID string) ([]models.MembershipRoleBinding, error) {
+	var roleBindings []models.MembershipRoleBinding
+	for binding := range f.roleBindings {
+		if binding.projectID == projectID {
+			roleBindings = append(roleBindings, models.MembershipRoleBinding{
+				UserID:    userID,
+				RoleID:    binding.roleID,
+				ProjectID: binding.projectID,
+			})
+		}
+	}
+	return roleBindings, nil
+}
+
+// DeleteMembershipRoleBinding cascades to the SSO managed role binding like
+// the database does
+func (f *fakeSsoStore) DeleteMembershipRoleBinding(ctx context.Context, userID, roleID, projectID string) error {
+	delete(f.roleBindings, projectRole{projectID, roleID})
+	delete(f.managed, projectRole{projectID, roleID})
+	return nil
+}
+
+func TestApplySsoGroupMappings(t *testing.T) {
+	mappings := []models.SsoGroupMapping{
+		{ProjectID: "prj_1", Group: "ops", RoleID: "rol_admin"},
+		{ProjectID: "prj_1", Group: "dev", RoleID: "rol_write"},
+		{ProjectID: "prj_2", Group: "dev", RoleID: "rol_read"},
+	}
+
+	for _, tc := range []struct {
+		name   string
+		groups []string
+
+		memberships []string
+		manual      []projectRole
+		managed     []projectRole
+
+		expectedMemberships []string
+		expectedManual      []projectRole
+		expectedManaged     []projectRole
+	}{
+		{
+			name:                "adds mapped roles",
+			groups:              []string{"dev"},
+			expectedMemberships: []string{"prj_1", "prj_2"},
+			expectedManaged:     []projectRole{{"prj_1", "rol_write"}, {"prj_2", "rol_read"}},
+		},
+		{
+			name:                "keeps roles that are still mapped",
+			groups:              []string{"ops"},
+			memberships:         []string{"prj_1"},
+			managed:             []projectRole{{"prj_1", "rol_admin"}},
+			expectedMemberships: []string{"prj_1"},
+			expectedManaged:     []projectRole{{"prj_1", "rol_admin"}},
+		},
+		{
+			name:                "replaces roles when groups change",
+			groups:              []string{"dev"},
+			memberships:         []string{"prj_1"},
+			managed:             []projectRole{{"prj_1", "rol_admin"}},
+			expectedMemberships: []string{"prj_1", "prj_2"},
+			expectedManaged:     []projectRole{{"prj_1", "rol_write"}, {"prj_2", "rol_read"}},
+		},
+		{
+			name:        "removes memberships left without roles",
+			memberships: []string{"prj_1", "prj_2"},
+			managed:     []projectRole{{"prj_1", "rol_write"}, {"prj_2", "rol_read"}},
+		},
+		{
+			name:                "keeps manually created bindings and their memberships",
+			memberships:         []string{"prj_1"},
+			manual:              []projectRole{{"prj_1", "rol_read"}},
+			managed:             []projectRole{{"prj_1", "rol_admin"}},
+			expectedMemberships: []string{"prj_1"},
+			expectedManual:      []projectRole{{"prj_1", "rol_read"}},
+		},
+		{
+			name:                "doesn't take over manually created bindings",
+			groups:              []string{"ops"},
+			memberships:         []string{"prj_1"},
+			manual:              []projectRole{{"prj_1", "rol_admin"}},
+			expectedMemberships: []string{"prj_1"},
+			expectedManual:      []projectRole{{"prj_1", "rol_admin"}},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			f := &fakeSsoStore{
+				mappings:     mappings,
+				memberships:  make(map[string]bool),
+				roleBindings: make(map[projectRole]bool),
+				managed:      make(map[projectRole]bool),
+			}
+			for _, projectID := range tc.memberships {
+				f.memberships[projectID] = true
+			}
+			for _, binding := range tc.manual {
+				f.roleBindings[binding] = true
+			}
+			for _, binding := range tc.managed {
+				f.roleBindings[binding] = true
+				f.managed[binding] = true
+			}
+
+			s := &Service{
+				ssoGroupMappings:       f,
+				ssoManagedRoleBindings: f,
+				memberships:            f,
+				membershipRoleBindings: f,
+			}
+			require.NoError(t, s.applySsoGroupMappings(context.Background(), "usr_1", tc.groups))
+
+			expectedMemberships := make(map[string]bool)
+			for _, projectID := range tc.expectedMemberships {
+				expectedMemberships[projectID] = true
+			}
+			expectedRoleBindings := make(map[projectRole]bool)
+			expectedManaged := make(map[projectRole]bool)
+			for _, binding := range tc.expectedManual {
+				expectedRoleBindings[binding] = true
+			}
+			for _, binding := range tc.expectedManaged {
+				expectedRoleBindings[binding] = true
+				expectedManaged[binding] = true
+			}
+
+			require.Equal(t, expectedMemberships, f.memberships)
+			require.Equal(t, expectedRoleBindings, f.roleBindings)
+			require.Equal(t, expectedManaged, f.managed)
+		})
+	}
+}
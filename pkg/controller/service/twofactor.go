@@ -0,0 +1,342 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"net/http"
+	"time"
+
+	"github.com/apex/log"
+	"github.com/deviceplane/deviceplane/pkg/controller/authz"
+	"github.com/deviceplane/deviceplane/pkg/controller/store"
+	"github.com/deviceplane/deviceplane/pkg/hash"
+	"github.com/deviceplane/deviceplane/pkg/models"
+	"github.com/deviceplane/deviceplane/pkg/totp"
+	"github.com/deviceplane/deviceplane/pkg/utils"
+	"github.com/pkg/errors"
+)
+
+const (
+	totpIssuer        = "Deviceplane"
+	recoveryCodeCount = 10
+
+	// Attempts are locked out for a while after this many invalid codes in a
+	// row, which makes guessing a code impractical
+	twoFactorMaxAttempts = 5
+	twoFactorLockout     = 5 * time.Minute
+)
+
+var (
+	errTwoFactorCodeRequired = errors.New("two-factor authentication code required")
+	errTwoFactorCodeInvalid  = errors.New("invalid two-factor authentication code")
+	errTwoFactorLocked       = errors.New("too many invalid two-factor authentication codes, try again later")
+	errTwoFactorEnabled      = errors.New("two-factor authentication is already enabled")
+	errTwoFactorNotEnabled   = errors.New("two-factor authentication is not enabled")
+	errTwoFactorRequired     = errors.New("this project requires two-factor authentication")
+	errTwoFactorInternalOnly = errors.New("two-factor authentication is only available for password logins")
+)
+
+// twoFactorActions are the actions that a project's security config can
+// restrict to users with two-factor authentication.
+var twoFactorActions = map[authz.Action]bool{
+	authz.ActionSSH:         true,
+	authz.ActionConnect:     true,
+	authz.ActionConnectPort: true,
+}
+
+func (s *Service) getMeTOTP(w http.ResponseWriter, r *http.Request) {
+	s.withUserAuth(w, r, func(user *models.User) {
+		userTOTP, err := s.userTOTPs.GetUserTOTP(r.Context(), user.ID)
+		if err == store.ErrUserTOTPNotFound {
+			utils.Respond(w, models.UserTOTP{
+				UserID: user.ID,
+			})
+			return
+		} else if err != nil {
+			log.WithError(err).Error("get user TOTP")
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		utils.Respond(w, userTOTP)
+	})
+}
+
+// createMeTOTP starts enrollment. Two-factor authentication isn't enforced
+// until the first code is verified with verifyMeTOTP.
+func (s *Service) createMeTOTP(w http.ResponseWriter, r *http.Request) {
+	s.withUserAuth(w, r, func(user *models.User) {
+		if user.InternalUserID == nil {
+			http.Error(w, errTwoFactorInternalOnly.Error(), http.StatusBadRequest)
+			return
+		}
+
+		internalUser, err := s.internalUsers.GetInternalUser(r.Context(), *user.InternalUserID)
+		if err != nil {
+			log.WithError(err).Error("get internal user")
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		if userTOTP, err := s.userTOTPs.GetUserTOTP(r.Context(), user.ID); err == nil && userTOTP.Enabled {
+			http.Error(w, errTwoFactorEnabled.Error(), http.StatusBadRequest)
+			return
+		} else if err != nil && err != store.ErrUserTOTPNotFound {
+			log.WithError(err).Error("get user TOTP")
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		secret, err := totp.GenerateSecret()
+		if err != nil {
+			log.WithError(err).Error("generate TOTP secret")
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		if _, err := s.userTOTPs.SetUserTOTPSecret(r.Context(), user.ID, secret); err != nil {
+			log.WithError(err).Error("set user TOTP secret")
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		utils.Respond(w, models.UserTOTPEnrollment{
+			Secret: secret,
+			URI:    totp.URI(totpIssuer, internalUser.Email, secret),
+		})
+	})
+}
+
+func (s *Service) verifyMeTOTP(w http.ResponseWriter, r *http.Request) {
+	s.withUserAuth(w, r, func(user *models.User) {
+		var verifyTOTPRequest struct {
+			Code string `json:"code" validate:"required,min=1,max=10"`
+		}
+		if err := read(r, &verifyTOTPRequest); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		userTOTP, err := s.userTOTPs.GetUserTOTP(r.Context(), user.ID)
+		if err == store.ErrUserTOTPNotFound {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		} else if err != nil {
+			log.WithError(err).Error("get user TOTP")
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		if userTOTP.Enabled {
+			http.Error(w, errTwoFactorEnabled.Error(), http.StatusBadRequest)
+			return
+		}
+
+		switch err := s.checkTOTPCode(r.Context(), userTOTP, verifyTOTPRequest.Code); err {
+		case nil:
+		case errTwoFactorCodeInvalid:
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		case errTwoFactorLocked:
+			http.Error(w, err.Error(), http.StatusTooManyRequests)
+			return
+		default:
+			log.WithError(err).Error("check TOTP code")
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		if _, err := s.userTOTPs.EnableUserTOTP(r.Context(), user.ID); err != nil {
+			log.WithError(err).Error("enable user TOTP")
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		recoveryCodes, err := s.newRecoveryCodes(r.Context(), user.ID)
+		if err != nil {
+			log.WithError(err).Error("create recovery codes")
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		utils.Respond(w, recoveryCodes)
+	})
+}
+
+func (s *Service) deleteMeTOTP(w http.ResponseWriter, r *http.Request) {
+	s.withUserAuth(w, r, func(user *models.User) {
+		s.withVerifiedTOTPCode(w, r, user, func() {
+			if err := s.userTOTPs.DeleteUserTOTP(r.Context(), user.ID); err != nil {
+				log.WithError(err).Error("delete user TOTP")
+				w.WriteHeader(http.StatusInternalServerError)
+				return
+			}
+
+			if err := s.userRecoveryCodes.SetUserRecoveryCodes(r.Context(), user.ID, nil); err != nil {
+				log.WithError(err).Error("delete recovery codes")
+				w.WriteHeader(http.StatusInternalServerError)
+				return
+			}
+		})
+	})
+}
+
+func (s *Service) createMeRecoveryCodes(w http.ResponseWriter, r *http.Request) {
+	s.withUserAuth(w, r, func(user *models.User) {
+		s.withVerifiedTOTPCode(w, r, user, func() {
+			recoveryCodes, err := s.newRecoveryCodes(r.Context(), user.ID)
+			if err != nil {
+				log.WithError(err).Error("create recovery codes")
+				w.WriteHeader(http.StatusInternalServerError)
+				return
+			}
+
+			utils.Respond(w, recoveryCodes)
+		})
+	})
+}
+
+// withVerifiedTOTPCode requires a current code for changes to an enabled
+// TOTP enrollment so that a stolen session can't turn it off.
+func (s *Service) withVerifiedTOTPCode(w http.ResponseWriter, r *http.Request, user *models.User, f func()) {
+	var codeRequest struct {
+		Code string `json:"code" validate:"required,min=1,max=10"`
+	}
+	if err := read(r, &codeRequest); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	userTOTP, err := s.userTOTPs.GetUserTOTP(r.Context(), user.ID)
+	if err == store.ErrUserTOTPNotFound || (err == nil && !userTOTP.Enabled) {
+		http.Error(w, errTwoFactorNotEnabled.Error(), http.StatusBadRequest)
+		return
+	} else if err != nil {
+		log.WithError(err).Error("get user TOTP")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	switch err := s.checkTOTPCode(r.Context(), userTOTP, codeRequest.Code); err {
+	case nil:
+	case errTwoFactorCodeInvalid:
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	case errTwoFactorLocked:
+		http.Error(w, err.Error(), http.StatusTooManyRequests)
+		return
+	default:
+		log.WithError(err).Error("check TOTP code")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	f()
+}
+
+// checkTOTPCode validates a code against the user's secret. Each code is
+// only accepted once, and too many invalid codes in a row lock out further
+// attempts for a while.
+func (s *Service) checkTOTPCode(ctx context.Context, userTOTP *models.UserTOTP, code string) error {
+	if userTOTP.Locked {
+		return errTwoFactorLocked
+	}
+
+	counter, valid := totp.ValidateCounter(userTOTP.Secret, code, time.Now())
+	if !valid {
+		return s.recordTwoFactorFailure(ctx, userTOTP.UserID)
+	}
+
+	if err := s.userTOTPs.UseUserTOTPCounter(ctx, userTOTP.UserID, counter); err == store.ErrUserTOTPCodeUsed {
+		return s.recordTwoFactorFailure(ctx, userTOTP.UserID)
+	} else if err != nil {
+		return err
+	}
+	return nil
+}
+
+func (s *Service) recordTwoFactorFailure(ctx context.Context, userID string) error {
+	if err := s.userTOTPs.RecordUserTOTPFailure(ctx, userID, twoFactorMaxAttempts, twoFactorLockout); err != nil {
+		return err
+	}
+	return errTwoFactorCodeInvalid
+}
+
+// newRecoveryCodes replaces the user's recovery codes. Only the hashes are
+// stored so the codes can't be shown again.
+func (s *Service) newRecoveryCodes(ctx context.Context, userID string) (*models.UserRecoveryCodes, error) {
+	codes := make([]string, recoveryCodeCount)
+	hashes := make([]string, recoveryCodeCount)
+	for i := range codes {
+		codeBytes := make([]byte, 5)
+		if _, err := rand.Read(codeBytes); err != nil {
+			return nil, err
+		}
+		code := hex.EncodeToString(codeBytes)
+		codes[i] = code[:5] + "-" + code[5:]
+		hashes[i] = hash.Hash(codes[i])
+	}
+
+	if err := s.userRecoveryCodes.SetUserRecoveryCodes(ctx, userID, hashes); err != nil {
+		return nil, err
+	}
+
+	return &models.UserRecoveryCodes{
+		Codes: codes,
+	}, nil
+}
+
+// validateSecondFactor checks the code or recovery code given at login if the
+// user has two-factor authentication enabled. Codes and recovery codes can
+// only be used once.
+func (s *Service) validateSecondFactor(ctx context.Context, userID string, code, recoveryCode *string) error {
+	userTOTP, err := s.userTOTPs.GetUserTOTP(ctx, userID)
+	if err == store.ErrUserTOTPNotFound || (err == nil && !userTOTP.Enabled) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	switch {
+	case code != nil:
+		return s.checkTOTPCode(ctx, userTOTP, *code)
+	case recoveryCode != nil:
+		// Recovery codes share the lockout with TOTP codes
+		if userTOTP.Locked {
+			return errTwoFactorLocked
+		}
+		if err := s.userRecoveryCodes.UseUserRecoveryCode(ctx, userID, hash.Hash(*recoveryCode)); err == store.ErrUserRecoveryCodeNotFound {
+			return s.recordTwoFactorFailure(ctx, userID)
+		} else if err != nil {
+			return err
+		}
+		return s.userTOTPs.ResetUserTOTPFailures(ctx, userID)
+	default:
+		return errTwoFactorCodeRequired
+	}
+}
+
+// satisfiesTwoFactorRequirement reports whether the user may perform actions
+// in twoFactorActions on the project. Users who log in through SSO are
+// expected to have multi-factor authentication enforced by their identity
+// provider.
+func (s *Service) satisfiesTwoFactorRequirement(ctx context.Context, project *models.Project, user *models.User) (bool, error) {
+	securityConfig, err := s.securityConfigs.GetSecurityConfig(ctx, project.ID)
+	if err != nil {
+		return false, err
+	}
+
+	if !securityConfig.RequireTwoFactor || user.InternalUserID == nil {
+		return true, nil
+	}
+
+	userTOTP, err := s.userTOTPs.GetUserTOTP(ctx, user.ID)
+	if err == store.ErrUserTOTPNotFound {
+		return false, nil
+	} else if err != nil {
+		return false, err
+	}
+
+	return userTOTP.Enabled, nil
+}
@@ -1,6 +1,7 @@
 package service
 
 import (
+	"context"
 	"net"
 	"net/http"
 	"strings"
@@ -8,7 +9,6 @@ import (
 	"github.com/apex/log"
 	"github.com/deviceplane/deviceplane/pkg/codes"
 	"github.com/deviceplane/deviceplane/pkg/controller/authz"
-	serviceutils "github.com/deviceplane/deviceplane/pkg/controller/service/utils"
 	"github.com/deviceplane/deviceplane/pkg/controller/store"
 	"github.com/deviceplane/deviceplane/pkg/hash"
 	"github.com/deviceplane/deviceplane/pkg/models"
@@ -21,6 +21,8 @@ import (
 
 var ErrDependencyNotSupplied = errors.New("internal route dependency not supplied")
 
+var errScopedAccessKeyNotAllowed = errors.New("access keys with a config can't be used for this request")
+
 type FetchObject struct {
 	Project                 *models.Project
 	Role                    *models.Role
@@ -95,112 +97,400 @@ func (s *Service) validateAuthorization(
 		return
 	}
 
-	var roles []string
-	superAdmin := false
+	authorizationConfigs, err := s.getAuthorizationConfigs(r.Context(), project, user, serviceAccount)
+	if err == store.ErrMembershipNotFound {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	} else if err == store.ErrServiceAccountNotFound {
+		w.WriteHeader(http.StatusForbidden)
+		return
+	} else if err != nil {
+		log.WithError(err).Error("get authorization configs")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	var object *authz.Object
+	if authorizationConfigs.scoped() {
+		object, err = s.getAuthorizationObject(r.Context(), project, requestedResource, mux.Vars(r)[authorizationObjectVars[requestedResource]])
+		if err != nil {
+			log.WithError(err).Error("get authorization object")
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+	}
+
+	if !authorizationConfigs.evaluate(requestedResource, requestedAction, object) {
+		w.WriteHeader(http.StatusForbidden)
+		return
+	}
+
+	if user != nil && twoFactorActions[requestedAction] {
+		satisfied, err := s.satisfiesTwoFactorRequirement(r.Context(), project, user)
+		if err != nil {
+			log.WithError(err).Error("check two-factor requirement")
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		if !satisfied {
+			http.Error(w, errTwoFactorRequired.Error(), http.StatusForbidden)
+			return
+		}
+	}
+
+	f(project)
+}
+
+// authorizationRole is a project or organization role that grants one of
+// the configs in authorizationConfigs.
+type authorizationRole struct {
+	ID   string
+	Name string
+}
+
+// authorizationConfigs decide what a user or service account can do in a
+// project.
+type authorizationConfigs struct {
+	superAdmin bool
+	// roles has the role that each config comes from, and is empty for super
+	// admins
+	roles   []authorizationRole
+	configs []authz.Config
+	// accessKeyConfigs is set if the subject authenticated with an access key
+	// that has a config of its own
+	accessKeyConfigs []authz.Config
+}
+
+// scoped returns true if any of the configs have rules that depend on the
+// object being accessed.
+func (c *authorizationConfigs) scoped() bool {
+	return authz.Scoped(c.configs) || authz.Scoped(c.accessKeyConfigs)
+}
+
+// evaluate returns true if an action is allowed on an object. Access keys with
+// a config of their own can only do what both the key and its owner are
+// allowed to do.
+func (c *authorizationConfigs) evaluate(resource authz.Resource, action authz.Action, object *authz.Object) bool {
+	if !authz.EvaluateObject(resource, action, object, c.configs) {
+		return false
+	}
+	if c.accessKeyConfigs != nil && !authz.EvaluateObject(resource, action, object, c.accessKeyConfigs) {
+		return false
+	}
+	return true
+}
+
+// evaluateDevice is evaluate for a device that was selected by a query
+// rather than named in the request's route. validateAuthorization can't see
+// those devices, so handlers that act on many devices use this to apply
+// device scoped rules to each of them.
+func (c *authorizationConfigs) evaluateDevice(resource authz.Resource, action authz.Action, device models.Device) bool {
+	return c.evaluate(resource, action, &authz.Object{ID: device.ID, Name: device.Name, Labels: device.Labels})
+}
+
+// getAuthorizationConfigs returns the configs that apply to a user or service
+// account in a project. Roles granted in the project's organization cascade
+// into the project, so organization members don't need a project membership.
+// It returns store.ErrMembershipNotFound if the user isn't a member of the
+// project or its organization, and store.ErrServiceAccountNotFound if the
+// service account doesn't belong to the project.
+func (s *Service) getAuthorizationConfigs(ctx context.Context, project *models.Project,
+	user *models.User, serviceAccount *models.ServiceAccount,
+) (*authorizationConfigs, error) {
+	var c authorizationConfigs
+	var roleIDs []string
+
 	if user != nil {
 		if user.SuperAdmin {
-			superAdmin = true
+			c.superAdmin = true
+			c.configs = []authz.Config{authz.AdminAllRole}
 		} else {
-			if _, err := s.memberships.GetMembership(r.Context(),
+			projectMember := true
+			if _, err := s.memberships.GetMembership(ctx,
 				user.ID, project.ID,
 			); err == store.ErrMembershipNotFound {
-				http.Error(w, err.Error(), http.StatusNotFound)
-				return
+				projectMember = false
 			} else if err != nil {
-				// TODO: better logging all around
-				log.WithField("user_id", user.ID).
-					WithField("project_id", project.ID).
-					WithError(err).
-					Error("get membership")
-				w.WriteHeader(http.StatusInternalServerError)
-				return
+				return nil, errors.Wrap(err, "get membership")
 			}
 
-			roleBindings, err := s.membershipRoleBindings.ListMembershipRoleBindings(
-				r.Context(),
-				user.ID,
-				project.ID,
-			)
-			if err != nil {
-				log.WithError(err).Error("list membership role bindings")
-				w.WriteHeader(http.StatusInternalServerError)
-				return
+			organizationMember := false
+			var organizationRoles []models.OrganizationRole
+			var organizationConfigs []authz.Config
+			if project.OrganizationID != nil {
+				var err error
+				organizationMember, organizationRoles, organizationConfigs, err = s.getOrganizationRoleConfigs(ctx,
+					user.ID, *project.OrganizationID)
+				if err != nil {
+					return nil, errors.Wrap(err, "get organization role configs")
+				}
+			}
+
+			if !projectMember && !organizationMember {
+				return nil, store.ErrMembershipNotFound
 			}
 
-			for _, roleBinding := range roleBindings {
-				roles = append(roles, roleBinding.RoleID)
+			if projectMember {
+				roleBindings, err := s.membershipRoleBindings.ListMembershipRoleBindings(ctx,
+					user.ID, project.ID)
+				if err != nil {
+					return nil, errors.Wrap(err, "list membership role bindings")
+				}
+				for _, roleBinding := range roleBindings {
+					roleIDs = append(roleIDs, roleBinding.RoleID)
+				}
 			}
+
+			roles, configs, err := s.getRoleConfigs(ctx, project.ID, roleIDs)
+			if err != nil {
+				return nil, errors.Wrap(err, "get role configs")
+			}
+			for _, role := range roles {
+				c.roles = append(c.roles, authorizationRole{ID: role.ID, Name: role.Name})
+			}
+			for _, role := range organizationRoles {
+				c.roles = append(c.roles, authorizationRole{ID: role.ID, Name: role.Name})
+			}
+			c.configs = append(configs, organizationConfigs...)
 		}
 	} else if serviceAccount != nil {
 		// Sanity check that this service account belongs to this project
-		if _, err := s.serviceAccounts.GetServiceAccount(r.Context(),
+		if _, err := s.serviceAccounts.GetServiceAccount(ctx,
 			serviceAccount.ID, project.ID,
-		); err == store.ErrServiceAccountNotFound {
-			w.WriteHeader(http.StatusForbidden)
-			return
-		} else if err != nil {
-			log.WithError(err).Error("get service account")
-			w.WriteHeader(http.StatusInternalServerError)
-			return
+		); err != nil {
+			return nil, err
 		}
 
-		roleBindings, err := s.serviceAccountRoleBindings.ListServiceAccountRoleBindings(r.Context(),
+		roleBindings, err := s.serviceAccountRoleBindings.ListServiceAccountRoleBindings(ctx,
 			serviceAccount.ID, project.ID)
 		if err != nil {
-			log.WithError(err).Error("list service account role bindings")
-			w.WriteHeader(http.StatusInternalServerError)
-			return
+			return nil, errors.Wrap(err, "list service account role bindings")
 		}
-
 		for _, roleBinding := range roleBindings {
-			roles = append(roles, roleBinding.RoleID)
+			roleIDs = append(roleIDs, roleBinding.RoleID)
+		}
+
+		roles, configs, err := s.getRoleConfigs(ctx, project.ID, roleIDs)
+		if err != nil {
+			return nil, errors.Wrap(err, "get role configs")
+		}
+		for _, role := range roles {
+			c.roles = append(c.roles, authorizationRole{ID: role.ID, Name: role.Name})
+		}
+		c.configs = configs
+	} else {
+		return nil, ErrDependencyNotSupplied
+	}
+
+	var accessKeyConfig *string
+	if user != nil {
+		accessKeyConfig = user.AccessKeyConfig
+	} else {
+		accessKeyConfig = serviceAccount.AccessKeyConfig
+	}
+	if accessKeyConfig != nil {
+		var config authz.Config
+		if err := yaml.Unmarshal([]byte(*accessKeyConfig), &config); err != nil {
+			return nil, errors.Wrap(err, "unmarshal access key config")
 		}
+		c.accessKeyConfigs = []authz.Config{config}
 	}
 
+	return &c, nil
+}
+
+// getRoleConfigs returns the roles with the given IDs along with their parsed
+// configs. Roles that no longer exist are skipped.
+func (s *Service) getRoleConfigs(ctx context.Context, projectID string, roleIDs []string) ([]models.Role, []authz.Config, error) {
+	var roles []models.Role
 	var configs []authz.Config
-	if superAdmin {
-		configs = []authz.Config{
-			authz.AdminAllRole,
+	for _, roleID := range roleIDs {
+		role, err := s.roles.GetRole(ctx, roleID, projectID)
+		if err == store.ErrRoleNotFound {
+			continue
+		} else if err != nil {
+			return nil, nil, err
 		}
-	} else {
-		for _, roleID := range roles {
-			role, err := s.roles.GetRole(r.Context(), roleID, project.ID)
-			if err == store.ErrRoleNotFound {
-				continue
-			} else if err != nil {
-				log.WithError(err).Error("get role")
-				w.WriteHeader(http.StatusInternalServerError)
-				return
-			}
-			var config authz.Config
-			if err := yaml.Unmarshal([]byte(role.Config), &config); err != nil {
-				log.WithError(err).Error("unmarshal role config")
-				w.WriteHeader(http.StatusInternalServerError)
-				return
-			}
-			configs = append(configs, config)
+		var config authz.Config
+		if err := yaml.Unmarshal([]byte(role.Config), &config); err != nil {
+			return nil, nil, errors.Wrapf(err, "unmarshal config of role %s", role.ID)
 		}
+		roles = append(roles, *role)
+		configs = append(configs, config)
 	}
+	return roles, configs, nil
+}
 
-	if !authz.Evaluate(requestedResource, requestedAction, configs) {
-		w.WriteHeader(http.StatusForbidden)
-		return
+// getOrganizationRoleConfigs returns whether the user is a member of the
+// organization along with their organization roles and parsed configs.
+func (s *Service) getOrganizationRoleConfigs(ctx context.Context, userID, organizationID string) (bool, []models.OrganizationRole, []authz.Config, error) {
+	if _, err := s.organizationMemberships.GetOrganizationMembership(ctx,
+		userID, organizationID,
+	); err == store.ErrOrganizationMembershipNotFound {
+		return false, nil, nil, nil
+	} else if err != nil {
+		return false, nil, nil, err
 	}
 
-	f(project)
+	roleBindings, err := s.organizationMembershipRoleBindings.ListOrganizationMembershipRoleBindings(ctx,
+		userID, organizationID)
+	if err != nil {
+		return false, nil, nil, err
+	}
+
+	var roles []models.OrganizationRole
+	var configs []authz.Config
+	for _, roleBinding := range roleBindings {
+		role, err := s.organizationRoles.GetOrganizationRole(ctx, roleBinding.RoleID, organizationID)
+		if err == store.ErrOrganizationRoleNotFound {
+			continue
+		} else if err != nil {
+			return false, nil, nil, err
+		}
+		var config authz.Config
+		if err := yaml.Unmarshal([]byte(role.Config), &config); err != nil {
+			return false, nil, nil, errors.Wrapf(err, "unmarshal config of organization role %s", role.ID)
+		}
+		roles = append(roles, *role)
+		configs = append(configs, config)
+	}
+	return true, roles, configs, nil
+}
+
+// authorizationObjectVars maps each resource to the route variable that
+// identifies the object it's scoped to.
+var authorizationObjectVars = map[authz.Resource]string{
+	authz.ResourceDevices:                                     "device",
+	authz.ResourceDeviceLabels:                                "device",
+	authz.ResourceDeviceEnvironmentVariables:                  "device",
+	authz.ResourceDeviceAccessKeys:                            "device",
+	authz.ResourceApplications:                                "application",
+	authz.ResourceReleases:                                    "application",
+	authz.ResourceConnections:                                 "connection",
+	authz.ResourceRoles:                                       "role",
+	authz.ResourceServiceAccounts:                             "serviceaccount",
+	authz.ResourceServiceAccountAccessKeys:                    "serviceaccount",
+	authz.ResourceServiceAccountRoleBindings:                  "serviceaccount",
+	authz.ResourceDeviceRegistrationTokens:                    "deviceregistrationtoken",
+	authz.ResourceDeviceRegistrationTokenLabels:               "deviceregistrationtoken",
+	authz.ResourceDeviceRegistrationTokenEnvironmentVariables: "deviceregistrationtoken",
+}
+
+// getAuthorizationObject looks up the object with the given name or ID so
+// that scoped rules can be evaluated against it. It returns nil if there's
+// no identifier or the object doesn't exist, leaving the not found response
+// to the handler.
+func (s *Service) getAuthorizationObject(ctx context.Context, project *models.Project, resource authz.Resource, identifier string) (*authz.Object, error) {
+	if identifier == "" {
+		return nil, nil
+	}
+
+	var object *authz.Object
+	var err error
+	switch resource {
+	case authz.ResourceDevices, authz.ResourceDeviceLabels, authz.ResourceDeviceEnvironmentVariables, authz.ResourceDeviceAccessKeys:
+		var device *models.Device
+		if strings.Contains(identifier, "_") {
+			device, err = s.devices.GetDevice(ctx, identifier, project.ID)
+		} else {
+			device, err = s.devices.LookupDevice(ctx, identifier, project.ID)
+		}
+		if device != nil {
+			object = &authz.Object{ID: device.ID, Name: device.Name, Labels: device.Labels}
+		}
+	case authz.ResourceApplications, authz.ResourceReleases:
+		var application *models.Application
+		if strings.Contains(identifier, "_") {
+			application, err = s.applications.GetApplication(ctx, identifier, project.ID)
+		} else {
+			application, err = s.applications.LookupApplication(ctx, identifier, project.ID)
+		}
+		if application != nil {
+			object = &authz.Object{ID: application.ID, Name: application.Name}
+		}
+	case authz.ResourceConnections:
+		var connection *models.Connection
+		if strings.Contains(identifier, "_") {
+			connection, err = s.connections.GetConnection(ctx, identifier, project.ID)
+		} else {
+			connection, err = s.connections.LookupConnection(ctx, identifier, project.ID)
+		}
+		if connection != nil {
+			object = &authz.Object{ID: connection.ID, Name: connection.Name}
+		}
+	case authz.ResourceRoles:
+		var role *models.Role
+		if strings.Contains(identifier, "_") {
+			role, err = s.roles.GetRole(ctx, identifier, project.ID)
+		} else {
+			role, err = s.roles.LookupRole(ctx, identifier, project.ID)
+		}
+		if role != nil {
+			object = &authz.Object{ID: role.ID, Name: role.Name}
+		}
+	case authz.ResourceServiceAccounts, authz.ResourceServiceAccountAccessKeys, authz.ResourceServiceAccountRoleBindings:
+		var serviceAccount *models.ServiceAccount
+		if strings.Contains(identifier, "_") {
+			serviceAccount, err = s.serviceAccounts.GetServiceAccount(ctx, identifier, project.ID)
+		} else {
+			serviceAccount, err = s.serviceAccounts.LookupServiceAccount(ctx, identifier, project.ID)
+		}
+		if serviceAccount != nil {
+			object = &authz.Object{ID: serviceAccount.ID, Name: serviceAccount.Name}
+		}
+	case authz.ResourceDeviceRegistrationTokens, authz.ResourceDeviceRegistrationTokenLabels, authz.ResourceDeviceRegistrationTokenEnvironmentVariables:
+		var token *models.DeviceRegistrationToken
+		if strings.Contains(identifier, "_") {
+			token, err = s.deviceRegistrationTokens.GetDeviceRegistrationToken(ctx, identifier, project.ID)
+		} else {
+			token, err = s.deviceRegistrationTokens.LookupDeviceRegistrationToken(ctx, identifier, project.ID)
+		}
+		if token != nil {
+			object = &authz.Object{ID: token.ID, Name: token.Name, Labels: token.Labels}
+		}
+	default:
+		return nil, nil
+	}
+
+	switch err {
+	case nil:
+		return object, nil
+	case store.ErrDeviceNotFound, store.ErrApplicationNotFound, store.ErrConnectionNotFound,
+		store.ErrRoleNotFound, store.ErrServiceAccountNotFound, store.ErrDeviceRegistrationTokenNotFound:
+		return nil, nil
+	default:
+		return nil, err
+	}
 }
 
 func (s *Service) withDeviceAuth(w http.ResponseWriter, r *http.Request, f func(project *models.Project, device *models.Device)) {
+	s.withDeviceAccessKeyAuth(w, r, func(project *models.Project, device *models.Device, deviceAccessKey *models.DeviceAccessKey) {
+		f(project, device)
+	})
+}
+
+func (s *Service) withDeviceAccessKeyAuth(w http.ResponseWriter, r *http.Request, f func(project *models.Project, device *models.Device, deviceAccessKey *models.DeviceAccessKey)) {
 	vars := mux.Vars(r)
 	projectID := vars["project"]
 
-	deviceAccessKeyValue, _, _ := r.BasicAuth()
-	if deviceAccessKeyValue == "" {
-		w.WriteHeader(http.StatusUnauthorized)
+	certificate, err := s.clientCertificate(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
 		return
 	}
 
-	deviceAccessKey, err := s.deviceAccessKeys.ValidateDeviceAccessKey(r.Context(), projectID, hash.Hash(deviceAccessKeyValue))
+	var deviceAccessKey *models.DeviceAccessKey
+	if certificate != nil {
+		deviceAccessKey, err = s.validateDeviceCertificate(r.Context(), projectID, certificate)
+	} else {
+		deviceAccessKeyValue, _, _ := r.BasicAuth()
+		if deviceAccessKeyValue == "" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		deviceAccessKey, err = s.deviceAccessKeys.ValidateDeviceAccessKey(r.Context(), projectID, hash.Hash(deviceAccessKeyValue))
+	}
 	if err == store.ErrDeviceAccessKeyNotFound {
 		w.WriteHeader(http.StatusUnauthorized)
 		return
@@ -210,6 +500,17 @@ func (s *Service) withDeviceAuth(w http.ResponseWriter, r *http.Request, f func(
 		return
 	}
 
+	// The first use of a rotated key shows that the device saved it, so the
+	// key it replaced can be revoked
+	if deviceAccessKey.ReplacesID != nil {
+		if err := s.deviceAccessKeys.CompleteDeviceAccessKeyRotation(r.Context(),
+			deviceAccessKey.ID, projectID); err != nil {
+			log.WithError(err).Error("complete device access key rotation")
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+	}
+
 	device, err := s.devices.GetDevice(r.Context(), deviceAccessKey.DeviceID, projectID)
 	if err != nil {
 		log.WithError(err).Error("get device")
@@ -224,7 +525,7 @@ func (s *Service) withDeviceAuth(w http.ResponseWriter, r *http.Request, f func(
 		return
 	}
 
-	f(project, device)
+	f(project, device, deviceAccessKey)
 }
 
 func (s *Service) withRole(w http.ResponseWriter, r *http.Request, project *models.Project, f func(role *models.Role)) {
@@ -261,13 +562,14 @@ func (s *Service) withRole(w http.ResponseWriter, r *http.Request, project *mode
 
 func (s *Service) withUserOrServiceAccountAuth(w http.ResponseWriter, r *http.Request, f func(user *models.User, serviceAccount *models.ServiceAccount)) {
 	var userID string
+	var userAccessKeyConfig *string
 	var serviceAccountAccessKey *models.ServiceAccountAccessKey
 
 	sessionValue, err := r.Cookie(sessionCookie)
 
 	switch err {
 	case nil:
-		session, err := s.sessions.ValidateSession(r.Context(), hash.Hash(sessionValue.Value))
+		session, err := s.validateSession(r, sessionValue.Value)
 		if err == store.ErrSessionNotFound {
 			w.WriteHeader(http.StatusUnauthorized)
 			return
@@ -277,6 +579,8 @@ func (s *Service) withUserOrServiceAccountAuth(w http.ResponseWriter, r *http.Re
 			return
 		}
 
+		refreshSessionCookie(w, r, sessionValue.Value, session)
+
 		userID = session.UserID
 	case http.ErrNoCookie:
 		accessKeyValue, _, _ := r.BasicAuth()
@@ -286,7 +590,7 @@ func (s *Service) withUserOrServiceAccountAuth(w http.ResponseWriter, r *http.Re
 		}
 
 		if strings.HasPrefix(accessKeyValue, "u") {
-			userAccessKey, err := s.userAccessKeys.ValidateUserAccessKey(r.Context(), hash.Hash(accessKeyValue))
+			userAccessKey, err := s.userAccessKeys.ValidateUserAccessKey(r.Context(), hash.Hash(accessKeyValue), remoteIP(r))
 			if err == store.ErrUserAccessKeyNotFound {
 				w.WriteHeader(http.StatusUnauthorized)
 				return
@@ -297,8 +601,9 @@ func (s *Service) withUserOrServiceAccountAuth(w http.ResponseWriter, r *http.Re
 			}
 
 			userID = userAccessKey.UserID
+			userAccessKeyConfig = userAccessKey.Config
 		} else if strings.HasPrefix(accessKeyValue, "s") {
-			serviceAccountAccessKey, err = s.serviceAccountAccessKeys.ValidateServiceAccountAccessKey(r.Context(), hash.Hash(accessKeyValue))
+			serviceAccountAccessKey, err = s.serviceAccountAccessKeys.ValidateServiceAccountAccessKey(r.Context(), hash.Hash(accessKeyValue), remoteIP(r))
 			if err == store.ErrServiceAccountAccessKeyNotFound {
 				w.WriteHeader(http.StatusUnauthorized)
 				return
@@ -328,6 +633,7 @@ func (s *Service) withUserOrServiceAccountAuth(w http.ResponseWriter, r *http.Re
 			w.WriteHeader(http.StatusInternalServerError)
 			return
 		}
+		user.AccessKeyConfig = userAccessKeyConfig
 
 		f(user, nil)
 		return
@@ -340,6 +646,7 @@ func (s *Service) withUserOrServiceAccountAuth(w http.ResponseWriter, r *http.Re
 			w.WriteHeader(http.StatusInternalServerError)
 			return
 		}
+		serviceAccount.AccessKeyConfig = serviceAccountAccessKey.Config
 
 		f(nil, serviceAccount)
 		return
@@ -350,77 +657,48 @@ func (s *Service) withUserOrServiceAccountAuth(w http.ResponseWriter, r *http.Re
 }
 
 func (s *Service) withValidatedSsoJWT(w http.ResponseWriter, r *http.Request, f func(ssoJWT models.SsoJWT)) {
-	var ssoRequest models.Auth0SsoRequest
+	var ssoRequest models.SsoRequest
 	if err := read(r, &ssoRequest); err != nil {
 		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
 
-	if s.auth0Audience == "" || s.auth0Domain == nil {
+	if s.oidcProvider == nil {
 		http.Error(w, "SSO is not enabled", http.StatusNotImplemented)
 		return
 	}
-	_, claims, err := serviceutils.ParseAndValidateSignedJWT(s.auth0Domain, s.auth0Audience, ssoRequest.IdToken)
+	identity, err := s.oidcProvider.Validate(r.Context(), ssoRequest.IdToken)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
 
-	get := func(key string) (string, error) {
-		v, ok := claims[key]
-		if !ok {
-			return "", errors.New("expected JWT claim not found")
-		}
-		value, ok := v.(string)
-		if !ok {
-			return "", errors.New("expected JWT claim to be string")
-		}
-		return value, nil
-	}
-
-	email, err := get("email")
-	if err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
-		return
-	}
-
-	name, err := get("name")
-	if err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
-		return
-	}
-
-	// TODO: validate nonce
-	_, err = get("nonce")
-	if err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
-		return
-	}
-
-	sub, err := get("sub")
-	if err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
-		return
-	}
-
-	subParts := strings.Split(sub, "|")
-	if len(subParts) != 2 {
-		http.Error(w, "invalid number of subject parts", http.StatusBadRequest)
-		return
-	}
-	subProvider := subParts[0]
-	subID := subParts[1]
-
 	f(models.SsoJWT{
-		Email:    email,
-		Name:     name,
-		Provider: subProvider,
-		Subject:  subID,
-		Claims:   claims,
+		Email:    identity.Email,
+		Name:     identity.Name,
+		Groups:   identity.Groups,
+		Provider: identity.Provider,
+		Subject:  identity.Subject,
+		Claims:   identity.Claims,
 	})
 }
 
+// withUserAuth is for requests that act on the user's own account. Access key
+// configs can't grant those, so keys with a config are rejected.
 func (s *Service) withUserAuth(w http.ResponseWriter, r *http.Request, f func(user *models.User)) {
+	s.withOrganizationUserAuth(w, r, func(user *models.User) {
+		if user.AccessKeyConfig != nil {
+			http.Error(w, errScopedAccessKeyNotAllowed.Error(), http.StatusForbidden)
+			return
+		}
+
+		f(user)
+	})
+}
+
+// withOrganizationUserAuth is for requests that are authorized with
+// validateOrganizationAuthorization, which checks access key configs itself.
+func (s *Service) withOrganizationUserAuth(w http.ResponseWriter, r *http.Request, f func(user *models.User)) {
 	s.withUserOrServiceAccountAuth(w, r, func(user *models.User, serviceAccount *models.ServiceAccount) {
 		if user == nil {
 			w.WriteHeader(http.StatusBadRequest)
@@ -443,6 +721,12 @@ func (s *Service) withSuperUserAuth(w http.ResponseWriter, r *http.Request, user
 		return
 	}
 
+	// Access key configs only cover project and organization resources
+	if user.AccessKeyConfig != nil {
+		http.Error(w, errScopedAccessKeyNotAllowed.Error(), http.StatusForbidden)
+		return
+	}
+
 	f()
 }
 
@@ -512,6 +796,33 @@ func (s *Service) withConnection(w http.ResponseWriter, r *http.Request, project
 	f(connection)
 }
 
+func (s *Service) withDeviceGroup(w http.ResponseWriter, r *http.Request, project *models.Project, f func(deviceGroup *models.DeviceGroup)) {
+	if project == nil {
+		log.WithError(ErrDependencyNotSupplied).Error("getting device group")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	vars := mux.Vars(r)
+	deviceGroupIdentifier := vars["devicegroup"]
+	if deviceGroupIdentifier == "" {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	deviceGroup, err := s.getDeviceGroupByIdentifier(r.Context(), deviceGroupIdentifier, project.ID)
+	if err == store.ErrDeviceGroupNotFound {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	} else if err != nil {
+		log.WithError(err).Error("lookup device group")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	f(deviceGroup)
+}
+
 func (s *Service) withApplication(w http.ResponseWriter, r *http.Request, project *models.Project, f func(application *models.Application)) {
 	if project == nil {
 		log.WithError(ErrDependencyNotSupplied).Error("getting application")
@@ -639,3 +950,156 @@ func (s *Service) GorillaSuperUserAuth(handler http.Handler) http.Handler {
 		},
 	))
 }
+
+func (s *Service) withOrganization(w http.ResponseWriter, r *http.Request, f func(organization *models.Organization)) {
+	organizationIdentifier := mux.Vars(r)["organization"]
+	if organizationIdentifier == "" {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	var organization *models.Organization
+	var err error
+	if strings.Contains(organizationIdentifier, "_") {
+		organization, err = s.organizations.GetOrganization(r.Context(), organizationIdentifier)
+	} else {
+		organization, err = s.organizations.LookupOrganization(r.Context(), organizationIdentifier)
+	}
+	if err == store.ErrOrganizationNotFound {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	} else if err != nil {
+		log.WithError(err).Error("get/lookup organization")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	f(organization)
+}
+
+// validateOrganizationAuthorization is the organization equivalent of
+// validateAuthorization. Only users can be organization members, so there's
+// no service account variant.
+func (s *Service) validateOrganizationAuthorization(
+	requestedResource authz.Resource,
+	requestedAction authz.Action,
+	w http.ResponseWriter,
+	r *http.Request,
+	user *models.User,
+	f func(organization *models.Organization),
+) {
+	if user == nil {
+		log.WithError(ErrDependencyNotSupplied).Error("validating organization authorization")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	s.withOrganization(w, r, func(organization *models.Organization) {
+		var configs []authz.Config
+		if user.SuperAdmin {
+			configs = []authz.Config{
+				authz.AdminAllRole,
+			}
+		} else {
+			member, _, organizationConfigs, err := s.getOrganizationRoleConfigs(r.Context(), user.ID, organization.ID)
+			if err != nil {
+				log.WithError(err).Error("get organization role configs")
+				w.WriteHeader(http.StatusInternalServerError)
+				return
+			}
+			if !member {
+				http.Error(w, store.ErrOrganizationMembershipNotFound.Error(), http.StatusNotFound)
+				return
+			}
+			configs = organizationConfigs
+		}
+
+		if !authz.Evaluate(requestedResource, requestedAction, configs) {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+
+		if user.AccessKeyConfig != nil {
+			var accessKeyConfig authz.Config
+			if err := yaml.Unmarshal([]byte(*user.AccessKeyConfig), &accessKeyConfig); err != nil {
+				log.WithError(err).Error("unmarshal access key config")
+				w.WriteHeader(http.StatusInternalServerError)
+				return
+			}
+			if !authz.Evaluate(requestedResource, requestedAction, []authz.Config{accessKeyConfig}) {
+				w.WriteHeader(http.StatusForbidden)
+				return
+			}
+		}
+
+		f(organization)
+	})
+}
+
+func (s *Service) withOrganizationRole(w http.ResponseWriter, r *http.Request, organization *models.Organization, f func(role *models.OrganizationRole)) {
+	if organization == nil {
+		log.WithError(ErrDependencyNotSupplied).Error("getting organization role")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	roleIdentifier := mux.Vars(r)["role"]
+	if roleIdentifier == "" {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	var role *models.OrganizationRole
+	var err error
+	if strings.Contains(roleIdentifier, "_") {
+		role, err = s.organizationRoles.GetOrganizationRole(r.Context(), roleIdentifier, organization.ID)
+	} else {
+		role, err = s.organizationRoles.LookupOrganizationRole(r.Context(), roleIdentifier, organization.ID)
+	}
+	if err == store.ErrOrganizationRoleNotFound {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	} else if err != nil {
+		log.WithError(err).Error("get/lookup organization role")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	f(role)
+}
+
+// remoteIP returns the IP address of the client that made the request.
+func remoteIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+func (s *Service) withJob(w http.ResponseWriter, r *http.Request, project *models.Project, f func(job *models.Job)) {
+	if project == nil {
+		log.WithError(ErrDependencyNotSupplied).Error("getting job")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	vars := mux.Vars(r)
+	jobID := vars["job"]
+	if jobID == "" {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	job, err := s.jobs.GetJob(r.Context(), jobID, project.ID)
+	if err == store.ErrJobNotFound {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	} else if err != nil {
+		log.WithError(err).Error("get job")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	f(job)
+}
@@ -0,0 +1,315 @@
+package mysql
+
+import (
+	"encoding/json"
+	"strings"
+	"time"
+
+	"github.com/deviceplane/deviceplane/pkg/controller/query"
+	"github.com/deviceplane/deviceplane/pkg/models"
+	"github.com/deviceplane/deviceplane/pkg/utils"
+)
+
+// Devices are online if they've been seen within this long
+const deviceOnlineThreshold = 2 * time.Minute
+
+var (
+	// Device fields that are ordered by in SQL. Names are compared as bytes
+	// like they are in Go.
+	deviceOrderColumns = map[string]string{
+		"id":         "id",
+		"name":       "binary name",
+		"createdAt":  "created_at",
+		"lastSeenAt": "last_seen_at",
+	}
+
+	// String properties that are compared in SQL
+	deviceStringColumns = map[string]string{
+		"id":                  "binary id",
+		"name":                "binary name",
+		"desiredAgentVersion": "binary desired_agent_version",
+	}
+
+	// Properties from the device's info that are compared in SQL
+	deviceInfoPaths = map[string]string{
+		"info.agentVersion":         "$.agentVersion",
+		"info.ipAddress":            "$.ipAddress",
+		"info.osRelease.prettyName": "$.osRelease.prettyName",
+		"info.osRelease.name":       "$.osRelease.name",
+		"info.osRelease.versionId":  "$.osRelease.versionId",
+		"info.osRelease.version":    "$.osRelease.version",
+		"info.osRelease.id":         "$.osRelease.id",
+		"info.osRelease.idLike":     "$.osRelease.idLike",
+	}
+
+	deviceTimeColumns = map[string]string{
+		"createdAt":  "created_at",
+		"lastSeenAt": "last_seen_at",
+	}
+)
+
+// sqlExpr is a fragment of SQL along with the arguments for its
+// placeholders.
+type sqlExpr struct {
+	sql  string
+	args []interface{}
+}
+
+// deviceFiltersSQL translates the filters that can be evaluated in SQL into
+// a condition, and returns the rest.
+func deviceFiltersSQL(filters models.Query, now time.Time) ([]sqlExpr, models.Query) {
+	var exprs []sqlExpr
+	var unapplied models.Query
+
+	for _, filter := range filters {
+		expr, ok := deviceFilterSQL(filter, now)
+		if !ok {
+			unapplied = append(unapplied, filter)
+			continue
+		}
+		exprs = append(exprs, expr)
+	}
+
+	return exprs, unapplied
+}
+
+// deviceFilterSQL translates a filter into SQL if every one of its
+// conditions can be.
+func deviceFilterSQL(filter models.Filter, now time.Time) (sqlExpr, bool) {
+	// A device matches a filter if it matches any of its conditions, so an
+	// empty filter matches nothing
+	if len(filter) == 0 {
+		return sqlExpr{sql: "false"}, true
+	}
+
+	var parts []string
+	var args []interface{}
+	for _, condition := range filter {
+		expr, ok := deviceConditionSQL(condition, now)
+		if !ok {
+			return sqlExpr{}, false
+		}
+		parts = append(parts, expr.sql)
+		args = append(args, expr.args...)
+	}
+
+	return sqlExpr{
+		sql:  "(" + strings.Join(parts, " or ") + ")",
+		args: args,
+	}, true
+}
+
+func deviceConditionSQL(condition models.Condition, now time.Time) (sqlExpr, bool) {
+	switch condition.Type {
+	case models.LabelExistenceCondition:
+		var params models.LabelExistenceConditionParams
+		if err := utils.JSONConvert(condition.Params, &params); err != nil || params.Key == "" {
+			return sqlExpr{}, false
+		}
+
+		expr := "json_extract(nullif(labels, ''), ?) is not null"
+		switch params.Operator {
+		case models.OperatorExists:
+		case models.OperatorNotExists:
+			expr = "json_extract(nullif(labels, ''), ?) is null"
+		default:
+			return sqlExpr{}, false
+		}
+		return sqlExpr{sql: expr, args: []interface{}{labelPath(params.Key)}}, true
+
+	case models.LabelValueCondition:
+		var params models.LabelValueConditionParams
+		if err := utils.JSONConvert(condition.Params, &params); err != nil || params.Key == "" {
+			return sqlExpr{}, false
+		}
+
+		// Extracted values are compared as bytes
+		value := sqlExpr{
+			sql:  "json_unquote(json_extract(nullif(labels, ''), ?))",
+			args: []interface{}{labelPath(params.Key)},
+		}
+		return stringConditionSQL(value, true, params.Operator, params.Value, params.Values)
+
+	case models.DevicePropertyCondition:
+		var params models.DevicePropertyConditionParams
+		if err := utils.JSONConvert(condition.Params, &params); err != nil {
+			return sqlExpr{}, false
+		}
+
+		if column, ok := deviceStringColumns[params.Property]; ok {
+			return stringConditionSQL(sqlExpr{sql: column}, false, params.Operator, params.Value, params.Values)
+		}
+
+		if path, ok := deviceInfoPaths[params.Property]; ok {
+			// Devices without info have the zero value for every field
+			value := sqlExpr{
+				sql:  "coalesce(json_unquote(json_extract(nullif(info, ''), ?)), '')",
+				args: []interface{}{path},
+			}
+			return stringConditionSQL(value, false, params.Operator, params.Value, params.Values)
+		}
+
+		if column, ok := deviceTimeColumns[params.Property]; ok {
+			return timeConditionSQL(column, params.Operator, params.Value, now)
+		}
+
+		switch params.Property {
+		case "status":
+			return statusConditionSQL(params.Operator, params.Value, now)
+		case "quarantined":
+			return quarantinedConditionSQL(params.Operator, params.Value)
+		}
+	}
+
+	return sqlExpr{}, false
+}
+
+// stringConditionSQL compares a string value. If nullable is set, a null
+// value means that the device doesn't have it.
+func stringConditionSQL(value sqlExpr, nullable bool, operator models.Operator, target string, targets []string) (sqlExpr, bool) {
+	var expr sqlExpr
+	negated := false
+
+	switch operator {
+	case models.OperatorIs, models.OperatorIsNot:
+		expr = sqlExpr{
+			sql:  value.sql + " = ?",
+			args: append(append([]interface{}{}, value.args...), target),
+		}
+		negated = operator == models.OperatorIsNot
+
+	case models.OperatorIn, models.OperatorNotIn:
+		if len(targets) == 0 {
+			return sqlExpr{}, false
+		}
+		expr = sqlExpr{
+			sql:  value.sql + " in (" + strings.TrimSuffix(strings.Repeat("?, ", len(targets)), ", ") + ")",
+			args: append([]interface{}{}, value.args...),
+		}
+		for _, t := range targets {
+			expr.args = append(expr.args, t)
+		}
+		negated = operator == models.OperatorNotIn
+
+	case models.OperatorLike, models.OperatorNotLike:
+		expr = sqlExpr{
+			sql:  value.sql + " like ?",
+			args: append(append([]interface{}{}, value.args...), globToLike(target)),
+		}
+		negated = operator == models.OperatorNotLike
+
+	default:
+		// Regular expressions and comparisons of versions and numbers
+		// behave differently in MySQL
+		return sqlExpr{}, false
+	}
+
+	if !negated {
+		return expr, true
+	}
+	if !nullable {
+		return sqlExpr{sql: "not (" + expr.sql + ")", args: expr.args}, true
+	}
+	return sqlExpr{
+		sql:  "(" + value.sql + " is null or not (" + expr.sql + "))",
+		args: append(append([]interface{}{}, value.args...), expr.args...),
+	}, true
+}
+
+func timeConditionSQL(column string, operator models.Operator, target string, now time.Time) (sqlExpr, bool) {
+	t, ok := query.ParseTime(target, now)
+	if !ok {
+		return sqlExpr{}, false
+	}
+
+	var op string
+	switch operator {
+	case models.OperatorGreaterThan:
+		op = ">"
+	case models.OperatorGreaterThanOrEqual:
+		op = ">="
+	case models.OperatorLessThan:
+		op = "<"
+	case models.OperatorLessThanOrEqual:
+		op = "<="
+	default:
+		return sqlExpr{}, false
+	}
+
+	return sqlExpr{sql: column + " " + op + " ?", args: []interface{}{t}}, true
+}
+
+func statusConditionSQL(operator models.Operator, target string, now time.Time) (sqlExpr, bool) {
+	var online bool
+	switch models.DeviceStatus(target) {
+	case models.DeviceStatusOnline:
+		online = true
+	case models.DeviceStatusOffline:
+		online = false
+	default:
+		return sqlExpr{}, false
+	}
+
+	switch operator {
+	case models.OperatorIs:
+	case models.OperatorIsNot:
+		online = !online
+	default:
+		return sqlExpr{}, false
+	}
+
+	threshold := now.Add(-deviceOnlineThreshold)
+	if online {
+		return sqlExpr{sql: "last_seen_at >= ?", args: []interface{}{threshold}}, true
+	}
+	return sqlExpr{sql: "last_seen_at < ?", args: []interface{}{threshold}}, true
+}
+
+func quarantinedConditionSQL(operator models.Operator, target string) (sqlExpr, bool) {
+	var quarantined bool
+	switch target {
+	case "true":
+		quarantined = true
+	case "false":
+		quarantined = false
+	default:
+		return sqlExpr{}, false
+	}
+
+	switch operator {
+	case models.OperatorIs:
+	case models.OperatorIsNot:
+		quarantined = !quarantined
+	default:
+		return sqlExpr{}, false
+	}
+
+	return sqlExpr{sql: "quarantined = ?", args: []interface{}{quarantined}}, true
+}
+
+// labelPath returns the JSON path of a label. Keys are quoted since they
+// can contain any character.
+func labelPath(key string) string {
+	quoted, _ := json.Marshal(key)
+	return "$." + string(quoted)
+}
+
+// globToLike converts a glob, where * matches any characters and ? matches
+// one, into a pattern for like.
+func globToLike(glob string) string {
+	var b strings.Builder
+	for _, r := range glob {
+		switch r {
+		case '*':
+			b.WriteRune('%')
+		case '?':
+			b.WriteRune('_')
+		case '%', '_', '\\':
+			b.WriteRune('\\')
+			b.WriteRune(r)
+		default:
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
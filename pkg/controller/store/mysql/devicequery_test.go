@@ -0,0 +1,81 @@
+package mysql
+
+import (
+	"testing"
+	"time"
+
+	"github.com/deviceplane/deviceplane/pkg/controller/query"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDeviceFiltersSQL(t *testing.T) {
+	now := time.Date(2020, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	for _, tc := range []struct {
+		expression string
+		sql        []string
+		args       []interface{}
+		unapplied  int
+	}{
+		{
+			expression: `labels.site = hq and labels.env != "dev"`,
+			sql: []string{
+				"(json_unquote(json_extract(nullif(labels, ''), ?)) = ?)",
+				"((json_unquote(json_extract(nullif(labels, ''), ?)) is null or not (json_unquote(json_extract(nullif(labels, ''), ?)) = ?)))",
+			},
+			args: []interface{}{`$."site"`, "hq", `$."env"`, `$."env"`, "dev"},
+		},
+		{
+			expression: `labels.role in (a, b) or name like "edge_*"`,
+			sql: []string{
+				"(json_unquote(json_extract(nullif(labels, ''), ?)) in (?, ?) or binary name like ?)",
+			},
+			args: []interface{}{`$."role"`, "a", "b", `edge\_%`},
+		},
+		{
+			expression: `status = online and lastSeenAt > now-1h and labels.x exists`,
+			sql: []string{
+				"(last_seen_at >= ?)",
+				"(last_seen_at > ?)",
+				"(json_extract(nullif(labels, ''), ?) is not null)",
+			},
+			args: []interface{}{now.Add(-2 * time.Minute), now.Add(-time.Hour), `$."x"`},
+		},
+		{
+			expression: `agentVersion in (1.0.0, 1.1.0) and quarantined != true`,
+			sql: []string{
+				"(coalesce(json_unquote(json_extract(nullif(info, ''), ?)), '') in (?, ?))",
+				"(quarantined = ?)",
+			},
+			args: []interface{}{"$.agentVersion", "1.0.0", "1.1.0", false},
+		},
+		{
+			// Regular expressions and version comparisons are left to Go
+			expression: `labels.site =~ "hq.*" and agentVersion >= 1.10 and name = x`,
+			sql: []string{
+				"(binary name = ?)",
+			},
+			args:      []interface{}{"x"},
+			unapplied: 2,
+		},
+	} {
+		filters, err := query.Parse(tc.expression)
+		require.NoError(t, err, tc.expression)
+
+		exprs, unapplied := deviceFiltersSQL(filters, now)
+		require.Len(t, unapplied, tc.unapplied, tc.expression)
+
+		var sql []string
+		var args []interface{}
+		for _, expr := range exprs {
+			sql = append(sql, expr.sql)
+			args = append(args, expr.args...)
+		}
+		require.Equal(t, tc.sql, sql, tc.expression)
+		require.Equal(t, tc.args, args, tc.expression)
+	}
+}
+
+func TestLabelPath(t *testing.T) {
+	require.Equal(t, `$."a.b \"c\""`, labelPath(`a.b "c"`))
+}
@@ -130,15 +130,49 @@ create table if not exists sessions (
 
   -- SENSITIVE FIELD
   hash varchar(255) not null,
+  expires_at timestamp null,
+  last_used_at timestamp null,
+  last_used_ip varchar(45),
+  user_agent varchar(255),
 
   primary key (id),
   unique hash_unique (hash),
   foreign key sessions_user_id(user_id)
   references users(id)
   on delete cascade,
+  index user_id (user_id),
   index hash (hash)
 );
 
+-- Columns and indexes added to sessions after it was created, for
+-- existing databases
+set @exists = (select count(*) from information_schema.columns where table_schema = database() and table_name = 'sessions' and column_name = 'expires_at');
+set @query = if(@exists = 0, 'alter table sessions add column expires_at timestamp null', 'select 1');
+prepare stmt from @query; execute stmt; deallocate prepare stmt;
+
+set @exists = (select count(*) from information_schema.columns where table_schema = database() and table_name = 'sessions' and column_name = 'last_used_at');
+set @query = if(@exists = 0, 'alter table sessions add column last_used_at timestamp null', 'select 1');
+prepare stmt from @query; execute stmt; deallocate prepare stmt;
+
+set @exists = (select count(*) from information_schema.columns where table_schema = database() and table_name = 'sessions' and column_name = 'last_used_ip');
+set @query = if(@exists = 0, 'alter table sessions add column last_used_ip varchar(45)', 'select 1');
+prepare stmt from @query; execute stmt; deallocate prepare stmt;
+
+set @exists = (select count(*) from information_schema.columns where table_schema = database() and table_name = 'sessions' and column_name = 'user_agent');
+set @query = if(@exists = 0, 'alter table sessions add column user_agent varchar(255)', 'select 1');
+prepare stmt from @query; execute stmt; deallocate prepare stmt;
+
+set @exists = (select count(*) from information_schema.statistics where table_schema = database() and table_name = 'sessions' and index_name = 'user_id');
+set @query = if(@exists = 0, 'alter table sessions add index user_id (user_id)', 'select 1');
+prepare stmt from @query; execute stmt; deallocate prepare stmt;
+
+-- Sessions from before expiry was tracked are given the default
+-- --session-ttl of 30 days, once. Like any other session, they're extended
+-- by the configured TTL when they're next used.
+update sessions
+set expires_at = created_at + interval 720 hour
+where expires_at is null;
+
 --
 -- UserAccessKeys
 --
@@ -151,6 +185,10 @@ create table if not exists user_access_keys (
   -- SENSITIVE FIELD
   hash varchar(255) not null,
   description longtext not null,
+  expires_at timestamp null,
+  config longtext,
+  last_used_at timestamp null,
+  last_used_ip varchar(45),
 
   primary key (id),
   unique hash_unique (hash),
@@ -161,6 +199,157 @@ create table if not exists user_access_keys (
   index hash (hash)
 );
 
+-- Columns and indexes added to user_access_keys after it was created, for
+-- existing databases
+set @exists = (select count(*) from information_schema.columns where table_schema = database() and table_name = 'user_access_keys' and column_name = 'expires_at');
+set @query = if(@exists = 0, 'alter table user_access_keys add column expires_at timestamp null', 'select 1');
+prepare stmt from @query; execute stmt; deallocate prepare stmt;
+
+set @exists = (select count(*) from information_schema.columns where table_schema = database() and table_name = 'user_access_keys' and column_name = 'config');
+set @query = if(@exists = 0, 'alter table user_access_keys add column config longtext', 'select 1');
+prepare stmt from @query; execute stmt; deallocate prepare stmt;
+
+set @exists = (select count(*) from information_schema.columns where table_schema = database() and table_name = 'user_access_keys' and column_name = 'last_used_at');
+set @query = if(@exists = 0, 'alter table user_access_keys add column last_used_at timestamp null', 'select 1');
+prepare stmt from @query; execute stmt; deallocate prepare stmt;
+
+set @exists = (select count(*) from information_schema.columns where table_schema = database() and table_name = 'user_access_keys' and column_name = 'last_used_ip');
+set @query = if(@exists = 0, 'alter table user_access_keys add column last_used_ip varchar(45)', 'select 1');
+prepare stmt from @query; execute stmt; deallocate prepare stmt;
+
+--
+-- UserTOTPs
+--
+
+create table if not exists user_totps (
+  user_id varchar(32) not null,
+  created_at timestamp not null default current_timestamp,
+
+  -- SENSITIVE FIELD
+  secret varchar(255) not null,
+  enabled boolean not null default false,
+  last_used_counter bigint not null default 0,
+  failed_attempts int not null default 0,
+  locked_until timestamp null,
+
+  primary key (user_id),
+  foreign key user_totps_user_id(user_id)
+  references users(id)
+  on delete cascade
+);
+
+-- Columns and indexes added to user_totps after it was created, for
+-- existing databases
+set @exists = (select count(*) from information_schema.columns where table_schema = database() and table_name = 'user_totps' and column_name = 'last_used_counter');
+set @query = if(@exists = 0, 'alter table user_totps add column last_used_counter bigint not null default 0', 'select 1');
+prepare stmt from @query; execute stmt; deallocate prepare stmt;
+
+set @exists = (select count(*) from information_schema.columns where table_schema = database() and table_name = 'user_totps' and column_name = 'failed_attempts');
+set @query = if(@exists = 0, 'alter table user_totps add column failed_attempts int not null default 0', 'select 1');
+prepare stmt from @query; execute stmt; deallocate prepare stmt;
+
+set @exists = (select count(*) from information_schema.columns where table_schema = database() and table_name = 'user_totps' and column_name = 'locked_until');
+set @query = if(@exists = 0, 'alter table user_totps add column locked_until timestamp null', 'select 1');
+prepare stmt from @query; execute stmt; deallocate prepare stmt;
+
+--
+-- UserRecoveryCodes
+--
+
+create table if not exists user_recovery_codes (
+  user_id varchar(32) not null,
+  created_at timestamp not null default current_timestamp,
+
+  -- SENSITIVE FIELD
+  hash varchar(255) not null,
+
+  primary key (user_id, hash),
+  foreign key user_recovery_codes_user_id(user_id)
+  references users(id)
+  on delete cascade
+);
+
+--
+-- Organizations
+--
+
+create table if not exists organizations (
+  id varchar(32) not null,
+  created_at timestamp not null default current_timestamp,
+
+  name varchar(100) not null,
+  billing_email varchar(255) not null,
+
+  primary key (id),
+  unique name_unique (name),
+  index name (name)
+);
+
+--
+-- OrganizationMemberships
+--
+
+create table if not exists organization_memberships (
+  user_id varchar(32) not null,
+  organization_id varchar(32) not null,
+  created_at timestamp not null default current_timestamp,
+
+  primary key (user_id, organization_id),
+  foreign key organization_memberships_user_id(user_id)
+  references users(id)
+  on delete cascade,
+  foreign key organization_memberships_organization_id(organization_id)
+  references organizations(id)
+  on delete cascade,
+  index user_id (user_id),
+  index organization_id (organization_id)
+);
+
+--
+-- OrganizationRoles
+--
+
+create table if not exists organization_roles (
+  id varchar(32) not null,
+  created_at timestamp not null default current_timestamp,
+  organization_id varchar(32) not null,
+
+  name varchar(100) not null,
+  description longtext not null,
+  config longtext not null,
+
+  primary key (id),
+  unique name_organization_id_unique (name, organization_id),
+  foreign key organization_roles_organization_id(organization_id)
+  references organizations(id)
+  on delete cascade,
+  index organization_id_id (organization_id, id),
+  index organization_id_name (organization_id, name)
+);
+
+--
+-- OrganizationMembershipRoleBindings
+--
+
+create table if not exists organization_membership_role_bindings (
+  user_id varchar(32) not null,
+  role_id varchar(32) not null,
+  created_at timestamp not null default current_timestamp,
+  organization_id varchar(32) not null,
+
+  primary key (user_id, organization_id, role_id),
+  foreign key organization_membership_role_bindings_user_id_organization_id(user_id, organization_id)
+  references organization_memberships(user_id, organization_id)
+  on delete cascade,
+  foreign key organization_membership_role_bindings_role_id(role_id)
+  references organization_roles(id)
+  on delete cascade,
+  foreign key organization_membership_role_bindings_organization_id(organization_id)
+  references organizations(id)
+  on delete cascade,
+  index organization_id_user_id_role_id (organization_id, user_id, role_id)
+);
+
 --
 -- Projects
 --
@@ -168,15 +357,33 @@ create table if not exists user_access_keys (
 create table if not exists projects (
   id varchar(32) not null,
   created_at timestamp not null default current_timestamp,
+  organization_id varchar(32),
 
   name varchar(100) not null,
   datadog_api_key varchar(100),
 
   primary key (id),
   unique name_unique (name),
-  index name (name)
+  foreign key projects_organization_id(organization_id)
+  references organizations(id),
+  index name (name),
+  index organization_id (organization_id)
 );
 
+-- Columns and indexes added to projects after it was created, for
+-- existing databases
+set @exists = (select count(*) from information_schema.columns where table_schema = database() and table_name = 'projects' and column_name = 'organization_id');
+set @query = if(@exists = 0, 'alter table projects add column organization_id varchar(32)', 'select 1');
+prepare stmt from @query; execute stmt; deallocate prepare stmt;
+
+set @exists = (select count(*) from information_schema.statistics where table_schema = database() and table_name = 'projects' and index_name = 'organization_id');
+set @query = if(@exists = 0, 'alter table projects add index organization_id (organization_id)', 'select 1');
+prepare stmt from @query; execute stmt; deallocate prepare stmt;
+
+set @exists = (select count(*) from information_schema.table_constraints where table_schema = database() and table_name = 'projects' and constraint_name = 'projects_organization_id');
+set @query = if(@exists = 0, 'alter table projects add foreign key projects_organization_id(organization_id) references organizations(id)', 'select 1');
+prepare stmt from @query; execute stmt; deallocate prepare stmt;
+
 --
 -- Roles
 --
@@ -242,6 +449,63 @@ create table if not exists membership_role_bindings (
   index project_id_user_id_role_id (project_id, user_id, role_id)
 );
 
+--
+-- SsoGroupMappings
+--
+
+create table if not exists sso_group_mappings (
+  id varchar(32) not null,
+  created_at timestamp not null default current_timestamp,
+  project_id varchar(32) not null,
+  group_name varchar(255) not null,
+  role_id varchar(32) not null,
+
+  primary key (id),
+  unique project_id_group_name_role_id_unique (project_id, group_name, role_id),
+  foreign key sso_group_mappings_project_id(project_id)
+  references projects(id)
+  on delete cascade,
+  foreign key sso_group_mappings_role_id(role_id)
+  references roles(id)
+  on delete cascade,
+  index project_id_id (project_id, id),
+  index group_name (group_name)
+);
+
+--
+-- SsoManagedRoleBindings
+--
+
+create table if not exists sso_managed_role_bindings (
+  user_id varchar(32) not null,
+  role_id varchar(32) not null,
+  created_at timestamp not null default current_timestamp,
+  project_id varchar(32) not null,
+
+  primary key (user_id, project_id, role_id),
+  foreign key sso_managed_role_bindings_membership_role_binding(user_id, project_id, role_id)
+  references membership_role_bindings(user_id, project_id, role_id)
+  on delete cascade,
+  index user_id (user_id)
+);
+
+--
+-- UserSsoGroups
+--
+
+create table if not exists user_sso_groups (
+  user_id varchar(32) not null,
+  group_name varchar(255) not null,
+  synced_at timestamp not null default current_timestamp,
+
+  primary key (user_id, group_name),
+  foreign key user_sso_groups_user_id(user_id)
+  references users(id)
+  on delete cascade,
+  index group_name (group_name),
+  index synced_at (synced_at)
+);
+
 --
 -- ServiceAccounts
 --
@@ -276,6 +540,10 @@ create table if not exists service_account_access_keys (
   -- SENSITIVE FIELD
   hash varchar(255) not null,
   description longtext not null,
+  expires_at timestamp null,
+  config longtext,
+  last_used_at timestamp null,
+  last_used_ip varchar(45),
 
   primary key (id),
   unique hash_unique (hash),
@@ -290,6 +558,24 @@ create table if not exists service_account_access_keys (
   index hash (hash)
 );
 
+-- Columns and indexes added to service_account_access_keys after it was created, for
+-- existing databases
+set @exists = (select count(*) from information_schema.columns where table_schema = database() and table_name = 'service_account_access_keys' and column_name = 'expires_at');
+set @query = if(@exists = 0, 'alter table service_account_access_keys add column expires_at timestamp null', 'select 1');
+prepare stmt from @query; execute stmt; deallocate prepare stmt;
+
+set @exists = (select count(*) from information_schema.columns where table_schema = database() and table_name = 'service_account_access_keys' and column_name = 'config');
+set @query = if(@exists = 0, 'alter table service_account_access_keys add column config longtext', 'select 1');
+prepare stmt from @query; execute stmt; deallocate prepare stmt;
+
+set @exists = (select count(*) from information_schema.columns where table_schema = database() and table_name = 'service_account_access_keys' and column_name = 'last_used_at');
+set @query = if(@exists = 0, 'alter table service_account_access_keys add column last_used_at timestamp null', 'select 1');
+prepare stmt from @query; execute stmt; deallocate prepare stmt;
+
+set @exists = (select count(*) from information_schema.columns where table_schema = database() and table_name = 'service_account_access_keys' and column_name = 'last_used_ip');
+set @query = if(@exists = 0, 'alter table service_account_access_keys add column last_used_ip varchar(45)', 'select 1');
+prepare stmt from @query; execute stmt; deallocate prepare stmt;
+
 --
 -- ServiceAccountRoleBindings
 --
@@ -350,6 +636,7 @@ create table if not exists devices (
   last_seen_at timestamp not null default current_timestamp,
   labels longtext not null,
   environment_variables longtext not null,
+  quarantined boolean not null default false,
 
   primary key (id),
   unique name_project_id_unique (name, project_id),
@@ -365,6 +652,12 @@ create table if not exists devices (
   fulltext(name, labels)
 );
 
+-- Columns and indexes added to devices after it was created, for
+-- existing databases
+set @exists = (select count(*) from information_schema.columns where table_schema = database() and table_name = 'devices' and column_name = 'quarantined');
+set @query = if(@exists = 0, 'alter table devices add column quarantined boolean not null default false', 'select 1');
+prepare stmt from @query; execute stmt; deallocate prepare stmt;
+
 --
 -- DeviceAccessKeys
 --
@@ -374,6 +667,9 @@ create table if not exists device_access_keys (
   created_at timestamp not null default current_timestamp,
   project_id varchar(32) not null,
   device_id varchar(32) not null,
+  type varchar(20) not null default 'key',
+  replaces_id varchar(32),
+  revoked_at timestamp null,
 
   -- SENSITIVE FIELD
   hash varchar(255) not null,
@@ -384,7 +680,44 @@ create table if not exists device_access_keys (
   references devices(id)
   on delete cascade,
   index project_id_id (project_id, id),
-  index project_id_hash (project_id, hash)
+  index project_id_hash (project_id, hash),
+  index project_id_device_id (project_id, device_id)
+);
+
+-- Columns and indexes added to device_access_keys after it was created, for
+-- existing databases
+set @exists = (select count(*) from information_schema.columns where table_schema = database() and table_name = 'device_access_keys' and column_name = 'type');
+set @query = if(@exists = 0, 'alter table device_access_keys add column type varchar(20) not null default ''key''', 'select 1');
+prepare stmt from @query; execute stmt; deallocate prepare stmt;
+
+set @exists = (select count(*) from information_schema.columns where table_schema = database() and table_name = 'device_access_keys' and column_name = 'replaces_id');
+set @query = if(@exists = 0, 'alter table device_access_keys add column replaces_id varchar(32)', 'select 1');
+prepare stmt from @query; execute stmt; deallocate prepare stmt;
+
+set @exists = (select count(*) from information_schema.columns where table_schema = database() and table_name = 'device_access_keys' and column_name = 'revoked_at');
+set @query = if(@exists = 0, 'alter table device_access_keys add column revoked_at timestamp null', 'select 1');
+prepare stmt from @query; execute stmt; deallocate prepare stmt;
+
+set @exists = (select count(*) from information_schema.statistics where table_schema = database() and table_name = 'device_access_keys' and index_name = 'project_id_device_id');
+set @query = if(@exists = 0, 'alter table device_access_keys add index project_id_device_id (project_id, device_id)', 'select 1');
+prepare stmt from @query; execute stmt; deallocate prepare stmt;
+
+--
+-- DeviceCertificateAuthorities
+--
+
+create table if not exists device_certificate_authorities (
+  project_id varchar(32) not null,
+  created_at timestamp not null default current_timestamp,
+  certificate longtext not null,
+
+  -- SENSITIVE FIELD
+  private_key longtext not null,
+
+  primary key (project_id),
+  foreign key device_certificate_authorities_project_id(project_id)
+  references projects(id)
+  on delete cascade
 );
 
 --
@@ -409,6 +742,28 @@ create table if not exists connections (
   index project_id_name (project_id, name)
 );
 
+--
+-- DeviceGroups
+--
+
+create table if not exists device_groups (
+  id varchar(32) not null,
+  created_at timestamp not null default current_timestamp,
+  project_id varchar(32) not null,
+
+  name varchar(100) not null,
+  description longtext not null,
+  query longtext not null,
+
+  primary key (id),
+  unique name_project_id_unique (name, project_id),
+  foreign key device_groups_project_id(project_id)
+  references projects(id)
+  on delete cascade,
+  index project_id_id (project_id, id),
+  index project_id_name (project_id, name)
+);
+
 --
 -- Applications
 --
@@ -557,6 +912,95 @@ create table if not exists project_configs (
   on delete cascade
 );
 
+--
+-- Metric Series
+--
+
+create table if not exists metric_series (
+  id varchar(64) not null,
+  created_at timestamp not null default current_timestamp,
+  project_id varchar(32) not null,
+  metric varchar(200) not null,
+  tags longtext not null,
+
+  primary key (id),
+  foreign key metric_series_project_id(project_id)
+  references projects(id)
+  on delete cascade,
+  index project_id_metric (project_id, metric)
+);
+
+--
+-- Metric Points
+--
+
+create table if not exists metric_points (
+  series_id varchar(64) not null,
+  resolution int not null,
+  ts bigint not null,
+  value_count bigint not null,
+  value_sum double not null,
+  value_min double not null,
+  value_max double not null,
+
+  primary key (series_id, resolution, ts),
+  foreign key metric_points_series_id(series_id)
+  references metric_series(id)
+  on delete cascade,
+  index resolution_ts (resolution, ts)
+);
+
+--
+-- Jobs
+--
+
+create table if not exists jobs (
+  id varchar(32) not null,
+  created_at timestamp not null default current_timestamp,
+  project_id varchar(32) not null,
+
+  type varchar(100) not null,
+  params longtext not null,
+  status varchar(32) not null,
+  cancel_requested boolean not null default false,
+  error longtext not null,
+  item_count int not null,
+  claim_id varchar(32) not null default '',
+  lease_expires_at timestamp null,
+  started_at timestamp null,
+  finished_at timestamp null,
+
+  primary key (id),
+  foreign key jobs_project_id(project_id)
+  references projects(id)
+  on delete cascade,
+  index project_id_id (project_id, id),
+  index status_lease_expires_at (status, lease_expires_at),
+  index claim_id (claim_id),
+  index finished_at (finished_at)
+);
+
+--
+-- Job Items
+--
+
+create table if not exists job_items (
+  job_id varchar(32) not null,
+  item_id varchar(100) not null,
+  position int not null,
+  name varchar(100) not null,
+  status varchar(32) not null,
+  error longtext not null,
+  updated_at timestamp not null default current_timestamp on update current_timestamp,
+
+  primary key (job_id, item_id),
+  foreign key job_items_job_id(job_id)
+  references jobs(id)
+  on delete cascade,
+  index job_id_position (job_id, position),
+  index job_id_status_position (job_id, status, position)
+);
+
 --
 -- Commit
 --
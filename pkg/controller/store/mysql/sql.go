@@ -57,6 +57,13 @@ const getExternalUserByProvider = `
   where provider_name = ? and provider_id = ?
 `
 
+// Index: primary key
+const updateExternalUser = `
+  update external_users
+  set email = ?, info = ?
+  where id = ?
+`
+
 const createInternalUser = `
   insert into internal_users (
     id,
@@ -144,21 +151,38 @@ const createSession = `
   insert into sessions (
     id,
     user_id,
-    hash
+    hash,
+    expires_at,
+    last_used_at,
+    last_used_ip,
+    user_agent
   )
-  values (?, ?, ?)
+  values (?, ?, ?, ?, current_timestamp, ?, ?)
 `
 
 // Index: primary key
 const getSession = `
-  select id, created_at, user_id from sessions
+  select id, created_at, user_id, expires_at, last_used_at, last_used_ip, user_agent from sessions
   where id = ?
 `
 
 // Index: hash
 const validateSession = `
-  select id, created_at, user_id from sessions
-  where hash = ?
+  select id, created_at, user_id, expires_at, last_used_at, last_used_ip, user_agent from sessions
+  where hash = ? and expires_at > current_timestamp
+`
+
+// Index: primary key
+const updateSessionLastUsed = `
+  update sessions
+  set expires_at = ?, last_used_at = current_timestamp, last_used_ip = ?, user_agent = ?
+  where id = ?
+`
+
+// Index: user_id
+const listSessions = `
+  select id, created_at, user_id, expires_at, last_used_at, last_used_ip, user_agent from sessions
+  where user_id = ? and expires_at > current_timestamp
 `
 
 // Index: primary key
@@ -168,31 +192,46 @@ const deleteSession = `
   limit 1
 `
 
+// Index: user_id
+const deleteUserSessions = `
+  delete from sessions
+  where user_id = ?
+`
+
 const createUserAccessKey = `
   insert into user_access_keys (
     id,
     user_id,
     hash,
-    description
+    description,
+    expires_at,
+    config
   )
-  values (?, ?, ?, ?)
+  values (?, ?, ?, ?, ?, ?)
 `
 
 // Index: primary key
 const getUserAccessKey = `
-  select id, created_at, user_id, description from user_access_keys
+  select id, created_at, user_id, description, expires_at, config, last_used_at, last_used_ip from user_access_keys
   where id = ?
 `
 
 // Index: hash
 const validateUserAccessKey = `
-  select id, created_at, user_id, description from user_access_keys
-  where hash = ?
+  select id, created_at, user_id, description, expires_at, config, last_used_at, last_used_ip from user_access_keys
+  where hash = ? and (expires_at is null or expires_at > current_timestamp)
+`
+
+// Index: primary key
+const updateUserAccessKeyLastUsed = `
+  update user_access_keys
+  set last_used_at = current_timestamp, last_used_ip = ?
+  where id = ?
 `
 
 // Index: user_id
 const listUserAccessKeys = `
-  select id, created_at, user_id, description from user_access_keys
+  select id, created_at, user_id, description, expires_at, config, last_used_at, last_used_ip from user_access_keys
   where user_id = ?
 `
 
@@ -203,28 +242,253 @@ const deleteUserAccessKey = `
   limit 1
 `
 
+// Index: primary key
+const setUserTOTPSecret = `
+  replace into user_totps (
+    user_id,
+    secret,
+    enabled
+  )
+  values (?, ?, false)
+`
+
+// Index: primary key
+const getUserTOTP = `
+  select user_id, created_at, secret, enabled, coalesce(locked_until > current_timestamp, false) from user_totps
+  where user_id = ?
+`
+
+// Index: primary key
+const enableUserTOTP = `
+  update user_totps
+  set enabled = true
+  where user_id = ?
+`
+
+// Index: primary key
+//
+// Codes are only accepted once, so only steps after the last one used are
+// accepted
+const useUserTOTPCounter = `
+  update user_totps
+  set last_used_counter = ?, failed_attempts = 0
+  where user_id = ? and last_used_counter < ?
+`
+
+// Index: primary key
+//
+// Assignments are applied in order, so locked_until sees the previous count
+const recordUserTOTPFailure = `
+  update user_totps
+  set
+    locked_until = if(failed_attempts + 1 >= ?, date_add(current_timestamp, interval ? second), locked_until),
+    failed_attempts = if(failed_attempts + 1 >= ?, 0, failed_attempts + 1)
+  where user_id = ?
+`
+
+// Index: primary key
+const resetUserTOTPFailures = `
+  update user_totps
+  set failed_attempts = 0
+  where user_id = ?
+`
+
+// Index: primary key
+const deleteUserTOTP = `
+  delete from user_totps
+  where user_id = ?
+  limit 1
+`
+
+const createUserRecoveryCode = `
+  insert into user_recovery_codes (
+    user_id,
+    hash
+  )
+  values (?, ?)
+`
+
+// Index: primary key
+const deleteUserRecoveryCode = `
+  delete from user_recovery_codes
+  where user_id = ? and hash = ?
+  limit 1
+`
+
+// Index: primary key
+const deleteUserRecoveryCodes = `
+  delete from user_recovery_codes
+  where user_id = ?
+`
+
+const createOrganization = `
+  insert into organizations (
+    id,
+    name,
+    billing_email
+  )
+  values (?, ?, ?)
+`
+
+// Index: primary key
+const getOrganization = `
+  select id, created_at, name, billing_email from organizations
+  where id = ?
+`
+
+// Index: name
+const lookupOrganization = `
+  select id, created_at, name, billing_email from organizations
+  where name = ?
+`
+
+// Index: primary key
+const updateOrganization = `
+  update organizations
+  set name = ?, billing_email = ?
+  where id = ?
+`
+
+// Index: primary key
+const deleteOrganization = `
+  delete from organizations
+  where id = ?
+  limit 1
+`
+
+const createOrganizationMembership = `
+  insert into organization_memberships (
+    user_id,
+    organization_id
+  )
+  values (?, ?)
+`
+
+// Index: primary key
+const getOrganizationMembership = `
+  select user_id, organization_id, created_at from organization_memberships
+  where user_id = ? and organization_id = ?
+`
+
+// Index: user_id
+const listOrganizationMembershipsByUser = `
+  select user_id, organization_id, created_at from organization_memberships
+  where user_id = ?
+`
+
+// Index: organization_id
+const listOrganizationMembershipsByOrganization = `
+  select user_id, organization_id, created_at from organization_memberships
+  where organization_id = ?
+`
+
+// Index: primary key
+const deleteOrganizationMembership = `
+  delete from organization_memberships
+  where user_id = ? and organization_id = ?
+  limit 1
+`
+
+const createOrganizationRole = `
+  insert into organization_roles (
+    id,
+    organization_id,
+    name,
+    description,
+    config
+  )
+  values (?, ?, ?, ?, ?)
+`
+
+// Index: organization_id_id
+const getOrganizationRole = `
+  select id, created_at, organization_id, name, description, config from organization_roles
+  where id = ? and organization_id = ?
+`
+
+// Index: organization_id_name
+const lookupOrganizationRole = `
+  select id, created_at, organization_id, name, description, config from organization_roles
+  where name = ? and organization_id = ?
+`
+
+// Index: organization_id_id
+const listOrganizationRoles = `
+  select id, created_at, organization_id, name, description, config from organization_roles
+  where organization_id = ?
+`
+
+// Index: organization_id_id
+const updateOrganizationRole = `
+  update organization_roles
+  set name = ?, description = ?, config = ?
+  where id = ? and organization_id = ?
+`
+
+// Index: organization_id_id
+const deleteOrganizationRole = `
+  delete from organization_roles
+  where id = ? and organization_id = ?
+  limit 1
+`
+
+const createOrganizationMembershipRoleBinding = `
+  insert into organization_membership_role_bindings (
+    user_id,
+    role_id,
+    organization_id
+  )
+  values (?, ?, ?)
+`
+
+// Index: organization_id_user_id_role_id
+const getOrganizationMembershipRoleBinding = `
+  select user_id, role_id, created_at, organization_id from organization_membership_role_bindings
+  where user_id = ? and role_id = ? and organization_id = ?
+`
+
+// Index: organization_id_user_id_role_id
+const listOrganizationMembershipRoleBindings = `
+  select user_id, role_id, created_at, organization_id from organization_membership_role_bindings
+  where user_id = ? and organization_id = ?
+`
+
+// Index: organization_id_user_id_role_id
+const deleteOrganizationMembershipRoleBinding = `
+  delete from organization_membership_role_bindings
+  where user_id = ? and role_id = ? and organization_id = ?
+  limit 1
+`
+
 const createProject = `
   insert into projects (
     id,
+    organization_id,
     name
   )
-  values (?, ?)
+  values (?, ?, ?)
 `
 
 // Index: primary key
 const getProject = `
-  select id, created_at, name, datadog_api_key from projects
+  select id, created_at, organization_id, name, datadog_api_key from projects
   where id = ?
 `
 
 // Index: name
 const lookupProject = `
-  select id, created_at, name, datadog_api_key from projects
+  select id, created_at, organization_id, name, datadog_api_key from projects
   where name = ?
 `
 
 const listProjects = `
-  select id, created_at, name, datadog_api_key from projects
+  select id, created_at, organization_id, name, datadog_api_key from projects
+`
+
+// Index: organization_id
+const listProjectsByOrganization = `
+  select id, created_at, organization_id, name, datadog_api_key from projects
+  where organization_id = ?
 `
 
 // Index: primary key
@@ -357,6 +621,89 @@ const deleteMembershipRoleBinding = `
   limit 1
 `
 
+const createSsoGroupMapping = `
+  insert into sso_group_mappings (
+    id,
+    project_id,
+    group_name,
+    role_id
+  )
+  values (?, ?, ?, ?)
+`
+
+// Index: project_id_id
+const getSsoGroupMapping = `
+  select id, created_at, project_id, group_name, role_id from sso_group_mappings
+  where id = ? and project_id = ?
+`
+
+// Index: project_id_group_name_role_id_unique
+const listSsoGroupMappings = `
+  select id, created_at, project_id, group_name, role_id from sso_group_mappings
+  where project_id = ?
+`
+
+// Index: group_name
+const listSsoGroupMappingsByGroups = `
+  select id, created_at, project_id, group_name, role_id from sso_group_mappings
+  where group_name in (%s)
+`
+
+// Index: project_id_id
+const deleteSsoGroupMapping = `
+  delete from sso_group_mappings
+  where id = ? and project_id = ?
+  limit 1
+`
+
+const createSsoManagedRoleBinding = `
+  insert into sso_managed_role_bindings (
+    user_id,
+    role_id,
+    project_id
+  )
+  values (?, ?, ?)
+`
+
+// Index: user_id
+const listSsoManagedRoleBindingsByUser = `
+  select user_id, role_id, created_at, project_id from sso_managed_role_bindings
+  where user_id = ?
+`
+
+// Index: primary key
+const deleteUserSsoGroups = `
+  delete from user_sso_groups
+  where user_id = ?
+`
+
+// The final argument is the placeholders for each group
+const createUserSsoGroups = `
+  insert into user_sso_groups (
+    user_id,
+    group_name
+  )
+  values %s
+`
+
+// Index: primary key
+const listUserSsoGroups = `
+  select group_name from user_sso_groups
+  where user_id = ?
+`
+
+// Index: group_name
+const listUsersBySsoGroup = `
+  select user_id from user_sso_groups
+  where group_name = ?
+`
+
+// Index: synced_at
+const listUsersWithSsoGroupsSyncedBefore = `
+  select distinct user_id from user_sso_groups
+  where synced_at < ?
+`
+
 const createServiceAccount = `
   insert into service_accounts (
     id,
@@ -405,26 +752,35 @@ const createServiceAccountAccessKey = `
     project_id,
     service_account_id,
     hash,
-    description
+    description,
+    expires_at,
+    config
   )
-  values (?, ?, ?, ?, ?)
+  values (?, ?, ?, ?, ?, ?, ?)
 `
 
 // Index: project_id_id
 const getServiceAccountAccessKey = `
-  select id, created_at, project_id, service_account_id, description from service_account_access_keys
+  select id, created_at, project_id, service_account_id, description, expires_at, config, last_used_at, last_used_ip from service_account_access_keys
   where id = ? and project_id = ?
 `
 
 // Index: hash
 const validateServiceAccountAccessKey = `
-  select id, created_at, project_id, service_account_id, description from service_account_access_keys
-  where hash = ?
+  select id, created_at, project_id, service_account_id, description, expires_at, config, last_used_at, last_used_ip from service_account_access_keys
+  where hash = ? and (expires_at is null or expires_at > current_timestamp)
+`
+
+// Index: primary key
+const updateServiceAccountAccessKeyLastUsed = `
+  update service_account_access_keys
+  set last_used_at = current_timestamp, last_used_ip = ?
+  where id = ?
 `
 
 // Index: project_id_service_account_id_id
 const listServiceAccountAccessKeys = `
-  select id, created_at, project_id, service_account_id, description from service_account_access_keys
+  select id, created_at, project_id, service_account_id, description, expires_at, config, last_used_at, last_used_ip from service_account_access_keys
   where project_id = ? and service_account_id = ?
 `
 
@@ -477,29 +833,45 @@ const createDevice = `
 
 // Index: project_id_id
 const getDevice = `
-  select id, created_at, project_id, name, registration_token_id, desired_agent_version, info, labels, environment_variables, last_seen_at from devices
+  select id, created_at, project_id, name, registration_token_id, desired_agent_version, info, labels, environment_variables, last_seen_at, quarantined from devices
   where id = ? and project_id = ?
 `
 
 // Index: project_id_name
 const lookupDevice = `
-  select id, created_at, project_id, name, registration_token_id, desired_agent_version, info, labels, environment_variables, last_seen_at from devices
+  select id, created_at, project_id, name, registration_token_id, desired_agent_version, info, labels, environment_variables, last_seen_at, quarantined from devices
   where name = ? and project_id = ?
 `
 
 // Index: project_id_id
 const listDevices = `
-  select id, created_at, project_id, name, registration_token_id, desired_agent_version, info, labels, environment_variables, last_seen_at from devices
+  select id, created_at, project_id, name, registration_token_id, desired_agent_version, info, labels, environment_variables, last_seen_at, quarantined from devices
   where project_id = ?
 `
 
 // Index: project_id_id,fulltext
 const searchDevices = `
-  select id, created_at, project_id, name, registration_token_id, desired_agent_version, info, labels, environment_variables, last_seen_at from devices
+  select id, created_at, project_id, name, registration_token_id, desired_agent_version, info, labels, environment_variables, last_seen_at, quarantined from devices
   where project_id = ?
   and match (name, labels) against (concat('*', ?, '*') in boolean mode)
 `
 
+// Index: project_id_id
+// Conditions, ordering and a limit are appended
+const queryDevices = `
+  select id, created_at, project_id, name, registration_token_id, desired_agent_version, info, labels, environment_variables, last_seen_at, quarantined from devices
+  where project_id = ?
+`
+
+// Index: project_id_id
+// Conditions are appended
+const countDevices = `
+  select count(*) from devices
+  where project_id = ?
+`
+
+const searchDevicesCondition = `match (name, labels) against (concat('*', ?, '*') in boolean mode)`
+
 // Index: project_id_id
 const updateDeviceName = `
   update devices
@@ -533,6 +905,13 @@ const setDeviceInfo = `
   where id = ? and project_id = ?
 `
 
+// Index: project_id_id
+const updateDeviceQuarantined = `
+  update devices
+  set quarantined = ?
+  where id = ? and project_id = ?
+`
+
 // Index: project_id_id
 const updateDeviceLastSeenAt = `
   update devices
@@ -616,21 +995,76 @@ const createDeviceAccessKey = `
     id,
     project_id,
     device_id,
+    type,
+    replaces_id,
     hash
   )
-  values (?, ?, ?, ?)
+  values (?, ?, ?, ?, ?, ?)
 `
 
 // Index: project_id_id
 const getDeviceAccessKey = `
-  select id, created_at, project_id, device_id from device_access_keys
+  select id, created_at, project_id, device_id, type, replaces_id, revoked_at from device_access_keys
   where id = ? and project_id = ?
 `
 
+// Index: project_id_device_id
+const listDeviceAccessKeys = `
+  select id, created_at, project_id, device_id, type, replaces_id, revoked_at from device_access_keys
+  where project_id = ? and device_id = ?
+  order by created_at desc
+`
+
 // Index: project_id_hash
 const validateDeviceAccessKey = `
-  select id, created_at, project_id, device_id from device_access_keys
+  select id, created_at, project_id, device_id, type, replaces_id, revoked_at from device_access_keys
   where project_id = ? and hash = ?
+  and revoked_at is null
+`
+
+// Index: project_id_id
+const clearDeviceAccessKeyReplacesID = `
+  update device_access_keys
+  set replaces_id = null
+  where id = ? and project_id = ?
+`
+
+// Index: project_id_id
+const revokeDeviceAccessKey = `
+  update device_access_keys
+  set revoked_at = current_timestamp
+  where id = ? and project_id = ? and revoked_at is null
+`
+
+// Index: project_id_device_id
+const revokeDeviceAccessKeyReplacements = `
+  update device_access_keys
+  set revoked_at = current_timestamp
+  where project_id = ? and device_id = ? and replaces_id = ? and revoked_at is null
+`
+
+// Index: project_id_device_id
+const revokeDeviceAccessKeys = `
+  update device_access_keys
+  set revoked_at = current_timestamp
+  where project_id = ? and device_id = ? and revoked_at is null
+`
+
+// Insert ignore so that concurrent registrations agree on the first
+// certificate authority created
+const createDeviceCertificateAuthority = `
+  insert ignore into device_certificate_authorities (
+    project_id,
+    certificate,
+    private_key
+  )
+  values (?, ?, ?)
+`
+
+// Index: primary key
+const getDeviceCertificateAuthority = `
+  select project_id, created_at, certificate, private_key from device_certificate_authorities
+  where project_id = ?
 `
 
 const createConnection = `
@@ -676,6 +1110,49 @@ const deleteConnection = `
   limit 1
 `
 
+const createDeviceGroup = `
+  insert into device_groups (
+    id,
+    project_id,
+    name,
+    description,
+    query
+  )
+  values (?, ?, ?, ?, ?)
+`
+
+// Index: project_id_id
+const getDeviceGroup = `
+  select id, created_at, project_id, name, description, query from device_groups
+  where id = ? and project_id = ?
+`
+
+// Index: project_id_name
+const lookupDeviceGroup = `
+  select id, created_at, project_id, name, description, query from device_groups
+  where name = ? and project_id = ?
+`
+
+// Index: project_id_id
+const listDeviceGroups = `
+  select id, created_at, project_id, name, description, query from device_groups
+  where project_id = ?
+`
+
+// Index: project_id_id
+const updateDeviceGroup = `
+  update device_groups
+  set name = ?, description = ?, query = ?
+  where id = ? and project_id = ?
+`
+
+// Index: project_id_id
+const deleteDeviceGroup = `
+  delete from device_groups
+  where id = ? and project_id = ?
+  limit 1
+`
+
 const createApplication = `
   insert into applications (
     id,
@@ -939,3 +1416,229 @@ const getProjectConfig = `
   select project_id, k, v from project_configs
   where project_id = ? and k = ?
 `
+
+const createMetricSeries = `
+  insert ignore into metric_series (
+    id,
+    project_id,
+    metric,
+    tags
+  )
+  values (?, ?, ?, ?)
+`
+
+// Index: project_id_metric
+const listMetricSeries = `
+  select id, project_id, metric, tags from metric_series
+  where project_id = ? and metric = ?
+`
+
+// Index: primary key
+const deleteEmptyMetricSeries = `
+  delete from metric_series
+  where created_at < date_sub(current_timestamp, interval 1 hour)
+  and not exists (
+    select 1 from metric_points
+    where metric_points.series_id = metric_series.id
+  )
+`
+
+// Points replace any that are already stored for the same second, so
+// writing the same points again doesn't count them twice
+const addMetricPoints = `
+  insert into metric_points (
+    series_id,
+    resolution,
+    ts,
+    value_count,
+    value_sum,
+    value_min,
+    value_max
+  )
+  values %s
+  on duplicate key update
+    value_count = values(value_count),
+    value_sum = values(value_sum),
+    value_min = values(value_min),
+    value_max = values(value_max)
+`
+
+// Index: primary key
+const listMetricPoints = `
+  select series_id, resolution, ts, value_count, value_sum, value_min, value_max from metric_points
+  where series_id in (%s) and resolution = ? and ts >= ? and ts < ?
+  order by ts
+`
+
+// Index: resolution_ts
+//
+// Buckets are recomputed in full, so running this again over the same range
+// picks up points that arrived late without counting any twice
+const downsampleMetricPoints = `
+  insert into metric_points (
+    series_id,
+    resolution,
+    ts,
+    value_count,
+    value_sum,
+    value_min,
+    value_max
+  )
+  select series_id, ?, ts - mod(ts, ?) as bucket, sum(value_count), sum(value_sum), min(value_min), max(value_max)
+  from metric_points
+  where resolution = ? and ts >= ? and ts < ?
+  group by series_id, bucket
+  on duplicate key update
+    value_count = values(value_count),
+    value_sum = values(value_sum),
+    value_min = values(value_min),
+    value_max = values(value_max)
+`
+
+// Index: resolution_ts
+const deleteMetricPoints = `
+  delete from metric_points
+  where resolution = ? and ts < ?
+`
+
+const createJob = `
+  insert into jobs (
+    id,
+    project_id,
+    type,
+    params,
+    status,
+    error,
+    item_count
+  )
+  values (?, ?, ?, ?, 'pending', '', ?)
+`
+
+// The final argument is the placeholders for each item
+const createJobItems = `
+  insert into job_items (
+    job_id,
+    item_id,
+    position,
+    name,
+    status,
+    error
+  )
+  values %s
+`
+
+// Index: project_id_id
+const getJob = `
+  select id, created_at, project_id, type, params, status, cancel_requested, error, item_count,
+    (select count(*) from job_items where job_items.job_id = jobs.id and job_items.status = 'succeeded'),
+    (select count(*) from job_items where job_items.job_id = jobs.id and job_items.status = 'failed'),
+    started_at, finished_at, claim_id
+  from jobs
+  where id = ? and project_id = ?
+`
+
+// Index: project_id_id
+const listJobs = `
+  select id, created_at, project_id, type, params, status, cancel_requested, error, item_count,
+    (select count(*) from job_items where job_items.job_id = jobs.id and job_items.status = 'succeeded'),
+    (select count(*) from job_items where job_items.job_id = jobs.id and job_items.status = 'failed'),
+    started_at, finished_at, claim_id
+  from jobs
+  where project_id = ?
+  order by created_at desc
+`
+
+// Index: claim_id
+const getClaimedJob = `
+  select id, created_at, project_id, type, params, status, cancel_requested, error, item_count,
+    (select count(*) from job_items where job_items.job_id = jobs.id and job_items.status = 'succeeded'),
+    (select count(*) from job_items where job_items.job_id = jobs.id and job_items.status = 'failed'),
+    started_at, finished_at, claim_id
+  from jobs
+  where id = ? and claim_id = ? and status = 'running'
+`
+
+// Index: job_id_position
+const listJobItems = `
+  select job_items.job_id, job_items.item_id, job_items.name, job_items.status, job_items.error, job_items.updated_at
+  from job_items
+  join jobs on jobs.id = job_items.job_id
+  where job_items.job_id = ? and jobs.project_id = ?
+  order by job_items.position
+`
+
+// Index: job_id_status_position
+const listPendingJobItems = `
+  select job_items.job_id, job_items.item_id, job_items.name, job_items.status, job_items.error, job_items.updated_at
+  from job_items
+  join jobs on jobs.id = job_items.job_id
+  where job_items.job_id = ? and jobs.project_id = ? and job_items.status = 'pending'
+  order by job_items.position
+  limit ?
+`
+
+// Index: project_id_id
+//
+// Jobs that haven't been claimed yet are cancelled straight away. Assignments
+// are applied in order, so finished_at is set before status changes.
+const cancelJob = `
+  update jobs
+  set
+    finished_at = if(status = 'pending', current_timestamp, finished_at),
+    status = if(status = 'pending', 'cancelled', status),
+    cancel_requested = true
+  where id = ? and project_id = ? and status in ('pending', 'running')
+`
+
+// Index: status_lease_expires_at
+//
+// Running jobs whose lease has expired were left behind by a runner that
+// stopped, so they're picked up again
+const claimJob = `
+  update jobs
+  set
+    status = 'running',
+    claim_id = ?,
+    lease_expires_at = date_add(current_timestamp, interval ? second),
+    started_at = coalesce(started_at, current_timestamp)
+  where status = 'pending' or (status = 'running' and lease_expires_at < current_timestamp)
+  order by created_at
+  limit 1
+`
+
+// Index: claim_id
+const getJobByClaim = `
+  select id, created_at, project_id, type, params, status, cancel_requested, error, item_count,
+    (select count(*) from job_items where job_items.job_id = jobs.id and job_items.status = 'succeeded'),
+    (select count(*) from job_items where job_items.job_id = jobs.id and job_items.status = 'failed'),
+    started_at, finished_at, claim_id
+  from jobs
+  where claim_id = ?
+`
+
+// Index: primary key
+const renewJobLease = `
+  update jobs
+  set lease_expires_at = date_add(current_timestamp, interval ? second)
+  where id = ? and claim_id = ? and status = 'running'
+`
+
+// Index: primary key
+const setJobItemResult = `
+  update job_items
+  set status = ?, error = ?
+  where job_id = ? and item_id = ? and status = 'pending'
+`
+
+// Index: primary key
+const finishJob = `
+  update jobs
+  set status = ?, error = ?, finished_at = current_timestamp, lease_expires_at = null
+  where id = ? and claim_id = ? and status = 'running'
+`
+
+// Index: finished_at
+const deleteJobsFinishedBefore = `
+  delete from jobs
+  where finished_at < ?
+`
@@ -5,6 +5,7 @@ import (
 	"database/sql"
 	"encoding/json"
 	"fmt"
+	"strings"
 	"time"
 
 	"github.com/deviceplane/deviceplane/pkg/controller/store"
@@ -27,6 +28,8 @@ const (
 	passwordRecoveryTokenPrefix   = "pwr"
 	sessionPrefix                 = "ses"
 	userAccessKeyPrefix           = "uky"
+	organizationPrefix            = "org"
+	organizationRolePrefix        = "orl"
 	projectPrefix                 = "prj"
 	rolePrefix                    = "rol"
 	serviceAccountPrefix          = "sac"
@@ -35,8 +38,12 @@ const (
 	deviceRegistrationTokenPrefix = "drt"
 	deviceAccessKeyPrefix         = "dak"
 	connectionPrefix              = "ctn"
+	deviceGroupPrefix             = "dgp"
 	applicationPrefix             = "app"
 	releasePrefix                 = "rel"
+	ssoGroupMappingPrefix         = "sgm"
+	jobPrefix                     = "job"
+	jobClaimPrefix                = "jcl"
 )
 
 func newUserID() string {
@@ -67,6 +74,14 @@ func newUserAccessKeyID() string {
 	return fmt.Sprintf("%s_%s", userAccessKeyPrefix, ksuid.New().String())
 }
 
+func newOrganizationID() string {
+	return fmt.Sprintf("%s_%s", organizationPrefix, ksuid.New().String())
+}
+
+func newOrganizationRoleID() string {
+	return fmt.Sprintf("%s_%s", organizationRolePrefix, ksuid.New().String())
+}
+
 func newProjectID() string {
 	return fmt.Sprintf("%s_%s", projectPrefix, ksuid.New().String())
 }
@@ -99,6 +114,10 @@ func newConnectionID() string {
 	return fmt.Sprintf("%s_%s", connectionPrefix, ksuid.New().String())
 }
 
+func newDeviceGroupID() string {
+	return fmt.Sprintf("%s_%s", deviceGroupPrefix, ksuid.New().String())
+}
+
 func newApplicationID() string {
 	return fmt.Sprintf("%s_%s", applicationPrefix, ksuid.New().String())
 }
@@ -107,32 +126,58 @@ func newReleaseID() string {
 	return fmt.Sprintf("%s_%s", releasePrefix, ksuid.New().String())
 }
 
+func newSsoGroupMappingID() string {
+	return fmt.Sprintf("%s_%s", ssoGroupMappingPrefix, ksuid.New().String())
+}
+
+func newJobID() string {
+	return fmt.Sprintf("%s_%s", jobPrefix, ksuid.New().String())
+}
+
+func newJobClaimID() string {
+	return fmt.Sprintf("%s_%s", jobClaimPrefix, ksuid.New().String())
+}
+
 var (
-	_ store.Users                      = &Store{}
-	_ store.InternalUsers              = &Store{}
-	_ store.ExternalUsers              = &Store{}
-	_ store.RegistrationTokens         = &Store{}
-	_ store.PasswordRecoveryTokens     = &Store{}
-	_ store.Sessions                   = &Store{}
-	_ store.UserAccessKeys             = &Store{}
-	_ store.Projects                   = &Store{}
-	_ store.ProjectDeviceCounts        = &Store{}
-	_ store.Roles                      = &Store{}
-	_ store.Memberships                = &Store{}
-	_ store.MembershipRoleBindings     = &Store{}
-	_ store.ServiceAccounts            = &Store{}
-	_ store.ServiceAccountAccessKeys   = &Store{}
-	_ store.ServiceAccountRoleBindings = &Store{}
-	_ store.Devices                    = &Store{}
-	_ store.DeviceAccessKeys           = &Store{}
-	_ store.DeviceRegistrationTokens   = &Store{}
-	_ store.Connections                = &Store{}
-	_ store.Applications               = &Store{}
-	_ store.Releases                   = &Store{}
-	_ store.ReleaseDeviceCounts        = &Store{}
-	_ store.DeviceApplicationStatuses  = &Store{}
-	_ store.DeviceServiceStatuses      = &Store{}
-	_ store.DeviceServiceStates        = &Store{}
+	_ store.Users                              = &Store{}
+	_ store.InternalUsers                      = &Store{}
+	_ store.ExternalUsers                      = &Store{}
+	_ store.RegistrationTokens                 = &Store{}
+	_ store.PasswordRecoveryTokens             = &Store{}
+	_ store.Sessions                           = &Store{}
+	_ store.UserAccessKeys                     = &Store{}
+	_ store.UserTOTPs                          = &Store{}
+	_ store.UserRecoveryCodes                  = &Store{}
+	_ store.Organizations                      = &Store{}
+	_ store.OrganizationMemberships            = &Store{}
+	_ store.OrganizationRoles                  = &Store{}
+	_ store.OrganizationMembershipRoleBindings = &Store{}
+	_ store.Projects                           = &Store{}
+	_ store.ProjectDeviceCounts                = &Store{}
+	_ store.Roles                              = &Store{}
+	_ store.Memberships                        = &Store{}
+	_ store.MembershipRoleBindings             = &Store{}
+	_ store.SsoGroupMappings                   = &Store{}
+	_ store.SsoManagedRoleBindings             = &Store{}
+	_ store.UserSsoGroups                      = &Store{}
+	_ store.ServiceAccounts                    = &Store{}
+	_ store.ServiceAccountAccessKeys           = &Store{}
+	_ store.ServiceAccountRoleBindings         = &Store{}
+	_ store.Devices                            = &Store{}
+	_ store.DeviceAccessKeys                   = &Store{}
+	_ store.DeviceCertificateAuthorities       = &Store{}
+	_ store.DeviceRegistrationTokens           = &Store{}
+	_ store.Connections                        = &Store{}
+	_ store.DeviceGroups                       = &Store{}
+	_ store.Applications                       = &Store{}
+	_ store.Releases                           = &Store{}
+	_ store.ReleaseDeviceCounts                = &Store{}
+	_ store.DeviceApplicationStatuses          = &Store{}
+	_ store.DeviceServiceStatuses              = &Store{}
+	_ store.DeviceServiceStates                = &Store{}
+	_ store.SecurityConfigs                    = &Store{}
+	_ store.StoredMetrics                      = &Store{}
+	_ store.Jobs                               = &Store{}
 )
 
 type Store struct {
@@ -262,6 +307,25 @@ func (s *Store) GetExternalUserByProviderID(ctx context.Context, providerName, p
 	return user, nil
 }
 
+func (s *Store) UpdateExternalUser(ctx context.Context, id, email string, info map[string]interface{}) (*models.ExternalUser, error) {
+	serializedInfo, err := json.Marshal(info)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := s.db.ExecContext(
+		ctx,
+		updateExternalUser,
+		email,
+		string(serializedInfo),
+		id,
+	); err != nil {
+		return nil, err
+	}
+
+	return s.GetExternalUser(ctx, id)
+}
+
 func (s *Store) CreateInternalUser(ctx context.Context, email, passwordHash string) (*models.InternalUser, error) {
 	id := newInternalUserID()
 
@@ -500,7 +564,7 @@ func (s *Store) scanPasswordRecoveryToken(scanner scanner) (*models.PasswordReco
 	return &passwordRecoveryToken, nil
 }
 
-func (s *Store) CreateSession(ctx context.Context, userID, hash string) (*models.Session, error) {
+func (s *Store) CreateSession(ctx context.Context, userID, hash string, expiresAt time.Time, ip, userAgent string) (*models.Session, error) {
 	id := newSessionID()
 
 	if _, err := s.db.ExecContext(
@@ -509,6 +573,9 @@ func (s *Store) CreateSession(ctx context.Context, userID, hash string) (*models
 		id,
 		userID,
 		hash,
+		expiresAt,
+		ip,
+		truncateUserAgent(userAgent),
 	); err != nil {
 		return nil, err
 	}
@@ -529,7 +596,7 @@ func (s *Store) GetSession(ctx context.Context, id string) (*models.Session, err
 	return session, nil
 }
 
-func (s *Store) ValidateSession(ctx context.Context, hash string) (*models.Session, error) {
+func (s *Store) ValidateSession(ctx context.Context, hash string, expiresAt time.Time, ip, userAgent string) (*models.Session, error) {
 	sessionRow := s.db.QueryRowContext(ctx, validateSession, hash)
 
 	session, err := s.scanSession(sessionRow)
@@ -539,7 +606,41 @@ func (s *Store) ValidateSession(ctx context.Context, hash string) (*models.Sessi
 		return nil, err
 	}
 
-	return session, nil
+	if _, err := s.db.ExecContext(
+		ctx,
+		updateSessionLastUsed,
+		expiresAt,
+		ip,
+		truncateUserAgent(userAgent),
+		session.ID,
+	); err != nil {
+		return nil, err
+	}
+
+	return s.GetSession(ctx, session.ID)
+}
+
+func (s *Store) ListSessions(ctx context.Context, userID string) ([]models.Session, error) {
+	sessionRows, err := s.db.QueryContext(ctx, listSessions, userID)
+	if err != nil {
+		return nil, errors.Wrap(err, "query sessions")
+	}
+	defer sessionRows.Close()
+
+	sessions := make([]models.Session, 0)
+	for sessionRows.Next() {
+		session, err := s.scanSession(sessionRows)
+		if err != nil {
+			return nil, err
+		}
+		sessions = append(sessions, *session)
+	}
+
+	if err := sessionRows.Err(); err != nil {
+		return nil, err
+	}
+
+	return sessions, nil
 }
 
 func (s *Store) DeleteSession(ctx context.Context, id string) error {
@@ -547,19 +648,37 @@ func (s *Store) DeleteSession(ctx context.Context, id string) error {
 	return err
 }
 
+func (s *Store) DeleteUserSessions(ctx context.Context, userID string) error {
+	_, err := s.db.ExecContext(ctx, deleteUserSessions, userID)
+	return err
+}
+
 func (s *Store) scanSession(scanner scanner) (*models.Session, error) {
 	var session models.Session
 	if err := scanner.Scan(
 		&session.ID,
 		&session.CreatedAt,
 		&session.UserID,
+		&session.ExpiresAt,
+		&session.LastUsedAt,
+		&session.LastUsedIP,
+		&session.UserAgent,
 	); err != nil {
 		return nil, err
 	}
 	return &session, nil
 }
 
-func (s *Store) CreateUserAccessKey(ctx context.Context, userID, hash, description string) (*models.UserAccessKey, error) {
+// truncateUserAgent keeps user agents within the size of their column.
+func truncateUserAgent(userAgent string) string {
+	const maxUserAgentLength = 255
+	if len(userAgent) > maxUserAgentLength {
+		return userAgent[:maxUserAgentLength]
+	}
+	return userAgent
+}
+
+func (s *Store) CreateUserAccessKey(ctx context.Context, userID, hash, description string, expiresAt *time.Time, config *string) (*models.UserAccessKey, error) {
 	id := newUserAccessKeyID()
 
 	if _, err := s.db.ExecContext(
@@ -569,6 +688,8 @@ func (s *Store) CreateUserAccessKey(ctx context.Context, userID, hash, descripti
 		userID,
 		hash,
 		description,
+		expiresAt,
+		config,
 	); err != nil {
 		return nil, err
 	}
@@ -589,7 +710,7 @@ func (s *Store) GetUserAccessKey(ctx context.Context, id string) (*models.UserAc
 	return userAccessKey, nil
 }
 
-func (s *Store) ValidateUserAccessKey(ctx context.Context, hash string) (*models.UserAccessKey, error) {
+func (s *Store) ValidateUserAccessKey(ctx context.Context, hash, ip string) (*models.UserAccessKey, error) {
 	userAccessKeyRow := s.db.QueryRowContext(ctx, validateUserAccessKey, hash)
 
 	userAccessKey, err := s.scanUserAccessKey(userAccessKeyRow)
@@ -599,7 +720,16 @@ func (s *Store) ValidateUserAccessKey(ctx context.Context, hash string) (*models
 		return nil, err
 	}
 
-	return userAccessKey, nil
+	if _, err := s.db.ExecContext(
+		ctx,
+		updateUserAccessKeyLastUsed,
+		ip,
+		userAccessKey.ID,
+	); err != nil {
+		return nil, err
+	}
+
+	return s.GetUserAccessKey(ctx, userAccessKey.ID)
 }
 
 func (s *Store) ListUserAccessKeys(ctx context.Context, projectID string) ([]models.UserAccessKey, error) {
@@ -641,285 +771,263 @@ func (s *Store) scanUserAccessKey(scanner scanner) (*models.UserAccessKey, error
 		&userAccessKey.CreatedAt,
 		&userAccessKey.UserID,
 		&userAccessKey.Description,
+		&userAccessKey.ExpiresAt,
+		&userAccessKey.Config,
+		&userAccessKey.LastUsedAt,
+		&userAccessKey.LastUsedIP,
 	); err != nil {
 		return nil, err
 	}
 	return &userAccessKey, nil
 }
 
-func (s *Store) CreateProject(ctx context.Context, name string) (*models.Project, error) {
-	id := newProjectID()
-
+func (s *Store) SetUserTOTPSecret(ctx context.Context, userID, secret string) (*models.UserTOTP, error) {
 	if _, err := s.db.ExecContext(
 		ctx,
-		createProject,
-		id,
-		name,
+		setUserTOTPSecret,
+		userID,
+		secret,
 	); err != nil {
 		return nil, err
 	}
 
-	return s.GetProject(ctx, id)
+	return s.GetUserTOTP(ctx, userID)
 }
 
-func (s *Store) GetProject(ctx context.Context, id string) (*models.Project, error) {
-	projectRow := s.db.QueryRowContext(ctx, getProject, id)
+func (s *Store) GetUserTOTP(ctx context.Context, userID string) (*models.UserTOTP, error) {
+	totpRow := s.db.QueryRowContext(ctx, getUserTOTP, userID)
 
-	project, err := s.scanProject(projectRow)
+	totp, err := s.scanUserTOTP(totpRow)
 	if err == sql.ErrNoRows {
-		return nil, store.ErrProjectNotFound
+		return nil, store.ErrUserTOTPNotFound
 	} else if err != nil {
 		return nil, err
 	}
 
-	return project, nil
+	return totp, nil
 }
 
-func (s *Store) LookupProject(ctx context.Context, name string) (*models.Project, error) {
-	projectRow := s.db.QueryRowContext(ctx, lookupProject, name)
-
-	project, err := s.scanProject(projectRow)
-	if err == sql.ErrNoRows {
-		return nil, store.ErrProjectNotFound
-	} else if err != nil {
+func (s *Store) EnableUserTOTP(ctx context.Context, userID string) (*models.UserTOTP, error) {
+	if _, err := s.db.ExecContext(
+		ctx,
+		enableUserTOTP,
+		userID,
+	); err != nil {
 		return nil, err
 	}
 
-	return project, nil
+	return s.GetUserTOTP(ctx, userID)
 }
 
-func (s *Store) ListProjects(ctx context.Context) ([]models.Project, error) {
-	projectRows, err := s.db.QueryContext(ctx, listProjects)
+func (s *Store) UseUserTOTPCounter(ctx context.Context, userID string, counter int64) error {
+	result, err := s.db.ExecContext(
+		ctx,
+		useUserTOTPCounter,
+		counter,
+		userID,
+		counter,
+	)
 	if err != nil {
-		return nil, errors.Wrap(err, "query projects")
+		return err
 	}
-	defer projectRows.Close()
 
-	projects := make([]models.Project, 0)
-	for projectRows.Next() {
-		project, err := s.scanProject(projectRows)
-		if err != nil {
-			return nil, err
-		}
-		projects = append(projects, *project)
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
 	}
-
-	if err := projectRows.Err(); err != nil {
-		return nil, err
+	if rowsAffected == 0 {
+		return store.ErrUserTOTPCodeUsed
 	}
 
-	return projects, nil
+	return nil
 }
 
-func (s *Store) UpdateProject(ctx context.Context, id, name, datadogApiKey string) (*models.Project, error) {
-	if _, err := s.db.ExecContext(
+func (s *Store) RecordUserTOTPFailure(ctx context.Context, userID string, maxAttempts int, lockout time.Duration) error {
+	_, err := s.db.ExecContext(
 		ctx,
-		updateProject,
-		name,
-		datadogApiKey,
-		id,
-	); err != nil {
-		return nil, err
-	}
+		recordUserTOTPFailure,
+		maxAttempts,
+		int64(lockout/time.Second),
+		maxAttempts,
+		userID,
+	)
+	return err
+}
 
-	return s.GetProject(ctx, id)
+func (s *Store) ResetUserTOTPFailures(ctx context.Context, userID string) error {
+	_, err := s.db.ExecContext(
+		ctx,
+		resetUserTOTPFailures,
+		userID,
+	)
+	return err
 }
 
-func (s *Store) DeleteProject(ctx context.Context, id string) error {
+func (s *Store) DeleteUserTOTP(ctx context.Context, userID string) error {
 	_, err := s.db.ExecContext(
 		ctx,
-		deleteProject,
-		id,
+		deleteUserTOTP,
+		userID,
 	)
 	return err
 }
 
-func (s *Store) scanProject(scanner scanner) (*models.Project, error) {
-	var project models.Project
+func (s *Store) scanUserTOTP(scanner scanner) (*models.UserTOTP, error) {
+	var totp models.UserTOTP
 	if err := scanner.Scan(
-		&project.ID,
-		&project.CreatedAt,
-		&project.Name,
-		&project.DatadogAPIKey,
+		&totp.UserID,
+		&totp.CreatedAt,
+		&totp.Secret,
+		&totp.Enabled,
+		&totp.Locked,
 	); err != nil {
 		return nil, err
 	}
-	return &project, nil
+	return &totp, nil
 }
 
-func (s *Store) GetProjectDeviceCounts(ctx context.Context, projectID string) (*models.ProjectDeviceCounts, error) {
-	countRow := s.db.QueryRowContext(ctx, getProjectDeviceCounts, projectID)
+func (s *Store) SetUserRecoveryCodes(ctx context.Context, userID string, hashes []string) error {
+	if _, err := s.db.ExecContext(
+		ctx,
+		deleteUserRecoveryCodes,
+		userID,
+	); err != nil {
+		return err
+	}
 
-	count, err := s.scanProjectDeviceCountRow(countRow)
-	if err != nil {
-		return nil, err
+	for _, hash := range hashes {
+		if _, err := s.db.ExecContext(
+			ctx,
+			createUserRecoveryCode,
+			userID,
+			hash,
+		); err != nil {
+			return err
+		}
 	}
 
-	return &models.ProjectDeviceCounts{
-		AllCount: count,
-	}, nil
+	return nil
 }
 
-func (s *Store) scanProjectDeviceCountRow(scanner scanner) (int, error) {
-	var count int
-	if err := scanner.Scan(
-		&count,
-	); err != nil {
-		return 0, err
+func (s *Store) UseUserRecoveryCode(ctx context.Context, userID, hash string) error {
+	result, err := s.db.ExecContext(
+		ctx,
+		deleteUserRecoveryCode,
+		userID,
+		hash,
+	)
+	if err != nil {
+		return err
 	}
-	return count, nil
-}
-
-func (s *Store) GetProjectApplicationCounts(ctx context.Context, projectID string) (*models.ProjectApplicationCounts, error) {
-	countRow := s.db.QueryRowContext(ctx, getProjectApplicationCounts, projectID)
 
-	count, err := s.scanProjectApplicationCountRow(countRow)
+	rowsAffected, err := result.RowsAffected()
 	if err != nil {
-		return nil, err
+		return err
 	}
-
-	return &models.ProjectApplicationCounts{
-		AllCount: count,
-	}, nil
-}
-
-func (s *Store) scanProjectApplicationCountRow(scanner scanner) (int, error) {
-	var count int
-	if err := scanner.Scan(
-		&count,
-	); err != nil {
-		return 0, err
+	if rowsAffected == 0 {
+		return store.ErrUserRecoveryCodeNotFound
 	}
-	return count, nil
+
+	return nil
 }
 
-func (s *Store) CreateRole(ctx context.Context, projectID, name, description, config string) (*models.Role, error) {
-	id := newRoleID()
+func (s *Store) CreateOrganization(ctx context.Context, name, billingEmail string) (*models.Organization, error) {
+	id := newOrganizationID()
 
 	if _, err := s.db.ExecContext(
 		ctx,
-		createRole,
+		createOrganization,
 		id,
-		projectID,
 		name,
-		description,
-		config,
+		billingEmail,
 	); err != nil {
 		return nil, err
 	}
 
-	return s.GetRole(ctx, id, projectID)
+	return s.GetOrganization(ctx, id)
 }
 
-func (s *Store) GetRole(ctx context.Context, id, projectID string) (*models.Role, error) {
-	roleRow := s.db.QueryRowContext(ctx, getRole, id, projectID)
+func (s *Store) GetOrganization(ctx context.Context, id string) (*models.Organization, error) {
+	organizationRow := s.db.QueryRowContext(ctx, getOrganization, id)
 
-	role, err := s.scanRole(roleRow)
+	organization, err := s.scanOrganization(organizationRow)
 	if err == sql.ErrNoRows {
-		return nil, store.ErrRoleNotFound
+		return nil, store.ErrOrganizationNotFound
 	} else if err != nil {
 		return nil, err
 	}
 
-	return role, nil
+	return organization, nil
 }
 
-func (s *Store) LookupRole(ctx context.Context, name, projectID string) (*models.Role, error) {
-	roleRow := s.db.QueryRowContext(ctx, lookupRole, name, projectID)
+func (s *Store) LookupOrganization(ctx context.Context, name string) (*models.Organization, error) {
+	organizationRow := s.db.QueryRowContext(ctx, lookupOrganization, name)
 
-	role, err := s.scanRole(roleRow)
+	organization, err := s.scanOrganization(organizationRow)
 	if err == sql.ErrNoRows {
-		return nil, store.ErrRoleNotFound
+		return nil, store.ErrOrganizationNotFound
 	} else if err != nil {
 		return nil, err
 	}
 
-	return role, nil
-}
-
-func (s *Store) ListRoles(ctx context.Context, projectID string) ([]models.Role, error) {
-	roleRows, err := s.db.QueryContext(ctx, listRoles, projectID)
-	if err != nil {
-		return nil, errors.Wrap(err, "query roles")
-	}
-	defer roleRows.Close()
-
-	roles := make([]models.Role, 0)
-	for roleRows.Next() {
-		role, err := s.scanRole(roleRows)
-		if err != nil {
-			return nil, err
-		}
-		roles = append(roles, *role)
-	}
-
-	if err := roleRows.Err(); err != nil {
-		return nil, err
-	}
-
-	return roles, nil
+	return organization, nil
 }
 
-func (s *Store) UpdateRole(ctx context.Context, id, projectID, name, description, config string) (*models.Role, error) {
+func (s *Store) UpdateOrganization(ctx context.Context, id, name, billingEmail string) (*models.Organization, error) {
 	if _, err := s.db.ExecContext(
 		ctx,
-		updateRole,
+		updateOrganization,
 		name,
-		description,
-		config,
+		billingEmail,
 		id,
-		projectID,
 	); err != nil {
 		return nil, err
 	}
 
-	return s.GetRole(ctx, id, projectID)
+	return s.GetOrganization(ctx, id)
 }
 
-func (s *Store) DeleteRole(ctx context.Context, id, projectID string) error {
+func (s *Store) DeleteOrganization(ctx context.Context, id string) error {
 	_, err := s.db.ExecContext(
 		ctx,
-		deleteRole,
+		deleteOrganization,
 		id,
-		projectID,
 	)
 	return err
 }
 
-func (s *Store) scanRole(scanner scanner) (*models.Role, error) {
-	var role models.Role
+func (s *Store) scanOrganization(scanner scanner) (*models.Organization, error) {
+	var organization models.Organization
 	if err := scanner.Scan(
-		&role.ID,
-		&role.CreatedAt,
-		&role.ProjectID,
-		&role.Name,
-		&role.Description,
-		&role.Config,
+		&organization.ID,
+		&organization.CreatedAt,
+		&organization.Name,
+		&organization.BillingEmail,
 	); err != nil {
 		return nil, err
 	}
-	return &role, nil
+	return &organization, nil
 }
 
-func (s *Store) CreateMembership(ctx context.Context, userID, projectID string) (*models.Membership, error) {
+func (s *Store) CreateOrganizationMembership(ctx context.Context, userID, organizationID string) (*models.OrganizationMembership, error) {
 	if _, err := s.db.ExecContext(
 		ctx,
-		createMembership,
+		createOrganizationMembership,
 		userID,
-		projectID,
+		organizationID,
 	); err != nil {
 		return nil, err
 	}
 
-	return s.GetMembership(ctx, userID, projectID)
+	return s.GetOrganizationMembership(ctx, userID, organizationID)
 }
 
-func (s *Store) GetMembership(ctx context.Context, userID, projectID string) (*models.Membership, error) {
-	membershipRow := s.db.QueryRowContext(ctx, getMembership, userID, projectID)
+func (s *Store) GetOrganizationMembership(ctx context.Context, userID, organizationID string) (*models.OrganizationMembership, error) {
+	membershipRow := s.db.QueryRowContext(ctx, getOrganizationMembership, userID, organizationID)
 
-	membership, err := s.scanMembership(membershipRow)
+	membership, err := s.scanOrganizationMembership(membershipRow)
 	if err == sql.ErrNoRows {
-		return nil, store.ErrMembershipNotFound
+		return nil, store.ErrOrganizationMembershipNotFound
 	} else if err != nil {
 		return nil, err
 	}
@@ -927,24 +1035,24 @@ func (s *Store) GetMembership(ctx context.Context, userID, projectID string) (*m
 	return membership, nil
 }
 
-func (s *Store) ListMembershipsByUser(ctx context.Context, userID string) ([]models.Membership, error) {
-	return s.listMemberships(ctx, userID, listMembershipsByUser)
+func (s *Store) ListOrganizationMembershipsByUser(ctx context.Context, userID string) ([]models.OrganizationMembership, error) {
+	return s.listOrganizationMemberships(ctx, userID, listOrganizationMembershipsByUser)
 }
 
-func (s *Store) ListMembershipsByProject(ctx context.Context, projectID string) ([]models.Membership, error) {
-	return s.listMemberships(ctx, projectID, listMembershipsByProject)
+func (s *Store) ListOrganizationMembershipsByOrganization(ctx context.Context, organizationID string) ([]models.OrganizationMembership, error) {
+	return s.listOrganizationMemberships(ctx, organizationID, listOrganizationMembershipsByOrganization)
 }
 
-func (s *Store) listMemberships(ctx context.Context, id, query string) ([]models.Membership, error) {
+func (s *Store) listOrganizationMemberships(ctx context.Context, id, query string) ([]models.OrganizationMembership, error) {
 	membershipRows, err := s.db.QueryContext(ctx, query, id)
 	if err != nil {
-		return nil, errors.Wrap(err, "query memberships")
+		return nil, errors.Wrap(err, "query organization memberships")
 	}
 	defer membershipRows.Close()
 
-	memberships := make([]models.Membership, 0)
+	memberships := make([]models.OrganizationMembership, 0)
 	for membershipRows.Next() {
-		membership, err := s.scanMembership(membershipRows)
+		membership, err := s.scanOrganizationMembership(membershipRows)
 		if err != nil {
 			return nil, err
 		}
@@ -958,21 +1066,21 @@ func (s *Store) listMemberships(ctx context.Context, id, query string) ([]models
 	return memberships, nil
 }
 
-func (s *Store) DeleteMembership(ctx context.Context, userID, projectID string) error {
+func (s *Store) DeleteOrganizationMembership(ctx context.Context, userID, organizationID string) error {
 	_, err := s.db.ExecContext(
 		ctx,
-		deleteMembership,
+		deleteOrganizationMembership,
 		userID,
-		projectID,
+		organizationID,
 	)
 	return err
 }
 
-func (s *Store) scanMembership(scanner scanner) (*models.Membership, error) {
-	var membership models.Membership
+func (s *Store) scanOrganizationMembership(scanner scanner) (*models.OrganizationMembership, error) {
+	var membership models.OrganizationMembership
 	if err := scanner.Scan(
 		&membership.UserID,
-		&membership.ProjectID,
+		&membership.OrganizationID,
 		&membership.CreatedAt,
 	); err != nil {
 		return nil, err
@@ -980,2056 +1088,3774 @@ func (s *Store) scanMembership(scanner scanner) (*models.Membership, error) {
 	return &membership, nil
 }
 
-func (s *Store) CreateMembershipRoleBinding(ctx context.Context, userID, roleID, projectID string) (*models.MembershipRoleBinding, error) {
+func (s *Store) CreateOrganizationRole(ctx context.Context, organizationID, name, description, config string) (*models.OrganizationRole, error) {
+	id := newOrganizationRoleID()
+
 	if _, err := s.db.ExecContext(
 		ctx,
-		createMembershipRoleBinding,
-		userID,
-		roleID,
-		projectID,
+		createOrganizationRole,
+		id,
+		organizationID,
+		name,
+		description,
+		config,
 	); err != nil {
 		return nil, err
 	}
 
-	return s.GetMembershipRoleBinding(ctx, userID, roleID, projectID)
+	return s.GetOrganizationRole(ctx, id, organizationID)
 }
 
-func (s *Store) GetMembershipRoleBinding(ctx context.Context, userID, roleID, projectID string) (*models.MembershipRoleBinding, error) {
-	membershipRoleBindingRow := s.db.QueryRowContext(ctx, getMembershipRoleBinding, userID, roleID, projectID)
+func (s *Store) GetOrganizationRole(ctx context.Context, id, organizationID string) (*models.OrganizationRole, error) {
+	roleRow := s.db.QueryRowContext(ctx, getOrganizationRole, id, organizationID)
 
-	membershipRoleBinding, err := s.scanMembershipRoleBinding(membershipRoleBindingRow)
+	role, err := s.scanOrganizationRole(roleRow)
 	if err == sql.ErrNoRows {
-		return nil, store.ErrMembershipRoleBindingNotFound
+		return nil, store.ErrOrganizationRoleNotFound
 	} else if err != nil {
 		return nil, err
 	}
 
-	return membershipRoleBinding, nil
+	return role, nil
 }
 
-func (s *Store) ListMembershipRoleBindings(ctx context.Context, userID, projectID string) ([]models.MembershipRoleBinding, error) {
-	membershipRoleBindingRows, err := s.db.QueryContext(ctx, listMembershipRoleBindings, userID, projectID)
+func (s *Store) LookupOrganizationRole(ctx context.Context, name, organizationID string) (*models.OrganizationRole, error) {
+	roleRow := s.db.QueryRowContext(ctx, lookupOrganizationRole, name, organizationID)
+
+	role, err := s.scanOrganizationRole(roleRow)
+	if err == sql.ErrNoRows {
+		return nil, store.ErrOrganizationRoleNotFound
+	} else if err != nil {
+		return nil, err
+	}
+
+	return role, nil
+}
+
+func (s *Store) ListOrganizationRoles(ctx context.Context, organizationID string) ([]models.OrganizationRole, error) {
+	roleRows, err := s.db.QueryContext(ctx, listOrganizationRoles, organizationID)
 	if err != nil {
-		return nil, errors.Wrap(err, "query membership role bindings")
+		return nil, errors.Wrap(err, "query organization roles")
 	}
-	defer membershipRoleBindingRows.Close()
+	defer roleRows.Close()
 
-	membershipRoleBindings := make([]models.MembershipRoleBinding, 0)
-	for membershipRoleBindingRows.Next() {
-		membershipRoleBinding, err := s.scanMembershipRoleBinding(membershipRoleBindingRows)
+	roles := make([]models.OrganizationRole, 0)
+	for roleRows.Next() {
+		role, err := s.scanOrganizationRole(roleRows)
 		if err != nil {
 			return nil, err
 		}
-		membershipRoleBindings = append(membershipRoleBindings, *membershipRoleBinding)
+		roles = append(roles, *role)
 	}
 
-	if err := membershipRoleBindingRows.Err(); err != nil {
+	if err := roleRows.Err(); err != nil {
 		return nil, err
 	}
 
-	return membershipRoleBindings, nil
+	return roles, nil
 }
 
-func (s *Store) DeleteMembershipRoleBinding(ctx context.Context, userID, roleID, projectID string) error {
+func (s *Store) UpdateOrganizationRole(ctx context.Context, id, organizationID, name, description, config string) (*models.OrganizationRole, error) {
+	if _, err := s.db.ExecContext(
+		ctx,
+		updateOrganizationRole,
+		name,
+		description,
+		config,
+		id,
+		organizationID,
+	); err != nil {
+		return nil, err
+	}
+
+	return s.GetOrganizationRole(ctx, id, organizationID)
+}
+
+func (s *Store) DeleteOrganizationRole(ctx context.Context, id, organizationID string) error {
 	_, err := s.db.ExecContext(
 		ctx,
-		deleteMembershipRoleBinding,
-		userID,
-		roleID,
-		projectID,
+		deleteOrganizationRole,
+		id,
+		organizationID,
 	)
 	return err
 }
 
-func (s *Store) scanMembershipRoleBinding(scanner scanner) (*models.MembershipRoleBinding, error) {
-	var membershipRoleBinding models.MembershipRoleBinding
+func (s *Store) scanOrganizationRole(scanner scanner) (*models.OrganizationRole, error) {
+	var role models.OrganizationRole
 	if err := scanner.Scan(
-		&membershipRoleBinding.UserID,
-		&membershipRoleBinding.RoleID,
-		&membershipRoleBinding.CreatedAt,
-		&membershipRoleBinding.ProjectID,
+		&role.ID,
+		&role.CreatedAt,
+		&role.OrganizationID,
+		&role.Name,
+		&role.Description,
+		&role.Config,
 	); err != nil {
 		return nil, err
 	}
-	return &membershipRoleBinding, nil
+	return &role, nil
 }
 
-func (s *Store) CreateServiceAccount(ctx context.Context, projectID, name, description string) (*models.ServiceAccount, error) {
-	id := newServiceAccountID()
-
+func (s *Store) CreateOrganizationMembershipRoleBinding(ctx context.Context, userID, roleID, organizationID string) (*models.OrganizationMembershipRoleBinding, error) {
 	if _, err := s.db.ExecContext(
 		ctx,
-		createServiceAccount,
-		id,
-		projectID,
-		name,
-		description,
+		createOrganizationMembershipRoleBinding,
+		userID,
+		roleID,
+		organizationID,
 	); err != nil {
 		return nil, err
 	}
 
-	return s.GetServiceAccount(ctx, id, projectID)
-}
-
-func (s *Store) GetServiceAccount(ctx context.Context, id, projectID string) (*models.ServiceAccount, error) {
-	serviceAccountRow := s.db.QueryRowContext(ctx, getServiceAccount, id, projectID)
-
-	serviceAccount, err := s.scanServiceAccount(serviceAccountRow)
-	if err == sql.ErrNoRows {
-		return nil, store.ErrServiceAccountNotFound
-	} else if err != nil {
-		return nil, err
-	}
-
-	return serviceAccount, nil
+	return s.GetOrganizationMembershipRoleBinding(ctx, userID, roleID, organizationID)
 }
 
-func (s *Store) LookupServiceAccount(ctx context.Context, name, projectID string) (*models.ServiceAccount, error) {
-	serviceAccountRow := s.db.QueryRowContext(ctx, lookupServiceAccount, name, projectID)
+func (s *Store) GetOrganizationMembershipRoleBinding(ctx context.Context, userID, roleID, organizationID string) (*models.OrganizationMembershipRoleBinding, error) {
+	roleBindingRow := s.db.QueryRowContext(ctx, getOrganizationMembershipRoleBinding, userID, roleID, organizationID)
 
-	serviceAccount, err := s.scanServiceAccount(serviceAccountRow)
+	roleBinding, err := s.scanOrganizationMembershipRoleBinding(roleBindingRow)
 	if err == sql.ErrNoRows {
-		return nil, store.ErrServiceAccountNotFound
+		return nil, store.ErrOrganizationMembershipRoleBindingNotFound
 	} else if err != nil {
 		return nil, err
 	}
 
-	return serviceAccount, nil
+	return roleBinding, nil
 }
 
-func (s *Store) ListServiceAccounts(ctx context.Context, projectID string) ([]models.ServiceAccount, error) {
-	serviceAccountRows, err := s.db.QueryContext(ctx, listServiceAccounts, projectID)
+func (s *Store) ListOrganizationMembershipRoleBindings(ctx context.Context, userID, organizationID string) ([]models.OrganizationMembershipRoleBinding, error) {
+	roleBindingRows, err := s.db.QueryContext(ctx, listOrganizationMembershipRoleBindings, userID, organizationID)
 	if err != nil {
-		return nil, errors.Wrap(err, "query service accounts")
+		return nil, errors.Wrap(err, "query organization membership role bindings")
 	}
-	defer serviceAccountRows.Close()
+	defer roleBindingRows.Close()
 
-	serviceAccounts := make([]models.ServiceAccount, 0)
-	for serviceAccountRows.Next() {
-		serviceAccount, err := s.scanServiceAccount(serviceAccountRows)
+	roleBindings := make([]models.OrganizationMembershipRoleBinding, 0)
+	for roleBindingRows.Next() {
+		roleBinding, err := s.scanOrganizationMembershipRoleBinding(roleBindingRows)
 		if err != nil {
 			return nil, err
 		}
-		serviceAccounts = append(serviceAccounts, *serviceAccount)
-	}
-
-	if err := serviceAccountRows.Err(); err != nil {
-		return nil, err
+		roleBindings = append(roleBindings, *roleBinding)
 	}
 
-	return serviceAccounts, nil
-}
-
-func (s *Store) UpdateServiceAccount(ctx context.Context, id, projectID, name, description string) (*models.ServiceAccount, error) {
-	if _, err := s.db.ExecContext(
-		ctx,
-		updateServiceAccount,
-		name,
-		description,
-		id,
-		projectID,
-	); err != nil {
+	if err := roleBindingRows.Err(); err != nil {
 		return nil, err
 	}
 
-	return s.GetServiceAccount(ctx, id, projectID)
+	return roleBindings, nil
 }
 
-func (s *Store) DeleteServiceAccount(ctx context.Context, id, projectID string) error {
+func (s *Store) DeleteOrganizationMembershipRoleBinding(ctx context.Context, userID, roleID, organizationID string) error {
 	_, err := s.db.ExecContext(
 		ctx,
-		deleteServiceAccount,
-		id,
-		projectID,
+		deleteOrganizationMembershipRoleBinding,
+		userID,
+		roleID,
+		organizationID,
 	)
 	return err
 }
 
-func (s *Store) scanServiceAccount(scanner scanner) (*models.ServiceAccount, error) {
-	var serviceAccount models.ServiceAccount
+func (s *Store) scanOrganizationMembershipRoleBinding(scanner scanner) (*models.OrganizationMembershipRoleBinding, error) {
+	var roleBinding models.OrganizationMembershipRoleBinding
 	if err := scanner.Scan(
-		&serviceAccount.ID,
-		&serviceAccount.CreatedAt,
-		&serviceAccount.ProjectID,
-		&serviceAccount.Name,
-		&serviceAccount.Description,
+		&roleBinding.UserID,
+		&roleBinding.RoleID,
+		&roleBinding.CreatedAt,
+		&roleBinding.OrganizationID,
 	); err != nil {
 		return nil, err
 	}
-	return &serviceAccount, nil
+	return &roleBinding, nil
 }
 
-func (s *Store) CreateServiceAccountAccessKey(ctx context.Context, projectID, serviceAccountID, hash, description string) (*models.ServiceAccountAccessKey, error) {
-	id := newServiceAccountAccessKeyID()
+func (s *Store) CreateProject(ctx context.Context, name string, organizationID *string) (*models.Project, error) {
+	id := newProjectID()
 
 	if _, err := s.db.ExecContext(
 		ctx,
-		createServiceAccountAccessKey,
+		createProject,
 		id,
-		projectID,
-		serviceAccountID,
-		hash,
-		description,
+		organizationID,
+		name,
 	); err != nil {
 		return nil, err
 	}
 
-	return s.GetServiceAccountAccessKey(ctx, id, projectID)
+	return s.GetProject(ctx, id)
 }
 
-func (s *Store) GetServiceAccountAccessKey(ctx context.Context, id, projectID string) (*models.ServiceAccountAccessKey, error) {
-	serviceAccountAccessKeyRow := s.db.QueryRowContext(ctx, getServiceAccountAccessKey, id, projectID)
+func (s *Store) GetProject(ctx context.Context, id string) (*models.Project, error) {
+	projectRow := s.db.QueryRowContext(ctx, getProject, id)
 
-	serviceAccountAccessKey, err := s.scanServiceAccountAccessKey(serviceAccountAccessKeyRow)
+	project, err := s.scanProject(projectRow)
 	if err == sql.ErrNoRows {
-		return nil, store.ErrServiceAccountAccessKeyNotFound
+		return nil, store.ErrProjectNotFound
 	} else if err != nil {
 		return nil, err
 	}
 
-	return serviceAccountAccessKey, nil
+	return project, nil
 }
 
-func (s *Store) ValidateServiceAccountAccessKey(ctx context.Context, hash string) (*models.ServiceAccountAccessKey, error) {
-	serviceAccountAccessKeyRow := s.db.QueryRowContext(ctx, validateServiceAccountAccessKey, hash)
+func (s *Store) LookupProject(ctx context.Context, name string) (*models.Project, error) {
+	projectRow := s.db.QueryRowContext(ctx, lookupProject, name)
 
-	serviceAccountAccessKey, err := s.scanServiceAccountAccessKey(serviceAccountAccessKeyRow)
+	project, err := s.scanProject(projectRow)
 	if err == sql.ErrNoRows {
-		return nil, store.ErrServiceAccountAccessKeyNotFound
+		return nil, store.ErrProjectNotFound
 	} else if err != nil {
 		return nil, err
 	}
 
-	return serviceAccountAccessKey, nil
+	return project, nil
 }
 
-func (s *Store) ListServiceAccountAccessKeys(ctx context.Context, projectID, serviceAccountID string) ([]models.ServiceAccountAccessKey, error) {
-	serviceAccountAccessKeyRows, err := s.db.QueryContext(ctx, listServiceAccountAccessKeys, projectID, serviceAccountID)
+func (s *Store) ListProjects(ctx context.Context) ([]models.Project, error) {
+	return s.listProjects(ctx, listProjects)
+}
+
+func (s *Store) ListProjectsByOrganization(ctx context.Context, organizationID string) ([]models.Project, error) {
+	return s.listProjects(ctx, listProjectsByOrganization, organizationID)
+}
+
+func (s *Store) listProjects(ctx context.Context, query string, args ...interface{}) ([]models.Project, error) {
+	projectRows, err := s.db.QueryContext(ctx, query, args...)
 	if err != nil {
-		return nil, errors.Wrap(err, "query service account access keys")
+		return nil, errors.Wrap(err, "query projects")
 	}
-	defer serviceAccountAccessKeyRows.Close()
+	defer projectRows.Close()
 
-	serviceAccountAccessKeys := make([]models.ServiceAccountAccessKey, 0)
-	for serviceAccountAccessKeyRows.Next() {
-		serviceAccountAccessKey, err := s.scanServiceAccountAccessKey(serviceAccountAccessKeyRows)
+	projects := make([]models.Project, 0)
+	for projectRows.Next() {
+		project, err := s.scanProject(projectRows)
 		if err != nil {
 			return nil, err
 		}
-		serviceAccountAccessKeys = append(serviceAccountAccessKeys, *serviceAccountAccessKey)
+		projects = append(projects, *project)
 	}
 
-	if err := serviceAccountAccessKeyRows.Err(); err != nil {
+	if err := projectRows.Err(); err != nil {
 		return nil, err
 	}
 
-	return serviceAccountAccessKeys, nil
+	return projects, nil
 }
 
-func (s *Store) DeleteServiceAccountAccessKey(ctx context.Context, id, projectID string) error {
+func (s *Store) UpdateProject(ctx context.Context, id, name, datadogApiKey string) (*models.Project, error) {
+	if _, err := s.db.ExecContext(
+		ctx,
+		updateProject,
+		name,
+		datadogApiKey,
+		id,
+	); err != nil {
+		return nil, err
+	}
+
+	return s.GetProject(ctx, id)
+}
+
+func (s *Store) DeleteProject(ctx context.Context, id string) error {
 	_, err := s.db.ExecContext(
 		ctx,
-		deleteServiceAccountAccessKey,
+		deleteProject,
 		id,
-		projectID,
 	)
 	return err
 }
 
-func (s *Store) scanServiceAccountAccessKey(scanner scanner) (*models.ServiceAccountAccessKey, error) {
-	var serviceAccountAccessKey models.ServiceAccountAccessKey
+func (s *Store) scanProject(scanner scanner) (*models.Project, error) {
+	var project models.Project
 	if err := scanner.Scan(
-		&serviceAccountAccessKey.ID,
-		&serviceAccountAccessKey.CreatedAt,
-		&serviceAccountAccessKey.ProjectID,
-		&serviceAccountAccessKey.ServiceAccountID,
-		&serviceAccountAccessKey.Description,
+		&project.ID,
+		&project.CreatedAt,
+		&project.OrganizationID,
+		&project.Name,
+		&project.DatadogAPIKey,
 	); err != nil {
 		return nil, err
 	}
-	return &serviceAccountAccessKey, nil
+	return &project, nil
 }
 
-func (s *Store) CreateServiceAccountRoleBinding(ctx context.Context, serviceAccountID, roleID, projectID string) (*models.ServiceAccountRoleBinding, error) {
-	if _, err := s.db.ExecContext(
-		ctx,
-		createServiceAccountRoleBinding,
-		serviceAccountID,
-		roleID,
-		projectID,
-	); err != nil {
+func (s *Store) GetProjectDeviceCounts(ctx context.Context, projectID string) (*models.ProjectDeviceCounts, error) {
+	countRow := s.db.QueryRowContext(ctx, getProjectDeviceCounts, projectID)
+
+	count, err := s.scanProjectDeviceCountRow(countRow)
+	if err != nil {
 		return nil, err
 	}
 
-	return s.GetServiceAccountRoleBinding(ctx, serviceAccountID, roleID, projectID)
-}
-
-func (s *Store) GetServiceAccountRoleBinding(ctx context.Context, serviceAccountID, roleID, projectID string) (*models.ServiceAccountRoleBinding, error) {
-	serviceAccountRoleBindingRow := s.db.QueryRowContext(ctx, getServiceAccountRoleBinding, serviceAccountID, roleID, projectID)
-
-	serviceAccountRoleBinding, err := s.scanServiceAccountRoleBinding(serviceAccountRoleBindingRow)
-	if err == sql.ErrNoRows {
-		return nil, store.ErrServiceAccountRoleBindingNotFound
-	} else if err != nil {
-		return nil, err
-	}
-
-	return serviceAccountRoleBinding, nil
+	return &models.ProjectDeviceCounts{
+		AllCount: count,
+	}, nil
 }
 
-func (s *Store) ListServiceAccountRoleBindings(ctx context.Context, serviceAccountID, projectID string) ([]models.ServiceAccountRoleBinding, error) {
-	serviceAccountRoleBindingRows, err := s.db.QueryContext(ctx, listServiceAccountRoleBindings, serviceAccountID, projectID)
-	if err != nil {
-		return nil, errors.Wrap(err, "query service account role bindings")
+func (s *Store) scanProjectDeviceCountRow(scanner scanner) (int, error) {
+	var count int
+	if err := scanner.Scan(
+		&count,
+	); err != nil {
+		return 0, err
 	}
-	defer serviceAccountRoleBindingRows.Close()
+	return count, nil
+}
 
-	serviceAccountRoleBindings := make([]models.ServiceAccountRoleBinding, 0)
-	for serviceAccountRoleBindingRows.Next() {
-		serviceAccountRoleBinding, err := s.scanServiceAccountRoleBinding(serviceAccountRoleBindingRows)
-		if err != nil {
-			return nil, err
-		}
-		serviceAccountRoleBindings = append(serviceAccountRoleBindings, *serviceAccountRoleBinding)
-	}
+func (s *Store) GetProjectApplicationCounts(ctx context.Context, projectID string) (*models.ProjectApplicationCounts, error) {
+	countRow := s.db.QueryRowContext(ctx, getProjectApplicationCounts, projectID)
 
-	if err := serviceAccountRoleBindingRows.Err(); err != nil {
+	count, err := s.scanProjectApplicationCountRow(countRow)
+	if err != nil {
 		return nil, err
 	}
 
-	return serviceAccountRoleBindings, nil
-}
-
-func (s *Store) DeleteServiceAccountRoleBinding(ctx context.Context, serviceAccountID, roleID, projectID string) error {
-	_, err := s.db.ExecContext(
-		ctx,
-		deleteServiceAccountRoleBinding,
-		serviceAccountID,
-		roleID,
-		projectID,
-	)
-	return err
+	return &models.ProjectApplicationCounts{
+		AllCount: count,
+	}, nil
 }
 
-func (s *Store) scanServiceAccountRoleBinding(scanner scanner) (*models.ServiceAccountRoleBinding, error) {
-	var serviceAccountRoleBinding models.ServiceAccountRoleBinding
+func (s *Store) scanProjectApplicationCountRow(scanner scanner) (int, error) {
+	var count int
 	if err := scanner.Scan(
-		&serviceAccountRoleBinding.ServiceAccountID,
-		&serviceAccountRoleBinding.RoleID,
-		&serviceAccountRoleBinding.CreatedAt,
-		&serviceAccountRoleBinding.ProjectID,
+		&count,
 	); err != nil {
-		return nil, err
+		return 0, err
 	}
-	return &serviceAccountRoleBinding, nil
+	return count, nil
 }
 
-func (s *Store) CreateDevice(ctx context.Context, projectID, name, deviceRegistrationTokenID string, deviceLabels, environmentVariables map[string]string) (*models.Device, error) {
-	deviceID := newDeviceID()
-
-	serializedDeviceLabels, err := json.Marshal(deviceLabels)
-	if err != nil {
-		return nil, err
-	}
-
-	serializedDeviceEnvironmentVariables, err := json.Marshal(environmentVariables)
-	if err != nil {
-		return nil, err
-	}
+func (s *Store) CreateRole(ctx context.Context, projectID, name, description, config string) (*models.Role, error) {
+	id := newRoleID()
 
 	if _, err := s.db.ExecContext(
 		ctx,
-		createDevice,
-		deviceID,
+		createRole,
+		id,
 		projectID,
 		name,
-		deviceRegistrationTokenID,
-		string(serializedDeviceLabels),
-		string(serializedDeviceEnvironmentVariables),
+		description,
+		config,
 	); err != nil {
 		return nil, err
 	}
 
-	return s.GetDevice(ctx, deviceID, projectID)
+	return s.GetRole(ctx, id, projectID)
 }
 
-func (s *Store) GetDevice(ctx context.Context, id, projectID string) (*models.Device, error) {
-	deviceRow := s.db.QueryRowContext(ctx, getDevice, id, projectID)
+func (s *Store) GetRole(ctx context.Context, id, projectID string) (*models.Role, error) {
+	roleRow := s.db.QueryRowContext(ctx, getRole, id, projectID)
 
-	device, err := s.scanDevice(deviceRow)
+	role, err := s.scanRole(roleRow)
 	if err == sql.ErrNoRows {
-		return nil, store.ErrDeviceNotFound
+		return nil, store.ErrRoleNotFound
 	} else if err != nil {
 		return nil, err
 	}
 
-	return device, nil
+	return role, nil
 }
 
-func (s *Store) LookupDevice(ctx context.Context, name, projectID string) (*models.Device, error) {
-	deviceRow := s.db.QueryRowContext(ctx, lookupDevice, name, projectID)
+func (s *Store) LookupRole(ctx context.Context, name, projectID string) (*models.Role, error) {
+	roleRow := s.db.QueryRowContext(ctx, lookupRole, name, projectID)
 
-	device, err := s.scanDevice(deviceRow)
+	role, err := s.scanRole(roleRow)
 	if err == sql.ErrNoRows {
-		return nil, store.ErrDeviceNotFound
+		return nil, store.ErrRoleNotFound
 	} else if err != nil {
 		return nil, err
 	}
 
-	return device, nil
+	return role, nil
 }
 
-func (s *Store) ListDevices(ctx context.Context, projectID, searchQuery string) ([]models.Device, error) {
-	var deviceRows *sql.Rows
-	var err error
-	if searchQuery == "" {
-		deviceRows, err = s.db.QueryContext(ctx, listDevices, projectID)
-	} else {
-		deviceRows, err = s.db.QueryContext(ctx, searchDevices, projectID, searchQuery)
-	}
+func (s *Store) ListRoles(ctx context.Context, projectID string) ([]models.Role, error) {
+	roleRows, err := s.db.QueryContext(ctx, listRoles, projectID)
 	if err != nil {
-		return nil, err
+		return nil, errors.Wrap(err, "query roles")
 	}
-	defer deviceRows.Close()
+	defer roleRows.Close()
 
-	devices := make([]models.Device, 0)
-	for deviceRows.Next() {
-		device, err := s.scanDevice(deviceRows)
+	roles := make([]models.Role, 0)
+	for roleRows.Next() {
+		role, err := s.scanRole(roleRows)
 		if err != nil {
 			return nil, err
 		}
-		devices = append(devices, *device)
+		roles = append(roles, *role)
 	}
 
-	if err := deviceRows.Err(); err != nil {
+	if err := roleRows.Err(); err != nil {
 		return nil, err
 	}
 
-	return devices, nil
+	return roles, nil
 }
 
-func (s *Store) UpdateDeviceName(ctx context.Context, id, projectID, name string) (*models.Device, error) {
+func (s *Store) UpdateRole(ctx context.Context, id, projectID, name, description, config string) (*models.Role, error) {
 	if _, err := s.db.ExecContext(
 		ctx,
-		updateDeviceName,
+		updateRole,
 		name,
+		description,
+		config,
 		id,
 		projectID,
 	); err != nil {
 		return nil, err
 	}
 
-	return s.GetDevice(ctx, id, projectID)
+	return s.GetRole(ctx, id, projectID)
 }
 
-func (s *Store) SetDeviceInfo(ctx context.Context, id, projectID string, deviceInfo models.DeviceInfo) (*models.Device, error) {
-	infoBytes, err := json.Marshal(deviceInfo)
-	if err != nil {
-		return nil, err
-	}
-
-	if _, err := s.db.ExecContext(
+func (s *Store) DeleteRole(ctx context.Context, id, projectID string) error {
+	_, err := s.db.ExecContext(
 		ctx,
-		setDeviceInfo,
-		string(infoBytes),
+		deleteRole,
 		id,
 		projectID,
+	)
+	return err
+}
+
+func (s *Store) scanRole(scanner scanner) (*models.Role, error) {
+	var role models.Role
+	if err := scanner.Scan(
+		&role.ID,
+		&role.CreatedAt,
+		&role.ProjectID,
+		&role.Name,
+		&role.Description,
+		&role.Config,
 	); err != nil {
 		return nil, err
 	}
-
-	return s.GetDevice(ctx, id, projectID)
+	return &role, nil
 }
 
-func (s *Store) UpdateDeviceLastSeenAt(ctx context.Context, projectID, deviceID string) error {
+func (s *Store) CreateMembership(ctx context.Context, userID, projectID string) (*models.Membership, error) {
 	if _, err := s.db.ExecContext(
 		ctx,
-		updateDeviceLastSeenAt,
+		createMembership,
+		userID,
 		projectID,
-		deviceID,
 	); err != nil {
-		return err
+		return nil, err
 	}
 
-	return nil
+	return s.GetMembership(ctx, userID, projectID)
 }
 
-func (s *Store) DeleteDevice(ctx context.Context, id, projectID string) error {
-	_, err := s.db.ExecContext(
-		ctx,
-		deleteDevice,
-		id,
-		projectID,
-	)
-	return err
-}
+func (s *Store) GetMembership(ctx context.Context, userID, projectID string) (*models.Membership, error) {
+	membershipRow := s.db.QueryRowContext(ctx, getMembership, userID, projectID)
 
-func (s *Store) scanDevice(scanner scanner) (*models.Device, error) {
-	var device models.Device
-	var infoString string
-	var labelsString string
-	var environmentVariablesString string
-	if err := scanner.Scan(
-		&device.ID,
-		&device.CreatedAt,
-		&device.ProjectID,
-		&device.Name,
-		&device.RegistrationTokenID,
-		&device.DesiredAgentVersion,
-		&infoString,
-		&labelsString,
-		&environmentVariablesString,
-		&device.LastSeenAt,
-	); err != nil {
+	membership, err := s.scanMembership(membershipRow)
+	if err == sql.ErrNoRows {
+		return nil, store.ErrMembershipNotFound
+	} else if err != nil {
 		return nil, err
 	}
 
-	if infoString != "" {
-		if err := json.Unmarshal([]byte(infoString), &device.Info); err != nil {
-			return nil, err
-		}
+	return membership, nil
+}
+
+func (s *Store) ListMembershipsByUser(ctx context.Context, userID string) ([]models.Membership, error) {
+	return s.listMemberships(ctx, userID, listMembershipsByUser)
+}
+
+func (s *Store) ListMembershipsByProject(ctx context.Context, projectID string) ([]models.Membership, error) {
+	return s.listMemberships(ctx, projectID, listMembershipsByProject)
+}
+
+func (s *Store) listMemberships(ctx context.Context, id, query string) ([]models.Membership, error) {
+	membershipRows, err := s.db.QueryContext(ctx, query, id)
+	if err != nil {
+		return nil, errors.Wrap(err, "query memberships")
 	}
+	defer membershipRows.Close()
 
-	if labelsString == "" {
-		device.Labels = map[string]string{}
-	} else {
-		if err := json.Unmarshal([]byte(labelsString), &device.Labels); err != nil {
+	memberships := make([]models.Membership, 0)
+	for membershipRows.Next() {
+		membership, err := s.scanMembership(membershipRows)
+		if err != nil {
 			return nil, err
 		}
+		memberships = append(memberships, *membership)
 	}
 
-	if environmentVariablesString == "" {
-		device.EnvironmentVariables = map[string]string{}
-	} else {
-		if err := json.Unmarshal([]byte(environmentVariablesString), &device.EnvironmentVariables); err != nil {
-			return nil, err
-		}
+	if err := membershipRows.Err(); err != nil {
+		return nil, err
 	}
 
-	if time.Now().After(device.LastSeenAt.Add(2 * time.Minute)) {
-		device.Status = models.DeviceStatusOffline
-	} else {
-		device.Status = models.DeviceStatusOnline
-	}
+	return memberships, nil
+}
 
-	return &device, nil
+func (s *Store) DeleteMembership(ctx context.Context, userID, projectID string) error {
+	_, err := s.db.ExecContext(
+		ctx,
+		deleteMembership,
+		userID,
+		projectID,
+	)
+	return err
 }
 
-func (s *Store) scanDeviceLabels(scanner scanner) (map[string]string, error) {
-	var labelsString string
+func (s *Store) scanMembership(scanner scanner) (*models.Membership, error) {
+	var membership models.Membership
 	if err := scanner.Scan(
-		&labelsString,
+		&membership.UserID,
+		&membership.ProjectID,
+		&membership.CreatedAt,
 	); err != nil {
 		return nil, err
 	}
+	return &membership, nil
+}
 
-	var labels map[string]string
-	if labelsString == "" {
-		labels = map[string]string{}
-	} else {
-		if err := json.Unmarshal([]byte(labelsString), &labels); err != nil {
-			return nil, err
-		}
+func (s *Store) CreateMembershipRoleBinding(ctx context.Context, userID, roleID, projectID string) (*models.MembershipRoleBinding, error) {
+	if _, err := s.db.ExecContext(
+		ctx,
+		createMembershipRoleBinding,
+		userID,
+		roleID,
+		projectID,
+	); err != nil {
+		return nil, err
 	}
 
-	return labels, nil
+	return s.GetMembershipRoleBinding(ctx, userID, roleID, projectID)
 }
 
-func (s *Store) ListAllDeviceLabelKeys(ctx context.Context, projectID string) ([]string, error) {
-	rows, err := s.db.QueryContext(
-		ctx,
-		listAllDeviceLabels,
-		projectID,
-	)
+func (s *Store) GetMembershipRoleBinding(ctx context.Context, userID, roleID, projectID string) (*models.MembershipRoleBinding, error) {
+	membershipRoleBindingRow := s.db.QueryRowContext(ctx, getMembershipRoleBinding, userID, roleID, projectID)
+
+	membershipRoleBinding, err := s.scanMembershipRoleBinding(membershipRoleBindingRow)
+	if err == sql.ErrNoRows {
+		return nil, store.ErrMembershipRoleBindingNotFound
+	} else if err != nil {
+		return nil, err
+	}
+
+	return membershipRoleBinding, nil
+}
+
+func (s *Store) ListMembershipRoleBindings(ctx context.Context, userID, projectID string) ([]models.MembershipRoleBinding, error) {
+	membershipRoleBindingRows, err := s.db.QueryContext(ctx, listMembershipRoleBindings, userID, projectID)
 	if err != nil {
-		return nil, errors.Wrap(err, "query device labels")
+		return nil, errors.Wrap(err, "query membership role bindings")
 	}
-	defer rows.Close()
+	defer membershipRoleBindingRows.Close()
 
-	allDeviceLabels := make(map[string]bool)
-	for rows.Next() {
-		deviceLabels, err := s.scanDeviceLabels(rows)
+	membershipRoleBindings := make([]models.MembershipRoleBinding, 0)
+	for membershipRoleBindingRows.Next() {
+		membershipRoleBinding, err := s.scanMembershipRoleBinding(membershipRoleBindingRows)
 		if err != nil {
 			return nil, err
 		}
-		for k := range deviceLabels {
-			allDeviceLabels[k] = true
-		}
+		membershipRoleBindings = append(membershipRoleBindings, *membershipRoleBinding)
 	}
 
-	if err := rows.Err(); err != nil {
+	if err := membershipRoleBindingRows.Err(); err != nil {
 		return nil, err
 	}
 
-	allDeviceLabelKeys := make([]string, len(allDeviceLabels))
-	i := 0
-	for k := range allDeviceLabels {
-		allDeviceLabelKeys[i] = k
-		i++
-	}
-
-	return allDeviceLabelKeys, nil
+	return membershipRoleBindings, nil
+}
 
+func (s *Store) DeleteMembershipRoleBinding(ctx context.Context, userID, roleID, projectID string) error {
+	_, err := s.db.ExecContext(
+		ctx,
+		deleteMembershipRoleBinding,
+		userID,
+		roleID,
+		projectID,
+	)
+	return err
 }
 
-func (s *Store) SetDeviceLabel(ctx context.Context, deviceID, projectID, key, value string) (*string, error) {
-	device, err := s.GetDevice(ctx, deviceID, projectID)
-	if err != nil {
+func (s *Store) scanMembershipRoleBinding(scanner scanner) (*models.MembershipRoleBinding, error) {
+	var membershipRoleBinding models.MembershipRoleBinding
+	if err := scanner.Scan(
+		&membershipRoleBinding.UserID,
+		&membershipRoleBinding.RoleID,
+		&membershipRoleBinding.CreatedAt,
+		&membershipRoleBinding.ProjectID,
+	); err != nil {
 		return nil, err
 	}
+	return &membershipRoleBinding, nil
+}
 
-	device.Labels[key] = value
-
-	labelsString, err := json.Marshal(device.Labels)
-	if err != nil {
-		return nil, err
-	}
+func (s *Store) CreateSsoGroupMapping(ctx context.Context, projectID, group, roleID string) (*models.SsoGroupMapping, error) {
+	id := newSsoGroupMappingID()
 
 	if _, err := s.db.ExecContext(
 		ctx,
-		updateDeviceLabels,
-		labelsString,
-		deviceID,
+		createSsoGroupMapping,
+		id,
 		projectID,
+		group,
+		roleID,
 	); err != nil {
 		return nil, err
 	}
 
-	device, err = s.GetDevice(ctx, deviceID, projectID)
-	if err != nil {
-		return nil, err
-	}
-	v := device.Labels[key]
-	return &v, nil
+	return s.GetSsoGroupMapping(ctx, id, projectID)
 }
 
-func (s *Store) DeleteDeviceLabel(ctx context.Context, deviceID, projectID, key string) error {
-	device, err := s.GetDevice(ctx, deviceID, projectID)
-	if err != nil {
-		return err
+func (s *Store) GetSsoGroupMapping(ctx context.Context, id, projectID string) (*models.SsoGroupMapping, error) {
+	mappingRow := s.db.QueryRowContext(ctx, getSsoGroupMapping, id, projectID)
+
+	mapping, err := s.scanSsoGroupMapping(mappingRow)
+	if err == sql.ErrNoRows {
+		return nil, store.ErrSsoGroupMappingNotFound
+	} else if err != nil {
+		return nil, err
 	}
 
-	delete(device.Labels, key)
+	return mapping, nil
+}
 
-	labelsString, err := json.Marshal(device.Labels)
-	if err != nil {
-		return err
+func (s *Store) ListSsoGroupMappings(ctx context.Context, projectID string) ([]models.SsoGroupMapping, error) {
+	return s.listSsoGroupMappings(ctx, listSsoGroupMappings, projectID)
+}
+
+func (s *Store) ListSsoGroupMappingsByGroups(ctx context.Context, groups []string) ([]models.SsoGroupMapping, error) {
+	if len(groups) == 0 {
+		return make([]models.SsoGroupMapping, 0), nil
 	}
 
-	if _, err := s.db.ExecContext(
-		ctx,
-		updateDeviceLabels,
-		labelsString,
-		deviceID,
-		projectID,
-	); err != nil {
-		return err
+	placeholders := make([]string, len(groups))
+	args := make([]interface{}, len(groups))
+	for i, group := range groups {
+		placeholders[i] = "?"
+		args[i] = group
 	}
-	return nil
+
+	return s.listSsoGroupMappings(ctx,
+		fmt.Sprintf(listSsoGroupMappingsByGroups, strings.Join(placeholders, ", ")), args...)
 }
 
-func (s *Store) SetDeviceEnvironmentVariable(ctx context.Context, deviceID, projectID, key, value string) (*string, error) {
-	device, err := s.GetDevice(ctx, deviceID, projectID)
+func (s *Store) listSsoGroupMappings(ctx context.Context, query string, args ...interface{}) ([]models.SsoGroupMapping, error) {
+	mappingRows, err := s.db.QueryContext(ctx, query, args...)
 	if err != nil {
-		return nil, err
+		return nil, errors.Wrap(err, "query SSO group mappings")
 	}
+	defer mappingRows.Close()
 
-	device.EnvironmentVariables[key] = value
+	mappings := make([]models.SsoGroupMapping, 0)
+	for mappingRows.Next() {
+		mapping, err := s.scanSsoGroupMapping(mappingRows)
+		if err != nil {
+			return nil, err
+		}
+		mappings = append(mappings, *mapping)
+	}
 
-	environmentVariablesString, err := json.Marshal(device.EnvironmentVariables)
-	if err != nil {
+	if err := mappingRows.Err(); err != nil {
 		return nil, err
 	}
 
-	if _, err := s.db.ExecContext(
+	return mappings, nil
+}
+
+func (s *Store) DeleteSsoGroupMapping(ctx context.Context, id, projectID string) error {
+	_, err := s.db.ExecContext(
 		ctx,
-		updateDeviceEnvironmentVariables,
-		environmentVariablesString,
-		deviceID,
+		deleteSsoGroupMapping,
+		id,
 		projectID,
+	)
+	return err
+}
+
+func (s *Store) scanSsoGroupMapping(scanner scanner) (*models.SsoGroupMapping, error) {
+	var mapping models.SsoGroupMapping
+	if err := scanner.Scan(
+		&mapping.ID,
+		&mapping.CreatedAt,
+		&mapping.ProjectID,
+		&mapping.Group,
+		&mapping.RoleID,
 	); err != nil {
 		return nil, err
 	}
+	return &mapping, nil
+}
 
-	device, err = s.GetDevice(ctx, deviceID, projectID)
-	if err != nil {
-		return nil, err
-	}
-	v := device.EnvironmentVariables[key]
-	return &v, nil
+func (s *Store) CreateSsoManagedRoleBinding(ctx context.Context, userID, roleID, projectID string) error {
+	_, err := s.db.ExecContext(
+		ctx,
+		createSsoManagedRoleBinding,
+		userID,
+		roleID,
+		projectID,
+	)
+	return err
 }
 
-func (s *Store) DeleteDeviceEnvironmentVariable(ctx context.Context, deviceID, projectID, key string) error {
-	device, err := s.GetDevice(ctx, deviceID, projectID)
+func (s *Store) ListSsoManagedRoleBindingsByUser(ctx context.Context, userID string) ([]models.MembershipRoleBinding, error) {
+	roleBindingRows, err := s.db.QueryContext(ctx, listSsoManagedRoleBindingsByUser, userID)
 	if err != nil {
-		return err
+		return nil, errors.Wrap(err, "query SSO managed role bindings")
 	}
+	defer roleBindingRows.Close()
 
-	delete(device.EnvironmentVariables, key)
+	roleBindings := make([]models.MembershipRoleBinding, 0)
+	for roleBindingRows.Next() {
+		roleBinding, err := s.scanMembershipRoleBinding(roleBindingRows)
+		if err != nil {
+			return nil, err
+		}
+		roleBindings = append(roleBindings, *roleBinding)
+	}
 
-	environmentVariablesString, err := json.Marshal(device.EnvironmentVariables)
+	if err := roleBindingRows.Err(); err != nil {
+		return nil, err
+	}
+
+	return roleBindings, nil
+}
+
+func (s *Store) SetUserSsoGroups(ctx context.Context, userID string, groups []string) error {
+	tx, err := s.db.BeginTx(ctx, nil)
 	if err != nil {
 		return err
 	}
+	defer tx.Rollback()
 
-	if _, err := s.db.ExecContext(
+	if _, err := tx.ExecContext(
 		ctx,
-		updateDeviceEnvironmentVariables,
-		environmentVariablesString,
-		deviceID,
-		projectID,
+		deleteUserSsoGroups,
+		userID,
 	); err != nil {
 		return err
 	}
-	return nil
-}
 
-func (s *Store) CreateDeviceRegistrationToken(ctx context.Context, projectID, name, description string, maxRegistrations *int) (*models.DeviceRegistrationToken, error) {
-	id := newDeviceRegistrationTokenID()
+	if len(groups) > 0 {
+		placeholders := make([]string, len(groups))
+		args := make([]interface{}, 0, len(groups)*2)
+		for i, group := range groups {
+			placeholders[i] = "(?, ?)"
+			args = append(args, userID, group)
+		}
 
-	if _, err := s.db.ExecContext(
-		ctx,
-		createDeviceRegistrationToken,
-		id,
-		projectID,
-		name,
-		description,
-		maxRegistrations,
-	); err != nil {
-		return nil, err
+		if _, err := tx.ExecContext(ctx,
+			fmt.Sprintf(createUserSsoGroups, strings.Join(placeholders, ", ")), args...); err != nil {
+			return err
+		}
 	}
 
-	return s.GetDeviceRegistrationToken(ctx, id, projectID)
+	return tx.Commit()
 }
 
-func (s *Store) LookupDeviceRegistrationToken(ctx context.Context, name, projectID string) (*models.DeviceRegistrationToken, error) {
-	deviceRegistrationTokenRow := s.db.QueryRowContext(ctx, lookupDeviceRegistrationToken, name, projectID)
+func (s *Store) ListUserSsoGroups(ctx context.Context, userID string) ([]string, error) {
+	return s.listStrings(ctx, "SSO groups", listUserSsoGroups, userID)
+}
 
-	deviceRegistrationToken, err := s.scanDeviceRegistrationToken(deviceRegistrationTokenRow)
-	if err == sql.ErrNoRows {
-		return nil, store.ErrDeviceRegistrationTokenNotFound
-	} else if err != nil {
-		return nil, err
-	}
+func (s *Store) ListUsersBySsoGroup(ctx context.Context, group string) ([]string, error) {
+	return s.listStrings(ctx, "SSO group users", listUsersBySsoGroup, group)
+}
 
-	return deviceRegistrationToken, nil
+func (s *Store) ListUsersWithSsoGroupsSyncedBefore(ctx context.Context, before time.Time) ([]string, error) {
+	return s.listStrings(ctx, "SSO group users", listUsersWithSsoGroupsSyncedBefore, before)
 }
 
-func (s *Store) ListDeviceRegistrationTokens(ctx context.Context, projectID string) ([]models.DeviceRegistrationToken, error) {
-	tokenRows, err := s.db.QueryContext(ctx, listDeviceRegistrationTokens, projectID)
+// listStrings runs a query that selects a single string column.
+func (s *Store) listStrings(ctx context.Context, name, query string, args ...interface{}) ([]string, error) {
+	rows, err := s.db.QueryContext(ctx, query, args...)
 	if err != nil {
-		return nil, errors.Wrap(err, "query device registration tokens")
+		return nil, errors.Wrap(err, "query "+name)
 	}
-	defer tokenRows.Close()
+	defer rows.Close()
 
-	deviceRegistrationTokens := make([]models.DeviceRegistrationToken, 0)
-	for tokenRows.Next() {
-		deviceRegistrationToken, err := s.scanDeviceRegistrationToken(tokenRows)
-		if err != nil {
+	values := make([]string, 0)
+	for rows.Next() {
+		var value string
+		if err := rows.Scan(&value); err != nil {
 			return nil, err
 		}
-		deviceRegistrationTokens = append(deviceRegistrationTokens, *deviceRegistrationToken)
+		values = append(values, value)
 	}
 
-	if err := tokenRows.Err(); err != nil {
+	if err := rows.Err(); err != nil {
 		return nil, err
 	}
 
-	return deviceRegistrationTokens, nil
+	return values, nil
 }
 
-func (s *Store) GetDeviceRegistrationToken(ctx context.Context, id, projectID string) (*models.DeviceRegistrationToken, error) {
-	deviceRegistrationTokenRow := s.db.QueryRowContext(ctx, getDeviceRegistrationToken, id, projectID)
+func (s *Store) CreateServiceAccount(ctx context.Context, projectID, name, description string) (*models.ServiceAccount, error) {
+	id := newServiceAccountID()
 
-	deviceRegistrationToken, err := s.scanDeviceRegistrationToken(deviceRegistrationTokenRow)
+	if _, err := s.db.ExecContext(
+		ctx,
+		createServiceAccount,
+		id,
+		projectID,
+		name,
+		description,
+	); err != nil {
+		return nil, err
+	}
+
+	return s.GetServiceAccount(ctx, id, projectID)
+}
+
+func (s *Store) GetServiceAccount(ctx context.Context, id, projectID string) (*models.ServiceAccount, error) {
+	serviceAccountRow := s.db.QueryRowContext(ctx, getServiceAccount, id, projectID)
+
+	serviceAccount, err := s.scanServiceAccount(serviceAccountRow)
 	if err == sql.ErrNoRows {
-		return nil, store.ErrDeviceRegistrationTokenNotFound
+		return nil, store.ErrServiceAccountNotFound
 	} else if err != nil {
 		return nil, err
 	}
 
-	return deviceRegistrationToken, nil
+	return serviceAccount, nil
 }
 
-func (s *Store) UpdateDeviceRegistrationToken(ctx context.Context, id, projectID, name, description string, maxRegistrations *int) (*models.DeviceRegistrationToken, error) {
+func (s *Store) LookupServiceAccount(ctx context.Context, name, projectID string) (*models.ServiceAccount, error) {
+	serviceAccountRow := s.db.QueryRowContext(ctx, lookupServiceAccount, name, projectID)
+
+	serviceAccount, err := s.scanServiceAccount(serviceAccountRow)
+	if err == sql.ErrNoRows {
+		return nil, store.ErrServiceAccountNotFound
+	} else if err != nil {
+		return nil, err
+	}
+
+	return serviceAccount, nil
+}
+
+func (s *Store) ListServiceAccounts(ctx context.Context, projectID string) ([]models.ServiceAccount, error) {
+	serviceAccountRows, err := s.db.QueryContext(ctx, listServiceAccounts, projectID)
+	if err != nil {
+		return nil, errors.Wrap(err, "query service accounts")
+	}
+	defer serviceAccountRows.Close()
+
+	serviceAccounts := make([]models.ServiceAccount, 0)
+	for serviceAccountRows.Next() {
+		serviceAccount, err := s.scanServiceAccount(serviceAccountRows)
+		if err != nil {
+			return nil, err
+		}
+		serviceAccounts = append(serviceAccounts, *serviceAccount)
+	}
+
+	if err := serviceAccountRows.Err(); err != nil {
+		return nil, err
+	}
+
+	return serviceAccounts, nil
+}
+
+func (s *Store) UpdateServiceAccount(ctx context.Context, id, projectID, name, description string) (*models.ServiceAccount, error) {
 	if _, err := s.db.ExecContext(
 		ctx,
-		updateDeviceRegistrationToken,
+		updateServiceAccount,
 		name,
 		description,
-		maxRegistrations,
 		id,
 		projectID,
 	); err != nil {
 		return nil, err
 	}
 
-	return s.GetDeviceRegistrationToken(ctx, id, projectID)
+	return s.GetServiceAccount(ctx, id, projectID)
 }
 
-func (s *Store) DeleteDeviceRegistrationToken(ctx context.Context, id, projectID string) error {
+func (s *Store) DeleteServiceAccount(ctx context.Context, id, projectID string) error {
 	_, err := s.db.ExecContext(
 		ctx,
-		deleteDeviceRegistrationToken,
+		deleteServiceAccount,
 		id,
 		projectID,
 	)
 	return err
 }
 
-func (s *Store) SetDeviceRegistrationTokenLabel(ctx context.Context, deviceRegistrationTokenID, projectID, key, value string) (*string, error) {
-	deviceRegistrationToken, err := s.GetDeviceRegistrationToken(ctx, deviceRegistrationTokenID, projectID)
-	if err != nil {
+func (s *Store) scanServiceAccount(scanner scanner) (*models.ServiceAccount, error) {
+	var serviceAccount models.ServiceAccount
+	if err := scanner.Scan(
+		&serviceAccount.ID,
+		&serviceAccount.CreatedAt,
+		&serviceAccount.ProjectID,
+		&serviceAccount.Name,
+		&serviceAccount.Description,
+	); err != nil {
 		return nil, err
 	}
+	return &serviceAccount, nil
+}
 
-	deviceRegistrationToken.Labels[key] = value
-
-	labelsString, err := json.Marshal(deviceRegistrationToken.Labels)
-	if err != nil {
-		return nil, err
-	}
+func (s *Store) CreateServiceAccountAccessKey(ctx context.Context, projectID, serviceAccountID, hash, description string, expiresAt *time.Time, config *string) (*models.ServiceAccountAccessKey, error) {
+	id := newServiceAccountAccessKeyID()
 
 	if _, err := s.db.ExecContext(
 		ctx,
-		updateDeviceRegistrationTokenLabels,
-		labelsString,
-		deviceRegistrationTokenID,
+		createServiceAccountAccessKey,
+		id,
 		projectID,
+		serviceAccountID,
+		hash,
+		description,
+		expiresAt,
+		config,
 	); err != nil {
 		return nil, err
 	}
 
-	deviceRegistrationToken, err = s.GetDeviceRegistrationToken(ctx, deviceRegistrationTokenID, projectID)
-	if err != nil {
-		return nil, err
-	}
-	v := deviceRegistrationToken.Labels[key]
-	return &v, nil
+	return s.GetServiceAccountAccessKey(ctx, id, projectID)
 }
 
-func (s *Store) DeleteDeviceRegistrationTokenLabel(ctx context.Context, deviceRegistrationTokenID, projectID, key string) error {
-	deviceRegistrationToken, err := s.GetDeviceRegistrationToken(ctx, deviceRegistrationTokenID, projectID)
-	if err != nil {
-		return err
-	}
-
-	delete(deviceRegistrationToken.Labels, key)
+func (s *Store) GetServiceAccountAccessKey(ctx context.Context, id, projectID string) (*models.ServiceAccountAccessKey, error) {
+	serviceAccountAccessKeyRow := s.db.QueryRowContext(ctx, getServiceAccountAccessKey, id, projectID)
 
-	labelsString, err := json.Marshal(deviceRegistrationToken.Labels)
-	if err != nil {
-		return err
+	serviceAccountAccessKey, err := s.scanServiceAccountAccessKey(serviceAccountAccessKeyRow)
+	if err == sql.ErrNoRows {
+		return nil, store.ErrServiceAccountAccessKeyNotFound
+	} else if err != nil {
+		return nil, err
 	}
 
-	if _, err := s.db.ExecContext(
-		ctx,
-		updateDeviceRegistrationTokenLabels,
-		labelsString,
-		deviceRegistrationTokenID,
-		projectID,
-	); err != nil {
-		return err
-	}
-	return nil
+	return serviceAccountAccessKey, nil
 }
 
-func (s *Store) SetDeviceRegistrationTokenEnvironmentVariable(ctx context.Context, tokenID, projectID, key, value string) (*string, error) {
-	deviceRegistrationToken, err := s.GetDeviceRegistrationToken(ctx, tokenID, projectID)
-	if err != nil {
-		return nil, err
-	}
-
-	deviceRegistrationToken.EnvironmentVariables[key] = value
+func (s *Store) ValidateServiceAccountAccessKey(ctx context.Context, hash, ip string) (*models.ServiceAccountAccessKey, error) {
+	serviceAccountAccessKeyRow := s.db.QueryRowContext(ctx, validateServiceAccountAccessKey, hash)
 
-	environmentVariablesString, err := json.Marshal(deviceRegistrationToken.EnvironmentVariables)
-	if err != nil {
+	serviceAccountAccessKey, err := s.scanServiceAccountAccessKey(serviceAccountAccessKeyRow)
+	if err == sql.ErrNoRows {
+		return nil, store.ErrServiceAccountAccessKeyNotFound
+	} else if err != nil {
 		return nil, err
 	}
 
 	if _, err := s.db.ExecContext(
 		ctx,
-		updateDeviceRegistrationTokenEnvironmentVariables,
-		environmentVariablesString,
-		tokenID,
-		projectID,
+		updateServiceAccountAccessKeyLastUsed,
+		ip,
+		serviceAccountAccessKey.ID,
 	); err != nil {
 		return nil, err
 	}
 
-	deviceRegistrationToken, err = s.GetDeviceRegistrationToken(ctx, tokenID, projectID)
-	if err != nil {
-		return nil, err
-	}
-	v := deviceRegistrationToken.EnvironmentVariables[key]
-	return &v, nil
+	return s.GetServiceAccountAccessKey(ctx, serviceAccountAccessKey.ID, serviceAccountAccessKey.ProjectID)
 }
 
-func (s *Store) DeleteDeviceRegistrationTokenEnvironmentVariable(ctx context.Context, tokenID, projectID, key string) error {
-	deviceRegistrationToken, err := s.GetDeviceRegistrationToken(ctx, tokenID, projectID)
+func (s *Store) ListServiceAccountAccessKeys(ctx context.Context, projectID, serviceAccountID string) ([]models.ServiceAccountAccessKey, error) {
+	serviceAccountAccessKeyRows, err := s.db.QueryContext(ctx, listServiceAccountAccessKeys, projectID, serviceAccountID)
 	if err != nil {
-		return err
+		return nil, errors.Wrap(err, "query service account access keys")
 	}
+	defer serviceAccountAccessKeyRows.Close()
 
-	delete(deviceRegistrationToken.EnvironmentVariables, key)
+	serviceAccountAccessKeys := make([]models.ServiceAccountAccessKey, 0)
+	for serviceAccountAccessKeyRows.Next() {
+		serviceAccountAccessKey, err := s.scanServiceAccountAccessKey(serviceAccountAccessKeyRows)
+		if err != nil {
+			return nil, err
+		}
+		serviceAccountAccessKeys = append(serviceAccountAccessKeys, *serviceAccountAccessKey)
+	}
 
-	environmentVariablesString, err := json.Marshal(deviceRegistrationToken.EnvironmentVariables)
-	if err != nil {
-		return err
+	if err := serviceAccountAccessKeyRows.Err(); err != nil {
+		return nil, err
 	}
 
-	if _, err := s.db.ExecContext(
+	return serviceAccountAccessKeys, nil
+}
+
+func (s *Store) DeleteServiceAccountAccessKey(ctx context.Context, id, projectID string) error {
+	_, err := s.db.ExecContext(
 		ctx,
-		updateDeviceRegistrationTokenEnvironmentVariables,
-		environmentVariablesString,
-		tokenID,
+		deleteServiceAccountAccessKey,
+		id,
 		projectID,
-	); err != nil {
-		return err
-	}
-	return nil
+	)
+	return err
 }
 
-func (s *Store) scanDeviceRegistrationToken(scanner scanner) (*models.DeviceRegistrationToken, error) {
-	var deviceRegistrationToken models.DeviceRegistrationToken
-	var labelsString string
-	var environmentVariablesString string
+func (s *Store) scanServiceAccountAccessKey(scanner scanner) (*models.ServiceAccountAccessKey, error) {
+	var serviceAccountAccessKey models.ServiceAccountAccessKey
 	if err := scanner.Scan(
-		&deviceRegistrationToken.ID,
-		&deviceRegistrationToken.CreatedAt,
-		&deviceRegistrationToken.ProjectID,
-		&deviceRegistrationToken.MaxRegistrations,
-		&deviceRegistrationToken.Name,
-		&deviceRegistrationToken.Description,
-		&labelsString,
-		&environmentVariablesString,
+		&serviceAccountAccessKey.ID,
+		&serviceAccountAccessKey.CreatedAt,
+		&serviceAccountAccessKey.ProjectID,
+		&serviceAccountAccessKey.ServiceAccountID,
+		&serviceAccountAccessKey.Description,
+		&serviceAccountAccessKey.ExpiresAt,
+		&serviceAccountAccessKey.Config,
+		&serviceAccountAccessKey.LastUsedAt,
+		&serviceAccountAccessKey.LastUsedIP,
 	); err != nil {
 		return nil, err
 	}
+	return &serviceAccountAccessKey, nil
+}
 
-	if labelsString == "" {
-		deviceRegistrationToken.Labels = map[string]string{}
-	} else {
-		if err := json.Unmarshal([]byte(labelsString), &deviceRegistrationToken.Labels); err != nil {
-			return nil, err
-		}
-	}
-
-	if environmentVariablesString == "" {
-		deviceRegistrationToken.EnvironmentVariables = map[string]string{}
-	} else {
-		if err := json.Unmarshal([]byte(environmentVariablesString), &deviceRegistrationToken.EnvironmentVariables); err != nil {
-			return nil, err
-		}
+func (s *Store) CreateServiceAccountRoleBinding(ctx context.Context, serviceAccountID, roleID, projectID string) (*models.ServiceAccountRoleBinding, error) {
+	if _, err := s.db.ExecContext(
+		ctx,
+		createServiceAccountRoleBinding,
+		serviceAccountID,
+		roleID,
+		projectID,
+	); err != nil {
+		return nil, err
 	}
 
-	return &deviceRegistrationToken, nil
+	return s.GetServiceAccountRoleBinding(ctx, serviceAccountID, roleID, projectID)
 }
 
-func (s *Store) GetDevicesRegisteredWithTokenCount(ctx context.Context, tokenID, projectID string) (*models.DevicesRegisteredWithTokenCount, error) {
-	countRow := s.db.QueryRowContext(ctx, getDevicesRegisteredWithTokenCount, tokenID, projectID)
+func (s *Store) GetServiceAccountRoleBinding(ctx context.Context, serviceAccountID, roleID, projectID string) (*models.ServiceAccountRoleBinding, error) {
+	serviceAccountRoleBindingRow := s.db.QueryRowContext(ctx, getServiceAccountRoleBinding, serviceAccountID, roleID, projectID)
 
-	count, err := s.scanDevicesRegisteredCountRow(countRow)
+	serviceAccountRoleBinding, err := s.scanServiceAccountRoleBinding(serviceAccountRoleBindingRow)
 	if err == sql.ErrNoRows {
-		return nil, store.ErrDeviceRegistrationTokenNotFound
+		return nil, store.ErrServiceAccountRoleBindingNotFound
 	} else if err != nil {
 		return nil, err
 	}
 
-	return &models.DevicesRegisteredWithTokenCount{
-		AllCount: count,
-	}, nil
+	return serviceAccountRoleBinding, nil
 }
 
-func (s *Store) scanDevicesRegisteredCountRow(scanner scanner) (int, error) {
-	var count int
+func (s *Store) ListServiceAccountRoleBindings(ctx context.Context, serviceAccountID, projectID string) ([]models.ServiceAccountRoleBinding, error) {
+	serviceAccountRoleBindingRows, err := s.db.QueryContext(ctx, listServiceAccountRoleBindings, serviceAccountID, projectID)
+	if err != nil {
+		return nil, errors.Wrap(err, "query service account role bindings")
+	}
+	defer serviceAccountRoleBindingRows.Close()
+
+	serviceAccountRoleBindings := make([]models.ServiceAccountRoleBinding, 0)
+	for serviceAccountRoleBindingRows.Next() {
+		serviceAccountRoleBinding, err := s.scanServiceAccountRoleBinding(serviceAccountRoleBindingRows)
+		if err != nil {
+			return nil, err
+		}
+		serviceAccountRoleBindings = append(serviceAccountRoleBindings, *serviceAccountRoleBinding)
+	}
+
+	if err := serviceAccountRoleBindingRows.Err(); err != nil {
+		return nil, err
+	}
+
+	return serviceAccountRoleBindings, nil
+}
+
+func (s *Store) DeleteServiceAccountRoleBinding(ctx context.Context, serviceAccountID, roleID, projectID string) error {
+	_, err := s.db.ExecContext(
+		ctx,
+		deleteServiceAccountRoleBinding,
+		serviceAccountID,
+		roleID,
+		projectID,
+	)
+	return err
+}
+
+func (s *Store) scanServiceAccountRoleBinding(scanner scanner) (*models.ServiceAccountRoleBinding, error) {
+	var serviceAccountRoleBinding models.ServiceAccountRoleBinding
 	if err := scanner.Scan(
-		&count,
+		&serviceAccountRoleBinding.ServiceAccountID,
+		&serviceAccountRoleBinding.RoleID,
+		&serviceAccountRoleBinding.CreatedAt,
+		&serviceAccountRoleBinding.ProjectID,
 	); err != nil {
-		return 0, err
+		return nil, err
 	}
-	return count, nil
+	return &serviceAccountRoleBinding, nil
 }
 
-func (s *Store) CreateDeviceAccessKey(ctx context.Context, projectID, deviceID, hash string) (*models.DeviceAccessKey, error) {
-	id := newDeviceAccessKeyID()
+func (s *Store) CreateDevice(ctx context.Context, projectID, name, deviceRegistrationTokenID string, deviceLabels, environmentVariables map[string]string) (*models.Device, error) {
+	deviceID := newDeviceID()
+
+	serializedDeviceLabels, err := json.Marshal(deviceLabels)
+	if err != nil {
+		return nil, err
+	}
+
+	serializedDeviceEnvironmentVariables, err := json.Marshal(environmentVariables)
+	if err != nil {
+		return nil, err
+	}
 
 	if _, err := s.db.ExecContext(
 		ctx,
-		createDeviceAccessKey,
-		id,
-		projectID,
+		createDevice,
 		deviceID,
-		hash,
+		projectID,
+		name,
+		deviceRegistrationTokenID,
+		string(serializedDeviceLabels),
+		string(serializedDeviceEnvironmentVariables),
 	); err != nil {
 		return nil, err
 	}
 
-	return s.GetDeviceAccessKey(ctx, id, projectID)
+	return s.GetDevice(ctx, deviceID, projectID)
 }
 
-func (s *Store) GetDeviceAccessKey(ctx context.Context, id, projectID string) (*models.DeviceAccessKey, error) {
-	deviceAccessKeyRow := s.db.QueryRowContext(ctx, getDeviceAccessKey, id, projectID)
+func (s *Store) GetDevice(ctx context.Context, id, projectID string) (*models.Device, error) {
+	deviceRow := s.db.QueryRowContext(ctx, getDevice, id, projectID)
 
-	deviceAccessKey, err := s.scanDeviceAccessKey(deviceAccessKeyRow)
+	device, err := s.scanDevice(deviceRow)
 	if err == sql.ErrNoRows {
-		return nil, store.ErrDeviceAccessKeyNotFound
+		return nil, store.ErrDeviceNotFound
 	} else if err != nil {
 		return nil, err
 	}
 
-	return deviceAccessKey, nil
+	return device, nil
 }
 
-func (s *Store) ValidateDeviceAccessKey(ctx context.Context, projectID, hash string) (*models.DeviceAccessKey, error) {
-	deviceAccessKeyRow := s.db.QueryRowContext(ctx, validateDeviceAccessKey, projectID, hash)
+func (s *Store) LookupDevice(ctx context.Context, name, projectID string) (*models.Device, error) {
+	deviceRow := s.db.QueryRowContext(ctx, lookupDevice, name, projectID)
 
-	deviceAccessKey, err := s.scanDeviceAccessKey(deviceAccessKeyRow)
+	device, err := s.scanDevice(deviceRow)
 	if err == sql.ErrNoRows {
-		return nil, store.ErrDeviceAccessKeyNotFound
+		return nil, store.ErrDeviceNotFound
 	} else if err != nil {
 		return nil, err
 	}
 
-	return deviceAccessKey, nil
+	return device, nil
 }
 
-func (s *Store) scanDeviceAccessKey(scanner scanner) (*models.DeviceAccessKey, error) {
-	var deviceAccessKey models.DeviceAccessKey
-	if err := scanner.Scan(
-		&deviceAccessKey.ID,
-		&deviceAccessKey.CreatedAt,
-		&deviceAccessKey.ProjectID,
-		&deviceAccessKey.DeviceID,
-	); err != nil {
+func (s *Store) ListDevices(ctx context.Context, projectID, searchQuery string) ([]models.Device, error) {
+	var deviceRows *sql.Rows
+	var err error
+	if searchQuery == "" {
+		deviceRows, err = s.db.QueryContext(ctx, listDevices, projectID)
+	} else {
+		deviceRows, err = s.db.QueryContext(ctx, searchDevices, projectID, searchQuery)
+	}
+	if err != nil {
 		return nil, err
 	}
-	return &deviceAccessKey, nil
-}
+	defer deviceRows.Close()
 
-func (s *Store) CreateConnection(ctx context.Context, projectID, name string, protocol models.Protocol, port uint) (*models.Connection, error) {
-	id := newConnectionID()
+	devices := make([]models.Device, 0)
+	for deviceRows.Next() {
+		device, err := s.scanDevice(deviceRows)
+		if err != nil {
+			return nil, err
+		}
+		devices = append(devices, *device)
+	}
 
-	if _, err := s.db.ExecContext(
-		ctx,
-		createConnection,
-		id,
-		projectID,
-		name,
-		protocol,
-		port,
-	); err != nil {
+	if err := deviceRows.Err(); err != nil {
 		return nil, err
 	}
 
-	return s.GetConnection(ctx, id, projectID)
+	return devices, nil
 }
 
-func (s *Store) GetConnection(ctx context.Context, id, projectID string) (*models.Connection, error) {
-	connectionRow := s.db.QueryRowContext(ctx, getConnection, id, projectID)
+// QueryDevices evaluates the filters that it can, the ordering and the
+// pagination in SQL. If any of them can't be, it falls back to returning
+// every device that matches the rest.
+func (s *Store) QueryDevices(ctx context.Context, projectID string, deviceQuery store.DeviceQuery) (*store.DevicePage, error) {
+	var conditions []sqlExpr
+	if deviceQuery.SearchQuery != "" {
+		conditions = append(conditions, sqlExpr{
+			sql:  searchDevicesCondition,
+			args: []interface{}{deviceQuery.SearchQuery},
+		})
+	}
 
-	connection, err := s.scanConnection(connectionRow)
-	if err == sql.ErrNoRows {
-		return nil, store.ErrConnectionNotFound
-	} else if err != nil {
+	totalCount, err := s.countDevices(ctx, projectID, conditions)
+	if err != nil {
 		return nil, err
 	}
 
-	return connection, nil
-}
+	filterConditions, unapplied := deviceFiltersSQL(deviceQuery.Filters, time.Now())
+	conditions = append(conditions, filterConditions...)
 
-func (s *Store) LookupConnection(ctx context.Context, name, projectID string) (*models.Connection, error) {
-	connectionRow := s.db.QueryRowContext(ctx, lookupConnection, name, projectID)
+	orderBy := deviceQuery.OrderBy
+	if orderBy == "" {
+		orderBy = "id"
+	}
+	orderColumn, orderSupported := deviceOrderColumns[orderBy]
 
-	connection, err := s.scanConnection(connectionRow)
-	if err == sql.ErrNoRows {
-		return nil, store.ErrConnectionNotFound
-	} else if err != nil {
+	if len(unapplied) != 0 || !orderSupported {
+		devices, err := s.queryDevices(ctx, projectID, conditions, "", 0)
+		if err != nil {
+			return nil, err
+		}
+		return &store.DevicePage{
+			Devices:    devices,
+			TotalCount: totalCount,
+			Unapplied:  unapplied,
+		}, nil
+	}
+
+	matchingCount, err := s.countDevices(ctx, projectID, conditions)
+	if err != nil {
 		return nil, err
 	}
 
-	return connection, nil
+	direction, comparison := "asc", ">"
+	if deviceQuery.Descending {
+		direction, comparison = "desc", "<"
+	}
+
+	if deviceQuery.After != "" {
+		after, err := s.GetDevice(ctx, deviceQuery.After, projectID)
+		if err == store.ErrDeviceNotFound {
+			return nil, store.ErrDevicePageNotFound
+		} else if err != nil {
+			return nil, err
+		}
+
+		// Devices are ordered by ID after the requested field, so that the
+		// order is stable
+		var afterValue interface{}
+		switch orderBy {
+		case "id":
+			afterValue = after.ID
+		case "name":
+			afterValue = after.Name
+		case "createdAt":
+			afterValue = after.CreatedAt
+		case "lastSeenAt":
+			afterValue = after.LastSeenAt
+		}
+		conditions = append(conditions, sqlExpr{
+			sql: fmt.Sprintf("(%s %s ? or (%s = ? and id %s ?))",
+				orderColumn, comparison, orderColumn, comparison),
+			args: []interface{}{afterValue, afterValue, after.ID},
+		})
+	}
+
+	order := fmt.Sprintf("order by %s %s, id %s", orderColumn, direction, direction)
+
+	devices, err := s.queryDevices(ctx, projectID, conditions, order, deviceQuery.PageSize)
+	if err != nil {
+		return nil, err
+	}
+
+	return &store.DevicePage{
+		Devices:       devices,
+		TotalCount:    totalCount,
+		MatchingCount: matchingCount,
+		Paginated:     true,
+	}, nil
 }
 
-func (s *Store) ListConnections(ctx context.Context, projectID string) ([]models.Connection, error) {
-	connectionRows, err := s.db.QueryContext(ctx, listConnections, projectID)
+func (s *Store) queryDevices(ctx context.Context, projectID string, conditions []sqlExpr, order string, limit int) ([]models.Device, error) {
+	q, args := appendConditions(queryDevices, projectID, conditions)
+	if order != "" {
+		q += "  " + order + "\n"
+	}
+	if limit > 0 {
+		q += "  limit ?\n"
+		args = append(args, limit)
+	}
+
+	deviceRows, err := s.db.QueryContext(ctx, q, args...)
 	if err != nil {
-		return nil, errors.Wrap(err, "query connections")
+		return nil, errors.Wrap(err, "query devices")
 	}
-	defer connectionRows.Close()
+	defer deviceRows.Close()
 
-	connections := make([]models.Connection, 0)
-	for connectionRows.Next() {
-		connection, err := s.scanConnection(connectionRows)
+	devices := make([]models.Device, 0)
+	for deviceRows.Next() {
+		device, err := s.scanDevice(deviceRows)
 		if err != nil {
 			return nil, err
 		}
-		connections = append(connections, *connection)
+		devices = append(devices, *device)
 	}
 
-	if err := connectionRows.Err(); err != nil {
+	if err := deviceRows.Err(); err != nil {
 		return nil, err
 	}
 
-	return connections, nil
+	return devices, nil
 }
 
-func (s *Store) UpdateConnection(ctx context.Context, id, projectID, name string, protocol models.Protocol, port uint) (*models.Connection, error) {
+func (s *Store) countDevices(ctx context.Context, projectID string, conditions []sqlExpr) (int, error) {
+	q, args := appendConditions(countDevices, projectID, conditions)
+
+	var count int
+	if err := s.db.QueryRowContext(ctx, q, args...).Scan(&count); err != nil {
+		return 0, errors.Wrap(err, "count devices")
+	}
+	return count, nil
+}
+
+func appendConditions(q, projectID string, conditions []sqlExpr) (string, []interface{}) {
+	args := []interface{}{projectID}
+	for _, condition := range conditions {
+		q += "  and " + condition.sql + "\n"
+		args = append(args, condition.args...)
+	}
+	return q, args
+}
+
+func (s *Store) UpdateDeviceName(ctx context.Context, id, projectID, name string) (*models.Device, error) {
 	if _, err := s.db.ExecContext(
 		ctx,
-		updateConnection,
+		updateDeviceName,
 		name,
-		protocol,
-		port,
 		id,
 		projectID,
 	); err != nil {
 		return nil, err
 	}
 
-	return s.GetConnection(ctx, id, projectID)
+	return s.GetDevice(ctx, id, projectID)
 }
 
-func (s *Store) DeleteConnection(ctx context.Context, id, projectID string) error {
-	_, err := s.db.ExecContext(
+func (s *Store) SetDeviceInfo(ctx context.Context, id, projectID string, deviceInfo models.DeviceInfo) (*models.Device, error) {
+	infoBytes, err := json.Marshal(deviceInfo)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := s.db.ExecContext(
 		ctx,
-		deleteConnection,
+		setDeviceInfo,
+		string(infoBytes),
 		id,
 		projectID,
-	)
-	return err
-}
-
-func (s *Store) scanConnection(scanner scanner) (*models.Connection, error) {
-	var connection models.Connection
-	if err := scanner.Scan(
-		&connection.ID,
-		&connection.CreatedAt,
-		&connection.ProjectID,
-		&connection.Name,
-		&connection.Protocol,
-		&connection.Port,
 	); err != nil {
 		return nil, err
 	}
 
-	return &connection, nil
+	return s.GetDevice(ctx, id, projectID)
 }
 
-func (s *Store) CreateApplication(ctx context.Context, projectID, name, description string) (*models.Application, error) {
-	id := newApplicationID()
-
+func (s *Store) SetDeviceQuarantined(ctx context.Context, id, projectID string, quarantined bool) (*models.Device, error) {
 	if _, err := s.db.ExecContext(
 		ctx,
-		createApplication,
+		updateDeviceQuarantined,
+		quarantined,
 		id,
 		projectID,
-		name,
-		description,
 	); err != nil {
 		return nil, err
 	}
 
-	return s.GetApplication(ctx, id, projectID)
+	return s.GetDevice(ctx, id, projectID)
 }
 
-func (s *Store) GetApplication(ctx context.Context, id, projectID string) (*models.Application, error) {
-	applicationRow := s.db.QueryRowContext(ctx, getApplication, id, projectID)
+func (s *Store) UpdateDeviceLastSeenAt(ctx context.Context, projectID, deviceID string) error {
+	if _, err := s.db.ExecContext(
+		ctx,
+		updateDeviceLastSeenAt,
+		projectID,
+		deviceID,
+	); err != nil {
+		return err
+	}
 
-	application, err := s.scanApplication(applicationRow)
-	if err == sql.ErrNoRows {
-		return nil, store.ErrApplicationNotFound
-	} else if err != nil {
+	return nil
+}
+
+func (s *Store) DeleteDevice(ctx context.Context, id, projectID string) error {
+	_, err := s.db.ExecContext(
+		ctx,
+		deleteDevice,
+		id,
+		projectID,
+	)
+	return err
+}
+
+func (s *Store) scanDevice(scanner scanner) (*models.Device, error) {
+	var device models.Device
+	var infoString string
+	var labelsString string
+	var environmentVariablesString string
+	if err := scanner.Scan(
+		&device.ID,
+		&device.CreatedAt,
+		&device.ProjectID,
+		&device.Name,
+		&device.RegistrationTokenID,
+		&device.DesiredAgentVersion,
+		&infoString,
+		&labelsString,
+		&environmentVariablesString,
+		&device.LastSeenAt,
+		&device.Quarantined,
+	); err != nil {
 		return nil, err
 	}
 
-	return application, nil
-}
+	if infoString != "" {
+		if err := json.Unmarshal([]byte(infoString), &device.Info); err != nil {
+			return nil, err
+		}
+	}
 
-func (s *Store) LookupApplication(ctx context.Context, name, projectID string) (*models.Application, error) {
-	applicationRow := s.db.QueryRowContext(ctx, lookupApplication, name, projectID)
+	if labelsString == "" {
+		device.Labels = map[string]string{}
+	} else {
+		if err := json.Unmarshal([]byte(labelsString), &device.Labels); err != nil {
+			return nil, err
+		}
+	}
 
-	application, err := s.scanApplication(applicationRow)
-	if err == sql.ErrNoRows {
-		return nil, store.ErrApplicationNotFound
-	} else if err != nil {
+	if environmentVariablesString == "" {
+		device.EnvironmentVariables = map[string]string{}
+	} else {
+		if err := json.Unmarshal([]byte(environmentVariablesString), &device.EnvironmentVariables); err != nil {
+			return nil, err
+		}
+	}
+
+	if time.Now().After(device.LastSeenAt.Add(deviceOnlineThreshold)) {
+		device.Status = models.DeviceStatusOffline
+	} else {
+		device.Status = models.DeviceStatusOnline
+	}
+
+	return &device, nil
+}
+
+func (s *Store) scanDeviceLabels(scanner scanner) (map[string]string, error) {
+	var labelsString string
+	if err := scanner.Scan(
+		&labelsString,
+	); err != nil {
 		return nil, err
 	}
 
-	return application, nil
+	var labels map[string]string
+	if labelsString == "" {
+		labels = map[string]string{}
+	} else {
+		if err := json.Unmarshal([]byte(labelsString), &labels); err != nil {
+			return nil, err
+		}
+	}
+
+	return labels, nil
 }
 
-func (s *Store) ListApplications(ctx context.Context, projectID string) ([]models.Application, error) {
-	applicationRows, err := s.db.QueryContext(ctx, listApplications, projectID)
+func (s *Store) ListAllDeviceLabelKeys(ctx context.Context, projectID string) ([]string, error) {
+	rows, err := s.db.QueryContext(
+		ctx,
+		listAllDeviceLabels,
+		projectID,
+	)
 	if err != nil {
-		return nil, errors.Wrap(err, "query applications")
+		return nil, errors.Wrap(err, "query device labels")
 	}
-	defer applicationRows.Close()
+	defer rows.Close()
 
-	applications := make([]models.Application, 0)
-	for applicationRows.Next() {
-		application, err := s.scanApplication(applicationRows)
+	allDeviceLabels := make(map[string]bool)
+	for rows.Next() {
+		deviceLabels, err := s.scanDeviceLabels(rows)
 		if err != nil {
 			return nil, err
 		}
-		applications = append(applications, *application)
+		for k := range deviceLabels {
+			allDeviceLabels[k] = true
+		}
 	}
 
-	if err := applicationRows.Err(); err != nil {
+	if err := rows.Err(); err != nil {
 		return nil, err
 	}
 
-	return applications, nil
+	allDeviceLabelKeys := make([]string, len(allDeviceLabels))
+	i := 0
+	for k := range allDeviceLabels {
+		allDeviceLabelKeys[i] = k
+		i++
+	}
+
+	return allDeviceLabelKeys, nil
+
 }
 
-func (s *Store) UpdateApplicationName(ctx context.Context, id, projectID, name string) (*models.Application, error) {
+func (s *Store) SetDeviceLabel(ctx context.Context, deviceID, projectID, key, value string) (*string, error) {
+	device, err := s.GetDevice(ctx, deviceID, projectID)
+	if err != nil {
+		return nil, err
+	}
+
+	device.Labels[key] = value
+
+	labelsString, err := json.Marshal(device.Labels)
+	if err != nil {
+		return nil, err
+	}
+
 	if _, err := s.db.ExecContext(
 		ctx,
-		updateApplicationName,
-		name,
-		id,
+		updateDeviceLabels,
+		labelsString,
+		deviceID,
 		projectID,
 	); err != nil {
 		return nil, err
 	}
 
-	return s.GetApplication(ctx, id, projectID)
+	device, err = s.GetDevice(ctx, deviceID, projectID)
+	if err != nil {
+		return nil, err
+	}
+	v := device.Labels[key]
+	return &v, nil
 }
 
-func (s *Store) UpdateApplicationDescription(ctx context.Context, id, projectID, description string) (*models.Application, error) {
+func (s *Store) DeleteDeviceLabel(ctx context.Context, deviceID, projectID, key string) error {
+	device, err := s.GetDevice(ctx, deviceID, projectID)
+	if err != nil {
+		return err
+	}
+
+	delete(device.Labels, key)
+
+	labelsString, err := json.Marshal(device.Labels)
+	if err != nil {
+		return err
+	}
+
 	if _, err := s.db.ExecContext(
 		ctx,
-		updateApplicationDescription,
-		description,
-		id,
+		updateDeviceLabels,
+		labelsString,
+		deviceID,
 		projectID,
 	); err != nil {
+		return err
+	}
+	return nil
+}
+
+func (s *Store) SetDeviceEnvironmentVariable(ctx context.Context, deviceID, projectID, key, value string) (*string, error) {
+	device, err := s.GetDevice(ctx, deviceID, projectID)
+	if err != nil {
 		return nil, err
 	}
 
-	return s.GetApplication(ctx, id, projectID)
-}
+	device.EnvironmentVariables[key] = value
 
-func (s *Store) UpdateApplicationSchedulingRule(ctx context.Context, id, projectID string, schedulingRule models.SchedulingRule) (*models.Application, error) {
-	schedulingRuleBytes, err := json.Marshal(schedulingRule)
+	environmentVariablesString, err := json.Marshal(device.EnvironmentVariables)
 	if err != nil {
 		return nil, err
 	}
 
 	if _, err := s.db.ExecContext(
 		ctx,
-		updateApplicationSchedulingRule,
-		string(schedulingRuleBytes),
-		id,
+		updateDeviceEnvironmentVariables,
+		environmentVariablesString,
+		deviceID,
 		projectID,
 	); err != nil {
 		return nil, err
 	}
 
-	return s.GetApplication(ctx, id, projectID)
+	device, err = s.GetDevice(ctx, deviceID, projectID)
+	if err != nil {
+		return nil, err
+	}
+	v := device.EnvironmentVariables[key]
+	return &v, nil
 }
 
-func (s *Store) UpdateApplicationMetricEndpointConfigs(ctx context.Context, id, projectID string, metricEndpointConfigs map[string]models.MetricEndpointConfig) (*models.Application, error) {
-	metricEndpointConfigsBytes, err := json.Marshal(metricEndpointConfigs)
+func (s *Store) DeleteDeviceEnvironmentVariable(ctx context.Context, deviceID, projectID, key string) error {
+	device, err := s.GetDevice(ctx, deviceID, projectID)
 	if err != nil {
-		return nil, err
+		return err
+	}
+
+	delete(device.EnvironmentVariables, key)
+
+	environmentVariablesString, err := json.Marshal(device.EnvironmentVariables)
+	if err != nil {
+		return err
 	}
 
 	if _, err := s.db.ExecContext(
 		ctx,
-		updateApplicationMetricEndpointConfigs,
-		string(metricEndpointConfigsBytes),
-		id,
+		updateDeviceEnvironmentVariables,
+		environmentVariablesString,
+		deviceID,
 		projectID,
 	); err != nil {
-		return nil, err
+		return err
 	}
-
-	return s.GetApplication(ctx, id, projectID)
+	return nil
 }
 
-func (s *Store) DeleteApplication(ctx context.Context, id, projectID string) error {
-	_, err := s.db.ExecContext(
+func (s *Store) CreateDeviceRegistrationToken(ctx context.Context, projectID, name, description string, maxRegistrations *int) (*models.DeviceRegistrationToken, error) {
+	id := newDeviceRegistrationTokenID()
+
+	if _, err := s.db.ExecContext(
 		ctx,
-		deleteApplication,
+		createDeviceRegistrationToken,
 		id,
 		projectID,
-	)
-	return err
+		name,
+		description,
+		maxRegistrations,
+	); err != nil {
+		return nil, err
+	}
+
+	return s.GetDeviceRegistrationToken(ctx, id, projectID)
 }
 
-func (s *Store) scanApplication(scanner scanner) (*models.Application, error) {
-	var schedulingRuleStr string
-	var metricEndpointConfigsStr string
+func (s *Store) LookupDeviceRegistrationToken(ctx context.Context, name, projectID string) (*models.DeviceRegistrationToken, error) {
+	deviceRegistrationTokenRow := s.db.QueryRowContext(ctx, lookupDeviceRegistrationToken, name, projectID)
 
-	var application models.Application
-	if err := scanner.Scan(
-		&application.ID,
-		&application.CreatedAt,
-		&application.ProjectID,
-		&application.Name,
-		&application.Description,
-		&schedulingRuleStr,
-		&metricEndpointConfigsStr,
-	); err != nil {
+	deviceRegistrationToken, err := s.scanDeviceRegistrationToken(deviceRegistrationTokenRow)
+	if err == sql.ErrNoRows {
+		return nil, store.ErrDeviceRegistrationTokenNotFound
+	} else if err != nil {
 		return nil, err
 	}
 
-	if schedulingRuleStr == "" {
-		application.SchedulingRule = models.SchedulingRule{
-			ScheduleType:     models.ScheduleTypeNoDevices,
-			DefaultReleaseID: models.LatestRelease,
-			ConditionalQuery: nil,
-			ReleaseSelectors: []models.ReleaseSelector{},
-		}
-	} else {
-		err := json.Unmarshal([]byte(schedulingRuleStr), &application.SchedulingRule)
-		if err != nil {
-			return nil, err
-		}
+	return deviceRegistrationToken, nil
+}
+
+func (s *Store) ListDeviceRegistrationTokens(ctx context.Context, projectID string) ([]models.DeviceRegistrationToken, error) {
+	tokenRows, err := s.db.QueryContext(ctx, listDeviceRegistrationTokens, projectID)
+	if err != nil {
+		return nil, errors.Wrap(err, "query device registration tokens")
 	}
-	if metricEndpointConfigsStr == "" {
-		application.MetricEndpointConfigs = make(map[string]models.MetricEndpointConfig)
-	} else {
-		err := json.Unmarshal([]byte(metricEndpointConfigsStr), &application.MetricEndpointConfigs)
+	defer tokenRows.Close()
+
+	deviceRegistrationTokens := make([]models.DeviceRegistrationToken, 0)
+	for tokenRows.Next() {
+		deviceRegistrationToken, err := s.scanDeviceRegistrationToken(tokenRows)
 		if err != nil {
 			return nil, err
 		}
+		deviceRegistrationTokens = append(deviceRegistrationTokens, *deviceRegistrationToken)
 	}
 
-	return &application, nil
+	if err := tokenRows.Err(); err != nil {
+		return nil, err
+	}
+
+	return deviceRegistrationTokens, nil
 }
 
-func (s *Store) GetApplicationDeviceCounts(ctx context.Context, projectID, applicationID string) (*models.ApplicationDeviceCounts, error) {
-	countRow := s.db.QueryRowContext(ctx, getApplicationDeviceCounts, projectID, applicationID)
+func (s *Store) GetDeviceRegistrationToken(ctx context.Context, id, projectID string) (*models.DeviceRegistrationToken, error) {
+	deviceRegistrationTokenRow := s.db.QueryRowContext(ctx, getDeviceRegistrationToken, id, projectID)
 
-	count, err := s.scanApplicationDeviceCountRow(countRow)
-	if err != nil {
+	deviceRegistrationToken, err := s.scanDeviceRegistrationToken(deviceRegistrationTokenRow)
+	if err == sql.ErrNoRows {
+		return nil, store.ErrDeviceRegistrationTokenNotFound
+	} else if err != nil {
 		return nil, err
 	}
 
-	return &models.ApplicationDeviceCounts{
-		AllCount: count,
-	}, nil
+	return deviceRegistrationToken, nil
 }
 
-func (s *Store) scanApplicationDeviceCountRow(scanner scanner) (int, error) {
-	var count int
-	if err := scanner.Scan(
-		&count,
+func (s *Store) UpdateDeviceRegistrationToken(ctx context.Context, id, projectID, name, description string, maxRegistrations *int) (*models.DeviceRegistrationToken, error) {
+	if _, err := s.db.ExecContext(
+		ctx,
+		updateDeviceRegistrationToken,
+		name,
+		description,
+		maxRegistrations,
+		id,
+		projectID,
 	); err != nil {
-		return 0, err
+		return nil, err
 	}
-	return count, nil
+
+	return s.GetDeviceRegistrationToken(ctx, id, projectID)
 }
 
-func (s *Store) CreateRelease(ctx context.Context, projectID, applicationID, yamlConfig, jsonConfig, createdByUserID, createdByServiceAccountID string) (*models.Release, error) {
-	id := newReleaseID()
+func (s *Store) DeleteDeviceRegistrationToken(ctx context.Context, id, projectID string) error {
+	_, err := s.db.ExecContext(
+		ctx,
+		deleteDeviceRegistrationToken,
+		id,
+		projectID,
+	)
+	return err
+}
 
-	var createdByUserIDNullable *string
-	if createdByUserID != "" {
-		createdByUserIDNullable = &createdByUserID
-	}
-	var createdByServiceAccountIDNullable *string
-	if createdByServiceAccountID != "" {
-		createdByServiceAccountIDNullable = &createdByServiceAccountID
+func (s *Store) SetDeviceRegistrationTokenLabel(ctx context.Context, deviceRegistrationTokenID, projectID, key, value string) (*string, error) {
+	deviceRegistrationToken, err := s.GetDeviceRegistrationToken(ctx, deviceRegistrationTokenID, projectID)
+	if err != nil {
+		return nil, err
 	}
 
-	lastRelease, err := s.GetLatestRelease(ctx, projectID, applicationID)
-	var number uint32
-	if err != nil && err != store.ErrReleaseNotFound {
+	deviceRegistrationToken.Labels[key] = value
+
+	labelsString, err := json.Marshal(deviceRegistrationToken.Labels)
+	if err != nil {
 		return nil, err
 	}
-	if err == store.ErrReleaseNotFound {
-		number = 1
-	} else {
-		number = lastRelease.Number + 1
-	}
 
 	if _, err := s.db.ExecContext(
 		ctx,
-		createRelease,
-		id,
-		number,
+		updateDeviceRegistrationTokenLabels,
+		labelsString,
+		deviceRegistrationTokenID,
 		projectID,
-		applicationID,
-		jsonConfig,
-		yamlConfig,
-		createdByUserIDNullable,
-		createdByServiceAccountIDNullable,
 	); err != nil {
 		return nil, err
 	}
 
-	return s.GetRelease(ctx, id, projectID, applicationID)
+	deviceRegistrationToken, err = s.GetDeviceRegistrationToken(ctx, deviceRegistrationTokenID, projectID)
+	if err != nil {
+		return nil, err
+	}
+	v := deviceRegistrationToken.Labels[key]
+	return &v, nil
 }
 
-func (s *Store) GetRelease(ctx context.Context, id, projectID, applicationID string) (*models.Release, error) {
-	applicationRow := s.db.QueryRowContext(ctx, getRelease, id, projectID, applicationID)
+func (s *Store) DeleteDeviceRegistrationTokenLabel(ctx context.Context, deviceRegistrationTokenID, projectID, key string) error {
+	deviceRegistrationToken, err := s.GetDeviceRegistrationToken(ctx, deviceRegistrationTokenID, projectID)
+	if err != nil {
+		return err
+	}
 
-	release, err := s.scanRelease(applicationRow)
-	if err == sql.ErrNoRows {
-		return nil, store.ErrReleaseNotFound
-	} else if err != nil {
-		return nil, err
+	delete(deviceRegistrationToken.Labels, key)
+
+	labelsString, err := json.Marshal(deviceRegistrationToken.Labels)
+	if err != nil {
+		return err
 	}
 
-	return release, nil
+	if _, err := s.db.ExecContext(
+		ctx,
+		updateDeviceRegistrationTokenLabels,
+		labelsString,
+		deviceRegistrationTokenID,
+		projectID,
+	); err != nil {
+		return err
+	}
+	return nil
 }
 
-func (s *Store) GetReleaseByNumber(ctx context.Context, number uint32, projectID, applicationID string) (*models.Release, error) {
-	applicationRow := s.db.QueryRowContext(ctx, getReleaseByNumber, number, projectID, applicationID)
-
-	release, err := s.scanRelease(applicationRow)
-	if err == sql.ErrNoRows {
-		return nil, store.ErrReleaseNotFound
-	} else if err != nil {
+func (s *Store) SetDeviceRegistrationTokenEnvironmentVariable(ctx context.Context, tokenID, projectID, key, value string) (*string, error) {
+	deviceRegistrationToken, err := s.GetDeviceRegistrationToken(ctx, tokenID, projectID)
+	if err != nil {
 		return nil, err
 	}
 
-	return release, nil
-}
+	deviceRegistrationToken.EnvironmentVariables[key] = value
 
-func (s *Store) GetLatestRelease(ctx context.Context, projectID, applicationID string) (*models.Release, error) {
-	applicationRow := s.db.QueryRowContext(ctx, getLatestRelease, projectID, applicationID)
+	environmentVariablesString, err := json.Marshal(deviceRegistrationToken.EnvironmentVariables)
+	if err != nil {
+		return nil, err
+	}
 
-	release, err := s.scanRelease(applicationRow)
-	if err == sql.ErrNoRows {
-		return nil, store.ErrReleaseNotFound
-	} else if err != nil {
+	if _, err := s.db.ExecContext(
+		ctx,
+		updateDeviceRegistrationTokenEnvironmentVariables,
+		environmentVariablesString,
+		tokenID,
+		projectID,
+	); err != nil {
 		return nil, err
 	}
 
-	return release, nil
+	deviceRegistrationToken, err = s.GetDeviceRegistrationToken(ctx, tokenID, projectID)
+	if err != nil {
+		return nil, err
+	}
+	v := deviceRegistrationToken.EnvironmentVariables[key]
+	return &v, nil
 }
 
-func (s *Store) ListReleases(ctx context.Context, projectID, applicationID string) ([]models.Release, error) {
-	releaseRows, err := s.db.QueryContext(ctx, listReleases, projectID, applicationID)
+func (s *Store) DeleteDeviceRegistrationTokenEnvironmentVariable(ctx context.Context, tokenID, projectID, key string) error {
+	deviceRegistrationToken, err := s.GetDeviceRegistrationToken(ctx, tokenID, projectID)
 	if err != nil {
-		return nil, errors.Wrap(err, "query releases")
+		return err
 	}
-	defer releaseRows.Close()
 
-	releases := make([]models.Release, 0)
-	for releaseRows.Next() {
-		release, err := s.scanRelease(releaseRows)
-		if err != nil {
-			return nil, err
-		}
-		releases = append(releases, *release)
-	}
+	delete(deviceRegistrationToken.EnvironmentVariables, key)
 
-	if err := releaseRows.Err(); err != nil {
-		return nil, err
+	environmentVariablesString, err := json.Marshal(deviceRegistrationToken.EnvironmentVariables)
+	if err != nil {
+		return err
 	}
 
-	return releases, nil
+	if _, err := s.db.ExecContext(
+		ctx,
+		updateDeviceRegistrationTokenEnvironmentVariables,
+		environmentVariablesString,
+		tokenID,
+		projectID,
+	); err != nil {
+		return err
+	}
+	return nil
 }
 
-func (s *Store) scanRelease(scanner scanner) (*models.Release, error) {
-	var jsonConfig string
-	var release models.Release
+func (s *Store) scanDeviceRegistrationToken(scanner scanner) (*models.DeviceRegistrationToken, error) {
+	var deviceRegistrationToken models.DeviceRegistrationToken
+	var labelsString string
+	var environmentVariablesString string
 	if err := scanner.Scan(
-		&release.ID,
-		&release.Number,
-		&release.CreatedAt,
-		&release.ProjectID,
-		&release.ApplicationID,
-		&jsonConfig,
-		&release.RawConfig,
-		&release.CreatedByUserID,
-		&release.CreatedByServiceAccountID,
+		&deviceRegistrationToken.ID,
+		&deviceRegistrationToken.CreatedAt,
+		&deviceRegistrationToken.ProjectID,
+		&deviceRegistrationToken.MaxRegistrations,
+		&deviceRegistrationToken.Name,
+		&deviceRegistrationToken.Description,
+		&labelsString,
+		&environmentVariablesString,
 	); err != nil {
 		return nil, err
 	}
 
-	var parsedConfig map[string]models.Service
-	if len(jsonConfig) == 0 {
-		if err := yaml.UnmarshalStrict([]byte(release.RawConfig), &parsedConfig); err != nil {
+	if labelsString == "" {
+		deviceRegistrationToken.Labels = map[string]string{}
+	} else {
+		if err := json.Unmarshal([]byte(labelsString), &deviceRegistrationToken.Labels); err != nil {
 			return nil, err
 		}
+	}
+
+	if environmentVariablesString == "" {
+		deviceRegistrationToken.EnvironmentVariables = map[string]string{}
 	} else {
-		if err := json.Unmarshal([]byte(jsonConfig), &parsedConfig); err != nil {
+		if err := json.Unmarshal([]byte(environmentVariablesString), &deviceRegistrationToken.EnvironmentVariables); err != nil {
 			return nil, err
 		}
 	}
-	release.Config = parsedConfig
 
-	return &release, nil
+	return &deviceRegistrationToken, nil
 }
 
-func (s *Store) GetReleaseDeviceCounts(ctx context.Context, projectID, applicationID, releaseID string) (*models.ReleaseDeviceCounts, error) {
-	countRow := s.db.QueryRowContext(ctx, getReleaseDeviceCounts, projectID, applicationID, releaseID)
+func (s *Store) GetDevicesRegisteredWithTokenCount(ctx context.Context, tokenID, projectID string) (*models.DevicesRegisteredWithTokenCount, error) {
+	countRow := s.db.QueryRowContext(ctx, getDevicesRegisteredWithTokenCount, tokenID, projectID)
 
-	count, err := s.scanReleaseDeviceCountRow(countRow)
-	if err != nil {
+	count, err := s.scanDevicesRegisteredCountRow(countRow)
+	if err == sql.ErrNoRows {
+		return nil, store.ErrDeviceRegistrationTokenNotFound
+	} else if err != nil {
 		return nil, err
 	}
 
-	return &models.ReleaseDeviceCounts{
+	return &models.DevicesRegisteredWithTokenCount{
 		AllCount: count,
 	}, nil
 }
 
-func (s *Store) scanReleaseDeviceCountRow(scanner scanner) (int, error) {
+func (s *Store) scanDevicesRegisteredCountRow(scanner scanner) (int, error) {
 	var count int
 	if err := scanner.Scan(
 		&count,
 	); err != nil {
 		return 0, err
 	}
-	return count, nil
-}
+	return count, nil
+}
+
+func (s *Store) CreateDeviceAccessKey(ctx context.Context, projectID, deviceID, hash string) (*models.DeviceAccessKey, error) {
+	id := newDeviceAccessKeyID()
+
+	if _, err := s.db.ExecContext(
+		ctx,
+		createDeviceAccessKey,
+		id,
+		projectID,
+		deviceID,
+		models.DeviceAccessKeyTypeKey,
+		nil,
+		hash,
+	); err != nil {
+		return nil, err
+	}
+
+	return s.GetDeviceAccessKey(ctx, id, projectID)
+}
+
+// CreateDeviceCertificateAccessKey records a client certificate issued to
+// the device so that it can be listed and revoked like an access key.
+func (s *Store) CreateDeviceCertificateAccessKey(ctx context.Context, projectID, deviceID, fingerprintHash string) (*models.DeviceAccessKey, error) {
+	id := newDeviceAccessKeyID()
+
+	if _, err := s.db.ExecContext(
+		ctx,
+		createDeviceAccessKey,
+		id,
+		projectID,
+		deviceID,
+		models.DeviceAccessKeyTypeCertificate,
+		nil,
+		fingerprintHash,
+	); err != nil {
+		return nil, err
+	}
+
+	return s.GetDeviceAccessKey(ctx, id, projectID)
+}
+
+// RotateDeviceAccessKey creates a new key for the same device as the key
+// with the given ID. The old key stays valid until the rotation is
+// completed so a device that fails to save the new key isn't locked out.
+// Replacements from earlier rotations that were never completed are revoked
+// since the device can't have saved them.
+func (s *Store) RotateDeviceAccessKey(ctx context.Context, id, projectID, hash string) (*models.DeviceAccessKey, error) {
+	deviceAccessKey, err := s.GetDeviceAccessKey(ctx, id, projectID)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := s.db.ExecContext(
+		ctx,
+		revokeDeviceAccessKeyReplacements,
+		projectID,
+		deviceAccessKey.DeviceID,
+		deviceAccessKey.ID,
+	); err != nil {
+		return nil, err
+	}
+
+	newID := newDeviceAccessKeyID()
+
+	if _, err := s.db.ExecContext(
+		ctx,
+		createDeviceAccessKey,
+		newID,
+		projectID,
+		deviceAccessKey.DeviceID,
+		models.DeviceAccessKeyTypeKey,
+		deviceAccessKey.ID,
+		hash,
+	); err != nil {
+		return nil, err
+	}
+
+	return s.GetDeviceAccessKey(ctx, newID, projectID)
+}
+
+// CompleteDeviceAccessKeyRotation revokes the key that the key with the
+// given ID replaced.
+func (s *Store) CompleteDeviceAccessKeyRotation(ctx context.Context, id, projectID string) error {
+	deviceAccessKey, err := s.GetDeviceAccessKey(ctx, id, projectID)
+	if err != nil {
+		return err
+	}
+	if deviceAccessKey.ReplacesID == nil {
+		return nil
+	}
+
+	if err := s.RevokeDeviceAccessKey(ctx, *deviceAccessKey.ReplacesID, projectID); err != nil {
+		return err
+	}
+
+	_, err = s.db.ExecContext(
+		ctx,
+		clearDeviceAccessKeyReplacesID,
+		id,
+		projectID,
+	)
+	return err
+}
+
+func (s *Store) GetDeviceAccessKey(ctx context.Context, id, projectID string) (*models.DeviceAccessKey, error) {
+	deviceAccessKeyRow := s.db.QueryRowContext(ctx, getDeviceAccessKey, id, projectID)
+
+	deviceAccessKey, err := s.scanDeviceAccessKey(deviceAccessKeyRow)
+	if err == sql.ErrNoRows {
+		return nil, store.ErrDeviceAccessKeyNotFound
+	} else if err != nil {
+		return nil, err
+	}
+
+	return deviceAccessKey, nil
+}
+
+func (s *Store) ListDeviceAccessKeys(ctx context.Context, projectID, deviceID string) ([]models.DeviceAccessKey, error) {
+	deviceAccessKeyRows, err := s.db.QueryContext(ctx, listDeviceAccessKeys, projectID, deviceID)
+	if err != nil {
+		return nil, errors.Wrap(err, "query device access keys")
+	}
+	defer deviceAccessKeyRows.Close()
+
+	deviceAccessKeys := make([]models.DeviceAccessKey, 0)
+	for deviceAccessKeyRows.Next() {
+		deviceAccessKey, err := s.scanDeviceAccessKey(deviceAccessKeyRows)
+		if err != nil {
+			return nil, err
+		}
+		deviceAccessKeys = append(deviceAccessKeys, *deviceAccessKey)
+	}
+
+	if err := deviceAccessKeyRows.Err(); err != nil {
+		return nil, err
+	}
+
+	return deviceAccessKeys, nil
+}
+
+func (s *Store) ValidateDeviceAccessKey(ctx context.Context, projectID, hash string) (*models.DeviceAccessKey, error) {
+	deviceAccessKeyRow := s.db.QueryRowContext(ctx, validateDeviceAccessKey, projectID, hash)
+
+	deviceAccessKey, err := s.scanDeviceAccessKey(deviceAccessKeyRow)
+	if err == sql.ErrNoRows {
+		return nil, store.ErrDeviceAccessKeyNotFound
+	} else if err != nil {
+		return nil, err
+	}
+
+	return deviceAccessKey, nil
+}
+
+func (s *Store) scanDeviceAccessKey(scanner scanner) (*models.DeviceAccessKey, error) {
+	var deviceAccessKey models.DeviceAccessKey
+	if err := scanner.Scan(
+		&deviceAccessKey.ID,
+		&deviceAccessKey.CreatedAt,
+		&deviceAccessKey.ProjectID,
+		&deviceAccessKey.DeviceID,
+		&deviceAccessKey.Type,
+		&deviceAccessKey.ReplacesID,
+		&deviceAccessKey.RevokedAt,
+	); err != nil {
+		return nil, err
+	}
+	return &deviceAccessKey, nil
+}
+
+func (s *Store) RevokeDeviceAccessKey(ctx context.Context, id, projectID string) error {
+	_, err := s.db.ExecContext(
+		ctx,
+		revokeDeviceAccessKey,
+		id,
+		projectID,
+	)
+	return err
+}
+
+func (s *Store) RevokeDeviceAccessKeys(ctx context.Context, projectID, deviceID string) error {
+	_, err := s.db.ExecContext(
+		ctx,
+		revokeDeviceAccessKeys,
+		projectID,
+		deviceID,
+	)
+	return err
+}
+
+func (s *Store) CreateDeviceCertificateAuthority(ctx context.Context, projectID, certificate, privateKey string) (*models.DeviceCertificateAuthority, error) {
+	if _, err := s.db.ExecContext(
+		ctx,
+		createDeviceCertificateAuthority,
+		projectID,
+		certificate,
+		privateKey,
+	); err != nil {
+		return nil, err
+	}
+
+	return s.GetDeviceCertificateAuthority(ctx, projectID)
+}
+
+func (s *Store) GetDeviceCertificateAuthority(ctx context.Context, projectID string) (*models.DeviceCertificateAuthority, error) {
+	deviceCertificateAuthorityRow := s.db.QueryRowContext(ctx, getDeviceCertificateAuthority, projectID)
+
+	var deviceCertificateAuthority models.DeviceCertificateAuthority
+	err := deviceCertificateAuthorityRow.Scan(
+		&deviceCertificateAuthority.ProjectID,
+		&deviceCertificateAuthority.CreatedAt,
+		&deviceCertificateAuthority.Certificate,
+		&deviceCertificateAuthority.PrivateKey,
+	)
+	if err == sql.ErrNoRows {
+		return nil, store.ErrDeviceCertificateAuthorityNotFound
+	} else if err != nil {
+		return nil, err
+	}
+
+	return &deviceCertificateAuthority, nil
+}
+
+func (s *Store) CreateConnection(ctx context.Context, projectID, name string, protocol models.Protocol, port uint) (*models.Connection, error) {
+	id := newConnectionID()
+
+	if _, err := s.db.ExecContext(
+		ctx,
+		createConnection,
+		id,
+		projectID,
+		name,
+		protocol,
+		port,
+	); err != nil {
+		return nil, err
+	}
+
+	return s.GetConnection(ctx, id, projectID)
+}
+
+func (s *Store) GetConnection(ctx context.Context, id, projectID string) (*models.Connection, error) {
+	connectionRow := s.db.QueryRowContext(ctx, getConnection, id, projectID)
+
+	connection, err := s.scanConnection(connectionRow)
+	if err == sql.ErrNoRows {
+		return nil, store.ErrConnectionNotFound
+	} else if err != nil {
+		return nil, err
+	}
+
+	return connection, nil
+}
+
+func (s *Store) LookupConnection(ctx context.Context, name, projectID string) (*models.Connection, error) {
+	connectionRow := s.db.QueryRowContext(ctx, lookupConnection, name, projectID)
+
+	connection, err := s.scanConnection(connectionRow)
+	if err == sql.ErrNoRows {
+		return nil, store.ErrConnectionNotFound
+	} else if err != nil {
+		return nil, err
+	}
+
+	return connection, nil
+}
+
+func (s *Store) ListConnections(ctx context.Context, projectID string) ([]models.Connection, error) {
+	connectionRows, err := s.db.QueryContext(ctx, listConnections, projectID)
+	if err != nil {
+		return nil, errors.Wrap(err, "query connections")
+	}
+	defer connectionRows.Close()
+
+	connections := make([]models.Connection, 0)
+	for connectionRows.Next() {
+		connection, err := s.scanConnection(connectionRows)
+		if err != nil {
+			return nil, err
+		}
+		connections = append(connections, *connection)
+	}
+
+	if err := connectionRows.Err(); err != nil {
+		return nil, err
+	}
+
+	return connections, nil
+}
+
+func (s *Store) UpdateConnection(ctx context.Context, id, projectID, name string, protocol models.Protocol, port uint) (*models.Connection, error) {
+	if _, err := s.db.ExecContext(
+		ctx,
+		updateConnection,
+		name,
+		protocol,
+		port,
+		id,
+		projectID,
+	); err != nil {
+		return nil, err
+	}
+
+	return s.GetConnection(ctx, id, projectID)
+}
+
+func (s *Store) DeleteConnection(ctx context.Context, id, projectID string) error {
+	_, err := s.db.ExecContext(
+		ctx,
+		deleteConnection,
+		id,
+		projectID,
+	)
+	return err
+}
+
+func (s *Store) scanConnection(scanner scanner) (*models.Connection, error) {
+	var connection models.Connection
+	if err := scanner.Scan(
+		&connection.ID,
+		&connection.CreatedAt,
+		&connection.ProjectID,
+		&connection.Name,
+		&connection.Protocol,
+		&connection.Port,
+	); err != nil {
+		return nil, err
+	}
+
+	return &connection, nil
+}
+
+func (s *Store) CreateDeviceGroup(ctx context.Context, projectID, name, description string, query models.Query) (*models.DeviceGroup, error) {
+	id := newDeviceGroupID()
+
+	queryBytes, err := json.Marshal(query)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := s.db.ExecContext(
+		ctx,
+		createDeviceGroup,
+		id,
+		projectID,
+		name,
+		description,
+		string(queryBytes),
+	); err != nil {
+		return nil, err
+	}
+
+	return s.GetDeviceGroup(ctx, id, projectID)
+}
+
+func (s *Store) GetDeviceGroup(ctx context.Context, id, projectID string) (*models.DeviceGroup, error) {
+	deviceGroupRow := s.db.QueryRowContext(ctx, getDeviceGroup, id, projectID)
+
+	deviceGroup, err := s.scanDeviceGroup(deviceGroupRow)
+	if err == sql.ErrNoRows {
+		return nil, store.ErrDeviceGroupNotFound
+	} else if err != nil {
+		return nil, err
+	}
+
+	return deviceGroup, nil
+}
+
+func (s *Store) LookupDeviceGroup(ctx context.Context, name, projectID string) (*models.DeviceGroup, error) {
+	deviceGroupRow := s.db.QueryRowContext(ctx, lookupDeviceGroup, name, projectID)
+
+	deviceGroup, err := s.scanDeviceGroup(deviceGroupRow)
+	if err == sql.ErrNoRows {
+		return nil, store.ErrDeviceGroupNotFound
+	} else if err != nil {
+		return nil, err
+	}
+
+	return deviceGroup, nil
+}
+
+func (s *Store) ListDeviceGroups(ctx context.Context, projectID string) ([]models.DeviceGroup, error) {
+	deviceGroupRows, err := s.db.QueryContext(ctx, listDeviceGroups, projectID)
+	if err != nil {
+		return nil, errors.Wrap(err, "query device groups")
+	}
+	defer deviceGroupRows.Close()
+
+	deviceGroups := make([]models.DeviceGroup, 0)
+	for deviceGroupRows.Next() {
+		deviceGroup, err := s.scanDeviceGroup(deviceGroupRows)
+		if err != nil {
+			return nil, err
+		}
+		deviceGroups = append(deviceGroups, *deviceGroup)
+	}
+
+	if err := deviceGroupRows.Err(); err != nil {
+		return nil, err
+	}
+
+	return deviceGroups, nil
+}
+
+func (s *Store) UpdateDeviceGroup(ctx context.Context, id, projectID, name, description string, query models.Query) (*models.DeviceGroup, error) {
+	queryBytes, err := json.Marshal(query)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := s.db.ExecContext(
+		ctx,
+		updateDeviceGroup,
+		name,
+		description,
+		string(queryBytes),
+		id,
+		projectID,
+	); err != nil {
+		return nil, err
+	}
+
+	return s.GetDeviceGroup(ctx, id, projectID)
+}
+
+func (s *Store) DeleteDeviceGroup(ctx context.Context, id, projectID string) error {
+	_, err := s.db.ExecContext(
+		ctx,
+		deleteDeviceGroup,
+		id,
+		projectID,
+	)
+	return err
+}
+
+func (s *Store) scanDeviceGroup(scanner scanner) (*models.DeviceGroup, error) {
+	var queryStr string
+
+	var deviceGroup models.DeviceGroup
+	if err := scanner.Scan(
+		&deviceGroup.ID,
+		&deviceGroup.CreatedAt,
+		&deviceGroup.ProjectID,
+		&deviceGroup.Name,
+		&deviceGroup.Description,
+		&queryStr,
+	); err != nil {
+		return nil, err
+	}
+
+	if err := json.Unmarshal([]byte(queryStr), &deviceGroup.Query); err != nil {
+		return nil, err
+	}
+	if deviceGroup.Query == nil {
+		deviceGroup.Query = models.Query{}
+	}
+
+	return &deviceGroup, nil
+}
+
+func (s *Store) CreateApplication(ctx context.Context, projectID, name, description string) (*models.Application, error) {
+	id := newApplicationID()
+
+	if _, err := s.db.ExecContext(
+		ctx,
+		createApplication,
+		id,
+		projectID,
+		name,
+		description,
+	); err != nil {
+		return nil, err
+	}
+
+	return s.GetApplication(ctx, id, projectID)
+}
+
+func (s *Store) GetApplication(ctx context.Context, id, projectID string) (*models.Application, error) {
+	applicationRow := s.db.QueryRowContext(ctx, getApplication, id, projectID)
+
+	application, err := s.scanApplication(applicationRow)
+	if err == sql.ErrNoRows {
+		return nil, store.ErrApplicationNotFound
+	} else if err != nil {
+		return nil, err
+	}
+
+	return application, nil
+}
+
+func (s *Store) LookupApplication(ctx context.Context, name, projectID string) (*models.Application, error) {
+	applicationRow := s.db.QueryRowContext(ctx, lookupApplication, name, projectID)
+
+	application, err := s.scanApplication(applicationRow)
+	if err == sql.ErrNoRows {
+		return nil, store.ErrApplicationNotFound
+	} else if err != nil {
+		return nil, err
+	}
+
+	return application, nil
+}
+
+func (s *Store) ListApplications(ctx context.Context, projectID string) ([]models.Application, error) {
+	applicationRows, err := s.db.QueryContext(ctx, listApplications, projectID)
+	if err != nil {
+		return nil, errors.Wrap(err, "query applications")
+	}
+	defer applicationRows.Close()
+
+	applications := make([]models.Application, 0)
+	for applicationRows.Next() {
+		application, err := s.scanApplication(applicationRows)
+		if err != nil {
+			return nil, err
+		}
+		applications = append(applications, *application)
+	}
+
+	if err := applicationRows.Err(); err != nil {
+		return nil, err
+	}
+
+	return applications, nil
+}
+
+func (s *Store) UpdateApplicationName(ctx context.Context, id, projectID, name string) (*models.Application, error) {
+	if _, err := s.db.ExecContext(
+		ctx,
+		updateApplicationName,
+		name,
+		id,
+		projectID,
+	); err != nil {
+		return nil, err
+	}
+
+	return s.GetApplication(ctx, id, projectID)
+}
+
+func (s *Store) UpdateApplicationDescription(ctx context.Context, id, projectID, description string) (*models.Application, error) {
+	if _, err := s.db.ExecContext(
+		ctx,
+		updateApplicationDescription,
+		description,
+		id,
+		projectID,
+	); err != nil {
+		return nil, err
+	}
+
+	return s.GetApplication(ctx, id, projectID)
+}
+
+func (s *Store) UpdateApplicationSchedulingRule(ctx context.Context, id, projectID string, schedulingRule models.SchedulingRule) (*models.Application, error) {
+	schedulingRuleBytes, err := json.Marshal(schedulingRule)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := s.db.ExecContext(
+		ctx,
+		updateApplicationSchedulingRule,
+		string(schedulingRuleBytes),
+		id,
+		projectID,
+	); err != nil {
+		return nil, err
+	}
+
+	return s.GetApplication(ctx, id, projectID)
+}
+
+func (s *Store) UpdateApplicationMetricEndpointConfigs(ctx context.Context, id, projectID string, metricEndpointConfigs map[string]models.MetricEndpointConfig) (*models.Application, error) {
+	metricEndpointConfigsBytes, err := json.Marshal(metricEndpointConfigs)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := s.db.ExecContext(
+		ctx,
+		updateApplicationMetricEndpointConfigs,
+		string(metricEndpointConfigsBytes),
+		id,
+		projectID,
+	); err != nil {
+		return nil, err
+	}
+
+	return s.GetApplication(ctx, id, projectID)
+}
+
+func (s *Store) DeleteApplication(ctx context.Context, id, projectID string) error {
+	_, err := s.db.ExecContext(
+		ctx,
+		deleteApplication,
+		id,
+		projectID,
+	)
+	return err
+}
+
+func (s *Store) scanApplication(scanner scanner) (*models.Application, error) {
+	var schedulingRuleStr string
+	var metricEndpointConfigsStr string
+
+	var application models.Application
+	if err := scanner.Scan(
+		&application.ID,
+		&application.CreatedAt,
+		&application.ProjectID,
+		&application.Name,
+		&application.Description,
+		&schedulingRuleStr,
+		&metricEndpointConfigsStr,
+	); err != nil {
+		return nil, err
+	}
+
+	if schedulingRuleStr == "" {
+		application.SchedulingRule = models.SchedulingRule{
+			ScheduleType:     models.ScheduleTypeNoDevices,
+			DefaultReleaseID: models.LatestRelease,
+			ConditionalQuery: nil,
+			ReleaseSelectors: []models.ReleaseSelector{},
+		}
+	} else {
+		err := json.Unmarshal([]byte(schedulingRuleStr), &application.SchedulingRule)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if metricEndpointConfigsStr == "" {
+		application.MetricEndpointConfigs = make(map[string]models.MetricEndpointConfig)
+	} else {
+		err := json.Unmarshal([]byte(metricEndpointConfigsStr), &application.MetricEndpointConfigs)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return &application, nil
+}
+
+func (s *Store) GetApplicationDeviceCounts(ctx context.Context, projectID, applicationID string) (*models.ApplicationDeviceCounts, error) {
+	countRow := s.db.QueryRowContext(ctx, getApplicationDeviceCounts, projectID, applicationID)
+
+	count, err := s.scanApplicationDeviceCountRow(countRow)
+	if err != nil {
+		return nil, err
+	}
+
+	return &models.ApplicationDeviceCounts{
+		AllCount: count,
+	}, nil
+}
+
+func (s *Store) scanApplicationDeviceCountRow(scanner scanner) (int, error) {
+	var count int
+	if err := scanner.Scan(
+		&count,
+	); err != nil {
+		return 0, err
+	}
+	return count, nil
+}
+
+func (s *Store) CreateRelease(ctx context.Context, projectID, applicationID, yamlConfig, jsonConfig, createdByUserID, createdByServiceAccountID string) (*models.Release, error) {
+	id := newReleaseID()
+
+	var createdByUserIDNullable *string
+	if createdByUserID != "" {
+		createdByUserIDNullable = &createdByUserID
+	}
+	var createdByServiceAccountIDNullable *string
+	if createdByServiceAccountID != "" {
+		createdByServiceAccountIDNullable = &createdByServiceAccountID
+	}
+
+	lastRelease, err := s.GetLatestRelease(ctx, projectID, applicationID)
+	var number uint32
+	if err != nil && err != store.ErrReleaseNotFound {
+		return nil, err
+	}
+	if err == store.ErrReleaseNotFound {
+		number = 1
+	} else {
+		number = lastRelease.Number + 1
+	}
+
+	if _, err := s.db.ExecContext(
+		ctx,
+		createRelease,
+		id,
+		number,
+		projectID,
+		applicationID,
+		jsonConfig,
+		yamlConfig,
+		createdByUserIDNullable,
+		createdByServiceAccountIDNullable,
+	); err != nil {
+		return nil, err
+	}
+
+	return s.GetRelease(ctx, id, projectID, applicationID)
+}
+
+func (s *Store) GetRelease(ctx context.Context, id, projectID, applicationID string) (*models.Release, error) {
+	applicationRow := s.db.QueryRowContext(ctx, getRelease, id, projectID, applicationID)
+
+	release, err := s.scanRelease(applicationRow)
+	if err == sql.ErrNoRows {
+		return nil, store.ErrReleaseNotFound
+	} else if err != nil {
+		return nil, err
+	}
+
+	return release, nil
+}
+
+func (s *Store) GetReleaseByNumber(ctx context.Context, number uint32, projectID, applicationID string) (*models.Release, error) {
+	applicationRow := s.db.QueryRowContext(ctx, getReleaseByNumber, number, projectID, applicationID)
+
+	release, err := s.scanRelease(applicationRow)
+	if err == sql.ErrNoRows {
+		return nil, store.ErrReleaseNotFound
+	} else if err != nil {
+		return nil, err
+	}
+
+	return release, nil
+}
+
+func (s *Store) GetLatestRelease(ctx context.Context, projectID, applicationID string) (*models.Release, error) {
+	applicationRow := s.db.QueryRowContext(ctx, getLatestRelease, projectID, applicationID)
+
+	release, err := s.scanRelease(applicationRow)
+	if err == sql.ErrNoRows {
+		return nil, store.ErrReleaseNotFound
+	} else if err != nil {
+		return nil, err
+	}
+
+	return release, nil
+}
+
+func (s *Store) ListReleases(ctx context.Context, projectID, applicationID string) ([]models.Release, error) {
+	releaseRows, err := s.db.QueryContext(ctx, listReleases, projectID, applicationID)
+	if err != nil {
+		return nil, errors.Wrap(err, "query releases")
+	}
+	defer releaseRows.Close()
+
+	releases := make([]models.Release, 0)
+	for releaseRows.Next() {
+		release, err := s.scanRelease(releaseRows)
+		if err != nil {
+			return nil, err
+		}
+		releases = append(releases, *release)
+	}
+
+	if err := releaseRows.Err(); err != nil {
+		return nil, err
+	}
+
+	return releases, nil
+}
+
+func (s *Store) scanRelease(scanner scanner) (*models.Release, error) {
+	var jsonConfig string
+	var release models.Release
+	if err := scanner.Scan(
+		&release.ID,
+		&release.Number,
+		&release.CreatedAt,
+		&release.ProjectID,
+		&release.ApplicationID,
+		&jsonConfig,
+		&release.RawConfig,
+		&release.CreatedByUserID,
+		&release.CreatedByServiceAccountID,
+	); err != nil {
+		return nil, err
+	}
+
+	var parsedConfig map[string]models.Service
+	if len(jsonConfig) == 0 {
+		if err := yaml.UnmarshalStrict([]byte(release.RawConfig), &parsedConfig); err != nil {
+			return nil, err
+		}
+	} else {
+		if err := json.Unmarshal([]byte(jsonConfig), &parsedConfig); err != nil {
+			return nil, err
+		}
+	}
+	release.Config = parsedConfig
+
+	return &release, nil
+}
+
+func (s *Store) GetReleaseDeviceCounts(ctx context.Context, projectID, applicationID, releaseID string) (*models.ReleaseDeviceCounts, error) {
+	countRow := s.db.QueryRowContext(ctx, getReleaseDeviceCounts, projectID, applicationID, releaseID)
+
+	count, err := s.scanReleaseDeviceCountRow(countRow)
+	if err != nil {
+		return nil, err
+	}
+
+	return &models.ReleaseDeviceCounts{
+		AllCount: count,
+	}, nil
+}
+
+func (s *Store) scanReleaseDeviceCountRow(scanner scanner) (int, error) {
+	var count int
+	if err := scanner.Scan(
+		&count,
+	); err != nil {
+		return 0, err
+	}
+	return count, nil
+}
+
+func (s *Store) SetDeviceApplicationStatus(ctx context.Context, projectID, deviceID, applicationID, currentReleaseID string) error {
+	_, err := s.db.ExecContext(
+		ctx,
+		setDeviceApplicationStatus,
+		projectID,
+		deviceID,
+		applicationID,
+		currentReleaseID,
+		currentReleaseID,
+	)
+	return err
+}
+
+func (s *Store) GetDeviceApplicationStatus(ctx context.Context, projectID, deviceID, applicationID string) (*models.DeviceApplicationStatus, error) {
+	deviceApplicationStatusRow := s.db.QueryRowContext(ctx, getDeviceApplicationStatus, projectID, deviceID, applicationID)
+
+	deviceApplicationStatus, err := s.scanDeviceApplicationStatus(deviceApplicationStatusRow)
+	if err == sql.ErrNoRows {
+		return nil, store.ErrDeviceApplicationStatusNotFound
+	} else if err != nil {
+		return nil, err
+	}
+
+	return deviceApplicationStatus, nil
+}
+
+func (s *Store) ListDeviceApplicationStatuses(ctx context.Context, projectID, deviceID string) ([]models.DeviceApplicationStatus, error) {
+	deviceApplicationStatusRows, err := s.db.QueryContext(ctx, listDeviceApplicationStatuses, projectID, deviceID)
+	if err != nil {
+		return nil, errors.Wrap(err, "query device application statuses")
+	}
+	defer deviceApplicationStatusRows.Close()
+
+	deviceApplicationStatuses := make([]models.DeviceApplicationStatus, 0)
+	for deviceApplicationStatusRows.Next() {
+		deviceApplicationStatus, err := s.scanDeviceApplicationStatus(deviceApplicationStatusRows)
+		if err != nil {
+			return nil, err
+		}
+		deviceApplicationStatuses = append(deviceApplicationStatuses, *deviceApplicationStatus)
+	}
+
+	if err := deviceApplicationStatusRows.Err(); err != nil {
+		return nil, err
+	}
+
+	return deviceApplicationStatuses, nil
+}
+
+func (s *Store) ListAllDeviceApplicationStatuses(ctx context.Context, projectID string) ([]models.DeviceApplicationStatus, error) {
+	deviceApplicationStatusRows, err := s.db.QueryContext(ctx, listAllDeviceApplicationStatuses, projectID)
+	if err != nil {
+		return nil, errors.Wrap(err, "query all device application statuses")
+	}
+	defer deviceApplicationStatusRows.Close()
+
+	deviceApplicationStatuses := make([]models.DeviceApplicationStatus, 0)
+	for deviceApplicationStatusRows.Next() {
+		deviceApplicationStatus, err := s.scanDeviceApplicationStatus(deviceApplicationStatusRows)
+		if err != nil {
+			return nil, err
+		}
+		deviceApplicationStatuses = append(deviceApplicationStatuses, *deviceApplicationStatus)
+	}
+
+	if err := deviceApplicationStatusRows.Err(); err != nil {
+		return nil, err
+	}
+
+	return deviceApplicationStatuses, nil
+}
+
+func (s *Store) DeleteDeviceApplicationStatus(ctx context.Context, projectID, deviceID, applicationID string) error {
+	_, err := s.db.ExecContext(
+		ctx,
+		deleteDeviceApplicationStatus,
+		projectID,
+		deviceID,
+		applicationID,
+	)
+	return err
+}
+
+func (s *Store) scanDeviceApplicationStatus(scanner scanner) (*models.DeviceApplicationStatus, error) {
+	var deviceApplicationStatus models.DeviceApplicationStatus
+	if err := scanner.Scan(
+		&deviceApplicationStatus.ProjectID,
+		&deviceApplicationStatus.DeviceID,
+		&deviceApplicationStatus.ApplicationID,
+		&deviceApplicationStatus.CurrentReleaseID,
+	); err != nil {
+		return nil, err
+	}
+	return &deviceApplicationStatus, nil
+}
+
+func (s *Store) SetDeviceServiceStatus(ctx context.Context, projectID, deviceID, applicationID, service, currentReleaseID string) error {
+	_, err := s.db.ExecContext(
+		ctx,
+		setDeviceServiceStatus,
+		projectID,
+		deviceID,
+		applicationID,
+		service,
+		currentReleaseID,
+		currentReleaseID,
+	)
+	return err
+}
+
+func (s *Store) GetDeviceServiceStatus(ctx context.Context, projectID, deviceID, applicationID, service string) (*models.DeviceServiceStatus, error) {
+	deviceServiceStatusRow := s.db.QueryRowContext(
+		ctx,
+		getDeviceServiceStatus,
+		projectID,
+		deviceID,
+		applicationID,
+		service,
+	)
+
+	deviceServiceStatus, err := s.scanDeviceServiceStatus(deviceServiceStatusRow)
+	if err == sql.ErrNoRows {
+		return nil, store.ErrDeviceServiceStatusNotFound
+	} else if err != nil {
+		return nil, err
+	}
+
+	return deviceServiceStatus, nil
+}
+
+func (s *Store) GetDeviceServiceStatuses(ctx context.Context, projectID, deviceID, applicationID string) ([]models.DeviceServiceStatus, error) {
+	deviceServiceStatusRows, err := s.db.QueryContext(
+		ctx,
+		getDeviceServiceStatuses,
+		projectID,
+		deviceID,
+		applicationID,
+	)
+	if err != nil {
+		return nil, errors.Wrap(err, "query device service statuses")
+	}
+	defer deviceServiceStatusRows.Close()
+
+	deviceServiceStatuses := make([]models.DeviceServiceStatus, 0)
+	for deviceServiceStatusRows.Next() {
+		deviceServiceStatus, err := s.scanDeviceServiceStatus(deviceServiceStatusRows)
+		if err != nil {
+			return nil, err
+		}
+		deviceServiceStatuses = append(deviceServiceStatuses, *deviceServiceStatus)
+	}
+
+	if err := deviceServiceStatusRows.Err(); err != nil {
+		return nil, err
+	}
+
+	return deviceServiceStatuses, nil
+}
+
+func (s *Store) ListDeviceServiceStatuses(ctx context.Context, projectID, deviceID string) ([]models.DeviceServiceStatus, error) {
+	deviceServiceStatusRows, err := s.db.QueryContext(ctx, listDeviceServiceStatuses, projectID, deviceID)
+	if err != nil {
+		return nil, errors.Wrap(err, "query device service statuses")
+	}
+	defer deviceServiceStatusRows.Close()
+
+	deviceServiceStatuses := make([]models.DeviceServiceStatus, 0)
+	for deviceServiceStatusRows.Next() {
+		deviceServiceStatus, err := s.scanDeviceServiceStatus(deviceServiceStatusRows)
+		if err != nil {
+			return nil, err
+		}
+		deviceServiceStatuses = append(deviceServiceStatuses, *deviceServiceStatus)
+	}
+
+	if err := deviceServiceStatusRows.Err(); err != nil {
+		return nil, err
+	}
+
+	return deviceServiceStatuses, nil
+}
+
+func (s *Store) DeleteDeviceServiceStatus(ctx context.Context, projectID, deviceID, applicationID, service string) error {
+	_, err := s.db.ExecContext(
+		ctx,
+		deleteDeviceServiceStatus,
+		projectID,
+		deviceID,
+		applicationID,
+		service,
+	)
+	return err
+}
+
+func (s *Store) scanDeviceServiceStatus(scanner scanner) (*models.DeviceServiceStatus, error) {
+	var deviceServiceStatus models.DeviceServiceStatus
+	if err := scanner.Scan(
+		&deviceServiceStatus.ProjectID,
+		&deviceServiceStatus.DeviceID,
+		&deviceServiceStatus.ApplicationID,
+		&deviceServiceStatus.Service,
+		&deviceServiceStatus.CurrentReleaseID,
+	); err != nil {
+		return nil, err
+	}
+
+	return &deviceServiceStatus, nil
+}
+
+func (s *Store) SetDeviceServiceState(ctx context.Context, projectID, deviceID, applicationID, service string, state models.ServiceState, errorMessage string) error {
+	_, err := s.db.ExecContext(
+		ctx,
+		setDeviceServiceState,
+		projectID,
+		deviceID,
+		applicationID,
+		service,
+		state,
+		errorMessage,
+		state,
+		errorMessage,
+	)
+	return err
+}
+
+func (s *Store) GetDeviceServiceState(ctx context.Context, projectID, deviceID, applicationID, service string) (*models.DeviceServiceState, error) {
+	deviceServiceStateRow := s.db.QueryRowContext(
+		ctx,
+		getDeviceServiceState,
+		projectID,
+		deviceID,
+		applicationID,
+		service,
+	)
+
+	deviceServiceState, err := s.scanDeviceServiceState(deviceServiceStateRow)
+	if err == sql.ErrNoRows {
+		return nil, store.ErrDeviceServiceStateNotFound
+	} else if err != nil {
+		return nil, err
+	}
+
+	return deviceServiceState, nil
+}
+
+func (s *Store) GetDeviceServiceStates(ctx context.Context, projectID, deviceID, applicationID string) ([]models.DeviceServiceState, error) {
+	deviceServiceStateRows, err := s.db.QueryContext(
+		ctx,
+		getDeviceServiceStates,
+		projectID,
+		deviceID,
+		applicationID,
+	)
+	if err != nil {
+		return nil, errors.Wrap(err, "query device service states")
+	}
+	defer deviceServiceStateRows.Close()
+
+	deviceServiceStates := make([]models.DeviceServiceState, 0)
+	for deviceServiceStateRows.Next() {
+		deviceServiceState, err := s.scanDeviceServiceState(deviceServiceStateRows)
+		if err != nil {
+			return nil, err
+		}
+		deviceServiceStates = append(deviceServiceStates, *deviceServiceState)
+	}
+
+	if err := deviceServiceStateRows.Err(); err != nil {
+		return nil, err
+	}
+
+	return deviceServiceStates, nil
+}
+
+func (s *Store) scanServiceStateCount(scanner scanner) (*models.ServiceStateCount, error) {
+	var serviceStateCount models.ServiceStateCount
+	if err := scanner.Scan(
+		&serviceStateCount.Count,
+		&serviceStateCount.CountErroring,
+		&serviceStateCount.State,
+		&serviceStateCount.Service,
+		&serviceStateCount.ApplicationID,
+	); err != nil {
+		return nil, err
+	}
+
+	return &serviceStateCount, nil
+}
+
+func (s *Store) ListApplicationServiceStateCounts(ctx context.Context, projectID, applicationID string) ([]models.ServiceStateCount, error) {
+	serviceStateCountRows, err := s.db.QueryContext(
+		ctx,
+		getDeviceServiceStateCountsByApplication,
+		projectID,
+		applicationID,
+	)
+	if err != nil {
+		return nil, errors.Wrap(err, "query device service states by application")
+	}
+	defer serviceStateCountRows.Close()
+
+	serviceStateCounts := make([]models.ServiceStateCount, 0)
+	for serviceStateCountRows.Next() {
+		ServiceStateCount, err := s.scanServiceStateCount(serviceStateCountRows)
+		if err != nil {
+			return nil, err
+		}
+		serviceStateCounts = append(serviceStateCounts, *ServiceStateCount)
+	}
+	if err := serviceStateCountRows.Err(); err != nil {
+		return nil, err
+	}
+
+	return serviceStateCounts, nil
+}
+
+func (s *Store) ListDeviceServiceStates(ctx context.Context, projectID, deviceID string) ([]models.DeviceServiceState, error) {
+	deviceServiceStateRows, err := s.db.QueryContext(ctx, listDeviceServiceStates, projectID, deviceID)
+	if err != nil {
+		return nil, errors.Wrap(err, "query device service states")
+	}
+	defer deviceServiceStateRows.Close()
+
+	deviceServiceStates := make([]models.DeviceServiceState, 0)
+	for deviceServiceStateRows.Next() {
+		deviceServiceState, err := s.scanDeviceServiceState(deviceServiceStateRows)
+		if err != nil {
+			return nil, err
+		}
+		deviceServiceStates = append(deviceServiceStates, *deviceServiceState)
+	}
+
+	if err := deviceServiceStateRows.Err(); err != nil {
+		return nil, err
+	}
+
+	return deviceServiceStates, nil
+}
+
+func (s *Store) ListAllDeviceServiceStates(ctx context.Context, projectID string) ([]models.DeviceServiceState, error) {
+	deviceServiceStateRows, err := s.db.QueryContext(ctx, listAllDeviceServiceStates, projectID)
+	if err != nil {
+		return nil, errors.Wrap(err, "query all device service states")
+	}
+	defer deviceServiceStateRows.Close()
+
+	deviceServiceStates := make([]models.DeviceServiceState, 0)
+	for deviceServiceStateRows.Next() {
+		deviceServiceState, err := s.scanDeviceServiceState(deviceServiceStateRows)
+		if err != nil {
+			return nil, err
+		}
+		deviceServiceStates = append(deviceServiceStates, *deviceServiceState)
+	}
+
+	if err := deviceServiceStateRows.Err(); err != nil {
+		return nil, err
+	}
+
+	return deviceServiceStates, nil
+}
+
+func (s *Store) DeleteDeviceServiceState(ctx context.Context, projectID, deviceID, applicationID, service string) error {
+	_, err := s.db.ExecContext(
+		ctx,
+		deleteDeviceServiceState,
+		projectID,
+		deviceID,
+		applicationID,
+		service,
+	)
+	return err
+}
+
+func (s *Store) scanDeviceServiceState(scanner scanner) (*models.DeviceServiceState, error) {
+	var deviceServiceState models.DeviceServiceState
+	if err := scanner.Scan(
+		&deviceServiceState.ProjectID,
+		&deviceServiceState.DeviceID,
+		&deviceServiceState.ApplicationID,
+		&deviceServiceState.Service,
+		&deviceServiceState.State,
+		&deviceServiceState.ErrorMessage,
+	); err != nil {
+		return nil, err
+	}
+
+	return &deviceServiceState, nil
+}
+
+func (s *Store) scanProjectConfig(scanner scanner) (*models.ProjectConfig, error) {
+	var projectConfig models.ProjectConfig
+	if err := scanner.Scan(
+		&projectConfig.ProjectID,
+		&projectConfig.Key,
+		&projectConfig.Value,
+	); err != nil {
+		return nil, err
+	}
+
+	return &projectConfig, nil
+}
+
+func (s *Store) scanDeviceMetricsConfig(scanner scanner) (*models.DeviceMetricsConfig, error) {
+	pConfig, err := s.scanProjectConfig(scanner)
+	if err != nil {
+		return nil, err
+	}
+
+	var dmc models.DeviceMetricsConfig
+	err = json.Unmarshal([]byte(pConfig.Value), &dmc)
+	if err != nil {
+		return nil, err
+	}
+
+	return &dmc, nil
+}
+
+func (s *Store) scanServiceMetricsConfig(scanner scanner) ([]models.ServiceMetricsConfig, error) {
+	pConfig, err := s.scanProjectConfig(scanner)
+	if err != nil {
+		return nil, err
+	}
+
+	var smc []models.ServiceMetricsConfig
+	err = json.Unmarshal([]byte(pConfig.Value), &smc)
+	if err != nil {
+		return nil, err
+	}
+
+	return smc, nil
+}
+
+func (s *Store) scanProjectMetricsConfig(scanner scanner) (*models.ProjectMetricsConfig, error) {
+	pConfig, err := s.scanProjectConfig(scanner)
+	if err != nil {
+		return nil, err
+	}
+
+	var pmc models.ProjectMetricsConfig
+	err = json.Unmarshal([]byte(pConfig.Value), &pmc)
+	if err != nil {
+		return nil, err
+	}
+
+	return &pmc, nil
+}
+
+func (s *Store) SetServiceMetricsConfigs(ctx context.Context, projectID string, value []models.ServiceMetricsConfig) error {
+	valueBytes, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+
+	_, err = s.db.ExecContext(
+		ctx,
+		setProjectConfig,
+		projectID,
+		models.ServiceMetricsConfigKey,
+		valueBytes,
+	)
+	return err
+}
+
+func (s *Store) GetServiceMetricsConfigs(ctx context.Context, projectID string) ([]models.ServiceMetricsConfig, error) {
+	smcRow := s.db.QueryRowContext(
+		ctx,
+		getProjectConfig,
+		projectID,
+		models.ServiceMetricsConfigKey,
+	)
+
+	smc, err := s.scanServiceMetricsConfig(smcRow)
+	if err == sql.ErrNoRows {
+		return make([]models.ServiceMetricsConfig, 0), nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	return smc, nil
+}
+
+func (s *Store) SetProjectMetricsConfig(ctx context.Context, projectID string, value models.ProjectMetricsConfig) error {
+	valueBytes, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
 
-func (s *Store) SetDeviceApplicationStatus(ctx context.Context, projectID, deviceID, applicationID, currentReleaseID string) error {
-	_, err := s.db.ExecContext(
+	_, err = s.db.ExecContext(
 		ctx,
-		setDeviceApplicationStatus,
+		setProjectConfig,
 		projectID,
-		deviceID,
-		applicationID,
-		currentReleaseID,
-		currentReleaseID,
+		models.ProjectMetricsConfigKey,
+		valueBytes,
 	)
 	return err
 }
 
-func (s *Store) GetDeviceApplicationStatus(ctx context.Context, projectID, deviceID, applicationID string) (*models.DeviceApplicationStatus, error) {
-	deviceApplicationStatusRow := s.db.QueryRowContext(ctx, getDeviceApplicationStatus, projectID, deviceID, applicationID)
+func (s *Store) GetProjectMetricsConfig(ctx context.Context, projectID string) (*models.ProjectMetricsConfig, error) {
+	pmcRow := s.db.QueryRowContext(
+		ctx,
+		getProjectConfig,
+		projectID,
+		models.ProjectMetricsConfigKey,
+	)
 
-	deviceApplicationStatus, err := s.scanDeviceApplicationStatus(deviceApplicationStatusRow)
+	pmc, err := s.scanProjectMetricsConfig(pmcRow)
 	if err == sql.ErrNoRows {
-		return nil, store.ErrDeviceApplicationStatusNotFound
+		return &models.ProjectMetricsConfig{
+			ExposedMetrics: make([]models.ExposedMetric, 0),
+		}, nil
 	} else if err != nil {
 		return nil, err
 	}
 
-	return deviceApplicationStatus, nil
+	return pmc, nil
 }
 
-func (s *Store) ListDeviceApplicationStatuses(ctx context.Context, projectID, deviceID string) ([]models.DeviceApplicationStatus, error) {
-	deviceApplicationStatusRows, err := s.db.QueryContext(ctx, listDeviceApplicationStatuses, projectID, deviceID)
+func (s *Store) SetDeviceMetricsConfig(ctx context.Context, projectID string, value models.DeviceMetricsConfig) error {
+	valueBytes, err := json.Marshal(value)
 	if err != nil {
-		return nil, errors.Wrap(err, "query device application statuses")
+		return err
 	}
-	defer deviceApplicationStatusRows.Close()
 
-	deviceApplicationStatuses := make([]models.DeviceApplicationStatus, 0)
-	for deviceApplicationStatusRows.Next() {
-		deviceApplicationStatus, err := s.scanDeviceApplicationStatus(deviceApplicationStatusRows)
-		if err != nil {
-			return nil, err
-		}
-		deviceApplicationStatuses = append(deviceApplicationStatuses, *deviceApplicationStatus)
-	}
+	_, err = s.db.ExecContext(
+		ctx,
+		setProjectConfig,
+		projectID,
+		models.DeviceMetricsConfigKey,
+		valueBytes,
+	)
+	return err
+}
 
-	if err := deviceApplicationStatusRows.Err(); err != nil {
+func (s *Store) GetDeviceMetricsConfig(ctx context.Context, projectID string) (*models.DeviceMetricsConfig, error) {
+	dmcRow := s.db.QueryRowContext(
+		ctx,
+		getProjectConfig,
+		projectID,
+		models.DeviceMetricsConfigKey,
+	)
+
+	dmc, err := s.scanDeviceMetricsConfig(dmcRow)
+	if err == sql.ErrNoRows {
+		return &models.DeviceMetricsConfig{
+			ExposedMetrics: make([]models.ExposedMetric, 0),
+		}, nil
+	} else if err != nil {
 		return nil, err
 	}
 
-	return deviceApplicationStatuses, nil
+	return dmc, nil
 }
 
-func (s *Store) ListAllDeviceApplicationStatuses(ctx context.Context, projectID string) ([]models.DeviceApplicationStatus, error) {
-	deviceApplicationStatusRows, err := s.db.QueryContext(ctx, listAllDeviceApplicationStatuses, projectID)
+func (s *Store) SetMetricsSinkConfig(ctx context.Context, projectID string, value models.MetricsSinkConfig) error {
+	valueBytes, err := json.Marshal(value)
 	if err != nil {
-		return nil, errors.Wrap(err, "query all device application statuses")
-	}
-	defer deviceApplicationStatusRows.Close()
-
-	deviceApplicationStatuses := make([]models.DeviceApplicationStatus, 0)
-	for deviceApplicationStatusRows.Next() {
-		deviceApplicationStatus, err := s.scanDeviceApplicationStatus(deviceApplicationStatusRows)
-		if err != nil {
-			return nil, err
-		}
-		deviceApplicationStatuses = append(deviceApplicationStatuses, *deviceApplicationStatus)
-	}
-
-	if err := deviceApplicationStatusRows.Err(); err != nil {
-		return nil, err
+		return err
 	}
 
-	return deviceApplicationStatuses, nil
-}
-
-func (s *Store) DeleteDeviceApplicationStatus(ctx context.Context, projectID, deviceID, applicationID string) error {
-	_, err := s.db.ExecContext(
+	_, err = s.db.ExecContext(
 		ctx,
-		deleteDeviceApplicationStatus,
+		setProjectConfig,
 		projectID,
-		deviceID,
-		applicationID,
+		models.MetricsSinkConfigKey,
+		valueBytes,
 	)
 	return err
 }
 
-func (s *Store) scanDeviceApplicationStatus(scanner scanner) (*models.DeviceApplicationStatus, error) {
-	var deviceApplicationStatus models.DeviceApplicationStatus
-	if err := scanner.Scan(
-		&deviceApplicationStatus.ProjectID,
-		&deviceApplicationStatus.DeviceID,
-		&deviceApplicationStatus.ApplicationID,
-		&deviceApplicationStatus.CurrentReleaseID,
-	); err != nil {
+func (s *Store) GetMetricsSinkConfig(ctx context.Context, projectID string) (*models.MetricsSinkConfig, error) {
+	mscRow := s.db.QueryRowContext(
+		ctx,
+		getProjectConfig,
+		projectID,
+		models.MetricsSinkConfigKey,
+	)
+
+	pConfig, err := s.scanProjectConfig(mscRow)
+	if err == sql.ErrNoRows {
+		return &models.MetricsSinkConfig{}, nil
+	} else if err != nil {
 		return nil, err
 	}
-	return &deviceApplicationStatus, nil
+
+	var msc models.MetricsSinkConfig
+	if err := json.Unmarshal([]byte(pConfig.Value), &msc); err != nil {
+		return nil, err
+	}
+
+	return &msc, nil
 }
 
-func (s *Store) SetDeviceServiceStatus(ctx context.Context, projectID, deviceID, applicationID, service, currentReleaseID string) error {
-	_, err := s.db.ExecContext(
+func (s *Store) SetSecurityConfig(ctx context.Context, projectID string, value models.SecurityConfig) error {
+	valueBytes, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+
+	_, err = s.db.ExecContext(
 		ctx,
-		setDeviceServiceStatus,
+		setProjectConfig,
 		projectID,
-		deviceID,
-		applicationID,
-		service,
-		currentReleaseID,
-		currentReleaseID,
+		models.SecurityConfigKey,
+		valueBytes,
 	)
 	return err
 }
 
-func (s *Store) GetDeviceServiceStatus(ctx context.Context, projectID, deviceID, applicationID, service string) (*models.DeviceServiceStatus, error) {
-	deviceServiceStatusRow := s.db.QueryRowContext(
+func (s *Store) GetSecurityConfig(ctx context.Context, projectID string) (*models.SecurityConfig, error) {
+	scRow := s.db.QueryRowContext(
 		ctx,
-		getDeviceServiceStatus,
+		getProjectConfig,
 		projectID,
-		deviceID,
-		applicationID,
-		service,
+		models.SecurityConfigKey,
 	)
 
-	deviceServiceStatus, err := s.scanDeviceServiceStatus(deviceServiceStatusRow)
+	pConfig, err := s.scanProjectConfig(scRow)
 	if err == sql.ErrNoRows {
-		return nil, store.ErrDeviceServiceStatusNotFound
+		return &models.SecurityConfig{}, nil
 	} else if err != nil {
 		return nil, err
 	}
 
-	return deviceServiceStatus, nil
-}
-
-func (s *Store) GetDeviceServiceStatuses(ctx context.Context, projectID, deviceID, applicationID string) ([]models.DeviceServiceStatus, error) {
-	deviceServiceStatusRows, err := s.db.QueryContext(
-		ctx,
-		getDeviceServiceStatuses,
-		projectID,
-		deviceID,
-		applicationID,
-	)
-	if err != nil {
-		return nil, errors.Wrap(err, "query device service statuses")
+	var sc models.SecurityConfig
+	if err := json.Unmarshal([]byte(pConfig.Value), &sc); err != nil {
+		return nil, err
 	}
-	defer deviceServiceStatusRows.Close()
 
-	deviceServiceStatuses := make([]models.DeviceServiceStatus, 0)
-	for deviceServiceStatusRows.Next() {
-		deviceServiceStatus, err := s.scanDeviceServiceStatus(deviceServiceStatusRows)
-		if err != nil {
-			return nil, err
-		}
-		deviceServiceStatuses = append(deviceServiceStatuses, *deviceServiceStatus)
-	}
+	return &sc, nil
+}
 
-	if err := deviceServiceStatusRows.Err(); err != nil {
-		return nil, err
+func (s *Store) CreateMetricSeries(ctx context.Context, series models.MetricSeries) error {
+	tagsBytes, err := json.Marshal(series.Tags)
+	if err != nil {
+		return err
 	}
 
-	return deviceServiceStatuses, nil
+	_, err = s.db.ExecContext(
+		ctx,
+		createMetricSeries,
+		series.ID,
+		series.ProjectID,
+		series.Metric,
+		string(tagsBytes),
+	)
+	return err
 }
 
-func (s *Store) ListDeviceServiceStatuses(ctx context.Context, projectID, deviceID string) ([]models.DeviceServiceStatus, error) {
-	deviceServiceStatusRows, err := s.db.QueryContext(ctx, listDeviceServiceStatuses, projectID, deviceID)
+func (s *Store) ListMetricSeries(ctx context.Context, projectID, metric string) ([]models.MetricSeries, error) {
+	seriesRows, err := s.db.QueryContext(ctx, listMetricSeries, projectID, metric)
 	if err != nil {
-		return nil, errors.Wrap(err, "query device service statuses")
+		return nil, errors.Wrap(err, "query metric series")
 	}
-	defer deviceServiceStatusRows.Close()
+	defer seriesRows.Close()
 
-	deviceServiceStatuses := make([]models.DeviceServiceStatus, 0)
-	for deviceServiceStatusRows.Next() {
-		deviceServiceStatus, err := s.scanDeviceServiceStatus(deviceServiceStatusRows)
+	metricSeries := make([]models.MetricSeries, 0)
+	for seriesRows.Next() {
+		series, err := s.scanMetricSeries(seriesRows)
 		if err != nil {
 			return nil, err
 		}
-		deviceServiceStatuses = append(deviceServiceStatuses, *deviceServiceStatus)
+		metricSeries = append(metricSeries, *series)
 	}
 
-	if err := deviceServiceStatusRows.Err(); err != nil {
+	if err := seriesRows.Err(); err != nil {
 		return nil, err
 	}
 
-	return deviceServiceStatuses, nil
+	return metricSeries, nil
 }
 
-func (s *Store) DeleteDeviceServiceStatus(ctx context.Context, projectID, deviceID, applicationID, service string) error {
-	_, err := s.db.ExecContext(
-		ctx,
-		deleteDeviceServiceStatus,
-		projectID,
-		deviceID,
-		applicationID,
-		service,
-	)
+func (s *Store) DeleteEmptyMetricSeries(ctx context.Context) error {
+	_, err := s.db.ExecContext(ctx, deleteEmptyMetricSeries)
 	return err
 }
 
-func (s *Store) scanDeviceServiceStatus(scanner scanner) (*models.DeviceServiceStatus, error) {
-	var deviceServiceStatus models.DeviceServiceStatus
+func (s *Store) scanMetricSeries(scanner scanner) (*models.MetricSeries, error) {
+	var series models.MetricSeries
+	var tagsString string
 	if err := scanner.Scan(
-		&deviceServiceStatus.ProjectID,
-		&deviceServiceStatus.DeviceID,
-		&deviceServiceStatus.ApplicationID,
-		&deviceServiceStatus.Service,
-		&deviceServiceStatus.CurrentReleaseID,
+		&series.ID,
+		&series.ProjectID,
+		&series.Metric,
+		&tagsString,
 	); err != nil {
 		return nil, err
 	}
-
-	return &deviceServiceStatus, nil
+	if err := json.Unmarshal([]byte(tagsString), &series.Tags); err != nil {
+		return nil, err
+	}
+	return &series, nil
 }
 
-func (s *Store) SetDeviceServiceState(ctx context.Context, projectID, deviceID, applicationID, service string, state models.ServiceState, errorMessage string) error {
-	_, err := s.db.ExecContext(
-		ctx,
-		setDeviceServiceState,
-		projectID,
-		deviceID,
-		applicationID,
-		service,
-		state,
-		errorMessage,
-		state,
-		errorMessage,
-	)
-	return err
-}
+// Keeps each insert well under MySQL's placeholder limit
+const metricPointsBatchSize = 500
 
-func (s *Store) GetDeviceServiceState(ctx context.Context, projectID, deviceID, applicationID, service string) (*models.DeviceServiceState, error) {
-	deviceServiceStateRow := s.db.QueryRowContext(
-		ctx,
-		getDeviceServiceState,
-		projectID,
-		deviceID,
-		applicationID,
-		service,
-	)
+func (s *Store) AddMetricPoints(ctx context.Context, points []models.MetricPoint) error {
+	for len(points) > 0 {
+		n := len(points)
+		if n > metricPointsBatchSize {
+			n = metricPointsBatchSize
+		}
 
-	deviceServiceState, err := s.scanDeviceServiceState(deviceServiceStateRow)
-	if err == sql.ErrNoRows {
-		return nil, store.ErrDeviceServiceStateNotFound
-	} else if err != nil {
-		return nil, err
-	}
+		placeholders := make([]string, n)
+		args := make([]interface{}, 0, n*7)
+		for i, point := range points[:n] {
+			placeholders[i] = "(?, ?, ?, ?, ?, ?, ?)"
+			args = append(args,
+				point.SeriesID,
+				point.Resolution,
+				point.Timestamp,
+				point.Count,
+				point.Sum,
+				point.Min,
+				point.Max,
+			)
+		}
 
-	return deviceServiceState, nil
+		if _, err := s.db.ExecContext(ctx,
+			fmt.Sprintf(addMetricPoints, strings.Join(placeholders, ", ")), args...); err != nil {
+			return err
+		}
+
+		points = points[n:]
+	}
+	return nil
 }
 
-func (s *Store) GetDeviceServiceStates(ctx context.Context, projectID, deviceID, applicationID string) ([]models.DeviceServiceState, error) {
-	deviceServiceStateRows, err := s.db.QueryContext(
-		ctx,
-		getDeviceServiceStates,
-		projectID,
-		deviceID,
-		applicationID,
-	)
+func (s *Store) ListMetricPoints(ctx context.Context, seriesIDs []string, resolution, start, end int64) ([]models.MetricPoint, error) {
+	if len(seriesIDs) == 0 {
+		return make([]models.MetricPoint, 0), nil
+	}
+
+	placeholders := make([]string, len(seriesIDs))
+	args := make([]interface{}, 0, len(seriesIDs)+3)
+	for i, seriesID := range seriesIDs {
+		placeholders[i] = "?"
+		args = append(args, seriesID)
+	}
+	args = append(args, resolution, start, end)
+
+	pointRows, err := s.db.QueryContext(ctx,
+		fmt.Sprintf(listMetricPoints, strings.Join(placeholders, ", ")), args...)
 	if err != nil {
-		return nil, errors.Wrap(err, "query device service states")
+		return nil, errors.Wrap(err, "query metric points")
 	}
-	defer deviceServiceStateRows.Close()
+	defer pointRows.Close()
 
-	deviceServiceStates := make([]models.DeviceServiceState, 0)
-	for deviceServiceStateRows.Next() {
-		deviceServiceState, err := s.scanDeviceServiceState(deviceServiceStateRows)
+	points := make([]models.MetricPoint, 0)
+	for pointRows.Next() {
+		point, err := s.scanMetricPoint(pointRows)
 		if err != nil {
 			return nil, err
 		}
-		deviceServiceStates = append(deviceServiceStates, *deviceServiceState)
+		points = append(points, *point)
 	}
 
-	if err := deviceServiceStateRows.Err(); err != nil {
+	if err := pointRows.Err(); err != nil {
 		return nil, err
 	}
 
-	return deviceServiceStates, nil
+	return points, nil
 }
 
-func (s *Store) scanServiceStateCount(scanner scanner) (*models.ServiceStateCount, error) {
-	var serviceStateCount models.ServiceStateCount
+func (s *Store) DownsampleMetricPoints(ctx context.Context, fromResolution, toResolution, start, end int64) error {
+	_, err := s.db.ExecContext(
+		ctx,
+		downsampleMetricPoints,
+		toResolution,
+		toResolution,
+		fromResolution,
+		start,
+		end,
+	)
+	return err
+}
+
+func (s *Store) DeleteMetricPoints(ctx context.Context, resolution, before int64) error {
+	_, err := s.db.ExecContext(ctx, deleteMetricPoints, resolution, before)
+	return err
+}
+
+func (s *Store) scanMetricPoint(scanner scanner) (*models.MetricPoint, error) {
+	var point models.MetricPoint
 	if err := scanner.Scan(
-		&serviceStateCount.Count,
-		&serviceStateCount.CountErroring,
-		&serviceStateCount.State,
-		&serviceStateCount.Service,
-		&serviceStateCount.ApplicationID,
+		&point.SeriesID,
+		&point.Resolution,
+		&point.Timestamp,
+		&point.Count,
+		&point.Sum,
+		&point.Min,
+		&point.Max,
 	); err != nil {
 		return nil, err
 	}
-
-	return &serviceStateCount, nil
+	return &point, nil
 }
 
-func (s *Store) ListApplicationServiceStateCounts(ctx context.Context, projectID, applicationID string) ([]models.ServiceStateCount, error) {
-	serviceStateCountRows, err := s.db.QueryContext(
+// Keeps each insert well under MySQL's placeholder limit
+const jobItemsBatchSize = 500
+
+func (s *Store) CreateJob(ctx context.Context, projectID string, jobType models.JobType, params map[string]interface{}, items []models.JobItem) (*models.Job, error) {
+	id := newJobID()
+
+	paramsBytes, err := json.Marshal(params)
+	if err != nil {
+		return nil, err
+	}
+
+	// The job and its items are created together so that a runner never
+	// claims a job that's missing some of its items
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(
 		ctx,
-		getDeviceServiceStateCountsByApplication,
+		createJob,
+		id,
 		projectID,
-		applicationID,
-	)
-	if err != nil {
-		return nil, errors.Wrap(err, "query device service states by application")
+		string(jobType),
+		string(paramsBytes),
+		len(items),
+	); err != nil {
+		return nil, err
 	}
-	defer serviceStateCountRows.Close()
 
-	serviceStateCounts := make([]models.ServiceStateCount, 0)
-	for serviceStateCountRows.Next() {
-		ServiceStateCount, err := s.scanServiceStateCount(serviceStateCountRows)
-		if err != nil {
+	for position := 0; position < len(items); position += jobItemsBatchSize {
+		batch := items[position:]
+		if len(batch) > jobItemsBatchSize {
+			batch = batch[:jobItemsBatchSize]
+		}
+
+		placeholders := make([]string, len(batch))
+		args := make([]interface{}, 0, len(batch)*6)
+		for i, item := range batch {
+			placeholders[i] = "(?, ?, ?, ?, ?, ?)"
+			args = append(args,
+				id,
+				item.ItemID,
+				position+i,
+				item.Name,
+				string(models.JobItemStatusPending),
+				"",
+			)
+		}
+
+		if _, err := tx.ExecContext(ctx,
+			fmt.Sprintf(createJobItems, strings.Join(placeholders, ", ")), args...); err != nil {
 			return nil, err
 		}
-		serviceStateCounts = append(serviceStateCounts, *ServiceStateCount)
 	}
-	if err := serviceStateCountRows.Err(); err != nil {
+
+	if err := tx.Commit(); err != nil {
 		return nil, err
 	}
 
-	return serviceStateCounts, nil
+	return s.GetJob(ctx, id, projectID)
 }
 
-func (s *Store) ListDeviceServiceStates(ctx context.Context, projectID, deviceID string) ([]models.DeviceServiceState, error) {
-	deviceServiceStateRows, err := s.db.QueryContext(ctx, listDeviceServiceStates, projectID, deviceID)
+func (s *Store) GetJob(ctx context.Context, id, projectID string) (*models.Job, error) {
+	jobRow := s.db.QueryRowContext(ctx, getJob, id, projectID)
+
+	job, err := s.scanJob(jobRow)
+	if err == sql.ErrNoRows {
+		return nil, store.ErrJobNotFound
+	} else if err != nil {
+		return nil, err
+	}
+
+	return job, nil
+}
+
+func (s *Store) ListJobs(ctx context.Context, projectID string) ([]models.Job, error) {
+	jobRows, err := s.db.QueryContext(ctx, listJobs, projectID)
 	if err != nil {
-		return nil, errors.Wrap(err, "query device service states")
+		return nil, errors.Wrap(err, "query jobs")
 	}
-	defer deviceServiceStateRows.Close()
+	defer jobRows.Close()
 
-	deviceServiceStates := make([]models.DeviceServiceState, 0)
-	for deviceServiceStateRows.Next() {
-		deviceServiceState, err := s.scanDeviceServiceState(deviceServiceStateRows)
+	jobs := make([]models.Job, 0)
+	for jobRows.Next() {
+		job, err := s.scanJob(jobRows)
 		if err != nil {
 			return nil, err
 		}
-		deviceServiceStates = append(deviceServiceStates, *deviceServiceState)
+		jobs = append(jobs, *job)
 	}
 
-	if err := deviceServiceStateRows.Err(); err != nil {
+	if err := jobRows.Err(); err != nil {
 		return nil, err
 	}
 
-	return deviceServiceStates, nil
+	return jobs, nil
 }
 
-func (s *Store) ListAllDeviceServiceStates(ctx context.Context, projectID string) ([]models.DeviceServiceState, error) {
-	deviceServiceStateRows, err := s.db.QueryContext(ctx, listAllDeviceServiceStates, projectID)
+func (s *Store) ListJobItems(ctx context.Context, id, projectID string) ([]models.JobItem, error) {
+	return s.listJobItems(ctx, listJobItems, id, projectID)
+}
+
+func (s *Store) ListPendingJobItems(ctx context.Context, id, projectID string, limit int) ([]models.JobItem, error) {
+	return s.listJobItems(ctx, listPendingJobItems, id, projectID, limit)
+}
+
+func (s *Store) listJobItems(ctx context.Context, query string, args ...interface{}) ([]models.JobItem, error) {
+	jobItemRows, err := s.db.QueryContext(ctx, query, args...)
 	if err != nil {
-		return nil, errors.Wrap(err, "query all device service states")
+		return nil, errors.Wrap(err, "query job items")
 	}
-	defer deviceServiceStateRows.Close()
+	defer jobItemRows.Close()
 
-	deviceServiceStates := make([]models.DeviceServiceState, 0)
-	for deviceServiceStateRows.Next() {
-		deviceServiceState, err := s.scanDeviceServiceState(deviceServiceStateRows)
+	jobItems := make([]models.JobItem, 0)
+	for jobItemRows.Next() {
+		jobItem, err := s.scanJobItem(jobItemRows)
 		if err != nil {
 			return nil, err
 		}
-		deviceServiceStates = append(deviceServiceStates, *deviceServiceState)
+		jobItems = append(jobItems, *jobItem)
 	}
 
-	if err := deviceServiceStateRows.Err(); err != nil {
+	if err := jobItemRows.Err(); err != nil {
 		return nil, err
 	}
 
-	return deviceServiceStates, nil
+	return jobItems, nil
 }
 
-func (s *Store) DeleteDeviceServiceState(ctx context.Context, projectID, deviceID, applicationID, service string) error {
-	_, err := s.db.ExecContext(
+func (s *Store) CancelJob(ctx context.Context, id, projectID string) (*models.Job, error) {
+	if _, err := s.db.ExecContext(
 		ctx,
-		deleteDeviceServiceState,
+		cancelJob,
+		id,
 		projectID,
-		deviceID,
-		applicationID,
-		service,
-	)
-	return err
-}
-
-func (s *Store) scanDeviceServiceState(scanner scanner) (*models.DeviceServiceState, error) {
-	var deviceServiceState models.DeviceServiceState
-	if err := scanner.Scan(
-		&deviceServiceState.ProjectID,
-		&deviceServiceState.DeviceID,
-		&deviceServiceState.ApplicationID,
-		&deviceServiceState.Service,
-		&deviceServiceState.State,
-		&deviceServiceState.ErrorMessage,
 	); err != nil {
 		return nil, err
 	}
 
-	return &deviceServiceState, nil
+	return s.GetJob(ctx, id, projectID)
 }
 
-func (s *Store) scanProjectConfig(scanner scanner) (*models.ProjectConfig, error) {
-	var projectConfig models.ProjectConfig
-	if err := scanner.Scan(
-		&projectConfig.ProjectID,
-		&projectConfig.Key,
-		&projectConfig.Value,
-	); err != nil {
-		return nil, err
-	}
-
-	return &projectConfig, nil
-}
+func (s *Store) ClaimJob(ctx context.Context, lease time.Duration) (*models.Job, error) {
+	claimID := newJobClaimID()
 
-func (s *Store) scanDeviceMetricsConfig(scanner scanner) (*models.DeviceMetricsConfig, error) {
-	pConfig, err := s.scanProjectConfig(scanner)
+	result, err := s.db.ExecContext(
+		ctx,
+		claimJob,
+		claimID,
+		int64(lease/time.Second),
+	)
 	if err != nil {
 		return nil, err
 	}
 
-	var dmc models.DeviceMetricsConfig
-	err = json.Unmarshal([]byte(pConfig.Value), &dmc)
+	rowsAffected, err := result.RowsAffected()
 	if err != nil {
 		return nil, err
 	}
-
-	return &dmc, nil
-}
-
-func (s *Store) scanServiceMetricsConfig(scanner scanner) ([]models.ServiceMetricsConfig, error) {
-	pConfig, err := s.scanProjectConfig(scanner)
-	if err != nil {
-		return nil, err
+	if rowsAffected == 0 {
+		return nil, store.ErrJobNotFound
 	}
 
-	var smc []models.ServiceMetricsConfig
-	err = json.Unmarshal([]byte(pConfig.Value), &smc)
-	if err != nil {
+	jobRow := s.db.QueryRowContext(ctx, getJobByClaim, claimID)
+
+	job, err := s.scanJob(jobRow)
+	if err == sql.ErrNoRows {
+		return nil, store.ErrJobNotFound
+	} else if err != nil {
 		return nil, err
 	}
 
-	return smc, nil
+	return job, nil
 }
 
-func (s *Store) scanProjectMetricsConfig(scanner scanner) (*models.ProjectMetricsConfig, error) {
-	pConfig, err := s.scanProjectConfig(scanner)
-	if err != nil {
+func (s *Store) RenewJobLease(ctx context.Context, id, claimID string, lease time.Duration) (*models.Job, error) {
+	if _, err := s.db.ExecContext(
+		ctx,
+		renewJobLease,
+		int64(lease/time.Second),
+		id,
+		claimID,
+	); err != nil {
 		return nil, err
 	}
 
-	var pmc models.ProjectMetricsConfig
-	err = json.Unmarshal([]byte(pConfig.Value), &pmc)
-	if err != nil {
+	// Rows that are updated to the same values aren't counted as affected, so
+	// the claim is checked separately
+	jobRow := s.db.QueryRowContext(ctx, getClaimedJob, id, claimID)
+
+	job, err := s.scanJob(jobRow)
+	if err == sql.ErrNoRows {
+		return nil, store.ErrJobNotFound
+	} else if err != nil {
 		return nil, err
 	}
 
-	return &pmc, nil
+	return job, nil
 }
 
-func (s *Store) SetServiceMetricsConfigs(ctx context.Context, projectID string, value []models.ServiceMetricsConfig) error {
-	valueBytes, err := json.Marshal(value)
-	if err != nil {
-		return err
-	}
-
-	_, err = s.db.ExecContext(
+func (s *Store) SetJobItemResult(ctx context.Context, id, itemID string, status models.JobItemStatus, errorMessage string) error {
+	_, err := s.db.ExecContext(
 		ctx,
-		setProjectConfig,
-		projectID,
-		models.ServiceMetricsConfigKey,
-		valueBytes,
+		setJobItemResult,
+		string(status),
+		errorMessage,
+		id,
+		itemID,
 	)
 	return err
 }
 
-func (s *Store) GetServiceMetricsConfigs(ctx context.Context, projectID string) ([]models.ServiceMetricsConfig, error) {
-	smcRow := s.db.QueryRowContext(
+func (s *Store) FinishJob(ctx context.Context, id, claimID string, status models.JobStatus, errorMessage string) error {
+	_, err := s.db.ExecContext(
 		ctx,
-		getProjectConfig,
-		projectID,
-		models.ServiceMetricsConfigKey,
+		finishJob,
+		string(status),
+		errorMessage,
+		id,
+		claimID,
 	)
-
-	smc, err := s.scanServiceMetricsConfig(smcRow)
-	if err == sql.ErrNoRows {
-		return make([]models.ServiceMetricsConfig, 0), nil
-	} else if err != nil {
-		return nil, err
-	}
-
-	return smc, nil
+	return err
 }
 
-func (s *Store) SetProjectMetricsConfig(ctx context.Context, projectID string, value models.ProjectMetricsConfig) error {
-	valueBytes, err := json.Marshal(value)
-	if err != nil {
-		return err
-	}
-
-	_, err = s.db.ExecContext(
+func (s *Store) DeleteJobsFinishedBefore(ctx context.Context, before time.Time) error {
+	_, err := s.db.ExecContext(
 		ctx,
-		setProjectConfig,
-		projectID,
-		models.ProjectMetricsConfigKey,
-		valueBytes,
+		deleteJobsFinishedBefore,
+		before,
 	)
 	return err
 }
 
-func (s *Store) GetProjectMetricsConfig(ctx context.Context, projectID string) (*models.ProjectMetricsConfig, error) {
-	pmcRow := s.db.QueryRowContext(
-		ctx,
-		getProjectConfig,
-		projectID,
-		models.ProjectMetricsConfigKey,
-	)
+func (s *Store) scanJob(scanner scanner) (*models.Job, error) {
+	var paramsString string
 
-	pmc, err := s.scanProjectMetricsConfig(pmcRow)
-	if err == sql.ErrNoRows {
-		return &models.ProjectMetricsConfig{
-			ExposedMetrics: make([]models.ExposedMetric, 0),
-		}, nil
-	} else if err != nil {
+	var job models.Job
+	if err := scanner.Scan(
+		&job.ID,
+		&job.CreatedAt,
+		&job.ProjectID,
+		&job.Type,
+		&paramsString,
+		&job.Status,
+		&job.CancelRequested,
+		&job.Error,
+		&job.ItemCount,
+		&job.SucceededCount,
+		&job.FailedCount,
+		&job.StartedAt,
+		&job.FinishedAt,
+		&job.ClaimID,
+	); err != nil {
 		return nil, err
 	}
 
-	return pmc, nil
-}
-
-func (s *Store) SetDeviceMetricsConfig(ctx context.Context, projectID string, value models.DeviceMetricsConfig) error {
-	valueBytes, err := json.Marshal(value)
-	if err != nil {
-		return err
+	if err := json.Unmarshal([]byte(paramsString), &job.Params); err != nil {
+		return nil, err
+	}
+	if job.Params == nil {
+		job.Params = map[string]interface{}{}
 	}
 
-	_, err = s.db.ExecContext(
-		ctx,
-		setProjectConfig,
-		projectID,
-		models.DeviceMetricsConfigKey,
-		valueBytes,
-	)
-	return err
+	return &job, nil
 }
 
-func (s *Store) GetDeviceMetricsConfig(ctx context.Context, projectID string) (*models.DeviceMetricsConfig, error) {
-	dmcRow := s.db.QueryRowContext(
-		ctx,
-		getProjectConfig,
-		projectID,
-		models.DeviceMetricsConfigKey,
-	)
-
-	dmc, err := s.scanDeviceMetricsConfig(dmcRow)
-	if err == sql.ErrNoRows {
-		return &models.DeviceMetricsConfig{
-			ExposedMetrics: make([]models.ExposedMetric, 0),
-		}, nil
-	} else if err != nil {
+func (s *Store) scanJobItem(scanner scanner) (*models.JobItem, error) {
+	var jobItem models.JobItem
+	if err := scanner.Scan(
+		&jobItem.JobID,
+		&jobItem.ItemID,
+		&jobItem.Name,
+		&jobItem.Status,
+		&jobItem.Error,
+		&jobItem.UpdatedAt,
+	); err != nil {
 		return nil, err
 	}
 
-	return dmc, nil
+	return &jobItem, nil
 }
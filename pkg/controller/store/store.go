@@ -3,6 +3,7 @@ package store
 import (
 	"context"
 	"errors"
+	"time"
 
 	"github.com/deviceplane/deviceplane/pkg/models"
 )
@@ -28,6 +29,7 @@ type ExternalUsers interface {
 	CreateExternalUser(ctx context.Context, providerName, providerID, email string, info map[string]interface{}) (*models.ExternalUser, error)
 	GetExternalUser(ctx context.Context, id string) (*models.ExternalUser, error)
 	GetExternalUserByProviderID(ctx context.Context, providerName, providerID string) (*models.ExternalUser, error)
+	UpdateExternalUser(ctx context.Context, id, email string, info map[string]interface{}) (*models.ExternalUser, error)
 }
 
 var ErrUserNotFound = errors.New("user not found")
@@ -49,29 +51,100 @@ type PasswordRecoveryTokens interface {
 var ErrPasswordRecoveryTokenNotFound = errors.New("password recovery token not found")
 
 type Sessions interface {
-	CreateSession(ctx context.Context, userID string, hash string) (*models.Session, error)
+	CreateSession(ctx context.Context, userID string, hash string, expiresAt time.Time, ip, userAgent string) (*models.Session, error)
 	GetSession(ctx context.Context, id string) (*models.Session, error)
-	ValidateSession(ctx context.Context, hash string) (*models.Session, error)
+	ValidateSession(ctx context.Context, hash string, expiresAt time.Time, ip, userAgent string) (*models.Session, error)
+	ListSessions(ctx context.Context, userID string) ([]models.Session, error)
 	DeleteSession(ctx context.Context, id string) error
+	DeleteUserSessions(ctx context.Context, userID string) error
 }
 
 var ErrSessionNotFound = errors.New("session not found")
 
 type UserAccessKeys interface {
-	CreateUserAccessKey(ctx context.Context, userID string, hash, description string) (*models.UserAccessKey, error)
+	CreateUserAccessKey(ctx context.Context, userID string, hash, description string, expiresAt *time.Time, config *string) (*models.UserAccessKey, error)
 	GetUserAccessKey(ctx context.Context, id string) (*models.UserAccessKey, error)
-	ValidateUserAccessKey(ctx context.Context, hash string) (*models.UserAccessKey, error)
+	ValidateUserAccessKey(ctx context.Context, hash, ip string) (*models.UserAccessKey, error)
 	ListUserAccessKeys(ctx context.Context, userID string) ([]models.UserAccessKey, error)
 	DeleteUserAccessKey(ctx context.Context, id string) error
 }
 
 var ErrUserAccessKeyNotFound = errors.New("user access key not found")
 
+type UserTOTPs interface {
+	SetUserTOTPSecret(ctx context.Context, userID, secret string) (*models.UserTOTP, error)
+	GetUserTOTP(ctx context.Context, userID string) (*models.UserTOTP, error)
+	EnableUserTOTP(ctx context.Context, userID string) (*models.UserTOTP, error)
+	// UseUserTOTPCounter records the time step of a code that was accepted.
+	// It returns ErrUserTOTPCodeUsed if a code from the same or a later step
+	// was already accepted.
+	UseUserTOTPCounter(ctx context.Context, userID string, counter int64) error
+	// RecordUserTOTPFailure counts a failed attempt and locks out further
+	// attempts for a while after too many in a row.
+	RecordUserTOTPFailure(ctx context.Context, userID string, maxAttempts int, lockout time.Duration) error
+	ResetUserTOTPFailures(ctx context.Context, userID string) error
+	DeleteUserTOTP(ctx context.Context, userID string) error
+}
+
+var ErrUserTOTPNotFound = errors.New("user TOTP not found")
+
+var ErrUserTOTPCodeUsed = errors.New("user TOTP code already used")
+
+type UserRecoveryCodes interface {
+	SetUserRecoveryCodes(ctx context.Context, userID string, hashes []string) error
+	UseUserRecoveryCode(ctx context.Context, userID, hash string) error
+}
+
+var ErrUserRecoveryCodeNotFound = errors.New("user recovery code not found")
+
+type Organizations interface {
+	CreateOrganization(ctx context.Context, name, billingEmail string) (*models.Organization, error)
+	GetOrganization(ctx context.Context, id string) (*models.Organization, error)
+	LookupOrganization(ctx context.Context, name string) (*models.Organization, error)
+	UpdateOrganization(ctx context.Context, id, name, billingEmail string) (*models.Organization, error)
+	DeleteOrganization(ctx context.Context, id string) error
+}
+
+var ErrOrganizationNotFound = errors.New("organization not found")
+var ErrOrganizationNameAlreadyInUse = errors.New("organization name already in use")
+
+type OrganizationMemberships interface {
+	CreateOrganizationMembership(ctx context.Context, userID, organizationID string) (*models.OrganizationMembership, error)
+	GetOrganizationMembership(ctx context.Context, userID, organizationID string) (*models.OrganizationMembership, error)
+	ListOrganizationMembershipsByUser(ctx context.Context, userID string) ([]models.OrganizationMembership, error)
+	ListOrganizationMembershipsByOrganization(ctx context.Context, organizationID string) ([]models.OrganizationMembership, error)
+	DeleteOrganizationMembership(ctx context.Context, userID, organizationID string) error
+}
+
+var ErrOrganizationMembershipNotFound = errors.New("organization membership not found")
+
+type OrganizationRoles interface {
+	CreateOrganizationRole(ctx context.Context, organizationID, name, description, config string) (*models.OrganizationRole, error)
+	GetOrganizationRole(ctx context.Context, id, organizationID string) (*models.OrganizationRole, error)
+	LookupOrganizationRole(ctx context.Context, name, organizationID string) (*models.OrganizationRole, error)
+	ListOrganizationRoles(ctx context.Context, organizationID string) ([]models.OrganizationRole, error)
+	UpdateOrganizationRole(ctx context.Context, id, organizationID, name, description, config string) (*models.OrganizationRole, error)
+	DeleteOrganizationRole(ctx context.Context, id, organizationID string) error
+}
+
+var ErrOrganizationRoleNotFound = errors.New("organization role not found")
+var ErrOrganizationRoleNameAlreadyInUse = errors.New("organization role name already in use")
+
+type OrganizationMembershipRoleBindings interface {
+	CreateOrganizationMembershipRoleBinding(ctx context.Context, userID, roleID, organizationID string) (*models.OrganizationMembershipRoleBinding, error)
+	GetOrganizationMembershipRoleBinding(ctx context.Context, userID, roleID, organizationID string) (*models.OrganizationMembershipRoleBinding, error)
+	ListOrganizationMembershipRoleBindings(ctx context.Context, userID, organizationID string) ([]models.OrganizationMembershipRoleBinding, error)
+	DeleteOrganizationMembershipRoleBinding(ctx context.Context, userID, roleID, organizationID string) error
+}
+
+var ErrOrganizationMembershipRoleBindingNotFound = errors.New("organization membership role binding not found")
+
 type Projects interface {
-	CreateProject(ctx context.Context, name string) (*models.Project, error)
+	CreateProject(ctx context.Context, name string, organizationID *string) (*models.Project, error)
 	GetProject(ctx context.Context, id string) (*models.Project, error)
 	LookupProject(ctx context.Context, name string) (*models.Project, error)
 	ListProjects(ctx context.Context) ([]models.Project, error)
+	ListProjectsByOrganization(ctx context.Context, organizationID string) ([]models.Project, error)
 	UpdateProject(ctx context.Context, id, name, datadogApiKey string) (*models.Project, error)
 	DeleteProject(ctx context.Context, id string) error
 }
@@ -118,6 +191,33 @@ type MembershipRoleBindings interface {
 
 var ErrMembershipRoleBindingNotFound = errors.New("membership role binding not found")
 
+type SsoGroupMappings interface {
+	CreateSsoGroupMapping(ctx context.Context, projectID, group, roleID string) (*models.SsoGroupMapping, error)
+	GetSsoGroupMapping(ctx context.Context, id, projectID string) (*models.SsoGroupMapping, error)
+	ListSsoGroupMappings(ctx context.Context, projectID string) ([]models.SsoGroupMapping, error)
+	ListSsoGroupMappingsByGroups(ctx context.Context, groups []string) ([]models.SsoGroupMapping, error)
+	DeleteSsoGroupMapping(ctx context.Context, id, projectID string) error
+}
+
+var ErrSsoGroupMappingNotFound = errors.New("SSO group mapping not found")
+
+// SsoManagedRoleBindings records the membership role bindings that were
+// created from SSO group mappings. Records are removed along with the role
+// binding they refer to.
+type SsoManagedRoleBindings interface {
+	CreateSsoManagedRoleBinding(ctx context.Context, userID, roleID, projectID string) error
+	ListSsoManagedRoleBindingsByUser(ctx context.Context, userID string) ([]models.MembershipRoleBinding, error)
+}
+
+// UserSsoGroups records the SSO groups that each user was in when they last
+// logged in, so that group mappings can be applied again without them.
+type UserSsoGroups interface {
+	SetUserSsoGroups(ctx context.Context, userID string, groups []string) error
+	ListUserSsoGroups(ctx context.Context, userID string) ([]string, error)
+	ListUsersBySsoGroup(ctx context.Context, group string) ([]string, error)
+	ListUsersWithSsoGroupsSyncedBefore(ctx context.Context, before time.Time) ([]string, error)
+}
+
 type ServiceAccounts interface {
 	CreateServiceAccount(ctx context.Context, projectID, name, description string) (*models.ServiceAccount, error)
 	GetServiceAccount(ctx context.Context, id, projectID string) (*models.ServiceAccount, error)
@@ -131,9 +231,9 @@ var ErrServiceAccountNotFound = errors.New("service account not found")
 var ErrServiceAccountNameAlreadyInUse = errors.New("service account name already in use")
 
 type ServiceAccountAccessKeys interface {
-	CreateServiceAccountAccessKey(ctx context.Context, projectID, serviceAccountID string, hash, description string) (*models.ServiceAccountAccessKey, error)
+	CreateServiceAccountAccessKey(ctx context.Context, projectID, serviceAccountID string, hash, description string, expiresAt *time.Time, config *string) (*models.ServiceAccountAccessKey, error)
 	GetServiceAccountAccessKey(ctx context.Context, id, projectID string) (*models.ServiceAccountAccessKey, error)
-	ValidateServiceAccountAccessKey(ctx context.Context, hash string) (*models.ServiceAccountAccessKey, error)
+	ValidateServiceAccountAccessKey(ctx context.Context, hash, ip string) (*models.ServiceAccountAccessKey, error)
 	ListServiceAccountAccessKeys(ctx context.Context, projectID, serviceAccountID string) ([]models.ServiceAccountAccessKey, error)
 	DeleteServiceAccountAccessKey(ctx context.Context, id, projectID string) error
 }
@@ -154,6 +254,7 @@ type Devices interface {
 	GetDevice(ctx context.Context, deviceID, projectID string) (*models.Device, error)
 	LookupDevice(ctx context.Context, name, projectID string) (*models.Device, error)
 	ListDevices(ctx context.Context, projectID, searchQuery string) ([]models.Device, error)
+	QueryDevices(ctx context.Context, projectID string, deviceQuery DeviceQuery) (*DevicePage, error)
 	UpdateDeviceName(ctx context.Context, deviceID, projectID, name string) (*models.Device, error)
 	DeleteDevice(ctx context.Context, deviceID, projectID string) error
 	SetDeviceInfo(ctx context.Context, deviceID, projectID string, deviceInfo models.DeviceInfo) (*models.Device, error)
@@ -163,9 +264,42 @@ type Devices interface {
 	DeleteDeviceLabel(ctx context.Context, deviceID, projectID, key string) error
 	SetDeviceEnvironmentVariable(ctx context.Context, deviceID, projectID, key, value string) (*string, error)
 	DeleteDeviceEnvironmentVariable(ctx context.Context, deviceID, projectID, key string) error
+	SetDeviceQuarantined(ctx context.Context, deviceID, projectID string, quarantined bool) (*models.Device, error)
+}
+
+// DeviceQuery selects a page of a project's devices. Filters have the same
+// meaning as they do for query.QueryDevices.
+type DeviceQuery struct {
+	SearchQuery string
+	Filters     models.Query
+	// OrderBy is the JSON name of a device field. Devices are ordered by ID
+	// when it's empty.
+	OrderBy    string
+	Descending bool
+	// After is the ID of the last device on the previous page
+	After string
+	// Every device is returned when PageSize is zero
+	PageSize int
+}
+
+// DevicePage is the result of a DeviceQuery. When the store can't apply some
+// of the filters, or the ordering, Paginated is false and Devices has every
+// device that matches the other filters, in no particular order. The filters
+// that still need to be applied are in Unapplied.
+type DevicePage struct {
+	Devices []models.Device
+	// TotalCount is the number of devices that match the search query,
+	// regardless of the filters
+	TotalCount int
+	// MatchingCount is the number of devices on all pages, and is only set
+	// when Paginated is true
+	MatchingCount int
+	Paginated     bool
+	Unapplied     models.Query
 }
 
 var ErrDeviceNotFound = errors.New("device not found")
+var ErrDevicePageNotFound = errors.New("requested page not found")
 var ErrDeviceNameAlreadyInUse = errors.New("device name already in use")
 
 type DeviceRegistrationTokens interface {
@@ -191,11 +325,24 @@ var ErrDeviceRegistrationTokenNameAlreadyInUse = errors.New("device registration
 type DeviceAccessKeys interface {
 	CreateDeviceAccessKey(ctx context.Context, projectID, deviceID, hash string) (*models.DeviceAccessKey, error)
 	GetDeviceAccessKey(ctx context.Context, id, projectID string) (*models.DeviceAccessKey, error)
+	ListDeviceAccessKeys(ctx context.Context, projectID, deviceID string) ([]models.DeviceAccessKey, error)
 	ValidateDeviceAccessKey(ctx context.Context, projectID, hash string) (*models.DeviceAccessKey, error)
+	CreateDeviceCertificateAccessKey(ctx context.Context, projectID, deviceID, fingerprintHash string) (*models.DeviceAccessKey, error)
+	RotateDeviceAccessKey(ctx context.Context, id, projectID, hash string) (*models.DeviceAccessKey, error)
+	CompleteDeviceAccessKeyRotation(ctx context.Context, id, projectID string) error
+	RevokeDeviceAccessKey(ctx context.Context, id, projectID string) error
+	RevokeDeviceAccessKeys(ctx context.Context, projectID, deviceID string) error
 }
 
 var ErrDeviceAccessKeyNotFound = errors.New("device access key not found")
 
+type DeviceCertificateAuthorities interface {
+	CreateDeviceCertificateAuthority(ctx context.Context, projectID, certificate, privateKey string) (*models.DeviceCertificateAuthority, error)
+	GetDeviceCertificateAuthority(ctx context.Context, projectID string) (*models.DeviceCertificateAuthority, error)
+}
+
+var ErrDeviceCertificateAuthorityNotFound = errors.New("device certificate authority not found")
+
 type Connections interface {
 	CreateConnection(ctx context.Context, projectID, name string, protocol models.Protocol, port uint) (*models.Connection, error)
 	GetConnection(ctx context.Context, id, projectID string) (*models.Connection, error)
@@ -208,6 +355,18 @@ type Connections interface {
 var ErrConnectionNotFound = errors.New("connection not found")
 var ErrConnectionNameAlreadyInUse = errors.New("connection name already in use")
 
+type DeviceGroups interface {
+	CreateDeviceGroup(ctx context.Context, projectID, name, description string, query models.Query) (*models.DeviceGroup, error)
+	GetDeviceGroup(ctx context.Context, id, projectID string) (*models.DeviceGroup, error)
+	LookupDeviceGroup(ctx context.Context, name, projectID string) (*models.DeviceGroup, error)
+	ListDeviceGroups(ctx context.Context, projectID string) ([]models.DeviceGroup, error)
+	UpdateDeviceGroup(ctx context.Context, id, projectID, name, description string, query models.Query) (*models.DeviceGroup, error)
+	DeleteDeviceGroup(ctx context.Context, id, projectID string) error
+}
+
+var ErrDeviceGroupNotFound = errors.New("device group not found")
+var ErrDeviceGroupNameAlreadyInUse = errors.New("device group name already in use")
+
 type Applications interface {
 	CreateApplication(ctx context.Context, projectID, name, description string) (*models.Application, error)
 	GetApplication(ctx context.Context, id, projectID string) (*models.Application, error)
@@ -275,6 +434,21 @@ var ErrDeviceServiceStateNotFound = errors.New("device service state not found")
 
 var ErrProjectConfigNotFound = errors.New("project config not found")
 
+type SecurityConfigs interface {
+	GetSecurityConfig(ctx context.Context, projectID string) (*models.SecurityConfig, error)
+	SetSecurityConfig(ctx context.Context, projectID string, value models.SecurityConfig) error
+}
+
+type StoredMetrics interface {
+	CreateMetricSeries(ctx context.Context, series models.MetricSeries) error
+	ListMetricSeries(ctx context.Context, projectID, metric string) ([]models.MetricSeries, error)
+	DeleteEmptyMetricSeries(ctx context.Context) error
+	AddMetricPoints(ctx context.Context, points []models.MetricPoint) error
+	ListMetricPoints(ctx context.Context, seriesIDs []string, resolution, start, end int64) ([]models.MetricPoint, error)
+	DownsampleMetricPoints(ctx context.Context, fromResolution, toResolution, start, end int64) error
+	DeleteMetricPoints(ctx context.Context, resolution, before int64) error
+}
+
 type MetricConfigs interface {
 	GetProjectMetricsConfig(ctx context.Context, projectID string) (*models.ProjectMetricsConfig, error)
 	SetProjectMetricsConfig(ctx context.Context, projectID string, value models.ProjectMetricsConfig) error
@@ -282,4 +456,26 @@ type MetricConfigs interface {
 	SetDeviceMetricsConfig(ctx context.Context, projectID string, value models.DeviceMetricsConfig) error
 	GetServiceMetricsConfigs(ctx context.Context, projectID string) ([]models.ServiceMetricsConfig, error)
 	SetServiceMetricsConfigs(ctx context.Context, projectID string, value []models.ServiceMetricsConfig) error
+	GetMetricsSinkConfig(ctx context.Context, projectID string) (*models.MetricsSinkConfig, error)
+	SetMetricsSinkConfig(ctx context.Context, projectID string, value models.MetricsSinkConfig) error
 }
+
+type Jobs interface {
+	CreateJob(ctx context.Context, projectID string, jobType models.JobType, params map[string]interface{}, items []models.JobItem) (*models.Job, error)
+	GetJob(ctx context.Context, id, projectID string) (*models.Job, error)
+	ListJobs(ctx context.Context, projectID string) ([]models.Job, error)
+	ListJobItems(ctx context.Context, id, projectID string) ([]models.JobItem, error)
+	ListPendingJobItems(ctx context.Context, id, projectID string, limit int) ([]models.JobItem, error)
+	CancelJob(ctx context.Context, id, projectID string) (*models.Job, error)
+	// ClaimJob claims a pending job, or a running job whose lease has expired,
+	// from any project. It returns ErrJobNotFound if there's nothing to claim.
+	ClaimJob(ctx context.Context, lease time.Duration) (*models.Job, error)
+	// RenewJobLease extends the lease on a claimed job and returns it, or
+	// ErrJobNotFound if the claim has been lost.
+	RenewJobLease(ctx context.Context, id, claimID string, lease time.Duration) (*models.Job, error)
+	SetJobItemResult(ctx context.Context, id, itemID string, status models.JobItemStatus, errorMessage string) error
+	FinishJob(ctx context.Context, id, claimID string, status models.JobStatus, errorMessage string) error
+	DeleteJobsFinishedBefore(ctx context.Context, before time.Time) error
+}
+
+var ErrJobNotFound = errors.New("job not found")
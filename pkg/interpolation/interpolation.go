@@ -139,3 +139,24 @@ func validVariableNameChar(c uint8) bool {
 func isNum(c uint8) bool {
 	return c >= '0' && c <= '9'
 }
+
+// Variables returns the names of the variables referenced in s, in order of
+// first appearance, without requiring any of them to be defined.
+func Variables(s string) ([]string, error) {
+	var variables []string
+	seen := make(map[string]bool)
+	_, success, err := interpolate(s, func(variable string) (string, error) {
+		if !seen[variable] {
+			seen[variable] = true
+			variables = append(variables, variable)
+		}
+		return "", nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if !success {
+		return nil, errInvalidInterpolation
+	}
+	return variables, nil
+}
@@ -76,3 +76,16 @@ func TestParseLine(t *testing.T) {
 	testInvalidInterpolate(t, "${A!}")
 	testInvalidInterpolate(t, "$!")
 }
+
+func TestVariables(t *testing.T) {
+	variables, err := Variables("image: $IMAGE:${TAG}\nenvironment:\n- A=$$B\n- C=${IMAGE}")
+	require.NoError(t, err)
+	require.Equal(t, []string{"IMAGE", "TAG"}, variables)
+
+	variables, err = Variables("image: nginx")
+	require.NoError(t, err)
+	require.Len(t, variables, 0)
+
+	_, err = Variables("image: ${IMAGE")
+	require.Equal(t, errInvalidInterpolation, err)
+}
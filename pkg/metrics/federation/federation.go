@@ -0,0 +1,147 @@
+package federation
+
+import (
+	"io"
+	"sort"
+	"sync"
+
+	prometheus "github.com/prometheus/client_model/go"
+	"github.com/prometheus/common/expfmt"
+)
+
+const (
+	// UpMetric reports whether each target was scraped successfully, like
+	// Prometheus' own up metric
+	UpMetric = "deviceplane_federate_up"
+
+	// Labels that a target already has are renamed with this prefix when
+	// they clash with the injected ones, the same as Prometheus does when
+	// honor_labels is off
+	exportedLabelPrefix = "exported_"
+)
+
+// Merger combines scrapes of many targets into a single exposition. Every
+// metric from a target gets that target's labels, so that series from
+// different devices stay distinct.
+type Merger struct {
+	lock     sync.Mutex
+	families map[string]*prometheus.MetricFamily
+}
+
+func NewMerger() *Merger {
+	return &Merger{
+		families: make(map[string]*prometheus.MetricFamily),
+	}
+}
+
+// Add parses a scrape in the text exposition format and merges it in with
+// labels added to every metric. Metrics whose type differs from an earlier
+// target's metric of the same name are dropped.
+func (m *Merger) Add(r io.Reader, labels map[string]string) error {
+	parser := expfmt.TextParser{}
+	families, err := parser.TextToMetricFamilies(r)
+	if err != nil {
+		return err
+	}
+
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	for name, family := range families {
+		for _, metric := range family.Metric {
+			metric.Label = injectLabels(metric.Label, labels)
+		}
+		m.merge(name, family)
+	}
+
+	return nil
+}
+
+// AddUp records whether a target could be scraped.
+func (m *Merger) AddUp(labels map[string]string, up bool) {
+	name := UpMetric
+	help := "Whether the target was scraped successfully."
+	metricType := prometheus.MetricType_GAUGE
+	value := 0.0
+	if up {
+		value = 1
+	}
+
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	m.merge(name, &prometheus.MetricFamily{
+		Name: &name,
+		Help: &help,
+		Type: &metricType,
+		Metric: []*prometheus.Metric{
+			{
+				Label: injectLabels(nil, labels),
+				Gauge: &prometheus.Gauge{
+					Value: &value,
+				},
+			},
+		},
+	})
+}
+
+func (m *Merger) merge(name string, family *prometheus.MetricFamily) {
+	existing, ok := m.families[name]
+	if !ok {
+		m.families[name] = family
+		return
+	}
+	if existing.GetType() != family.GetType() {
+		return
+	}
+	existing.Metric = append(existing.Metric, family.Metric...)
+}
+
+// Write outputs everything merged so far in the text exposition format,
+// ordered by metric name.
+func (m *Merger) Write(w io.Writer) error {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	names := make([]string, 0, len(m.families))
+	for name := range m.families {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		if _, err := expfmt.MetricFamilyToText(w, m.families[name]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func injectLabels(existing []*prometheus.LabelPair, labels map[string]string) []*prometheus.LabelPair {
+	ret := make([]*prometheus.LabelPair, 0, len(existing)+len(labels))
+
+	for _, label := range existing {
+		if _, ok := labels[label.GetName()]; ok {
+			name := exportedLabelPrefix + label.GetName()
+			value := label.GetValue()
+			label = &prometheus.LabelPair{
+				Name:  &name,
+				Value: &value,
+			}
+		}
+		ret = append(ret, label)
+	}
+
+	for name, value := range labels {
+		name, value := name, value
+		ret = append(ret, &prometheus.LabelPair{
+			Name:  &name,
+			Value: &value,
+		})
+	}
+
+	sort.Slice(ret, func(i, j int) bool {
+		return ret[i].GetName() < ret[j].GetName()
+	})
+	return ret
+}
@@ -0,0 +1,47 @@
+package federation
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestMerger(t *testing.T) {
+	m := NewMerger()
+
+	require.NoError(t, m.Add(strings.NewReader(`# TYPE node_load1 gauge
+node_load1 0.5
+`), map[string]string{"device": "dev-1"}))
+
+	require.NoError(t, m.Add(strings.NewReader(`# TYPE node_load1 gauge
+node_load1{device="internal"} 1.5
+# TYPE node_load1_typo counter
+node_load1_typo 3
+`), map[string]string{"device": "dev-2"}))
+
+	// Conflicts with the type seen earlier, so it's dropped
+	require.NoError(t, m.Add(strings.NewReader(`# TYPE node_load1 counter
+node_load1 7
+`), map[string]string{"device": "dev-3"}))
+
+	m.AddUp(map[string]string{"device": "dev-4"}, false)
+
+	var buf bytes.Buffer
+	require.NoError(t, m.Write(&buf))
+	require.Equal(t, `# HELP deviceplane_federate_up Whether the target was scraped successfully.
+# TYPE deviceplane_federate_up gauge
+deviceplane_federate_up{device="dev-4"} 0
+# TYPE node_load1 gauge
+node_load1{device="dev-1"} 0.5
+node_load1{device="dev-2",exported_device="internal"} 1.5
+# TYPE node_load1_typo counter
+node_load1_typo{device="dev-2"} 3
+`, buf.String())
+}
+
+func TestMergerInvalidInput(t *testing.T) {
+	m := NewMerger()
+	require.Error(t, m.Add(strings.NewReader("not { valid"), nil))
+}
@@ -0,0 +1,91 @@
+package sink
+
+import (
+	"bytes"
+	"context"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/deviceplane/deviceplane/pkg/models"
+)
+
+// InfluxDB sends metrics in InfluxDB line protocol. The URL is the full write
+// endpoint, including the database or bucket, for example
+// http://influxdb:8086/write?db=deviceplane.
+type InfluxDB struct {
+	url     string
+	headers map[string]string
+	client  *http.Client
+}
+
+func NewInfluxDB(url string, headers map[string]string, client *http.Client) *InfluxDB {
+	return &InfluxDB{
+		url:     url,
+		headers: headers,
+		client:  client,
+	}
+}
+
+func (i *InfluxDB) PostMetrics(ctx context.Context, req models.DatadogPostMetricsRequest) error {
+	if len(req.Series) == 0 {
+		return nil
+	}
+
+	header := http.Header{}
+	header.Set("Content-Type", "text/plain; charset=utf-8")
+
+	return post(ctx, i.client, i.url, encodeLineProtocol(req.Series), header, i.headers)
+}
+
+var (
+	measurementEscaper = strings.NewReplacer(",", `\,`, " ", `\ `)
+	tagEscaper         = strings.NewReplacer(",", `\,`, " ", `\ `, "=", `\=`)
+)
+
+// encodeLineProtocol writes one line per point, with the metric name as the
+// measurement and its value in the "value" field:
+//
+//	deviceplane.device.cpu,host=dev_1 value=0.5 1577836800000000000
+func encodeLineProtocol(series models.DatadogSeries) []byte {
+	var buf bytes.Buffer
+
+	for _, metric := range series {
+		metricLabels := Labels(metric)
+		tagKeys := make([]string, 0, len(metricLabels))
+		for key := range metricLabels {
+			// Line protocol doesn't allow empty tag values
+			if metricLabels[key] != "" {
+				tagKeys = append(tagKeys, key)
+			}
+		}
+		sort.Strings(tagKeys)
+
+		var seriesKey strings.Builder
+		seriesKey.WriteString(measurementEscaper.Replace(metric.Metric))
+		for _, key := range tagKeys {
+			seriesKey.WriteByte(',')
+			seriesKey.WriteString(tagEscaper.Replace(key))
+			seriesKey.WriteByte('=')
+			seriesKey.WriteString(tagEscaper.Replace(metricLabels[key]))
+		}
+
+		for _, s := range Samples(metric) {
+			// Neither can be represented as a field value
+			if math.IsNaN(s.Value) || math.IsInf(s.Value, 0) {
+				continue
+			}
+
+			buf.WriteString(seriesKey.String())
+			buf.WriteString(" value=")
+			buf.WriteString(strconv.FormatFloat(s.Value, 'g', -1, 64))
+			buf.WriteByte(' ')
+			buf.WriteString(strconv.FormatInt(s.Timestamp.UnixNano(), 10))
+			buf.WriteByte('\n')
+		}
+	}
+
+	return buf.Bytes()
+}
@@ -0,0 +1,180 @@
+package sink
+
+import (
+	"context"
+	"encoding/json"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+
+	"github.com/deviceplane/deviceplane/pkg/models"
+)
+
+const (
+	otlpScopeName = "deviceplane"
+
+	// AGGREGATION_TEMPORALITY_DELTA, since Datadog counts are per interval
+	otlpAggregationTemporalityDelta = 1
+)
+
+// OTLP sends metrics to an OpenTelemetry collector using OTLP over HTTP with
+// JSON encoding. The URL is the full metrics endpoint, usually
+// http://collector:4318/v1/metrics.
+type OTLP struct {
+	url     string
+	headers map[string]string
+	client  *http.Client
+}
+
+func NewOTLP(url string, headers map[string]string, client *http.Client) *OTLP {
+	return &OTLP{
+		url:     url,
+		headers: headers,
+		client:  client,
+	}
+}
+
+func (o *OTLP) PostMetrics(ctx context.Context, req models.DatadogPostMetricsRequest) error {
+	if len(req.Series) == 0 {
+		return nil
+	}
+
+	reqBytes, err := json.Marshal(newOTLPRequest(req.Series))
+	if err != nil {
+		return err
+	}
+
+	header := http.Header{}
+	header.Set("Content-Type", "application/json")
+
+	return post(ctx, o.client, o.url, reqBytes, header, o.headers)
+}
+
+type otlpRequest struct {
+	ResourceMetrics []otlpResourceMetrics `json:"resourceMetrics"`
+}
+
+type otlpResourceMetrics struct {
+	Resource     otlpResource       `json:"resource"`
+	ScopeMetrics []otlpScopeMetrics `json:"scopeMetrics"`
+}
+
+type otlpResource struct {
+	Attributes []otlpAttribute `json:"attributes"`
+}
+
+type otlpScopeMetrics struct {
+	Scope   otlpScope    `json:"scope"`
+	Metrics []otlpMetric `json:"metrics"`
+}
+
+type otlpScope struct {
+	Name string `json:"name"`
+}
+
+type otlpMetric struct {
+	Name  string     `json:"name"`
+	Gauge *otlpGauge `json:"gauge,omitempty"`
+	Sum   *otlpSum   `json:"sum,omitempty"`
+}
+
+type otlpGauge struct {
+	DataPoints []otlpDataPoint `json:"dataPoints"`
+}
+
+type otlpSum struct {
+	DataPoints             []otlpDataPoint `json:"dataPoints"`
+	AggregationTemporality int             `json:"aggregationTemporality"`
+	IsMonotonic            bool            `json:"isMonotonic"`
+}
+
+type otlpDataPoint struct {
+	Attributes []otlpAttribute `json:"attributes"`
+	// 64 bit integers are encoded as strings in OTLP's JSON mapping
+	TimeUnixNano string  `json:"timeUnixNano"`
+	AsDouble     float64 `json:"asDouble"`
+}
+
+type otlpAttribute struct {
+	Key   string             `json:"key"`
+	Value otlpAttributeValue `json:"value"`
+}
+
+type otlpAttributeValue struct {
+	StringValue string `json:"stringValue"`
+}
+
+func newOTLPRequest(series models.DatadogSeries) otlpRequest {
+	metrics := make([]otlpMetric, 0, len(series))
+
+	for _, metric := range series {
+		metricLabels := Labels(metric)
+		keys := make([]string, 0, len(metricLabels))
+		for key := range metricLabels {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+
+		attributes := make([]otlpAttribute, 0, len(keys))
+		for _, key := range keys {
+			attributes = append(attributes, otlpAttribute{
+				Key: key,
+				Value: otlpAttributeValue{
+					StringValue: metricLabels[key],
+				},
+			})
+		}
+
+		var dataPoints []otlpDataPoint
+		for _, s := range Samples(metric) {
+			// JSON can't represent either
+			if math.IsNaN(s.Value) || math.IsInf(s.Value, 0) {
+				continue
+			}
+
+			dataPoints = append(dataPoints, otlpDataPoint{
+				Attributes:   attributes,
+				TimeUnixNano: strconv.FormatInt(s.Timestamp.UnixNano(), 10),
+				AsDouble:     s.Value,
+			})
+		}
+		if len(dataPoints) == 0 {
+			continue
+		}
+
+		otlpMetric := otlpMetric{
+			Name: metric.Metric,
+		}
+		if metric.Type == "count" {
+			otlpMetric.Sum = &otlpSum{
+				DataPoints:             dataPoints,
+				AggregationTemporality: otlpAggregationTemporalityDelta,
+				IsMonotonic:            true,
+			}
+		} else {
+			otlpMetric.Gauge = &otlpGauge{
+				DataPoints: dataPoints,
+			}
+		}
+		metrics = append(metrics, otlpMetric)
+	}
+
+	return otlpRequest{
+		ResourceMetrics: []otlpResourceMetrics{
+			{
+				Resource: otlpResource{
+					Attributes: []otlpAttribute{},
+				},
+				ScopeMetrics: []otlpScopeMetrics{
+					{
+						Scope: otlpScope{
+							Name: otlpScopeName,
+						},
+						Metrics: metrics,
+					},
+				},
+			},
+		},
+	}
+}
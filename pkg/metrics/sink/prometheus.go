@@ -0,0 +1,191 @@
+package sink
+
+import (
+	"context"
+	"encoding/binary"
+	"math"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/deviceplane/deviceplane/pkg/models"
+)
+
+// PrometheusRemoteWrite sends metrics to an endpoint that implements the
+// Prometheus remote write protocol, such as Prometheus itself, Cortex or
+// Thanos.
+type PrometheusRemoteWrite struct {
+	url     string
+	headers map[string]string
+	client  *http.Client
+}
+
+func NewPrometheusRemoteWrite(url string, headers map[string]string, client *http.Client) *PrometheusRemoteWrite {
+	return &PrometheusRemoteWrite{
+		url:     url,
+		headers: headers,
+		client:  client,
+	}
+}
+
+func (p *PrometheusRemoteWrite) PostMetrics(ctx context.Context, req models.DatadogPostMetricsRequest) error {
+	if len(req.Series) == 0 {
+		return nil
+	}
+
+	writeRequest := encodeWriteRequest(req.Series)
+
+	header := http.Header{}
+	header.Set("Content-Type", "application/x-protobuf")
+	header.Set("Content-Encoding", "snappy")
+	header.Set("X-Prometheus-Remote-Write-Version", "0.1.0")
+
+	return post(ctx, p.client, p.url, snappyEncode(writeRequest), header, p.headers)
+}
+
+// encodeWriteRequest builds a prometheus.WriteRequest protobuf message by
+// hand, since it's small and the generated code isn't vendored:
+//
+//	WriteRequest { repeated TimeSeries timeseries = 1; }
+//	TimeSeries   { repeated Label labels = 1; repeated Sample samples = 2; }
+//	Label        { string name = 1; string value = 2; }
+//	Sample       { double value = 1; int64 timestamp = 2; }
+func encodeWriteRequest(series models.DatadogSeries) []byte {
+	var writeRequest []byte
+
+	for _, metric := range series {
+		samples := Samples(metric)
+		if len(samples) == 0 {
+			continue
+		}
+
+		// Names are sanitized before they're sorted. When several names
+		// end up the same, the metric name wins and otherwise the value of
+		// the first original name in sorted order is kept, so the result
+		// doesn't depend on map iteration order.
+		originalLabels := Labels(metric)
+		originalNames := make([]string, 0, len(originalLabels))
+		for name := range originalLabels {
+			originalNames = append(originalNames, name)
+		}
+		sort.Strings(originalNames)
+
+		metricLabels := map[string]string{
+			"__name__": prometheusName(metric.Metric),
+		}
+		for _, originalName := range originalNames {
+			name := prometheusName(originalName)
+			if _, ok := metricLabels[name]; ok {
+				continue
+			}
+			metricLabels[name] = originalLabels[originalName]
+		}
+
+		// Remote write expects labels sorted by name. __name__ isn't
+		// necessarily first since uppercase letters sort before underscores.
+		labelNames := make([]string, 0, len(metricLabels))
+		for name := range metricLabels {
+			labelNames = append(labelNames, name)
+		}
+		sort.Strings(labelNames)
+
+		var timeSeries []byte
+		for _, name := range labelNames {
+			timeSeries = appendLabel(timeSeries, name, metricLabels[name])
+		}
+
+		for _, s := range samples {
+			var sample []byte
+			sample = appendUvarint(sample, 1<<3|wireFixed64)
+			sample = appendFixed64(sample, math.Float64bits(s.Value))
+			sample = appendUvarint(sample, 2<<3|wireVarint)
+			sample = appendUvarint(sample, uint64(s.Timestamp.UnixNano()/1e6))
+
+			timeSeries = appendBytesField(timeSeries, 2, sample)
+		}
+
+		writeRequest = appendBytesField(writeRequest, 1, timeSeries)
+	}
+
+	return writeRequest
+}
+
+const (
+	wireVarint  = 0
+	wireFixed64 = 1
+	wireBytes   = 2
+)
+
+func appendLabel(timeSeries []byte, name, value string) []byte {
+	var label []byte
+	label = appendBytesField(label, 1, []byte(name))
+	label = appendBytesField(label, 2, []byte(value))
+	return appendBytesField(timeSeries, 1, label)
+}
+
+func appendBytesField(b []byte, field uint64, value []byte) []byte {
+	b = appendUvarint(b, field<<3|wireBytes)
+	b = appendUvarint(b, uint64(len(value)))
+	return append(b, value...)
+}
+
+func appendUvarint(b []byte, x uint64) []byte {
+	var buf [binary.MaxVarintLen64]byte
+	n := binary.PutUvarint(buf[:], x)
+	return append(b, buf[:n]...)
+}
+
+func appendFixed64(b []byte, x uint64) []byte {
+	var buf [8]byte
+	binary.LittleEndian.PutUint64(buf[:], x)
+	return append(b, buf[:]...)
+}
+
+// prometheusName replaces the characters that Prometheus doesn't allow in
+// metric and label names, such as the dots in "deviceplane.device.cpu".
+func prometheusName(name string) string {
+	name = strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '_':
+			return r
+		default:
+			return '_'
+		}
+	}, name)
+	if name == "" || (name[0] >= '0' && name[0] <= '9') {
+		name = "_" + name
+	}
+	return name
+}
+
+// snappyEncode produces a snappy block made up only of literals. It doesn't
+// compress anything, but it's valid input for any snappy decoder and saves
+// vendoring a compression library for payloads this small.
+func snappyEncode(src []byte) []byte {
+	const maxLiteralLength = 1 << 16
+
+	dst := appendUvarint(nil, uint64(len(src)))
+
+	for len(src) > 0 {
+		n := len(src)
+		if n > maxLiteralLength {
+			n = maxLiteralLength
+		}
+
+		// Literal lengths are stored minus one, inline in the tag byte when
+		// they fit and in the following bytes otherwise
+		switch l := n - 1; {
+		case l < 60:
+			dst = append(dst, byte(l<<2))
+		case l < 1<<8:
+			dst = append(dst, 60<<2, byte(l))
+		default:
+			dst = append(dst, 61<<2, byte(l), byte(l>>8))
+		}
+
+		dst = append(dst, src[:n]...)
+		src = src[n:]
+	}
+
+	return dst
+}
@@ -0,0 +1,261 @@
+package sink
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/deviceplane/deviceplane/pkg/metrics/datadog"
+	"github.com/deviceplane/deviceplane/pkg/models"
+	"github.com/pkg/errors"
+)
+
+var (
+	ErrDatadogAPIKeyMissing = errors.New("project has no Datadog API key")
+	ErrUnknownSinkType      = errors.New("unknown metrics sink type")
+	ErrAddressNotAllowed    = errors.New("metrics sinks can't be sent to loopback, private or link-local addresses")
+)
+
+// StatusError is returned when a sink responds with an error status.
+type StatusError struct {
+	StatusCode int
+	Body       string
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("metrics sink responded with status %d: %s", e.StatusCode, e.Body)
+}
+
+// Permanent reports whether a sink rejected metrics in a way that sending
+// them again won't fix, such as a bad request or invalid credentials, or if
+// the sink isn't allowed at all. Anything else, including errors reaching
+// the sink, might succeed later.
+func Permanent(err error) bool {
+	err = errors.Cause(err)
+	if urlErr, ok := err.(*url.Error); ok {
+		err = urlErr.Err
+	}
+	if opErr, ok := err.(*net.OpError); ok {
+		err = opErr.Err
+	}
+
+	switch err := err.(type) {
+	case *StatusError:
+		return err.StatusCode >= 400 && err.StatusCode < 500 &&
+			err.StatusCode != http.StatusRequestTimeout && err.StatusCode != http.StatusTooManyRequests
+	default:
+		return err == ErrAddressNotAllowed
+	}
+}
+
+// Sink receives metrics that have already been filtered and tagged by
+// pkg/metrics/datadog/processing. Series stay in Datadog's format, since
+// that's what devices send, and each sink translates them on the way out.
+type Sink interface {
+	PostMetrics(ctx context.Context, req models.DatadogPostMetricsRequest) error
+}
+
+var (
+	httpClient = &http.Client{
+		Timeout: 30 * time.Second,
+	}
+
+	// Sink URLs are set by project admins, so by default they can't be used
+	// to reach the controller's own network. Addresses are checked once
+	// they're resolved, which covers redirects and DNS names that point at
+	// private addresses.
+	restrictedHTTPClient = &http.Client{
+		Timeout: 30 * time.Second,
+		Transport: &http.Transport{
+			DialContext: (&net.Dialer{
+				Timeout:   30 * time.Second,
+				KeepAlive: 30 * time.Second,
+				Control: func(network, address string, c syscall.RawConn) error {
+					host, _, err := net.SplitHostPort(address)
+					if err != nil {
+						return err
+					}
+					if !publicIP(net.ParseIP(host)) {
+						return ErrAddressNotAllowed
+					}
+					return nil
+				},
+			}).DialContext,
+			MaxIdleConns:          100,
+			IdleConnTimeout:       90 * time.Second,
+			TLSHandshakeTimeout:   10 * time.Second,
+			ExpectContinueTimeout: 1 * time.Second,
+		},
+	}
+)
+
+var privateNetworks = mustParseCIDRs(
+	"0.0.0.0/8",
+	"10.0.0.0/8",
+	"100.64.0.0/10",
+	"172.16.0.0/12",
+	"192.168.0.0/16",
+	"fc00::/7",
+)
+
+func mustParseCIDRs(cidrs ...string) []*net.IPNet {
+	ret := make([]*net.IPNet, 0, len(cidrs))
+	for _, cidr := range cidrs {
+		_, network, err := net.ParseCIDR(cidr)
+		if err != nil {
+			panic(err)
+		}
+		ret = append(ret, network)
+	}
+	return ret
+}
+
+func publicIP(ip net.IP) bool {
+	if ip == nil || ip.IsLoopback() || ip.IsUnspecified() || ip.IsMulticast() ||
+		ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() {
+		return false
+	}
+	for _, network := range privateNetworks {
+		if network.Contains(ip) {
+			return false
+		}
+	}
+	return true
+}
+
+// New returns the sink configured for the project. Sinks can only be sent to
+// loopback, private or link-local addresses if their host is one of
+// allowedHosts.
+func New(config models.MetricsSinkConfig, project *models.Project, allowedHosts []string) (Sink, error) {
+	client := restrictedHTTPClient
+	if sinkURL, err := url.Parse(config.URL); err == nil {
+		for _, host := range allowedHosts {
+			if strings.EqualFold(sinkURL.Hostname(), host) {
+				client = httpClient
+			}
+		}
+	}
+
+	switch config.Type {
+	case "", models.MetricsSinkTypeDatadog:
+		if project.DatadogAPIKey == nil || *project.DatadogAPIKey == "" {
+			return nil, ErrDatadogAPIKeyMissing
+		}
+		return datadog.NewClient(*project.DatadogAPIKey), nil
+	case models.MetricsSinkTypePrometheusRemoteWrite:
+		return NewPrometheusRemoteWrite(config.URL, config.Headers, client), nil
+	case models.MetricsSinkTypeInfluxDB:
+		return NewInfluxDB(config.URL, config.Headers, client), nil
+	case models.MetricsSinkTypeOTLP:
+		return NewOTLP(config.URL, config.Headers, client), nil
+	default:
+		return nil, ErrUnknownSinkType
+	}
+}
+
+// post sends a request body to a sink. The headers from the sink's config
+// are added last so that they can override the defaults.
+func post(ctx context.Context, client *http.Client, url string, body []byte, header http.Header, configHeaders map[string]string) error {
+	req, err := http.NewRequest("POST", url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req = req.WithContext(ctx)
+
+	for k, vs := range header {
+		for _, v := range vs {
+			req.Header.Add(k, v)
+		}
+	}
+	for k, v := range configHeaders {
+		req.Header.Set(k, v)
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	respBytes, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 1024))
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return &StatusError{
+			StatusCode: resp.StatusCode,
+			Body:       strings.TrimSpace(string(respBytes)),
+		}
+	}
+
+	return nil
+}
+
+type Sample struct {
+	Timestamp time.Time
+	Value     float64
+}
+
+// Samples decodes the metric's points, skipping any that are malformed.
+// Points are [timestamp in seconds, value] pairs and hold either the types
+// datadog.NewPoint creates or whatever JSON decoding produced.
+func Samples(metric models.DatadogMetric) []Sample {
+	ret := make([]Sample, 0, len(metric.Points))
+	for _, point := range metric.Points {
+		timestamp, ok := toFloat(point[0])
+		if !ok {
+			continue
+		}
+		value, ok := toFloat(point[1])
+		if !ok {
+			continue
+		}
+		ret = append(ret, Sample{
+			Timestamp: time.Unix(0, int64(timestamp*float64(time.Second))),
+			Value:     value,
+		})
+	}
+	return ret
+}
+
+func toFloat(v interface{}) (float64, bool) {
+	switch n := v.(type) {
+	case float64:
+		return n, true
+	case float32:
+		return float64(n), true
+	case int:
+		return float64(n), true
+	case int64:
+		return float64(n), true
+	case json.Number:
+		f, err := n.Float64()
+		return f, err == nil
+	default:
+		return 0, false
+	}
+}
+
+// Labels turns Datadog's "key:value" tags into key value pairs. Tags without
+// a value get an empty one.
+func Labels(metric models.DatadogMetric) map[string]string {
+	ret := make(map[string]string, len(metric.Tags)+1)
+	for _, tag := range metric.Tags {
+		parts := strings.SplitN(tag, ":", 2)
+		if len(parts) == 2 {
+			ret[parts[0]] = parts[1]
+		} else {
+			ret[parts[0]] = ""
+		}
+	}
+	if metric.Host != "" {
+		ret["host"] = metric.Host
+	}
+	return ret
+}
@@ -0,0 +1,226 @@
+package sink
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/deviceplane/deviceplane/pkg/models"
+	"github.com/golang/protobuf/proto"
+	"github.com/stretchr/testify/require"
+)
+
+var series = models.DatadogSeries{
+	{
+		Metric: "deviceplane.device.cpu",
+		Points: [][2]interface{}{
+			{float64(1577836800), float64(0.5)},
+			{int64(1577836810), float32(0.25)},
+		},
+		Type: "gauge",
+		Tags: []string{"deviceplane.project_id:prj_1", "location:ohio, usa"},
+	},
+	{
+		Metric: "deviceplane.device.bytes",
+		Points: [][2]interface{}{
+			{"not a timestamp", float64(1)},
+		},
+		Type: "count",
+	},
+}
+
+func TestEncodeLineProtocol(t *testing.T) {
+	require.Equal(t,
+		"deviceplane.device.cpu,deviceplane.project_id=prj_1,location=ohio\\,\\ usa value=0.5 1577836800000000000\n"+
+			"deviceplane.device.cpu,deviceplane.project_id=prj_1,location=ohio\\,\\ usa value=0.25 1577836810000000000\n",
+		string(encodeLineProtocol(series)),
+	)
+}
+
+func TestPrometheusName(t *testing.T) {
+	require.Equal(t, "deviceplane_device_cpu", prometheusName("deviceplane.device.cpu"))
+	require.Equal(t, "_1m_load", prometheusName("1m-load"))
+}
+
+// These mirror the prompb messages, which aren't vendored, so that
+// encodeWriteRequest's output can be decoded with the protobuf library
+type testWriteRequest struct {
+	Timeseries []*testTimeSeries `protobuf:"bytes,1,rep,name=timeseries"`
+}
+
+func (m *testWriteRequest) Reset()         { *m = testWriteRequest{} }
+func (m *testWriteRequest) String() string { return proto.CompactTextString(m) }
+func (*testWriteRequest) ProtoMessage()    {}
+
+type testTimeSeries struct {
+	Labels  []*testLabel  `protobuf:"bytes,1,rep,name=labels"`
+	Samples []*testSample `protobuf:"bytes,2,rep,name=samples"`
+}
+
+func (m *testTimeSeries) Reset()         { *m = testTimeSeries{} }
+func (m *testTimeSeries) String() string { return proto.CompactTextString(m) }
+func (*testTimeSeries) ProtoMessage()    {}
+
+type testLabel struct {
+	Name  string `protobuf:"bytes,1,opt,name=name"`
+	Value string `protobuf:"bytes,2,opt,name=value"`
+}
+
+func (m *testLabel) Reset()         { *m = testLabel{} }
+func (m *testLabel) String() string { return proto.CompactTextString(m) }
+func (*testLabel) ProtoMessage()    {}
+
+type testSample struct {
+	Value     float64 `protobuf:"fixed64,1,opt,name=value"`
+	Timestamp int64   `protobuf:"varint,2,opt,name=timestamp"`
+}
+
+func (m *testSample) Reset()         { *m = testSample{} }
+func (m *testSample) String() string { return proto.CompactTextString(m) }
+func (*testSample) ProtoMessage()    {}
+
+func TestEncodeWriteRequest(t *testing.T) {
+	var writeRequest testWriteRequest
+	require.NoError(t, proto.Unmarshal(encodeWriteRequest(models.DatadogSeries{
+		series[0],
+		series[1],
+		{
+			Metric: "deviceplane.device.memory",
+			Points: [][2]interface{}{
+				{float64(1577836800), float64(2)},
+			},
+			Host: "device-1",
+			// Zone sorts before __name__, and the rest collide with each
+			// other or with the metric name once they're sanitized
+			Tags: []string{"Zone:b", "__name__:other", "a_b:2", "a.b:1"},
+		},
+	}), &writeRequest))
+
+	require.Equal(t, testWriteRequest{
+		Timeseries: []*testTimeSeries{
+			{
+				Labels: []*testLabel{
+					{Name: "__name__", Value: "deviceplane_device_cpu"},
+					{Name: "deviceplane_project_id", Value: "prj_1"},
+					{Name: "location", Value: "ohio, usa"},
+				},
+				Samples: []*testSample{
+					{Value: 0.5, Timestamp: 1577836800000},
+					{Value: 0.25, Timestamp: 1577836810000},
+				},
+			},
+			{
+				Labels: []*testLabel{
+					{Name: "Zone", Value: "b"},
+					{Name: "__name__", Value: "deviceplane_device_memory"},
+					{Name: "a_b", Value: "1"},
+					{Name: "host", Value: "device-1"},
+				},
+				Samples: []*testSample{
+					{Value: 2, Timestamp: 1577836800000},
+				},
+			},
+		},
+	}, writeRequest)
+}
+
+func TestSnappyEncode(t *testing.T) {
+	require.Equal(t, []byte{3, 2 << 2, 'a', 'b', 'c'}, snappyEncode([]byte("abc")))
+
+	large := bytes.Repeat([]byte("a"), 300)
+	encoded := snappyEncode(large)
+	require.Equal(t, []byte{0xac, 0x02, 61 << 2, 43, 1}, encoded[:5])
+	require.Equal(t, large, encoded[5:])
+}
+
+func TestNewOTLPRequest(t *testing.T) {
+	req := newOTLPRequest(series)
+
+	metrics := req.ResourceMetrics[0].ScopeMetrics[0].Metrics
+	require.Len(t, metrics, 1)
+	require.Equal(t, "deviceplane.device.cpu", metrics[0].Name)
+	require.Nil(t, metrics[0].Sum)
+	require.Len(t, metrics[0].Gauge.DataPoints, 2)
+	require.Equal(t, "1577836810000000000", metrics[0].Gauge.DataPoints[1].TimeUnixNano)
+}
+
+func TestPostHeaders(t *testing.T) {
+	var received *http.Request
+	var body []byte
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received = r
+		body, _ = ioutil.ReadAll(r.Body)
+	}))
+	defer server.Close()
+
+	sink, err := New(models.MetricsSinkConfig{
+		Type:    models.MetricsSinkTypeOTLP,
+		URL:     server.URL,
+		Headers: map[string]string{"Authorization": "Bearer token"},
+	}, &models.Project{}, []string{"127.0.0.1"})
+	require.NoError(t, err)
+
+	require.NoError(t, sink.PostMetrics(context.Background(), models.DatadogPostMetricsRequest{
+		Series: series,
+	}))
+	require.Equal(t, "Bearer token", received.Header.Get("Authorization"))
+	require.Equal(t, "application/json", received.Header.Get("Content-Type"))
+	require.True(t, json.Valid(body))
+}
+
+func TestPostPrivateAddress(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+
+	sink, err := New(models.MetricsSinkConfig{
+		Type: models.MetricsSinkTypeOTLP,
+		URL:  server.URL,
+	}, &models.Project{}, nil)
+	require.NoError(t, err)
+
+	err = sink.PostMetrics(context.Background(), models.DatadogPostMetricsRequest{
+		Series: series,
+	})
+	require.Error(t, err)
+	require.Contains(t, err.Error(), ErrAddressNotAllowed.Error())
+}
+
+func TestPermanent(t *testing.T) {
+	require.True(t, Permanent(&StatusError{StatusCode: http.StatusBadRequest}))
+	require.True(t, Permanent(&StatusError{StatusCode: http.StatusUnauthorized}))
+	require.False(t, Permanent(&StatusError{StatusCode: http.StatusTooManyRequests}))
+	require.False(t, Permanent(&StatusError{StatusCode: http.StatusServiceUnavailable}))
+	require.False(t, Permanent(errors.New("connection refused")))
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+
+	sink, err := New(models.MetricsSinkConfig{
+		Type: models.MetricsSinkTypeOTLP,
+		URL:  server.URL,
+	}, &models.Project{}, nil)
+	require.NoError(t, err)
+	require.True(t, Permanent(sink.PostMetrics(context.Background(), models.DatadogPostMetricsRequest{
+		Series: series,
+	})))
+}
+
+func TestPublicIP(t *testing.T) {
+	for _, ip := range []string{"127.0.0.1", "10.1.2.3", "172.20.0.1", "192.168.1.1", "169.254.169.254", "::1", "fd00::1", "fe80::1", "0.0.0.0"} {
+		require.False(t, publicIP(net.ParseIP(ip)), ip)
+	}
+	for _, ip := range []string{"8.8.8.8", "172.32.0.1", "2001:4860:4860::8888"} {
+		require.True(t, publicIP(net.ParseIP(ip)), ip)
+	}
+}
+
+func TestNewDatadogWithoutAPIKey(t *testing.T) {
+	_, err := New(models.MetricsSinkConfig{}, &models.Project{}, nil)
+	require.Equal(t, ErrDatadogAPIKeyMissing, err)
+}
@@ -0,0 +1,38 @@
+package models
+
+type BulkDeviceOperation string
+
+const (
+	BulkDeviceOperationSetLabel                  = BulkDeviceOperation("SetLabel")
+	BulkDeviceOperationDeleteLabel               = BulkDeviceOperation("DeleteLabel")
+	BulkDeviceOperationSetEnvironmentVariable    = BulkDeviceOperation("SetEnvironmentVariable")
+	BulkDeviceOperationDeleteEnvironmentVariable = BulkDeviceOperation("DeleteEnvironmentVariable")
+	BulkDeviceOperationReboot                    = BulkDeviceOperation("Reboot")
+	BulkDeviceOperationDelete                    = BulkDeviceOperation("Delete")
+)
+
+// Devices must match Query if it's set and be in DeviceIDs if that's set. At
+// least one of them is required, so an empty query is needed to select every
+// device.
+type BulkDeviceRequest struct {
+	Query     *Query   `json:"query,omitempty"`
+	DeviceIDs []string `json:"deviceIds,omitempty" validate:"max=10000,dive,id"`
+	Key       string   `json:"key,omitempty"`
+	Value     string   `json:"value,omitempty"`
+}
+
+type BulkDeviceResult struct {
+	DeviceID   string `json:"deviceId"`
+	DeviceName string `json:"deviceName"`
+	Error      string `json:"error,omitempty"`
+}
+
+// BulkDeviceResponse has the IDs of the matching devices for dry runs, a job
+// ID if the operation runs in the background, and otherwise the result for
+// each device.
+type BulkDeviceResponse struct {
+	MatchingCount int                `json:"matchingCount"`
+	DeviceIDs     []string           `json:"deviceIds,omitempty"`
+	JobID         string             `json:"jobId,omitempty"`
+	Results       []BulkDeviceResult `json:"results,omitempty"`
+}
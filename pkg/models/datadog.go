@@ -1,5 +1,7 @@
 package models
 
+import "time"
+
 type DatadogPostMetricsRequest struct {
 	Series DatadogSeries `json:"series"`
 }
@@ -16,3 +18,37 @@ type DatadogMetric struct {
 	Host     string           `json:"host,omitempty"`
 	Tags     []string         `json:"tags"`
 }
+
+// MetricSeries identifies a stored time series. Its ID is derived from the
+// project, metric and tags so that writers don't need to look it up.
+type MetricSeries struct {
+	ID        string            `json:"id" yaml:"id"`
+	ProjectID string            `json:"projectId" yaml:"projectId"`
+	Metric    string            `json:"metric" yaml:"metric"`
+	Tags      map[string]string `json:"tags" yaml:"tags"`
+}
+
+// MetricPoint aggregates the values a series had within a bucket of
+// Resolution seconds starting at Timestamp.
+type MetricPoint struct {
+	SeriesID   string  `json:"seriesId" yaml:"seriesId"`
+	Resolution int64   `json:"resolution" yaml:"resolution"`
+	Timestamp  int64   `json:"timestamp" yaml:"timestamp"`
+	Count      int64   `json:"count" yaml:"count"`
+	Sum        float64 `json:"sum" yaml:"sum"`
+	Min        float64 `json:"min" yaml:"min"`
+	Max        float64 `json:"max" yaml:"max"`
+}
+
+type MetricQueryResult struct {
+	Metric string             `json:"metric" yaml:"metric"`
+	Tags   map[string]string  `json:"tags" yaml:"tags"`
+	Points []MetricQueryPoint `json:"points" yaml:"points"`
+}
+
+type MetricQueryPoint struct {
+	Timestamp time.Time `json:"timestamp" yaml:"timestamp"`
+	Value     float64   `json:"value" yaml:"value"`
+	Min       float64   `json:"min" yaml:"min"`
+	Max       float64   `json:"max" yaml:"max"`
+}
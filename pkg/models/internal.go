@@ -3,6 +3,7 @@ package models
 type SsoJWT struct {
 	Email    string
 	Name     string
+	Groups   []string
 	Provider string
 	Subject  string
 	Claims   map[string]interface{}
@@ -0,0 +1,59 @@
+package models
+
+import "time"
+
+type JobType string
+
+const (
+	JobTypeBulkDeviceOperation = JobType("BulkDeviceOperation")
+)
+
+type JobStatus string
+
+const (
+	JobStatusPending   = JobStatus("pending")
+	JobStatusRunning   = JobStatus("running")
+	JobStatusCompleted = JobStatus("completed")
+	JobStatusCancelled = JobStatus("cancelled")
+	JobStatusFailed    = JobStatus("failed")
+)
+
+type JobItemStatus string
+
+const (
+	JobItemStatusPending   = JobItemStatus("pending")
+	JobItemStatusSucceeded = JobItemStatus("succeeded")
+	JobItemStatusFailed    = JobItemStatus("failed")
+)
+
+// Job is a long running operation that's applied to each of its items by
+// the controller's job runner. A job is completed once every item has been
+// attempted, whether or not they succeeded, and failed if it couldn't be run
+// at all.
+type Job struct {
+	ID              string                 `json:"id" yaml:"id"`
+	CreatedAt       time.Time              `json:"createdAt" yaml:"createdAt"`
+	ProjectID       string                 `json:"projectId" yaml:"projectId"`
+	Type            JobType                `json:"type" yaml:"type"`
+	Params          map[string]interface{} `json:"params" yaml:"params"`
+	Status          JobStatus              `json:"status" yaml:"status"`
+	CancelRequested bool                   `json:"cancelRequested" yaml:"cancelRequested"`
+	Error           string                 `json:"error,omitempty" yaml:"error,omitempty"`
+	ItemCount       int                    `json:"itemCount" yaml:"itemCount"`
+	SucceededCount  int                    `json:"succeededCount" yaml:"succeededCount"`
+	FailedCount     int                    `json:"failedCount" yaml:"failedCount"`
+	StartedAt       *time.Time             `json:"startedAt,omitempty" yaml:"startedAt,omitempty"`
+	FinishedAt      *time.Time             `json:"finishedAt,omitempty" yaml:"finishedAt,omitempty"`
+
+	// ClaimID identifies the runner that's working on the job
+	ClaimID string `json:"-" yaml:"-"`
+}
+
+type JobItem struct {
+	JobID     string        `json:"jobId" yaml:"jobId"`
+	ItemID    string        `json:"itemId" yaml:"itemId"`
+	Name      string        `json:"name" yaml:"name"`
+	Status    JobItemStatus `json:"status" yaml:"status"`
+	Error     string        `json:"error,omitempty" yaml:"error,omitempty"`
+	UpdatedAt time.Time     `json:"updatedAt" yaml:"updatedAt"`
+}
@@ -11,6 +11,10 @@ type User struct {
 	InternalUserID *string   `json:"-" yaml:"-"`
 	ExternalUserID *string   `json:"-" yaml:"-"`
 	SuperAdmin     bool      `json:"superAdmin" yaml:"superAdmin"`
+
+	// AccessKeyConfig is the restricted role config of the access key the
+	// user authenticated with, if any
+	AccessKeyConfig *string `json:"-" yaml:"-"`
 }
 
 type UserFull struct {
@@ -47,16 +51,29 @@ type PasswordRecoveryToken struct {
 }
 
 type Session struct {
-	ID        string    `json:"id" yaml:"id"`
-	CreatedAt time.Time `json:"createdAt" yaml:"createdAt"`
-	UserID    string    `json:"userId" yaml:"userId"`
+	ID         string     `json:"id" yaml:"id"`
+	CreatedAt  time.Time  `json:"createdAt" yaml:"createdAt"`
+	UserID     string     `json:"userId" yaml:"userId"`
+	ExpiresAt  *time.Time `json:"expiresAt" yaml:"expiresAt"`
+	LastUsedAt *time.Time `json:"lastUsedAt" yaml:"lastUsedAt"`
+	LastUsedIP *string    `json:"lastUsedIp" yaml:"lastUsedIp"`
+	UserAgent  *string    `json:"userAgent" yaml:"userAgent"`
+}
+
+type SessionWithCurrent struct {
+	Session
+	Current bool `json:"current" yaml:"current"`
 }
 
 type UserAccessKey struct {
-	ID          string    `json:"id" yaml:"id"`
-	CreatedAt   time.Time `json:"createdAt" yaml:"createdAt"`
-	UserID      string    `json:"userId" yaml:"userId"`
-	Description string    `json:"description" yaml:"description"`
+	ID          string     `json:"id" yaml:"id"`
+	CreatedAt   time.Time  `json:"createdAt" yaml:"createdAt"`
+	UserID      string     `json:"userId" yaml:"userId"`
+	Description string     `json:"description" yaml:"description"`
+	ExpiresAt   *time.Time `json:"expiresAt" yaml:"expiresAt"`
+	Config      *string    `json:"config" yaml:"config"`
+	LastUsedAt  *time.Time `json:"lastUsedAt" yaml:"lastUsedAt"`
+	LastUsedIP  *string    `json:"lastUsedIp" yaml:"lastUsedIp"`
 }
 
 type UserAccessKeyWithValue struct {
@@ -64,11 +81,59 @@ type UserAccessKeyWithValue struct {
 	Value string `json:"value" yaml:"value"`
 }
 
+type UserTOTP struct {
+	UserID    string    `json:"userId" yaml:"userId"`
+	CreatedAt time.Time `json:"createdAt" yaml:"createdAt"`
+	Secret    string    `json:"-" yaml:"-"`
+	Enabled   bool      `json:"enabled" yaml:"enabled"`
+	// Locked is set while attempts are locked out after too many failures
+	Locked bool `json:"-" yaml:"-"`
+}
+
+type UserTOTPEnrollment struct {
+	Secret string `json:"secret" yaml:"secret"`
+	URI    string `json:"uri" yaml:"uri"`
+}
+
+type UserRecoveryCodes struct {
+	Codes []string `json:"codes" yaml:"codes"`
+}
+
+type Organization struct {
+	ID           string    `json:"id" yaml:"id"`
+	CreatedAt    time.Time `json:"createdAt" yaml:"createdAt"`
+	Name         string    `json:"name" yaml:"name"`
+	BillingEmail string    `json:"billingEmail" yaml:"billingEmail"`
+}
+
+type OrganizationMembership struct {
+	UserID         string    `json:"userId" yaml:"userId"`
+	OrganizationID string    `json:"organizationId" yaml:"organizationId"`
+	CreatedAt      time.Time `json:"createdAt" yaml:"createdAt"`
+}
+
+type OrganizationRole struct {
+	ID             string    `json:"id" yaml:"id"`
+	CreatedAt      time.Time `json:"createdAt" yaml:"createdAt"`
+	OrganizationID string    `json:"organizationId" yaml:"organizationId"`
+	Name           string    `json:"name" yaml:"name"`
+	Description    string    `json:"description" yaml:"description"`
+	Config         string    `json:"config" yaml:"config"`
+}
+
+type OrganizationMembershipRoleBinding struct {
+	UserID         string    `json:"userId" yaml:"userId"`
+	RoleID         string    `json:"roleId" yaml:"roleId"`
+	CreatedAt      time.Time `json:"createdAt" yaml:"createdAt"`
+	OrganizationID string    `json:"organizationId" yaml:"organizationId"`
+}
+
 type Project struct {
-	ID            string    `json:"id" yaml:"id"`
-	CreatedAt     time.Time `json:"createdAt" yaml:"createdAt"`
-	Name          string    `json:"name" yaml:"name"`
-	DatadogAPIKey *string   `json:"datadogApiKey" yaml:"datadogApiKey"`
+	ID             string    `json:"id" yaml:"id"`
+	CreatedAt      time.Time `json:"createdAt" yaml:"createdAt"`
+	OrganizationID *string   `json:"organizationId" yaml:"organizationId"`
+	Name           string    `json:"name" yaml:"name"`
+	DatadogAPIKey  *string   `json:"datadogApiKey" yaml:"datadogApiKey"`
 }
 
 type ProjectDeviceCounts struct {
@@ -101,20 +166,36 @@ type MembershipRoleBinding struct {
 	ProjectID string    `json:"projectId" yaml:"projectId"`
 }
 
+type SsoGroupMapping struct {
+	ID        string    `json:"id" yaml:"id"`
+	CreatedAt time.Time `json:"createdAt" yaml:"createdAt"`
+	ProjectID string    `json:"projectId" yaml:"projectId"`
+	Group     string    `json:"group" yaml:"group"`
+	RoleID    string    `json:"roleId" yaml:"roleId"`
+}
+
 type ServiceAccount struct {
 	ID          string    `json:"id" yaml:"id"`
 	CreatedAt   time.Time `json:"createdAt" yaml:"createdAt"`
 	ProjectID   string    `json:"projectId" yaml:"projectId"`
 	Name        string    `json:"name" yaml:"name"`
 	Description string    `json:"description" yaml:"description"`
+
+	// AccessKeyConfig is the restricted role config of the access key the
+	// service account authenticated with, if any
+	AccessKeyConfig *string `json:"-" yaml:"-"`
 }
 
 type ServiceAccountAccessKey struct {
-	ID               string    `json:"id" yaml:"id"`
-	CreatedAt        time.Time `json:"createdAt" yaml:"createdAt"`
-	ProjectID        string    `json:"projectId" yaml:"projectId"`
-	ServiceAccountID string    `json:"serviceAccountId" yaml:"serviceAccountId"`
-	Description      string    `json:"description" yaml:"description"`
+	ID               string     `json:"id" yaml:"id"`
+	CreatedAt        time.Time  `json:"createdAt" yaml:"createdAt"`
+	ProjectID        string     `json:"projectId" yaml:"projectId"`
+	ServiceAccountID string     `json:"serviceAccountId" yaml:"serviceAccountId"`
+	Description      string     `json:"description" yaml:"description"`
+	ExpiresAt        *time.Time `json:"expiresAt" yaml:"expiresAt"`
+	Config           *string    `json:"config" yaml:"config"`
+	LastUsedAt       *time.Time `json:"lastUsedAt" yaml:"lastUsedAt"`
+	LastUsedIP       *string    `json:"lastUsedIp" yaml:"lastUsedIp"`
 }
 
 type ServiceAccountAccessKeyWithValue struct {
@@ -141,6 +222,7 @@ type Device struct {
 	Status               DeviceStatus      `json:"status" yaml:"status"`
 	Labels               map[string]string `json:"labels" yaml:"labels"`
 	EnvironmentVariables map[string]string `json:"environmentVariables" yaml:"environmentVariables"`
+	Quarantined          bool              `json:"quarantined" yaml:"quarantined"`
 }
 
 type DeviceStatus string
@@ -166,10 +248,27 @@ type DevicesRegisteredWithTokenCount struct {
 }
 
 type DeviceAccessKey struct {
-	ID        string    `json:"id" yaml:"id"`
-	CreatedAt time.Time `json:"createdAt" yaml:"createdAt"`
-	ProjectID string    `json:"projectId" yaml:"projectId"`
-	DeviceID  string    `json:"deviceId" yaml:"deviceId"`
+	ID         string              `json:"id" yaml:"id"`
+	CreatedAt  time.Time           `json:"createdAt" yaml:"createdAt"`
+	ProjectID  string              `json:"projectId" yaml:"projectId"`
+	DeviceID   string              `json:"deviceId" yaml:"deviceId"`
+	Type       DeviceAccessKeyType `json:"type" yaml:"type"`
+	ReplacesID *string             `json:"replacesId" yaml:"replacesId"`
+	RevokedAt  *time.Time          `json:"revokedAt" yaml:"revokedAt"`
+}
+
+type DeviceAccessKeyType string
+
+const (
+	DeviceAccessKeyTypeKey         = DeviceAccessKeyType("key")
+	DeviceAccessKeyTypeCertificate = DeviceAccessKeyType("certificate")
+)
+
+type DeviceCertificateAuthority struct {
+	ProjectID   string    `json:"projectId" yaml:"projectId"`
+	CreatedAt   time.Time `json:"createdAt" yaml:"createdAt"`
+	Certificate string    `json:"certificate" yaml:"certificate"`
+	PrivateKey  string    `json:"-" yaml:"-"`
 }
 
 type Connection struct {
@@ -188,6 +287,15 @@ const (
 	ProtocolHTTP = Protocol("http")
 )
 
+type DeviceGroup struct {
+	ID          string    `json:"id" yaml:"id"`
+	CreatedAt   time.Time `json:"createdAt" yaml:"createdAt"`
+	ProjectID   string    `json:"projectId" yaml:"projectId"`
+	Name        string    `json:"name" yaml:"name"`
+	Description string    `json:"description" yaml:"description"`
+	Query       Query     `json:"query" yaml:"query"`
+}
+
 type Application struct {
 	ID                    string                          `json:"id" yaml:"id"`
 	CreatedAt             time.Time                       `json:"createdAt" yaml:"createdAt"`
@@ -348,6 +456,7 @@ type Bundle struct {
 	DeviceName           string            `json:"deviceName" yaml:"deviceName"`
 	EnvironmentVariables map[string]string `json:"environmentVariables" yaml:"environmentVariables"`
 	DesiredAgentVersion  string            `json:"desiredAgentVersion" yaml:"desiredAgentVersion"`
+	Quarantined          bool              `json:"quarantined" yaml:"quarantined"`
 
 	ServiceMetricsConfigs []ServiceMetricsConfig `json:"serviceMetricsConfig" yaml:"serviceMetricsConfig"`
 	DeviceMetricsConfig   *DeviceMetricsConfig   `json:"deviceMetricsConfig" yaml:"deviceMetricsConfig"`
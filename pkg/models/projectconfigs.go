@@ -10,8 +10,34 @@ const (
 	ServiceMetricsConfigKey = "service-metrics-config"
 	ProjectMetricsConfigKey = "project-metrics-config"
 	DeviceMetricsConfigKey  = "device-metrics-config"
+	SecurityConfigKey       = "security-config"
+	MetricsSinkConfigKey    = "metrics-sink-config"
 )
 
+type SecurityConfig struct {
+	// RequireTwoFactor stops users without two-factor authentication from
+	// using SSH or connections on the project's devices
+	RequireTwoFactor bool `json:"requireTwoFactor" yaml:"requireTwoFactor"`
+}
+
+type MetricsSinkType string
+
+const (
+	MetricsSinkTypeDatadog               = MetricsSinkType("datadog")
+	MetricsSinkTypePrometheusRemoteWrite = MetricsSinkType("prometheus-remote-write")
+	MetricsSinkTypeInfluxDB              = MetricsSinkType("influxdb")
+	MetricsSinkTypeOTLP                  = MetricsSinkType("otlp")
+)
+
+// MetricsSinkConfig selects where a project's metrics are forwarded to. When
+// Type is empty, metrics go to Datadog using the project's Datadog API key.
+type MetricsSinkConfig struct {
+	Type MetricsSinkType `json:"type" yaml:"type" validate:"omitempty,eq=datadog|eq=prometheus-remote-write|eq=influxdb|eq=otlp"`
+	URL  string          `json:"url" yaml:"url" validate:"omitempty,url"`
+	// Headers are sent with every request, for example to authenticate
+	Headers map[string]string `json:"headers" yaml:"headers"`
+}
+
 type ServiceMetricsConfig struct {
 	ApplicationID  string          `json:"applicationId" yaml:"applicationId"`
 	Service        string          `json:"service" yaml:"service"`
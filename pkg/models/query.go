@@ -5,8 +5,8 @@ type Query []Filter
 type Filter []Condition
 
 type Condition struct {
-	Type   ConditionType          `json:"type"`
-	Params map[string]interface{} `json:"params"`
+	Type   ConditionType          `json:"type" yaml:"type"`
+	Params map[string]interface{} `json:"params" yaml:"params"`
 }
 
 type ConditionType string
@@ -18,23 +18,30 @@ const (
 	ApplicationReleaseCondition   = ConditionType("ApplicationReleaseCondition")
 	ApplicationExistenceCondition = ConditionType("ApplicationExistenceCondition")
 	ServiceStateCondition         = ConditionType("ServiceStateCondition")
+	DeviceGroupCondition          = ConditionType("DeviceGroupCondition")
 )
 
+// Property is the device's JSON field, with nested fields separated by dots,
+// such as "info.agentVersion".
 type DevicePropertyConditionParams struct {
-	Property string   `json:"property"`
-	Operator Operator `json:"operator"`
-	Value    string   `json:"value"`
+	Property string   `json:"property" yaml:"property"`
+	Operator Operator `json:"operator" yaml:"operator"`
+	Value    string   `json:"value" yaml:"value"`
+	// Values is used instead of Value by OperatorIn and OperatorNotIn
+	Values []string `json:"values,omitempty" yaml:"values,omitempty"`
 }
 
 type LabelValueConditionParams struct {
-	Key      string   `json:"key"`
-	Operator Operator `json:"operator"`
-	Value    string   `json:"value"`
+	Key      string   `json:"key" yaml:"key"`
+	Operator Operator `json:"operator" yaml:"operator"`
+	Value    string   `json:"value" yaml:"value"`
+	// Values is used instead of Value by OperatorIn and OperatorNotIn
+	Values []string `json:"values,omitempty" yaml:"values,omitempty"`
 }
 
 type LabelExistenceConditionParams struct {
-	Key      string   `json:"key"`
-	Operator Operator `json:"operator"`
+	Key      string   `json:"key" yaml:"key"`
+	Operator Operator `json:"operator" yaml:"operator"`
 }
 
 const (
@@ -42,21 +49,28 @@ const (
 )
 
 type ApplicationReleaseConditionParams struct {
-	ApplicationID string   `json:"applicationId"`
-	Operator      Operator `json:"operator"`
-	Release       string   `json:"release"`
+	ApplicationID string   `json:"applicationId" yaml:"applicationId"`
+	Operator      Operator `json:"operator" yaml:"operator"`
+	Release       string   `json:"release" yaml:"release"`
 }
 
 type ApplicationExistenceConditionParams struct {
-	ApplicationID string   `json:"applicationId"`
-	Operator      Operator `json:"operator"`
+	ApplicationID string   `json:"applicationId" yaml:"applicationId"`
+	Operator      Operator `json:"operator" yaml:"operator"`
 }
 
 type ServiceStateConditionParams struct {
-	ApplicationID string       `json:"applicationId"`
-	Service       string       `json:"service"`
-	Operator      Operator     `json:"operator"`
-	ServiceState  ServiceState `json:"serviceState"`
+	ApplicationID string       `json:"applicationId" yaml:"applicationId"`
+	Service       string       `json:"service" yaml:"service"`
+	Operator      Operator     `json:"operator" yaml:"operator"`
+	ServiceState  ServiceState `json:"serviceState" yaml:"serviceState"`
+}
+
+// The group's query is looked up whenever the condition is evaluated, so
+// changing the group changes which devices match.
+type DeviceGroupConditionParams struct {
+	DeviceGroupID string   `json:"deviceGroupId" yaml:"deviceGroupId"`
+	Operator      Operator `json:"operator" yaml:"operator"`
 }
 
 type Operator string
@@ -67,4 +81,22 @@ const (
 
 	OperatorExists    = Operator("exists")
 	OperatorNotExists = Operator("does not exist")
+
+	// Values are compared as versions, numbers or times where they look
+	// like them, and as strings otherwise
+	OperatorGreaterThan        = Operator(">")
+	OperatorGreaterThanOrEqual = Operator(">=")
+	OperatorLessThan           = Operator("<")
+	OperatorLessThanOrEqual    = Operator("<=")
+
+	// The value is a regular expression that must match all of it
+	OperatorMatches    = Operator("matches")
+	OperatorNotMatches = Operator("does not match")
+
+	// The value is a glob where * matches any characters and ? matches one
+	OperatorLike    = Operator("like")
+	OperatorNotLike = Operator("not like")
+
+	OperatorIn    = Operator("in")
+	OperatorNotIn = Operator("not in")
 )
@@ -0,0 +1,43 @@
+package models
+
+// BaseRelease is zero when the target is the first release of its
+// application, in which case every service is reported as added.
+type ReleaseDiff struct {
+	BaseRelease   uint32        `json:"baseRelease" yaml:"baseRelease"`
+	TargetRelease uint32        `json:"targetRelease" yaml:"targetRelease"`
+	Services      []ServiceDiff `json:"services" yaml:"services"`
+}
+
+type ServiceDiffType string
+
+const (
+	ServiceDiffTypeAdded   = ServiceDiffType("added")
+	ServiceDiffTypeRemoved = ServiceDiffType("removed")
+	ServiceDiffTypeChanged = ServiceDiffType("changed")
+)
+
+type ServiceDiff struct {
+	Service     string          `json:"service" yaml:"service"`
+	Type        ServiceDiffType `json:"type" yaml:"type"`
+	Image       *ValueDiff      `json:"image,omitempty" yaml:"image,omitempty"`
+	Environment []KeyValueDiff  `json:"environment,omitempty" yaml:"environment,omitempty"`
+	Volumes     *ListDiff       `json:"volumes,omitempty" yaml:"volumes,omitempty"`
+	Ports       *ListDiff       `json:"ports,omitempty" yaml:"ports,omitempty"`
+	OtherFields []string        `json:"otherFields,omitempty" yaml:"otherFields,omitempty"`
+}
+
+type ValueDiff struct {
+	From string `json:"from" yaml:"from"`
+	To   string `json:"to" yaml:"to"`
+}
+
+type KeyValueDiff struct {
+	Key  string  `json:"key" yaml:"key"`
+	From *string `json:"from" yaml:"from"`
+	To   *string `json:"to" yaml:"to"`
+}
+
+type ListDiff struct {
+	Added   []string `json:"added,omitempty" yaml:"added,omitempty"`
+	Removed []string `json:"removed,omitempty" yaml:"removed,omitempty"`
+}
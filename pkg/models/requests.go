@@ -4,12 +4,25 @@ type CreateReleaseRequest struct {
 	RawConfig string `json:"rawConfig" validate:"config"`
 }
 
+type CreateReleaseDryRunResponse struct {
+	Config           map[string]Service `json:"config"`
+	ScheduledDevices []ScheduledDevice  `json:"scheduledDevices"`
+}
+
 type RegisterDeviceRequest struct {
 	DeviceRegistrationTokenID string `json:"deviceRegistrationTokenId" validate:"id"`
+	CertificateSigningRequest string `json:"certificateSigningRequest" validate:"max=10000"`
 }
 
+// RegisterDeviceResponse has a certificate instead of an access key when
+// the request included a certificate signing request.
 type RegisterDeviceResponse struct {
 	DeviceID             string `json:"deviceId"`
+	DeviceAccessKeyValue string `json:"deviceAccessKeyValue,omitempty"`
+	DeviceCertificate    string `json:"deviceCertificate,omitempty"`
+}
+
+type RotateDeviceAccessKeyResponse struct {
 	DeviceAccessKeyValue string `json:"deviceAccessKeyValue"`
 }
 
@@ -30,7 +43,7 @@ type SetDeviceServiceStateRequest struct {
 	ErrorMessage string       `json:"errorMessage"`
 }
 
-type Auth0SsoRequest struct {
+type SsoRequest struct {
 	AccessToken string `json:"access_token"`
 	ExpiresIn   string `json:"expires_in"`
 	IdToken     string `json:"id_token"`
@@ -38,3 +51,32 @@ type Auth0SsoRequest struct {
 	State       string `json:"state"`
 	TokenType   string `json:"token_type"`
 }
+
+type SsoConfig struct {
+	Enabled  bool   `json:"enabled"`
+	Issuer   string `json:"issuer,omitempty"`
+	ClientID string `json:"clientId,omitempty"`
+}
+
+type SimulateAuthorizationRequest struct {
+	UserID         string `json:"userId"`
+	ServiceAccount string `json:"serviceAccount"`
+	Resource       string `json:"resource"`
+	Action         string `json:"action"`
+	Object         string `json:"object"`
+}
+
+type SimulateAuthorizationResponse struct {
+	Allowed    bool                        `json:"allowed" yaml:"allowed"`
+	SuperAdmin bool                        `json:"superAdmin" yaml:"superAdmin"`
+	Roles      []string                    `json:"roles" yaml:"roles"`
+	AllowRules []MatchingAuthorizationRule `json:"allowRules" yaml:"allowRules"`
+	DenyRules  []MatchingAuthorizationRule `json:"denyRules" yaml:"denyRules"`
+}
+
+type MatchingAuthorizationRule struct {
+	RoleID    string `json:"roleId" yaml:"roleId"`
+	RoleName  string `json:"roleName" yaml:"roleName"`
+	RuleIndex int    `json:"ruleIndex" yaml:"ruleIndex"`
+	Rule      string `json:"rule" yaml:"rule"`
+}
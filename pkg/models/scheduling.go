@@ -4,14 +4,14 @@ const LatestRelease = "latest"
 
 type ScheduledDevice struct {
 	Device
-	ReleaseID string `json:"releaseId"`
+	ReleaseID string `json:"releaseId" yaml:"releaseId"`
 }
 
 type SchedulingRule struct {
-	ScheduleType     ScheduleType      `json:"scheduleType"`
-	DefaultReleaseID string            `json:"defaultReleaseId"` // TODO: validate Release ID?
-	ConditionalQuery *Query            `json:"conditionalQuery,omitempty"`
-	ReleaseSelectors []ReleaseSelector `json:"releaseSelectors"`
+	ScheduleType     ScheduleType      `json:"scheduleType" yaml:"scheduleType"`
+	DefaultReleaseID string            `json:"defaultReleaseId" yaml:"defaultReleaseId"` // TODO: validate Release ID?
+	ConditionalQuery *Query            `json:"conditionalQuery,omitempty" yaml:"conditionalQuery,omitempty"`
+	ReleaseSelectors []ReleaseSelector `json:"releaseSelectors" yaml:"releaseSelectors"`
 }
 
 type ScheduleType string
@@ -23,6 +23,6 @@ const (
 )
 
 type ReleaseSelector struct {
-	Query     Query  `json:"releaseQuery"`
-	ReleaseID string `json:"releaseId"` // TODO: validate Release ID?
+	Query     Query  `json:"releaseQuery" yaml:"releaseQuery"`
+	ReleaseID string `json:"releaseId" yaml:"releaseId"` // TODO: validate Release ID?
 }
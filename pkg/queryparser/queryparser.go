@@ -0,0 +1,488 @@
+package queryparser
+
+import (
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/deviceplane/deviceplane/pkg/models"
+	"github.com/deviceplane/deviceplane/pkg/utils"
+	"github.com/pkg/errors"
+)
+
+const (
+	labelFieldPrefix = "labels."
+	deviceGroupField = "group"
+
+	// Converting or inside and to a query multiplies the number of filters,
+	// so expressions are limited to keep that reasonable
+	maxParsedFilters = 100
+)
+
+var (
+	ErrExpressionTooComplex = errors.New("expression is too complex")
+
+	// Shorter names for nested device properties
+	propertyAliases = map[string]string{
+		"agentVersion": "info.agentVersion",
+		"ipAddress":    "info.ipAddress",
+	}
+
+	inverseOperators = map[models.Operator]models.Operator{
+		models.OperatorIs:                 models.OperatorIsNot,
+		models.OperatorIsNot:              models.OperatorIs,
+		models.OperatorExists:             models.OperatorNotExists,
+		models.OperatorNotExists:          models.OperatorExists,
+		models.OperatorGreaterThan:        models.OperatorLessThanOrEqual,
+		models.OperatorLessThanOrEqual:    models.OperatorGreaterThan,
+		models.OperatorGreaterThanOrEqual: models.OperatorLessThan,
+		models.OperatorLessThan:           models.OperatorGreaterThanOrEqual,
+		models.OperatorMatches:            models.OperatorNotMatches,
+		models.OperatorNotMatches:         models.OperatorMatches,
+		models.OperatorLike:               models.OperatorNotLike,
+		models.OperatorNotLike:            models.OperatorLike,
+		models.OperatorIn:                 models.OperatorNotIn,
+		models.OperatorNotIn:              models.OperatorIn,
+	}
+
+	symbolOperators = map[string]models.Operator{
+		"=":  models.OperatorIs,
+		"==": models.OperatorIs,
+		"!=": models.OperatorIsNot,
+		">":  models.OperatorGreaterThan,
+		">=": models.OperatorGreaterThanOrEqual,
+		"<":  models.OperatorLessThan,
+		"<=": models.OperatorLessThanOrEqual,
+		"=~": models.OperatorMatches,
+		"!~": models.OperatorNotMatches,
+	}
+)
+
+// Parse converts a textual expression into a query. Conditions compare a
+// device property or a label ("labels.<key>") with a value, and are combined
+// with and, or, not and parentheses. For example:
+//
+//	labels.site = "hq" and agentVersion >= 1.10
+//	status = online and (labels.role in (gateway, sensor) or name like "edge-*")
+//	labels.rack =~ "r[0-9]+" and lastSeenAt > now-1h and not labels.test exists
+//
+// Devices in a saved device group are matched with "group = <ID>". Values
+// only need quotes if they contain spaces or operator characters.
+// Negating a condition inverts its operator, so "not x > 1" is the same as
+// "x <= 1" and neither matches devices without x.
+//
+// Values aren't validated here, since that's up to whatever runs the query.
+func Parse(expression string) (models.Query, error) {
+	p := parser{
+		tokens: tokenize(expression),
+	}
+
+	n, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if t := p.peek(); t.kind != tokenEOF {
+		return nil, p.errorf(t, "unexpected %q", t.text)
+	}
+
+	clauses, err := toCNF(n)
+	if err != nil {
+		return nil, err
+	}
+
+	query := make(models.Query, 0, len(clauses))
+	for _, clause := range clauses {
+		filter := make(models.Filter, 0, len(clause))
+		for _, c := range clause {
+			condition, err := c.toCondition()
+			if err != nil {
+				return nil, err
+			}
+			filter = append(filter, condition)
+		}
+		query = append(query, filter)
+	}
+
+	return query, nil
+}
+
+type tokenKind int
+
+const (
+	tokenEOF tokenKind = iota
+	tokenWord
+	tokenString
+	tokenOperator
+	tokenLeftParen
+	tokenRightParen
+	tokenComma
+	tokenInvalid
+)
+
+type token struct {
+	kind tokenKind
+	text string
+	pos  int
+}
+
+func (t token) isKeyword(keyword string) bool {
+	return t.kind == tokenWord && strings.EqualFold(t.text, keyword)
+}
+
+func isWordRune(r rune) bool {
+	return !unicode.IsSpace(r) && !strings.ContainsRune(`=!<>~(),"'`, r)
+}
+
+func tokenize(s string) []token {
+	var tokens []token
+	runes := []rune(s)
+
+	for i := 0; i < len(runes); {
+		r := runes[i]
+		switch {
+		case unicode.IsSpace(r):
+			i++
+
+		case r == '(':
+			tokens = append(tokens, token{tokenLeftParen, "(", i})
+			i++
+		case r == ')':
+			tokens = append(tokens, token{tokenRightParen, ")", i})
+			i++
+		case r == ',':
+			tokens = append(tokens, token{tokenComma, ",", i})
+			i++
+
+		case strings.ContainsRune("=!<>~", r):
+			start := i
+			i++
+			if i < len(runes) && strings.ContainsRune("=~", runes[i]) {
+				i++
+			}
+			tokens = append(tokens, token{tokenOperator, string(runes[start:i]), start})
+
+		case r == '"' || r == '\'':
+			start := i
+			i++
+			for i < len(runes) && runes[i] != r {
+				if runes[i] == '\\' && r == '"' {
+					i++
+				}
+				i++
+			}
+			if i >= len(runes) {
+				return append(tokens, token{tokenInvalid, "unterminated string", start})
+			}
+			i++
+
+			raw := string(runes[start:i])
+			text := raw[1 : len(raw)-1]
+			if r == '"' {
+				unquoted, err := strconv.Unquote(raw)
+				if err != nil {
+					return append(tokens, token{tokenInvalid, "invalid string", start})
+				}
+				text = unquoted
+			}
+			tokens = append(tokens, token{tokenString, text, start})
+
+		default:
+			start := i
+			for i < len(runes) && isWordRune(runes[i]) {
+				i++
+			}
+			tokens = append(tokens, token{tokenWord, string(runes[start:i]), start})
+		}
+	}
+
+	return append(tokens, token{tokenEOF, "end of expression", len(runes)})
+}
+
+// node is either a condition or, when and or or are set, two nodes joined
+// together.
+type node struct {
+	and, or     bool
+	left, right *node
+	condition   parsedCondition
+}
+
+type parsedCondition struct {
+	field    string
+	operator models.Operator
+	value    string
+	values   []string
+}
+
+type parser struct {
+	tokens []token
+	i      int
+}
+
+func (p *parser) peek() token {
+	return p.tokens[p.i]
+}
+
+func (p *parser) next() token {
+	t := p.tokens[p.i]
+	if t.kind != tokenEOF {
+		p.i++
+	}
+	return t
+}
+
+func (p *parser) errorf(t token, format string, args ...interface{}) error {
+	if t.kind == tokenInvalid {
+		return errors.Errorf("%s at position %d", t.text, t.pos+1)
+	}
+	return errors.Errorf(format+" at position %d", append(args, t.pos+1)...)
+}
+
+func (p *parser) parseOr() (*node, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for p.peek().isKeyword("or") {
+		p.next()
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		left = &node{or: true, left: left, right: right}
+	}
+	return left, nil
+}
+
+func (p *parser) parseAnd() (*node, error) {
+	left, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	for p.peek().isKeyword("and") {
+		p.next()
+		right, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		left = &node{and: true, left: left, right: right}
+	}
+	return left, nil
+}
+
+func (p *parser) parseUnary() (*node, error) {
+	t := p.peek()
+	switch {
+	case t.isKeyword("not"):
+		p.next()
+		n, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return negate(n), nil
+
+	case t.kind == tokenLeftParen:
+		p.next()
+		n, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if t := p.next(); t.kind != tokenRightParen {
+			return nil, p.errorf(t, "expected \")\" but got %q", t.text)
+		}
+		return n, nil
+	}
+
+	return p.parseCondition()
+}
+
+func (p *parser) parseCondition() (*node, error) {
+	field := p.next()
+	if field.kind != tokenWord && field.kind != tokenString {
+		return nil, p.errorf(field, "expected a property or label but got %q", field.text)
+	}
+
+	c := parsedCondition{
+		field: field.text,
+	}
+
+	t := p.next()
+	negated := false
+	if t.isKeyword("not") {
+		negated = true
+		t = p.next()
+	}
+
+	var err error
+	switch {
+	case t.kind == tokenOperator && !negated:
+		operator, ok := symbolOperators[t.text]
+		if !ok {
+			return nil, p.errorf(t, "invalid operator %q", t.text)
+		}
+		c.operator = operator
+		c.value, err = p.parseValue()
+
+	case t.isKeyword("in"):
+		c.operator = models.OperatorIn
+		c.values, err = p.parseList()
+
+	case t.isKeyword("like"):
+		c.operator = models.OperatorLike
+		c.value, err = p.parseValue()
+
+	case t.isKeyword("matches"):
+		c.operator = models.OperatorMatches
+		c.value, err = p.parseValue()
+
+	case t.isKeyword("exists"):
+		c.operator = models.OperatorExists
+
+	default:
+		return nil, p.errorf(t, "expected an operator but got %q", t.text)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if negated {
+		c.operator = inverseOperators[c.operator]
+	}
+	return &node{condition: c}, nil
+}
+
+func (p *parser) parseValue() (string, error) {
+	t := p.next()
+	if t.kind != tokenWord && t.kind != tokenString {
+		return "", p.errorf(t, "expected a value but got %q", t.text)
+	}
+	return t.text, nil
+}
+
+func (p *parser) parseList() ([]string, error) {
+	if t := p.next(); t.kind != tokenLeftParen {
+		return nil, p.errorf(t, "expected \"(\" but got %q", t.text)
+	}
+
+	var values []string
+	for {
+		value, err := p.parseValue()
+		if err != nil {
+			return nil, err
+		}
+		values = append(values, value)
+
+		t := p.next()
+		if t.kind == tokenRightParen {
+			return values, nil
+		}
+		if t.kind != tokenComma {
+			return nil, p.errorf(t, "expected \",\" or \")\" but got %q", t.text)
+		}
+	}
+}
+
+func negate(n *node) *node {
+	if n.and || n.or {
+		return &node{
+			and:   n.or,
+			or:    n.and,
+			left:  negate(n.left),
+			right: negate(n.right),
+		}
+	}
+	c := n.condition
+	c.operator = inverseOperators[c.operator]
+	return &node{condition: c}
+}
+
+// toCNF converts an expression into an and of ors, which is the form that
+// queries take.
+func toCNF(n *node) ([][]parsedCondition, error) {
+	if !n.and && !n.or {
+		return [][]parsedCondition{{n.condition}}, nil
+	}
+
+	left, err := toCNF(n.left)
+	if err != nil {
+		return nil, err
+	}
+	right, err := toCNF(n.right)
+	if err != nil {
+		return nil, err
+	}
+
+	if n.and {
+		if len(left)+len(right) > maxParsedFilters {
+			return nil, ErrExpressionTooComplex
+		}
+		return append(left, right...), nil
+	}
+
+	if len(left)*len(right) > maxParsedFilters {
+		return nil, ErrExpressionTooComplex
+	}
+	ret := make([][]parsedCondition, 0, len(left)*len(right))
+	for _, l := range left {
+		for _, r := range right {
+			clause := make([]parsedCondition, 0, len(l)+len(r))
+			clause = append(clause, l...)
+			clause = append(clause, r...)
+			ret = append(ret, clause)
+		}
+	}
+	return ret, nil
+}
+
+func (c parsedCondition) toCondition() (models.Condition, error) {
+	var condition models.Condition
+	var params interface{}
+
+	switch {
+	case strings.HasPrefix(c.field, labelFieldPrefix):
+		key := strings.TrimPrefix(c.field, labelFieldPrefix)
+		if c.operator == models.OperatorExists || c.operator == models.OperatorNotExists {
+			condition.Type = models.LabelExistenceCondition
+			params = models.LabelExistenceConditionParams{
+				Key:      key,
+				Operator: c.operator,
+			}
+		} else {
+			condition.Type = models.LabelValueCondition
+			params = models.LabelValueConditionParams{
+				Key:      key,
+				Operator: c.operator,
+				Value:    c.value,
+				Values:   c.values,
+			}
+		}
+
+	case c.field == deviceGroupField:
+		if c.operator != models.OperatorIs && c.operator != models.OperatorIsNot {
+			return condition, errors.Errorf("%q only supports = and !=", c.field)
+		}
+		condition.Type = models.DeviceGroupCondition
+		params = models.DeviceGroupConditionParams{
+			DeviceGroupID: c.value,
+			Operator:      c.operator,
+		}
+
+	case c.operator == models.OperatorExists || c.operator == models.OperatorNotExists:
+		return condition, errors.Errorf("exists is only supported on labels, not %q", c.field)
+
+	default:
+		property := c.field
+		if alias, ok := propertyAliases[property]; ok {
+			property = alias
+		}
+		condition.Type = models.DevicePropertyCondition
+		params = models.DevicePropertyConditionParams{
+			Property: property,
+			Operator: c.operator,
+			Value:    c.value,
+			Values:   c.values,
+		}
+	}
+
+	err := utils.JSONConvert(params, &condition.Params)
+	return condition, err
+}
@@ -0,0 +1,166 @@
+package queryparser
+
+import (
+	"testing"
+
+	"github.com/deviceplane/deviceplane/pkg/models"
+	"github.com/stretchr/testify/require"
+)
+
+func property(property string, operator models.Operator, value string, values ...string) models.Condition {
+	params := map[string]interface{}{
+		"property": property,
+		"operator": string(operator),
+		"value":    value,
+	}
+	if len(values) > 0 {
+		params["values"] = toInterfaces(values)
+	}
+	return models.Condition{
+		Type:   models.DevicePropertyCondition,
+		Params: params,
+	}
+}
+
+func label(key string, operator models.Operator, value string, values ...string) models.Condition {
+	params := map[string]interface{}{
+		"key":      key,
+		"operator": string(operator),
+		"value":    value,
+	}
+	if len(values) > 0 {
+		params["values"] = toInterfaces(values)
+	}
+	return models.Condition{
+		Type:   models.LabelValueCondition,
+		Params: params,
+	}
+}
+
+func toInterfaces(values []string) []interface{} {
+	ret := make([]interface{}, len(values))
+	for i, value := range values {
+		ret[i] = value
+	}
+	return ret
+}
+
+func TestParse(t *testing.T) {
+	for _, tc := range []struct {
+		expression string
+		expected   models.Query
+	}{
+		{
+			`status=online`,
+			models.Query{
+				{property("status", models.OperatorIs, "online")},
+			},
+		},
+		{
+			`labels.site = "hq" and agentVersion >= 1.10`,
+			models.Query{
+				{label("site", models.OperatorIs, "hq")},
+				{property("info.agentVersion", models.OperatorGreaterThanOrEqual, "1.10")},
+			},
+		},
+		{
+			`labels.role in (gateway, "edge sensor") or name like 'edge-*'`,
+			models.Query{
+				{
+					label("role", models.OperatorIn, "", "gateway", "edge sensor"),
+					property("name", models.OperatorLike, "edge-*"),
+				},
+			},
+		},
+		{
+			`(labels.a = 1 or labels.b = 2) and (labels.c = 3 or labels.d = 4)`,
+			models.Query{
+				{label("a", models.OperatorIs, "1"), label("b", models.OperatorIs, "2")},
+				{label("c", models.OperatorIs, "3"), label("d", models.OperatorIs, "4")},
+			},
+		},
+		{
+			`labels.a = 1 or (labels.b = 2 and labels.c =~ "x.*")`,
+			models.Query{
+				{label("a", models.OperatorIs, "1"), label("b", models.OperatorIs, "2")},
+				{label("a", models.OperatorIs, "1"), label("c", models.OperatorMatches, "x.*")},
+			},
+		},
+		{
+			`not (status = online and lastSeenAt > now-1h) and labels.x not exists`,
+			models.Query{
+				{
+					property("status", models.OperatorIsNot, "online"),
+					property("lastSeenAt", models.OperatorLessThanOrEqual, "now-1h"),
+				},
+				{
+					{
+						Type: models.LabelExistenceCondition,
+						Params: map[string]interface{}{
+							"key":      "x",
+							"operator": string(models.OperatorNotExists),
+						},
+					},
+				},
+			},
+		},
+		{
+			`group != dgp_1`,
+			models.Query{
+				{
+					{
+						Type: models.DeviceGroupCondition,
+						Params: map[string]interface{}{
+							"deviceGroupId": "dgp_1",
+							"operator":      string(models.OperatorIsNot),
+						},
+					},
+				},
+			},
+		},
+		{
+			`labels.env NOT IN (dev, test)`,
+			models.Query{
+				{label("env", models.OperatorNotIn, "", "dev", "test")},
+			},
+		},
+	} {
+		query, err := Parse(tc.expression)
+		require.NoError(t, err, tc.expression)
+		require.Equal(t, tc.expected, query, tc.expression)
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	for _, expression := range []string{
+		``,
+		`status`,
+		`status = `,
+		`status = online and`,
+		`(status = online`,
+		`status = "online`,
+		`labels.a in (b`,
+		`status exists`,
+		`status ! online`,
+		`group > dgp_1`,
+	} {
+		_, err := Parse(expression)
+		require.Error(t, err, expression)
+	}
+}
+
+func TestParseTooComplex(t *testing.T) {
+	expression := "(labels.a = 1 or labels.b = 1)"
+	for i := 0; i < 7; i++ {
+		expression += " and (labels.a = 1 or labels.b = 1)"
+	}
+	_, err := Parse("labels.c = 1 or " + expression)
+	require.NoError(t, err)
+
+	expression = "(labels.a = 1 and labels.b = 1)"
+	for i := 0; i < 7; i++ {
+		expression += " or (labels.a = 1 and labels.b = 1)"
+	}
+	_, err = Parse(expression)
+	require.Equal(t, ErrExpressionTooComplex, err)
+}
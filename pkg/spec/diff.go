@@ -0,0 +1,194 @@
+package spec
+
+import (
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/deviceplane/deviceplane/pkg/models"
+	"github.com/deviceplane/deviceplane/pkg/yamltypes"
+)
+
+// Fields that get a structured diff rather than just being reported as changed
+var structuredDiffFields = map[string]bool{
+	"Image":       true,
+	"Environment": true,
+	"Volumes":     true,
+	"Ports":       true,
+}
+
+func Diff(base, target map[string]models.Service) []models.ServiceDiff {
+	var names []string
+	for name := range base {
+		names = append(names, name)
+	}
+	for name := range target {
+		if _, ok := base[name]; !ok {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	diffs := make([]models.ServiceDiff, 0)
+	for _, name := range names {
+		baseService, inBase := base[name]
+		targetService, inTarget := target[name]
+
+		switch {
+		case !inBase:
+			diffs = append(diffs, models.ServiceDiff{
+				Service: name,
+				Type:    models.ServiceDiffTypeAdded,
+				Image:   &models.ValueDiff{To: targetService.Image},
+			})
+		case !inTarget:
+			diffs = append(diffs, models.ServiceDiff{
+				Service: name,
+				Type:    models.ServiceDiffTypeRemoved,
+				Image:   &models.ValueDiff{From: baseService.Image},
+			})
+		default:
+			if diff := diffService(name, baseService, targetService); diff != nil {
+				diffs = append(diffs, *diff)
+			}
+		}
+	}
+
+	return diffs
+}
+
+func diffService(name string, base, target models.Service) *models.ServiceDiff {
+	diff := models.ServiceDiff{
+		Service: name,
+		Type:    models.ServiceDiffTypeChanged,
+	}
+	changed := false
+
+	if base.Image != target.Image {
+		diff.Image = &models.ValueDiff{From: base.Image, To: target.Image}
+		changed = true
+	}
+
+	if environment := diffEnvironment(base.Environment, target.Environment); len(environment) > 0 {
+		diff.Environment = environment
+		changed = true
+	}
+
+	if volumes := diffList(volumeStrings(base.Volumes), volumeStrings(target.Volumes)); volumes != nil {
+		diff.Volumes = volumes
+		changed = true
+	}
+
+	if ports := diffList(base.Ports, target.Ports); ports != nil {
+		diff.Ports = ports
+		changed = true
+	}
+
+	baseValue := reflect.ValueOf(base)
+	targetValue := reflect.ValueOf(target)
+	serviceType := baseValue.Type()
+	for i := 0; i < serviceType.NumField(); i++ {
+		field := serviceType.Field(i)
+		if structuredDiffFields[field.Name] {
+			continue
+		}
+		if !reflect.DeepEqual(baseValue.Field(i).Interface(), targetValue.Field(i).Interface()) {
+			diff.OtherFields = append(diff.OtherFields, strings.Split(field.Tag.Get("yaml"), ",")[0])
+			changed = true
+		}
+	}
+
+	if !changed {
+		return nil
+	}
+	return &diff
+}
+
+func diffEnvironment(base, target yamltypes.MaporEqualSlice) []models.KeyValueDiff {
+	baseMap := environmentMap(base)
+	targetMap := environmentMap(target)
+
+	var keys []string
+	for key := range baseMap {
+		keys = append(keys, key)
+	}
+	for key := range targetMap {
+		if _, ok := baseMap[key]; !ok {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+
+	var diffs []models.KeyValueDiff
+	for _, key := range keys {
+		baseValue, inBase := baseMap[key]
+		targetValue, inTarget := targetMap[key]
+		if inBase && inTarget && baseValue == targetValue {
+			continue
+		}
+
+		diff := models.KeyValueDiff{Key: key}
+		if inBase {
+			diff.From = &baseValue
+		}
+		if inTarget {
+			diff.To = &targetValue
+		}
+		diffs = append(diffs, diff)
+	}
+	return diffs
+}
+
+// Environment entries without a value (e.g. "- DEBUG") are kept with an
+// empty value rather than being dropped.
+func environmentMap(environment yamltypes.MaporEqualSlice) map[string]string {
+	m := make(map[string]string)
+	for _, entry := range environment {
+		parts := strings.SplitN(entry, "=", 2)
+		if len(parts) == 2 {
+			m[parts[0]] = parts[1]
+		} else {
+			m[parts[0]] = ""
+		}
+	}
+	return m
+}
+
+func volumeStrings(volumes *yamltypes.Volumes) []string {
+	if volumes == nil {
+		return nil
+	}
+	var ret []string
+	for _, volume := range volumes.Volumes {
+		ret = append(ret, volume.String())
+	}
+	return ret
+}
+
+func diffList(base, target []string) *models.ListDiff {
+	baseSet := make(map[string]bool)
+	for _, s := range base {
+		baseSet[s] = true
+	}
+	targetSet := make(map[string]bool)
+	for _, s := range target {
+		targetSet[s] = true
+	}
+
+	var diff models.ListDiff
+	for _, s := range target {
+		if !baseSet[s] {
+			diff.Added = append(diff.Added, s)
+		}
+	}
+	for _, s := range base {
+		if !targetSet[s] {
+			diff.Removed = append(diff.Removed, s)
+		}
+	}
+
+	if len(diff.Added) == 0 && len(diff.Removed) == 0 {
+		return nil
+	}
+	return &diff
+}
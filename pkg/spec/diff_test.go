@@ -0,0 +1,73 @@
+package spec
+
+import (
+	"testing"
+
+	"github.com/deviceplane/deviceplane/pkg/models"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDiff(t *testing.T) {
+	base, err := Parse([]byte(`
+web:
+  image: nginx:1.16
+  environment:
+  - MODE=prod
+  - DEBUG=false
+  ports:
+  - 80:80
+  volumes:
+  - /data:/data
+worker:
+  image: worker:1
+cache:
+  image: redis
+`))
+	require.NoError(t, err)
+
+	target, err := Parse([]byte(`
+web:
+  image: nginx:1.17
+  environment:
+    MODE: prod
+    DEBUG: "true"
+    LOG_LEVEL: info
+  ports:
+  - 80:80
+  - 443:443
+  restart: always
+worker:
+  image: worker:1
+metrics:
+  image: exporter
+`))
+	require.NoError(t, err)
+
+	debugFrom, debugTo, logLevel := "false", "true", "info"
+	require.Equal(t, []models.ServiceDiff{
+		{
+			Service: "cache",
+			Type:    models.ServiceDiffTypeRemoved,
+			Image:   &models.ValueDiff{From: "redis"},
+		},
+		{
+			Service: "metrics",
+			Type:    models.ServiceDiffTypeAdded,
+			Image:   &models.ValueDiff{To: "exporter"},
+		},
+		{
+			Service: "web",
+			Type:    models.ServiceDiffTypeChanged,
+			Image:   &models.ValueDiff{From: "nginx:1.16", To: "nginx:1.17"},
+			Environment: []models.KeyValueDiff{
+				{Key: "DEBUG", From: &debugFrom, To: &debugTo},
+				{Key: "LOG_LEVEL", To: &logLevel},
+			},
+			Volumes:     &models.ListDiff{Removed: []string{"/data:/data"}},
+			Ports:       &models.ListDiff{Added: []string{"443:443"}},
+			OtherFields: []string{"restart"},
+		},
+	}, Diff(base, target))
+
+	require.Empty(t, Diff(target, target))
+}
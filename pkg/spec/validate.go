@@ -3,6 +3,7 @@ package spec
 import (
 	"fmt"
 
+	"github.com/deviceplane/deviceplane/pkg/models"
 	"github.com/deviceplane/deviceplane/pkg/validation"
 	"gopkg.in/yaml.v2"
 )
@@ -94,3 +95,17 @@ func Validate(c []byte) error {
 
 	return nil
 }
+
+// Parse validates a release config and unmarshals it into its services.
+func Parse(c []byte) (map[string]models.Service, error) {
+	if err := Validate(c); err != nil {
+		return nil, err
+	}
+
+	var services map[string]models.Service
+	if err := yaml.UnmarshalStrict(c, &services); err != nil {
+		return nil, err
+	}
+
+	return services, nil
+}
@@ -16,3 +16,16 @@ func TestValidate(t *testing.T) {
 		require.NoError(t, Validate(full))
 	})
 }
+
+func TestParse(t *testing.T) {
+	services, err := Parse([]byte("web:\n  image: nginx\n  ports:\n  - 80:80\n"))
+	require.NoError(t, err)
+	require.Equal(t, "nginx", services["web"].Image)
+	require.Equal(t, []string{"80:80"}, services["web"].Ports)
+
+	_, err = Parse([]byte("web:\n  image: nginx\n  unknown: true\n"))
+	require.Error(t, err)
+
+	_, err = Parse([]byte("web: nginx\n"))
+	require.Error(t, err)
+}
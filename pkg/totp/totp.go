@@ -0,0 +1,109 @@
+package totp
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/subtle"
+	"encoding/base32"
+	"encoding/binary"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// These match the defaults of common authenticator apps
+const (
+	Digits     = 6
+	Period     = 30 * time.Second
+	secretSize = 20
+
+	// Accept codes from one period either side of the current one to allow
+	// for clock drift
+	skew = 1
+)
+
+var encoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// GenerateSecret returns a new random base32 encoded secret.
+func GenerateSecret() (string, error) {
+	secret := make([]byte, secretSize)
+	if _, err := rand.Read(secret); err != nil {
+		return "", err
+	}
+	return encoding.EncodeToString(secret), nil
+}
+
+// Code returns the code for the given secret at the given time as described
+// in RFC 6238.
+func Code(secret string, t time.Time) (string, error) {
+	key, err := encoding.DecodeString(strings.ToUpper(secret))
+	if err != nil {
+		return "", err
+	}
+	return code(key, uint64(t.Unix()/int64(Period/time.Second))), nil
+}
+
+func code(key []byte, counter uint64) string {
+	var counterBytes [8]byte
+	binary.BigEndian.PutUint64(counterBytes[:], counter)
+
+	mac := hmac.New(sha1.New, key)
+	mac.Write(counterBytes[:])
+	sum := mac.Sum(nil)
+
+	offset := sum[len(sum)-1] & 0xf
+	value := binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff
+
+	mod := uint32(1)
+	for i := 0; i < Digits; i++ {
+		mod *= 10
+	}
+	return fmt.Sprintf("%0*d", Digits, value%mod)
+}
+
+// Validate reports whether the code is valid for the secret at the given
+// time.
+func Validate(secret, candidate string, t time.Time) bool {
+	_, valid := ValidateCounter(secret, candidate, t)
+	return valid
+}
+
+// ValidateCounter is like Validate but also returns the time step that the
+// code belongs to, so that callers can refuse to accept a code twice.
+func ValidateCounter(secret, candidate string, t time.Time) (int64, bool) {
+	key, err := encoding.DecodeString(strings.ToUpper(secret))
+	if err != nil {
+		return 0, false
+	}
+
+	candidate = strings.TrimSpace(candidate)
+	counter := t.Unix() / int64(Period/time.Second)
+	var matched int64
+	valid := false
+	for i := -skew; i <= skew; i++ {
+		if subtle.ConstantTimeCompare([]byte(code(key, uint64(counter+int64(i)))), []byte(candidate)) == 1 {
+			matched = counter + int64(i)
+			valid = true
+		}
+	}
+	return matched, valid
+}
+
+// URI returns an otpauth URI that authenticator apps can import, usually
+// by scanning it as a QR code.
+func URI(issuer, account, secret string) string {
+	values := url.Values{}
+	values.Set("secret", secret)
+	values.Set("issuer", issuer)
+	values.Set("digits", fmt.Sprint(Digits))
+	values.Set("period", fmt.Sprint(int(Period/time.Second)))
+
+	return (&url.URL{
+		Scheme:   "otpauth",
+		Host:     "totp",
+		Path:     "/" + issuer + ":" + account,
+		RawQuery: values.Encode(),
+	}).String()
+}
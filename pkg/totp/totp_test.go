@@ -0,0 +1,64 @@
+package totp
+
+import (
+	"encoding/base32"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// The SHA1 test vectors from RFC 6238 truncated to six digits
+func TestCode(t *testing.T) {
+	secret := base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString([]byte("12345678901234567890"))
+
+	for unix, expected := range map[int64]string{
+		59:          "287082",
+		1111111109:  "081804",
+		1111111111:  "050471",
+		1234567890:  "005924",
+		2000000000:  "279037",
+		20000000000: "353130",
+	} {
+		code, err := Code(secret, time.Unix(unix, 0))
+		require.NoError(t, err)
+		require.Equal(t, expected, code, unix)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	secret, err := GenerateSecret()
+	require.NoError(t, err)
+
+	now := time.Now()
+	code, err := Code(secret, now)
+	require.NoError(t, err)
+
+	require.True(t, Validate(secret, code, now))
+	require.True(t, Validate(secret, code, now.Add(Period)))
+	require.True(t, Validate(secret, code, now.Add(-Period)))
+	require.False(t, Validate(secret, code, now.Add(3*Period)))
+	require.False(t, Validate(secret, "", now))
+	require.False(t, Validate("not base32!", code, now))
+}
+
+func TestValidateCounter(t *testing.T) {
+	secret, err := GenerateSecret()
+	require.NoError(t, err)
+
+	now := time.Unix(1577836800, 0)
+	code, err := Code(secret, now)
+	require.NoError(t, err)
+
+	// The code belongs to the same step whenever it's checked
+	counter, valid := ValidateCounter(secret, code, now)
+	require.True(t, valid)
+	require.Equal(t, now.Unix()/30, counter)
+
+	counter, valid = ValidateCounter(secret, code, now.Add(Period))
+	require.True(t, valid)
+	require.Equal(t, now.Unix()/30, counter)
+
+	_, valid = ValidateCounter(secret, code, now.Add(3*Period))
+	require.False(t, valid)
+}